@@ -0,0 +1,181 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A pathAccessor is a compiled form of a path that consists only
+// of names, such as Account.Order.Product. It reads the fields
+// directly, without the generic path logic, for as long as each
+// step yields a single map or struct.
+//
+// An accessor depends only on the names in its path, so the
+// expressions compiled by a Compiler share one accessor per
+// distinct path (see accessorTable).
+type pathAccessor struct {
+	names []string
+	keys  []reflect.Value
+}
+
+func newPathAccessor(names []string) *pathAccessor {
+
+	keys := make([]reflect.Value, len(names))
+	for i, name := range names {
+		keys[i] = reflect.ValueOf(name)
+	}
+
+	return &pathAccessor{
+		names: names,
+		keys:  keys,
+	}
+}
+
+// eval evaluates the path against data. If ok is false, the path
+// can't be read directly, e.g. because data or one of the steps
+// is an array, and the caller must evaluate the path as usual.
+func (a *pathAccessor) eval(data reflect.Value, env *environment) (v reflect.Value, ok bool) {
+
+	if !data.IsValid() {
+		return undefined, true
+	}
+
+	v = data
+	last := len(a.keys) - 1
+
+	for i, key := range a.keys {
+
+		if _, ok := asSequence(v); ok || isLazyArray(v) {
+			return undefined, false
+		}
+
+		switch r := jtypes.Resolve(v); {
+		case jtypes.IsMap(r):
+			v = env.convert(r.MapIndex(key))
+		case jtypes.IsStruct(r):
+			v = env.convert(jtypes.StructField(r, a.names[i]))
+		default:
+			return undefined, false
+		}
+
+		if !v.IsValid() {
+			// A Resolver may know the missing field (see
+			// WithResolver).
+			return undefined, env.state.resolver == nil
+		}
+
+		if i < last && jtypes.IsArray(v) {
+			return undefined, false
+		}
+	}
+
+	switch {
+	case isLazyArray(v):
+		return undefined, false
+	case jtypes.IsArray(v):
+		if jtypes.Resolve(v).Len() == 0 {
+			return undefined, true
+		}
+		return v, true
+	case !v.CanInterface():
+		return undefined, false
+	default:
+		return reflect.ValueOf(v.Interface()), true
+	}
+}
+
+// compilePathAccessors returns accessors for the paths in a
+// syntax tree that consist only of names. The map is keyed by
+// path node and is safe for concurrent reads. If table is not
+// nil, the accessors are shared with other expressions.
+func compilePathAccessors(root jparse.Node, table *accessorTable) (map[*jparse.PathNode]*pathAccessor, error) {
+
+	if err := checkPlanTree(root); err != nil {
+		return nil, err
+	}
+
+	var accessors map[*jparse.PathNode]*pathAccessor
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+
+		path, ok := node.(*jparse.PathNode)
+		if !ok || path.KeepArrays || len(path.Steps) == 0 || !isNamePath(path.Steps) {
+			return true
+		}
+
+		names := make([]string, len(path.Steps))
+		for i, step := range path.Steps {
+			names[i] = step.(*jparse.NameNode).Value
+		}
+
+		if accessors == nil {
+			accessors = map[*jparse.PathNode]*pathAccessor{}
+		}
+		accessors[path] = table.lookup(names)
+
+		return true
+	})
+
+	return accessors, nil
+}
+
+// An accessorTable interns the path accessors created by a
+// Compiler, so that expressions that read the same path share
+// an accessor. Deployments that compile tens of thousands of
+// expressions, such as rule sets, typically read the same few
+// paths over and over. The table is safe for concurrent use.
+// Accessors stay in the table for the Compiler's lifetime.
+type accessorTable struct {
+	mu    sync.Mutex
+	paths map[string]*pathAccessor
+}
+
+func newAccessorTable() *accessorTable {
+	return &accessorTable{
+		paths: map[string]*pathAccessor{},
+	}
+}
+
+// lookup returns the accessor for a path, creating it if it's
+// not in the table. A nil table creates a new accessor each
+// time.
+func (t *accessorTable) lookup(names []string) *pathAccessor {
+
+	if t == nil {
+		return newPathAccessor(names)
+	}
+
+	key := fmt.Sprintf("%q", names)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a, ok := t.paths[key]
+	if !ok {
+		a = newPathAccessor(names)
+		t.paths[key] = a
+	}
+
+	return a
+}
+
+// len returns the number of accessors in the table.
+func (t *accessorTable) len() int {
+
+	if t == nil {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.paths)
+}
@@ -0,0 +1,273 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+func TestPathAccessorSelection(t *testing.T) {
+
+	data := []struct {
+		Expression string
+		Accessors  int
+	}{
+		{`Account.Order.Product`, 1},
+		{`Account`, 1},
+		{`Account.Order[0].Product`, 0},
+		{`Account.Order[].Product`, 0},
+		{`Account.*.Product`, 0},
+		{`$.Account`, 0},
+		{`Account.Order.Product & Account.Name`, 2},
+		{`$map(Items, function($i){ $i.Price.Amount })`, 1},
+	}
+
+	for _, test := range data {
+
+		node, err := jparse.Parse(test.Expression)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Expression, err)
+		}
+
+		accessors, _ := compilePathAccessors(node, nil)
+		if len(accessors) != test.Accessors {
+			t.Errorf("%s: expected %d accessors, got %d", test.Expression, test.Accessors, len(accessors))
+		}
+	}
+}
+
+type testAccessorItem struct {
+	Name  string
+	Price float64 `json:"price"`
+	Tags  []string
+	When  time.Time
+	Next  *testAccessorItem
+	Extra interface{}
+}
+
+func TestPathAccessors(t *testing.T) {
+
+	item := &testAccessorItem{
+		Name:  "Hat",
+		Price: 34.45,
+		Tags:  []string{"red", "wool"},
+		When:  time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+		Next:  &testAccessorItem{Name: "Bag"},
+		Extra: map[string]interface{}{"Colour": "Red"},
+	}
+
+	input := map[string]interface{}{
+		"Item": item,
+		"Order": map[string]interface{}{
+			"Product": map[string]interface{}{
+				"Name":  "Hat",
+				"Price": 34.45,
+				"Tags":  []interface{}{"red"},
+				"None":  []interface{}{},
+				"Null":  nil,
+			},
+			"Lines": []interface{}{
+				map[string]interface{}{"Qty": 1},
+				map[string]interface{}{"Qty": 2},
+			},
+		},
+		"Nested": []interface{}{
+			[]interface{}{map[string]interface{}{"a": 1}},
+			[]interface{}{},
+		},
+	}
+
+	exprs := []string{
+		`Order.Product.Name`,
+		`Order.Product.Price`,
+		`Order.Product.Tags`,
+		`Order.Product.None`,
+		`Order.Product.Null`,
+		`Order.Product.Missing`,
+		`Order.Missing.Name`,
+		`Order.Product.Name.Length`,
+		`Order.Lines.Qty`,
+		`Order.Lines`,
+		`Nested.a`,
+		`Item.Name`,
+		`Item.price`,
+		`Item.Price`,
+		`Item.Tags`,
+		`Item.When`,
+		`Item.Next.Name`,
+		`Item.Next.Next.Name`,
+		`Item.Next.Tags`,
+		`Item.Extra.Colour`,
+	}
+
+	for _, expr := range exprs {
+
+		node, err := jparse.Parse(expr)
+		if err != nil {
+			t.Fatalf("%s: %s", expr, err)
+		}
+
+		accessors, _ := compilePathAccessors(node, nil)
+		if len(accessors) == 0 {
+			t.Errorf("%s: no accessors selected", expr)
+			continue
+		}
+
+		// Evaluate the expression with and without accessors.
+		// The results should be identical.
+		in := reflect.ValueOf(input)
+
+		env := newEnvironment(nil, 0)
+		env.state = &evalState{accessors: accessors}
+		got, gotErr := eval(node, in, env)
+
+		exp, expErr := eval(node, in, newEnvironment(nil, 0))
+
+		if !reflect.DeepEqual(gotErr, expErr) {
+			t.Errorf("%s: expected error %v, got %v", expr, expErr, gotErr)
+		}
+
+		var gotValue, expValue interface{}
+		if got.IsValid() {
+			gotValue = got.Interface()
+		}
+		if exp.IsValid() {
+			expValue = exp.Interface()
+		}
+
+		if !reflect.DeepEqual(gotValue, expValue) {
+			t.Errorf("%s: expected %v, got %v", expr, expValue, gotValue)
+		}
+	}
+}
+
+func TestPathAccessor_Fallback(t *testing.T) {
+
+	input := reflect.ValueOf(map[string]interface{}{
+		"a": map[string]interface{}{"b": 1},
+		"c": []interface{}{map[string]interface{}{"b": 2}},
+	})
+
+	data := []struct {
+		Names []string
+		OK    bool
+	}{
+		{[]string{"a", "b"}, true},
+		{[]string{"a", "x"}, true},
+		{[]string{"a", "b", "c"}, false},
+		{[]string{"c"}, true},
+		{[]string{"c", "b"}, false},
+	}
+
+	env := newEnvironment(nil, 0)
+	env.state = &evalState{}
+
+	for _, test := range data {
+		if _, ok := newPathAccessor(test.Names).eval(input, env); ok != test.OK {
+			t.Errorf("%q: expected ok to be %t, got %t", test.Names, test.OK, ok)
+		}
+	}
+
+	// With a Resolver, missing fields go through the generic
+	// path.
+	env.state.resolver = ResolverFunc(nil)
+	if _, ok := newPathAccessor([]string{"a", "x"}).eval(input, env); ok {
+		t.Errorf("expected a missing field to fall back when there is a Resolver")
+	}
+}
+
+func TestCompiler_SharedAccessors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e1 := comp.MustCompile(`Account.Order.Product`)
+	e2 := comp.MustCompile(`$count(Account.Order.Product) + $count(Account.Order)`)
+	e3 := comp.MustCompile(`Account.Order[0].Product`)
+
+	if n := comp.accessors.len(); n != 2 {
+		t.Errorf("expected 2 shared accessors, got %d", n)
+	}
+
+	find := func(e *Expression, names ...string) *pathAccessor {
+		for _, a := range e.compiled().accessors {
+			if reflect.DeepEqual(a.names, names) {
+				return a
+			}
+		}
+		return nil
+	}
+
+	a1 := find(e1, "Account", "Order", "Product")
+	a2 := find(e2, "Account", "Order", "Product")
+	if a1 == nil || a1 != a2 {
+		t.Errorf("expected expressions to share the Account.Order.Product accessor, got %p and %p", a1, a2)
+	}
+	if len(e3.compiled().accessors) != 0 {
+		t.Errorf("expected no accessors for a path with a predicate, got %d", len(e3.compiled().accessors))
+	}
+
+	// Compilers don't share accessors with each other.
+	other, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	if a := find(other.MustCompile(`Account.Order.Product`), "Account", "Order", "Product"); a == nil || a == a1 {
+		t.Errorf("expected a separate accessor from a different Compiler")
+	}
+
+	// Shared accessors have no per-expression state.
+	data := map[string]interface{}{
+		"Account": map[string]interface{}{
+			"Order": []interface{}{
+				map[string]interface{}{"Product": []interface{}{"Hat", "Bag"}},
+				map[string]interface{}{"Product": "Coat"},
+			},
+		},
+	}
+
+	got, err := e2.Eval(data, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != float64(5) {
+		t.Errorf("expected 5, got %v", got)
+	}
+}
+
+func BenchmarkPathAccessor(b *testing.B) {
+
+	data := map[string]interface{}{
+		"Account": map[string]interface{}{
+			"Order": map[string]interface{}{
+				"Product": map[string]interface{}{
+					"Price": 34.45,
+				},
+			},
+		},
+	}
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	e := comp.MustCompile(`Account.Order.Product.Price`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := e.Eval(data, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// ApplyInPlace evaluates an expression that is a transform, such
+// as
+//
+//	| servers[env = "prod"] | {"debug": false, "replicas": replicas * 2} |
+//
+// against target and makes its changes to target itself, instead
+// of returning a modified copy. target must be a non-nil pointer,
+// e.g. to a struct, or a non-nil map.
+//
+// Only the values that the transform changes are written. Each
+// one is converted to the type of the struct field, map value or
+// slice item that it replaces in the same way as encoding/json
+// would decode it, so an int field stays an int, and a value
+// that doesn't fit, e.g. 2.5 for an int, is an error. Members
+// that the transform deletes are removed from maps and set to
+// their zero values in structs. If an array changes length, or a
+// value changes between an object and something else, the whole
+// value is replaced.
+//
+// A transform can't add fields to a struct. If any change can't
+// be made, ApplyInPlace returns an error and target is left as
+// it was.
+func (e *Expression) ApplyInPlace(target interface{}) error {
+
+	dst := reflect.ValueOf(target)
+	switch {
+	case dst.Kind() == reflect.Ptr && !dst.IsNil():
+		dst = dst.Elem()
+	case dst.Kind() == reflect.Map && !dst.IsNil():
+		// The map's entries are set in place.
+		m := reflect.New(dst.Type()).Elem()
+		m.Set(dst)
+		dst = m
+	default:
+		return fmt.Errorf("ApplyInPlace needs a non-nil pointer or map, got %T", target)
+	}
+
+	before, after, err := e.evalTransform(target, nil, "ApplyInPlace")
+	if err != nil {
+		return err
+	}
+
+	var w writeBack
+	if err := w.update(dst, nil, before, after); err != nil {
+		return err
+	}
+
+	for _, op := range w.ops {
+		op()
+	}
+
+	return nil
+}
+
+// evalTransform evaluates an expression that is a transform and
+// calls it with data. It returns data before and after the
+// transform as decoded JSON. method is the name of the caller,
+// for errors.
+func (e *Expression) evalTransform(data interface{}, vars map[string]interface{}, method string) (before, after interface{}, err error) {
+
+	k := e.compiled()
+
+	err = e.withEvalEnv(context.Background(), k, e.newBaseEnv(), data, vars, nil, func(input reflect.Value, env *environment) error {
+
+		v, err := eval(k.node, input, env)
+		if err != nil {
+			return err
+		}
+
+		var f *transformationCallable
+		if v.IsValid() && v.CanInterface() {
+			f, _ = v.Interface().(*transformationCallable)
+		}
+		if f == nil {
+			return fmt.Errorf("%s needs a transform expression", method)
+		}
+		if input == undefined {
+			return fmt.Errorf("%s needs an input value", method)
+		}
+
+		orig, err := f.clone(input)
+		if err != nil {
+			return newEvalError(ErrClone, nil, nil)
+		}
+
+		res, err := f.Call([]reflect.Value{input})
+		if err != nil {
+			return err
+		}
+
+		before, after = orig.Interface(), res.Interface()
+		return nil
+	})
+
+	return before, after, err
+}
+
+// A writeBack collects the changes that ApplyInPlace makes to
+// its target, so that none of them are made unless they can all
+// be made.
+type writeBack struct {
+	ops []func()
+}
+
+// update plans the changes that turn before into after in dst,
+// which must be settable. before and after are decoded JSON.
+func (w *writeBack) update(dst reflect.Value, path []diffStep, before, after interface{}) error {
+
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() || after == nil {
+			return w.assign(dst, path, after)
+		}
+		return w.update(dst.Elem(), path, before, after)
+
+	case reflect.Interface:
+		if dst.IsNil() || after == nil {
+			return w.assign(dst, path, after)
+		}
+		// Update a copy of the dynamic value and store it
+		// back. A number or a string that can't keep its
+		// type is replaced.
+		v := reflect.New(dst.Elem().Type()).Elem()
+		v.Set(dst.Elem())
+		n := len(w.ops)
+		if err := w.update(v, path, before, after); err != nil {
+			switch v.Kind() {
+			case reflect.Map, reflect.Struct, reflect.Slice, reflect.Array, reflect.Ptr:
+				return err
+			}
+			w.ops = w.ops[:n]
+			return w.assign(dst, path, after)
+		}
+		w.ops = append(w.ops, func() { dst.Set(v) })
+		return nil
+	}
+
+	bm, bok := before.(map[string]interface{})
+	am, aok := after.(map[string]interface{})
+	if bok && aok {
+		switch dst.Kind() {
+		case reflect.Map:
+			return w.updateMap(dst, path, bm, am)
+		case reflect.Struct:
+			return w.updateStruct(dst, path, bm, am)
+		}
+	}
+
+	ba, bok := before.([]interface{})
+	aa, aok := after.([]interface{})
+	if bok && aok && len(ba) == len(aa) {
+		switch dst.Kind() {
+		case reflect.Slice, reflect.Array:
+			if dst.Len() != len(aa) {
+				break
+			}
+			for i := range aa {
+				if err := w.update(dst.Index(i), appendStep(path, diffStep{index: i}), ba[i], aa[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	return w.assign(dst, path, after)
+}
+
+func (w *writeBack) updateMap(dst reflect.Value, path []diffStep, before, after map[string]interface{}) error {
+
+	typ := dst.Type()
+	if typ.Key().Kind() != reflect.String {
+		return fmt.Errorf("cannot update %s: map keys must be strings", diffPath(path))
+	}
+
+	for _, k := range sortedKeys(after) {
+
+		b, ok := before[k]
+		if ok && reflect.DeepEqual(b, after[k]) {
+			continue
+		}
+
+		k := k
+		key := reflect.ValueOf(k).Convert(typ.Key())
+		p := appendStep(path, diffStep{key: &k})
+
+		v := reflect.New(typ.Elem()).Elem()
+		var err error
+		if old := dst.MapIndex(key); ok && old.IsValid() {
+			v.Set(old)
+			err = w.update(v, p, b, after[k])
+		} else {
+			err = w.assign(v, p, after[k])
+		}
+		if err != nil {
+			return err
+		}
+
+		w.ops = append(w.ops, func() { dst.SetMapIndex(key, v) })
+	}
+
+	for _, k := range sortedKeys(before) {
+		if _, ok := after[k]; !ok {
+			key := reflect.ValueOf(k).Convert(typ.Key())
+			w.ops = append(w.ops, func() { dst.SetMapIndex(key, reflect.Value{}) })
+		}
+	}
+
+	return nil
+}
+
+func (w *writeBack) updateStruct(dst reflect.Value, path []diffStep, before, after map[string]interface{}) error {
+
+	for _, k := range sortedKeys(after) {
+
+		b, ok := before[k]
+		if ok && reflect.DeepEqual(b, after[k]) {
+			continue
+		}
+
+		k := k
+		p := appendStep(path, diffStep{key: &k})
+
+		f := jtypes.RawStructField(dst, k)
+		if !f.IsValid() || !f.CanSet() {
+			return fmt.Errorf("cannot set %s: %s has no field %q", diffPath(p), dst.Type(), k)
+		}
+
+		var err error
+		if ok {
+			err = w.update(f, p, b, after[k])
+		} else {
+			err = w.assign(f, p, after[k])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, k := range sortedKeys(before) {
+		if _, ok := after[k]; !ok {
+			if f := jtypes.RawStructField(dst, k); f.IsValid() && f.CanSet() {
+				w.ops = append(w.ops, func() { f.Set(reflect.Zero(f.Type())) })
+			}
+		}
+	}
+
+	return nil
+}
+
+// assign plans to replace dst with a decoded JSON value, which
+// is converted to dst's type by encoding/json.
+func (w *writeBack) assign(dst reflect.Value, path []diffStep, value interface{}) error {
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot set %s: %w", diffPath(path), err)
+	}
+
+	v := reflect.New(dst.Type())
+	if err := json.Unmarshal(b, v.Interface()); err != nil {
+		return fmt.Errorf("cannot set %s: %w", diffPath(path), err)
+	}
+
+	w.ops = append(w.ops, func() { dst.Set(v.Elem()) })
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
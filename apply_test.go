@@ -0,0 +1,201 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type applyServer struct {
+	Name     string            `json:"name"`
+	Env      string            `json:"env"`
+	Replicas int               `json:"replicas"`
+	Debug    bool              `json:"debug"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Owner    *applyOwner       `json:"owner,omitempty"`
+}
+
+type applyOwner struct {
+	Team string `json:"team"`
+}
+
+type applyConfig struct {
+	Version  int           `json:"version"`
+	Updated  time.Time     `json:"updated"`
+	Servers  []applyServer `json:"servers"`
+	Backends []*applyOwner `json:"backends"`
+}
+
+func TestExpression_ApplyInPlace(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	updated := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	owner := &applyOwner{Team: "infra"}
+
+	cfg := &applyConfig{
+		Version: 1,
+		Updated: updated,
+		Servers: []applyServer{
+			{Name: "a", Env: "prod", Replicas: 2, Debug: true, Labels: map[string]string{"tier": "web", "old": "x"}},
+			{Name: "b", Env: "dev", Replicas: 1, Debug: true},
+			{Name: "c", Env: "prod", Replicas: 3, Owner: owner},
+		},
+		Backends: []*applyOwner{owner},
+	}
+	servers := cfg.Servers
+
+	expr := comp.MustCompile(`| servers[env = "prod"] | {
+		"debug": false,
+		"replicas": replicas * 2,
+		"labels": labels ~> | $ | {"zone": "eu"}, "old" |
+	} |`)
+
+	if err := expr.ApplyInPlace(cfg); err != nil {
+		t.Fatalf("ApplyInPlace failed: %v", err)
+	}
+
+	want := []applyServer{
+		{Name: "a", Env: "prod", Replicas: 4, Labels: map[string]string{"tier": "web", "zone": "eu"}},
+		{Name: "b", Env: "dev", Replicas: 1, Debug: true},
+		{Name: "c", Env: "prod", Replicas: 6, Owner: owner},
+	}
+
+	if !reflect.DeepEqual(cfg.Servers, want) {
+		t.Errorf("expected servers %+v, got %+v", want, cfg.Servers)
+	}
+	if &cfg.Servers[0] != &servers[0] {
+		t.Errorf("expected the servers to be updated in place")
+	}
+	if cfg.Servers[2].Owner != owner || cfg.Backends[0] != owner {
+		t.Errorf("expected unchanged pointers to be kept")
+	}
+	if cfg.Version != 1 || !cfg.Updated.Equal(updated) {
+		t.Errorf("expected unchanged fields to be kept, got %v and %v", cfg.Version, cfg.Updated)
+	}
+
+	// Pointers are followed.
+	expr = comp.MustCompile(`| backends | {"team": "platform"} |`)
+	if err := expr.ApplyInPlace(cfg); err != nil {
+		t.Fatalf("ApplyInPlace failed: %v", err)
+	}
+	if owner.Team != "platform" {
+		t.Errorf("expected the owner to be updated, got %q", owner.Team)
+	}
+
+	// Deleted struct fields are set to their zero values.
+	expr = comp.MustCompile(`| servers[name = "b"] | {}, ["debug", "replicas"] |`)
+	if err := expr.ApplyInPlace(cfg); err != nil {
+		t.Fatalf("ApplyInPlace failed: %v", err)
+	}
+	if s := cfg.Servers[1]; s.Debug || s.Replicas != 0 || s.Name != "b" {
+		t.Errorf("expected debug and replicas to be cleared, got %+v", s)
+	}
+}
+
+func TestExpression_ApplyInPlaceMap(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	doc := map[string]interface{}{
+		"count": 1,
+		"tags":  []interface{}{"a", "b"},
+		"limits": map[string]int{
+			"cpu": 2,
+			"mem": 4,
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"name": "a", "port": 80},
+			applyServer{Name: "b", Replicas: 1},
+		},
+	}
+	limits := doc["limits"].(map[string]int)
+
+	expr := comp.MustCompile(`| $ | {
+		"count": count + 1,
+		"tags": [tags, "c"],
+		"limits": limits ~> | $ | {"cpu": cpu * 2}, "mem" |,
+		"servers": servers ~> $map(function($s) { $s ~> | $ | {"replicas": 2} | })
+	} |`)
+
+	if err := expr.ApplyInPlace(doc); err != nil {
+		t.Fatalf("ApplyInPlace failed: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"count":  2,
+		"tags":   []interface{}{"a", "b", "c"},
+		"limits": map[string]int{"cpu": 4},
+		"servers": []interface{}{
+			map[string]interface{}{"name": "a", "port": 80, "replicas": float64(2)},
+			applyServer{Name: "b", Replicas: 2},
+		},
+	}
+
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("expected %#v, got %#v", want, doc)
+	}
+	if limits["cpu"] != 4 {
+		t.Errorf("expected the limits map to be updated in place")
+	}
+}
+
+func TestExpression_ApplyInPlaceErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr   string
+		target interface{}
+		err    string
+	}{
+		{
+			expr:   `| $ | {"replicas": 2.5} |`,
+			target: &applyServer{Name: "a", Replicas: 1, Env: "dev"},
+			err:    "cannot set replicas:",
+		},
+		{
+			expr:   `| $ | {"env": "prod", "color": "red"} |`,
+			target: &applyServer{Name: "a", Replicas: 1, Env: "dev"},
+			err:    `cannot set color: jsonata.applyServer has no field "color"`,
+		},
+		{
+			expr:   `$ ~> | $ | {"env": "prod"} |`,
+			target: &applyServer{Name: "a", Replicas: 1, Env: "dev"},
+			err:    "needs a transform expression",
+		},
+		{
+			expr:   `| $ | {"env": "prod"} |`,
+			target: applyServer{Name: "a", Replicas: 1, Env: "dev"},
+			err:    "needs a non-nil pointer or map",
+		},
+	}
+
+	for _, test := range tests {
+
+		err := comp.MustCompile(test.expr).ApplyInPlace(test.target)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, got %v", test.expr, test.err, err)
+			continue
+		}
+
+		want := applyServer{Name: "a", Replicas: 1, Env: "dev"}
+		if s, ok := test.target.(*applyServer); ok && !reflect.DeepEqual(*s, want) {
+			t.Errorf("%s: expected the target to be unchanged, got %+v", test.expr, *s)
+		}
+	}
+}
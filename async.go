@@ -0,0 +1,441 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A Future is the result of an asynchronous extension function.
+//
+// Extension functions can start work in the background and
+// return either a Future or a receive-only channel instead of
+// a value. The evaluator waits for the result when the function
+// returns. The exceptions are $map and function calls in path
+// steps, which call the function for every item first and then
+// wait for all of the results. This allows slow lookups to run
+// concurrently:
+//
+//	$map(orders, function($o) { $enrich($o) })
+//	orders.$enrich($)
+//
+// When a function returns a channel, the evaluator receives a
+// single value from it. If the value is an error, evaluation
+// fails with that error. If the channel is closed without a
+// value, the result is undefined.
+//
+// If the evaluation's context (see Expression.EvalContext) is
+// cancelled while waiting, evaluation stops and the context's
+// error is returned.
+type Future interface {
+	// Await blocks until the result is available or until
+	// ctx is cancelled. A nil result with a nil error is
+	// treated as undefined.
+	Await(ctx context.Context) (interface{}, error)
+}
+
+var typeFuture = reflect.TypeOf((*Future)(nil)).Elem()
+
+// An asyncResult is a pending result from an asynchronous
+// extension function or from a call that has been added to a
+// batch (see Extension.CallBatch).
+type asyncResult struct {
+	future Future
+	ch     reflect.Value
+	batch  *pendingBatch
+	index  int
+}
+
+// newAsyncResult returns an asyncResult if v is a Future
+// or a channel. Otherwise it returns false.
+func newAsyncResult(v reflect.Value) (*asyncResult, bool) {
+
+	if !v.IsValid() {
+		return nil, false
+	}
+
+	// Only call Interface if the value might be a Future. It's
+	// relatively expensive for non-pointer types.
+	if v.Kind() == reflect.Interface || v.Type().Implements(typeFuture) {
+		if f, ok := v.Interface().(Future); ok && f != nil {
+			return &asyncResult{future: f}, true
+		}
+	}
+
+	ch := jtypes.Resolve(v)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		return nil, false
+	}
+
+	return &asyncResult{ch: ch}, true
+}
+
+func (r *asyncResult) await(ctx context.Context) (reflect.Value, error) {
+
+	if r.batch != nil {
+		return r.batch.result(r.index)
+	}
+
+	if r.future != nil {
+		v, err := r.future.Await(ctx)
+		if err != nil {
+			if err == jtypes.ErrUndefined {
+				err = nil
+			}
+			return undefined, err
+		}
+		return reflect.ValueOf(v), nil
+	}
+
+	// A nil channel would block forever.
+	if r.ch.IsNil() {
+		return undefined, nil
+	}
+
+	cases := []reflect.SelectCase{
+		{
+			Dir:  reflect.SelectRecv,
+			Chan: r.ch,
+		},
+		{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(ctx.Done()),
+		},
+	}
+
+	chosen, v, ok := reflect.Select(cases)
+	if chosen == 1 {
+		return undefined, ctx.Err()
+	}
+
+	if !ok {
+		return undefined, nil
+	}
+
+	if v.CanInterface() {
+		if err, isErr := v.Interface().(error); isErr && err != nil {
+			if err == jtypes.ErrUndefined {
+				err = nil
+			}
+			return undefined, err
+		}
+	}
+
+	return v, nil
+}
+
+func asAsyncResult(v reflect.Value) (*asyncResult, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+	r, ok := v.Interface().(*asyncResult)
+	return r, ok
+}
+
+// await waits for v if it's a pending asynchronous result.
+// Other values are returned unchanged.
+func await(v reflect.Value, env *environment) (reflect.Value, error) {
+	return awaitContext(env.ctx(), v)
+}
+
+func awaitContext(ctx context.Context, v reflect.Value) (reflect.Value, error) {
+	if r, ok := asAsyncResult(v); ok {
+		return r.await(ctx)
+	}
+	return v, nil
+}
+
+// awaitAll is like await except that it also waits for any
+// pending results in an array. Undefined results are dropped
+// from the array.
+func awaitAll(v reflect.Value, env *environment) (reflect.Value, error) {
+
+	if r, ok := asAsyncResult(v); ok {
+		return r.await(env.ctx())
+	}
+
+	if !v.IsValid() || !v.CanInterface() {
+		return v, nil
+	}
+
+	items, ok := v.Interface().([]interface{})
+	if !ok || !hasAsyncResults(items) {
+		return v, nil
+	}
+
+	var results []interface{}
+
+	for _, item := range items {
+
+		r, ok := item.(*asyncResult)
+		if !ok {
+			results = append(results, item)
+			continue
+		}
+
+		res, err := r.await(env.ctx())
+		if err != nil {
+			return undefined, err
+		}
+
+		if res.IsValid() && res.CanInterface() {
+			results = append(results, res.Interface())
+		}
+	}
+
+	return reflect.ValueOf(results), nil
+}
+
+func hasAsyncResults(items []interface{}) bool {
+	for _, item := range items {
+		if _, ok := item.(*asyncResult); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// An awaitingCallable wraps a Callable that is passed as an
+// argument to a Go function. Go functions don't know about
+// asynchronous results so, by default, the wrapper waits for
+// them before returning.
+//
+// If the Go function fans out (see goCallable.fansOut), the
+// wrapper does the opposite. Results are returned while still
+// pending, batchable calls are added to batches and lambda
+// functions defer their final function call (see evalTail).
+// The evaluator then waits for all of the results when the
+// Go function returns.
+type awaitingCallable struct {
+	jtypes.Callable
+	env     *environment
+	batches *batchSet
+}
+
+func (f *awaitingCallable) Call(argv []reflect.Value) (reflect.Value, error) {
+
+	if f.batches != nil {
+		switch fn := f.Callable.(type) {
+		case *lambdaCallable:
+			return fn.call(argv, f.batches)
+		case *goCallable:
+			return fn.callBatched(argv, f.batches)
+		default:
+			return fn.Call(argv)
+		}
+	}
+
+	v, err := f.Callable.Call(argv)
+	if err != nil {
+		return undefined, err
+	}
+
+	return await(v, f.env)
+}
+
+// wrapCallableArgs wraps any Callables in a Go function's
+// argument list with awaitingCallables. If the function fans
+// out, batches must be non-nil.
+func wrapCallableArgs(fn *goCallable, argv []reflect.Value, env *environment, batches *batchSet) {
+
+	for i, arg := range argv {
+
+		callable, ok := jtypes.AsCallable(arg)
+		if !ok {
+			continue
+		}
+
+		switch callable.(type) {
+		case *lambdaCallable:
+			// Lambdas wait for their own results unless
+			// they are being deferred.
+			if !fn.fansOut {
+				continue
+			}
+		case *goCallable, *partialCallable, *chainCallable:
+		default:
+			continue
+		}
+
+		f := &awaitingCallable{
+			Callable: callable,
+			env:      env,
+		}
+		if fn.fansOut {
+			f.batches = batches
+		}
+
+		argv[i] = reflect.ValueOf(f)
+	}
+}
+
+// evalTail is like eval except that if node is a function
+// call, or a block that ends with a function call, the result
+// of the call is returned without waiting for it. If the call
+// can be batched, it is added to batches.
+func evalTail(node jparse.Node, data reflect.Value, env *environment, batches *batchSet) (reflect.Value, error) {
+
+	// Traced and profiled evaluations visit every node.
+	if env.tracing() || env.profiling() {
+		return eval(node, data, env)
+	}
+
+	switch node := node.(type) {
+	case *jparse.FunctionCallNode:
+		visitTail(node, env)
+		v, err := callFunction(node, data, env, batches)
+		if err != nil {
+			return undefined, env.recordError(node, err)
+		}
+		if seq, ok := asSequence(v); ok {
+			v = seq.Value()
+		}
+		return v, nil
+	case *jparse.BlockNode:
+		var err error
+		var res reflect.Value
+
+		visitTail(node, env)
+		env = newEnvironment(env, 0)
+
+		for i, expr := range node.Exprs {
+			if i == len(node.Exprs)-1 {
+				return evalTail(expr, data, env, batches)
+			}
+			res, err = eval(expr, data, env)
+			if err != nil {
+				return undefined, err
+			}
+		}
+
+		return res, nil
+	default:
+		return eval(node, data, env)
+	}
+}
+
+// visitTail records a node that evalTail evaluates without
+// calling evalNode in the evaluation's statistics and coverage,
+// as evalNode would.
+func visitTail(node jparse.Node, env *environment) {
+	if env != nil && env.state != nil && env.state.stats != nil {
+		env.state.stats.node(env.state.depth + 1)
+	}
+	env.cover(node)
+}
+
+// callOverItems evaluates a function call path step for each
+// item in an array. Like $map, it makes all of the calls before
+// waiting for any of the results.
+func callOverItems(node *jparse.FunctionCallNode, n int, item func(int) reflect.Value, env *environment) ([]reflect.Value, error) {
+
+	var results []reflect.Value
+	batches := newBatchSet()
+
+	for i := 0; i < n; i++ {
+
+		res, err := evalTail(node, item(i), env, batches)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.IsValid() {
+			if results == nil {
+				results = make([]reflect.Value, 0, n)
+			}
+			results = append(results, res)
+		}
+	}
+
+	j := 0
+	for _, res := range results {
+
+		res, err := await(res, env)
+		if err != nil {
+			return nil, env.recordError(node, err)
+		}
+
+		if res.IsValid() {
+			results[j] = res
+			j++
+		}
+	}
+
+	return results[:j], nil
+}
+
+// A batchSet collects calls to batchable functions made while
+// fanning out over an array.
+type batchSet struct {
+	batches map[*goCallable]*pendingBatch
+}
+
+func newBatchSet() *batchSet {
+	return &batchSet{}
+}
+
+// add adds a call to the batch for the given function and
+// returns its pending result.
+func (s *batchSet) add(fn *goCallable, args []interface{}) *asyncResult {
+
+	b := s.batches[fn]
+	if b == nil || b.done {
+		b = &pendingBatch{
+			fn: fn,
+		}
+		if s.batches == nil {
+			s.batches = map[*goCallable]*pendingBatch{}
+		}
+		s.batches[fn] = b
+	}
+
+	b.args = append(b.args, args)
+
+	return &asyncResult{
+		batch: b,
+		index: len(b.args) - 1,
+	}
+}
+
+// A pendingBatch is a set of calls to a batchable function.
+// The function is called, once, when the first result is
+// needed.
+type pendingBatch struct {
+	fn      *goCallable
+	args    [][]interface{}
+	results []interface{}
+	err     error
+	done    bool
+}
+
+func (b *pendingBatch) result(i int) (reflect.Value, error) {
+
+	if !b.done {
+		b.done = true
+		b.results, b.err = b.fn.batch(b.args)
+		if b.err == nil && len(b.results) != len(b.args) {
+			b.err = fmt.Errorf("%s: CallBatch returned %d results for %d calls",
+				b.fn.Name(), len(b.results), len(b.args))
+		}
+	}
+
+	if b.err != nil {
+		if b.err == jtypes.ErrUndefined {
+			return undefined, nil
+		}
+		return undefined, b.err
+	}
+
+	if b.results[i] == nil {
+		return undefined, nil
+	}
+
+	return reflect.ValueOf(b.results[i]), nil
+}
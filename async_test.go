@@ -0,0 +1,482 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testFuture struct {
+	v   interface{}
+	err error
+}
+
+func (f testFuture) Await(ctx context.Context) (interface{}, error) {
+	return f.v, f.err
+}
+
+func asyncDouble(n float64) <-chan float64 {
+	ch := make(chan float64, 1)
+	go func() {
+		ch <- n * 2
+	}()
+	return ch
+}
+
+func TestAsyncExtensions(t *testing.T) {
+
+	errLookup := errors.New("lookup failed")
+
+	exts := map[string]Extension{
+		"double": {
+			Func: asyncDouble,
+		},
+		"future": {
+			Func: func(s string) Future {
+				return testFuture{v: s + "!"}
+			},
+		},
+		"fail": {
+			Func: func() <-chan error {
+				ch := make(chan error, 1)
+				ch <- errLookup
+				return ch
+			},
+		},
+		"nothing": {
+			Func: func() <-chan interface{} {
+				ch := make(chan interface{})
+				close(ch)
+				return ch
+			},
+		},
+		"isOdd": {
+			Func: func(n float64) chan bool {
+				ch := make(chan bool, 1)
+				ch <- int(n)%2 == 1
+				return ch
+			},
+		},
+	}
+
+	data := []struct {
+		Expression string
+		Output     interface{}
+		Error      error
+	}{
+		{
+			Expression: `$double(21)`,
+			Output:     float64(42),
+		},
+		{
+			Expression: `$double($double(1)) + 1`,
+			Output:     float64(5),
+		},
+		{
+			Expression: `3 ~> $double()`,
+			Output:     float64(6),
+		},
+		{
+			Expression: `$future("hello")`,
+			Output:     "hello!",
+		},
+		{
+			Expression: `$fail()`,
+			Error:      errLookup,
+		},
+		{
+			Expression: `$nothing()`,
+			Error:      ErrUndefined,
+		},
+		{
+			Expression: `$map([1, 2, 3], $double)`,
+			Output:     []interface{}{float64(2), float64(4), float64(6)},
+		},
+		{
+			Expression: `$map([1, 2, 3], function($n) { $double($n) })`,
+			Output:     []interface{}{float64(2), float64(4), float64(6)},
+		},
+		{
+			Expression: `$map([1, 2, 3], function($n) { ($x := $n + 1; $double($x)) })`,
+			Output:     []interface{}{float64(4), float64(6), float64(8)},
+		},
+		{
+			Expression: `$map([1, 2, 3], function($n) { $double($n) + 1 })`,
+			Output:     []interface{}{float64(3), float64(5), float64(7)},
+		},
+		{
+			// Like the synchronous equivalent, this returns
+			// an empty array.
+			Expression: `$map([1, 2], function($n) { $nothing() })`,
+			Output:     []interface{}(nil),
+		},
+		{
+			Expression: `$map([1, 2], function($n) { $fail() })`,
+			Error:      errLookup,
+		},
+		{
+			Expression: `$filter([1, 2, 3, 4, 5], $isOdd)`,
+			Output:     []interface{}{float64(1), float64(3), float64(5)},
+		},
+		{
+			Expression: `$filter([1, 2, 3, 4, 5], $isOdd(?))`,
+			Output:     []interface{}{float64(1), float64(3), float64(5)},
+		},
+		{
+			Expression: `($f := $double ~> $double; $f(2))`,
+			Output:     float64(8),
+		},
+	}
+
+	comp, err := NewCompiler(nil, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	for _, test := range data {
+
+		expr, err := comp.Compile(test.Expression)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.Expression, err)
+		}
+
+		output, err := expr.Eval(nil, nil)
+
+		if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("%s: expected %v, got %v", test.Expression, test.Output, output)
+		}
+
+		// Extension errors are wrapped in an EvalError.
+		var evalErr *EvalError
+		if errors.As(err, &evalErr) && evalErr.Type == ErrWrapped {
+			err = evalErr.Err
+		}
+
+		if !reflect.DeepEqual(err, test.Error) {
+			t.Errorf("%s: expected error %v, got %v", test.Expression, test.Error, err)
+		}
+	}
+}
+
+func TestAsyncFanOut(t *testing.T) {
+
+	const n = 5
+
+	// Each call blocks until all n calls have started. If
+	// $map waited for each result in turn, the first call
+	// would never complete.
+	var started sync.WaitGroup
+	started.Add(n)
+
+	exts := map[string]Extension{
+		"enrich": {
+			Func: func(id float64) <-chan map[string]interface{} {
+				started.Done()
+				ch := make(chan map[string]interface{}, 1)
+				go func() {
+					started.Wait()
+					ch <- map[string]interface{}{"id": id}
+				}()
+				return ch
+			},
+		},
+	}
+
+	comp, err := NewCompiler(nil, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err := comp.Compile(`$map(ids, function($id) { $enrich($id) }).id`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input := map[string]interface{}{
+		"ids": []interface{}{1, 2, 3, 4, 5},
+	}
+
+	output, err := expr.EvalContext(ctx, input, nil)
+	if err != nil {
+		t.Fatalf("EvalContext failed: %v", err)
+	}
+
+	exp := []interface{}{float64(1), float64(2), float64(3), float64(4), float64(5)}
+	if !reflect.DeepEqual(output, exp) {
+		t.Errorf("expected %v, got %v", exp, output)
+	}
+}
+
+func TestAsyncCancel(t *testing.T) {
+
+	exts := map[string]Extension{
+		"hang": {
+			Func: func() <-chan interface{} {
+				return make(chan interface{})
+			},
+		},
+	}
+
+	comp, err := NewCompiler(nil, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err := comp.Compile(`$map([1, 2, 3], function() { $hang() })`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = expr.EvalContext(ctx, nil, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestBatchExtensions(t *testing.T) {
+
+	var calls int
+	var batches []int
+
+	exts := map[string]Extension{
+		"lookup": {
+			Func: func(id float64) (interface{}, error) {
+				calls++
+				return id * 10, nil
+			},
+			CallBatch: func(args [][]interface{}) ([]interface{}, error) {
+				batches = append(batches, len(args))
+				results := make([]interface{}, len(args))
+				for i, a := range args {
+					if id := a[0].(float64); id != 3 {
+						results[i] = id * 10
+					}
+				}
+				return results, nil
+			},
+			UndefinedHandler: defaultUndefinedHandler,
+		},
+		"bad": {
+			Func: func(id float64) float64 {
+				return id
+			},
+			CallBatch: func(args [][]interface{}) ([]interface{}, error) {
+				return nil, nil
+			},
+		},
+	}
+
+	data := []struct {
+		Expression string
+		Output     interface{}
+		Error      error
+		Calls      int
+		Batches    []int
+	}{
+		{
+			Expression: `$lookup(1)`,
+			Output:     float64(10),
+			Calls:      1,
+		},
+		{
+			Expression: `$map([1, 2, 3, 4], $lookup)`,
+			Output:     []interface{}{float64(10), float64(20), float64(40)},
+			Batches:    []int{4},
+		},
+		{
+			Expression: `$map([1, 2, 4], function($id) { $lookup($id + 1) })`,
+			Output:     []interface{}{float64(20), float64(50)},
+			Batches:    []int{3},
+		},
+		{
+			Expression: `[1, 2, 4].$lookup($)`,
+			Output:     []interface{}{float64(10), float64(20), float64(40)},
+			Batches:    []int{3},
+		},
+		{
+			Expression: `items.$lookup(id)`,
+			Output:     []interface{}{float64(10), float64(20)},
+			Batches:    []int{2},
+		},
+		{
+			// Undefined arguments are handled before batching.
+			Expression: `items.$lookup(missing)`,
+			Error:      ErrUndefined,
+		},
+		{
+			// Calls that are not the final call in the lambda
+			// are not batched.
+			Expression: `$map([1, 2], function($id) { $lookup($id) + 1 })`,
+			Output:     []interface{}{float64(11), float64(21)},
+			Calls:      2,
+		},
+		{
+			Expression: `$map([1, 2], $bad)`,
+			Error:      fmt.Errorf("bad: CallBatch returned 0 results for 2 calls"),
+		},
+	}
+
+	comp, err := NewCompiler(nil, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": 1},
+			map[string]interface{}{"id": 2},
+		},
+	}
+
+	for _, test := range data {
+
+		calls, batches = 0, nil
+
+		expr, err := comp.Compile(test.Expression)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.Expression, err)
+		}
+
+		output, err := expr.Eval(input, nil)
+
+		if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("%s: expected %v, got %v", test.Expression, test.Output, output)
+		}
+
+		// Extension errors are wrapped in an EvalError.
+		var evalErr *EvalError
+		if errors.As(err, &evalErr) && evalErr.Type == ErrWrapped {
+			err = evalErr.Err
+		}
+
+		if !reflect.DeepEqual(err, test.Error) {
+			t.Errorf("%s: expected error %v, got %v", test.Expression, test.Error, err)
+		}
+
+		if calls != test.Calls {
+			t.Errorf("%s: expected %d calls to Func, got %d", test.Expression, test.Calls, calls)
+		}
+
+		if !reflect.DeepEqual(batches, test.Batches) {
+			t.Errorf("%s: expected batch sizes %v, got %v", test.Expression, test.Batches, batches)
+		}
+	}
+}
+
+type testContextKey struct{}
+
+func TestContextExtensions(t *testing.T) {
+
+	exts := map[string]Extension{
+		"user": {
+			Func: func(ctx context.Context, id string) (string, error) {
+				name, ok := ctx.Value(testContextKey{}).(string)
+				if !ok {
+					name = "none"
+				}
+				return name + ":" + id, nil
+			},
+		},
+		"wait": {
+			Func: func(ctx context.Context) (interface{}, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		},
+	}
+
+	comp, err := NewCompiler(nil, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	data := []struct {
+		Expression string
+		Output     interface{}
+	}{
+		{
+			Expression: `$user("a")`,
+			Output:     "alice:a",
+		},
+		{
+			Expression: `$map(["a", "b"], $user)`,
+			Output:     []interface{}{"alice:a", "alice:b"},
+		},
+		{
+			Expression: `$map(["a", "b"], function($id) { $user($id) })`,
+			Output:     []interface{}{"alice:a", "alice:b"},
+		},
+		{
+			Expression: `($f := $user(?); $f("c"))`,
+			Output:     "alice:c",
+		},
+		{
+			Expression: `"d" ~> $user()`,
+			Output:     "alice:d",
+		},
+	}
+
+	ctx := context.WithValue(context.Background(), testContextKey{}, "alice")
+
+	for _, test := range data {
+
+		expr, err := comp.Compile(test.Expression)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.Expression, err)
+		}
+
+		output, err := expr.EvalContext(ctx, nil, nil)
+		if err != nil {
+			t.Errorf("%s: EvalContext failed: %v", test.Expression, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("%s: expected %v, got %v", test.Expression, test.Output, output)
+		}
+	}
+
+	expr, err := comp.Compile(`$user("e")`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	// Eval uses a background context.
+	if output, err := expr.Eval(nil, nil); err != nil || output != "none:e" {
+		t.Errorf("Eval: expected none:e, got %v (error %v)", output, err)
+	}
+
+	// Evaluators use the context of each evaluation.
+	ev := expr.NewEvaluator()
+	for _, name := range []string{"bob", "carol"} {
+		ctx := context.WithValue(context.Background(), testContextKey{}, name)
+		output, err := ev.EvalContext(ctx, nil, nil)
+		if err != nil || output != name+":e" {
+			t.Errorf("Evaluator: expected %s:e, got %v (error %v)", name, output, err)
+		}
+	}
+
+	expr, err = comp.Compile(`$wait()`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := expr.EvalContext(ctx, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+}
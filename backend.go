@@ -0,0 +1,223 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// A Backend identifies how an Expression is evaluated.
+type Backend string
+
+const (
+	// BackendTree evaluates every node of an expression with
+	// the tree-walking evaluator.
+	BackendTree Backend = "tree"
+
+	// BackendOptimized evaluates the nodes that have compiled
+	// plans, such as filter kernels, path accessors, parallel
+	// steps and memoized subexpressions, with those plans, and
+	// the rest with the tree-walking evaluator. It's the
+	// default.
+	BackendOptimized Backend = "optimized"
+)
+
+// An Optimization is a kind of compiled plan used by the
+// optimized backend.
+type Optimization string
+
+const (
+	// OptFilterKernels is set for expressions with predicates
+	// that compare a value with a number or string literal, as
+	// in Order[Price > 100].
+	OptFilterKernels Optimization = "filter-kernels"
+
+	// OptPathAccessors is set for expressions with paths that
+	// consist only of names (see Shared path accessors).
+	OptPathAccessors Optimization = "path-accessors"
+
+	// OptFastPath is set for expressions that are only a path
+	// of names and numeric indexes, such as foo.bar[0].baz,
+	// which are evaluated without creating environments when
+	// the input allows it.
+	OptFastPath Optimization = "fast-path"
+
+	// OptParallel is set for expressions with steps that can be
+	// evaluated in parallel (see WithParallelism).
+	OptParallel Optimization = "parallel"
+
+	// OptMemoization is set for expressions with repeated pure
+	// subexpressions (see WithMemoization).
+	OptMemoization Optimization = "memoization"
+)
+
+// WithBackend selects the backend that the Compiler's expressions
+// use. BackendTree turns off every optimization, e.g. to compare
+// results or timings with the optimized backend, or to rule it
+// out while investigating a problem.
+func WithBackend(b Backend) CompilerOption {
+	return func(c *Compiler) error {
+		switch b {
+		case BackendTree, BackendOptimized:
+		default:
+			return fmt.Errorf("unknown backend %q", b)
+		}
+		c.backend = b
+		return nil
+	}
+}
+
+// BackendInfo describes the backend of a compiled expression.
+type BackendInfo struct {
+	// Backend is the backend that was selected. It's
+	// BackendTree if the expression has no compiled plans,
+	// even if the optimized backend was requested.
+	Backend Backend
+
+	// Optimizations lists the kinds of compiled plans that the
+	// expression uses.
+	Optimizations []Optimization
+
+	// Fallback is the reason that the expression fell back to
+	// the tree-walking evaluator, if the optimized backend
+	// couldn't compile it. It's nil otherwise.
+	Fallback error
+}
+
+// Backend reports which backend the expression was compiled for
+// and which optimizations it uses. Optimizations are chosen per
+// node, so a construct that an optimization doesn't support is
+// simply evaluated by the tree-walking evaluator. If the plans
+// can't be compiled at all, e.g. for a hand-built syntax tree
+// with nil nodes, the whole expression falls back to the
+// tree-walking evaluator and Fallback says why, rather than
+// Compile failing. This makes it safe to turn optimizations on
+// for every expression in a deployment.
+func (e *Expression) Backend() *BackendInfo {
+
+	k := e.compiled()
+
+	info := &BackendInfo{
+		Backend:  BackendTree,
+		Fallback: k.fallback,
+	}
+
+	if len(k.kernels) > 0 {
+		info.Optimizations = append(info.Optimizations, OptFilterKernels)
+	}
+	if len(k.accessors) > 0 {
+		info.Optimizations = append(info.Optimizations, OptPathAccessors)
+	}
+	if k.fast != nil {
+		info.Optimizations = append(info.Optimizations, OptFastPath)
+	}
+	if k.parallel != nil {
+		info.Optimizations = append(info.Optimizations, OptParallel)
+	}
+	if k.memo != nil {
+		info.Optimizations = append(info.Optimizations, OptMemoization)
+	}
+
+	if len(info.Optimizations) > 0 {
+		info.Backend = BackendOptimized
+	}
+
+	return info
+}
+
+// compilePlans compiles the optimized backend's plans for a
+// syntax tree into k. If the Compiler uses the tree backend, or
+// a plan compiler reports an unsupported construct, k gets no
+// plans. In the latter case, the reason is returned as an error.
+func (c *Compiler) compilePlans(k *compiledExpr, node jparse.Node) error {
+
+	if c.backend == BackendTree {
+		return nil
+	}
+
+	var err error
+
+	k.kernels, err = compileFilterKernels(node, c.equal != nil)
+	if err == nil {
+		k.accessors, err = compilePathAccessors(node, c.accessors)
+	}
+	if err == nil {
+		k.fast, err = compileFastPath(node)
+	}
+	if err == nil {
+		k.parallel, err = compileParallelPlan(node, c.parallelism)
+	}
+	if err == nil {
+		k.memo, err = compileMemoPlan(node, c.memoize)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(*unsupportedError); !ok {
+		panicf("optimized backend: %s", err)
+	}
+
+	k.kernels = nil
+	k.accessors = nil
+	k.fast = nil
+	k.parallel = nil
+	k.memo = nil
+
+	return fmt.Errorf("optimized backend: %w", err)
+}
+
+// An unsupportedError is returned by a plan compiler for a
+// syntax tree that it can't compile, such as a hand-built tree
+// with nil nodes. The expression falls back to the tree-walking
+// evaluator.
+type unsupportedError struct {
+	node jparse.Node
+}
+
+func (e *unsupportedError) Error() string {
+	if e.node == nil {
+		return "unsupported construct: nil node"
+	}
+	return fmt.Sprintf("unsupported construct: nil %T", e.node)
+}
+
+// checkPlanTree returns an unsupportedError if a syntax tree
+// contains nodes that the plan compilers can't compile. The plan
+// compilers call it before they inspect the tree.
+func checkPlanTree(root jparse.Node) error {
+
+	var err error
+
+	check := func(node jparse.Node) bool {
+		if node == nil {
+			err = &unsupportedError{}
+			return false
+		}
+		if v := reflect.ValueOf(node); v.Kind() == reflect.Ptr && v.IsNil() {
+			err = &unsupportedError{node: node}
+			return false
+		}
+		return true
+	}
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+		if err != nil || !check(node) {
+			return false
+		}
+		for _, child := range jparse.Children(node) {
+			if !check(child) {
+				return false
+			}
+		}
+		return true
+	})
+
+	return err
+}
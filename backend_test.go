@@ -0,0 +1,132 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+func TestExpression_Backend(t *testing.T) {
+
+	data := map[string]interface{}{
+		"Order": []interface{}{
+			map[string]interface{}{"Price": 50.0},
+			map[string]interface{}{"Price": 150.0},
+		},
+	}
+
+	optimized, err := NewCompiler(nil, nil, WithParallelism(4), WithMemoization())
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	tree, err := NewCompiler(nil, nil, WithParallelism(4), WithMemoization(), WithBackend(BackendTree))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		Expression string
+		Backend    Backend
+		Opts       []Optimization
+	}{
+		{
+			Expression: `1 + 2`,
+			Backend:    BackendTree,
+		},
+		{
+			Expression: `Order[Price > 100]`,
+			Backend:    BackendOptimized,
+			Opts:       []Optimization{OptFilterKernels, OptPathAccessors, OptParallel},
+		},
+		{
+			Expression: `$sum(Order.Price) / $sum(Order.Price)`,
+			Backend:    BackendOptimized,
+			Opts:       []Optimization{OptPathAccessors, OptParallel, OptMemoization},
+		},
+	}
+
+	for _, test := range tests {
+
+		e := optimized.MustCompile(test.Expression)
+		info := e.Backend()
+
+		if info.Backend != test.Backend || !reflect.DeepEqual(info.Optimizations, test.Opts) || info.Fallback != nil {
+			t.Errorf("%s: expected backend %s with %v, got %s with %v (%v)", test.Expression, test.Backend, test.Opts, info.Backend, info.Optimizations, info.Fallback)
+		}
+
+		// The tree backend gives the same results.
+		te := tree.MustCompile(test.Expression)
+		if info := te.Backend(); info.Backend != BackendTree || len(info.Optimizations) != 0 {
+			t.Errorf("%s: expected the tree backend, got %s with %v", test.Expression, info.Backend, info.Optimizations)
+		}
+
+		want, err1 := e.Eval(data, nil)
+		got, err2 := te.Eval(data, nil)
+		if !reflect.DeepEqual(got, want) || err1 != err2 {
+			t.Errorf("%s: expected %v (%v) from the tree backend, got %v (%v)", test.Expression, want, err1, got, err2)
+		}
+	}
+}
+
+func TestExpression_BackendFallback(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	// A hand-built tree that the path accessors can't handle
+	// falls back to the tree backend.
+	node := &jparse.BlockNode{
+		Exprs: []jparse.Node{
+			&jparse.PredicateNode{
+				Expr: &jparse.NameNode{Value: "Order"},
+				Filters: []jparse.Node{
+					&jparse.ComparisonOperatorNode{
+						Type: jparse.ComparisonGreater,
+						LHS:  &jparse.NameNode{Value: "Price"},
+						RHS:  &jparse.NumberNode{Value: 100},
+					},
+				},
+			},
+			&jparse.PathNode{
+				Steps: []jparse.Node{(*jparse.NameNode)(nil)},
+			},
+		},
+	}
+
+	info := comp.newExpression(node, nil, "").Backend()
+	if info.Backend != BackendTree || len(info.Optimizations) != 0 {
+		t.Errorf("expected the tree backend, got %s with %v", info.Backend, info.Optimizations)
+	}
+	if info.Fallback == nil || info.Fallback.Error() != "optimized backend: unsupported construct: nil *jparse.NameNode" {
+		t.Errorf("expected a fallback reason, got %v", info.Fallback)
+	}
+
+	var unsupported *unsupportedError
+	if !errors.As(info.Fallback, &unsupported) {
+		t.Errorf("expected an *unsupportedError, got %T", info.Fallback)
+	}
+
+	// So does a tree with a missing node.
+	path := &jparse.PathNode{
+		Steps: []jparse.Node{&jparse.NameNode{Value: "Order"}, nil},
+	}
+
+	info = comp.newExpression(path, nil, "").Backend()
+	if info.Backend != BackendTree || info.Fallback == nil || info.Fallback.Error() != "optimized backend: unsupported construct: nil node" {
+		t.Errorf("expected the tree backend with a fallback reason, got %s (%v)", info.Backend, info.Fallback)
+	}
+}
+
+func TestCompiler_WithBackend(t *testing.T) {
+	if _, err := NewCompiler(nil, nil, WithBackend("bytecode")); err == nil || err.Error() != `unknown backend "bytecode"` {
+		t.Errorf("expected an unknown backend error, got %v", err)
+	}
+}
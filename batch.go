@@ -0,0 +1,120 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// BatchOptions configure EvalBatch.
+type BatchOptions struct {
+	// Workers is the number of goroutines that evaluate the
+	// inputs. Zero means runtime.GOMAXPROCS(0).
+	Workers int
+
+	// Vars are the variables for every evaluation.
+	Vars map[string]interface{}
+
+	// StopOnError cancels the evaluations that haven't started
+	// when one fails. By default, every input is evaluated.
+	StopOnError bool
+}
+
+// A BatchResult is the outcome of evaluating one input of a
+// batch. Err is ErrUndefined if the result is undefined.
+type BatchResult struct {
+	Value interface{}
+	Err   error
+}
+
+// EvalBatch evaluates the expression against each of the inputs
+// using a pool of worker goroutines, and returns their results
+// in the same order as the inputs. opts may be nil. Each worker
+// reuses one Evaluator for all of its inputs.
+//
+// Failed evaluations don't stop the batch unless
+// BatchOptions.StopOnError is set, in which case the first
+// failure is also returned as the error. Otherwise, the returned
+// error is only non-nil if ctx is done before every input has
+// been evaluated. The inputs that weren't evaluated have the
+// returned error as their Err.
+//
+// The inputs must not be modified while they're being
+// evaluated.
+func (e *Expression) EvalBatch(ctx context.Context, inputs []interface{}, opts *BatchOptions) ([]BatchResult, error) {
+
+	var o BatchOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	workers := o.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(inputs) {
+		workers = len(inputs)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]BatchResult, len(inputs))
+	indexes := make(chan int)
+
+	var mu sync.Mutex
+	var stopErr error
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			ev := e.NewEvaluator()
+			for i := range indexes {
+				v, err := ev.EvalContext(ctx, inputs[i], o.Vars)
+				results[i] = BatchResult{Value: v, Err: err}
+
+				if err != nil && err != ErrUndefined && o.StopOnError {
+					mu.Lock()
+					if stopErr == nil {
+						stopErr = err
+						cancel()
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	next := 0
+
+feed:
+	for ; next < len(inputs) && ctx.Err() == nil; next++ {
+		select {
+		case indexes <- next:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	err := stopErr
+	if err == nil && next < len(inputs) {
+		err = ctx.Err()
+	}
+
+	for i := next; i < len(inputs); i++ {
+		results[i].Err = err
+	}
+
+	return results, err
+}
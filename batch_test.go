@@ -0,0 +1,120 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestExpression_EvalBatch(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`price * qty * $rate`)
+
+	inputs := make([]interface{}, 100)
+	for i := range inputs {
+		inputs[i] = map[string]interface{}{"price": float64(i), "qty": 2.0}
+	}
+	inputs[10] = map[string]interface{}{"price": "x", "qty": 2.0}
+	inputs[20] = map[string]interface{}{}
+
+	results, err := e.EvalBatch(context.Background(), inputs, &BatchOptions{
+		Workers: 4,
+		Vars:    map[string]interface{}{"rate": 0.5},
+	})
+	if err != nil {
+		t.Fatalf("EvalBatch failed: %v", err)
+	}
+
+	if len(results) != len(inputs) {
+		t.Fatalf("expected %d results, got %d", len(inputs), len(results))
+	}
+
+	for i, res := range results {
+		switch i {
+		case 10:
+			if res.Err == nil || res.Err == ErrUndefined {
+				t.Errorf("input %d: expected an evaluation error, got %v", i, res.Err)
+			}
+		case 20:
+			if res.Err != ErrUndefined {
+				t.Errorf("input %d: expected ErrUndefined, got %v", i, res.Err)
+			}
+		default:
+			if res.Err != nil || res.Value != float64(i) {
+				t.Errorf("input %d: expected %d, got %v (error %v)", i, i, res.Value, res.Err)
+			}
+		}
+	}
+
+	results, err = e.EvalBatch(context.Background(), nil, nil)
+	if err != nil || len(results) != 0 {
+		t.Errorf("empty batch: expected no results, got %v (error %v)", results, err)
+	}
+}
+
+func TestExpression_EvalBatchStop(t *testing.T) {
+
+	var calls int32
+	errBad := errors.New("bad input")
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"check": {Func: func(v float64) (float64, error) {
+			atomic.AddInt32(&calls, 1)
+			if v == 3 {
+				return 0, errBad
+			}
+			return v, nil
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`$check($)`)
+
+	inputs := make([]interface{}, 1000)
+	for i := range inputs {
+		inputs[i] = float64(i)
+	}
+
+	results, err := e.EvalBatch(context.Background(), inputs, &BatchOptions{
+		Workers:     1,
+		StopOnError: true,
+	})
+	if !errors.Is(err, errBad) {
+		t.Fatalf("expected %v, got %v", errBad, err)
+	}
+
+	if n := atomic.LoadInt32(&calls); n >= int32(len(inputs)) {
+		t.Errorf("expected the batch to stop early, got %d calls", n)
+	}
+
+	if !reflect.DeepEqual(results[2], BatchResult{Value: 2.0}) {
+		t.Errorf("expected input 2 to succeed, got %+v", results[2])
+	}
+	if results[len(results)-1].Err != err {
+		t.Errorf("expected the last input to fail with %v, got %v", err, results[len(results)-1].Err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err = e.EvalBatch(ctx, inputs, nil)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if results[len(results)-1].Err != context.Canceled {
+		t.Errorf("expected the last input to fail with context.Canceled, got %v", results[len(results)-1].Err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package bench provides a set of representative JSONata
+// workloads and a harness for running them. It's intended to
+// help users measure the effect of compiler options on their
+// own hardware before enabling them in production.
+//
+//	results, err := bench.Run(bench.Workloads(), jsonata.WithRoundingMode(jlib.RoundHalfUp))
+//	if err != nil {
+//		...
+//	}
+//	for _, r := range results {
+//		fmt.Println(r)
+//	}
+package bench
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+// A Workload is a JSONata expression paired with the input data
+// it is evaluated against.
+type Workload struct {
+	// Name identifies the workload in results.
+	Name string
+
+	// Expression is the JSONata expression to evaluate.
+	Expression string
+
+	// Input returns the data that the expression is
+	// evaluated against. It is called once per run, outside
+	// of the timed section.
+	Input func() interface{}
+}
+
+// A Result holds the measurements for a single workload.
+type Result struct {
+	Workload    string
+	N           int
+	NsPerOp     int64
+	AllocsPerOp int64
+	BytesPerOp  int64
+}
+
+// Duration returns the average time taken by one evaluation.
+func (r Result) Duration() time.Duration {
+	return time.Duration(r.NsPerOp)
+}
+
+// String returns the result formatted in the style of the go
+// test tool's benchmark output.
+func (r Result) String() string {
+	return fmt.Sprintf("%-24s %10d %12d ns/op %10d B/op %8d allocs/op",
+		r.Workload, r.N, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+}
+
+// Run compiles each workload with a Compiler configured with
+// the given options and measures how long it takes to evaluate.
+// Workloads are run sequentially in the order given. Run returns
+// an error if a workload fails to compile or evaluate.
+func Run(workloads []Workload, opts ...jsonata.CompilerOption) ([]Result, error) {
+
+	compiler, err := jsonata.NewCompiler(nil, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(workloads))
+
+	for _, w := range workloads {
+		res, err := runWorkload(compiler, w)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", w.Name, err)
+		}
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+func runWorkload(compiler *jsonata.Compiler, w Workload) (Result, error) {
+
+	expr, err := compiler.Compile(w.Expression)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var input interface{}
+	if w.Input != nil {
+		input = w.Input()
+	}
+
+	// Evaluate once up front so that errors are reported
+	// rather than hidden inside the benchmark loop.
+	if _, err := expr.Eval(input, nil); err != nil && err != jsonata.ErrUndefined {
+		return Result{}, err
+	}
+
+	br := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			expr.Eval(input, nil)
+		}
+	})
+
+	return Result{
+		Workload:    w.Name,
+		N:           br.N,
+		NsPerOp:     br.NsPerOp(),
+		AllocsPerOp: br.AllocsPerOp(),
+		BytesPerOp:  br.AllocedBytesPerOp(),
+	}, nil
+}
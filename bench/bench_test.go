@@ -0,0 +1,80 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package bench_test
+
+import (
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/bench"
+)
+
+func TestWorkloads(t *testing.T) {
+
+	compiler, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, w := range bench.Workloads() {
+
+		expr, err := compiler.Compile(w.Expression)
+		if err != nil {
+			t.Errorf("%s: %s", w.Name, err)
+			continue
+		}
+
+		var input interface{}
+		if w.Input != nil {
+			input = w.Input()
+		}
+
+		if _, err := expr.Eval(input, nil); err != nil {
+			t.Errorf("%s: %s", w.Name, err)
+		}
+	}
+}
+
+func TestRunError(t *testing.T) {
+
+	_, err := bench.Run([]bench.Workload{
+		{
+			Name:       "bad",
+			Expression: `1 + "a"`,
+		},
+	})
+
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func BenchmarkWorkloads(b *testing.B) {
+
+	compiler, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, w := range bench.Workloads() {
+
+		expr, err := compiler.Compile(w.Expression)
+		if err != nil {
+			b.Fatalf("%s: %s", w.Name, err)
+		}
+
+		var input interface{}
+		if w.Input != nil {
+			input = w.Input()
+		}
+
+		b.Run(w.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				expr.Eval(input, nil)
+			}
+		})
+	}
+}
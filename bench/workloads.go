@@ -0,0 +1,106 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package bench
+
+import (
+	"fmt"
+)
+
+// Workloads returns the standard set of workloads. Each call
+// returns a new slice which the caller is free to modify.
+func Workloads() []Workload {
+	return []Workload{
+		{
+			Name:       "path",
+			Expression: `Account.Order.Product.SKU`,
+			Input:      orders(100, 5),
+		},
+		{
+			Name:       "predicate",
+			Expression: `Account.Order.Product[Price > 50].SKU`,
+			Input:      orders(100, 5),
+		},
+		{
+			Name:       "aggregate",
+			Expression: `$sum(Account.Order.Product.(Price * Quantity))`,
+			Input:      orders(100, 5),
+		},
+		{
+			Name:       "arithmetic",
+			Expression: `$map([1..1000], function($n) { ($n * 3 + 1) % 7 < 3 ? $n / 2 : -$n })`,
+		},
+		{
+			Name:       "strings",
+			Expression: `$join(Account.Order.Product.$uppercase($substring(SKU, 0, 4)), ",")`,
+			Input:      orders(100, 5),
+		},
+		{
+			Name:       "concat",
+			Expression: `Account.Order.(OrderID & ": " & $string($count(Product)) & " items")`,
+			Input:      orders(100, 5),
+		},
+		{
+			Name:       "sort",
+			Expression: `Account.Order.Product^(>Price, SKU).SKU`,
+			Input:      orders(100, 5),
+		},
+		{
+			Name:       "group",
+			Expression: `Account.Order.Product{Colour: $sum(Price)}`,
+			Input:      orders(100, 5),
+		},
+		{
+			Name:       "reduce",
+			Expression: `$reduce(Account.Order.Product, function($acc, $p) { $append($acc, $p.Price) }, [])`,
+			Input:      orders(100, 5),
+		},
+		{
+			Name:       "transform",
+			Expression: `Account.Order ~> | Product | {"Total": Price * Quantity}, ["Description"] |`,
+			Input:      orders(20, 5),
+		},
+	}
+}
+
+var colours = []string{"Red", "Green", "Blue", "Black", "White"}
+
+// orders returns a function that generates a document with
+// the given number of orders, each containing the given number
+// of products. The values are deterministic so that results
+// are comparable between runs.
+func orders(nOrders, nProducts int) func() interface{} {
+	return func() interface{} {
+
+		orders := make([]interface{}, nOrders)
+
+		for i := range orders {
+
+			products := make([]interface{}, nProducts)
+
+			for j := range products {
+				n := i*nProducts + j
+				products[j] = map[string]interface{}{
+					"SKU":         fmt.Sprintf("SKU-%06d", n),
+					"Price":       float64(n%97) + 0.99,
+					"Quantity":    float64(n%5 + 1),
+					"Colour":      colours[n%len(colours)],
+					"Description": fmt.Sprintf("Product number %d", n),
+				}
+			}
+
+			orders[i] = map[string]interface{}{
+				"OrderID": fmt.Sprintf("order%04d", i),
+				"Product": products,
+			}
+		}
+
+		return map[string]interface{}{
+			"Account": map[string]interface{}{
+				"Name":  "Firefly",
+				"Order": orders,
+			},
+		}
+	}
+}
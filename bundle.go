@@ -0,0 +1,396 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// A Bundle is a set of named expressions that are evaluated
+// together against the same input, as in a rule engine. Pure
+// subexpressions that appear more than once in the bundle, such
+// as several rules filtering the same path, are evaluated once
+// per input and the result is shared.
+//
+// A subexpression is shared if it's a path (other than a plain
+// chain of names), a filter, a sort, a group or a descendant
+// search that is evaluated against the input itself, rather
+// than against an item in a path or in a function, and which
+// doesn't refer to any variables or call any functions or
+// custom operators. Leading
+// steps that are common to more than one path are shared too,
+// so Orders[Status="open"].Total and Orders[Status="open"].Qty
+// evaluate the filter once.
+//
+// A Bundle is safe for concurrent use.
+type Bundle struct {
+	names []string
+	exprs []*Expression
+	plan  *sharedPlan
+
+	hits   int64
+	misses int64
+}
+
+// BundleStats reports how well a Bundle shares work between
+// its expressions.
+type BundleStats struct {
+	// Shared is the number of distinct subexpressions that
+	// the Bundle evaluates once per input.
+	Shared int
+
+	// Hits is the number of times a shared result was reused
+	// and Misses is the number of times one was computed,
+	// over all evaluations of the Bundle.
+	Hits   int64
+	Misses int64
+}
+
+// CompileBundle compiles a set of expressions, keyed by name,
+// into a Bundle.
+func (c *Compiler) CompileBundle(exprs map[string]string) (*Bundle, error) {
+
+	b := &Bundle{
+		names: make([]string, 0, len(exprs)),
+	}
+
+	for name := range exprs {
+		b.names = append(b.names, name)
+	}
+	sort.Strings(b.names)
+
+	roots := make([]jparse.Node, len(b.names))
+
+	for i, name := range b.names {
+		e, err := c.Compile(exprs[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		b.exprs = append(b.exprs, e)
+		roots[i] = e.art.pin().node
+	}
+
+	b.plan = newSharedPlan(roots)
+	return b, nil
+}
+
+// Names returns the names of the Bundle's expressions in
+// sorted order.
+func (b *Bundle) Names() []string {
+	return append([]string(nil), b.names...)
+}
+
+// Eval evaluates every expression in the Bundle with the given
+// input and variables. Expressions are evaluated in name order.
+// The results are keyed by name; expressions that evaluate to
+// undefined are omitted. If an expression returns an error,
+// evaluation stops and the error is returned, prefixed with the
+// expression's name.
+func (b *Bundle) Eval(data interface{}, vars map[string]interface{}) (map[string]interface{}, error) {
+	return b.EvalContext(context.Background(), data, vars)
+}
+
+// EvalContext is like Eval but uses ctx for the evaluations. See
+// Expression.EvalContext.
+func (b *Bundle) EvalContext(ctx context.Context, data interface{}, vars map[string]interface{}) (map[string]interface{}, error) {
+
+	cache := &sharedCache{
+		plan:   b.plan,
+		values: map[string]reflect.Value{},
+	}
+
+	results := make(map[string]interface{}, len(b.exprs))
+
+	if len(b.exprs) > 0 {
+		ctx = b.exprs[0].evalIDContext(ctx)
+	}
+
+	for i, e := range b.exprs {
+
+		res, err := e.evalWithBase(ctx, e.newBaseEnv(), data, vars, cache)
+		if err == ErrUndefined {
+			continue
+		}
+		if err != nil {
+			b.addStats(cache)
+			return nil, fmt.Errorf("%s: %w", b.names[i], err)
+		}
+
+		results[b.names[i]] = res
+	}
+
+	b.addStats(cache)
+	return results, nil
+}
+
+// Stats returns the Bundle's cache statistics.
+func (b *Bundle) Stats() BundleStats {
+	return BundleStats{
+		Shared: b.plan.size(),
+		Hits:   atomic.LoadInt64(&b.hits),
+		Misses: atomic.LoadInt64(&b.misses),
+	}
+}
+
+func (b *Bundle) addStats(cache *sharedCache) {
+	atomic.AddInt64(&b.hits, cache.hits)
+	atomic.AddInt64(&b.misses, cache.misses)
+}
+
+// A sharedPlan records which subexpressions of a Bundle are
+// shared. Nodes and path prefixes are mapped to keys that are
+// the same for subexpressions that evaluate to the same value.
+type sharedPlan struct {
+	nodes    map[jparse.Node]string
+	prefixes map[*jparse.PathNode][]string
+}
+
+func newSharedPlan(roots []jparse.Node) *sharedPlan {
+
+	counts := map[string]int{}
+
+	for _, root := range roots {
+		walkInputNodes(root, func(node jparse.Node) bool {
+			if key, ok := sharedKey(node); ok {
+				counts[key]++
+			}
+			if path, ok := node.(*jparse.PathNode); ok {
+				for _, key := range prefixKeys(path) {
+					if key != "" {
+						counts[key]++
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	plan := &sharedPlan{
+		nodes:    map[jparse.Node]string{},
+		prefixes: map[*jparse.PathNode][]string{},
+	}
+
+	for _, root := range roots {
+		walkInputNodes(root, func(node jparse.Node) bool {
+
+			if key, ok := sharedKey(node); ok && counts[key] > 1 {
+				plan.nodes[node] = key
+				return false
+			}
+
+			path, ok := node.(*jparse.PathNode)
+			if !ok {
+				return true
+			}
+
+			keys := prefixKeys(path)
+			shared := false
+			for i, key := range keys {
+				if key != "" && counts[key] > 1 {
+					shared = true
+				} else {
+					keys[i] = ""
+				}
+			}
+			if shared {
+				plan.prefixes[path] = keys
+			}
+
+			return true
+		})
+	}
+
+	return plan
+}
+
+// size returns the number of distinct shared subexpressions.
+func (p *sharedPlan) size() int {
+
+	keys := map[string]bool{}
+
+	for _, key := range p.nodes {
+		keys[key] = true
+	}
+	for _, pk := range p.prefixes {
+		for _, key := range pk {
+			if key != "" {
+				keys[key] = true
+			}
+		}
+	}
+
+	return len(keys)
+}
+
+// walkInputNodes calls fn for each node in a syntax tree that is
+// evaluated against the input of the expression, as opposed to
+// an item in a path, a group or a function. If fn returns false,
+// the node's children are not visited.
+func walkInputNodes(node jparse.Node, fn func(jparse.Node) bool) {
+
+	if node == nil || !fn(node) {
+		return
+	}
+
+	var children []jparse.Node
+
+	switch node := node.(type) {
+	case *jparse.BlockNode:
+		children = node.Exprs
+	case *jparse.ArrayNode:
+		children = node.Items
+	case *jparse.ConditionalNode:
+		children = jparse.Children(node)
+	case *jparse.AssignmentNode:
+		children = []jparse.Node{node.Value}
+	case *jparse.FunctionCallNode:
+		children = node.Args
+	case *jparse.FunctionApplicationNode:
+		children = []jparse.Node{node.LHS}
+	case *jparse.NegationNode, *jparse.RangeNode, *jparse.NumericOperatorNode,
+		*jparse.ComparisonOperatorNode, *jparse.BooleanOperatorNode,
+		*jparse.StringConcatenationNode, *jparse.CustomOperatorNode:
+		children = jparse.Children(node)
+	}
+
+	for _, child := range children {
+		walkInputNodes(child, fn)
+	}
+}
+
+// sharedKey returns the key for a node that can be shared.
+func sharedKey(node jparse.Node) (string, bool) {
+
+	switch node := node.(type) {
+	case *jparse.PathNode:
+		if isNamePath(node.Steps) {
+			return "", false
+		}
+	case *jparse.PredicateNode, *jparse.SortNode, *jparse.GroupNode,
+		*jparse.DescendentNode:
+	default:
+		return "", false
+	}
+
+	if !isPure(node) {
+		return "", false
+	}
+
+	return fmt.Sprintf("%T %s", node, node), true
+}
+
+// prefixKeys returns keys for the leading steps of a path, one
+// per step except for the last. Paths that can't be shared have
+// no keys.
+func prefixKeys(path *jparse.PathNode) []string {
+
+	if len(path.Steps) < 2 || !isPure(path) {
+		return nil
+	}
+
+	keys := make([]string, len(path.Steps)-1)
+	for i := range keys {
+		if isNamePath(path.Steps[:i+1]) {
+			// Field lookups are cheaper than the cache.
+			continue
+		}
+		prefix := &jparse.PathNode{
+			Steps: path.Steps[:i+1],
+		}
+		keys[i] = "prefix " + prefix.String()
+	}
+
+	return keys
+}
+
+// isNamePath returns true if a path consists only of names.
+func isNamePath(steps []jparse.Node) bool {
+	for _, step := range steps {
+		if _, ok := step.(*jparse.NameNode); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// isPure returns true if the result of a node depends only on
+// its input.
+func isPure(node jparse.Node) bool {
+
+	pure := true
+
+	jparse.Walk(node, func(node jparse.Node) bool {
+		switch node := node.(type) {
+		case *jparse.VariableNode:
+			pure = node.Name == "" || node.Name == "$"
+		case *jparse.FunctionCallNode, *jparse.FunctionApplicationNode,
+			*jparse.PartialNode, *jparse.LambdaNode, *jparse.TypedLambdaNode,
+			*jparse.ObjectTransformationNode, *jparse.AssignmentNode,
+			*jparse.CustomOperatorNode:
+			// Custom operators call Go functions, like
+			// extensions.
+			pure = false
+		}
+		return pure
+	})
+
+	return pure
+}
+
+// A sharedCache holds the results of shared subexpressions for
+// a single evaluation of a Bundle.
+type sharedCache struct {
+	plan   *sharedPlan
+	values map[string]reflect.Value
+	hits   int64
+	misses int64
+}
+
+func (c *sharedCache) lookup(key string) (reflect.Value, bool) {
+	v, ok := c.values[key]
+	if ok {
+		c.hits++
+	}
+	return v, ok
+}
+
+func (c *sharedCache) store(key string, v reflect.Value) {
+	c.values[key] = v
+	c.misses++
+}
+
+// sharedNode returns the key and cache for a shared node, or a
+// nil cache if the node isn't shared.
+func (s *environment) sharedNode(node jparse.Node) (string, *sharedCache) {
+	if s == nil || s.state == nil || s.state.shared == nil {
+		return "", nil
+	}
+	cache := s.state.shared
+	key, ok := cache.plan.nodes[node]
+	if !ok {
+		return "", nil
+	}
+	return key, cache
+}
+
+// sharedPrefixes returns the prefix keys and cache for a path
+// with shared leading steps, or a nil cache if there are none.
+func (s *environment) sharedPrefixes(node *jparse.PathNode) ([]string, *sharedCache) {
+	if s == nil || s.state == nil || s.state.shared == nil {
+		return nil, nil
+	}
+	cache := s.state.shared
+	keys, ok := cache.plan.prefixes[node]
+	if !ok {
+		return nil, nil
+	}
+	return keys, cache
+}
@@ -0,0 +1,195 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+func TestBundle(t *testing.T) {
+
+	var lookups int
+
+	exts := map[string]Extension{
+		"lookup": {
+			Func: func(s string) string {
+				lookups++
+				return strings.ToUpper(s)
+			},
+		},
+	}
+
+	comp, err := NewCompiler(nil, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	bundle, err := comp.CompileBundle(map[string]string{
+		"bigOrder":   `$sum(orders[status = "open"].total) > 100`,
+		"manyOrders": `$count(orders[status = "open"]) > 2`,
+		"quantity":   `$sum(orders[status = "open"].qty)`,
+		"vip":        `customer.tier = "gold" and $count(orders[status = "open"]) > 1`,
+		"region":     `$lookup(customer.region)`,
+		"byStatus":   `orders{status: $count($)}`,
+		"closed":     `orders[status = "closed"].total`,
+		"missing":    `orders[status = "lost"].total`,
+		"threshold":  `orders[total > $min]`,
+	})
+	if err != nil {
+		t.Fatalf("CompileBundle failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"customer": map[string]interface{}{
+			"tier":   "gold",
+			"region": "emea",
+		},
+		"orders": []interface{}{
+			map[string]interface{}{"status": "open", "total": 50, "qty": 1},
+			map[string]interface{}{"status": "open", "total": 70, "qty": 2},
+			map[string]interface{}{"status": "closed", "total": 20, "qty": 3},
+		},
+	}
+
+	want := map[string]interface{}{
+		"bigOrder":   true,
+		"manyOrders": false,
+		"quantity":   float64(3),
+		"vip":        true,
+		"region":     "EMEA",
+		"byStatus":   map[string]interface{}{"open": 2, "closed": 1},
+		"closed":     20,
+		"threshold":  input["orders"].([]interface{})[1],
+	}
+
+	// The filter orders[status = "open"] (used by manyOrders
+	// and vip) and the path prefix orders[status = "open"]
+	// (used by bigOrder and quantity) are shared. The filter
+	// on $min is not, because it uses a variable.
+	const shared = 2
+
+	for i := 1; i <= 3; i++ {
+
+		got, err := bundle.Eval(input, map[string]interface{}{"min": 60})
+		if err != nil {
+			t.Fatalf("Eval failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+
+		stats := bundle.Stats()
+		exp := BundleStats{
+			Shared: shared,
+			Hits:   int64(2 * i),
+			Misses: int64(2 * i),
+		}
+		if stats != exp {
+			t.Errorf("expected stats %+v, got %+v", exp, stats)
+		}
+	}
+
+	// Functions are not shared.
+	if lookups != 3 {
+		t.Errorf("expected 3 calls to $lookup, got %d", lookups)
+	}
+
+	names := []string{"bigOrder", "byStatus", "closed", "manyOrders", "missing", "quantity", "region", "threshold", "vip"}
+	if got := bundle.Names(); !reflect.DeepEqual(got, names) {
+		t.Errorf("expected names %v, got %v", names, got)
+	}
+}
+
+func TestBundle_CustomOperators(t *testing.T) {
+
+	var calls int
+
+	comp, err := NewCompiler(nil, nil, WithOperator("matches", Operator{
+		Precedence: jparse.PrecedenceCompare,
+		Func: func(s, prefix string) bool {
+			calls++
+			return strings.HasPrefix(s, prefix)
+		},
+	}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	bundle, err := comp.CompileBundle(map[string]string{
+		"count": `$count(orders[status matches "op"])`,
+		"open":  `orders[status matches "op"]`,
+	})
+	if err != nil {
+		t.Fatalf("CompileBundle failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"status": "open", "total": 50},
+			map[string]interface{}{"status": "closed", "total": 20},
+		},
+	}
+
+	got, err := bundle.Eval(input, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"count": 1,
+		"open":  input["orders"].([]interface{})[0],
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Like functions, custom operators are not shared.
+	if stats := bundle.Stats(); stats.Shared != 0 {
+		t.Errorf("expected nothing to be shared, got %+v", stats)
+	}
+	if calls != 4 {
+		t.Errorf("expected 4 calls to matches, got %d", calls)
+	}
+}
+
+func TestBundleErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	if _, err := comp.CompileBundle(map[string]string{"bad": "orders["}); err == nil {
+		t.Errorf("expected error for invalid expression")
+	} else if !strings.HasPrefix(err.Error(), "bad: ") {
+		t.Errorf("expected error to start with the expression name, got %q", err)
+	}
+
+	bundle, err := comp.CompileBundle(map[string]string{
+		"ok":  `a`,
+		"err": `a + "x"`,
+	})
+	if err != nil {
+		t.Fatalf("CompileBundle failed: %v", err)
+	}
+
+	_, err = bundle.Eval(map[string]interface{}{"a": 1}, nil)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) {
+		t.Errorf("expected the error to wrap an EvalError, got %T", err)
+	}
+	if !strings.HasPrefix(err.Error(), "err: ") {
+		t.Errorf("expected error to start with the expression name, got %q", err)
+	}
+}
@@ -5,6 +5,7 @@
 package jsonata
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -84,6 +85,24 @@ type goCallable struct {
 	undefinedHandler jtypes.ArgHandler
 	contextHandler   jtypes.ArgHandler
 	context          reflect.Value
+	fansOut          bool
+	parallelCalls    bool
+	batch            func([][]interface{}) ([]interface{}, error)
+	takesContext     bool
+	evalCtx          *evalContextRef
+	isExtension      bool
+	signature        []jparse.Param
+	signatureText    string
+	description      string
+	deprecated       string
+}
+
+// An evalContextRef holds the context.Context of the current
+// evaluation for Go functions that take one. It's shared by
+// the callables in an environment created by newBaseEnv and
+// is updated at the start of each evaluation.
+type evalContextRef struct {
+	ctx context.Context
 }
 
 // clone returns a shallow copy of the callable with cleared
@@ -108,6 +127,21 @@ func newGoCallable(name string, ext Extension) (*goCallable, error) {
 		return nil, err
 	}
 
+	var sig []jparse.Param
+	if ext.Signature != "" {
+		if ext.EvalContextHandler != nil {
+			return nil, fmt.Errorf("an extension cannot have both a signature and an EvalContextHandler")
+		}
+		var err error
+		sig, err = jparse.ParseSignature(ext.Signature)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateSignature(sig, params, t.IsVariadic()); err != nil {
+			return nil, err
+		}
+	}
+
 	return &goCallable{
 		callableName: callableName{
 			name: name,
@@ -117,10 +151,27 @@ func newGoCallable(name string, ext Extension) (*goCallable, error) {
 		isVariadic:       t.IsVariadic(),
 		undefinedHandler: ext.UndefinedHandler,
 		contextHandler:   ext.EvalContextHandler,
+		batch:            ext.CallBatch,
+		takesContext:     takesContext(t),
+		signature:        sig,
+		signatureText:    ext.Signature,
+		description:      ext.Description,
+		deprecated:       ext.Deprecated,
 	}, nil
 }
 
-var typeError = reflect.TypeOf((*error)(nil)).Elem()
+var (
+	typeError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// takesContext returns true if the first parameter of a Go
+// function is a context.Context. The evaluator passes the
+// context of the current evaluation (see Expression.EvalContext)
+// in that parameter, so it's not visible to JSONata.
+func takesContext(typ reflect.Type) bool {
+	return typ.NumIn() > 0 && typ.In(0) == typeContext
+}
 
 func validateGoCallableFunc(fn interface{}) error {
 
@@ -186,9 +237,42 @@ func validateGoCallableParams(params []goCallableParam, isVariadic bool) error {
 	return nil
 }
 
+// validateSignature checks that a type signature matches the
+// parameters of a Go function.
+func validateSignature(sig []jparse.Param, params []goCallableParam, isVariadic bool) error {
+
+	if len(sig) != len(params) {
+		return fmt.Errorf("signature has %d parameters, func has %d", len(sig), len(params))
+	}
+
+	for i, p := range sig {
+		switch p.Option {
+		case jparse.ParamContextable:
+			if i > 0 {
+				return fmt.Errorf("only the first parameter can be contextable")
+			}
+		case jparse.ParamVariadic:
+			if i < len(sig)-1 {
+				return fmt.Errorf("only the last parameter can be variadic")
+			}
+		}
+	}
+
+	if hasVariadic := len(sig) > 0 && sig[len(sig)-1].Option == jparse.ParamVariadic; hasVariadic != isVariadic {
+		return fmt.Errorf("signature must have a variadic parameter if and only if func is variadic")
+	}
+
+	return nil
+}
+
 func makeGoCallableParams(typ reflect.Type) []goCallableParam {
 
-	paramCount := typ.NumIn()
+	first := 0
+	if takesContext(typ) {
+		first = 1
+	}
+
+	paramCount := typ.NumIn() - first
 	if paramCount == 0 {
 		return nil
 	}
@@ -198,7 +282,7 @@ func makeGoCallableParams(typ reflect.Type) []goCallableParam {
 
 	for i := range params {
 
-		t := typ.In(i)
+		t := typ.In(first + i)
 		if isVariadic && i == paramCount-1 {
 			// The type of the final parameter in a variadic
 			// function is a slice of the declared type. Call
@@ -237,23 +321,88 @@ func (c *goCallable) Call(argv []reflect.Value) (reflect.Value, error) {
 		return undefined, err
 	}
 
+	if c.takesContext {
+		argv = append([]reflect.Value{reflect.ValueOf(c.callContext())}, argv...)
+	}
+
 	results := c.fn.Call(argv)
 
 	if len(results) == 2 && !results[1].IsNil() {
 		err := results[1].Interface().(error)
 		if err == jtypes.ErrUndefined {
-			err = nil
+			return undefined, nil
+		}
+		if c.isExtension {
+			err = &ExtensionError{
+				Func:     c.Name(),
+				Position: -1,
+				Err:      err,
+			}
 		}
 		return undefined, err
 	}
 
+	if r, ok := newAsyncResult(results[0]); ok {
+		return reflect.ValueOf(r), nil
+	}
+
 	return results[0], nil
 }
 
+// callContext returns the context to pass to a Go function
+// that takes one.
+func (c *goCallable) callContext() context.Context {
+	if c.evalCtx == nil || c.evalCtx.ctx == nil {
+		return context.Background()
+	}
+	return c.evalCtx.ctx
+}
+
+// callBatched is like Call except that, if the function has a
+// batch implementation, the call is added to a batch and a
+// pending result is returned.
+func (c *goCallable) callBatched(argv []reflect.Value, batches *batchSet) (reflect.Value, error) {
+
+	if c.batch == nil || batches == nil {
+		return c.Call(argv)
+	}
+
+	var err error
+
+	argv, err = c.validateArgCount(argv)
+	if err != nil {
+		if err == jtypes.ErrUndefined {
+			err = nil
+		}
+		return undefined, err
+	}
+
+	argv, err = c.validateArgTypes(argv)
+	if err != nil {
+		return undefined, err
+	}
+
+	args := make([]interface{}, len(argv))
+	for i, arg := range argv {
+		if arg.IsValid() && arg.CanInterface() {
+			args[i] = arg.Interface()
+		}
+	}
+
+	return reflect.ValueOf(batches.add(c, args)), nil
+}
+
 func (c *goCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value, error) {
 
 	argc := len(argv)
 
+	if c.signature != nil {
+		var err error
+		if argv, err = c.applySignature(argv); err != nil {
+			return nil, err
+		}
+	}
+
 	if c.contextHandler != nil && c.contextHandler(argv) {
 		// TODO: Return an error if the evaluation context
 		// is not the correct type.
@@ -289,11 +438,79 @@ func (c *goCallable) validateArgCount(argv []reflect.Value) ([]reflect.Value, er
 	return argv, nil
 }
 
+// applySignature checks arguments against the callable's type
+// signature. It inserts the evaluation context for a missing
+// contextable argument and zero values for missing or undefined
+// optional arguments.
+func (c *goCallable) applySignature(argv []reflect.Value) ([]reflect.Value, error) {
+
+	argc := len(argv)
+	sig := c.signature
+
+	// As in jsonata-js, the context is only used if the first
+	// argument can't be passed to the first parameter.
+	if argc < len(sig) && sig[0].Option == jparse.ParamContextable &&
+		(argc == 0 || argv[0] == undefined || !validArgType(argv[0], sig[0])) {
+		newargv := make([]reflect.Value, 1, len(argv)+1)
+		newargv[0] = c.context
+		argv = append(newargv, argv...)
+	} else {
+		argv = append([]reflect.Value(nil), argv...)
+	}
+
+	for i := len(argv); i < len(sig); i++ {
+		if sig[i].Option != jparse.ParamOptional {
+			break
+		}
+		argv = append(argv, undefined)
+	}
+
+	isVar := len(sig) > 0 && sig[len(sig)-1].Option == jparse.ParamVariadic
+
+	// A variadic parameter needs at least one argument.
+	if len(argv) < len(sig) || (len(argv) > len(sig) && !isVar) {
+		return nil, newArgCountError(c, argc)
+	}
+
+	for i, arg := range argv {
+
+		j := i
+		if j >= len(sig) {
+			j = len(sig) - 1
+		}
+
+		if arg == undefined {
+			if sig[j].Option == jparse.ParamOptional {
+				if _, ok := processUndefinedArg(c.params[j]); !ok {
+					argv[i] = reflect.Zero(c.params[j].t)
+				}
+			}
+			continue
+		}
+
+		if sig[j].Type == jparse.ParamTypeArray {
+			arg = arrayify(arg)
+			argv[i] = arg
+		}
+
+		if !validArgType(arg, sig[j]) {
+			return nil, newArgTypeError(c, i+1)
+		}
+	}
+
+	return argv, nil
+}
+
 func (c *goCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value, error) {
 
 	var ok bool
 	paramCount := len(c.params)
 
+	spread := false
+	if c.isVariadic {
+		argv, spread = c.variadicArgs(argv)
+	}
+
 	for i, v := range argv {
 
 		v = jtypes.Resolve(v)
@@ -318,6 +535,10 @@ func (c *goCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value, er
 
 		v, ok = processGoCallableArg(v, c.params[j])
 		if !ok {
+			if spread && i >= j {
+				// Report the position of the array.
+				return nil, newArgTypeError(c, j+1)
+			}
 			return nil, newArgTypeError(c, i+1)
 		}
 
@@ -327,11 +548,91 @@ func (c *goCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value, er
 	return argv, nil
 }
 
+// variadicArgs prepares the arguments to a variadic function.
+// Undefined arguments to the final parameter are dropped, unless
+// the parameter accepts undefined values. If the final parameter
+// has a single argument that is an array of values that can't be
+// passed as a single value, the array's items are passed instead,
+// so that $max([1, 2, 3]) is the same as $max(1, 2, 3). The bool
+// return value is true if an array was spread.
+func (c *goCallable) variadicArgs(argv []reflect.Value) ([]reflect.Value, bool) {
+
+	last := len(c.params) - 1
+	if last < 0 || len(argv) <= last {
+		return argv, false
+	}
+
+	param := c.params[last]
+
+	results := make([]reflect.Value, last, len(argv))
+	copy(results, argv[:last])
+
+	for _, v := range argv[last:] {
+		if v == undefined {
+			if _, ok := processUndefinedArg(param); !ok {
+				continue
+			}
+		}
+		results = append(results, v)
+	}
+
+	if len(results) != last+1 {
+		return results, false
+	}
+
+	arr := jtypes.Resolve(results[last])
+	if !jtypes.IsArray(arr) {
+		return results, false
+	}
+	if _, ok := processGoCallableArg(arr, param); ok {
+		return results, false
+	}
+
+	results = results[:last]
+	for i := 0; i < arr.Len(); i++ {
+		results = append(results, arr.Index(i))
+	}
+
+	return results, true
+}
+
 var (
 	typeString    = reflect.TypeOf((*string)(nil)).Elem()
 	typeByteSlice = reflect.TypeOf((*[]byte)(nil)).Elem()
 )
 
+var typeCallable = reflect.TypeOf((*Callable)(nil)).Elem()
+
+// An invokableCallable adds the Invoke method to a Callable
+// that is passed to a Go function (see Callable).
+type invokableCallable struct {
+	jtypes.Callable
+}
+
+func (f invokableCallable) Invoke(args ...interface{}) (interface{}, error) {
+
+	argv := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		argv[i] = reflect.ValueOf(arg)
+	}
+
+	res, err := f.Call(argv)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !res.IsValid():
+		return nil, ErrUndefined
+	case !res.CanInterface():
+		return nil, nil
+	case res.Kind() == reflect.Ptr && res.IsNil():
+		return nil, nil
+	default:
+		return res.Interface(), nil
+	}
+}
+
 func processGoCallableArg(arg reflect.Value, param goCallableParam) (reflect.Value, bool) {
 
 	if arg == undefined {
@@ -356,6 +657,11 @@ func processGoCallableArg(arg reflect.Value, param goCallableParam) (reflect.Val
 		return arg, true
 	case paramType == jtypes.TypeValue:
 		return reflect.ValueOf(arg), true
+	case paramType == typeCallable && argType.Implements(jtypes.TypeCallable):
+		if arg.CanInterface() {
+			var fn Callable = invokableCallable{arg.Interface().(jtypes.Callable)}
+			return reflect.ValueOf(&fn).Elem(), true
+		}
 	case argType.ConvertibleTo(paramType):
 		// Only allow conversion to a string if the source type
 		// is a byte slice. Go can convert other types (such as
@@ -426,6 +732,12 @@ func (f *lambdaCallable) ParamCount() int {
 }
 
 func (f *lambdaCallable) Call(argv []reflect.Value) (reflect.Value, error) {
+	return f.call(argv, nil)
+}
+
+// call invokes the function. If batches is non-nil, the body
+// is evaluated with evalTail instead of eval.
+func (f *lambdaCallable) call(argv []reflect.Value, batches *batchSet) (reflect.Value, error) {
 
 	argv, err := f.validateArgs(argv)
 	if err != nil {
@@ -452,6 +764,9 @@ func (f *lambdaCallable) Call(argv []reflect.Value) (reflect.Value, error) {
 	}
 
 	// Evaluate the function body.
+	if batches != nil {
+		return evalTail(f.body, f.context, env, batches)
+	}
 	return eval(f.body, f.context, env)
 }
 
@@ -547,7 +862,7 @@ func (f *lambdaCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value
 			argv[i] = arg
 		}
 
-		if !f.validArgType(arg, param) {
+		if !validArgType(arg, param) {
 			return nil, newArgTypeError(f, i+1)
 		}
 	}
@@ -555,7 +870,9 @@ func (f *lambdaCallable) validateArgTypes(argv []reflect.Value) ([]reflect.Value
 	return argv, nil
 }
 
-func (f *lambdaCallable) validArgType(arg reflect.Value, p jparse.Param) bool {
+// validArgType returns true if an argument matches the type of
+// a parameter in a type signature.
+func validArgType(arg reflect.Value, p jparse.Param) bool {
 
 	typ := p.Type
 
@@ -584,7 +901,7 @@ func (f *lambdaCallable) validArgType(arg reflect.Value, p jparse.Param) bool {
 				return true
 			}
 			return jtypes.IsArrayOf(arg, func(v reflect.Value) bool {
-				return f.validArgType(v, p.SubParams[0])
+				return validArgType(v, p.SubParams[0])
 			})
 		}
 		return false
@@ -944,6 +1261,7 @@ type chainCallable struct {
 	callableName
 	callableMarshaler
 	callables []jtypes.Callable
+	state     *evalState
 }
 
 func (f *chainCallable) ParamCount() int {
@@ -965,6 +1283,11 @@ func (f *chainCallable) Call(argv []reflect.Value) (reflect.Value, error) {
 		if err != nil {
 			return undefined, err
 		}
+
+		v, err = awaitContext(f.state.ctx(), v)
+		if err != nil {
+			return undefined, err
+		}
 	}
 
 	return v, nil
@@ -391,6 +391,24 @@ func TestGoCallable(t *testing.T) {
 				Which: 3,
 			},
 		},
+		{
+			// Error: Bad type (variadic array)
+			Name: "argType3",
+			Ext: Extension{
+				Func: func(string, ...int) int { return 0 },
+			},
+			Args: []interface{}{
+				"hello",
+				[]interface{}{
+					1,
+					"world",
+				},
+			},
+			Error: &ArgTypeError{
+				Func:  "argType3",
+				Which: 2,
+			},
+		},
 		{
 			// Function returns an error
 			Name: "error",
@@ -485,6 +503,61 @@ func TestGoCallable(t *testing.T) {
 			},
 			Output: 0,
 		},
+		{
+			// Variadic function (array argument)
+			Name: "variadic3",
+			Ext: Extension{
+				Func: func(nums ...int) []int {
+					sort.Ints(nums)
+					return nums
+				},
+			},
+			Args: []interface{}{
+				[]interface{}{
+					3.0,
+					1.0,
+					2.0,
+				},
+			},
+			Output: []int{
+				1,
+				2,
+				3,
+			},
+		},
+		{
+			// Variadic function (undefined arguments)
+			Name: "variadic4",
+			Ext: Extension{
+				Func: func(nums ...int) int {
+					return len(nums)
+				},
+			},
+			Args: []interface{}{
+				1,
+				nil,
+				2,
+			},
+			Output: 2,
+		},
+		{
+			// Variadic function (undefined and array arguments
+			// to an interface{} parameter)
+			Name: "variadic5",
+			Ext: Extension{
+				Func: func(vs ...interface{}) int {
+					return len(vs)
+				},
+			},
+			Args: []interface{}{
+				nil,
+				[]interface{}{
+					1,
+					2,
+				},
+			},
+			Output: 2,
+		},
 		{
 			// Optional parameter (set)
 			Name: "optional_set",
@@ -0,0 +1,464 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package conformance runs the JSONata test suite from the
+// jsonata-js repository (test/test-suite) against jsonata-go
+// and reports the results by test group. Forks and extension
+// authors can use it to check that a Compiler with their own
+// extensions still behaves like JSONata.
+//
+// # Usage
+//
+// Clone https://github.com/jsonata-js/jsonata, check out the
+// version to test against, and call Run with the path of its
+// test/test-suite directory:
+//
+//	report, err := conformance.Run("jsonata/test/test-suite", nil)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	fmt.Println(report.Passed, "passed", report.Failed, "failed")
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A Case is a test case from the test suite.
+type Case struct {
+	// Group is the name of the directory that contains the
+	// case, e.g. "function-sum", and Name is the name of its
+	// file without the .json extension, followed by its index
+	// if the file has more than one case, e.g. "case001[2]".
+	Group string `json:"-"`
+	Name  string `json:"-"`
+
+	Expr        string
+	ExprFile    string `json:"expr-file"`
+	Category    string
+	Data        interface{}
+	Dataset     string
+	Description string
+	TimeLimit   int
+	Depth       int
+	Bindings    map[string]interface{}
+	Result      interface{}
+	Undefined   bool   `json:"undefinedResult"`
+	Error       string `json:"code"`
+	Token       string
+	Unordered   bool
+}
+
+// Options control how Run runs the test suite.
+type Options struct {
+	// Compiler compiles the test expressions. If it's nil, Run
+	// uses a Compiler with only the built-in functions.
+	Compiler *jsonata.Compiler
+
+	// Eval, if it's not nil, is used instead of Compiler to
+	// evaluate the test expressions, e.g. to run the suite
+	// against another engine such as jlite. It must return
+	// jsonata.ErrUndefined if the result is undefined.
+	Eval func(expr string, data interface{}, bindings map[string]interface{}) (interface{}, error)
+
+	// Group restricts the run to the groups whose names
+	// contain Group, e.g. "function-" for the function tests.
+	Group string
+
+	// Failed, if it's not nil, is called with each failed case
+	// as soon as it fails, e.g. to report progress.
+	Failed func(Failure)
+}
+
+// A Failure is a test case that failed.
+type Failure struct {
+	Case Case
+
+	// Expr is the expression that was evaluated. It differs
+	// from Case.Expr if quoted names in the original were
+	// replaced with backquoted ones, which jsonata-go requires.
+	Expr string
+
+	// Got and Err are the result of the evaluation.
+	Got interface{}
+	Err error
+}
+
+func (f Failure) String() string {
+
+	var want string
+	switch {
+	case f.Case.Error != "":
+		want = "error " + f.Case.Error
+	case f.Case.Undefined:
+		want = "undefined"
+	default:
+		want = fmt.Sprintf("%v", f.Case.Result)
+	}
+
+	got := fmt.Sprintf("%v", f.Got)
+	if f.Err != nil {
+		got = "error: " + f.Err.Error()
+	}
+
+	return fmt.Sprintf("%s/%s: %s: want %s, got %s", f.Case.Group, f.Case.Name, f.Expr, want, got)
+}
+
+// A GroupResult has the results of the cases in a group.
+type GroupResult struct {
+	Name     string
+	Passed   int
+	Failed   int
+	Skipped  int
+	Failures []Failure
+}
+
+// A Report has the results of a run, with the groups sorted by
+// name. Passed, Failed and Skipped are the totals across all
+// groups.
+type Report struct {
+	Groups  []*GroupResult
+	Passed  int
+	Failed  int
+	Skipped int
+}
+
+// Run runs the test suite in dir, which contains the suite's
+// groups and datasets directories. Cases that assume JavaScript
+// object ordering or that have a time limit are skipped. Run
+// only returns an error if the test suite can't be read; failed
+// cases are recorded in the Report.
+func Run(dir string, opts *Options) (*Report, error) {
+
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	comp := opts.Compiler
+	if comp == nil {
+		var err error
+		if comp, err = jsonata.NewCompiler(nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &runner{
+		comp:    comp,
+		opts:    opts,
+		datadir: filepath.Join(dir, "datasets"),
+		data:    map[string]interface{}{},
+	}
+
+	groupdir := filepath.Join(dir, "groups")
+	groups, err := ioutil.ReadDir(groupdir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+
+	for _, group := range groups {
+
+		if !group.IsDir() || !strings.Contains(group.Name(), opts.Group) {
+			continue
+		}
+
+		res, err := r.runGroup(filepath.Join(groupdir, group.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		report.Groups = append(report.Groups, res)
+		report.Passed += res.Passed
+		report.Failed += res.Failed
+		report.Skipped += res.Skipped
+	}
+
+	sort.Slice(report.Groups, func(i, j int) bool {
+		return report.Groups[i].Name < report.Groups[j].Name
+	})
+
+	return report, nil
+}
+
+type runner struct {
+	comp    *jsonata.Compiler
+	opts    *Options
+	datadir string
+	data    map[string]interface{}
+}
+
+func (r *runner) runGroup(dir string) (*GroupResult, error) {
+
+	res := &GroupResult{
+		Name: filepath.Base(dir),
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+
+		cases, err := LoadCases(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range cases {
+
+			if c.Unordered || c.TimeLimit != 0 {
+				res.Skipped++
+				continue
+			}
+
+			f, err := r.runCase(c)
+			if err != nil {
+				return nil, err
+			}
+
+			if f == nil {
+				res.Passed++
+				continue
+			}
+
+			res.Failed++
+			res.Failures = append(res.Failures, *f)
+			if r.opts.Failed != nil {
+				r.opts.Failed(*f)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// runCase runs a test case and returns its Failure, or nil if
+// it passed.
+func (r *runner) runCase(c Case) (*Failure, error) {
+
+	data := c.Data
+	if c.Dataset != "" {
+		var err error
+		if data, err = r.dataset(c.Dataset); err != nil {
+			return nil, err
+		}
+	}
+
+	expr, _ := replaceQuotesInPaths(c.Expr)
+	got, err := r.eval(expr, c.Bindings, data)
+
+	var ok bool
+	switch {
+	case c.Error != "":
+		// Error codes aren't compared because jsonata-go
+		// doesn't have a code for every error.
+		ok = err != nil && err != jsonata.ErrUndefined
+	case c.Undefined:
+		ok = err == jsonata.ErrUndefined
+	default:
+		ok = err == nil && equalResults(got, c.Result)
+	}
+
+	if ok {
+		return nil, nil
+	}
+
+	return &Failure{
+		Case: c,
+		Expr: expr,
+		Got:  got,
+		Err:  err,
+	}, nil
+}
+
+func (r *runner) eval(expr string, bindings map[string]interface{}, data interface{}) (result interface{}, err error) {
+
+	// A panic in an extension fails the case, not the run.
+	defer func() {
+		if e := recover(); e != nil {
+			result, err = nil, fmt.Errorf("panic: %v", e)
+		}
+	}()
+
+	if r.opts.Eval != nil {
+		return r.opts.Eval(expr, data, bindings)
+	}
+
+	e, err := r.comp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Eval(data, bindings)
+}
+
+// dataset returns a dataset from the datasets directory. Each
+// one is only read once.
+func (r *runner) dataset(name string) (interface{}, error) {
+
+	if data, ok := r.data[name]; ok {
+		return data, nil
+	}
+
+	var data interface{}
+	if err := readJSONFile(filepath.Join(r.datadir, name+".json"), &data); err != nil {
+		return nil, err
+	}
+
+	r.data[name] = data
+	return data, nil
+}
+
+// LoadCases reads the test cases in a test suite file, which
+// contains either one case or an array of cases. Expressions
+// in separate files (see Case.ExprFile) are read from the same
+// directory.
+func LoadCases(path string) ([]Case, error) {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []Case
+	if err := json.Unmarshal(b, &cases); err != nil {
+		var c Case
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("cannot read %s: %s", path, err)
+		}
+		cases = []Case{c}
+	}
+
+	group := filepath.Base(filepath.Dir(path))
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+
+	for i := range cases {
+
+		c := &cases[i]
+		c.Group = group
+		c.Name = name
+		if len(cases) > 1 {
+			c.Name = fmt.Sprintf("%s[%d]", name, i)
+		}
+
+		if c.ExprFile != "" {
+			expr, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), c.ExprFile))
+			if err != nil {
+				return nil, err
+			}
+			c.Expr = string(expr)
+		}
+	}
+
+	return cases, nil
+}
+
+func readJSONFile(path string, dest interface{}) error {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("dataset %s not found", filepath.Base(path))
+		}
+		return err
+	}
+
+	if err := json.Unmarshal(b, dest); err != nil {
+		return fmt.Errorf("cannot read %s: %s", path, err)
+	}
+
+	return nil
+}
+
+func equalResults(x, y interface{}) bool {
+
+	if reflect.DeepEqual(x, y) {
+		return true
+	}
+
+	vx := jtypes.Resolve(reflect.ValueOf(x))
+	vy := jtypes.Resolve(reflect.ValueOf(y))
+
+	if jtypes.IsArray(vx) && jtypes.IsArray(vy) {
+		if vx.Len() != vy.Len() {
+			return false
+		}
+		for i := 0; i < vx.Len(); i++ {
+			if !equalResults(vx.Index(i).Interface(), vy.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if jtypes.IsMap(vx) && jtypes.IsMap(vy) {
+		if vx.Len() != vy.Len() {
+			return false
+		}
+		for _, k := range vx.MapKeys() {
+			v := vy.MapIndex(k)
+			if !v.IsValid() || !equalResults(vx.MapIndex(k).Interface(), v.Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+
+	ix, okx := jtypes.AsNumber(vx)
+	iy, oky := jtypes.AsNumber(vy)
+	if okx && oky && ix == iy {
+		return true
+	}
+
+	sx, okx := jtypes.AsString(vx)
+	sy, oky := jtypes.AsString(vy)
+	if okx && oky && sx == sy {
+		return true
+	}
+
+	bx, okx := jtypes.AsBool(vx)
+	by, oky := jtypes.AsBool(vy)
+	if okx && oky && bx == by {
+		return true
+	}
+
+	return false
+}
+
+var (
+	reQuotedPath      = regexp.MustCompile(`([A-Za-z\$\\*\` + "`" + `])\.[\"']([ \.0-9A-Za-z]+?)[\"']`)
+	reQuotedPathStart = regexp.MustCompile(`^[\"']([ \.0-9A-Za-z]+?)[\"']\.([A-Za-z\$\*\"\'])`)
+)
+
+// replaceQuotesInPaths replaces quoted names in paths, such as
+// Account."Account Name", with backquoted ones, which is what
+// jsonata-go expects. It reports whether it changed anything.
+func replaceQuotesInPaths(s string) (string, bool) {
+	var changed bool
+
+	if reQuotedPathStart.MatchString(s) {
+		s = reQuotedPathStart.ReplaceAllString(s, "`$1`.$2")
+		changed = true
+	}
+
+	for reQuotedPath.MatchString(s) {
+		s = reQuotedPath.ReplaceAllString(s, "$1.`$2`")
+		changed = true
+	}
+
+	return s, changed
+}
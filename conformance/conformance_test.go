@@ -0,0 +1,157 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package conformance
+
+import (
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/jlite"
+)
+
+const testSuite = "testdata/test-suite"
+
+func TestRun(t *testing.T) {
+
+	report, err := Run(testSuite, nil)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if report.Passed != 7 || report.Failed != 0 || report.Skipped != 1 {
+		t.Errorf("expected 7 passed, 0 failed and 1 skipped, got %d, %d and %d", report.Passed, report.Failed, report.Skipped)
+	}
+
+	var names []string
+	for _, g := range report.Groups {
+		names = append(names, g.Name)
+	}
+	if len(names) != 3 || names[0] != "fields" || names[1] != "function-sum" || names[2] != "object-ordering" {
+		t.Errorf("expected the groups fields, function-sum and object-ordering, got %v", names)
+	}
+
+	for _, g := range report.Groups {
+		for _, f := range g.Failures {
+			t.Errorf("unexpected failure: %s", f)
+		}
+	}
+}
+
+func TestRun_Compiler(t *testing.T) {
+
+	// A broken replacement for $sum that counts its
+	// arguments instead of adding them up.
+	comp, err := jsonata.NewCompiler(nil, map[string]jsonata.Extension{
+		"sum": {
+			Func: func(xs []interface{}) float64 {
+				return float64(len(xs))
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	var failed []string
+	report, err := Run(testSuite, &Options{
+		Compiler: comp,
+		Group:    "function-",
+		Failed: func(f Failure) {
+			failed = append(failed, f.Case.Group+"/"+f.Case.Name)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(report.Groups) != 1 || report.Groups[0].Name != "function-sum" {
+		t.Fatalf("expected only the function-sum group, got %+v", report.Groups)
+	}
+
+	g := report.Groups[0]
+	if g.Passed != 1 || g.Failed != 2 {
+		t.Errorf("expected 1 passed and 2 failed, got %d and %d", g.Passed, g.Failed)
+	}
+
+	want := []string{"function-sum/case000", "function-sum/case001"}
+	if len(failed) != len(want) || failed[0] != want[0] || failed[1] != want[1] {
+		t.Errorf("expected failures %v, got %v", want, failed)
+	}
+
+	if s := g.Failures[0].String(); s != "function-sum/case000: $sum(values): want 6, got 3" {
+		t.Errorf("unexpected failure message %q", s)
+	}
+}
+
+func TestLoadCases(t *testing.T) {
+
+	cases, err := LoadCases(testSuite + "/groups/fields/case001.json")
+	if err != nil {
+		t.Fatalf("LoadCases failed: %v", err)
+	}
+
+	if len(cases) != 3 {
+		t.Fatalf("expected 3 cases, got %d", len(cases))
+	}
+
+	if c := cases[1]; c.Name != "case001[1]" || c.Group != "fields" || !c.Undefined {
+		t.Errorf("expected case001[1] in fields with an undefined result, got %+v", c)
+	}
+
+	if c := cases[2]; c.Expr != `{"fud": foo.blah.baz.fud}` {
+		t.Errorf("expected the expression to be read from its file, got %q", c.Expr)
+	}
+}
+
+// TestRun_Engines runs the test suites against both jsonata-go
+// and jlite. The engines suite only uses features that jlite
+// supports, so every case should pass with both engines.
+func TestRun_Engines(t *testing.T) {
+
+	lite := func(expr string, data interface{}, bindings map[string]interface{}) (interface{}, error) {
+		e, err := jlite.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		v, err := e.Eval(data, bindings)
+		if err == jlite.ErrUndefined {
+			return nil, jsonata.ErrUndefined
+		}
+		return v, err
+	}
+
+	for _, engine := range []struct {
+		Name string
+		Opts *Options
+	}{
+		{"jsonata", nil},
+		{"jlite", &Options{Eval: lite}},
+	} {
+		for _, suite := range []struct {
+			Dir     string
+			Passed  int
+			Skipped int
+		}{
+			{testSuite, 7, 1},
+			{"testdata/engines", 80, 0},
+		} {
+			report, err := Run(suite.Dir, engine.Opts)
+			if err != nil {
+				t.Fatalf("%s: %s: Run failed: %v", engine.Name, suite.Dir, err)
+			}
+
+			if report.Passed != suite.Passed || report.Failed != 0 || report.Skipped != suite.Skipped {
+				t.Errorf("%s: %s: expected %d passed, 0 failed and %d skipped, got %d, %d and %d", engine.Name, suite.Dir,
+					suite.Passed, suite.Skipped, report.Passed, report.Failed, report.Skipped)
+			}
+
+			for _, g := range report.Groups {
+				for _, f := range g.Failures {
+					t.Errorf("%s: unexpected failure: %s", engine.Name, f)
+				}
+			}
+		}
+	}
+}
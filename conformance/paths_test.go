@@ -1,4 +1,8 @@
-package main
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package conformance
 
 import "testing"
 
@@ -0,0 +1,242 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A ValueConverter converts a Go value of a domain type, such
+// as a decimal or a UUID, to a value that JSONata understands,
+// e.g. a number, a string or a map. Returning nil converts the
+// value to null.
+type ValueConverter func(v interface{}) interface{}
+
+// RegisterValueConverter registers a function that converts
+// values of type typ when an expression reads them from its
+// input or from a variable. Without a converter, such values
+// are treated like any other Go value: a struct with unexported
+// fields, for example, looks like an empty object.
+//
+// Values are converted when they are read by name, by the
+// wildcard and descendant operators, and when they are passed
+// as the input or as variables. A slice or array of typ is
+// converted to an array of converted values, and the elements
+// of a []interface{} and the values of a map[string]interface{}
+// are converted when the array or map is read. Pointers to typ
+// are dereferenced before conversion and nil pointers are
+// converted to null. Built-in functions that operate on whole
+// objects, such as $each and $spread, see unconverted values in
+// structs and in maps nested inside other maps or arrays.
+//
+// Converters apply to expressions compiled after they are
+// registered. RegisterValueConverter must not be called at the
+// same time as Compile.
+func (c *Compiler) RegisterValueConverter(typ reflect.Type, fn ValueConverter) error {
+
+	if c.frozen {
+		return errDefaultFrozen()
+	}
+
+	if typ == nil {
+		return fmt.Errorf("value converter type cannot be nil")
+	}
+	if fn == nil {
+		return fmt.Errorf("value converter for %s cannot be nil", typ)
+	}
+	if typ.Kind() == reflect.Interface {
+		return fmt.Errorf("cannot register a value converter for interface type %s", typ)
+	}
+
+	if c.converters == nil {
+		c.converters = valueConverters{}
+	}
+	c.converters[typ] = fn
+	return nil
+}
+
+// valueConverters maps Go types to their registered
+// ValueConverters.
+type valueConverters map[reflect.Type]ValueConverter
+
+// convert converts times (see jtypes.ConvertTime) and values
+// with registered converters. Other values are returned
+// unchanged.
+func (cs valueConverters) convert(v reflect.Value) reflect.Value {
+
+	v = jtypes.ConvertTime(v)
+	if len(cs) == 0 || !v.IsValid() {
+		return v
+	}
+
+	r := v
+	for r.Kind() == reflect.Interface && !r.IsNil() {
+		r = r.Elem()
+	}
+
+	if r.Kind() == reflect.Ptr && r.IsNil() && cs.hasElemConverter(r.Type()) {
+		return reflect.ValueOf(null)
+	}
+
+	if fn, r, ok := cs.lookup(r); ok {
+		return convertedValue(fn(r.Interface()))
+	}
+
+	switch r = jtypes.Resolve(r); r.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t := r.Type().Elem(); isEmptyInterface(t) {
+			return cs.convertValues(v, r)
+		} else if cs.hasElemConverter(t) {
+			return cs.convertItems(r)
+		}
+	case reflect.Map:
+		if isEmptyInterface(r.Type().Elem()) {
+			return cs.convertMap(v, r)
+		}
+	}
+
+	return v
+}
+
+// lookup returns the converter for v and the value to pass to
+// it. If v is a non-nil pointer to a type with a converter, the
+// value is dereferenced.
+func (cs valueConverters) lookup(v reflect.Value) (ValueConverter, reflect.Value, bool) {
+
+	if !v.CanInterface() {
+		return nil, v, false
+	}
+
+	if fn, ok := cs[v.Type()]; ok {
+		return fn, v, true
+	}
+
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		if fn, ok := cs[v.Type().Elem()]; ok {
+			return fn, v.Elem(), true
+		}
+	}
+
+	return nil, v, false
+}
+
+func (cs valueConverters) hasElemConverter(t reflect.Type) bool {
+	if _, ok := cs[t]; ok {
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		_, ok := cs[t.Elem()]
+		return ok
+	}
+	return false
+}
+
+func (cs valueConverters) convertItems(v reflect.Value) reflect.Value {
+
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		return v
+	}
+
+	results := make([]interface{}, v.Len())
+
+	for i := range results {
+		if fn, item, ok := cs.lookup(v.Index(i)); ok {
+			results[i] = fn(item.Interface())
+		}
+	}
+
+	return reflect.ValueOf(results)
+}
+
+// convertValues converts the elements of a slice or array of
+// interfaces, such as a []interface{}. The elements of nested
+// arrays are converted too because the evaluator doesn't convert
+// items as it iterates over them. Maps are converted when they
+// are read. If no element changes, v is returned as is.
+func (cs valueConverters) convertValues(v, r reflect.Value) reflect.Value {
+
+	if r.Kind() == reflect.Slice && r.IsNil() {
+		return v
+	}
+
+	var results []interface{}
+
+	for i := 0; i < r.Len(); i++ {
+		item := r.Index(i)
+		conv := cs.convertItem(item)
+		if results == nil {
+			if conv == item {
+				continue
+			}
+			results = make([]interface{}, r.Len())
+			for j := 0; j < i; j++ {
+				results[j] = r.Index(j).Interface()
+			}
+		}
+		if conv.IsValid() {
+			results[i] = conv.Interface()
+		}
+	}
+
+	if results == nil {
+		return v
+	}
+	return reflect.ValueOf(results)
+}
+
+// convertMap converts the values of a map of interfaces, such as
+// a map[string]interface{}, so that functions that operate on
+// whole objects see converted values. Nested maps are converted
+// when they are read. If no value changes, v is returned as is.
+func (cs valueConverters) convertMap(v, r reflect.Value) reflect.Value {
+
+	var results reflect.Value
+
+	for it := r.MapRange(); it.Next(); {
+		item := it.Value()
+		conv := cs.convertItem(item)
+		if conv == item {
+			continue
+		}
+		if !results.IsValid() {
+			results = reflect.MakeMapWithSize(r.Type(), r.Len())
+			for it := r.MapRange(); it.Next(); {
+				results.SetMapIndex(it.Key(), it.Value())
+			}
+		}
+		results.SetMapIndex(it.Key(), conv)
+	}
+
+	if !results.IsValid() {
+		return v
+	}
+	return results
+}
+
+// convertItem converts v like convert but leaves maps of
+// interfaces alone, so that converting an array or a map
+// doesn't walk everything beneath it.
+func (cs valueConverters) convertItem(v reflect.Value) reflect.Value {
+	if r := jtypes.Resolve(v); r.Kind() == reflect.Map && isEmptyInterface(r.Type().Elem()) {
+		return v
+	}
+	return cs.convert(v)
+}
+
+func isEmptyInterface(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && t.NumMethod() == 0
+}
+
+// convertedValue returns the result of a ValueConverter as a
+// reflect.Value. A nil result is returned as null.
+func convertedValue(v interface{}) reflect.Value {
+	if v == nil {
+		return reflect.ValueOf(null)
+	}
+	return reflect.ValueOf(v)
+}
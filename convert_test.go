@@ -0,0 +1,198 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testDecimal is a fixed-point number with unexported fields,
+// like most decimal types.
+type testDecimal struct {
+	unscaled int64
+	scale    int
+}
+
+func (d testDecimal) Float64() float64 {
+	return float64(d.unscaled) / math.Pow10(d.scale)
+}
+
+type testUUID [4]byte
+
+func (u testUUID) String() string {
+	return fmt.Sprintf("%x-%x", u[:2], u[2:])
+}
+
+type testInvoice struct {
+	ID       testUUID
+	Total    testDecimal
+	Lines    []testDecimal
+	Discount *testDecimal
+	Tax      *testDecimal
+	Missing  testDecimal
+}
+
+func TestCompiler_RegisterValueConverter(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.RegisterValueConverter(reflect.TypeOf(testDecimal{}), func(v interface{}) interface{} {
+		d := v.(testDecimal)
+		if d.scale < 0 {
+			return nil
+		}
+		return d.Float64()
+	})
+	if err != nil {
+		t.Fatalf("RegisterValueConverter failed: %v", err)
+	}
+
+	err = comp.RegisterValueConverter(reflect.TypeOf(testUUID{}), func(v interface{}) interface{} {
+		return v.(testUUID).String()
+	})
+	if err != nil {
+		t.Fatalf("RegisterValueConverter failed: %v", err)
+	}
+
+	input := testInvoice{
+		ID:    testUUID{0xde, 0xad, 0xbe, 0xef},
+		Total: testDecimal{1999, 2},
+		Lines: []testDecimal{
+			{1000, 2},
+			{500, 2},
+		},
+		Tax:     &testDecimal{25, 1},
+		Missing: testDecimal{1, -1},
+	}
+
+	vars := map[string]interface{}{
+		"rate": testDecimal{15, 2},
+		"items": []interface{}{
+			map[string]interface{}{"price": testDecimal{5, 0}},
+			map[string]interface{}{"price": &testDecimal{7, 0}},
+		},
+		"mixed": []interface{}{
+			testDecimal{1, 0},
+			time.Date(2018, 5, 15, 15, 12, 59, 0, time.UTC),
+			[]interface{}{testDecimal{2, 0}},
+		},
+		"totals": map[string]interface{}{
+			"net": testDecimal{3, 0},
+			"tax": testDecimal{4, 0},
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"ID", "dead-beef"},
+		{"Total", 19.99},
+		{"Total * 2", 39.98},
+		{"$sum(Lines)", float64(15)},
+		{"Lines[1]", float64(5)},
+		{"Discount", nil},
+		{"Tax", 2.5},
+		{"$type(Missing)", "null"},
+		{"$rate * 100", float64(15)},
+		{"$sum($items.price)", float64(12)},
+		{"$count(*[$type($) = 'number'])", 4},
+		{"$count(*[$type($) = 'null'])", 2},
+		{"**[$ = 'dead-beef']", "dead-beef"},
+		{"$mixed.$type($)", []interface{}{"number", "string", "array"}},
+		{"$string($mixed)", `[1,"2018-05-15T15:12:59.000Z",[2]]`},
+		{"$sum($each($totals, function($v) { $v }))", float64(7)},
+	}
+
+	for _, test := range tests {
+
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.expr, err)
+		}
+
+		out, err := expr.Eval(input, vars)
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(out, test.want) {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", test.expr, test.want, test.want, out, out)
+		}
+	}
+
+	// Generic arrays and maps are copied, not modified.
+	if _, ok := vars["mixed"].([]interface{})[0].(testDecimal); !ok {
+		t.Errorf("expected the input array to be unchanged")
+	}
+	if _, ok := vars["totals"].(map[string]interface{})["net"].(testDecimal); !ok {
+		t.Errorf("expected the input map to be unchanged")
+	}
+
+	// The input is converted too.
+	expr, err := comp.Compile("$")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	out, err := expr.Eval(testDecimal{42, 0}, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if out != float64(42) {
+		t.Errorf("expected 42, got %v", out)
+	}
+
+	// Expressions compiled before a converter is registered
+	// don't use it.
+	comp, err = NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	before, err := comp.Compile("Total * 2")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	err = comp.RegisterValueConverter(reflect.TypeOf(testDecimal{}), func(v interface{}) interface{} {
+		return v.(testDecimal).Float64()
+	})
+	if err != nil {
+		t.Fatalf("RegisterValueConverter failed: %v", err)
+	}
+	if _, err := before.Eval(input, nil); err == nil {
+		t.Errorf("expected error for unconverted value")
+	}
+}
+
+func TestCompiler_RegisterValueConverterErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	conv := func(v interface{}) interface{} {
+		return v
+	}
+
+	if err := comp.RegisterValueConverter(nil, conv); err == nil {
+		t.Errorf("expected error for nil type")
+	}
+
+	if err := comp.RegisterValueConverter(reflect.TypeOf(testDecimal{}), nil); err == nil {
+		t.Errorf("expected error for nil converter")
+	}
+
+	if err := comp.RegisterValueConverter(reflect.TypeOf((*fmt.Stringer)(nil)).Elem(), conv); err == nil {
+		t.Errorf("expected error for interface type")
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// A Coverage records which parts of a set of expressions are
+// evaluated by a test suite. Evaluate the expressions through
+// the Coverage, then call Report to see which subexpressions and
+// which branches of conditional expressions were never
+// exercised.
+//
+// Evaluations through a Coverage don't use the specialised
+// implementations of simple filters, so that every node in the
+// syntax tree is visited. The results are the same.
+//
+// A Coverage is safe for concurrent use.
+type Coverage struct {
+	mu    sync.Mutex
+	exprs []*Expression
+	stats map[*Expression]*coverageStats
+}
+
+type coverageStats struct {
+	evals    int
+	nodes    map[jparse.Node]bool
+	branches map[*jparse.ConditionalNode][2]bool
+}
+
+// NewCoverage returns an empty Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		stats: map[*Expression]*coverageStats{},
+	}
+}
+
+// Add adds expressions to the coverage report without evaluating
+// them, so that expressions which a test suite never evaluates
+// are reported with no coverage.
+func (c *Coverage) Add(exprs ...*Expression) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range exprs {
+		c.statsFor(e)
+	}
+}
+
+// Eval evaluates an expression like Expression.Eval and records
+// the parts of it that were evaluated.
+func (c *Coverage) Eval(e *Expression, data interface{}, vars map[string]interface{}) (interface{}, error) {
+	return c.EvalContext(context.Background(), e, data, vars)
+}
+
+// EvalContext is like Eval but uses ctx for the evaluation. See
+// Expression.EvalContext.
+func (c *Coverage) EvalContext(ctx context.Context, e *Expression, data interface{}, vars map[string]interface{}) (interface{}, error) {
+
+	rec := &coverageRecorder{
+		nodes:    map[jparse.Node]bool{},
+		branches: map[*jparse.ConditionalNode][2]bool{},
+	}
+
+	var result reflect.Value
+
+	// Coverage is recorded by node, so the expression's
+	// syntax tree must not be trimmed.
+	k := e.art.pin()
+
+	err := e.withEvalEnv(ctx, k, e.newBaseEnv(), data, vars, nil, func(input reflect.Value, env *environment) error {
+		env.state.kernels = nil
+		env.state.accessors = nil
+		env.state.parallel = nil
+		env.state.memo = nil
+		env.state.coverage = rec
+
+		var err error
+		result, err = eval(k.node, input, env)
+		return err
+	})
+
+	c.record(e, rec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return exportResult(result)
+}
+
+func (c *Coverage) record(e *Expression, rec *coverageRecorder) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.statsFor(e)
+	stats.evals++
+
+	for node := range rec.nodes {
+		stats.nodes[node] = true
+	}
+
+	for node, taken := range rec.branches {
+		prev := stats.branches[node]
+		stats.branches[node] = [2]bool{prev[0] || taken[0], prev[1] || taken[1]}
+	}
+}
+
+func (c *Coverage) statsFor(e *Expression) *coverageStats {
+
+	stats, ok := c.stats[e]
+	if !ok {
+		e.art.pin()
+		stats = &coverageStats{
+			nodes:    map[jparse.Node]bool{},
+			branches: map[*jparse.ConditionalNode][2]bool{},
+		}
+		c.stats[e] = stats
+		c.exprs = append(c.exprs, e)
+	}
+
+	return stats
+}
+
+// Report returns the coverage of each expression, in the order
+// in which the expressions were first added or evaluated.
+func (c *Coverage) Report() []*CoverageReport {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reports := make([]*CoverageReport, len(c.exprs))
+	for i, e := range c.exprs {
+		reports[i] = newCoverageReport(e, c.stats[e])
+	}
+
+	return reports
+}
+
+// A CoverageReport describes the coverage of a single expression.
+type CoverageReport struct {
+	// Expr is the source of the expression. Expressions that
+	// weren't compiled from source, such as decision tables,
+	// are shown in JSONata syntax, in which case the gaps have
+	// no source ranges.
+	Expr string
+
+	// Evals is the number of times the expression was
+	// evaluated.
+	Evals int
+
+	// Nodes is the number of nodes in the expression's syntax
+	// tree, and CoveredNodes is the number that were evaluated
+	// at least once.
+	Nodes        int
+	CoveredNodes int
+
+	// Branches is the number of branches in the expression's
+	// conditional expressions (two per conditional, whether or
+	// not it has an else branch), and CoveredBranches is the
+	// number that were taken at least once.
+	Branches        int
+	CoveredBranches int
+
+	// Gaps lists the subexpressions that were never evaluated,
+	// and the branches that were never taken, in source order.
+	// A subexpression inside a gap isn't listed separately.
+	Gaps []CoverageGap
+}
+
+// A CoverageGap is a part of an expression that a test suite
+// didn't exercise.
+type CoverageGap struct {
+	// Start and End are the byte offsets of the gap's source
+	// in the expression, or -1 if unknown.
+	Start int
+	End   int
+
+	// Source is the gap's source text.
+	Source string
+
+	// Branch is "then" or "else" if the gap is the branch of
+	// the conditional expression in Source that was never
+	// taken. It's empty if the gap is a subexpression that was
+	// never evaluated.
+	Branch string
+}
+
+// Percent returns the percentage of nodes and branches that
+// were covered.
+func (r *CoverageReport) Percent() float64 {
+
+	total := r.Nodes + r.Branches
+	if total == 0 {
+		return 100
+	}
+
+	return 100 * float64(r.CoveredNodes+r.CoveredBranches) / float64(total)
+}
+
+// String returns a readable summary of the report, with one
+// line per gap.
+func (r *CoverageReport) String() string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %.1f%% (%d/%d nodes, %d/%d branches, %d evaluations)\n",
+		r.Expr, r.Percent(), r.CoveredNodes, r.Nodes, r.CoveredBranches, r.Branches, r.Evals)
+
+	for _, gap := range r.Gaps {
+
+		pos := "?"
+		if gap.Start >= 0 {
+			pos = fmt.Sprintf("%d-%d", gap.Start, gap.End)
+		}
+
+		switch gap.Branch {
+		case "":
+			fmt.Fprintf(&b, "  %s: not evaluated: %s\n", pos, gap.Source)
+		default:
+			fmt.Fprintf(&b, "  %s: %s branch not taken: %s\n", pos, gap.Branch, gap.Source)
+		}
+	}
+
+	return b.String()
+}
+
+func newCoverageReport(e *Expression, stats *coverageStats) *CoverageReport {
+
+	k := e.compiled()
+
+	r := &CoverageReport{
+		Expr:  e.source,
+		Evals: stats.evals,
+	}
+	if r.Expr == "" {
+		r.Expr = k.node.String()
+	}
+
+	gap := func(node jparse.Node, branch string) CoverageGap {
+		rng, ok := k.ranges[node]
+		if !ok {
+			return CoverageGap{
+				Start:  -1,
+				End:    -1,
+				Source: node.String(),
+				Branch: branch,
+			}
+		}
+		return CoverageGap{
+			Start:  rng.Start,
+			End:    rng.End,
+			Source: e.source[rng.Start:rng.End],
+			Branch: branch,
+		}
+	}
+
+	var inGap int
+	var walk func(jparse.Node)
+	walk = func(node jparse.Node) {
+
+		// Placeholders in partial applications are never
+		// evaluated.
+		if _, ok := node.(*jparse.PlaceholderNode); ok {
+			return
+		}
+
+		r.Nodes++
+		covered := stats.nodes[node]
+		switch {
+		case covered:
+			r.CoveredNodes++
+		case inGap == 0:
+			r.Gaps = append(r.Gaps, gap(node, ""))
+		}
+
+		if cond, ok := node.(*jparse.ConditionalNode); ok {
+			taken := stats.branches[cond]
+			for i, name := range []string{"then", "else"} {
+				r.Branches++
+				switch {
+				case taken[i]:
+					r.CoveredBranches++
+				case covered:
+					r.Gaps = append(r.Gaps, gap(cond, name))
+				}
+			}
+		}
+
+		if !covered {
+			inGap++
+		}
+		for _, child := range jparse.Children(node) {
+			walk(child)
+		}
+		if !covered {
+			inGap--
+		}
+	}
+	walk(k.node)
+
+	sort.SliceStable(r.Gaps, func(i, j int) bool {
+		return r.Gaps[i].Start < r.Gaps[j].Start
+	})
+
+	return r
+}
+
+// A coverageRecorder records the nodes evaluated, and the
+// branches taken, during a single evaluation.
+type coverageRecorder struct {
+	nodes    map[jparse.Node]bool
+	branches map[*jparse.ConditionalNode][2]bool
+}
+
+// cover records that a node was evaluated, if coverage is being
+// recorded.
+func (s *environment) cover(node jparse.Node) {
+	if s == nil || s.state == nil || s.state.coverage == nil {
+		return
+	}
+	s.state.coverage.nodes[node] = true
+}
+
+// coverBranch records which branch of a conditional expression
+// was taken, if coverage is being recorded.
+func (s *environment) coverBranch(node *jparse.ConditionalNode, then bool) {
+	if s == nil || s.state == nil || s.state.coverage == nil {
+		return
+	}
+
+	taken := s.state.coverage.branches[node]
+	if then {
+		taken[0] = true
+	} else {
+		taken[1] = true
+	}
+	s.state.coverage.branches[node] = taken
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	discount, err := comp.Compile(`total > 100 ? total * 0.9 : (member ? total - 5)`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	names, err := comp.Compile(`items[price > 10].name`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	unused, err := comp.Compile(`$uppercase(name)`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	cov := NewCoverage()
+	cov.Add(unused)
+
+	got, err := cov.Eval(discount, map[string]interface{}{"total": 200}, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if got != 180.0 {
+		t.Errorf("expected 180, got %v", got)
+	}
+
+	if _, err := cov.Eval(discount, map[string]interface{}{"total": 50}, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+
+	if _, err := cov.Eval(names, map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "pen", "price": 20},
+		},
+	}, nil); err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	reports := cov.Report()
+	if len(reports) != 3 {
+		t.Fatalf("expected 3 reports, got %d", len(reports))
+	}
+
+	r := reports[1]
+	if r.Expr != discount.source || r.Evals != 2 {
+		t.Errorf("unexpected report: %+v", r)
+	}
+	if r.Branches != 4 || r.CoveredBranches != 3 {
+		t.Errorf("expected 3/4 branches, got %d/%d", r.CoveredBranches, r.Branches)
+	}
+
+	want := []CoverageGap{
+		{Start: 29, End: 47, Source: "member ? total - 5", Branch: "then"},
+		{Start: 38, End: 47, Source: "total - 5"},
+	}
+	if !reflect.DeepEqual(r.Gaps, want) {
+		t.Errorf("expected gaps %+v, got %+v", want, r.Gaps)
+	}
+
+	if r := reports[2]; r.Percent() != 100 || len(r.Gaps) != 0 {
+		t.Errorf("expected full coverage of %s, got %s", r.Expr, r)
+	}
+
+	if r := reports[0]; r.Evals != 0 || r.CoveredNodes != 0 || len(r.Gaps) != 1 || r.Gaps[0].Source != unused.source {
+		t.Errorf("expected no coverage of %s, got %s", r.Expr, r)
+	}
+
+	if s := reports[1].String(); !strings.Contains(s, "29-47: then branch not taken: member ? total - 5") {
+		t.Errorf("unexpected summary:\n%s", s)
+	}
+}
+
+func TestCoverage_DecisionTable(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	expr, err := comp.CompileDecisionTable(&DecisionTable{
+		Rows: []DecisionRow{
+			{When: []string{"x > 1"}, Then: "'big'"},
+		},
+		Default: "'small'",
+	})
+	if err != nil {
+		t.Fatalf("CompileDecisionTable failed: %v", err)
+	}
+
+	cov := NewCoverage()
+	if _, err := cov.Eval(expr, map[string]interface{}{"x": 2}, nil); err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	r := cov.Report()[0]
+	if r.Expr != expr.compiled().node.String() || len(r.Gaps) != 2 {
+		t.Fatalf("unexpected report: %s", r)
+	}
+
+	for _, gap := range r.Gaps {
+		if gap.Start != -1 || gap.End != -1 {
+			t.Errorf("expected no source range, got %+v", gap)
+		}
+	}
+}
+
+func TestCoverage_TailCalls(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	// Lambda bodies that end in a function call, and function
+	// calls in path steps, are evaluated as tail calls.
+	for _, src := range []string{
+		`$map([1, 2], function($x) { $string($x) })`,
+		`$map([1, 2], function($x) { ($y := $x; $string($y)) })`,
+		`items.$string(price)`,
+	} {
+		cov := NewCoverage()
+		if _, err := cov.Eval(comp.MustCompile(src), map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"price": 1},
+				map[string]interface{}{"price": 2},
+			},
+		}, nil); err != nil {
+			t.Fatalf("%s: Eval failed: %v", src, err)
+		}
+		if r := cov.Report()[0]; r.Percent() != 100 {
+			t.Errorf("expected full coverage, got %s", r)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+)
+
+// cycleCheckDepth is the nesting depth at which a cycleChecker
+// starts to look for cycles. Checking every level would slow
+// down the common case of data without cycles, and a cycle is
+// found soon enough after this depth anyway. encoding/json does
+// the same.
+const cycleCheckDepth = 1000
+
+// A cycleChecker finds cycles in Go values, such as a map that
+// contains itself, while they're read recursively. Readers call
+// enter before they read the contents of a value and leave when
+// they're done with them.
+type cycleChecker struct {
+	depth int
+	path  map[cycleKey]bool
+}
+
+// A cycleKey identifies a map, a slice or a pointer. Slices are
+// identified by their length as well as their address, because
+// a slice and its first item can start at the same address.
+type cycleKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// enter records that the contents of v are about to be read. It
+// returns a *CycleError if v is one of the values whose contents
+// are already being read, i.e. if v contains itself. Otherwise,
+// the caller must call leave with the same value afterwards.
+func (c *cycleChecker) enter(v reflect.Value) error {
+
+	c.depth++
+	if c.depth <= cycleCheckDepth {
+		return nil
+	}
+
+	key, ok := newCycleKey(v)
+	if !ok {
+		return nil
+	}
+
+	if c.path[key] {
+		c.depth--
+		return &CycleError{Type: key.typ}
+	}
+
+	if c.path == nil {
+		c.path = map[cycleKey]bool{}
+	}
+	c.path[key] = true
+	return nil
+}
+
+// leave records that the contents of v have been read.
+func (c *cycleChecker) leave(v reflect.Value) {
+
+	if c.depth > cycleCheckDepth {
+		if key, ok := newCycleKey(v); ok {
+			delete(c.path, key)
+		}
+	}
+
+	c.depth--
+}
+
+func newCycleKey(v reflect.Value) (cycleKey, bool) {
+
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map, reflect.Ptr:
+		if v.IsNil() {
+			return cycleKey{}, false
+		}
+		return cycleKey{ptr: v.Pointer(), typ: v.Type()}, true
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return cycleKey{}, false
+		}
+		return cycleKey{ptr: v.Pointer(), typ: v.Type(), len: v.Len()}, true
+	default:
+		return cycleKey{}, false
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type testCycleNode struct {
+	Name string
+	Next *testCycleNode
+}
+
+func TestCycles(t *testing.T) {
+
+	m := map[string]interface{}{"x": 1}
+	m["self"] = m
+
+	arr := []interface{}{1, nil}
+	arr[1] = arr
+
+	node := &testCycleNode{Name: "a"}
+	node.Next = &testCycleNode{Name: "b", Next: node}
+
+	tests := []struct {
+		expr string
+		data interface{}
+		typ  reflect.Type
+	}{
+		{"**.x", m, reflect.TypeOf(m)},
+		{"self.**", m, reflect.TypeOf(m)},
+		{"**.Name", node, reflect.TypeOf(node)},
+		{"$.x", arr, reflect.TypeOf(arr)},
+		{"*", map[string]interface{}{"arr": arr}, reflect.TypeOf(arr)},
+	}
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	for _, test := range tests {
+
+		_, err := comp.MustCompile(test.expr).Eval(test.data, nil)
+
+		var cerr *CycleError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%s: expected a CycleError, got %v", test.expr, err)
+			continue
+		}
+		if cerr.Type != test.typ {
+			t.Errorf("%s: expected a cycle via %s, got %s", test.expr, test.typ, cerr.Type)
+		}
+
+		// The legacy API returns the same error.
+		_, err = MustCompile(test.expr).Eval(test.data)
+		if !errors.As(err, &cerr) {
+			t.Errorf("%s: expected a CycleError from Expr.Eval, got %v", test.expr, err)
+		}
+	}
+
+	// Paths that don't go round a cycle are fine.
+	for expr, want := range map[string]interface{}{
+		"self.self.self.x": 1,
+		"Next.Next.Name":   "a",
+		"$count(self.*)":   2,
+	} {
+		data := interface{}(m)
+		if expr == "Next.Next.Name" {
+			data = node
+		}
+		got, err := comp.MustCompile(expr).Eval(data, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", expr, err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: expected %v, got %v", expr, want, got)
+		}
+	}
+}
+
+func TestCycles_Acyclic(t *testing.T) {
+
+	// A value that appears more than once, but not inside
+	// itself, isn't a cycle.
+	shared := map[string]interface{}{"x": 1}
+	var data interface{} = map[string]interface{}{"a": shared, "b": []interface{}{shared, shared}}
+
+	// Neither is deep nesting.
+	for i := 0; i < 3*cycleCheckDepth; i++ {
+		data = []interface{}{map[string]interface{}{"x": 2, "next": data}}
+	}
+
+	got, err := MustCompile("$count(**.x)").Eval(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := 3*cycleCheckDepth + 3; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %d, got %v", want, got)
+	}
+
+	if _, err := Normalize(data, nil); err != nil {
+		t.Errorf("Normalize: unexpected error: %v", err)
+	}
+}
+
+func TestNormalize_Cycles(t *testing.T) {
+
+	m := map[string]interface{}{"x": 1}
+	m["items"] = []interface{}{m}
+
+	node := &testCycleNode{Name: "a"}
+	node.Next = node
+
+	for _, v := range []interface{}{m, node} {
+
+		_, err := Normalize(v, nil)
+
+		var cerr *CycleError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%T: expected a CycleError, got %v", v, err)
+		}
+
+		_, err = Diff(v, v, nil)
+		if !errors.As(err, &cerr) {
+			t.Errorf("%T: expected a CycleError from Diff, got %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// ErrDebugAbort is returned by Expression.Debug when the
+// Debugger's Pause function returns DebugAbort.
+var ErrDebugAbort = errors.New("evaluation aborted by the debugger")
+
+// A DebugAction tells Expression.Debug how to continue after a
+// pause.
+type DebugAction int
+
+const (
+	// DebugContinue runs until the next breakpoint.
+	DebugContinue DebugAction = iota
+
+	// DebugStepInto pauses at the next node that's evaluated,
+	// which is usually the first operand of the current node.
+	DebugStepInto
+
+	// DebugStepOver pauses at the next node that isn't part
+	// of the current node, i.e. after the current node has
+	// been evaluated.
+	DebugStepOver
+
+	// DebugStepOut pauses at the next node that isn't part of
+	// the node that contains the current node.
+	DebugStepOut
+
+	// DebugAbort stops the evaluation, which returns
+	// ErrDebugAbort.
+	DebugAbort
+)
+
+// A Debugger controls an evaluation made by Expression.Debug.
+// The evaluation pauses before nodes that match a breakpoint
+// and calls Pause, which can inspect the evaluation and choose
+// how to continue. Pause may block, e.g. to wait for a user's
+// command in an interactive playground.
+type Debugger struct {
+	// Positions are breakpoints at byte offsets in the
+	// expression. The evaluation pauses before each node that
+	// starts at one of them.
+	Positions []int
+
+	// Types are breakpoints on node types, such as
+	// "FunctionCall" or "Condition" (see TraceStep.Type). The
+	// evaluation pauses before each node of one of the types.
+	Types []string
+
+	// StopOnEntry pauses the evaluation before its first node.
+	StopOnEntry bool
+
+	// Pause is called when the evaluation pauses. The frame is
+	// only valid until Pause returns.
+	Pause func(frame *DebugFrame) DebugAction
+}
+
+// A DebugFrame describes the node that an evaluation has paused
+// at.
+type DebugFrame struct {
+	// Type, Expr, Start and End describe the node like the
+	// fields of a TraceStep.
+	Type  string
+	Expr  string
+	Start int
+	End   int
+
+	// Depth is the number of nodes that are being evaluated,
+	// including this one.
+	Depth int
+
+	// Breakpoint is true if the evaluation paused because the
+	// node matches a breakpoint, rather than because of a step.
+	Breakpoint bool
+
+	// Input is the node's input, i.e. the value of $, or nil
+	// if it's undefined.
+	Input interface{}
+
+	// EvalID is the evaluation's ID, if it has one (see
+	// WithEvalID).
+	EvalID string
+
+	env *environment
+}
+
+// Vars returns the variables that are visible to the node:
+// those passed to Debug, and those bound by the expression's
+// assignments and lambda parameters, with inner bindings hiding
+// outer ones. Functions defined in the expression are returned
+// as Callables. Built-in functions, extensions, $ and variables
+// that are undefined are left out.
+func (f *DebugFrame) Vars() map[string]interface{} {
+
+	vars := map[string]interface{}{}
+	seen := map[string]bool{}
+
+	// The environments created during the evaluation share its
+	// state. Their ancestors hold the built-in functions and
+	// the Compiler's extensions and variables.
+	for s := f.env; s != nil && s.state == f.env.state; s = s.parent {
+		for name, v := range s.symbols {
+
+			if seen[name] || name == "$" {
+				continue
+			}
+			seen[name] = true
+
+			if v.IsValid() && v.CanInterface() {
+				switch x := v.Interface().(type) {
+				case *goCallable:
+					continue
+				case *partialCallable:
+					// $millis and $now (see timeCallables).
+					if x.fn == milisT || x.fn == nowT {
+						continue
+					}
+				}
+			}
+
+			if x, err := exportResult(v); err == nil {
+				vars[name] = x
+			}
+		}
+	}
+
+	return vars
+}
+
+// Debug evaluates the expression like EvalContext under the
+// control of a Debugger. It's meant for tools that step through
+// an expression, such as an interactive playground. Like
+// Explain, Debug turns off the optimizations that skip the
+// evaluation of parts of an expression.
+func (e *Expression) Debug(ctx context.Context, data interface{}, vars map[string]interface{}, d *Debugger) (interface{}, error) {
+
+	if d == nil {
+		d = &Debugger{}
+	}
+
+	k := e.compiled()
+
+	sess := &debugSession{
+		d:         d,
+		src:       e.source,
+		ranges:    k.ranges,
+		positions: map[int]bool{},
+		types:     map[string]bool{},
+	}
+
+	for _, pos := range d.Positions {
+		sess.positions[pos] = true
+	}
+	for _, typ := range d.Types {
+		sess.types[typ] = true
+	}
+	if d.StopOnEntry {
+		sess.action = DebugStepInto
+	}
+
+	var result reflect.Value
+
+	err := e.withEvalEnv(ctx, k, e.newBaseEnv(), data, vars, nil, func(input reflect.Value, env *environment) error {
+		env.state.unoptimize()
+		env.state.debug = sess
+
+		var err error
+		result, err = eval(k.node, input, env)
+		return err
+	})
+	if err != nil {
+		if sess.aborted {
+			return nil, ErrDebugAbort
+		}
+		return nil, err
+	}
+
+	return exportResult(result)
+}
+
+// A debugSession runs a Debugger for a single evaluation.
+type debugSession struct {
+	d      *Debugger
+	src    string
+	ranges map[jparse.Node]jparse.Range
+
+	positions map[int]bool
+	types     map[string]bool
+
+	// action is the last action returned by Pause and target
+	// is the depth that DebugStepOver and DebugStepOut pause
+	// at.
+	action DebugAction
+	target int
+
+	// spans holds the nodes that are being evaluated.
+	spans   []debugSpan
+	aborted bool
+}
+
+// A debugSpan is the source range of a node that's being
+// evaluated, and whether the evaluation paused at it.
+type debugSpan struct {
+	jparse.Range
+	paused bool
+}
+
+// eval evaluates a node, pausing first if it matches a
+// breakpoint or the current step.
+func (s *debugSession) eval(node jparse.Node, input reflect.Value, env *environment) (reflect.Value, error) {
+
+	if s.aborted {
+		return undefined, ErrDebugAbort
+	}
+
+	expr, start, end := nodeSource(node, s.src, s.ranges)
+	span := debugSpan{Range: jparse.Range{Start: start, End: end}}
+
+	// Don't pause twice for the same source, e.g. for a path
+	// and its only step.
+	n := len(s.spans)
+	same := start >= 0 && n > 0 && s.spans[n-1].Range == span.Range && s.spans[n-1].paused
+
+	s.spans = append(s.spans, span)
+	defer func() { s.spans = s.spans[:n] }()
+
+	if !same {
+		paused, err := s.pause(node, expr, start, end, input, env)
+		if err != nil {
+			return undefined, err
+		}
+		s.spans[n].paused = paused
+	}
+
+	return evalNode(node, input, env)
+}
+
+// pause calls the Debugger's Pause function if the evaluation
+// should pause at a node and returns true if it did.
+func (s *debugSession) pause(node jparse.Node, expr string, start, end int, input reflect.Value, env *environment) (bool, error) {
+
+	depth := len(s.spans)
+	typ := nodeType(node)
+	breakpoint := (start >= 0 && s.positions[start]) || s.types[typ]
+
+	var step bool
+	switch s.action {
+	case DebugStepInto:
+		step = true
+	case DebugStepOver, DebugStepOut:
+		step = depth <= s.target
+	}
+
+	if !breakpoint && !step || s.d.Pause == nil {
+		return false, nil
+	}
+
+	in, _ := exportResult(input)
+
+	action := s.d.Pause(&DebugFrame{
+		Type:       typ,
+		Expr:       expr,
+		Start:      start,
+		End:        end,
+		Depth:      depth,
+		Breakpoint: breakpoint,
+		Input:      in,
+		EvalID:     EvalID(env.state.context),
+		env:        env,
+	})
+
+	switch action {
+	case DebugAbort:
+		s.aborted = true
+		return true, ErrDebugAbort
+	case DebugStepOver:
+		s.target = depth
+	case DebugStepOut:
+		s.target = depth - 1
+	}
+	s.action = action
+
+	return true, nil
+}
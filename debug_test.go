@@ -0,0 +1,221 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// debugScript returns a Pause function that returns actions in
+// order, recording each frame's Expr, and then continues.
+func debugScript(stops *[]string, actions ...DebugAction) func(*DebugFrame) DebugAction {
+	return func(f *DebugFrame) DebugAction {
+		*stops = append(*stops, f.Expr)
+		if len(actions) == 0 {
+			return DebugContinue
+		}
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	}
+}
+
+func TestExpression_Debug(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	const expr = `$count(items) > 1 ? "many" : "few"`
+	e := comp.MustCompile(expr)
+
+	input := map[string]interface{}{
+		"items": []interface{}{1, 2, 3},
+	}
+
+	data := []struct {
+		Name     string
+		Debugger Debugger
+		Actions  []DebugAction
+		Stops    []string
+	}{
+		{
+			Name: "step",
+			Debugger: Debugger{
+				StopOnEntry: true,
+			},
+			Actions: []DebugAction{DebugStepInto, DebugStepInto, DebugStepInto, DebugStepOver, DebugStepOver, DebugStepOut},
+			Stops: []string{
+				expr,
+				"$count(items) > 1",
+				"$count(items)",
+				"$count",
+				"items",
+				"1",
+				`"many"`,
+			},
+		},
+		{
+			Name: "continue",
+			Debugger: Debugger{
+				StopOnEntry: true,
+			},
+			Actions: []DebugAction{DebugContinue},
+			Stops: []string{
+				expr,
+			},
+		},
+		{
+			Name: "positions",
+			Debugger: Debugger{
+				Positions: []int{strings.Index(expr, "items"), strings.Index(expr, `"many"`)},
+			},
+			Stops: []string{
+				"items",
+				`"many"`,
+			},
+		},
+		{
+			Name: "types",
+			Debugger: Debugger{
+				Types: []string{"FunctionCall", "String"},
+			},
+			Stops: []string{
+				"$count(items)",
+				`"many"`,
+			},
+		},
+	}
+
+	for _, test := range data {
+
+		var got []string
+		d := test.Debugger
+		d.Pause = debugScript(&got, test.Actions...)
+
+		v, err := e.Debug(context.Background(), input, nil, &d)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Name, err)
+		}
+		if v != "many" {
+			t.Errorf("%s: expected many, got %v", test.Name, v)
+		}
+		if !reflect.DeepEqual(got, test.Stops) {
+			t.Errorf("%s: expected stops %q, got %q", test.Name, test.Stops, got)
+		}
+	}
+}
+
+func TestExpression_Debug_Vars(t *testing.T) {
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"double": {Func: func(n float64) float64 { return 2 * n }},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`($rate := 0.5; $f := function($n) { $double($n) * $rate }; $f(price))`)
+
+	var frames []string
+	d := &Debugger{
+		Types: []string{"Name"},
+		Pause: func(f *DebugFrame) DebugAction {
+			vars := f.Vars()
+
+			fn, ok := vars["f"]
+			delete(vars, "f")
+			if _, callable := fn.(*lambdaCallable); !ok || !callable {
+				t.Errorf("expected $f to be a lambda, got %T", fn)
+			}
+
+			frames = append(frames, fmt.Sprintf("%s %s %v %v", f.Expr, f.Type, f.Input, vars))
+			return DebugContinue
+		},
+	}
+
+	v, err := e.Debug(WithEvalID(context.Background(), "dbg-1"), map[string]interface{}{"price": 8}, map[string]interface{}{"tax": 1}, d)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != float64(8) {
+		t.Errorf("expected 8, got %v", v)
+	}
+
+	want := []string{
+		"price Name map[price:8] map[rate:0.5 tax:1]",
+	}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("expected frames %q, got %q", want, frames)
+	}
+
+	// Lambda parameters are visible inside the lambda.
+	var inner map[string]interface{}
+	var id string
+	d = &Debugger{
+		Types: []string{"FunctionCall"},
+		Pause: func(f *DebugFrame) DebugAction {
+			if f.Expr == "$double($n)" {
+				inner = f.Vars()
+				id = f.EvalID
+			}
+			return DebugContinue
+		},
+	}
+
+	if _, err := e.Debug(WithEvalID(context.Background(), "dbg-2"), map[string]interface{}{"price": 8}, nil, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(inner["n"], inner["rate"]) != "8 0.5" {
+		t.Errorf("expected $n and $rate in the lambda, got %v", inner)
+	}
+	if id != "dbg-2" {
+		t.Errorf("expected the evaluation ID dbg-2, got %q", id)
+	}
+}
+
+func TestExpression_Debug_Abort(t *testing.T) {
+
+	var calls int
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"side": {Func: func() int {
+			calls++
+			return calls
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`[$side(), $side(), $side()]`)
+
+	var stops []string
+	d := &Debugger{
+		Types: []string{"FunctionCall"},
+		Pause: debugScript(&stops, DebugContinue, DebugAbort),
+	}
+
+	if _, err := e.Debug(context.Background(), nil, nil, d); err != ErrDebugAbort {
+		t.Errorf("expected ErrDebugAbort, got %v", err)
+	}
+	if calls != 1 || len(stops) != 2 {
+		t.Errorf("expected to stop after one call, got %d calls and stops %q", calls, stops)
+	}
+
+	// A nil Debugger just evaluates the expression.
+	calls = 0
+	v, err := e.Debug(context.Background(), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(v, []interface{}{1, 2, 3}) {
+		t.Errorf("expected [1 2 3], got %v", v)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// A DecisionTable maps conditions to outcomes. Each row has a
+// list of conditions, which are JSONata predicates such as
+//
+//	age >= 18
+//
+// and an outcome, which is a JSONata expression. The table's
+// result is the outcome of the first row whose conditions are
+// all true, or the Default outcome if no row matches. A
+// condition that is empty or "-" matches anything.
+//
+// Conditions, if set, names the table's condition columns. The
+// names are used in error messages and every row must have one
+// condition per column.
+type DecisionTable struct {
+	Conditions []string      `json:"conditions,omitempty"`
+	Rows       []DecisionRow `json:"rows"`
+	Default    string        `json:"default,omitempty"`
+}
+
+// A DecisionRow is a row in a DecisionTable.
+type DecisionRow struct {
+	When []string `json:"when"`
+	Then string   `json:"then"`
+}
+
+// ReadDecisionTableJSON reads a DecisionTable from a JSON
+// document with the same layout as the DecisionTable type:
+//
+//	{
+//	    "conditions": ["age", "country"],
+//	    "rows": [
+//	        {"when": ["age < 18", "-"], "then": "'minor'"},
+//	        {"when": ["-", "country = 'US'"], "then": "'domestic'"}
+//	    ],
+//	    "default": "'international'"
+//	}
+func ReadDecisionTableJSON(r io.Reader) (*DecisionTable, error) {
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var t DecisionTable
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("cannot read decision table: %w", err)
+	}
+
+	return &t, nil
+}
+
+// ReadDecisionTableCSV reads a DecisionTable from CSV. The first
+// record is a header that names the columns. The last column
+// holds the outcomes and the other columns hold the conditions.
+// Every other record is a row. The table has no Default, but a
+// final row whose conditions are all "-" has the same effect.
+func ReadDecisionTableCSV(r io.Reader) (*DecisionTable, error) {
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read decision table: %w", err)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("cannot read decision table: missing header")
+	}
+
+	header := records[0]
+	last := len(header) - 1
+
+	t := &DecisionTable{
+		Conditions: header[:last],
+		Rows:       make([]DecisionRow, len(records)-1),
+	}
+
+	for i, rec := range records[1:] {
+		t.Rows[i] = DecisionRow{
+			When: rec[:last],
+			Then: rec[last],
+		}
+	}
+
+	return t, nil
+}
+
+// CompileDecisionTable compiles a DecisionTable into a single
+// Expression that is equivalent to a chain of conditional
+// expressions, one per row. Each cell is parsed separately, so
+// errors are reported by row and column. A row that follows a
+// row that matches anything is unreachable and is an error.
+func (c *Compiler) CompileDecisionTable(t *DecisionTable) (*Expression, error) {
+
+	if len(t.Rows) == 0 && t.Default == "" {
+		return nil, fmt.Errorf("decision table has no rows")
+	}
+
+	var node jparse.Node
+
+	if t.Default != "" {
+		def, err := c.compileCell(t.Default)
+		if err != nil {
+			return nil, fmt.Errorf("default: %w", err)
+		}
+		node = def
+	}
+
+	// Build the chain from the last row up, so that each row's
+	// conditional falls through to the rows below it.
+	for i := len(t.Rows) - 1; i >= 0; i-- {
+
+		row := t.Rows[i]
+
+		if len(t.Conditions) > 0 && len(row.When) != len(t.Conditions) {
+			return nil, fmt.Errorf("row %d: expected %d conditions, got %d", i+1, len(t.Conditions), len(row.When))
+		}
+
+		then, err := c.compileCell(row.Then)
+		if err != nil {
+			return nil, fmt.Errorf("row %d, outcome: %w", i+1, err)
+		}
+
+		cond, err := t.parseConditions(i, c.compileCell)
+		if err != nil {
+			return nil, err
+		}
+
+		if cond == nil {
+			if node != nil {
+				return nil, fmt.Errorf("row %d matches anything, so the rows after it are unreachable", i+1)
+			}
+			node = then
+			continue
+		}
+
+		node = &jparse.ConditionalNode{
+			If:   cond,
+			Then: then,
+			Else: node,
+		}
+	}
+
+	// The cells are checked separately, but the limits apply to
+	// the table as a whole too.
+	if err := c.checkComplexity(node, "", nil); err != nil {
+		return nil, err
+	}
+
+	return c.newExpression(node, nil, ""), nil
+}
+
+// compileCell prepares the source of a decision table cell as
+// Compile prepares an expression.
+func (c *Compiler) compileCell(src string) (jparse.Node, error) {
+
+	node, ranges, src, errs := c.compileNode(src, false)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	if errs := c.checkLibraries(node, src, ranges); len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return node, nil
+}
+
+// parseConditions returns the conditions of a row, combined with
+// the and operator, or nil if the row matches anything. The cells
+// are prepared with compile.
+func (t *DecisionTable) parseConditions(row int, compile func(string) (jparse.Node, error)) (jparse.Node, error) {
+
+	var cond jparse.Node
+
+	for i, cell := range t.Rows[row].When {
+
+		if cell = strings.TrimSpace(cell); cell == "" || cell == "-" {
+			continue
+		}
+
+		node, err := compile(cell)
+		if err != nil {
+			return nil, fmt.Errorf("row %d, %s: %w", row+1, t.columnName(i), err)
+		}
+
+		if cond == nil {
+			cond = node
+			continue
+		}
+
+		cond = &jparse.BooleanOperatorNode{
+			Type: jparse.BooleanAnd,
+			LHS:  cond,
+			RHS:  node,
+		}
+	}
+
+	return cond, nil
+}
+
+func (t *DecisionTable) columnName(i int) string {
+	if i < len(t.Conditions) && t.Conditions[i] != "" {
+		return fmt.Sprintf("condition %q", t.Conditions[i])
+	}
+	return fmt.Sprintf("condition %d", i+1)
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDecisionCSV = `tier,total,discount
+"tier = 'gold'",total >= 100,0.2
+"tier = 'gold'",-,0.1
+-,total >= 500,0.05
+-,-,0
+`
+
+const testDecisionJSON = `{
+	"conditions": ["tier", "total"],
+	"rows": [
+		{"when": ["tier = 'gold'", "total >= 100"], "then": "0.2"},
+		{"when": ["tier = 'gold'", "-"], "then": "0.1"},
+		{"when": ["", "total >= 500"], "then": "0.05"}
+	],
+	"default": "0"
+}`
+
+func TestCompiler_CompileDecisionTable(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	fromCSV, err := ReadDecisionTableCSV(strings.NewReader(testDecisionCSV))
+	if err != nil {
+		t.Fatalf("ReadDecisionTableCSV failed: %v", err)
+	}
+
+	fromJSON, err := ReadDecisionTableJSON(strings.NewReader(testDecisionJSON))
+	if err != nil {
+		t.Fatalf("ReadDecisionTableJSON failed: %v", err)
+	}
+
+	tests := []struct {
+		input map[string]interface{}
+		want  interface{}
+	}{
+		{map[string]interface{}{"tier": "gold", "total": 150}, 0.2},
+		{map[string]interface{}{"tier": "gold", "total": 50}, 0.1},
+		{map[string]interface{}{"tier": "silver", "total": 600}, 0.05},
+		{map[string]interface{}{"tier": "silver", "total": 50}, float64(0)},
+		{map[string]interface{}{}, float64(0)},
+	}
+
+	for name, table := range map[string]*DecisionTable{"csv": fromCSV, "json": fromJSON} {
+
+		expr, err := comp.CompileDecisionTable(table)
+		if err != nil {
+			t.Fatalf("%s: CompileDecisionTable failed: %v", name, err)
+		}
+
+		for _, test := range tests {
+
+			got, err := expr.Eval(test.input, nil)
+			if err != nil {
+				t.Errorf("%s: %v: Eval failed: %v", name, test.input, err)
+				continue
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s: %v: expected %v, got %v", name, test.input, test.want, got)
+			}
+		}
+	}
+
+	// Without a default, no match is undefined.
+	expr, err := comp.CompileDecisionTable(&DecisionTable{
+		Rows: []DecisionRow{
+			{When: []string{"x > 1"}, Then: "{'big': true}"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CompileDecisionTable failed: %v", err)
+	}
+	if _, err := expr.Eval(map[string]interface{}{"x": 1}, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
+
+func TestCompiler_CompileDecisionTableErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		table *DecisionTable
+		want  string
+	}{
+		{
+			table: &DecisionTable{},
+			want:  "decision table has no rows",
+		},
+		{
+			table: &DecisionTable{
+				Conditions: []string{"a", "b"},
+				Rows:       []DecisionRow{{When: []string{"true"}, Then: "1"}},
+			},
+			want: "row 1: expected 2 conditions, got 1",
+		},
+		{
+			table: &DecisionTable{
+				Conditions: []string{"age"},
+				Rows: []DecisionRow{
+					{When: []string{"true"}, Then: "1"},
+					{When: []string{"age <"}, Then: "2"},
+				},
+			},
+			want: `row 2, condition "age": `,
+		},
+		{
+			table: &DecisionTable{
+				Rows: []DecisionRow{{When: []string{"true"}, Then: "("}},
+			},
+			want: "row 1, outcome: ",
+		},
+		{
+			table: &DecisionTable{
+				Rows: []DecisionRow{
+					{When: []string{"-"}, Then: "1"},
+					{When: []string{"true"}, Then: "2"},
+				},
+			},
+			want: "row 1 matches anything",
+		},
+		{
+			table: &DecisionTable{
+				Rows:    []DecisionRow{{When: []string{""}, Then: "1"}},
+				Default: "2",
+			},
+			want: "row 1 matches anything",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := comp.CompileDecisionTable(test.table)
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%+v: expected error %q, got %v", test.table, test.want, err)
+		}
+	}
+
+	if _, err := ReadDecisionTableJSON(strings.NewReader(`{"rowz": []}`)); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+
+	if _, err := ReadDecisionTableCSV(strings.NewReader("a,b\n1,2,3\n")); err == nil {
+		t.Errorf("expected error for wrong number of fields")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// The package-level default compiler. It's configured by
+// RegisterDefault and SetDefault until Default is first called,
+// and frozen afterwards.
+var (
+	defaultMutex    sync.Mutex
+	defaultCompiler *Compiler
+	defaultFrozen   bool
+)
+
+// Default returns the package-level default Compiler, so that
+// small programs can compile expressions without creating and
+// passing around a Compiler of their own:
+//
+//	expr := jsonata.Default().MustCompile(`$sum(orders.total)`)
+//
+// The default compiler has the built-in functions and whatever
+// was registered with RegisterDefault or set with SetDefault,
+// typically from init functions. The first call to Default
+// freezes it: later calls to RegisterDefault and SetDefault
+// return an error, as do the compiler's RegisterModule and
+// RegisterValueConverter methods, so every expression compiled
+// with the default compiler sees the same functions. Default is
+// safe for concurrent use.
+//
+// The default compiler is separate from the registry used by the
+// package-level Compile function (see RegisterExts).
+func Default() *Compiler {
+
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	if defaultCompiler == nil {
+		defaultCompiler = &Compiler{accessors: newAccessorTable(), exprs: newExprRegistry()}
+	}
+	if !defaultFrozen {
+		defaultCompiler.frozen = true
+		defaultFrozen = true
+	}
+
+	return defaultCompiler
+}
+
+// RegisterDefault adds variables and extensions to the default
+// compiler and applies options to it, in the same way as
+// NewCompiler. It can be called any number of times, including
+// from several goroutines, until Default is first called. Each
+// registration replaces any variable or extension of the same
+// name from an earlier one, and options replace the settings of
+// earlier options, so a program can override what a library
+// registered in its init function. If anything is invalid,
+// nothing is registered.
+func RegisterDefault(vars map[string]interface{}, exts map[string]Extension, opts ...CompilerOption) error {
+
+	update, err := NewCompiler(vars, exts)
+	if err != nil {
+		return err
+	}
+
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	if defaultFrozen {
+		return errDefaultFrozen()
+	}
+
+	c := &Compiler{accessors: newAccessorTable(), exprs: newExprRegistry()}
+	if defaultCompiler != nil {
+		c = defaultCompiler.clone()
+	}
+
+	for name, v := range update.baseRegistry {
+		c.setBase(name, v)
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return err
+		}
+	}
+
+	defaultCompiler = c
+	return nil
+}
+
+// SetDefault replaces the default compiler with c, discarding
+// anything registered with RegisterDefault. It's for programs
+// that configure a Compiler themselves, e.g. from a config file,
+// and want the rest of the program to use it through Default.
+// Like RegisterDefault, it returns an error once Default has
+// been called. c must not be modified after it's set.
+func SetDefault(c *Compiler) error {
+
+	if c == nil {
+		return fmt.Errorf("the default compiler cannot be nil")
+	}
+
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	if defaultFrozen {
+		return errDefaultFrozen()
+	}
+
+	defaultCompiler = c
+	return nil
+}
+
+func errDefaultFrozen() error {
+	return fmt.Errorf("the default compiler is in use and can no longer be changed")
+}
+
+// clone returns a copy of a Compiler that can be changed without
+// affecting the original.
+func (c *Compiler) clone() *Compiler {
+
+	clone := *c
+	clone.frozen = false
+	if c.exprs != nil {
+		clone.exprs = newExprRegistry()
+	}
+
+	if c.baseRegistry != nil {
+		clone.baseRegistry = make(map[string]reflect.Value, len(c.baseRegistry))
+		for name, v := range c.baseRegistry {
+			clone.baseRegistry[name] = v
+		}
+	}
+
+	if c.libraries != nil {
+		clone.libraries = make(map[string]*library, len(c.libraries))
+		for name, lib := range c.libraries {
+			clone.libraries[name] = lib
+		}
+	}
+
+	if c.disabled != nil {
+		clone.disabled = make(map[string]bool, len(c.disabled))
+		for name := range c.disabled {
+			clone.disabled[name] = true
+		}
+	}
+
+	if c.allowed != nil {
+		clone.allowed = make(map[string]bool, len(c.allowed))
+		for name := range c.allowed {
+			clone.allowed[name] = true
+		}
+	}
+
+	if c.converters != nil {
+		clone.converters = make(valueConverters, len(c.converters))
+		for typ, fn := range c.converters {
+			clone.converters[typ] = fn
+		}
+	}
+
+	return &clone
+}
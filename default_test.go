@@ -0,0 +1,122 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// resetDefault discards the default compiler so that a test can
+// configure a new one.
+func resetDefault() {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultCompiler = nil
+	defaultFrozen = false
+}
+
+func TestDefault(t *testing.T) {
+
+	resetDefault()
+	defer resetDefault()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := RegisterDefault(map[string]interface{}{
+				"greeting": "hello",
+			}, map[string]Extension{
+				"upper": {Func: strings.ToUpper},
+			})
+			if err != nil {
+				t.Errorf("RegisterDefault failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Later registrations override earlier ones.
+	err := RegisterDefault(map[string]interface{}{
+		"greeting": "hi",
+	}, nil, WithModule("str", map[string]Extension{
+		"reverse": {Func: func(s string) string {
+			r := []rune(s)
+			for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+				r[i], r[j] = r[j], r[i]
+			}
+			return string(r)
+		}},
+	}))
+	if err != nil {
+		t.Fatalf("RegisterDefault failed: %v", err)
+	}
+
+	// A failed registration changes nothing.
+	err = RegisterDefault(map[string]interface{}{
+		"greeting": "hey",
+	}, nil, WithMapProgress(1, nil))
+	if err == nil {
+		t.Errorf("expected an error for an invalid option")
+	}
+
+	got, err := Default().MustCompile(`$upper($greeting) & $str.reverse("abc")`).Eval(nil, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if got != "HIcba" {
+		t.Errorf("expected HIcba, got %v", got)
+	}
+
+	if Default() != Default() {
+		t.Errorf("expected Default to return the same compiler")
+	}
+
+	for name, err := range map[string]error{
+		"RegisterDefault":        RegisterDefault(map[string]interface{}{"greeting": "hey"}, nil),
+		"SetDefault":             SetDefault(&Compiler{}),
+		"RegisterModule":         Default().RegisterModule("util", nil),
+		"RegisterValueConverter": Default().RegisterValueConverter(reflect.TypeOf(0), func(v interface{}) interface{} { return v }),
+	} {
+		if err == nil || !strings.Contains(err.Error(), "can no longer be changed") {
+			t.Errorf("%s: expected an error after Default, got %v", name, err)
+		}
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+
+	resetDefault()
+	defer resetDefault()
+
+	if err := RegisterDefault(map[string]interface{}{"x": 1}, nil); err != nil {
+		t.Fatalf("RegisterDefault failed: %v", err)
+	}
+
+	comp, err := NewCompiler(map[string]interface{}{"y": 2}, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	if err := SetDefault(comp); err != nil {
+		t.Fatalf("SetDefault failed: %v", err)
+	}
+
+	if Default() != comp {
+		t.Fatalf("expected Default to return the compiler passed to SetDefault")
+	}
+
+	got, err := Default().MustCompile(`[$x, $y]`).Eval(nil, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, []interface{}{2}) {
+		t.Errorf("expected [2], got %v", got)
+	}
+}
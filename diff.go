@@ -0,0 +1,348 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DiffOptions control how Diff compares values.
+type DiffOptions struct {
+	// Tolerance is the largest absolute difference between two
+	// numbers that are considered equal, e.g. 1e-9 to ignore
+	// floating point rounding.
+	Tolerance float64
+
+	// CollapseSingletons treats an array that contains exactly
+	// one value as the value itself, as JSONata sequences do,
+	// so that [5] and 5 are equal.
+	CollapseSingletons bool
+}
+
+// A DiffKind is the kind of a Difference.
+type DiffKind int
+
+const (
+	// DiffChanged means that the values are of the same type
+	// but not equal.
+	DiffChanged DiffKind = iota
+
+	// DiffTypeChanged means that the values are of different
+	// types, e.g. a string and a number.
+	DiffTypeChanged
+
+	// DiffMissing means that an object member or array item
+	// is in the expected value but not in the actual one.
+	DiffMissing
+
+	// DiffExtra means that an object member or array item is
+	// in the actual value but not in the expected one.
+	DiffExtra
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffChanged:
+		return "changed"
+	case DiffTypeChanged:
+		return "type changed"
+	case DiffMissing:
+		return "missing"
+	case DiffExtra:
+		return "extra"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", int(k))
+	}
+}
+
+// A Difference is a difference between two values at a single
+// location.
+type Difference struct {
+	// Path is the location of the difference as a JSONata path,
+	// e.g. orders[0].total, or $ for the values themselves.
+	// Evaluating Path against either value returns the value
+	// that differs.
+	Path string
+
+	Kind DiffKind
+
+	// Want and Got are the expected and actual values, after
+	// normalization (see Normalize). Want is nil if Kind is
+	// DiffExtra and Got is nil if Kind is DiffMissing.
+	Want interface{}
+	Got  interface{}
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffMissing:
+		return fmt.Sprintf("%s: missing, want %s", d.Path, diffValue(d.Want))
+	case DiffExtra:
+		return fmt.Sprintf("%s: extra value %s", d.Path, diffValue(d.Got))
+	case DiffTypeChanged:
+		return fmt.Sprintf("%s: type changed from %s %s to %s %s",
+			d.Path, diffType(d.Want), diffValue(d.Want), diffType(d.Got), diffValue(d.Got))
+	default:
+		return fmt.Sprintf("%s: want %s, got %s", d.Path, diffValue(d.Want), diffValue(d.Got))
+	}
+}
+
+// Differences is a list of differences returned by Diff.
+type Differences []Difference
+
+// String returns a report with one line per difference.
+func (ds Differences) String() string {
+
+	if len(ds) == 0 {
+		return "no differences\n"
+	}
+
+	var b strings.Builder
+
+	for _, d := range ds {
+		b.WriteString(d.String())
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// Diff compares an expected evaluation result, such as a golden
+// output, with an actual result and returns their differences.
+// Both values are normalized first (see Normalize), so an int
+// and a float64 with the same value are equal, as are a struct
+// and the equivalent map. Objects are compared member by member
+// and arrays item by item, and the differences are sorted by
+// path. Diff returns an error if either value can't be
+// normalized. A nil opts is the same as a zero DiffOptions.
+func Diff(want, got interface{}, opts *DiffOptions) (Differences, error) {
+
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+
+	nopts := &NormalizeOptions{
+		CollapseSingletons: opts.CollapseSingletons,
+	}
+
+	w, err := Normalize(want, nopts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compare expected value: %w", err)
+	}
+
+	g, err := Normalize(got, nopts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compare actual value: %w", err)
+	}
+
+	d := &differ{
+		opts: opts,
+	}
+	d.diff(nil, w, g)
+
+	sort.SliceStable(d.diffs, func(i, j int) bool {
+		return lessPath(d.diffs[i].path, d.diffs[j].path)
+	})
+
+	diffs := make(Differences, len(d.diffs))
+	for i, e := range d.diffs {
+		diffs[i] = e.Difference
+	}
+
+	return diffs, nil
+}
+
+type differ struct {
+	opts  *DiffOptions
+	diffs []diffEntry
+}
+
+type diffEntry struct {
+	Difference
+	path []diffStep
+}
+
+// A diffStep is an object key or, if key is nil, an array index.
+type diffStep struct {
+	key   *string
+	index int
+}
+
+func (d *differ) add(path []diffStep, kind DiffKind, want, got interface{}) {
+	d.diffs = append(d.diffs, diffEntry{
+		Difference: Difference{
+			Path: diffPath(path),
+			Kind: kind,
+			Want: want,
+			Got:  got,
+		},
+		path: path,
+	})
+}
+
+func (d *differ) diff(path []diffStep, want, got interface{}) {
+
+	if diffType(want) != diffType(got) {
+		d.add(path, DiffTypeChanged, want, got)
+		return
+	}
+
+	switch w := want.(type) {
+	case map[string]interface{}:
+		d.diffObjects(path, w, got.(map[string]interface{}))
+
+	case []interface{}:
+		d.diffArrays(path, w, got.([]interface{}))
+
+	case float64:
+		if math.Abs(w-got.(float64)) > d.opts.Tolerance {
+			d.add(path, DiffChanged, want, got)
+		}
+
+	default:
+		if want != got {
+			d.add(path, DiffChanged, want, got)
+		}
+	}
+}
+
+func (d *differ) diffObjects(path []diffStep, want, got map[string]interface{}) {
+
+	for key, w := range want {
+		key := key
+		g, ok := got[key]
+		if !ok {
+			d.add(appendStep(path, diffStep{key: &key}), DiffMissing, w, nil)
+			continue
+		}
+		d.diff(appendStep(path, diffStep{key: &key}), w, g)
+	}
+
+	for key, g := range got {
+		key := key
+		if _, ok := want[key]; !ok {
+			d.add(appendStep(path, diffStep{key: &key}), DiffExtra, nil, g)
+		}
+	}
+}
+
+func (d *differ) diffArrays(path []diffStep, want, got []interface{}) {
+
+	for i, w := range want {
+		if i >= len(got) {
+			d.add(appendStep(path, diffStep{index: i}), DiffMissing, w, nil)
+			continue
+		}
+		d.diff(appendStep(path, diffStep{index: i}), w, got[i])
+	}
+
+	for i := len(want); i < len(got); i++ {
+		d.add(appendStep(path, diffStep{index: i}), DiffExtra, nil, got[i])
+	}
+}
+
+// lessPath orders paths by object key and array index, with
+// the differences in an object or array before the
+// differences in its members or items.
+func lessPath(a, b []diffStep) bool {
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+
+		x, y := a[i], b[i]
+		switch {
+		case x.key == nil && y.key == nil:
+			if x.index != y.index {
+				return x.index < y.index
+			}
+		case x.key == nil || y.key == nil:
+			return x.key == nil
+		case *x.key != *y.key:
+			return *x.key < *y.key
+		}
+	}
+
+	return len(a) < len(b)
+}
+
+func appendStep(path []diffStep, step diffStep) []diffStep {
+	return append(append([]diffStep(nil), path...), step)
+}
+
+// diffPath formats a path as a JSONata path expression.
+func diffPath(path []diffStep) string {
+
+	if len(path) == 0 {
+		return "$"
+	}
+
+	var b strings.Builder
+
+	for i, step := range path {
+
+		if step.key == nil {
+			if i == 0 {
+				b.WriteByte('$')
+			}
+			fmt.Fprintf(&b, "[%d]", step.index)
+			continue
+		}
+
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(pathExpr([]string{*step.key}))
+	}
+
+	return b.String()
+}
+
+// diffType returns the JSON type of a normalized value.
+func diffType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// maxDiffValue is the length after which values in difference
+// reports are truncated.
+const maxDiffValue = 60
+
+// diffValue formats a normalized value as JSON for a report.
+func diffValue(v interface{}) string {
+
+	var s string
+	switch v := v.(type) {
+	case float64:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		s = string(b)
+	}
+
+	if r := []rune(s); len(r) > maxDiffValue {
+		s = string(r[:maxDiffValue-3]) + "..."
+	}
+
+	return s
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+
+	var want, got interface{}
+
+	if err := json.Unmarshal([]byte(`{
+		"id": 42,
+		"total": 10.5,
+		"name": "Ada",
+		"tags": ["a", "b"],
+		"first name": "x",
+		"items": [{"sku": "p1", "qty": 1}, {"sku": "p2", "qty": 2}, {"sku": "p3"}],
+		"extra": null
+	}`), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	got = map[string]interface{}{
+		"id":         "42",
+		"total":      10.5000001,
+		"name":       "Bob",
+		"tags":       []string{"a", "b", "c"},
+		"first name": "y",
+		"items": []interface{}{
+			map[string]interface{}{"sku": "p1", "qty": 1},
+			map[string]interface{}{"sku": "p2", "qty": 3, "note": "late"},
+		},
+	}
+
+	diffs, err := Diff(want, got, &DiffOptions{Tolerance: 1e-3})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	expected := Differences{
+		{Path: "extra", Kind: DiffMissing},
+		{Path: "`first name`", Kind: DiffChanged, Want: "x", Got: "y"},
+		{Path: "id", Kind: DiffTypeChanged, Want: float64(42), Got: "42"},
+		{Path: "items[1].note", Kind: DiffExtra, Got: "late"},
+		{Path: "items[1].qty", Kind: DiffChanged, Want: float64(2), Got: float64(3)},
+		{Path: "items[2]", Kind: DiffMissing, Want: map[string]interface{}{"sku": "p3"}},
+		{Path: "name", Kind: DiffChanged, Want: "Ada", Got: "Bob"},
+		{Path: "tags[2]", Kind: DiffExtra, Got: "c"},
+	}
+
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected %v, got %v", expected, diffs)
+	}
+
+	report := `extra: missing, want null
+` + "`first name`" + `: want "x", got "y"
+id: type changed from number 42 to string "42"
+items[1].note: extra value "late"
+items[1].qty: want 2, got 3
+items[2]: missing, want {"sku":"p3"}
+name: want "Ada", got "Bob"
+tags[2]: extra value "c"
+`
+	if s := diffs.String(); s != report {
+		t.Errorf("expected report:\n%s\ngot:\n%s", report, s)
+	}
+
+	// Without a tolerance, the totals differ.
+	diffs, err = Diff(map[string]interface{}{"total": 10.5}, map[string]interface{}{"total": 10.5000001}, nil)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].Path != "total" {
+		t.Errorf("expected a difference in total, got %v", diffs)
+	}
+}
+
+func TestDiff_Arrays(t *testing.T) {
+
+	tests := []struct {
+		want, got interface{}
+		opts      *DiffOptions
+		paths     []string
+	}{
+		{
+			want:  []interface{}{1, 2},
+			got:   []interface{}{1, 2},
+			paths: nil,
+		},
+		{
+			want:  []interface{}{5},
+			got:   5,
+			paths: []string{"$"},
+		},
+		{
+			want:  []interface{}{5},
+			got:   5,
+			opts:  &DiffOptions{CollapseSingletons: true},
+			paths: nil,
+		},
+		{
+			want:  []interface{}{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+			got:   []interface{}{0, 1, 9, 3, 4, 5, 6, 7, 8, 9, 9},
+			paths: []string{"$[2]", "$[10]", "$[11]"},
+		},
+		{
+			want:  []interface{}{map[string]interface{}{"a": 1}},
+			got:   []interface{}{map[string]interface{}{"a": 2}},
+			paths: []string{"$[0].a"},
+		},
+	}
+
+	for _, test := range tests {
+
+		diffs, err := Diff(test.want, test.got, test.opts)
+		if err != nil {
+			t.Errorf("%v: Diff failed: %v", test.want, err)
+			continue
+		}
+
+		var paths []string
+		for _, d := range diffs {
+			paths = append(paths, d.Path)
+		}
+
+		if !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("%v: expected differences at %v, got %v", test.want, test.paths, paths)
+		}
+	}
+
+	if _, err := Diff(func() {}, nil, nil); err == nil {
+		t.Errorf("expected error for a function")
+	}
+
+	if s := (Differences{}).String(); s != "no differences\n" {
+		t.Errorf("unexpected empty report %q", s)
+	}
+}
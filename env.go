@@ -5,6 +5,7 @@
 package jsonata
 
 import (
+	"context"
 	"errors"
 	"math"
 	"reflect"
@@ -19,13 +20,232 @@ import (
 type environment struct {
 	parent  *environment
 	symbols map[string]reflect.Value
+	state   *evalState
+}
+
+// An evalState holds data shared by all of the environments
+// created during a single evaluation. It is inherited from the
+// parent environment when a new environment is created.
+type evalState struct {
+	kernels    map[jparse.Node]filterKernel
+	accessors  map[*jparse.PathNode]*pathAccessor
+	parallel   *parallelPlan
+	memo       *memoCache
+	context    context.Context
+	equal      jlib.EqualFunc
+	order      jlib.KeyOrder
+	collate    jlib.CompareFunc
+	converters valueConverters
+	shared     *sharedCache
+	resolver   Resolver
+
+	// operators holds the expression's custom operators (see
+	// RegisterOperator).
+	operators map[string]*customOperator
+
+	// missingFuncs is called for calls to functions that
+	// aren't defined (see WithMissingFunctions).
+	missingFuncs func(Warning)
+
+	// observer is told about function calls (see
+	// WithObserver).
+	observer EvalObserver
+
+	// ranges holds the source ranges of the expression's
+	// nodes, if they're known. errNode is the innermost node
+	// with a source range that returned the current error.
+	ranges  map[jparse.Node]jparse.Range
+	errNode jparse.Node
+
+	// coverage is set when the evaluation is recorded by a
+	// Coverage.
+	coverage *coverageRecorder
+
+	// trace is set when the evaluation is recorded by
+	// Explain.
+	trace *traceRecorder
+
+	// profile is set when the evaluation is recorded by a
+	// Profile (see WithProfile).
+	profile *profileRecorder
+
+	// debug is set when the evaluation is controlled by a
+	// Debugger.
+	debug *debugSession
+
+	// stats is set when the caller has asked for the
+	// evaluation's statistics (see WithEvalStats).
+	stats *statsRecorder
+
+	// limits is set by WithSizeLimits.
+	limits SizeLimits
+
+	// goContext is set in the environments created by
+	// newBaseEnv. It's shared with the Go callables that
+	// take a context.Context.
+	goContext *evalContextRef
+
+	// depth is the number of calls to eval in progress (see
+	// maxEvalDepth).
+	depth int
+
+	// cycles finds cycles in the Go values that are read
+	// recursively during the evaluation.
+	cycles cycleChecker
 }
 
 func newEnvironment(parent *environment, size int) *environment {
+
+	var state *evalState
+	if parent != nil {
+		state = parent.state
+	}
+
 	return &environment{
 		parent:  parent,
 		symbols: make(map[string]reflect.Value, size),
+		state:   state,
+	}
+}
+
+// ctx returns the context for the current evaluation.
+func (s *environment) ctx() context.Context {
+	if s == nil {
+		return context.Background()
+	}
+	return s.state.ctx()
+}
+
+func (s *evalState) ctx() context.Context {
+	if s == nil || s.context == nil {
+		return context.Background()
+	}
+	return s.context
+}
+
+// goContext returns the holder for the context passed to Go
+// callables, or nil if there isn't one.
+func (s *environment) goContext() *evalContextRef {
+	if s == nil || s.state == nil {
+		return nil
+	}
+	return s.state.goContext
+}
+
+// cloneGoCallable clones a Go callable for use in this
+// environment. Callables that take a context.Context are given
+// the environment's context holder.
+func (s *environment) cloneGoCallable(gc *goCallable) *goCallable {
+	cc := gc.clone()
+	if cc.takesContext {
+		cc.evalCtx = s.goContext()
 	}
+	return cc
+}
+
+// operator returns the Go function of a custom operator, or
+// nil if the operator isn't defined.
+func (s *environment) operator(symbol string) *goCallable {
+
+	if s == nil || s.state == nil {
+		return nil
+	}
+
+	op := s.state.operators[symbol]
+	if op == nil {
+		return nil
+	}
+
+	// Operators don't use the evaluation context, so only
+	// those that take a context.Context need a clone.
+	if op.callable.takesContext {
+		return s.cloneGoCallable(op.callable)
+	}
+	return op.callable
+}
+
+// equal returns the custom equality function for the current
+// evaluation, or nil if there isn't one (see WithEqual).
+func (s *environment) equal() jlib.EqualFunc {
+	if s == nil || s.state == nil {
+		return nil
+	}
+	return s.state.equal
+}
+
+// keyOrder returns the order in which map keys are visited in
+// the current evaluation (see WithSortedMapKeys).
+func (s *environment) keyOrder() jlib.KeyOrder {
+	if s == nil || s.state == nil {
+		return jlib.UnorderedKeys
+	}
+	return s.state.order
+}
+
+// collation returns the custom string ordering for the current
+// evaluation, or nil if there isn't one (see WithCollation).
+func (s *environment) collation() jlib.CompareFunc {
+	if s == nil || s.state == nil {
+		return nil
+	}
+	return s.state.collate
+}
+
+// convert converts a value read from the input or from a
+// variable (see Compiler.RegisterValueConverter).
+func (s *environment) convert(v reflect.Value) reflect.Value {
+	if s == nil || s.state == nil {
+		return jtypes.ConvertTime(v)
+	}
+	return s.state.converters.convert(v)
+}
+
+// cycles returns the cycleChecker for the current evaluation.
+func (s *environment) cycles() *cycleChecker {
+	if s == nil || s.state == nil {
+		return &cycleChecker{}
+	}
+	return &s.state.cycles
+}
+
+// recordError records that node returned err, so that the
+// error can be located in the expression (see locateError),
+// and returns err. Only the innermost node is recorded.
+func (s *environment) recordError(node jparse.Node, err error) error {
+	if err == nil || s == nil || s.state == nil || s.state.ranges == nil || s.state.errNode != nil {
+		return err
+	}
+	if _, ok := s.state.ranges[node]; ok {
+		s.state.errNode = node
+	}
+	return err
+}
+
+// clearError forgets the node recorded by recordError after a
+// subsequent node is evaluated successfully, i.e. after the
+// error was handled.
+func (s *environment) clearError() {
+	if s != nil && s.state != nil && s.state.errNode != nil {
+		s.state.errNode = nil
+	}
+}
+
+// pathAccessor returns the compiled accessor for the given path,
+// or nil if there isn't one.
+func (s *environment) pathAccessor(path *jparse.PathNode) *pathAccessor {
+	if s == nil || s.state == nil {
+		return nil
+	}
+	return s.state.accessors[path]
+}
+
+// filterKernel returns the specialised implementation of the
+// given predicate filter, or nil if there isn't one.
+func (s *environment) filterKernel(filter jparse.Node) filterKernel {
+	if s == nil || s.state == nil {
+		return nil
+	}
+	return s.state.kernels[filter]
 }
 
 func (s *environment) bind(name string, value reflect.Value) {
@@ -165,7 +385,7 @@ var baseEnv = initBaseEnv(map[string]Extension{
 		EvalContextHandler: defaultContextHandler,
 	},
 	"decodeUrlComponent": {
-		Func:               jlib.DecodeURL,
+		Func:               jlib.DecodeURLComponent,
 		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: defaultContextHandler,
 	},
@@ -179,6 +399,16 @@ var baseEnv = initBaseEnv(map[string]Extension{
 		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: defaultContextHandler,
 	},
+	"parseCsv": {
+		Func:               jlib.ParseCsv,
+		UndefinedHandler:   defaultUndefinedHandler,
+		EvalContextHandler: defaultContextHandler,
+	},
+	"toCsv": {
+		Func:               jlib.ToCsv,
+		UndefinedHandler:   defaultUndefinedHandler,
+		EvalContextHandler: nil,
+	},
 
 	// Number functions
 
@@ -245,6 +475,11 @@ var baseEnv = initBaseEnv(map[string]Extension{
 		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: nil,
 	},
+	"weightedAverage": {
+		Func:               jlib.WeightedAverage,
+		UndefinedHandler:   undefinedHandlerWeightedAverage,
+		EvalContextHandler: nil,
+	},
 
 	// Boolean functions
 
@@ -268,7 +503,7 @@ var baseEnv = initBaseEnv(map[string]Extension{
 
 	"distinct": {
 		Func:               jlib.Distinct,
-		UndefinedHandler:   nil,
+		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: nil,
 	},
 	"count": {
@@ -321,6 +556,16 @@ var baseEnv = initBaseEnv(map[string]Extension{
 		UndefinedHandler:   defaultUndefinedHandler,
 		EvalContextHandler: nil,
 	},
+	"countIf": {
+		Func:               jlib.CountIf,
+		UndefinedHandler:   nil,
+		EvalContextHandler: nil,
+	},
+	"sumIf": {
+		Func:               jlib.SumIf,
+		UndefinedHandler:   defaultUndefinedHandler,
+		EvalContextHandler: nil,
+	},
 
 	// Object functions
 
@@ -396,6 +641,21 @@ func initBaseEnv(exts map[string]Extension) *environment {
 		env.bind(name, reflect.ValueOf(fn))
 	}
 
+	// $map calls its function argument for every item before
+	// waiting for any asynchronous results.
+	if fn, ok := env.symbols["map"].Interface().(*goCallable); ok {
+		fn.fansOut = true
+	}
+
+	// $map and $filter can call their function argument for
+	// the items of a large array in parallel (see
+	// WithParallelism).
+	for _, name := range []string{"map", "filter"} {
+		if fn, ok := env.symbols[name].Interface().(*goCallable); ok {
+			fn.parallelCalls = true
+		}
+	}
+
 	return env
 }
 
@@ -414,6 +674,9 @@ func mustGoCallable(name string, ext Extension) *goCallable {
 func lookup(v reflect.Value, name string) (interface{}, error) {
 
 	res, err := evalName(&jparse.NameNode{Value: name}, v, nil)
+	if err == nil {
+		res, err = readLazy(res, nil)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -439,6 +702,10 @@ func undefinedHandlerAppend(argv []reflect.Value) bool {
 	return len(argv) == 2 && argv[0] == undefined && argv[1] == undefined
 }
 
+func undefinedHandlerWeightedAverage(argv []reflect.Value) bool {
+	return len(argv) == 2 && (argv[0] == undefined || argv[1] == undefined)
+}
+
 // Context handlers
 
 func contextHandlerSubstring(argv []reflect.Value) bool {
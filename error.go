@@ -5,10 +5,15 @@
 package jsonata
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/iwongu/jsonata-go/jparse"
 	"github.com/iwongu/jsonata-go/jtypes"
 )
 
@@ -47,6 +52,20 @@ const (
 	ErrIllegalDelete
 	ErrNonSortable
 	ErrSortMismatch
+
+	// ErrWrapped means that the error is described by the
+	// EvalError's Err field, e.g. an *ArgCountError.
+	ErrWrapped
+
+	// ErrStackOverflow means that the evaluation nested too
+	// deeply, usually because a function calls itself without
+	// end.
+	ErrStackOverflow
+
+	// ErrResultTooLarge means that an array, object or string
+	// built by the expression is larger than the limit set by
+	// WithSizeLimits.
+	ErrResultTooLarge
 )
 
 var errmsgs = map[ErrType]string{
@@ -70,16 +89,95 @@ var errmsgs = map[ErrType]string{
 	ErrIllegalDelete:      `the delete clause of an object transformation must evaluate to an array of strings`,
 	ErrNonSortable:        `expressions in a sort term must evaluate to strings or numbers`,
 	ErrSortMismatch:       `expressions in a sort term must have the same type`,
+	ErrStackOverflow:      `stack overflow error: check for a non-terminating recursive function`,
+	ErrResultTooLarge:     `result of {{token}} is larger than the limit of {{value}}`,
+}
+
+// evalErrCodes maps error types to the equivalent JSONata
+// error codes.
+var evalErrCodes = map[ErrType]string{
+	ErrNonIntegerLHS:      "T2003",
+	ErrNonIntegerRHS:      "T2004",
+	ErrNonNumberLHS:       "T2001",
+	ErrNonNumberRHS:       "T2002",
+	ErrNonComparableLHS:   "T2010",
+	ErrNonComparableRHS:   "T2010",
+	ErrTypeMismatch:       "T2009",
+	ErrNonCallable:        "T1006",
+	ErrNonCallableApply:   "T2006",
+	ErrNonCallablePartial: "T1008",
+	ErrNumberInf:          "D1001",
+	ErrNumberNaN:          "D1001",
+	ErrMaxRangeItems:      "D2014",
+	ErrIllegalKey:         "T1003",
+	ErrDuplicateKey:       "D1009",
+	ErrClone:              "T2013",
+	ErrIllegalUpdate:      "T2011",
+	ErrIllegalDelete:      "T2012",
+	ErrNonSortable:        "T2008",
+	ErrSortMismatch:       "T2007",
+	ErrStackOverflow:      "U1001",
+}
+
+// parseErrCodes maps parser error types to the equivalent
+// JSONata error codes.
+var parseErrCodes = map[jparse.ErrType]string{
+	jparse.ErrSyntaxError:        "S0201",
+	jparse.ErrUnexpectedEOF:      "S0207",
+	jparse.ErrUnexpectedToken:    "S0202",
+	jparse.ErrMissingToken:       "S0203",
+	jparse.ErrPrefix:             "S0211",
+	jparse.ErrInfix:              "S0204",
+	jparse.ErrUnterminatedString: "S0101",
+	jparse.ErrUnterminatedRegex:  "S0302",
+	jparse.ErrUnterminatedName:   "S0105",
+	jparse.ErrIllegalEscape:      "S0103",
+	jparse.ErrIllegalEscapeHex:   "S0104",
+	jparse.ErrInvalidNumber:      "S0201",
+	jparse.ErrNumberRange:        "S0102",
+	jparse.ErrEmptyRegex:         "S0301",
+	jparse.ErrGroupPredicate:     "S0209",
+	jparse.ErrGroupGroup:         "S0210",
+	jparse.ErrPathLiteral:        "S0213",
+	jparse.ErrIllegalAssignment:  "S0212",
+	jparse.ErrIllegalParam:       "S0208",
+	jparse.ErrInvalidUnionType:   "S0402",
+	jparse.ErrInvalidSubtype:     "S0401",
 }
 
 var reErrMsg = regexp.MustCompile("{{(token|value)}}")
 
 // An EvalError represents an error during evaluation of a
 // JSONata expression.
+//
+// The fields after Value are set for errors returned by the
+// expressions that a Compiler compiles. Errors other than
+// operator errors, such as an *ArgCountError or an
+// *ExtensionError, are wrapped in an EvalError with the type
+// ErrWrapped, and can be retrieved with errors.As.
 type EvalError struct {
 	Type  ErrType
 	Token string
 	Value string
+
+	// Code is the JSONata error code, e.g. "T2001", or an
+	// empty string if JSONata doesn't have an equivalent.
+	Code string
+
+	// Position is the byte offset in the expression of the
+	// subexpression that failed, or -1 if it isn't known.
+	// Line and Column are the 1-based line and column of the
+	// same location, with the column counted in characters.
+	Position int
+	Line     int
+	Column   int
+
+	// Err is the error that caused an ErrWrapped error.
+	Err error
+
+	// EvalID is the ID of the evaluation that failed, if it
+	// has one (see WithEvalID).
+	EvalID string
 }
 
 func newEvalError(typ ErrType, token interface{}, value interface{}) *EvalError {
@@ -104,6 +202,10 @@ func newEvalError(typ ErrType, token interface{}, value interface{}) *EvalError
 
 func (e EvalError) Error() string {
 
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+
 	s := errmsgs[e.Type]
 	if s == "" {
 		return fmt.Sprintf("EvalError: unknown error type %d", e.Type)
@@ -121,6 +223,164 @@ func (e EvalError) Error() string {
 	})
 }
 
+// Unwrap returns the error that caused an ErrWrapped error.
+func (e EvalError) Unwrap() error {
+	return e.Err
+}
+
+// locateError returns an *EvalError for an error returned by
+// the evaluator. The error's location is taken from the node
+// that failed, which is nil if it isn't known. ErrUndefined and
+// context errors are returned unchanged.
+func locateError(err error, node jparse.Node, src string, ranges map[jparse.Node]jparse.Range) error {
+
+	if err == ErrUndefined || err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+
+	var e EvalError
+	switch err := err.(type) {
+	case *EvalError:
+		e = *err
+		e.Code = evalErrCodes[e.Type]
+	case *ArgCountError, *ArgTypeError:
+		e = EvalError{Type: ErrWrapped, Code: "T0410", Err: err}
+	default:
+		e = EvalError{Type: ErrWrapped, Err: err}
+	}
+
+	e.Position = -1
+	if r, ok := ranges[node]; ok {
+		e.Position = r.Start
+		e.Line, e.Column = lineColumn(src, r.Start)
+		if e.Token == "" {
+			e.Token = src[r.Start:r.End]
+		}
+	}
+
+	return &e
+}
+
+// A CompileError is returned by Compiler.Compile when an
+// expression isn't valid. Err is the underlying error, usually
+// a *jparse.Error. If the location of the error is known, the
+// error message shows the line of the expression that contains
+// it with a caret under the error, e.g.
+//
+//	unexpected end of expression at line 1, column 8
+//	orders[
+//	       ^
+type CompileError struct {
+	// Code is the JSONata error code, e.g. "S0201", or an
+	// empty string if JSONata doesn't have an equivalent.
+	Code string
+
+	// Token is the text at the location of the error.
+	Token string
+
+	// Position is the byte offset of the error in the
+	// expression, or -1 if it isn't known. Line and Column
+	// are the 1-based line and column of the same location,
+	// with the column counted in characters.
+	Position int
+	Line     int
+	Column   int
+
+	// SourceLine is the line of the expression that contains
+	// the error, without its line terminator.
+	SourceLine string
+
+	Err error
+}
+
+func newCompileError(err error, src string) *CompileError {
+
+	e := &CompileError{
+		Position: -1,
+		Err:      err,
+	}
+
+	if perr, ok := err.(*jparse.Error); ok {
+		e.Code = parseErrCodes[perr.Type]
+		e.Token = perr.Token
+		if perr.Position >= 0 && perr.Position <= len(src) {
+			e.Position = perr.Position
+			e.Line, e.Column = lineColumn(src, perr.Position)
+			e.SourceLine = sourceLine(src, perr.Position)
+		}
+	}
+
+	return e
+}
+
+func (e CompileError) Error() string {
+
+	if e.Position < 0 {
+		return e.Err.Error()
+	}
+
+	// Tabs in the source line are copied so that the caret
+	// lines up however wide they're displayed.
+	var caret strings.Builder
+	for i, r := range []rune(e.SourceLine) {
+		if i >= e.Column-1 {
+			break
+		}
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+
+	return fmt.Sprintf("%s at line %d, column %d\n%s\n%s", e.Err, e.Line, e.Column, e.SourceLine, caret.String())
+}
+
+// Unwrap returns the underlying error.
+func (e CompileError) Unwrap() error {
+	return e.Err
+}
+
+// CompileErrors is the error returned by Compiler.CompileAll
+// if an expression has one or more errors, sorted by position.
+type CompileErrors []*CompileError
+
+func (errs CompileErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// lineColumn returns the 1-based line and column of a byte
+// offset in src.
+func lineColumn(src string, pos int) (line, column int) {
+
+	before := src[:pos]
+	line = 1 + strings.Count(before, "\n")
+	if i := strings.LastIndexByte(before, '\n'); i >= 0 {
+		before = before[i+1:]
+	}
+
+	return line, 1 + utf8.RuneCountInString(before)
+}
+
+// sourceLine returns the line of src that contains the byte
+// offset pos, without its line terminator.
+func sourceLine(src string, pos int) string {
+
+	start := strings.LastIndexByte(src[:pos], '\n') + 1
+
+	end := len(src)
+	if i := strings.IndexByte(src[pos:], '\n'); i >= 0 {
+		end = pos + i
+	}
+
+	return strings.TrimSuffix(src[start:end], "\r")
+}
+
 // ArgCountError is returned by the evaluation methods when an
 // expression contains a function call with the wrong number of
 // arguments.
@@ -160,3 +420,40 @@ func newArgTypeError(f jtypes.Callable, which int) *ArgTypeError {
 func (e ArgTypeError) Error() string {
 	return fmt.Sprintf("argument %d of function %q does not match function signature", e.Which, e.Func)
 }
+
+// An ExtensionError is returned by the evaluation methods when
+// an extension function (see Extension) returns a non-nil error.
+// Position is the offset of the call's opening parenthesis in
+// the expression, or -1 if the function was not called directly,
+// e.g. if it was passed to $map.
+type ExtensionError struct {
+	Func     string
+	Position int
+	Err      error
+}
+
+func (e ExtensionError) Error() string {
+	if e.Position < 0 {
+		return fmt.Sprintf("function %q failed: %s", e.Func, e.Err)
+	}
+	return fmt.Sprintf("function %q failed at position %d: %s", e.Func, e.Position, e.Err)
+}
+
+// Unwrap returns the error returned by the extension function.
+func (e ExtensionError) Unwrap() error {
+	return e.Err
+}
+
+// A CycleError is returned when a Go value in the input or in a
+// result contains itself, e.g. a map with a value that is the
+// map itself or a struct with a pointer to itself, and reading
+// it would go round the cycle forever. This happens in paths
+// through nested arrays, the wildcard operators and Normalize.
+// Type is the type of the value that contains itself.
+type CycleError struct {
+	Type reflect.Type
+}
+
+func (e CycleError) Error() string {
+	return fmt.Sprintf("the value of type %s contains itself", e.Type)
+}
@@ -19,10 +19,50 @@ var undefined reflect.Value
 
 var typeInterfaceSlice = reflect.SliceOf(jtypes.TypeInterface)
 
+// maxEvalDepth is the maximum number of nested calls to eval.
+// Deeper evaluations, such as a function that calls itself
+// without end, fail with ErrStackOverflow instead of exhausting
+// the Go stack, which would crash the program.
+const maxEvalDepth = 50000
+
 func eval(node jparse.Node, input reflect.Value, env *environment) (reflect.Value, error) {
+	if env.tracing() {
+		if d := env.state.debug; d != nil {
+			return d.eval(node, input, env)
+		}
+		return env.state.trace.eval(node, input, env)
+	}
+	if env.profiling() {
+		return env.state.profile.eval(node, input, env)
+	}
+	return evalNode(node, input, env)
+}
+
+// evalNode is eval without tracing or profiling (see Explain,
+// Debug and WithProfile).
+func evalNode(node jparse.Node, input reflect.Value, env *environment) (reflect.Value, error) {
 	var err error
 	var v reflect.Value
 
+	if err := env.enter(node); err != nil {
+		return undefined, err
+	}
+	defer env.leave()
+
+	key, cache := env.sharedNode(node)
+	if cache != nil {
+		if v, ok := cache.lookup(key); ok {
+			return v, nil
+		}
+	}
+
+	memoKey, memo := env.memoNode(node, input)
+	if memo != nil {
+		if v, ok := memo.lookup(memoKey); ok {
+			return v, nil
+		}
+	}
+
 	switch node := node.(type) {
 	case *jparse.StringNode:
 		v, err = evalString(node, input, env)
@@ -38,6 +78,9 @@ func eval(node jparse.Node, input reflect.Value, env *environment) (reflect.Valu
 		v, err = evalVariable(node, input, env)
 	case *jparse.NameNode:
 		v, err = evalName(node, input, env)
+		if err == nil {
+			v, err = readLazy(v, env)
+		}
 	case *jparse.PathNode:
 		v, err = evalPath(node, input, env)
 	case *jparse.NegationNode:
@@ -84,21 +127,71 @@ func eval(node jparse.Node, input reflect.Value, env *environment) (reflect.Valu
 		v, err = evalBooleanOperator(node, input, env)
 	case *jparse.StringConcatenationNode:
 		v, err = evalStringConcatenation(node, input, env)
+	case *jparse.CustomOperatorNode:
+		v, err = evalCustomOperator(node, input, env)
 	default:
 		panicf("eval: unexpected node type %T", node)
 	}
 
 	if err != nil {
-		return undefined, err
+		return undefined, env.recordError(node, err)
 	}
+	env.clearError()
 
 	if seq, ok := asSequence(v); ok {
 		v = seq.Value()
 	}
 
+	if cache != nil {
+		cache.store(key, v)
+	}
+	if memo != nil {
+		memo.store(memoKey, input, v)
+	}
+
 	return v, nil
 }
 
+// enter records the start of a node's evaluation. It enforces
+// maxEvalDepth and updates the evaluation's statistics and
+// coverage. Every call to enter that returns a nil error must
+// be followed by a call to leave.
+func (s *environment) enter(node jparse.Node) error {
+	if s != nil && s.state != nil {
+		state := s.state
+		if state.depth >= maxEvalDepth {
+			return s.recordError(node, newEvalError(ErrStackOverflow, nil, nil))
+		}
+		state.depth++
+		if state.stats != nil {
+			state.stats.node(state.depth)
+		}
+	}
+
+	s.cover(node)
+	return nil
+}
+
+// leave records the end of a node's evaluation.
+func (s *environment) leave() {
+	if s != nil && s.state != nil {
+		s.state.depth--
+	}
+}
+
+// direct returns true if nodes can be evaluated without
+// calling eval, i.e. if the evaluation isn't traced, debugged
+// or profiled and doesn't use a memo or shared cache. Nodes
+// evaluated directly must still call enter and leave.
+func (s *environment) direct() bool {
+	if s == nil || s.state == nil {
+		return true
+	}
+	state := s.state
+	return state.trace == nil && state.debug == nil && state.profile == nil &&
+		state.memo == nil && state.shared == nil
+}
+
 func evalString(node *jparse.StringNode, data reflect.Value, env *environment) (reflect.Value, error) {
 	return reflect.ValueOf(node.Value), nil
 }
@@ -125,36 +218,51 @@ func evalVariable(node *jparse.VariableNode, data reflect.Value, env *environmen
 	if node.Name == "" {
 		return data, nil
 	}
-	return env.lookup(node.Name), nil
+	return readLazy(env.convert(env.lookup(node.Name)), env)
 }
 
 func evalName(node *jparse.NameNode, data reflect.Value, env *environment) (reflect.Value, error) {
-	var err error
 	var v reflect.Value
 
 	data = jtypes.Resolve(data)
 
 	switch {
 	case jtypes.IsStruct(data):
-		v = data.FieldByName(node.Value)
+		v = env.convert(jtypes.StructField(data, node.Value))
 	case jtypes.IsMap(data):
-		v = data.MapIndex(reflect.ValueOf(node.Value))
+		v = env.convert(data.MapIndex(reflect.ValueOf(node.Value)))
 	case jtypes.IsArray(data):
-		v, err = evalNameArray(node, data, env)
+		return evalNameArray(node, data, env)
+	case jtypes.IsString(data), jtypes.IsNumber(data), jtypes.IsBool(data):
 	default:
 		return undefined, nil
 	}
 
-	return v, err
+	if !v.IsValid() {
+		// The field isn't in the input. Ask the Resolver,
+		// if there is one (see WithResolver).
+		return env.resolve(data, node.Value)
+	}
+
+	return v, nil
 }
 
 func evalNameArray(node *jparse.NameNode, data reflect.Value, env *environment) (reflect.Value, error) {
+	cycles := env.cycles()
+	if err := cycles.enter(data); err != nil {
+		return undefined, err
+	}
+	defer cycles.leave(data)
+
 	n := data.Len()
 	results := newSequence(n)
 
 	for i := 0; i < n; i++ {
 
 		v, err := evalName(node, data.Index(i), env)
+		if err == nil {
+			v, err = readLazy(v, env)
+		}
 		if err != nil {
 			return undefined, err
 		}
@@ -172,6 +280,12 @@ func evalPath(node *jparse.PathNode, data reflect.Value, env *environment) (refl
 		return undefined, nil
 	}
 
+	if a := env.pathAccessor(node); a != nil {
+		if v, ok := a.eval(data, env); ok {
+			return v, nil
+		}
+	}
+
 	var isVar bool
 	switch step0 := node.Steps[0].(type) {
 	case (*jparse.VariableNode):
@@ -180,6 +294,8 @@ func evalPath(node *jparse.PathNode, data reflect.Value, env *environment) (refl
 		_, isVar = step0.Expr.(*jparse.VariableNode)
 	}
 
+	steps := node.Steps
+
 	output := data
 	if isVar || !jtypes.IsArray(data) {
 		output = reflect.MakeSlice(typeInterfaceSlice, 1, 1)
@@ -188,22 +304,67 @@ func evalPath(node *jparse.PathNode, data reflect.Value, env *environment) (refl
 		}
 	}
 
+	// If the leading steps are shared with other expressions
+	// in a Bundle, start after the longest prefix that has
+	// already been evaluated.
+	start := 0
+	keys, cache := env.sharedPrefixes(node)
+	for i := len(keys) - 1; i >= 0; i-- {
+		if keys[i] == "" {
+			continue
+		}
+		if v, ok := cache.lookup(keys[i]); ok {
+			if v == undefined {
+				return undefined, nil
+			}
+			output, start = v, i+1
+			break
+		}
+	}
+
 	var err error
-	lastIndex := len(node.Steps) - 1
-	for i, step := range node.Steps {
+	lastIndex := len(steps) - 1
+	for i := start; i <= lastIndex; i++ {
 
+		step := steps[i]
 		if step0, ok := step.(*jparse.ArrayNode); ok && i == 0 {
-			output, err = eval(step0, output, env)
+			// If the first step is a range, as in [1..n].($ * 2),
+			// the next step is applied to its numbers as they're
+			// generated.
+			var lazy LazyArray
+			var isRange bool
+			if lastIndex > 0 {
+				lazy, isRange, err = evalRangeLazy(step0, output, env)
+			}
+			switch {
+			case !isRange:
+				output, err = eval(step0, output, env)
+			case err == nil:
+				output, err = evalLazyStep(lazy, steps[1], env, lastIndex == 1)
+				i++
+			}
+		} else if name, ok := step.(*jparse.NameNode); ok && i < lastIndex && !env.tracing() {
+			// If the name refers to a LazyArray, the next step
+			// is applied to its items as they're read.
+			var lazy bool
+			output, lazy, err = evalNameStep(name, steps[i+1], output, env, i+1 == lastIndex)
+			if lazy {
+				i++
+			}
 		} else {
 			output, err = evalPathStep(step, output, env, i == lastIndex)
 		}
 
-		if err != nil || output == undefined {
-			return undefined, err
+		if err == nil && jtypes.IsArray(output) && jtypes.Resolve(output).Len() == 0 {
+			output = undefined
 		}
 
-		if jtypes.IsArray(output) && jtypes.Resolve(output).Len() == 0 {
-			return undefined, nil
+		if err == nil && i < len(keys) && keys[i] != "" {
+			cache.store(keys[i], output)
+		}
+
+		if err != nil || output == undefined {
+			return undefined, err
 		}
 	}
 
@@ -231,12 +392,62 @@ func evalPathStep(step jparse.Node, data reflect.Value, env *environment, lastSt
 		return undefined, err
 	}
 
+	return pathStepResult(step, results, lastStep, env)
+}
+
+// evalNameStep evaluates a path step that is a name. If the
+// input is a single value whose named field is a LazyArray, the
+// following step is applied to the array's items as they're read
+// and lazy is true.
+func evalNameStep(step *jparse.NameNode, next jparse.Node, data reflect.Value, env *environment, nextIsLast bool) (output reflect.Value, lazy bool, err error) {
+
+	var item reflect.Value
+	if seq, ok := asSequence(data); ok {
+		if len(seq.values) != 1 {
+			v, err := evalPathStep(step, data, env, false)
+			return v, false, err
+		}
+		item = reflect.ValueOf(seq.values[0])
+	} else {
+		if data.Len() != 1 {
+			v, err := evalPathStep(step, data, env, false)
+			return v, false, err
+		}
+		item = data.Index(0)
+	}
+
+	v, array, err := evalNameLazy(step, item, env)
+	if err != nil {
+		return undefined, false, err
+	}
+
+	if array != nil {
+		v, err := evalLazyStep(array, next, env, nextIsLast)
+		return v, true, err
+	}
+
+	var results []reflect.Value
+	if v.IsValid() {
+		results = []reflect.Value{v}
+	}
+
+	v, err = pathStepResult(step, results, false, env)
+	return v, false, err
+}
+
+// pathStepResult combines the results of applying a path step
+// to each of its input values. It returns an error if joining
+// the arrays among the results makes more items than the
+// evaluation's SizeLimits allow.
+func pathStepResult(step jparse.Node, results []reflect.Value, lastStep bool, env *environment) (reflect.Value, error) {
+
 	if lastStep && len(results) == 1 && jtypes.IsArray(results[0]) {
 		return results[0], nil
 	}
 
 	_, isCons := step.(*jparse.ArrayNode)
 	resultSequence := newSequence(len(results))
+	arrays := 0
 
 	for _, v := range results {
 
@@ -248,6 +459,11 @@ func evalPathStep(step jparse.Node, data reflect.Value, env *environment, lastSt
 		}
 
 		v = arrayify(v)
+		if arrays++; arrays > 1 {
+			if err := env.checkItems(resultSequence.Len()+v.Len(), "."); err != nil {
+				return undefined, err
+			}
+		}
 		for i, N := 0, v.Len(); i < N; i++ {
 			if vi := v.Index(i); vi.IsValid() && vi.CanInterface() {
 				resultSequence.Append(vi.Interface())
@@ -263,39 +479,52 @@ func evalPathStep(step jparse.Node, data reflect.Value, env *environment, lastSt
 }
 
 func evalOverArray(node jparse.Node, data reflect.Value, env *environment) ([]reflect.Value, error) {
-	var results []reflect.Value
+	return evalOverItems(node, data.Len(), data.Index, env)
+}
 
-	for i, N := 0, data.Len(); i < N; i++ {
+func evalOverSequence(node jparse.Node, seq *sequence, env *environment) ([]reflect.Value, error) {
+	item := func(i int) reflect.Value {
+		return reflect.ValueOf(seq.values[i])
+	}
+	return evalOverItems(node, len(seq.values), item, env)
+}
 
-		res, err := eval(node, data.Index(i), env)
-		if err != nil {
-			return nil, err
-		}
+// evalOverItems evaluates a path step for each of n items. If
+// the step can be evaluated in parallel (see WithParallelism),
+// the items are split between goroutines.
+func evalOverItems(node jparse.Node, n int, item func(int) reflect.Value, env *environment) ([]reflect.Value, error) {
 
-		if res.IsValid() {
-			if results == nil {
-				results = make([]reflect.Value, 0, N)
-			}
-			results = append(results, res)
-		}
+	results, ok, err := evalParallel(node, n, env, func(lo, hi int, env *environment) ([]reflect.Value, error) {
+		return evalOverRange(node, lo, hi, item, env)
+	})
+	if ok {
+		return results, err
 	}
 
-	return results, nil
+	return evalOverRange(node, 0, n, item, env)
 }
 
-func evalOverSequence(node jparse.Node, seq *sequence, env *environment) ([]reflect.Value, error) {
+// evalOverRange evaluates a path step for the items [lo, hi).
+func evalOverRange(node jparse.Node, lo, hi int, item func(int) reflect.Value, env *environment) ([]reflect.Value, error) {
+	if call, ok := node.(*jparse.FunctionCallNode); ok && !env.tracing() {
+		offset := func(i int) reflect.Value {
+			return item(lo + i)
+		}
+		return callOverItems(call, hi-lo, offset, env)
+	}
+
 	var results []reflect.Value
 
-	for i, N := 0, len(seq.values); i < N; i++ {
+	for i := lo; i < hi; i++ {
 
-		res, err := eval(node, reflect.ValueOf(seq.values[i]), env)
+		res, err := eval(node, item(i), env)
 		if err != nil {
 			return nil, err
 		}
 
 		if res.IsValid() {
 			if results == nil {
-				results = make([]reflect.Value, 0, N)
+				results = make([]reflect.Value, 0, hi-lo)
 			}
 			results = append(results, res)
 		}
@@ -329,6 +558,25 @@ func isInteger(x float64) bool {
 }
 
 func evalRange(node *jparse.RangeNode, data reflect.Value, env *environment) (reflect.Value, error) {
+	lhs, size, err := evalRangeBounds(node, data, env)
+	if err != nil || size == 0 {
+		return undefined, err
+	}
+
+	results := reflect.MakeSlice(typeInterfaceSlice, size, size)
+
+	for i := 0; i < size; i++ {
+		results.Index(i).Set(reflect.ValueOf(lhs))
+		lhs++
+	}
+
+	return results, nil
+}
+
+// evalRangeBounds returns the first number of a range and the
+// number of items in it. The size is zero if the range is
+// undefined.
+func evalRangeBounds(node *jparse.RangeNode, data reflect.Value, env *environment) (float64, int, error) {
 	evaluate := func(node jparse.Node) (float64, bool, bool, error) {
 
 		v, err := eval(node, data, env)
@@ -343,44 +591,43 @@ func evalRange(node *jparse.RangeNode, data reflect.Value, env *environment) (re
 	// Evaluate both sides and return any errors.
 	lhs, lhsOK, lhsInteger, err := evaluate(node.LHS)
 	if err != nil {
-		return undefined, err
+		return 0, 0, err
 	}
 
 	rhs, rhsOK, rhsInteger, err := evaluate(node.RHS)
 	if err != nil {
-		return undefined, err
+		return 0, 0, err
 	}
 
 	// If either side is not an integer, return an error.
 	if lhsOK && !lhsInteger {
-		return undefined, newEvalError(ErrNonIntegerLHS, node.LHS, "..")
+		return 0, 0, newEvalError(ErrNonIntegerLHS, node.LHS, "..")
 	}
 
 	if rhsOK && !rhsInteger {
-		return undefined, newEvalError(ErrNonIntegerRHS, node.RHS, "..")
+		return 0, 0, newEvalError(ErrNonIntegerRHS, node.RHS, "..")
 	}
 
 	// If either side is undefined or the left side is greater
 	// than the right, return undefined.
 	if !lhsOK || !rhsOK || lhs > rhs {
-		return undefined, nil
+		return 0, 0, nil
 	}
 
 	size := int(rhs-lhs) + 1
+	if size >= 0 {
+		if err := env.checkItems(size, ".."); err != nil {
+			return 0, 0, err
+		}
+	}
+
 	// Check for integer overflow or an array size that exceeds
 	// our upper bound.
 	if size < 0 || size > maxRangeItems {
-		return undefined, newEvalError(ErrMaxRangeItems, "..", nil)
+		return 0, 0, newEvalError(ErrMaxRangeItems, "..", nil)
 	}
 
-	results := reflect.MakeSlice(typeInterfaceSlice, size, size)
-
-	for i := 0; i < size; i++ {
-		results.Index(i).Set(reflect.ValueOf(lhs))
-		lhs++
-	}
-
-	return results, nil
+	return lhs, size, nil
 }
 
 func evalArray(node *jparse.ArrayNode, data reflect.Value, env *environment) (reflect.Value, error) {
@@ -413,12 +660,19 @@ func evalArray(node *jparse.ArrayNode, data reflect.Value, env *environment) (re
 			}
 		default:
 			v = arrayify(v)
+			if err := env.checkItems(len(results)+v.Len(), "["); err != nil {
+				return undefined, err
+			}
 			for i, N := 0, v.Len(); i < N; i++ {
 				if vi := v.Index(i); vi.IsValid() && vi.CanInterface() {
 					results = append(results, vi.Interface())
 				}
 			}
 		}
+
+		if err := env.checkItems(len(results), "["); err != nil {
+			return undefined, err
+		}
 	}
 
 	return reflect.ValueOf(results), nil
@@ -432,6 +686,10 @@ func evalObject(node *jparse.ObjectNode, data reflect.Value, env *environment) (
 		return undefined, err
 	}
 
+	if err := env.checkItems(len(keys), "{"); err != nil {
+		return undefined, err
+	}
+
 	nItems := data.Len()
 	results := make(map[string]interface{}, len(keys))
 
@@ -473,6 +731,8 @@ func groupItemsByKey(obj *jparse.ObjectNode, items reflect.Value, env *environme
 
 		if s, ok := keyNode.(*jparse.StringNode); ok {
 
+			env.cover(keyNode)
+
 			key := s.Value
 			if _, ok := results[key]; ok {
 				return nil, newEvalError(ErrDuplicateKey, keyNode, key)
@@ -541,12 +801,14 @@ func evalBlock(node *jparse.BlockNode, data reflect.Value, env *environment) (re
 }
 
 func evalConditional(node *jparse.ConditionalNode, data reflect.Value, env *environment) (reflect.Value, error) {
-	v, err := eval(node.If, data, env)
+	b, err := evalCondition(node.If, data, env)
 	if err != nil {
 		return undefined, err
 	}
 
-	if jlib.Boolean(v) {
+	env.coverBranch(node, b)
+
+	if b {
 		return eval(node.Then, data, env)
 	}
 
@@ -570,17 +832,26 @@ func evalAssignment(node *jparse.AssignmentNode, data reflect.Value, env *enviro
 func evalWildcard(node *jparse.WildcardNode, data reflect.Value, env *environment) (reflect.Value, error) {
 	results := newSequence(0)
 
-	walkObjectValues(data, func(v reflect.Value) {
-		appendWildcard(results, v)
+	var err error
+	walkObjectValues(data, env, func(v reflect.Value) {
+		if err == nil {
+			err = appendWildcard(results, v, env)
+		}
 	})
+	if err != nil {
+		return undefined, err
+	}
 
 	return reflect.ValueOf(results), nil
 }
 
-func appendWildcard(seq *sequence, v reflect.Value) {
+func appendWildcard(seq *sequence, v reflect.Value, env *environment) error {
 	switch {
 	case jtypes.IsArray(v):
-		v = flattenArray(v)
+		v, err := flattenArray(v, env)
+		if err != nil {
+			return err
+		}
 		for i, N := 0, v.Len(); i < N; i++ {
 			if vi := v.Index(i); vi.IsValid() && vi.CanInterface() {
 				seq.Append(vi.Interface())
@@ -591,24 +862,37 @@ func appendWildcard(seq *sequence, v reflect.Value) {
 			seq.Append(v.Interface())
 		}
 	}
+	return nil
 }
 
 func evalDescendent(node *jparse.DescendentNode, data reflect.Value, env *environment) (reflect.Value, error) {
 	results := newSequence(0)
 
-	recurseDescendents(results, data)
+	if err := recurseDescendents(results, data, env); err != nil {
+		return undefined, err
+	}
 
 	return reflect.ValueOf(results), nil
 }
 
-func recurseDescendents(seq *sequence, v reflect.Value) {
+func recurseDescendents(seq *sequence, v reflect.Value, env *environment) error {
 	if v.IsValid() && v.CanInterface() && !jtypes.IsArray(v) {
 		seq.Append(v.Interface())
 	}
 
-	walkObjectValues(v, func(v reflect.Value) {
-		recurseDescendents(seq, v)
+	cycles := env.cycles()
+	if err := cycles.enter(v); err != nil {
+		return err
+	}
+	defer cycles.leave(v)
+
+	var err error
+	walkObjectValues(v, env, func(v reflect.Value) {
+		if err == nil {
+			err = recurseDescendents(seq, v, env)
+		}
 	})
+	return err
 }
 
 func evalGroup(node *jparse.GroupNode, data reflect.Value, env *environment) (reflect.Value, error) {
@@ -621,12 +905,41 @@ func evalGroup(node *jparse.GroupNode, data reflect.Value, env *environment) (re
 }
 
 func evalPredicate(node *jparse.PredicateNode, data reflect.Value, env *environment) (reflect.Value, error) {
-	items, err := eval(node.Expr, data, env)
+	filters := node.Filters
+
+	var items reflect.Value
+	var lazy LazyArray
+	var isRange bool
+	var err error
+
+	if name, ok := node.Expr.(*jparse.NameNode); ok && !env.tracing() {
+		items, lazy, err = evalNameLazy(name, data, env)
+	} else if lazy, isRange, err = evalRangeLazy(predicateBase(node), data, env); isRange {
+		// Filters on a range, as in [1..n][$ % 7 = 0][0], are
+		// applied to its numbers as they're generated.
+		filters = predicateFilters(node, env)
+	} else {
+		items, err = eval(node.Expr, data, env)
+	}
+
+	if err == nil && lazy != nil {
+		var n int
+		items, n, err = filterLazy(lazy, filters, env)
+		if n > 0 {
+			filters = filters[n:]
+			if items.Len() == 0 {
+				items = undefined
+			}
+		} else if err == nil {
+			items, err = readLazy(reflect.ValueOf(lazy), env)
+		}
+	}
+
 	if err != nil || items == undefined {
 		return undefined, err
 	}
 
-	for _, filter := range node.Filters {
+	for _, filter := range filters {
 
 		// TODO: If this filter is of type *jparse.NumberNode,
 		// we should access the indexed item directly instead
@@ -646,17 +959,74 @@ func evalPredicate(node *jparse.PredicateNode, data reflect.Value, env *environm
 	return normalizeArray(items), nil
 }
 
+// predicateBase returns the expression that a predicate, or a
+// series of nested predicates such as [1..10][$ > 2][0], filters.
+func predicateBase(node *jparse.PredicateNode) jparse.Node {
+	for {
+		inner, ok := node.Expr.(*jparse.PredicateNode)
+		if !ok {
+			return node.Expr
+		}
+		node = inner
+	}
+}
+
+// predicateFilters returns the filters of a series of nested
+// predicates in the order in which they're applied. The inner
+// predicates aren't evaluated, so they're recorded for coverage
+// here.
+func predicateFilters(node *jparse.PredicateNode, env *environment) []jparse.Node {
+
+	inner, ok := node.Expr.(*jparse.PredicateNode)
+	if !ok {
+		return node.Filters
+	}
+
+	env.cover(inner)
+
+	filters := predicateFilters(inner, env)
+	return append(filters[:len(filters):len(filters)], node.Filters...)
+}
+
 func applyFilter(filter jparse.Node, items reflect.Value, env *environment) (reflect.Value, error) {
+	if kernel := env.filterKernel(filter); kernel != nil {
+		v, err := applyFilterKernel(kernel, items, env)
+		return v, env.recordError(filter, err)
+	}
+
 	nItems := items.Len()
-	results := reflect.MakeSlice(typeInterfaceSlice, 0, 0)
 
-	for i := 0; i < nItems; i++ {
+	matches, ok, err := evalParallel(filter, nItems, env, func(lo, hi int, env *environment) ([]reflect.Value, error) {
+		return filterRange(filter, items, lo, hi, env)
+	})
+	if !ok {
+		matches, err = filterRange(filter, items, 0, nItems, env)
+	}
+	if err != nil {
+		return undefined, err
+	}
+
+	results := reflect.MakeSlice(typeInterfaceSlice, 0, len(matches))
+	for _, item := range matches {
+		results = reflect.Append(results, item)
+	}
+
+	return results, nil
+}
+
+// filterRange returns the items in [lo, hi) that match a filter.
+func filterRange(filter jparse.Node, items reflect.Value, lo, hi int, env *environment) ([]reflect.Value, error) {
+
+	nItems := items.Len()
+	var results []reflect.Value
+
+	for i := lo; i < hi; i++ {
 
 		item := items.Index(i)
 
 		res, err := eval(filter, item, env)
 		if err != nil {
-			return undefined, err
+			return nil, err
 		}
 
 		if jtypes.IsNumber(res) {
@@ -674,11 +1044,11 @@ func applyFilter(filter jparse.Node, items reflect.Value, env *environment) (ref
 				}
 
 				if index == i {
-					results = reflect.Append(results, item)
+					results = append(results, item)
 				}
 			}
 		case jlib.Boolean(res):
-			results = reflect.Append(results, item)
+			results = append(results, item)
 		}
 	}
 
@@ -741,7 +1111,7 @@ func buildSortInfo(items reflect.Value, terms []jparse.SortTerm, env *environmen
 	return info, nil
 }
 
-func makeLessFunc(info []*sortinfo, terms []jparse.SortTerm) func(int, int) bool {
+func makeLessFunc(info []*sortinfo, terms []jparse.SortTerm, cmp jlib.CompareFunc) func(int, int) bool {
 	return func(i, j int) bool {
 	Loop:
 		for t, term := range terms {
@@ -758,6 +1128,19 @@ func makeLessFunc(info []*sortinfo, terms []jparse.SortTerm) func(int, int) bool
 				return true
 			}
 
+			if cmp != nil && jtypes.IsString(vi) {
+				si, _ := jtypes.AsString(vi)
+				sj, _ := jtypes.AsString(vj)
+				c := cmp(si, sj)
+				if c == 0 {
+					continue Loop
+				}
+				if term.Dir == jparse.SortDescending {
+					return c > 0
+				}
+				return c < 0
+			}
+
 			if eq(vi, vj) {
 				continue Loop
 			}
@@ -785,7 +1168,7 @@ func evalSort(node *jparse.SortNode, data reflect.Value, env *environment) (refl
 		return undefined, err
 	}
 
-	sort.SliceStable(info, makeLessFunc(info, node.Terms))
+	sort.SliceStable(info, makeLessFunc(info, node.Terms, env.collation()))
 
 	results := reflect.MakeSlice(typeInterfaceSlice, len(info), len(info))
 
@@ -873,6 +1256,19 @@ type contextSetter interface {
 }
 
 func evalFunctionCall(node *jparse.FunctionCallNode, data reflect.Value, env *environment) (reflect.Value, error) {
+	v, err := callFunction(node, data, env, nil)
+	if err != nil {
+		return undefined, err
+	}
+
+	return await(v, env)
+}
+
+// callFunction is like evalFunctionCall except that it does
+// not wait for asynchronous results. If batches is non-nil
+// and the function can be batched, the call is added to a
+// batch.
+func callFunction(node *jparse.FunctionCallNode, data reflect.Value, env *environment, batches *batchSet) (reflect.Value, error) {
 	v, err := eval(node.Func, data, env)
 	if err != nil {
 		return undefined, err
@@ -880,6 +1276,9 @@ func evalFunctionCall(node *jparse.FunctionCallNode, data reflect.Value, env *en
 
 	fn, ok := jtypes.AsCallable(v)
 	if !ok {
+		if env.missingFunc(node.Func, v) {
+			return undefined, nil
+		}
 		return undefined, newEvalError(ErrNonCallable, node.Func, nil)
 	}
 
@@ -904,22 +1303,82 @@ func evalFunctionCall(node *jparse.FunctionCallNode, data reflect.Value, env *en
 		argv[i] = v
 	}
 
-	return fn.Call(argv)
+	if env.state != nil && env.state.observer != nil {
+		return observeCall(env.state.observer, fn, node, env, func() (reflect.Value, error) {
+			return applyFunction(fn, argv, node, env, batches)
+		})
+	}
+
+	return applyFunction(fn, argv, node, env, batches)
+}
+
+// applyFunction is the part of callFunction that calls the
+// function once its arguments have been evaluated.
+func applyFunction(fn jtypes.Callable, argv []reflect.Value, node *jparse.FunctionCallNode, env *environment, batches *batchSet) (reflect.Value, error) {
+
+	gc, ok := fn.(*goCallable)
+	if env.state != nil && env.state.stats != nil {
+		env.state.stats.call(ok && !gc.isExtension)
+	}
+	if !ok {
+		return fn.Call(argv)
+	}
+
+	if gc.parallelCalls {
+		if err := precomputeCalls(argv, env); err != nil {
+			return undefined, err
+		}
+	}
+
+	if !gc.fansOut {
+		wrapCallableArgs(gc, argv, env, nil)
+		v, err := gc.callBatched(argv, batches)
+		if err == nil {
+			err = env.checkResultItems(v, gc)
+		}
+		return v, withCallPosition(err, gc, node)
+	}
+
+	wrapCallableArgs(gc, argv, env, newBatchSet())
+
+	v, err := gc.Call(argv)
+	if err != nil {
+		return undefined, withCallPosition(err, gc, node)
+	}
+
+	v, err = awaitAll(v, env)
+	if err == nil {
+		err = env.checkResultItems(v, gc)
+	}
+	return v, err
+}
+
+// withCallPosition adds the position of a function call to an
+// error returned by the function, if it's an ExtensionError.
+// Errors from functions called by the function are unchanged.
+func withCallPosition(err error, fn *goCallable, node *jparse.FunctionCallNode) error {
+	if e, ok := err.(*ExtensionError); ok && e.Position < 0 && e.Func == fn.Name() {
+		e.Position = node.Position
+	}
+	return err
 }
 
 func evalFunctionApplication(node *jparse.FunctionApplicationNode, data reflect.Value, env *environment) (reflect.Value, error) {
 	// If the right hand side is a function call, insert
 	// the left hand side into the argument list and
 	// evaluate it.
-	if f, ok := node.RHS.(*jparse.FunctionCallNode); ok {
+	call, ok := node.RHS.(*jparse.FunctionCallNode)
+
+	if ok {
 
 		// Do not mutate the original AST node. Make a shallow copy
 		// and create a new args slice with LHS prepended.
-		g := *f
-		newArgs := make([]jparse.Node, 0, len(f.Args)+1)
+		g := *call
+		newArgs := make([]jparse.Node, 0, len(call.Args)+1)
 		newArgs = append(newArgs, node.LHS)
-		newArgs = append(newArgs, f.Args...)
+		newArgs = append(newArgs, call.Args...)
 		g.Args = newArgs
+		env.cover(node.RHS)
 		return evalFunctionCall(&g, data, env)
 	}
 
@@ -937,13 +1396,27 @@ func evalFunctionApplication(node *jparse.FunctionApplicationNode, data reflect.
 	// Check that the right hand side is callable.
 	f2, ok := jtypes.AsCallable(rhs)
 	if !ok {
+		if env.missingFunc(node.RHS, rhs) {
+			return undefined, nil
+		}
 		return undefined, newEvalError(ErrNonCallableApply, node.RHS, "~>")
 	}
 
 	// If the left hand side is not callable, call the right
 	// hand side using the left hand side as the argument.
 	if !jtypes.IsCallable(lhs) {
-		return f2.Call([]reflect.Value{lhs})
+		var v reflect.Value
+		if env.state != nil && env.state.observer != nil {
+			v, err = observeCall(env.state.observer, f2, node, env, func() (reflect.Value, error) {
+				return f2.Call([]reflect.Value{lhs})
+			})
+		} else {
+			v, err = f2.Call([]reflect.Value{lhs})
+		}
+		if err != nil {
+			return undefined, err
+		}
+		return await(v, env)
 	}
 
 	// Otherwise, combine both sides into a single callable.
@@ -954,46 +1427,52 @@ func evalFunctionApplication(node *jparse.FunctionApplicationNode, data reflect.
 			f1,
 			f2,
 		},
+		state: env.state,
 	}
 
 	return reflect.ValueOf(f), nil
 }
 
 func evalNumericOperator(node *jparse.NumericOperatorNode, data reflect.Value, env *environment) (reflect.Value, error) {
-	evaluate := func(node jparse.Node) (float64, bool, bool, error) {
-
-		v, err := eval(node, data, env)
-		if err != nil || v == undefined {
-			return 0, false, false, err
-		}
-
-		n, isNum := jtypes.AsNumber(v)
-		return n, true, isNum, nil
+	x, ok, err := evalNumericOperation(node, data, env)
+	if err != nil || !ok {
+		return undefined, err
 	}
 
+	return reflect.ValueOf(x), nil
+}
+
+// evalNumericOperation is like evalNumericOperator except that
+// it returns a float64 instead of a reflect.Value. The boolean
+// return value is false if the result is undefined.
+//
+// Operands that are themselves numeric expressions are evaluated
+// with evalNumericOperand, so intermediate results in a chain of
+// arithmetic operations are never boxed.
+func evalNumericOperation(node *jparse.NumericOperatorNode, data reflect.Value, env *environment) (float64, bool, error) {
 	// Evaluate both sides and return any errors.
-	lhs, lhsOK, lhsNumber, err := evaluate(node.LHS)
+	lhs, lhsOK, lhsNumber, err := evalNumericOperand(node.LHS, data, env)
 	if err != nil {
-		return undefined, err
+		return 0, false, err
 	}
 
-	rhs, rhsOK, rhsNumber, err := evaluate(node.RHS)
+	rhs, rhsOK, rhsNumber, err := evalNumericOperand(node.RHS, data, env)
 	if err != nil {
-		return undefined, err
+		return 0, false, err
 	}
 
 	// Return an error if either side is not a number.
 	if lhsOK && !lhsNumber {
-		return undefined, newEvalError(ErrNonNumberLHS, node.LHS, node.Type)
+		return 0, false, newEvalError(ErrNonNumberLHS, node.LHS, node.Type)
 	}
 
 	if rhsOK && !rhsNumber {
-		return undefined, newEvalError(ErrNonNumberRHS, node.RHS, node.Type)
+		return 0, false, newEvalError(ErrNonNumberRHS, node.RHS, node.Type)
 	}
 
 	// Return undefined if either side is undefined.
 	if !lhsOK || !rhsOK {
-		return undefined, nil
+		return 0, false, nil
 	}
 
 	var x float64
@@ -1014,85 +1493,255 @@ func evalNumericOperator(node *jparse.NumericOperatorNode, data reflect.Value, e
 	}
 
 	if math.IsInf(x, 0) {
-		return undefined, newEvalError(ErrNumberInf, nil, node.Type)
+		return 0, false, newEvalError(ErrNumberInf, nil, node.Type)
 	}
 
 	if math.IsNaN(x) {
-		return undefined, newEvalError(ErrNumberNaN, nil, node.Type)
+		return 0, false, newEvalError(ErrNumberNaN, nil, node.Type)
 	}
 
-	return reflect.ValueOf(x), nil
+	return x, true, nil
 }
 
-// See https://docs.jsonata.org/expressions#comparison-expressions
-func evalComparisonOperator(node *jparse.ComparisonOperatorNode, data reflect.Value, env *environment) (reflect.Value, error) {
-	evaluate := func(node jparse.Node) (reflect.Value, bool, bool, error) {
+// evalNumericOperand evaluates the operand of a numeric or
+// comparison operator. It returns the operand's numeric value,
+// whether the operand is defined, and whether it evaluated to
+// a number. Number literals, negations, numeric operators and
+// parenthesised numeric expressions are evaluated directly as
+// float64s, unless the evaluation needs to see every node (see
+// direct).
+func evalNumericOperand(node jparse.Node, data reflect.Value, env *environment) (float64, bool, bool, error) {
 
-		v, err := eval(node, data, env)
-		if err != nil || v == undefined {
-			return undefined, false, false, err
+	if !isNumericNode(node) || !env.direct() {
+		return evalNumericValue(node, data, env)
+	}
+
+	if err := env.enter(node); err != nil {
+		return 0, false, false, err
+	}
+	defer env.leave()
+
+	switch node := node.(type) {
+	case *jparse.NumberNode:
+		return node.Value, true, true, nil
+	case *jparse.NumericOperatorNode:
+		x, ok, err := evalNumericOperation(node, data, env)
+		return x, ok, ok, env.recordError(node, err)
+	case *jparse.NegationNode:
+		x, ok, isNum, err := evalNumericOperand(node.RHS, data, env)
+		if err != nil || !ok {
+			return 0, false, false, err
+		}
+		if !isNum {
+			return 0, false, false, env.recordError(node, newEvalError(ErrNonNumberRHS, node.RHS, "-"))
 		}
+		return -x, true, true, nil
+	case *jparse.BlockNode:
+		return evalNumericOperand(node.Exprs[0], data, newEnvironment(env, 0))
+	default:
+		panicf("evalNumericOperand: unexpected node type %T", node)
+		return 0, false, false, nil
+	}
+}
 
-		return v, jtypes.IsNumber(v), jtypes.IsString(v), nil
+// evalNumericValue is like evalNumericOperand but always
+// evaluates the node with eval.
+func evalNumericValue(node jparse.Node, data reflect.Value, env *environment) (float64, bool, bool, error) {
 
+	v, err := eval(node, data, env)
+	if err != nil || v == undefined {
+		return 0, false, false, err
 	}
 
-	// Evaluate both sides and return any errors.
-	lhs, lhsNumber, lhsString, err := evaluate(node.LHS)
+	n, isNum := jtypes.AsNumber(v)
+	return n, true, isNum, nil
+}
+
+// isNumericNode returns true if the given node is evaluated
+// by evalNumericOperand without creating a reflect.Value.
+func isNumericNode(node jparse.Node) bool {
+	switch node := node.(type) {
+	case *jparse.NumberNode, *jparse.NumericOperatorNode, *jparse.NegationNode:
+		return true
+	case *jparse.BlockNode:
+		return len(node.Exprs) == 1 && isNumericNode(node.Exprs[0])
+	default:
+		return false
+	}
+}
+
+// See https://docs.jsonata.org/expressions#comparison-expressions
+func evalComparisonOperator(node *jparse.ComparisonOperatorNode, data reflect.Value, env *environment) (reflect.Value, error) {
+	b, err := evalComparison(node, data, env)
 	if err != nil {
 		return undefined, err
 	}
 
-	rhs, rhsNumber, rhsString, err := evaluate(node.RHS)
+	return reflect.ValueOf(b), nil
+}
+
+// evalComparison is like evalComparisonOperator except that it
+// returns a bool instead of a reflect.Value.
+func evalComparison(node *jparse.ComparisonOperatorNode, data reflect.Value, env *environment) (bool, error) {
+	// Evaluate both sides and return any errors.
+	lhs, lhsOK, err := evalComparisonOperand(node.LHS, data, env)
 	if err != nil {
-		return undefined, err
+		return false, err
+	}
+
+	rhs, rhsOK, err := evalComparisonOperand(node.RHS, data, env)
+	if err != nil {
+		return false, err
 	}
 
+	return compareOperands(node, lhs, lhsOK, rhs, rhsOK, env.equal())
+}
+
+// A comparisonOperand holds the result of evaluating one side
+// of a comparison. Operands that are numeric expressions are
+// stored as float64s and only converted to reflect.Values if
+// a generic comparison is required.
+type comparisonOperand struct {
+	v        reflect.Value
+	n        float64
+	isNumber bool
+	isString bool
+}
+
+func evalComparisonOperand(node jparse.Node, data reflect.Value, env *environment) (comparisonOperand, bool, error) {
+
+	if isNumericNode(node) {
+		n, ok, isNum, err := evalNumericOperand(node, data, env)
+		if err != nil || !ok {
+			return comparisonOperand{}, false, err
+		}
+		return comparisonOperand{n: n, isNumber: isNum}, true, nil
+	}
+
+	v, err := eval(node, data, env)
+	if err != nil || v == undefined {
+		return comparisonOperand{}, false, err
+	}
+
+	return newComparisonOperand(v), true, nil
+}
+
+func newComparisonOperand(v reflect.Value) comparisonOperand {
+	n, isNum := jtypes.AsNumber(v)
+	return comparisonOperand{
+		v:        v,
+		n:        n,
+		isNumber: isNum,
+		isString: jtypes.IsString(v),
+	}
+}
+
+// compareOperands applies a comparison operator to a pair of
+// evaluated operands. The boolean arguments are false if the
+// corresponding operand is undefined. If equal is non-nil, it
+// is used by the equality and in operators.
+func compareOperands(node *jparse.ComparisonOperatorNode, lhs comparisonOperand, lhsOK bool, rhs comparisonOperand, rhsOK bool, equal jlib.EqualFunc) (bool, error) {
 	// If this operator requires comparable types, return
 	// an error if a) either side is not comparable or b)
 	// left side type does not equal right side type.
 	if needComparableTypes(node.Type) {
-		if lhs != undefined && !lhsNumber && !lhsString {
-			return undefined, newEvalError(ErrNonComparableLHS, node.LHS, node.Type)
+		if lhsOK && !lhs.isNumber && !lhs.isString {
+			return false, newEvalError(ErrNonComparableLHS, node.LHS, node.Type)
 		}
 
-		if rhs != undefined && !rhsNumber && !rhsString {
-			return undefined, newEvalError(ErrNonComparableRHS, node.RHS, node.Type)
+		if rhsOK && !rhs.isNumber && !rhs.isString {
+			return false, newEvalError(ErrNonComparableRHS, node.RHS, node.Type)
 		}
 
-		if lhs != undefined && rhs != undefined &&
-			(lhsNumber != rhsNumber || lhsString != rhsString) {
-			return undefined, newEvalError(ErrTypeMismatch, nil, node.Type)
+		if lhsOK && rhsOK &&
+			(lhs.isNumber != rhs.isNumber || lhs.isString != rhs.isString) {
+			return false, newEvalError(ErrTypeMismatch, nil, node.Type)
 		}
 	}
 
-	// Return undefined if either side is undefined.
-	if lhs == undefined || rhs == undefined {
-		return reflect.ValueOf(false), nil
+	// Return false if either side is undefined.
+	if !lhsOK || !rhsOK {
+		return false, nil
+	}
+
+	// Compare numbers directly, unless there's a custom
+	// equality function that might handle them.
+	if lhs.isNumber && rhs.isNumber && node.Type != jparse.ComparisonIn &&
+		(equal == nil || needComparableTypes(node.Type)) {
+		return compareNumbers(node.Type, lhs.n, rhs.n), nil
 	}
 
-	var b bool
+	if !lhs.v.IsValid() {
+		lhs.v = reflect.ValueOf(lhs.n)
+	}
 
-	switch node.Type {
-	case jparse.ComparisonIn:
-		b = in(lhs, rhs)
+	if !rhs.v.IsValid() {
+		rhs.v = reflect.ValueOf(rhs.n)
+	}
+
+	return compareValues(node.Type, lhs.v, rhs.v, equal), nil
+}
+
+func compareNumbers(op jparse.ComparisonOperator, lhs, rhs float64) bool {
+	switch op {
 	case jparse.ComparisonEqual:
-		b = eq(lhs, rhs)
+		return lhs == rhs
 	case jparse.ComparisonNotEqual:
-		b = !eq(lhs, rhs)
+		return lhs != rhs
 	case jparse.ComparisonLess:
-		b = lt(lhs, rhs)
+		return lhs < rhs
 	case jparse.ComparisonLessEqual:
-		b = lte(lhs, rhs)
+		return lhs <= rhs
 	case jparse.ComparisonGreater:
-		b = !lte(lhs, rhs)
+		return lhs > rhs
 	case jparse.ComparisonGreaterEqual:
-		b = !lt(lhs, rhs)
+		return lhs >= rhs
 	default:
-		panicf("unrecognised comparison operator %q", node.Type)
+		panicf("unrecognised comparison operator %q", op)
+		return false
 	}
+}
 
-	return reflect.ValueOf(b), nil
+func compareStrings(op jparse.ComparisonOperator, lhs, rhs string) bool {
+	switch op {
+	case jparse.ComparisonEqual:
+		return lhs == rhs
+	case jparse.ComparisonNotEqual:
+		return lhs != rhs
+	case jparse.ComparisonLess:
+		return lhs < rhs
+	case jparse.ComparisonLessEqual:
+		return lhs <= rhs
+	case jparse.ComparisonGreater:
+		return lhs > rhs
+	case jparse.ComparisonGreaterEqual:
+		return lhs >= rhs
+	default:
+		panicf("unrecognised comparison operator %q", op)
+		return false
+	}
+}
+
+func compareValues(op jparse.ComparisonOperator, lhs, rhs reflect.Value, equal jlib.EqualFunc) bool {
+	switch op {
+	case jparse.ComparisonIn:
+		return in(lhs, rhs, equal)
+	case jparse.ComparisonEqual:
+		return equals(lhs, rhs, equal)
+	case jparse.ComparisonNotEqual:
+		return !equals(lhs, rhs, equal)
+	case jparse.ComparisonLess:
+		return lt(lhs, rhs)
+	case jparse.ComparisonLessEqual:
+		return lte(lhs, rhs)
+	case jparse.ComparisonGreater:
+		return !lte(lhs, rhs)
+	case jparse.ComparisonGreaterEqual:
+		return !lt(lhs, rhs)
+	default:
+		panicf("unrecognised comparison operator %q", op)
+		return false
+	}
 }
 
 func needComparableTypes(op jparse.ComparisonOperator) bool {
@@ -1142,6 +1791,17 @@ func eq(lhs, rhs reflect.Value) bool {
 	return lhs == rhs
 }
 
+// equals is like eq except that it consults the custom equality
+// function first, if there is one.
+func equals(lhs, rhs reflect.Value, equal jlib.EqualFunc) bool {
+	if equal != nil && lhs.CanInterface() && rhs.CanInterface() {
+		if res, ok := equal(lhs.Interface(), rhs.Interface()); ok {
+			return res
+		}
+	}
+	return eq(lhs, rhs)
+}
+
 func lt(lhs, rhs reflect.Value) bool {
 	if v1, ok := jtypes.AsNumber(lhs); ok {
 		if v2, ok := jtypes.AsNumber(rhs); ok {
@@ -1163,7 +1823,7 @@ func lte(lhs, rhs reflect.Value) bool {
 	return lt(lhs, rhs) || eq(lhs, rhs)
 }
 
-func in(lhs, rhs reflect.Value) bool {
+func in(lhs, rhs reflect.Value, equal jlib.EqualFunc) bool {
 	// TODO: Does not work with null, e.g.
 	//    null in null    // evaluates to false
 	//    null in [null]  // evaluates to false
@@ -1171,7 +1831,7 @@ func in(lhs, rhs reflect.Value) bool {
 	rhs = arrayify(rhs)
 
 	for i, N := 0, rhs.Len(); i < N; i++ {
-		if eq(lhs, rhs.Index(i)) {
+		if equals(lhs, rhs.Index(i), equal) {
 			return true
 		}
 	}
@@ -1180,29 +1840,82 @@ func in(lhs, rhs reflect.Value) bool {
 }
 
 func evalBooleanOperator(node *jparse.BooleanOperatorNode, data reflect.Value, env *environment) (reflect.Value, error) {
-	// Evaluate both sides and return any errors.
-	lhs, err := eval(node.LHS, data, env)
+	b, err := evalBooleanOperation(node, data, env)
 	if err != nil {
 		return undefined, err
 	}
 
-	rhs, err := eval(node.RHS, data, env)
+	return reflect.ValueOf(b), nil
+}
+
+// evalBooleanOperation is like evalBooleanOperator except that
+// it returns a bool instead of a reflect.Value.
+func evalBooleanOperation(node *jparse.BooleanOperatorNode, data reflect.Value, env *environment) (bool, error) {
+	// Evaluate both sides and return any errors.
+	lhs, err := evalCondition(node.LHS, data, env)
 	if err != nil {
-		return undefined, err
+		return false, err
 	}
 
-	var b bool
+	rhs, err := evalCondition(node.RHS, data, env)
+	if err != nil {
+		return false, err
+	}
 
 	switch node.Type {
 	case jparse.BooleanAnd:
-		b = jlib.Boolean(lhs) && jlib.Boolean(rhs)
+		return lhs && rhs, nil
 	case jparse.BooleanOr:
-		b = jlib.Boolean(lhs) || jlib.Boolean(rhs)
+		return lhs || rhs, nil
 	default:
 		panicf("unrecognised boolean operator %q", node.Type)
+		return false, nil
+	}
+}
+
+// evalCondition evaluates a node and converts the result to
+// a boolean using JSONata's casting rules. Comparisons and
+// boolean operators are evaluated without creating an
+// intermediate reflect.Value, unless the evaluation needs to
+// see every node (see direct).
+func evalCondition(node jparse.Node, data reflect.Value, env *environment) (bool, error) {
+
+	switch node.(type) {
+	case *jparse.ComparisonOperatorNode, *jparse.BooleanOperatorNode, *jparse.BooleanNode:
+		if !env.direct() {
+			return evalConditionValue(node, data, env)
+		}
+	default:
+		return evalConditionValue(node, data, env)
 	}
 
-	return reflect.ValueOf(b), nil
+	if err := env.enter(node); err != nil {
+		return false, err
+	}
+	defer env.leave()
+
+	switch node := node.(type) {
+	case *jparse.ComparisonOperatorNode:
+		b, err := evalComparison(node, data, env)
+		return b, env.recordError(node, err)
+	case *jparse.BooleanOperatorNode:
+		b, err := evalBooleanOperation(node, data, env)
+		return b, env.recordError(node, err)
+	default:
+		return node.(*jparse.BooleanNode).Value, nil
+	}
+}
+
+// evalConditionValue is like evalCondition but always evaluates
+// the node with eval.
+func evalConditionValue(node jparse.Node, data reflect.Value, env *environment) (bool, error) {
+
+	v, err := eval(node, data, env)
+	if err != nil {
+		return false, err
+	}
+
+	return jlib.Boolean(v), nil
 }
 
 func evalStringConcatenation(node *jparse.StringConcatenationNode, data reflect.Value, env *environment) (reflect.Value, error) {
@@ -1236,25 +1949,33 @@ func evalStringConcatenation(node *jparse.StringConcatenationNode, data reflect.
 		return undefined, err
 	}
 
+	if err := env.checkBytes(len(s1)+len(s2), "&"); err != nil {
+		return undefined, err
+	}
+
 	return reflect.ValueOf(s1 + s2), nil
 }
 
 // Helper functions
 
-func walkObjectValues(v reflect.Value, fn func(reflect.Value)) {
+func walkObjectValues(v reflect.Value, env *environment, fn func(reflect.Value)) {
 	switch v := jtypes.Resolve(v); {
 	case jtypes.IsArray(v):
 		for i, N := 0, v.Len(); i < N; i++ {
 			fn(v.Index(i))
 		}
 	case jtypes.IsMap(v):
-		for _, k := range v.MapKeys() {
-			fn(v.MapIndex(k))
+		for _, k := range env.keyOrder().MapKeys(v) {
+			if v := env.convert(v.MapIndex(k)); !isLazyArray(v) {
+				fn(v)
+			}
 		}
 	case jtypes.IsStruct(v):
-		for i, N := 0, v.NumField(); i < N; i++ {
-			fn(v.Field(i))
-		}
+		jtypes.EachStructField(v, func(_ string, v reflect.Value) {
+			if v := env.convert(v); !isLazyArray(v) {
+				fn(v)
+			}
+		})
 	}
 }
 
@@ -1266,14 +1987,23 @@ func normalizeArray(v reflect.Value) reflect.Value {
 	return v
 }
 
-func flattenArray(v reflect.Value) reflect.Value {
+func flattenArray(v reflect.Value, env *environment) (reflect.Value, error) {
 	results := reflect.MakeSlice(typeInterfaceSlice, 0, 0)
 
 	switch {
 	case jtypes.IsArray(v):
+		cycles := env.cycles()
+		if err := cycles.enter(v); err != nil {
+			return undefined, err
+		}
+		defer cycles.leave(v)
+
 		v = jtypes.Resolve(v)
 		for i, N := 0, v.Len(); i < N; i++ {
-			vi := flattenArray(v.Index(i))
+			vi, err := flattenArray(v.Index(i), env)
+			if err != nil {
+				return undefined, err
+			}
 			if vi.IsValid() {
 				results = reflect.AppendSlice(results, vi)
 			}
@@ -1284,7 +2014,7 @@ func flattenArray(v reflect.Value) reflect.Value {
 		}
 	}
 
-	return results
+	return results, nil
 }
 
 func arrayify(v reflect.Value) reflect.Value {
@@ -1361,8 +2091,11 @@ func asSequence(v reflect.Value) (*sequence, bool) {
 		return v.Interface().(*sequence), true
 	}
 
-	if jtypes.Resolve(v).Type() == typeSequence && v.CanAddr() {
-		return v.Addr().Interface().(*sequence), true
+	// Take the address of the resolved value, not v itself. If
+	// v is an interface (e.g. an element of a []interface{}),
+	// its address is an *interface{}, not a *sequence.
+	if r := jtypes.Resolve(v); r.Type() == typeSequence && r.CanAddr() {
+		return r.Addr().Interface().(*sequence), true
 	}
 
 	return nil, false
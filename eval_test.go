@@ -3046,6 +3046,50 @@ func TestEvalNumericOperator(t *testing.T) {
 			},
 			Output: nil,
 		},
+		{
+			// Nested operators.
+			Input: &jparse.NumericOperatorNode{
+				Type: jparse.NumericMultiply,
+				LHS: &jparse.BlockNode{
+					Exprs: []jparse.Node{
+						&jparse.NumericOperatorNode{
+							Type: jparse.NumericAdd,
+							LHS: &jparse.NumberNode{
+								Value: 1,
+							},
+							RHS: &jparse.NegationNode{
+								RHS: &jparse.NumberNode{
+									Value: 4,
+								},
+							},
+						},
+					},
+				},
+				RHS: &jparse.NumberNode{
+					Value: 2.5,
+				},
+			},
+			Output: -7.5,
+		},
+		{
+			// Nested negation of a non-number.
+			Input: &jparse.NumericOperatorNode{
+				Type: jparse.NumericAdd,
+				LHS: &jparse.NumberNode{
+					Value: 1,
+				},
+				RHS: &jparse.NegationNode{
+					RHS: &jparse.StringNode{
+						Value: "1",
+					},
+				},
+			},
+			Error: &EvalError{
+				Type:  ErrNonNumberRHS,
+				Token: `"1"`,
+				Value: "-",
+			},
+		},
 	})
 }
 
@@ -4317,3 +4361,25 @@ func testEvalTestCases(t *testing.T, tests []evalTestCase) {
 		}
 	}
 }
+
+func BenchmarkEvalArithmetic(b *testing.B) {
+
+	node, err := jparse.Parse("(x * 2 + y / 4 - 1) % 7 > 3 and x * y <= 100")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	data := reflect.ValueOf(map[string]interface{}{
+		"x": 6.0,
+		"y": 16.0,
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := eval(node, data, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
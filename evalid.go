@@ -0,0 +1,84 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type evalIDKey struct{}
+
+// WithEvalID returns a copy of ctx with an evaluation ID, such as
+// the ID of the request that the evaluation is part of. When ctx
+// is passed to EvalContext (or to the EvalContext method of a
+// Bundle, RuleSet or Template), the ID is available to extensions
+// that take a context.Context (see EvalID) and is recorded in the
+// evaluation's errors (see EvalError.EvalID), so that their logs
+// can be matched up with the caller's.
+func WithEvalID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, evalIDKey{}, id)
+}
+
+// EvalID returns the evaluation ID in ctx, or an empty string if
+// there isn't one. Extensions that take a context.Context can use
+// it to label their logs:
+//
+//	"lookup": {Func: func(ctx context.Context, id string) (string, error) {
+//	    log.Printf("[%s] looking up %s", jsonata.EvalID(ctx), id)
+//	    ...
+//	}}
+func EvalID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(evalIDKey{}).(string)
+	return id
+}
+
+// WithEvalIDs gives each evaluation of the expressions compiled
+// by the Compiler an evaluation ID (see WithEvalID), unless the
+// caller has supplied one in the context. The IDs are made by
+// gen, or are random 16-digit hex strings if gen is nil. A
+// Bundle, RuleSet or Template has one ID for all of the
+// expressions it evaluates. Without this option, evaluations only
+// have the IDs that their callers supply.
+func WithEvalIDs(gen func() string) CompilerOption {
+	return func(c *Compiler) error {
+		if gen == nil {
+			gen = newEvalID
+		}
+		c.evalIDs = gen
+		return nil
+	}
+}
+
+// newEvalID returns a random evaluation ID.
+func newEvalID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panicf("could not create an evaluation ID: %s", err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// evalIDContext returns ctx with a new evaluation ID if the
+// expression makes IDs and ctx doesn't have one.
+func (e *Expression) evalIDContext(ctx context.Context) context.Context {
+	if e.evalIDs == nil || EvalID(ctx) != "" {
+		return ctx
+	}
+	return WithEvalID(ctx, e.evalIDs())
+}
+
+// setEvalID records an evaluation ID in an error returned by
+// locateError.
+func setEvalID(err error, id string) error {
+	if e, ok := err.(*EvalError); ok && id != "" {
+		e.EvalID = id
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+// newEvalIDCompiler returns a Compiler with an extension that
+// records the evaluation IDs it sees.
+func newEvalIDCompiler(t *testing.T, ids *[]string, opts ...CompilerOption) *Compiler {
+
+	exts := map[string]Extension{
+		"id": {Func: func(ctx context.Context) string {
+			id := EvalID(ctx)
+			*ids = append(*ids, id)
+			return id
+		}},
+		"fail": {Func: func() (interface{}, error) {
+			return nil, fmt.Errorf("failed")
+		}},
+	}
+
+	comp, err := NewCompiler(nil, exts, opts...)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	return comp
+}
+
+func TestWithEvalID(t *testing.T) {
+
+	var ids []string
+	comp := newEvalIDCompiler(t, &ids)
+
+	ctx := WithEvalID(context.Background(), "req-1")
+
+	got, err := comp.MustCompile(`[$id(), $id()]`).EvalContext(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := fmt.Sprint(got); s != "[req-1 req-1]" {
+		t.Errorf("expected the extension to see req-1, got %s", s)
+	}
+
+	var eerr *EvalError
+	_, err = comp.MustCompile(`$fail()`).EvalContext(ctx, nil, nil)
+	if !errors.As(err, &eerr) || eerr.EvalID != "req-1" {
+		t.Errorf("expected an EvalError with the ID req-1, got %#v", err)
+	}
+
+	// Without an ID in the context, there's no ID.
+	_, err = comp.MustCompile(`$id() & $fail()`).Eval(nil, nil)
+	if !errors.As(err, &eerr) || eerr.EvalID != "" {
+		t.Errorf("expected an EvalError without an ID, got %#v", err)
+	}
+	if ids[len(ids)-1] != "" {
+		t.Errorf("expected no ID, got %q", ids[len(ids)-1])
+	}
+
+	if id := EvalID(context.Background()); id != "" {
+		t.Errorf("expected no ID in an empty context, got %q", id)
+	}
+}
+
+func TestCompiler_WithEvalIDs(t *testing.T) {
+
+	var n int
+	gen := func() string {
+		n++
+		return fmt.Sprintf("eval-%d", n)
+	}
+
+	var ids []string
+	comp := newEvalIDCompiler(t, &ids, WithEvalIDs(gen))
+
+	e := comp.MustCompile(`[$id(), $id()]`)
+	for i := 0; i < 2; i++ {
+		if _, err := e.Eval(nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// The caller's ID takes precedence.
+	if _, err := e.EvalContext(WithEvalID(context.Background(), "mine"), nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "[eval-1 eval-1 eval-2 eval-2 mine mine]"
+	if s := fmt.Sprint(ids); s != want {
+		t.Errorf("expected IDs %s, got %s", want, s)
+	}
+
+	var eerr *EvalError
+	_, err := comp.MustCompile(`$fail()`).Eval(nil, nil)
+	if !errors.As(err, &eerr) || eerr.EvalID != "eval-3" {
+		t.Errorf("expected an EvalError with the ID eval-3, got %#v", err)
+	}
+
+	// The expressions in a Bundle share an ID.
+	ids = nil
+	b, err := comp.CompileBundle(map[string]string{
+		"a": `$id()`,
+		"b": `$id()`,
+	})
+	if err != nil {
+		t.Fatalf("CompileBundle failed: %v", err)
+	}
+	if _, err := b.Eval(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := fmt.Sprint(ids); s != "[eval-4 eval-4]" {
+		t.Errorf("expected the Bundle's expressions to share an ID, got %s", s)
+	}
+
+	// The default IDs are random.
+	ids = nil
+	comp = newEvalIDCompiler(t, &ids, WithEvalIDs(nil))
+	e = comp.MustCompile(`$id()`)
+	for i := 0; i < 2; i++ {
+		if _, err := e.Eval(nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	re := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	if len(ids) != 2 || !re.MatchString(ids[0]) || !re.MatchString(ids[1]) || ids[0] == ids[1] {
+		t.Errorf("expected two different random IDs, got %q", ids)
+	}
+}
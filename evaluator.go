@@ -0,0 +1,126 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"sync"
+)
+
+// An Evaluator evaluates an Expression using environments that
+// are set up once and reused between calls. This avoids the cost
+// of preparing the built-in functions and the compiler's base
+// registry on every evaluation.
+//
+// An Evaluator is safe for concurrent use by multiple goroutines.
+// Each evaluation takes an environment from the Evaluator's pool,
+// or prepares a new one if they're all in use, and returns it to
+// the pool when it finishes, so a single Evaluator can be shared
+// by a service's request handlers.
+type Evaluator struct {
+	expr  *Expression
+	bases sync.Pool
+}
+
+// NewEvaluator returns an Evaluator for the expression.
+func (e *Expression) NewEvaluator() *Evaluator {
+
+	ev := &Evaluator{
+		expr: e,
+	}
+	ev.bases.New = func() interface{} {
+		return e.newBaseEnv()
+	}
+
+	return ev
+}
+
+// Eval is like Expression.Eval except that it reuses one of the
+// Evaluator's environments. Variables passed in vars are only
+// visible to this evaluation.
+func (ev *Evaluator) Eval(data interface{}, vars map[string]interface{}) (interface{}, error) {
+	return ev.EvalContext(context.Background(), data, vars)
+}
+
+// EvalContext is like Eval but uses ctx for the evaluation. See
+// Expression.EvalContext.
+func (ev *Evaluator) EvalContext(ctx context.Context, data interface{}, vars map[string]interface{}) (interface{}, error) {
+
+	base := ev.bases.Get().(*environment)
+	res, err := ev.expr.evalWithBase(ctx, base, data, vars, nil)
+
+	// An evaluation that panics doesn't return its environment,
+	// which may have been left in an inconsistent state.
+	ev.bases.Put(base)
+
+	return res, err
+}
+
+// An EvaluatorPool maintains one Evaluator per worker, where a
+// worker is identified by a caller-supplied ID. Since Evaluators
+// are safe for concurrent use, a single Evaluator is usually
+// simpler. An EvaluatorPool is for fixed-size goroutine pools
+// that want to release a worker's environments when it exits.
+// An EvaluatorPool is safe for concurrent use by multiple
+// goroutines.
+type EvaluatorPool struct {
+	expr       *Expression
+	mu         sync.RWMutex
+	evaluators map[int]*Evaluator
+}
+
+// NewEvaluatorPool returns an empty EvaluatorPool for the
+// expression. Evaluators are created on first use.
+func (e *Expression) NewEvaluatorPool() *EvaluatorPool {
+	return &EvaluatorPool{
+		expr:       e,
+		evaluators: map[int]*Evaluator{},
+	}
+}
+
+// Get returns the Evaluator for the given worker, creating it
+// if necessary.
+func (p *EvaluatorPool) Get(worker int) *Evaluator {
+
+	p.mu.RLock()
+	ev, ok := p.evaluators[worker]
+	p.mu.RUnlock()
+
+	if ok {
+		return ev
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ev, ok = p.evaluators[worker]; !ok {
+		ev = p.expr.NewEvaluator()
+		p.evaluators[worker] = ev
+	}
+
+	return ev
+}
+
+// Eval evaluates the expression using the given worker's
+// Evaluator.
+func (p *EvaluatorPool) Eval(worker int, data interface{}, vars map[string]interface{}) (interface{}, error) {
+	return p.Get(worker).Eval(data, vars)
+}
+
+// Release discards the Evaluator for the given worker. It
+// should be called when a worker exits so that its Evaluator
+// can be garbage collected.
+func (p *EvaluatorPool) Release(worker int) {
+	p.mu.Lock()
+	delete(p.evaluators, worker)
+	p.mu.Unlock()
+}
+
+// Len returns the number of Evaluators in the pool.
+func (p *EvaluatorPool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.evaluators)
+}
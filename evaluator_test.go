@@ -0,0 +1,185 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestEvaluator_Reuse(t *testing.T) {
+	comp, err := NewCompiler(map[string]interface{}{"greet": "Hello"}, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err := comp.Compile(`$greet & " " & name & ($suffix ? $suffix : "")`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	ev := expr.NewEvaluator()
+
+	out, err := ev.Eval(map[string]interface{}{"name": "Ada"}, map[string]interface{}{"suffix": "!"})
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if out != "Hello Ada!" {
+		t.Errorf("expected %q, got %v", "Hello Ada!", out)
+	}
+
+	// Variables from the previous call must not be visible.
+	out, err = ev.Eval(map[string]interface{}{"name": "Bob"}, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if out != "Hello Bob" {
+		t.Errorf("expected %q, got %v", "Hello Bob", out)
+	}
+
+	if _, err := ev.Eval(nil, map[string]interface{}{"bad name": 1}); err == nil {
+		t.Errorf("expected error for invalid variable name")
+	}
+}
+
+func TestEvaluatorPool(t *testing.T) {
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err := comp.Compile(`$uppercase($substring(s, 0, 3)) & $string($n)`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	pool := expr.NewEvaluatorPool()
+
+	const workers = 4
+	const iterations = 200
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				s := fmt.Sprintf("w%dabc", worker)
+				out, err := pool.Eval(worker, map[string]interface{}{"s": s}, map[string]interface{}{"n": i})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if want := fmt.Sprintf("W%dA%d", worker, i); out != want {
+					errs <- fmt.Errorf("worker %d: expected %q, got %v", worker, want, out)
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if pool.Len() != workers {
+		t.Errorf("expected %d evaluators, got %d", workers, pool.Len())
+	}
+
+	if pool.Get(0) != pool.Get(0) {
+		t.Errorf("expected the same evaluator for the same worker")
+	}
+
+	pool.Release(0)
+	if pool.Len() != workers-1 {
+		t.Errorf("expected %d evaluators, got %d", workers-1, pool.Len())
+	}
+}
+
+func TestEvaluator_Concurrent(t *testing.T) {
+	comp, err := NewCompiler(map[string]interface{}{"greet": "Hello"}, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err := comp.Compile(`$greet & " " & name & $string($n)`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	ev := expr.NewEvaluator()
+
+	const goroutines = 8
+	const iterations = 200
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				name := fmt.Sprintf("g%d", g)
+				out, err := ev.Eval(map[string]interface{}{"name": name}, map[string]interface{}{"n": i})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if want := fmt.Sprintf("Hello %s%d", name, i); out != want {
+					errs <- fmt.Errorf("goroutine %d: expected %q, got %v", g, want, out)
+					return
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func BenchmarkEvaluator(b *testing.B) {
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		b.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err := comp.Compile(`a + b`)
+	if err != nil {
+		b.Fatalf("Compile failed: %v", err)
+	}
+	input := map[string]interface{}{"a": 1, "b": 2}
+
+	b.Run("Expression", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			expr.Eval(input, nil)
+		}
+	})
+
+	b.Run("Evaluator", func(b *testing.B) {
+		ev := expr.NewEvaluator()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ev.Eval(input, nil)
+		}
+	})
+
+	b.Run("EvaluatorParallel", func(b *testing.B) {
+		ev := expr.NewEvaluator()
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ev.Eval(input, nil)
+			}
+		})
+	})
+}
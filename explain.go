@@ -0,0 +1,304 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// ExplainOptions control what Explain records.
+type ExplainOptions struct {
+	// MaxValueLength, if it's positive, is the number of
+	// characters of each value that are kept. Longer values
+	// are cut short and marked as truncated.
+	MaxValueLength int
+
+	// MaxSteps, if it's positive, is the number of steps that
+	// are recorded. Steps after that are evaluated but not
+	// recorded, and the Trace is marked as truncated.
+	MaxSteps int
+}
+
+// A Trace is a record of an evaluation made by Explain. Root is
+// the step for the whole expression.
+type Trace struct {
+	Root     *TraceStep    `json:"root"`
+	Duration time.Duration `json:"duration"`
+
+	// Truncated is true if steps were left out because of
+	// ExplainOptions.MaxSteps.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// EvalID is the evaluation's ID, if it has one (see
+	// WithEvalID).
+	EvalID string `json:"evalId,omitempty"`
+}
+
+// A TraceStep is the evaluation of one node of the syntax tree.
+// Steps are the nodes that were evaluated to produce its value,
+// in the order they were evaluated. A node that is evaluated
+// more than once, e.g. a step in a path over an array, has a
+// TraceStep for each evaluation.
+type TraceStep struct {
+	// Type is the kind of node, e.g. "Path" or "FunctionCall"
+	// (the name of its jparse type without the Node suffix).
+	// Expr is the node's source, or its canonical form if the
+	// source isn't known.
+	Type string `json:"type"`
+	Expr string `json:"expr"`
+
+	// Start and End are the byte offsets of the node in the
+	// expression, or -1 if they aren't known.
+	Start int `json:"start"`
+	End   int `json:"end"`
+
+	// Value is the JSON encoding of the node's value, with
+	// functions shown as "<function>". It's empty if the value
+	// is undefined or the node failed, in which case Undefined
+	// is true or Error has the error message.
+	Value     string `json:"value,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Undefined bool   `json:"undefined,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	// Duration is the time spent evaluating the node,
+	// including its Steps.
+	Duration time.Duration `json:"duration"`
+
+	Steps []*TraceStep `json:"steps,omitempty"`
+}
+
+// Explain evaluates the expression like Eval and returns a Trace
+// of the evaluation: the nodes that were evaluated, with their
+// values and how long they took. It's meant for tools that show
+// why an expression produced its result. If the evaluation fails,
+// Explain returns the error along with the trace up to the
+// failure. opts may be nil.
+//
+// Explain turns off the optimizations that skip the evaluation
+// of parts of an expression, such as WithParallelism and
+// WithMemoization, so that each node appears in the trace, and
+// calls batched extensions one at a time. It's much slower than
+// Eval.
+func (e *Expression) Explain(data interface{}, vars map[string]interface{}, opts *ExplainOptions) (*Trace, error) {
+	return e.ExplainContext(context.Background(), data, vars, opts)
+}
+
+// ExplainContext is like Explain but uses ctx for the evaluation.
+// See Expression.EvalContext.
+func (e *Expression) ExplainContext(ctx context.Context, data interface{}, vars map[string]interface{}, opts *ExplainOptions) (*Trace, error) {
+
+	if opts == nil {
+		opts = &ExplainOptions{}
+	}
+
+	k := e.compiled()
+
+	rec := &traceRecorder{
+		src:    e.source,
+		ranges: k.ranges,
+		opts:   *opts,
+	}
+
+	trace := &Trace{}
+	start := time.Now()
+
+	err := e.withEvalEnv(ctx, k, e.newBaseEnv(), data, vars, nil, func(input reflect.Value, env *environment) error {
+		env.state.unoptimize()
+		env.state.trace = rec
+
+		trace.EvalID = EvalID(env.state.context)
+
+		_, err := eval(k.node, input, env)
+		return err
+	})
+
+	trace.Duration = time.Since(start)
+	trace.Truncated = rec.truncated
+	if len(rec.steps) > 0 {
+		trace.Root = rec.steps[0]
+	}
+
+	if err != nil {
+		return trace, err
+	}
+
+	if trace.Root == nil || trace.Root.Undefined {
+		return trace, ErrUndefined
+	}
+
+	return trace, nil
+}
+
+// String returns the trace as an indented list of steps with
+// their values.
+func (t *Trace) String() string {
+
+	var b strings.Builder
+
+	var write func(step *TraceStep, depth int)
+	write = func(step *TraceStep, depth int) {
+
+		value := step.Value
+		switch {
+		case step.Error != "":
+			value = "error: " + step.Error
+		case step.Undefined:
+			value = "undefined"
+		case step.Truncated:
+			value += "..."
+		}
+
+		fmt.Fprintf(&b, "%s%s = %s (%s)\n", strings.Repeat("  ", depth), step.Expr, value, step.Duration)
+		for _, child := range step.Steps {
+			write(child, depth+1)
+		}
+	}
+
+	if t.Root != nil {
+		write(t.Root, 0)
+	}
+	if t.Truncated {
+		b.WriteString("...\n")
+	}
+
+	return b.String()
+}
+
+// A traceRecorder builds the Trace for a single evaluation.
+type traceRecorder struct {
+	src    string
+	ranges map[jparse.Node]jparse.Range
+	opts   ExplainOptions
+
+	// steps holds the top-level steps and stack holds the
+	// steps that are being evaluated.
+	steps     []*TraceStep
+	stack     []*TraceStep
+	count     int
+	truncated bool
+}
+
+// tracing returns true if the evaluation is being traced or
+// debugged.
+func (s *environment) tracing() bool {
+	return s != nil && s.state != nil && (s.state.trace != nil || s.state.debug != nil)
+}
+
+// unoptimize turns off the optimizations that skip calls to
+// eval, so that every node is traced.
+func (s *evalState) unoptimize() {
+	s.kernels = nil
+	s.accessors = nil
+	s.parallel = nil
+	s.memo = nil
+}
+
+// eval evaluates a node and records a TraceStep for it.
+func (r *traceRecorder) eval(node jparse.Node, input reflect.Value, env *environment) (reflect.Value, error) {
+
+	step := &TraceStep{
+		Type: nodeType(node),
+	}
+	step.Expr, step.Start, step.End = nodeSource(node, r.src, r.ranges)
+
+	var parent *TraceStep
+	if n := len(r.stack); n > 0 {
+		parent = r.stack[n-1]
+		if step.Start >= 0 && step.Start == parent.Start && step.End == parent.End {
+			// The node is the parent in all but name, e.g.
+			// the only step of a path.
+			return evalNode(node, input, env)
+		}
+	}
+
+	if r.opts.MaxSteps > 0 && r.count >= r.opts.MaxSteps {
+		r.truncated = true
+		return evalNode(node, input, env)
+	}
+	r.count++
+
+	if parent != nil {
+		parent.Steps = append(parent.Steps, step)
+	} else {
+		r.steps = append(r.steps, step)
+	}
+
+	r.stack = append(r.stack, step)
+	start := time.Now()
+
+	v, err := evalNode(node, input, env)
+
+	step.Duration = time.Since(start)
+	r.stack = r.stack[:len(r.stack)-1]
+
+	switch {
+	case err != nil:
+		step.Error = err.Error()
+	case v == undefined:
+		step.Undefined = true
+	default:
+		step.Value, step.Truncated = r.format(v)
+	}
+
+	return v, err
+}
+
+// nodeType returns the name of a node's type without the
+// package name and the Node suffix, e.g. "FunctionCall".
+func nodeType(node jparse.Node) string {
+	return strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", node), "*jparse."), "Node")
+}
+
+// nodeSource returns a node's source and its byte offsets in
+// the expression, or its canonical form and -1 offsets if its
+// source range isn't known.
+func nodeSource(node jparse.Node, src string, ranges map[jparse.Node]jparse.Range) (string, int, int) {
+	if r, ok := ranges[node]; ok && r.End <= len(src) {
+		return src[r.Start:r.End], r.Start, r.End
+	}
+	return node.String(), -1, -1
+}
+
+// format returns the JSON encoding of a value, truncated to
+// MaxValueLength characters.
+func (r *traceRecorder) format(v reflect.Value) (string, bool) {
+
+	var s string
+
+	if _, ok := jtypes.AsCallable(v); ok {
+		s = `"<function>"`
+	} else if v.CanInterface() {
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			b, _ = json.Marshal(fmt.Sprint(v.Interface()))
+		}
+		s = string(b)
+	}
+
+	max := r.opts.MaxValueLength
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s, false
+	}
+
+	n := 0
+	for i := range s {
+		if n == max {
+			return s[:i], true
+		}
+		n++
+	}
+
+	return s, false
+}
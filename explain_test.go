@@ -0,0 +1,199 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// clearDurations zeroes the durations in a trace so that it can
+// be compared with an expected trace.
+func clearDurations(t *Trace) {
+
+	var clear func(step *TraceStep)
+	clear = func(step *TraceStep) {
+		step.Duration = 0
+		for _, child := range step.Steps {
+			clear(child)
+		}
+	}
+
+	t.Duration = 0
+	if t.Root != nil {
+		clear(t.Root)
+	}
+}
+
+func TestExplain(t *testing.T) {
+
+	input := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": 10, "qty": 2},
+			map[string]interface{}{"price": 5, "qty": 0},
+		},
+	}
+
+	data := []struct {
+		Expression string
+		Options    *ExplainOptions
+		Trace      string
+		Err        error
+	}{
+		{
+			Expression: `$count(items) > 1 ? "many" : "few"`,
+			Trace: `$count(items) > 1 ? "many" : "few" = "many" (0s)
+  $count(items) > 1 = true (0s)
+    $count(items) = 2 (0s)
+      $count = "<function>" (0s)
+      items = [{"price":10,"qty":2},{"price":5,"qty":0}] (0s)
+    1 = 1 (0s)
+  "many" = "many" (0s)
+`,
+		},
+		{
+			Expression: `items[qty > 0].(price * qty)`,
+			Options:    &ExplainOptions{MaxValueLength: 10},
+			Trace: `items[qty > 0].(price * qty) = 20 (0s)
+  items[qty > 0] = {"price":1... (0s)
+    items = [{"price":... (0s)
+    qty > 0 = true (0s)
+      qty = 2 (0s)
+      0 = 0 (0s)
+    qty > 0 = false (0s)
+      qty = 0 (0s)
+      0 = 0 (0s)
+  (price * qty) = 20 (0s)
+    price * qty = 20 (0s)
+      price = 10 (0s)
+      qty = 2 (0s)
+`,
+		},
+		{
+			Expression: `missing.name`,
+			Trace: `missing.name = undefined (0s)
+  missing = undefined (0s)
+`,
+			Err: ErrUndefined,
+		},
+		{
+			Expression: `[1, 2, 3, 4]`,
+			Options:    &ExplainOptions{MaxSteps: 3},
+			Trace: `[1, 2, 3, 4] = [1,2,3,4] (0s)
+  1 = 1 (0s)
+  2 = 2 (0s)
+...
+`,
+		},
+	}
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	for _, test := range data {
+
+		trace, err := comp.MustCompile(test.Expression).Explain(input, nil, test.Options)
+		if err != test.Err {
+			t.Errorf("%s: expected error %v, got %v", test.Expression, test.Err, err)
+		}
+
+		clearDurations(trace)
+		if s := trace.String(); s != test.Trace {
+			t.Errorf("%s: expected trace:\n%s\ngot:\n%s", test.Expression, test.Trace, s)
+		}
+	}
+}
+
+func TestExplain_Error(t *testing.T) {
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"fail": {Func: func(s string) (string, error) {
+			return "", fmt.Errorf("bad %s", s)
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	ctx := WithEvalID(context.Background(), "req-7")
+
+	trace, err := comp.MustCompile(`"a" & $fail("b")`).ExplainContext(ctx, nil, nil, nil)
+
+	var eerr *ExtensionError
+	if !errors.As(err, &eerr) {
+		t.Fatalf("expected an ExtensionError, got %v", err)
+	}
+
+	clearDurations(trace)
+
+	want := `"a" & $fail("b") = error: function "fail" failed at position 11: bad b (0s)
+  "a" = "a" (0s)
+  $fail("b") = error: function "fail" failed at position 11: bad b (0s)
+    $fail = "<function>" (0s)
+    "b" = "b" (0s)
+`
+	if s := trace.String(); s != want {
+		t.Errorf("expected trace:\n%s\ngot:\n%s", want, s)
+	}
+
+	if trace.EvalID != "req-7" {
+		t.Errorf("expected the evaluation ID req-7, got %q", trace.EvalID)
+	}
+	if step := trace.Root.Steps[1]; step.Type != "FunctionCall" || step.Start != 6 || step.End != 16 {
+		t.Errorf("expected a FunctionCall step at 6-16, got %s at %d-%d", step.Type, step.Start, step.End)
+	}
+}
+
+func TestExplain_Optimizations(t *testing.T) {
+
+	setMinParallelItems(t, 2)
+
+	comp, err := NewCompiler(nil, nil, WithMemoization(), WithParallelism(4))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"items": testParallelItems(10),
+	}
+
+	// Memoized and parallel subexpressions appear in the trace
+	// each time they're evaluated.
+	trace, err := comp.MustCompile(`$count(items.id) + $count(items.id)`).Explain(input, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var calls, names int
+
+	var count func(step *TraceStep)
+	count = func(step *TraceStep) {
+		switch {
+		case step.Type == "FunctionCall":
+			calls++
+		case step.Type == "Name" && step.Expr == "id":
+			names++
+		}
+		for _, child := range step.Steps {
+			count(child)
+		}
+	}
+	count(trace.Root)
+
+	if calls != 2 || names != 20 {
+		t.Errorf("expected 2 calls and 20 names, got %d and %d:\n%s", calls, names, trace)
+	}
+	if trace.Root.Value != "20" {
+		t.Errorf("expected 20, got %s", trace.Root.Value)
+	}
+	if !strings.HasPrefix(trace.Root.Expr, "$count") {
+		t.Errorf("expected the root to be the whole expression, got %s", trace.Root.Expr)
+	}
+}
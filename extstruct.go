@@ -0,0 +1,97 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+	"unicode"
+)
+
+// ExtensionsFromStruct returns an Extension for each exported
+// method of obj, which must be a struct or a pointer to a struct.
+// Methods with pointer receivers are included only if obj is a
+// pointer. The methods are bound to obj, so they can use its
+// fields, e.g. a service client.
+//
+// Each extension is named after its method with the leading
+// capital letters lowercased, so Slugify becomes slugify,
+// FormatDate becomes formatDate and URLEncode becomes urlEncode.
+//
+// The methods must follow the same rules as Extension.Func:
+// they return one value, or a value and an error, and can take
+// a context.Context as their first parameter. ExtensionsFromStruct
+// returns an error if any exported method doesn't. The results
+// can be passed to NewCompiler, RegisterExts or
+// Compiler.RegisterModule, and can be edited first, e.g. to add
+// a Signature.
+func ExtensionsFromStruct(obj interface{}) (map[string]Extension, error) {
+
+	if obj == nil {
+		return nil, fmt.Errorf("cannot get extensions from nil")
+	}
+
+	v := reflect.ValueOf(obj)
+	t := v.Type()
+
+	st := t
+	if st.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, fmt.Errorf("cannot get extensions from a nil %s", t)
+		}
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot get extensions from %s: not a struct or a pointer to a struct", t)
+	}
+
+	exts := make(map[string]Extension, t.NumMethod())
+	methods := make(map[string]string, t.NumMethod())
+
+	for i := 0; i < t.NumMethod(); i++ {
+
+		method := t.Method(i)
+		name := extensionName(method.Name)
+
+		if other, ok := methods[name]; ok {
+			return nil, fmt.Errorf("methods %s and %s have the same extension name %s", other, method.Name, name)
+		}
+		methods[name] = method.Name
+
+		ext := Extension{
+			Func: v.Method(i).Interface(),
+		}
+		if _, err := newGoCallable(name, ext); err != nil {
+			return nil, fmt.Errorf("method %s is not a valid extension: %s", method.Name, err)
+		}
+
+		exts[name] = ext
+	}
+
+	return exts, nil
+}
+
+// extensionName returns the extension name for a method name.
+// A leading run of capital letters is lowercased, apart from
+// the last one if it starts a word, e.g. URLEncode is urlEncode.
+func extensionName(method string) string {
+
+	runes := []rune(method)
+
+	n := 0
+	for n < len(runes) && unicode.IsUpper(runes[n]) {
+		n++
+	}
+
+	if n > 1 && n < len(runes) && unicode.IsLower(runes[n]) {
+		n--
+	}
+
+	for i := 0; i < n; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	return string(runes)
+}
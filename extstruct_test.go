@@ -0,0 +1,159 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type testHelpers struct {
+	prefix string
+	calls  int
+}
+
+func (h testHelpers) Greet(name string) string {
+	return h.prefix + name
+}
+
+func (h testHelpers) URLEncode(s string) string {
+	return strings.Replace(s, " ", "%20", -1)
+}
+
+func (h testHelpers) Lookup(ctx context.Context, id string) (string, error) {
+	if id == "" {
+		return "", errors.New("missing id")
+	}
+	return "user-" + id, ctx.Err()
+}
+
+func (h *testHelpers) Count() int {
+	h.calls++
+	return h.calls
+}
+
+type testBadHelpers struct{}
+
+func (testBadHelpers) Pair() (string, string) {
+	return "", ""
+}
+
+func TestExtensionsFromStruct(t *testing.T) {
+
+	h := &testHelpers{prefix: "Hello, "}
+
+	exts, err := ExtensionsFromStruct(h)
+	if err != nil {
+		t.Fatalf("ExtensionsFromStruct failed: %v", err)
+	}
+
+	var names []string
+	for name := range exts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if want := []string{"count", "greet", "lookup", "urlEncode"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected extensions %v, got %v", want, names)
+	}
+
+	comp, err := NewCompiler(nil, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{`$greet(name)`, "Hello, Ada"},
+		{`$urlEncode("a b")`, "a%20b"},
+		{`$lookup(id)`, "user-42"},
+		{`[$count(), $count()]`, []interface{}{1, 2}},
+	}
+
+	input := map[string]interface{}{"name": "Ada", "id": "42"}
+
+	for _, test := range tests {
+
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		got, err := expr.Eval(input, nil)
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+	}
+
+	expr, err := comp.Compile(`$lookup("")`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	var extErr *ExtensionError
+	if _, err := expr.Eval(nil, nil); !errors.As(err, &extErr) || extErr.Func != "lookup" {
+		t.Errorf("expected ExtensionError from lookup, got %v", err)
+	}
+
+	// Pointer methods are left out for struct values.
+	exts, err = ExtensionsFromStruct(testHelpers{})
+	if err != nil {
+		t.Fatalf("ExtensionsFromStruct failed: %v", err)
+	}
+	if _, ok := exts["count"]; ok || len(exts) != 3 {
+		t.Errorf("expected 3 extensions without count, got %d", len(exts))
+	}
+}
+
+func TestExtensionsFromStructErrors(t *testing.T) {
+
+	var nilHelpers *testHelpers
+
+	tests := []struct {
+		obj  interface{}
+		want string
+	}{
+		{nil, "cannot get extensions from nil"},
+		{nilHelpers, "cannot get extensions from a nil *jsonata.testHelpers"},
+		{"str", "cannot get extensions from string: not a struct"},
+		{testBadHelpers{}, "method Pair is not a valid extension: "},
+	}
+
+	for _, test := range tests {
+		_, err := ExtensionsFromStruct(test.obj)
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%v: expected error %q, got %v", test.obj, test.want, err)
+		}
+	}
+}
+
+func TestExtensionName(t *testing.T) {
+
+	tests := map[string]string{
+		"Slugify":    "slugify",
+		"FormatDate": "formatDate",
+		"URLEncode":  "urlEncode",
+		"ID":         "id",
+		"ID2":        "id2",
+		"X":          "x",
+	}
+
+	for method, want := range tests {
+		if got := extensionName(method); got != want {
+			t.Errorf("%s: expected %s, got %s", method, want, got)
+		}
+	}
+}
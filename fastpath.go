@@ -0,0 +1,180 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"math"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A fastPath is the compiled form of an expression that is only
+// a path of names, each optionally followed by a numeric index,
+// such as foo.bar[0].baz. It reads the input directly, without
+// creating the environments for an evaluation, for as long as
+// each step yields a single map or struct.
+type fastPath struct {
+	steps []fastStep
+}
+
+// A fastStep is a step of a fastPath.
+type fastStep struct {
+	name string
+	key  reflect.Value
+
+	// index is the step's index, if indexed is true.
+	index   float64
+	indexed bool
+}
+
+// compileFastPath returns a fastPath for an expression, or nil
+// if the expression isn't a simple path.
+func compileFastPath(root jparse.Node) (*fastPath, error) {
+
+	if err := checkPlanTree(root); err != nil {
+		return nil, err
+	}
+
+	path, ok := root.(*jparse.PathNode)
+	if !ok || path.KeepArrays || len(path.Steps) == 0 {
+		return nil, nil
+	}
+
+	p := &fastPath{
+		steps: make([]fastStep, len(path.Steps)),
+	}
+
+	for i, step := range path.Steps {
+
+		var index *jparse.NumberNode
+
+		if pred, ok := step.(*jparse.PredicateNode); ok {
+			if len(pred.Filters) != 1 {
+				return nil, nil
+			}
+			if index, ok = pred.Filters[0].(*jparse.NumberNode); !ok {
+				return nil, nil
+			}
+			step = pred.Expr
+		}
+
+		name, ok := step.(*jparse.NameNode)
+		if !ok {
+			return nil, nil
+		}
+
+		p.steps[i] = fastStep{
+			name: name.Value,
+			key:  reflect.ValueOf(name.Value),
+		}
+		if index != nil {
+			p.steps[i].index = index.Value
+			p.steps[i].indexed = true
+		}
+	}
+
+	return p, nil
+}
+
+// eval evaluates the path against data. If ok is false, the path
+// can't be read directly, e.g. because data or one of the steps
+// is an array that isn't indexed, and the caller must evaluate
+// the expression as usual.
+func (p *fastPath) eval(data reflect.Value, cs valueConverters) (v reflect.Value, ok bool) {
+
+	if !data.IsValid() {
+		return undefined, true
+	}
+
+	v = data
+	last := len(p.steps) - 1
+
+	for i, step := range p.steps {
+
+		if isLazyArray(v) {
+			return undefined, false
+		}
+
+		switch r := jtypes.Resolve(v); {
+		case jtypes.IsMap(r):
+			v = cs.convert(r.MapIndex(step.key))
+		case jtypes.IsStruct(r):
+			v = cs.convert(jtypes.StructField(r, step.name))
+		default:
+			return undefined, false
+		}
+
+		if !v.IsValid() {
+			return undefined, true
+		}
+
+		if step.indexed {
+			if v, ok = step.item(v, cs); !ok || !v.IsValid() {
+				return v, ok
+			}
+		}
+
+		if i < last && jtypes.IsArray(v) {
+			return undefined, false
+		}
+	}
+
+	switch {
+	case isLazyArray(v):
+		return undefined, false
+	case jtypes.IsArray(v):
+		if jtypes.Resolve(v).Len() == 0 {
+			return undefined, true
+		}
+		return v, true
+	case !v.CanInterface():
+		return undefined, false
+	default:
+		return reflect.ValueOf(v.Interface()), true
+	}
+}
+
+// item returns the item of an array that the step's index
+// selects. It returns false for values that aren't arrays, and
+// for items that are arrays or null, which the generic path
+// logic treats specially.
+func (step fastStep) item(v reflect.Value, cs valueConverters) (reflect.Value, bool) {
+
+	if isLazyArray(v) || !jtypes.IsArray(v) {
+		return undefined, false
+	}
+
+	arr := jtypes.Resolve(v)
+	n := int(math.Floor(step.index))
+	if n < 0 {
+		n += arr.Len()
+	}
+	if n < 0 || n >= arr.Len() {
+		return undefined, true
+	}
+
+	item := cs.convert(arr.Index(n))
+	if r := jtypes.Resolve(item); !r.IsValid() || isNilValue(r) || jtypes.IsArray(r) || isLazyArray(item) {
+		return undefined, false
+	}
+
+	return item, true
+}
+
+// evalFastPath evaluates e with its fastPath, if it has one and
+// nothing about the evaluation needs an environment, such as an
+// observer, a prelude or evaluation statistics.
+func (e *Expression) evalFastPath(ctx context.Context, k *compiledExpr, data interface{}) (reflect.Value, bool) {
+
+	if k.fast == nil || len(e.stages) > 0 || e.observer != nil || e.profile != nil || e.prelude != nil ||
+		e.resolver != nil || e.evalIDs != nil || evalStats(ctx) != nil {
+		return undefined, false
+	}
+
+	return k.fast.eval(e.input(data), e.converters)
+}
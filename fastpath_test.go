@@ -0,0 +1,194 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+func TestFastPathSelection(t *testing.T) {
+
+	data := []struct {
+		Expr string
+		Fast bool
+	}{
+		{`foo`, true},
+		{`foo.bar[0].baz`, true},
+		{`foo[-1]`, true},
+		{`foo[1.5].bar`, true},
+		{"`foo bar`.baz", true},
+		{`foo.bar[]`, false},
+		{`foo[0][1]`, false},
+		{`foo[bar = 1]`, false},
+		{`foo[$i]`, false},
+		{`$.foo`, false},
+		{`$foo.bar`, false},
+		{`foo.*`, false},
+		{`foo.(bar)`, false},
+		{`foo + 1`, false},
+	}
+
+	for _, test := range data {
+
+		node, err := jparse.Parse(test.Expr)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Expr, err)
+		}
+
+		if p, _ := compileFastPath(node); (p != nil) != test.Fast {
+			t.Errorf("%s: expected fast path %t, got %t", test.Expr, test.Fast, p != nil)
+		}
+	}
+}
+
+func TestFastPath(t *testing.T) {
+
+	item := &testAccessorItem{
+		Name:  "Hat",
+		Price: 34.45,
+		Tags:  []string{"red", "wool"},
+		When:  time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+		Next:  &testAccessorItem{Name: "Bag"},
+		Extra: map[string]interface{}{"Colour": "Red"},
+	}
+
+	input := map[string]interface{}{
+		"Item":  item,
+		"Items": []*testAccessorItem{item, item.Next},
+		"Order": map[string]interface{}{
+			"Product": map[string]interface{}{
+				"Name":  "Hat",
+				"Tags":  []interface{}{"red"},
+				"None":  []interface{}{},
+				"Null":  nil,
+				"Nulls": []interface{}{nil, 1.0},
+			},
+			"Lines": []interface{}{
+				map[string]interface{}{"Qty": 1, "SKU": []interface{}{"a", "b"}},
+				map[string]interface{}{"Qty": 2, "SKU": "c"},
+			},
+			"Single": map[string]interface{}{"Qty": 3},
+		},
+		"Nested": []interface{}{
+			[]interface{}{map[string]interface{}{"a": 1}},
+			[]interface{}{},
+		},
+	}
+
+	exprs := []string{
+		`Order.Product.Name`,
+		`Order.Product.Tags`,
+		`Order.Product.Tags[0]`,
+		`Order.Product.None`,
+		`Order.Product.None[0]`,
+		`Order.Product.Null`,
+		`Order.Product.Nulls[0]`,
+		`Order.Product.Nulls[1]`,
+		`Order.Product.Missing`,
+		`Order.Missing.Name`,
+		`Order.Lines[0].Qty`,
+		`Order.Lines[1].Qty`,
+		`Order.Lines[-1].Qty`,
+		`Order.Lines[-3].Qty`,
+		`Order.Lines[2].Qty`,
+		`Order.Lines[0.9].Qty`,
+		`Order.Lines[0].SKU`,
+		`Order.Lines[1].SKU`,
+		`Order.Lines[0].SKU[1]`,
+		`Order.Lines.Qty`,
+		`Order.Single[0].Qty`,
+		`Order.Single[1].Qty`,
+		`Nested[0].a`,
+		`Nested[0]`,
+		`Item.Name`,
+		`Item.Tags[1]`,
+		`Item.When`,
+		`Item.Next.Name`,
+		`Item.Next.Next.Name`,
+		`Items[1].Name`,
+		`Items[0].Next.Name`,
+	}
+
+	fast, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	tree, err := NewCompiler(nil, nil, WithBackend(BackendTree))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	for _, expr := range exprs {
+
+		e := fast.MustCompile(expr)
+		if e.compiled().fast == nil {
+			t.Errorf("%s: no fast path selected", expr)
+			continue
+		}
+
+		for _, data := range []interface{}{input, nil, []interface{}{input}, "string"} {
+
+			got, gotErr := e.Eval(data, nil)
+			exp, expErr := tree.MustCompile(expr).Eval(data, nil)
+
+			if !reflect.DeepEqual(got, exp) || !reflect.DeepEqual(gotErr, expErr) {
+				t.Errorf("%s: expected %v (error %v), got %v (error %v)", expr, exp, expErr, got, gotErr)
+			}
+		}
+	}
+}
+
+func TestFastPath_Fallback(t *testing.T) {
+
+	input := reflect.ValueOf(map[string]interface{}{
+		"a": map[string]interface{}{"b": 1},
+		"c": []interface{}{map[string]interface{}{"b": 2}},
+		"d": []interface{}{[]interface{}{1}, nil},
+	})
+
+	data := []struct {
+		Expr string
+		OK   bool
+	}{
+		{`a.b`, true},
+		{`a.x`, true},
+		{`a[0].b`, false},
+		{`c`, true},
+		{`c.b`, false},
+		{`c[0].b`, true},
+		{`c[5].b`, true},
+		{`d[0]`, false},
+		{`d[1]`, false},
+	}
+
+	for _, test := range data {
+
+		node, err := jparse.Parse(test.Expr)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Expr, err)
+		}
+
+		p, _ := compileFastPath(node)
+		if _, ok := p.eval(input, nil); ok != test.OK {
+			t.Errorf("%s: expected ok to be %t, got %t", test.Expr, test.OK, ok)
+		}
+	}
+
+	// Observers need the environment, so they turn the fast
+	// path off.
+	comp, err := NewCompiler(nil, nil, WithObserver(&recordingObserver{}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	e := comp.MustCompile(`a.b`)
+	if _, ok := e.evalFastPath(context.Background(), e.compiled(), input); ok {
+		t.Errorf("expected an observer to turn the fast path off")
+	}
+}
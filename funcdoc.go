@@ -0,0 +1,359 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A FunctionDoc describes a function that can be called by the
+// expressions compiled by a Compiler. FunctionDocs are meant
+// for rendering function references, e.g. as JSON with
+// encoding/json or as Markdown with WriteFunctionDocsMarkdown.
+type FunctionDoc struct {
+	// Name is the function's name without the leading $,
+	// e.g. "uppercase", or "str.slug" for a function in a
+	// module (see Compiler.RegisterModule).
+	Name string `json:"name"`
+
+	// Builtin is true for JSONata's built-in functions,
+	// including built-ins replaced by compiler options, and
+	// false for extensions.
+	Builtin bool `json:"builtin"`
+
+	// Signature is the function's type signature in the
+	// format used by typed lambdas, e.g. "<s-n?:s>". It's the
+	// extension's Signature if it has one, otherwise it's
+	// derived from the Go function's parameter and result
+	// types, in which case Inferred is true.
+	Signature string `json:"signature"`
+	Inferred  bool   `json:"inferred,omitempty"`
+
+	// Params and Returns describe the signature's parameters
+	// and result.
+	Params  []ParamDoc `json:"params"`
+	Returns string     `json:"returns"`
+
+	// Description and Deprecated are the extension's
+	// Description and Deprecated.
+	Description string `json:"description,omitempty"`
+	Deprecated  string `json:"deprecated,omitempty"`
+}
+
+// A ParamDoc describes a parameter of a function.
+type ParamDoc struct {
+	// Type is the parameter's type as a signature code, e.g.
+	// "n" for a number, "(sn)" for a string or a number, or
+	// "a<s>" for an array of strings.
+	Type string `json:"type"`
+
+	// Optional parameters can be left out. Variadic parameters
+	// accept any number of arguments. Contextable parameters
+	// receive the evaluation context if they're left out.
+	Optional    bool `json:"optional,omitempty"`
+	Variadic    bool `json:"variadic,omitempty"`
+	Contextable bool `json:"contextable,omitempty"`
+}
+
+// FunctionDocs returns descriptions of the built-in functions
+// and extensions available to expressions compiled by c, sorted
+// by name. Extensions that replace built-in functions are
+// listed in their place, and disabled functions aren't listed
+// (see DisableFunctions).
+func (c *Compiler) FunctionDocs() []FunctionDoc {
+
+	docs := map[string]FunctionDoc{
+		"now": {
+			Name:      "now",
+			Builtin:   true,
+			Signature: "<s?s?:s>",
+			Params: []ParamDoc{
+				{Type: "s", Optional: true},
+				{Type: "s", Optional: true},
+			},
+			Returns: "s",
+		},
+		"millis": {
+			Name:      "millis",
+			Builtin:   true,
+			Signature: "<:n>",
+			Params:    []ParamDoc{},
+			Returns:   "n",
+		},
+	}
+
+	for name, v := range baseEnv.symbols {
+		if gc, ok := v.Interface().(*goCallable); ok {
+			docs[name] = newFunctionDoc(name, gc)
+		}
+	}
+
+	for name, v := range c.baseRegistry {
+
+		if !v.IsValid() || !v.CanInterface() {
+			continue
+		}
+
+		switch x := v.Interface().(type) {
+		case *goCallable:
+			docs[name] = newFunctionDoc(name, x)
+		case extensionModule:
+			delete(docs, name)
+			for fn, v := range x {
+				if gc, ok := v.(*goCallable); ok {
+					docs[name+"."+fn] = newFunctionDoc(name+"."+fn, gc)
+				}
+			}
+		default:
+			// A variable hides the function with the same name.
+			delete(docs, name)
+		}
+	}
+
+	for _, name := range c.disabledFunctions() {
+		delete(docs, name)
+	}
+
+	results := make([]FunctionDoc, 0, len(docs))
+	for _, doc := range docs {
+		results = append(results, doc)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	return results
+}
+
+func newFunctionDoc(name string, gc *goCallable) FunctionDoc {
+
+	doc := FunctionDoc{
+		Name:        name,
+		Builtin:     !gc.isExtension,
+		Description: gc.description,
+		Deprecated:  gc.deprecated,
+	}
+
+	typ := gc.fn.Type()
+
+	var params []jparse.Param
+	if gc.signature != nil {
+		params = gc.signature
+		doc.Signature = gc.signatureText
+		if i := strings.LastIndexByte(doc.Signature, ':'); i >= 0 {
+			doc.Returns = strings.TrimSuffix(doc.Signature[i+1:], ">")
+		}
+	} else {
+		params = inferParams(gc)
+		doc.Inferred = true
+	}
+
+	if doc.Returns == "" {
+		doc.Returns = inferParam(typ.Out(0)).String()
+	}
+
+	if doc.Signature == "" {
+		var b strings.Builder
+		b.WriteByte('<')
+		for _, p := range params {
+			b.WriteString(p.String())
+		}
+		b.WriteByte(':')
+		b.WriteString(doc.Returns)
+		b.WriteByte('>')
+		doc.Signature = b.String()
+	}
+
+	doc.Params = make([]ParamDoc, len(params))
+	for i, p := range params {
+		sub := p
+		sub.Option = 0
+		doc.Params[i] = ParamDoc{
+			Type:        sub.String(),
+			Optional:    p.Option == jparse.ParamOptional,
+			Variadic:    p.Option == jparse.ParamVariadic,
+			Contextable: p.Option == jparse.ParamContextable,
+		}
+	}
+
+	return doc
+}
+
+// inferParams returns signature parameters for a Go callable
+// that doesn't have a signature.
+func inferParams(gc *goCallable) []jparse.Param {
+
+	params := make([]jparse.Param, len(gc.params))
+
+	for i, p := range gc.params {
+
+		switch {
+		case p.isOpt:
+			params[i] = inferParam(p.optType.t)
+			params[i].Option = jparse.ParamOptional
+		case p.isVar:
+			for _, vt := range p.varTypes {
+				params[i].Type |= inferParam(vt.t).Type
+			}
+			if params[i].Type == 0 {
+				params[i].Type = jparse.ParamTypeAny
+			}
+		default:
+			params[i] = inferParam(p.t)
+		}
+	}
+
+	n := len(params)
+	switch {
+	case n == 0:
+	case gc.isVariadic:
+		params[n-1].Option = jparse.ParamVariadic
+	case gc.contextHandler != nil && params[0].Option == 0:
+		params[0].Option = jparse.ParamContextable
+	}
+
+	return params
+}
+
+// inferParam returns the signature parameter that corresponds
+// to a Go type.
+func inferParam(t reflect.Type) jparse.Param {
+
+	switch {
+	case t == jtypes.TypeValue || t == jtypes.TypeInterface:
+		return jparse.Param{Type: jparse.ParamTypeAny}
+	case t.Implements(jtypes.TypeCallable):
+		return jparse.Param{Type: jparse.ParamTypeFunc}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return jparse.Param{Type: jparse.ParamTypeBool}
+	case reflect.String:
+		return jparse.Param{Type: jparse.ParamTypeString}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return jparse.Param{Type: jparse.ParamTypeNumber}
+	case reflect.Slice, reflect.Array:
+		p := jparse.Param{Type: jparse.ParamTypeArray}
+		if sub := inferParam(t.Elem()); sub.Type != jparse.ParamTypeAny {
+			p.SubParams = []jparse.Param{sub}
+		}
+		return p
+	case reflect.Map, reflect.Struct:
+		return jparse.Param{Type: jparse.ParamTypeObject}
+	case reflect.Ptr:
+		return inferParam(t.Elem())
+	default:
+		return jparse.Param{Type: jparse.ParamTypeAny}
+	}
+}
+
+// WriteFunctionDocsMarkdown writes a function reference in
+// Markdown, with a section for each function.
+func WriteFunctionDocsMarkdown(w io.Writer, docs []FunctionDoc) error {
+
+	var b strings.Builder
+
+	for i, doc := range docs {
+
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		fmt.Fprintf(&b, "### $%s\n\n", doc.Name)
+		fmt.Fprintf(&b, "`$%s%s`", doc.Name, doc.Signature)
+		if doc.Builtin {
+			b.WriteString(" (built-in)")
+		}
+		b.WriteString("\n\n")
+
+		if doc.Description != "" {
+			b.WriteString(doc.Description)
+			b.WriteString("\n\n")
+		}
+
+		if doc.Deprecated != "" {
+			fmt.Fprintf(&b, "Deprecated: %s\n\n", doc.Deprecated)
+		}
+
+		for j, p := range doc.Params {
+
+			var opts []string
+			if p.Optional {
+				opts = append(opts, "optional")
+			}
+			if p.Variadic {
+				opts = append(opts, "variadic")
+			}
+			if p.Contextable {
+				opts = append(opts, "defaults to the context")
+			}
+
+			fmt.Fprintf(&b, "- argument %d: %s", j+1, paramTypeName(p.Type))
+			if len(opts) > 0 {
+				fmt.Fprintf(&b, " (%s)", strings.Join(opts, ", "))
+			}
+			b.WriteByte('\n')
+		}
+
+		fmt.Fprintf(&b, "- returns: %s\n", paramTypeName(doc.Returns))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var paramTypeNames = map[rune]string{
+	'n': "number",
+	's': "string",
+	'b': "boolean",
+	'l': "null",
+	'a': "array",
+	'o': "object",
+	'f': "function",
+	'j': "JSON value",
+	'x': "any",
+}
+
+// paramTypeName returns a readable name for a signature type
+// code, e.g. "string or number" for "(sn)".
+func paramTypeName(code string) string {
+
+	if code == "" {
+		return "undefined"
+	}
+
+	var sub string
+	if i := strings.IndexByte(code, '<'); i >= 0 {
+		sub = strings.TrimSuffix(code[i+1:], ">")
+		code = code[:i]
+	}
+
+	code = strings.TrimSuffix(strings.TrimPrefix(code, "("), ")")
+
+	names := make([]string, 0, len(code))
+	for _, r := range code {
+		if name, ok := paramTypeNames[r]; ok {
+			names = append(names, name)
+		}
+	}
+
+	s := strings.Join(names, " or ")
+	if sub != "" {
+		s += " of " + paramTypeName(sub)
+	}
+
+	return s
+}
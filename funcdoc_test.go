@@ -0,0 +1,176 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompiler_FunctionDocs(t *testing.T) {
+
+	exts := map[string]Extension{
+		"repeat": {
+			Func:        strings.Repeat,
+			Signature:   "<s-n:s>",
+			Description: "Repeats a string.",
+			Deprecated:  "use $pad",
+		},
+		"joinAll": {
+			Func: func(sep string, parts ...string) string {
+				return strings.Join(parts, sep)
+			},
+		},
+		"uppercase": {
+			Func: strings.ToUpper,
+		},
+	}
+
+	vars := map[string]interface{}{
+		"lowercase": "hidden",
+	}
+
+	comp, err := NewCompiler(vars, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.RegisterModule("str", map[string]Extension{
+		"words": {
+			Func: strings.Fields,
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterModule failed: %v", err)
+	}
+
+	docs := comp.FunctionDocs()
+
+	byName := map[string]FunctionDoc{}
+	for i, doc := range docs {
+		if i > 0 && docs[i-1].Name >= doc.Name {
+			t.Errorf("docs are not sorted: %s before %s", docs[i-1].Name, doc.Name)
+		}
+		byName[doc.Name] = doc
+	}
+
+	expected := []FunctionDoc{
+		{
+			Name:        "repeat",
+			Signature:   "<s-n:s>",
+			Params:      []ParamDoc{{Type: "s", Contextable: true}, {Type: "n"}},
+			Returns:     "s",
+			Description: "Repeats a string.",
+			Deprecated:  "use $pad",
+		},
+		{
+			Name:      "joinAll",
+			Signature: "<ss+:s>",
+			Inferred:  true,
+			Params:    []ParamDoc{{Type: "s"}, {Type: "s", Variadic: true}},
+			Returns:   "s",
+		},
+		{
+			Name:      "uppercase",
+			Signature: "<s:s>",
+			Inferred:  true,
+			Params:    []ParamDoc{{Type: "s"}},
+			Returns:   "s",
+		},
+		{
+			Name:      "str.words",
+			Signature: "<s:a<s>>",
+			Inferred:  true,
+			Params:    []ParamDoc{{Type: "s"}},
+			Returns:   "a<s>",
+		},
+		{
+			Name:      "substring",
+			Builtin:   true,
+			Signature: "<s-nn?:s>",
+			Inferred:  true,
+			Params:    []ParamDoc{{Type: "s", Contextable: true}, {Type: "n"}, {Type: "n", Optional: true}},
+			Returns:   "s",
+		},
+		{
+			Name:      "millis",
+			Builtin:   true,
+			Signature: "<:n>",
+			Params:    []ParamDoc{},
+			Returns:   "n",
+		},
+	}
+
+	for _, want := range expected {
+		got, ok := byName[want.Name]
+		if !ok {
+			t.Errorf("%s: missing from docs", want.Name)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %+v, got %+v", want.Name, want, got)
+		}
+	}
+
+	if _, ok := byName["lowercase"]; ok {
+		t.Errorf("expected lowercase to be hidden by a variable")
+	}
+
+	if _, err := json.Marshal(docs); err != nil {
+		t.Errorf("json.Marshal failed: %v", err)
+	}
+}
+
+func TestWriteFunctionDocsMarkdown(t *testing.T) {
+
+	docs := []FunctionDoc{
+		{
+			Name:        "str.pad",
+			Signature:   "<s-na<s>?:s>",
+			Params:      []ParamDoc{{Type: "s", Contextable: true}, {Type: "n"}, {Type: "a<s>", Optional: true}},
+			Returns:     "s",
+			Description: "Pads a string.",
+			Deprecated:  "use $str.padStart",
+		},
+		{
+			Name:      "sum",
+			Builtin:   true,
+			Signature: "<a<n>:n>",
+			Params:    []ParamDoc{{Type: "a<n>"}},
+			Returns:   "n",
+		},
+	}
+
+	var b strings.Builder
+	if err := WriteFunctionDocsMarkdown(&b, docs); err != nil {
+		t.Fatalf("WriteFunctionDocsMarkdown failed: %v", err)
+	}
+
+	want := "### $str.pad\n" +
+		"\n" +
+		"`$str.pad<s-na<s>?:s>`\n" +
+		"\n" +
+		"Pads a string.\n" +
+		"\n" +
+		"Deprecated: use $str.padStart\n" +
+		"\n" +
+		"- argument 1: string (defaults to the context)\n" +
+		"- argument 2: number\n" +
+		"- argument 3: array of string (optional)\n" +
+		"- returns: string\n" +
+		"\n" +
+		"### $sum\n" +
+		"\n" +
+		"`$sum<a<n>:n>` (built-in)\n" +
+		"\n" +
+		"- argument 1: array of number\n" +
+		"- returns: number\n"
+
+	if got := b.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package jsonata
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// fuzzEvalSeeds are the initial inputs for FuzzEval. They refer
+// to the fields in testdata/account.json. Inputs that once
+// crashed the evaluator are kept in testdata/fuzz.
+var fuzzEvalSeeds = []string{
+	`Account.Order.Product.Price`,
+	`$sum(Account.Order.Product.(Price * Quantity))`,
+	`Account.Order[0].Product[ProductID > 800].SKU`,
+	`Account.Order.Product{Description.Colour: $count($)}`,
+	`Account.Order.Product^(>Price).Description.Weight`,
+	`Account.Order@$o.Product#$i.{"order": $o.OrderID, "index": $i}`,
+	`Account.**.Colour`,
+	`Account.*.Product.%.OrderID`,
+	`$map(Account.Order, function($o) { $count($o.Product) })`,
+	`[1..3].($ * 2) ~> $reduce(function($a, $b) { $a + $b })`,
+	`($f := function($n) { $n <= 1 ? 1 : $n * $f($n - 1) }; $f(5))`,
+	`$string(Account) & $uppercase(Account.` + "`Account Name`" + `)`,
+	`Account.Order.Product ~> | Description | {"Colour": "Red"} |`,
+	`$replace(Account.Order.Product.SKU, /0+/, "x")`,
+	`$lookup(Account, "Order")[OrderID = "order104"]`,
+}
+
+func FuzzEval(f *testing.F) {
+
+	b, err := ioutil.ReadFile("testdata/account.json")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		f.Fatal(err)
+	}
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	for _, s := range fuzzEvalSeeds {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, expr string) {
+
+		e, err := comp.Compile(expr)
+		if err != nil {
+			var cerr *CompileError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("Compile(%q): expected a *CompileError, got %T: %v", expr, err, err)
+			}
+			return
+		}
+
+		// Errors are fine, panics are not.
+		e.Eval(data, nil)
+	})
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EvalGroupOptions configure an EvalGroup.
+type EvalGroupOptions struct {
+	// CollectAll evaluates every expression even if some of
+	// them fail, and returns the results of the ones that
+	// succeed along with an *EvalGroupError. By default, the
+	// first error cancels the other evaluations.
+	CollectAll bool
+
+	// MaxConcurrency, if it's positive, is the number of
+	// expressions that are evaluated at a time. By default,
+	// they're all evaluated at once.
+	MaxConcurrency int
+}
+
+// An EvalGroup evaluates a set of named expressions against the
+// same input concurrently, e.g. the fields of a composite
+// mapping that each call slow extensions. Unlike a Bundle, its
+// expressions don't share results, and they can come from
+// different Compilers. An EvalGroup is safe for concurrent use.
+type EvalGroup struct {
+	names []string
+	exprs []*Expression
+	opts  EvalGroupOptions
+}
+
+// NewEvalGroup returns an EvalGroup for a set of expressions,
+// keyed by name. opts may be nil.
+func NewEvalGroup(exprs map[string]*Expression, opts *EvalGroupOptions) *EvalGroup {
+
+	g := &EvalGroup{
+		names: make([]string, 0, len(exprs)),
+	}
+	if opts != nil {
+		g.opts = *opts
+	}
+
+	for name := range exprs {
+		g.names = append(g.names, name)
+	}
+	sort.Strings(g.names)
+
+	for _, name := range g.names {
+		g.exprs = append(g.exprs, exprs[name])
+	}
+
+	return g
+}
+
+// CompileGroup compiles a set of expressions, keyed by name,
+// into an EvalGroup. opts may be nil.
+func (c *Compiler) CompileGroup(exprs map[string]string, opts *EvalGroupOptions) (*EvalGroup, error) {
+
+	compiled := make(map[string]*Expression, len(exprs))
+
+	for name, expr := range exprs {
+		e, err := c.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		compiled[name] = e
+	}
+
+	return NewEvalGroup(compiled, opts), nil
+}
+
+// Names returns the names of the group's expressions in sorted
+// order.
+func (g *EvalGroup) Names() []string {
+	return append([]string(nil), g.names...)
+}
+
+// Eval evaluates the group's expressions with the given input and
+// variables. See EvalContext.
+func (g *EvalGroup) Eval(data interface{}, vars map[string]interface{}) (map[string]interface{}, error) {
+	return g.EvalContext(context.Background(), data, vars)
+}
+
+// EvalContext evaluates the group's expressions concurrently with
+// the given input and variables, and returns their results keyed
+// by name. Expressions that evaluate to undefined are omitted.
+// All of the evaluations have the same evaluation ID (see
+// WithEvalIDs).
+//
+// By default, the first expression to fail cancels the context
+// of the others, and EvalContext returns that error, prefixed
+// with the expression's name, once they've all returned. The
+// cancellation is seen by asynchronous and context-aware
+// extensions (see Future). With EvalGroupOptions.CollectAll,
+// every expression is evaluated and the errors are returned
+// together in an *EvalGroupError, along with the results of the
+// expressions that succeeded.
+//
+// The input must not be modified while it's being evaluated.
+func (g *EvalGroup) EvalContext(ctx context.Context, data interface{}, vars map[string]interface{}) (map[string]interface{}, error) {
+
+	if len(g.exprs) > 0 {
+		ctx = g.exprs[0].evalIDContext(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var sem chan struct{}
+	if n := g.opts.MaxConcurrency; n > 0 && n < len(g.exprs) {
+		sem = make(chan struct{}, n)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	var first error
+	errs := map[string]error{}
+	results := make(map[string]interface{}, len(g.exprs))
+
+	eval := func(e *Expression) (interface{}, error) {
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return e.EvalContext(ctx, data, vars)
+	}
+
+	for i, e := range g.exprs {
+
+		wg.Add(1)
+		go func(name string, e *Expression) {
+			defer wg.Done()
+
+			res, err := eval(e)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case err == nil:
+				results[name] = res
+			case err == ErrUndefined:
+			case g.opts.CollectAll:
+				errs[name] = err
+			case first == nil:
+				first = fmt.Errorf("%s: %w", name, err)
+				cancel()
+			}
+		}(g.names[i], e)
+	}
+
+	wg.Wait()
+
+	if first != nil {
+		return nil, first
+	}
+	if len(errs) > 0 {
+		return results, &EvalGroupError{Errors: errs}
+	}
+
+	return results, nil
+}
+
+// An EvalGroupError holds the errors of the expressions in an
+// EvalGroup that failed, keyed by name (see
+// EvalGroupOptions.CollectAll).
+type EvalGroupError struct {
+	Errors map[string]error
+}
+
+func (e *EvalGroupError) Error() string {
+
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %s", name, e.Errors[name])
+	}
+
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newGroupCompiler returns a Compiler with extensions that wait,
+// fail and record how many calls are in progress at once.
+func newGroupCompiler(t *testing.T, active, peak *int32) *Compiler {
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"slow": {Func: func(ctx context.Context, v interface{}) (interface{}, error) {
+			n := atomic.AddInt32(active, 1)
+			defer atomic.AddInt32(active, -1)
+			for {
+				p := atomic.LoadInt32(peak)
+				if n <= p || atomic.CompareAndSwapInt32(peak, p, n) {
+					break
+				}
+			}
+
+			select {
+			case <-time.After(20 * time.Millisecond):
+				return v, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}},
+		"fail": {Func: func(msg string) (interface{}, error) {
+			return nil, errors.New(msg)
+		}},
+	}, WithEvalIDs(nil))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	return comp
+}
+
+func TestCompiler_CompileGroup(t *testing.T) {
+
+	var active, peak int32
+	comp := newGroupCompiler(t, &active, &peak)
+
+	g, err := comp.CompileGroup(map[string]string{
+		"name":    `$slow(name)`,
+		"total":   `$slow($sum(items))`,
+		"count":   `$slow($count(items))`,
+		"missing": `nothing`,
+	}, nil)
+	if err != nil {
+		t.Fatalf("CompileGroup failed: %v", err)
+	}
+
+	if names := g.Names(); !reflect.DeepEqual(names, []string{"count", "missing", "name", "total"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	input := map[string]interface{}{
+		"name":  "order",
+		"items": []interface{}{1.0, 2.0, 3.0},
+	}
+
+	start := time.Now()
+	got, err := g.Eval(input, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"name":  "order",
+		"total": 6.0,
+		"count": 3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// The expressions run at the same time.
+	if peak < 3 {
+		t.Errorf("expected at least 3 concurrent calls, got %d", peak)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Errorf("expected the evaluations to overlap, took %s", d)
+	}
+
+	// MaxConcurrency limits the concurrent evaluations.
+	peak = 0
+	g, err = comp.CompileGroup(map[string]string{
+		"a": `$slow(1)`,
+		"b": `$slow(2)`,
+		"c": `$slow(3)`,
+	}, &EvalGroupOptions{MaxConcurrency: 1})
+	if err != nil {
+		t.Fatalf("CompileGroup failed: %v", err)
+	}
+	if _, err := g.Eval(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if peak != 1 {
+		t.Errorf("expected one evaluation at a time, got %d", peak)
+	}
+
+	if _, err := comp.CompileGroup(map[string]string{"bad": `(`}, nil); err == nil {
+		t.Errorf("expected a compile error")
+	}
+}
+
+func TestNewEvalGroup_Errors(t *testing.T) {
+
+	var active, peak int32
+	comp := newGroupCompiler(t, &active, &peak)
+
+	exprs := map[string]*Expression{
+		"ok":     comp.MustCompile(`"fine"`),
+		"bad":    comp.MustCompile(`$fail("boom")`),
+		"worse":  comp.MustCompile(`$fail("bang")`),
+		"slowly": comp.MustCompile(`$slow("late")`),
+	}
+
+	// The first error cancels the other evaluations.
+	g := NewEvalGroup(map[string]*Expression{
+		"bad":    exprs["bad"],
+		"slowly": exprs["slowly"],
+	}, nil)
+
+	got, err := g.Eval(nil, nil)
+	if got != nil || err == nil || err.Error() != `bad: function "fail" failed at position 5: boom` {
+		t.Errorf("expected the error from bad, got %v, %v", got, err)
+	}
+
+	var eerr *EvalError
+	if !errors.As(err, &eerr) || eerr.EvalID == "" {
+		t.Errorf("expected an EvalError with an evaluation ID, got %#v", err)
+	}
+
+	// CollectAll returns every error along with the results.
+	g = NewEvalGroup(exprs, &EvalGroupOptions{CollectAll: true})
+
+	got, err = g.EvalContext(WithEvalID(context.Background(), "req-2"), nil, nil)
+	if want := map[string]interface{}{"ok": "fine", "slowly": "late"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	var gerr *EvalGroupError
+	if !errors.As(err, &gerr) || len(gerr.Errors) != 2 {
+		t.Fatalf("expected an EvalGroupError with 2 errors, got %v", err)
+	}
+
+	want := `bad: function "fail" failed at position 5: boom
+worse: function "fail" failed at position 5: bang`
+	if s := err.Error(); s != want {
+		t.Errorf("expected error:\n%s\ngot:\n%s", want, s)
+	}
+
+	for name, err := range gerr.Errors {
+		if !errors.As(err, &eerr) || eerr.EvalID != "req-2" {
+			t.Errorf("%s: expected the evaluation ID req-2, got %v", name, err)
+		}
+	}
+
+	// A cancelled context stops evaluations that are waiting
+	// to start.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	g = NewEvalGroup(map[string]*Expression{
+		"a": exprs["slowly"],
+		"b": exprs["slowly"],
+	}, &EvalGroupOptions{MaxConcurrency: 1, CollectAll: true})
+
+	_, err = g.EvalContext(ctx, nil, nil)
+	if !errors.As(err, &gerr) || len(gerr.Errors) != 2 {
+		t.Fatalf("expected an EvalGroupError with 2 errors, got %v", err)
+	}
+	for name, err := range gerr.Errors {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", name, fmt.Sprint(err))
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithInterpolation replaces ${NAME} placeholders in the source
+// of the expressions that the Compiler compiles with values from
+// a map before they're parsed, e.g. to put environment-specific
+// constants into a shared set of expressions:
+//
+//	comp, err := jsonata.NewCompiler(nil, nil, jsonata.WithInterpolation(map[string]string{
+//	    "REGION":    os.Getenv("REGION"),
+//	    "THRESHOLD": "250",
+//	}))
+//	e, err := comp.Compile(`order.total > ${THRESHOLD} and region = "${REGION}"`)
+//
+// Names start with a letter or an underscore, followed by
+// letters, digits and underscores. The values are inserted as
+// they are, so a value inside a string literal must not contain
+// its quotes. $${NAME} is a literal ${NAME}. A placeholder that
+// isn't in values is a compile error, a *CompileError that wraps
+// a *PlaceholderError. The positions in other compile errors and
+// in evaluation errors are offsets in the expression after the
+// placeholders have been replaced.
+//
+// Placeholders are replaced by Compile and CompileAll, and so in
+// the expressions of Bundles, RuleSets and Templates.
+func WithInterpolation(values map[string]string) CompilerOption {
+	return func(c *Compiler) error {
+		c.interpolation = make(map[string]string, len(values))
+		for k, v := range values {
+			c.interpolation[k] = v
+		}
+		return nil
+	}
+}
+
+// A PlaceholderError is the error in a CompileError for a
+// ${NAME} placeholder that doesn't have a value (see
+// WithInterpolation).
+type PlaceholderError struct {
+	Name string
+}
+
+func (e *PlaceholderError) Error() string {
+	return fmt.Sprintf("no value for placeholder ${%s}", e.Name)
+}
+
+// interpolate replaces the placeholders in an expression. It
+// returns an error for each placeholder without a value.
+func (c *Compiler) interpolate(expr string) (string, CompileErrors) {
+
+	if c.interpolation == nil || !strings.Contains(expr, "${") {
+		return expr, nil
+	}
+
+	var b strings.Builder
+	var errs CompileErrors
+
+	for i := 0; i < len(expr); i++ {
+
+		escaped := strings.HasPrefix(expr[i:], "$${")
+		start := i
+		if escaped {
+			start++
+		}
+
+		if strings.HasPrefix(expr[start:], "${") {
+			if name := placeholderName(expr[start+2:]); name != "" {
+				end := start + 2 + len(name) + 1
+
+				switch v, ok := c.interpolation[name]; {
+				case escaped:
+					b.WriteString(expr[start:end])
+				case ok:
+					b.WriteString(v)
+				default:
+					errs = append(errs, newPlaceholderError(name, expr, start))
+				}
+
+				i = end - 1
+				continue
+			}
+		}
+
+		b.WriteByte(expr[i])
+	}
+
+	return b.String(), errs
+}
+
+// placeholderName returns the name at the start of s if it's
+// followed by a closing brace.
+func placeholderName(s string) string {
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		case c == '}' && i > 0:
+			return s[:i]
+		default:
+			return ""
+		}
+	}
+
+	return ""
+}
+
+func newPlaceholderError(name string, src string, pos int) *CompileError {
+
+	line, column := lineColumn(src, pos)
+
+	return &CompileError{
+		Token:      "${" + name + "}",
+		Position:   pos,
+		Line:       line,
+		Column:     column,
+		SourceLine: sourceLine(src, pos),
+		Err:        &PlaceholderError{Name: name},
+	}
+}
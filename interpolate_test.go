@@ -0,0 +1,130 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompiler_WithInterpolation(t *testing.T) {
+
+	values := map[string]string{
+		"THRESHOLD": "250",
+		"REGION":    "eu-west",
+		"_x1":       "1",
+	}
+
+	comp, err := NewCompiler(nil, nil, WithInterpolation(values))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	// Changes to the map don't affect the Compiler.
+	values["THRESHOLD"] = "0"
+
+	input := map[string]interface{}{
+		"total":  300,
+		"region": "eu-west",
+	}
+
+	data := []struct {
+		Expression string
+		Source     string
+		Output     interface{}
+	}{
+		{
+			Expression: `total > ${THRESHOLD} and region = "${REGION}"`,
+			Source:     `total > 250 and region = "eu-west"`,
+			Output:     true,
+		},
+		{
+			Expression: `${_x1} + ${_x1}`,
+			Source:     `1 + 1`,
+			Output:     float64(2),
+		},
+		{
+			// Escaped placeholders.
+			Expression: `"$${THRESHOLD} is ${THRESHOLD}"`,
+			Source:     `"${THRESHOLD} is 250"`,
+			Output:     "${THRESHOLD} is 250",
+		},
+		{
+			// Text that isn't a placeholder is left alone.
+			Expression: `[$string(${"a": 1}), "${}", "${1A}", "$${x"]`,
+			Source:     `[$string(${"a": 1}), "${}", "${1A}", "$${x"]`,
+			Output:     []interface{}{`{"a":1}`, "${}", "${1A}", "$${x"},
+		},
+	}
+
+	for _, test := range data {
+
+		e, err := comp.Compile(test.Expression)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.Expression, err)
+			continue
+		}
+		if e.source != test.Source {
+			t.Errorf("%s: expected source %s, got %s", test.Expression, test.Source, e.source)
+		}
+
+		got, err := e.Eval(input, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Expression, err)
+		}
+		if !reflect.DeepEqual(got, test.Output) {
+			t.Errorf("%s: expected %v, got %v", test.Expression, test.Output, got)
+		}
+	}
+}
+
+func TestCompiler_WithInterpolation_Errors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil, WithInterpolation(map[string]string{"A": "1"}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	const expr = "${A} +\n  ${B} + ${C}"
+
+	_, err = comp.Compile(expr)
+
+	var cerr *CompileError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected a CompileError, got %v", err)
+	}
+
+	var perr *PlaceholderError
+	if !errors.As(err, &perr) || perr.Name != "B" {
+		t.Errorf("expected a PlaceholderError for B, got %v", err)
+	}
+
+	want := "no value for placeholder ${B} at line 2, column 3\n  ${B} + ${C}\n  ^"
+	if s := err.Error(); s != want {
+		t.Errorf("expected error:\n%s\ngot:\n%s", want, s)
+	}
+
+	// CompileAll reports every missing placeholder.
+	_, err = comp.CompileAll(expr)
+
+	var cerrs CompileErrors
+	if !errors.As(err, &cerrs) || len(cerrs) != 2 {
+		t.Fatalf("expected two CompileErrors, got %v", err)
+	}
+	if cerrs[0].Token != "${B}" || cerrs[1].Token != "${C}" || cerrs[1].Position != 16 {
+		t.Errorf("unexpected errors %q at %d and %q at %d", cerrs[0].Token, cerrs[0].Position, cerrs[1].Token, cerrs[1].Position)
+	}
+
+	// Without the option, placeholders aren't replaced, and
+	// ${B} isn't valid JSONata.
+	comp, err = NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	if _, err := comp.Compile(`${B}`); err == nil || errors.As(err, &perr) {
+		t.Errorf("expected a syntax error, got %v", err)
+	}
+}
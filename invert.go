@@ -0,0 +1,336 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// An Inversion is a best-effort inverse of a mapping expression,
+// as returned by Invert.
+type Inversion struct {
+	// Expr is the inverse expression. It maps the output of
+	// the original expression back to its input, for the
+	// fields that could be inverted.
+	Expr string
+
+	// Issues lists the parts of the original expression that
+	// could not be inverted and are missing from Expr.
+	Issues []InversionIssue
+}
+
+// An InversionIssue describes an output field that Invert could
+// not map back to the input.
+type InversionIssue struct {
+	// Field is the output field, as a dotted path of keys.
+	// Fields of the objects created for each item of an array
+	// are marked with [], e.g. "items[].sku".
+	Field string
+
+	// Expr is the expression that computes the field.
+	Expr string
+
+	// Reason explains why the field can't be inverted.
+	Reason string
+}
+
+// Invert generates the inverse of an expression that maps one
+// JSON schema to another by moving and renaming fields. The
+// expression must be an object constructor, or a path that ends
+// with one, whose values are:
+//
+//   - paths made up only of field names, e.g. address.city
+//   - nested object constructors
+//   - paths of field names that end with an object constructor,
+//     e.g. orders.{"sku": id}, which map every item of an array
+//
+// For example, the inverse of
+//
+//	{"name": fullName, "city": address.city}
+//
+// is
+//
+//	{"fullName": name, "address": {"city": city}}
+//
+// Any other values, such as function calls, operators and
+// constants, are left out of the inverse and reported as issues,
+// as are fields that map an input field that is already mapped
+// by another field. Invert returns an error only if expr is not
+// a valid expression or is not an object mapping at all.
+func Invert(expr string) (*Inversion, error) {
+
+	root, err := jparse.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isMapping(root) {
+		return nil, fmt.Errorf("cannot invert %s: expression is not an object constructor", root)
+	}
+
+	inv := &inverter{}
+	tree := newInverseTree()
+	inv.value(root, nil, "", tree)
+
+	res := &Inversion{
+		Expr:   tree.String(),
+		Issues: inv.issues,
+	}
+
+	if _, err := jparse.Parse(res.Expr); err != nil {
+		// This indicates a bug in the inverter.
+		return nil, fmt.Errorf("cannot invert %s: generated invalid expression %s: %s", root, res.Expr, err)
+	}
+
+	return res, nil
+}
+
+// isMapping returns true if a node is an object constructor or
+// a path that ends with one.
+func isMapping(node jparse.Node) bool {
+	switch node := node.(type) {
+	case *jparse.ObjectNode:
+		return true
+	case *jparse.PathNode:
+		_, ok := node.Steps[len(node.Steps)-1].(*jparse.ObjectNode)
+		return ok
+	default:
+		return false
+	}
+}
+
+type inverter struct {
+	issues []InversionIssue
+}
+
+func (inv *inverter) issue(field string, node jparse.Node, reason string) {
+	inv.issues = append(inv.issues, InversionIssue{
+		Field:  field,
+		Expr:   node.String(),
+		Reason: reason,
+	})
+}
+
+// object inverts the fields of an object constructor. Rel is the
+// path of the object in the output, relative to the current
+// context item, and field is its full path for issues.
+func (inv *inverter) object(obj *jparse.ObjectNode, rel []string, field string, tree *inverseTree) {
+
+	for _, pair := range obj.Pairs {
+
+		key, ok := pair[0].(*jparse.StringNode)
+		if !ok {
+			inv.issue(field, pair[0], "computed keys cannot be inverted")
+			continue
+		}
+
+		inv.value(pair[1], appendPath(rel, key.Value), joinField(field, key.Value), tree)
+	}
+}
+
+// value inverts the expression that computes the output field at
+// path rel. The inverse sets tree's input fields from rel.
+func (inv *inverter) value(node jparse.Node, rel []string, field string, tree *inverseTree) {
+
+	switch node := node.(type) {
+	case *jparse.ObjectNode:
+		inv.object(node, rel, field, tree)
+		return
+
+	case *jparse.PathNode:
+		steps := node.Steps
+		if v, ok := steps[0].(*jparse.VariableNode); ok && v.Name == "" {
+			steps = steps[1:]
+		}
+
+		names, ok := fieldNames(steps)
+		if ok && len(names) > 0 {
+			inv.set(tree, names, pathExpr(rel), field, node)
+			return
+		}
+
+		if len(steps) > 0 {
+			obj, isObj := steps[len(steps)-1].(*jparse.ObjectNode)
+			names, ok = fieldNames(steps[:len(steps)-1])
+			if isObj && ok {
+				inner := newInverseTree()
+				inv.object(obj, nil, field+"[]", inner)
+				expr := fmt.Sprintf("%s.%s", pathExpr(rel), inner)
+				if len(names) == 0 {
+					// The whole input was mapped, e.g. by
+					// $.{...} at the top level.
+					if tree.empty() && len(rel) == 0 {
+						tree.expr = expr
+						return
+					}
+					inv.issue(field, node, "only the top-level expression can map the whole input")
+					return
+				}
+				inv.set(tree, names, expr, field, node)
+				return
+			}
+		}
+
+		inv.issue(field, node, "only paths of field names can be inverted")
+
+	case *jparse.StringNode, *jparse.NumberNode, *jparse.BooleanNode, *jparse.NullNode:
+		inv.issue(field, node, "constant values don't come from the input")
+
+	default:
+		inv.issue(field, node, "computed values cannot be inverted")
+	}
+}
+
+func (inv *inverter) set(tree *inverseTree, path []string, expr string, field string, node jparse.Node) {
+	if !tree.set(path, expr) {
+		inv.issue(field, node, fmt.Sprintf("input field %s is already mapped by another field", strings.Join(path, ".")))
+	}
+}
+
+// fieldNames returns the names in a path if every step is a
+// field name.
+func fieldNames(steps []jparse.Node) ([]string, bool) {
+
+	names := make([]string, len(steps))
+
+	for i, step := range steps {
+		name, ok := step.(*jparse.NameNode)
+		if !ok {
+			return nil, false
+		}
+		names[i] = name.Value
+	}
+
+	return names, true
+}
+
+func appendPath(path []string, name string) []string {
+	return append(append([]string(nil), path...), name)
+}
+
+func joinField(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+var reIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// pathExpr returns a JSONata path for a list of field names,
+// or $ for an empty list.
+func pathExpr(names []string) string {
+
+	if len(names) == 0 {
+		return "$"
+	}
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		switch {
+		case !reIdentifier.MatchString(name), isKeyword(name):
+			parts[i] = "`" + name + "`"
+		default:
+			parts[i] = name
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+func isKeyword(s string) bool {
+	switch s {
+	case "and", "or", "in", "true", "false", "null", "function":
+		return true
+	default:
+		return false
+	}
+}
+
+// An inverseTree is an object constructor in an inverse
+// expression. Each key maps to either an expression or a nested
+// object. If expr is set, the tree is an expression rather than
+// an object.
+type inverseTree struct {
+	keys     []string
+	values   map[string]string
+	children map[string]*inverseTree
+	expr     string
+}
+
+func newInverseTree() *inverseTree {
+	return &inverseTree{
+		values:   map[string]string{},
+		children: map[string]*inverseTree{},
+	}
+}
+
+func (t *inverseTree) empty() bool {
+	return len(t.keys) == 0 && t.expr == ""
+}
+
+// set sets the field at path to expr. It returns false if the
+// field, or a field that contains it or is contained by it, is
+// already set.
+func (t *inverseTree) set(path []string, expr string) bool {
+
+	if t.expr != "" {
+		return false
+	}
+
+	key := path[0]
+	_, isValue := t.values[key]
+	child, isChild := t.children[key]
+
+	if len(path) == 1 {
+		if isValue || isChild {
+			return false
+		}
+		t.keys = append(t.keys, key)
+		t.values[key] = expr
+		return true
+	}
+
+	if isValue {
+		return false
+	}
+	if !isChild {
+		child = newInverseTree()
+		t.keys = append(t.keys, key)
+		t.children[key] = child
+	}
+
+	return child.set(path[1:], expr)
+}
+
+func (t *inverseTree) String() string {
+
+	if t.expr != "" {
+		return t.expr
+	}
+
+	parts := make([]string, len(t.keys))
+
+	for i, key := range t.keys {
+
+		k, _ := json.Marshal(key)
+
+		var v string
+		if child, ok := t.children[key]; ok {
+			v = child.String()
+		} else {
+			v = t.values[key]
+		}
+
+		parts[i] = fmt.Sprintf("%s: %s", k, v)
+	}
+
+	return "{" + strings.Join(parts, ", ") + "}"
+}
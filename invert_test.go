@@ -0,0 +1,130 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInvert(t *testing.T) {
+
+	tests := []struct {
+		expr   string
+		want   string
+		issues []InversionIssue
+	}{
+		{
+			expr: `{"name": fullName, "city": address.city, "zip": $.address.zip}`,
+			want: `{"fullName": name, "address": {"city": city, "zip": zip}}`,
+		},
+		{
+			expr: `{"customer": {"id": custId, "first name": name.first}}`,
+			want: `{"custId": customer.id, "name": {"first": customer.` + "`first name`" + `}}`,
+		},
+		{
+			expr: `{"lines": orders.{"sku": id, "qty": quantity}}`,
+			want: `{"orders": lines.{"id": sku, "quantity": qty}}`,
+		},
+		{
+			expr: `Account.{"owner": Name}`,
+			want: `{"Account": $.{"Name": owner}}`,
+		},
+		{
+			expr: `$.{"owner": Name}`,
+			want: `$.{"Name": owner}`,
+		},
+		{
+			expr: `{"id": id, "upper": $uppercase(name), "kind": "customer", "total": price * qty, "copy": id, "items": orders.{"sku": id & "x"}}`,
+			want: `{"id": id, "orders": items.{}}`,
+			issues: []InversionIssue{
+				{Field: "upper", Expr: `$uppercase(name)`, Reason: "computed values cannot be inverted"},
+				{Field: "kind", Expr: `"customer"`, Reason: "constant values don't come from the input"},
+				{Field: "total", Expr: `price * qty`, Reason: "computed values cannot be inverted"},
+				{Field: "copy", Expr: `id`, Reason: "input field id is already mapped by another field"},
+				{Field: "items[].sku", Expr: `id & "x"`, Reason: "computed values cannot be inverted"},
+			},
+		},
+		{
+			expr: `{"a": x.y, "b": x, "c": items[0].name}`,
+			want: `{"x": {"y": a}}`,
+			issues: []InversionIssue{
+				{Field: "b", Expr: `x`, Reason: "input field x is already mapped by another field"},
+				{Field: "c", Expr: `items[0].name`, Reason: "only paths of field names can be inverted"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		inv, err := Invert(test.expr)
+		if err != nil {
+			t.Errorf("%s: Invert failed: %v", test.expr, err)
+			continue
+		}
+
+		if inv.Expr != test.want {
+			t.Errorf("%s: expected inverse %s, got %s", test.expr, test.want, inv.Expr)
+		}
+
+		if !reflect.DeepEqual(inv.Issues, test.issues) {
+			t.Errorf("%s: expected issues %+v, got %+v", test.expr, test.issues, inv.Issues)
+		}
+	}
+
+	for _, expr := range []string{`name`, `$uppercase(x)`, `{`} {
+		if _, err := Invert(expr); err == nil {
+			t.Errorf("%s: expected error", expr)
+		}
+	}
+}
+
+func TestInvertRoundTrip(t *testing.T) {
+
+	forward := `{"name": fullName, "city": address.city, "lines": orders.{"sku": id, "qty": quantity}}`
+
+	input := map[string]interface{}{
+		"fullName": "Ada",
+		"address": map[string]interface{}{
+			"city": "London",
+		},
+		"orders": []interface{}{
+			map[string]interface{}{"id": "a1", "quantity": 2},
+			map[string]interface{}{"id": "b2", "quantity": 5},
+		},
+	}
+
+	inv, err := Invert(forward)
+	if err != nil {
+		t.Fatalf("Invert failed: %v", err)
+	}
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	fwd, err := comp.Compile(forward)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	back, err := comp.Compile(inv.Expr)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	output, err := fwd.Eval(input, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	got, err := back.Eval(output, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, input) {
+		t.Errorf("expected %v, got %v", input, got)
+	}
+}
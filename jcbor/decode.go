@@ -0,0 +1,382 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jcbor
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ErrInvalidData is wrapped by the errors for CBOR data that's
+// malformed or can't be converted to JSONata values.
+var ErrInvalidData = errors.New("invalid data")
+
+// maxDepth is the maximum nesting of arrays, maps and tags in
+// the data that Decode accepts.
+const maxDepth = 10000
+
+// The major types of RFC 8949.
+const (
+	majorUint = iota
+	majorNegInt
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+// The tags that Decode converts (see RFC 8949, section 3.4).
+const (
+	tagEpoch     = 1
+	tagBignum    = 2
+	tagNegBignum = 3
+	tagBase64    = 22
+	tagBase16    = 23
+)
+
+// The additional information of simple values and floats, and of
+// indefinite-length items.
+const (
+	simpleFalse   = 20
+	simpleTrue    = 21
+	simpleNull    = 22
+	simpleUndef   = 23
+	simpleFloat16 = 25
+	simpleFloat32 = 26
+	simpleFloat64 = 27
+	lengthIndef   = 31
+)
+
+// Decode converts a single CBOR data item to JSONata values,
+// following the conversion to JSON in RFC 8949, section 6.1:
+// maps become objects, arrays become arrays, and integers and
+// floating-point numbers become float64s. Byte strings become
+// base64url strings, or base64 or hex strings if they're tagged
+// as such (tags 22 and 23). Bignums become float64s, and other
+// tags are ignored. Undefined becomes null. Map keys must be
+// text strings or integers, and integer keys are converted to
+// decimal strings. Infinities and NaNs are errors because JSONata
+// has no such numbers, and so is data after the first item.
+func Decode(data []byte) (interface{}, error) {
+
+	d := &decoder{data: data}
+
+	v, err := d.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.off < len(d.data) {
+		return nil, d.errorf("%d bytes after the data item", len(d.data)-d.off)
+	}
+
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("cbor: offset %d: %w: %s", d.off, ErrInvalidData, fmt.Sprintf(format, a...))
+}
+
+// head reads the initial byte of a data item and its argument.
+// indef is true for the indefinite-length marker.
+func (d *decoder) head() (major int, info byte, arg uint64, indef bool, err error) {
+
+	if d.off >= len(d.data) {
+		return 0, 0, 0, false, d.errorf("unexpected end of data")
+	}
+
+	b := d.data[d.off]
+	d.off++
+
+	major, info = int(b>>5), b&0x1f
+
+	switch {
+	case info < 24:
+		return major, info, uint64(info), false, nil
+	case info <= 27:
+		n := 1 << (info - 24)
+		if len(d.data)-d.off < n {
+			return 0, 0, 0, false, d.errorf("unexpected end of data")
+		}
+		for _, c := range d.data[d.off : d.off+n] {
+			arg = arg<<8 | uint64(c)
+		}
+		d.off += n
+		return major, info, arg, false, nil
+	case info == lengthIndef && major >= majorBytes && major <= majorMap:
+		return major, info, 0, true, nil
+	case info == lengthIndef && major == majorSimple:
+		d.off--
+		return 0, 0, 0, false, d.errorf("unexpected break")
+	default:
+		return 0, 0, 0, false, d.errorf("invalid additional information %d", info)
+	}
+}
+
+// decode reads a data item. tag is the innermost tag that
+// applies to the item, or 0.
+func (d *decoder) decode(depth int, tag uint64) (interface{}, error) {
+
+	if depth > maxDepth {
+		return nil, d.errorf("data is nested too deeply")
+	}
+
+	start := d.off
+	major, info, arg, indef, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		return float64(arg), nil
+
+	case majorNegInt:
+		return -1 - float64(arg), nil
+
+	case majorBytes:
+		b, err := d.bytes(major, arg, indef)
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagBignum, tagNegBignum:
+			f, _ := new(big.Float).SetInt(new(big.Int).SetBytes(b)).Float64()
+			if tag == tagNegBignum {
+				f = -1 - f
+			}
+			if math.IsInf(f, 0) {
+				d.off = start
+				return nil, d.errorf("bignum is out of range")
+			}
+			return f, nil
+		case tagBase64:
+			return base64.StdEncoding.EncodeToString(b), nil
+		case tagBase16:
+			return hex.EncodeToString(b), nil
+		default:
+			return base64.RawURLEncoding.EncodeToString(b), nil
+		}
+
+	case majorText:
+		b, err := d.bytes(major, arg, indef)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			d.off = start
+			return nil, d.errorf("text string is not valid UTF-8")
+		}
+		return string(b), nil
+
+	case majorArray:
+		var items []interface{}
+		if !indef {
+			if arg > uint64(len(d.data)-d.off) {
+				return nil, d.errorf("array of %d items is longer than the data", arg)
+			}
+			items = make([]interface{}, 0, arg)
+		}
+		for i := uint64(0); indef || i < arg; i++ {
+			if indef && d.atBreak() {
+				break
+			}
+			v, err := d.decode(depth+1, 0)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		if items == nil {
+			items = []interface{}{}
+		}
+		return items, nil
+
+	case majorMap:
+		var m map[string]interface{}
+		if indef {
+			m = map[string]interface{}{}
+		} else {
+			if arg > uint64(len(d.data)-d.off)/2 {
+				return nil, d.errorf("map of %d pairs is longer than the data", arg)
+			}
+			m = make(map[string]interface{}, arg)
+		}
+		for i := uint64(0); indef || i < arg; i++ {
+			if indef && d.atBreak() {
+				break
+			}
+			key, err := d.key()
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(depth+1, 0)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		}
+		return m, nil
+
+	case majorTag:
+		v, err := d.decode(depth+1, arg)
+		if err != nil {
+			return nil, err
+		}
+		if arg == tagEpoch {
+			if _, ok := v.(float64); !ok {
+				d.off = start
+				return nil, d.errorf("epoch time is not a number")
+			}
+		}
+		return v, nil
+
+	default:
+		return d.simple(info, arg, start)
+	}
+}
+
+// simple converts a simple value or a floating-point number.
+func (d *decoder) simple(info byte, arg uint64, start int) (interface{}, error) {
+
+	var f float64
+
+	switch info {
+	case simpleFalse:
+		return false, nil
+	case simpleTrue:
+		return true, nil
+	case simpleNull, simpleUndef:
+		return nil, nil
+	case simpleFloat16:
+		f = float16(uint16(arg))
+	case simpleFloat32:
+		f = float64(math.Float32frombits(uint32(arg)))
+	case simpleFloat64:
+		f = math.Float64frombits(arg)
+	default:
+		d.off = start
+		return nil, d.errorf("unsupported simple value %d", arg)
+	}
+
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		d.off = start
+		return nil, d.errorf("%v is not a valid JSONata number", f)
+	}
+
+	return f, nil
+}
+
+// key reads a map key.
+func (d *decoder) key() (string, error) {
+
+	start := d.off
+	major, _, arg, indef, err := d.head()
+	if err != nil {
+		return "", err
+	}
+
+	switch major {
+	case majorText:
+		b, err := d.bytes(major, arg, indef)
+		if err != nil {
+			return "", err
+		}
+		if !utf8.Valid(b) {
+			d.off = start
+			return "", d.errorf("text string is not valid UTF-8")
+		}
+		return string(b), nil
+	case majorUint:
+		return strconv.FormatUint(arg, 10), nil
+	case majorNegInt:
+		return "-" + new(big.Int).Add(new(big.Int).SetUint64(arg), big.NewInt(1)).String(), nil
+	default:
+		d.off = start
+		return "", d.errorf("map keys must be text strings or integers")
+	}
+}
+
+// bytes reads the content of a byte or text string, joining the
+// chunks of an indefinite-length string.
+func (d *decoder) bytes(major int, n uint64, indef bool) ([]byte, error) {
+
+	if !indef {
+		if n > uint64(len(d.data)-d.off) {
+			return nil, d.errorf("string of %d bytes is longer than the data", n)
+		}
+		b := d.data[d.off : d.off+int(n)]
+		d.off += int(n)
+		return b, nil
+	}
+
+	var b []byte
+	for !d.atBreak() {
+		chunkMajor, _, n, indef, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || indef {
+			return nil, d.errorf("invalid chunk in an indefinite-length string")
+		}
+		chunk, err := d.bytes(major, n, false)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, chunk...)
+	}
+
+	return b, nil
+}
+
+// atBreak reads the break code that ends an indefinite-length
+// item, if it's next.
+func (d *decoder) atBreak() bool {
+	if d.off < len(d.data) && d.data[d.off] == 0xff {
+		d.off++
+		return true
+	}
+	return false
+}
+
+// float16 converts an IEEE 754 half-precision number.
+func float16(h uint16) float64 {
+
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		f = -f
+	}
+
+	return f
+}
@@ -0,0 +1,205 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jcbor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// maxSafeInteger is the largest integer that a float64 holds
+// exactly.
+const maxSafeInteger = 1 << 53
+
+// Encode writes a JSONata result, such as a value returned by
+// Expression.Eval, as a CBOR data item. Numbers that are
+// integers are written as CBOR integers, and other numbers as
+// 64-bit floats. Map keys are sorted as in RFC 8949's core
+// deterministic encoding, so equal values always have the same
+// encoding. Values that aren't JSON values, such as Go structs,
+// are encoded as encoding/json would encode them.
+func Encode(v interface{}) ([]byte, error) {
+
+	var e encoder
+	if err := e.encode(reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+// head writes the initial byte of a data item and its argument,
+// in the shortest form.
+func (e *encoder) head(major int, arg uint64) {
+
+	b := byte(major << 5)
+
+	switch {
+	case arg < 24:
+		e.buf.WriteByte(b | byte(arg))
+	case arg <= math.MaxUint8:
+		e.buf.Write([]byte{b | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		e.buf.Write([]byte{b | 25, byte(arg >> 8), byte(arg)})
+	case arg <= math.MaxUint32:
+		e.buf.Write([]byte{b | 26, byte(arg >> 24), byte(arg >> 16), byte(arg >> 8), byte(arg)})
+	default:
+		e.buf.WriteByte(b | 27)
+		for shift := 56; shift >= 0; shift -= 8 {
+			e.buf.WriteByte(byte(arg >> uint(shift)))
+		}
+	}
+}
+
+func (e *encoder) int(n int64) {
+	if n < 0 {
+		e.head(majorNegInt, uint64(-1-n))
+		return
+	}
+	e.head(majorUint, uint64(n))
+}
+
+func (e *encoder) float(f float64) error {
+
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("cbor: cannot encode %v", f)
+	}
+
+	if f == math.Trunc(f) && math.Abs(f) <= maxSafeInteger {
+		e.int(int64(f))
+		return nil
+	}
+
+	e.buf.WriteByte(majorSimple<<5 | simpleFloat64)
+	bits := math.Float64bits(f)
+	for shift := 56; shift >= 0; shift -= 8 {
+		e.buf.WriteByte(byte(bits >> uint(shift)))
+	}
+
+	return nil
+}
+
+func (e *encoder) encode(v reflect.Value, depth int) error {
+
+	if depth > maxDepth {
+		return fmt.Errorf("cbor: value is nested too deeply")
+	}
+
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			v = reflect.Value{}
+			break
+		}
+		if v.Type().Implements(jsonMarshalerType) {
+			return e.encodeJSON(v, depth)
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		e.buf.WriteByte(majorSimple<<5 | simpleNull)
+		return nil
+	}
+
+	if v.Type().Implements(jsonMarshalerType) || (v.CanAddr() && reflect.PtrTo(v.Type()).Implements(jsonMarshalerType)) {
+		return e.encodeJSON(v, depth)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b := byte(simpleFalse)
+		if v.Bool() {
+			b = simpleTrue
+		}
+		e.buf.WriteByte(majorSimple<<5 | b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.head(majorUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return e.float(v.Float())
+	case reflect.String:
+		e.head(majorText, uint64(v.Len()))
+		e.buf.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			e.head(majorBytes, uint64(v.Len()))
+			e.buf.Write(v.Bytes())
+			return nil
+		}
+		e.head(majorArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return e.encodeJSON(v, depth)
+		}
+		return e.encodeMap(v, depth)
+	default:
+		return e.encodeJSON(v, depth)
+	}
+
+	return nil
+}
+
+// encodeMap writes a map with string keys. The pairs are sorted
+// by the bytewise order of their encoded keys, which for text
+// strings means shorter keys first.
+func (e *encoder) encodeMap(v reflect.Value, depth int) error {
+
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i].String(), keys[j].String()
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+
+	e.head(majorMap, uint64(len(keys)))
+	for _, key := range keys {
+		e.head(majorText, uint64(key.Len()))
+		e.buf.WriteString(key.String())
+		if err := e.encode(v.MapIndex(key), depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// encodeJSON writes a value that isn't a JSON value as its JSON
+// encoding would decode.
+func (e *encoder) encodeJSON(v reflect.Value, depth int) error {
+
+	if !v.CanInterface() {
+		return fmt.Errorf("cbor: cannot encode unexported value of type %s", v.Type())
+	}
+
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Errorf("cbor: %w", err)
+	}
+
+	var x interface{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		return fmt.Errorf("cbor: %w", err)
+	}
+
+	return e.encode(reflect.ValueOf(x), depth+1)
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jcbor evaluates JSONata expressions over CBOR (RFC
+// 8949) payloads. Decode converts a data item directly to the
+// values that JSONata works with, and Encode writes a result
+// back out as CBOR, so a payload never passes through JSON:
+//
+//	msg := <-readings
+//	out, err := jcbor.Eval(ctx, expr, msg, nil)
+//
+// The conversions follow RFC 8949's advice for converting CBOR
+// to JSON (see Decode). jcbor has no dependencies outside the
+// standard library.
+package jcbor
+
+import (
+	"context"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+// Eval decodes a CBOR data item, evaluates e against it and
+// returns the result as CBOR. Like EvalContext, it returns
+// jsonata.ErrUndefined if the expression evaluates to undefined.
+func Eval(ctx context.Context, e *jsonata.Expression, data []byte, vars map[string]interface{}) ([]byte, error) {
+
+	v, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.EvalContext(ctx, v, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return Encode(res)
+}
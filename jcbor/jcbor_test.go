@@ -0,0 +1,179 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jcbor
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+func TestDecode(t *testing.T) {
+
+	// Most of these are from RFC 8949, appendix A.
+	for _, test := range []struct {
+		Hex   string
+		Value interface{}
+	}{
+		{"00", 0.0},
+		{"17", 23.0},
+		{"1903e8", 1000.0},
+		{"1bffffffffffffffff", 18446744073709551615.0},
+		{"c249010000000000000000", 18446744073709551616.0},
+		{"3bffffffffffffffff", -18446744073709551616.0},
+		{"c349010000000000000000", -18446744073709551617.0},
+		{"3903e7", -1000.0},
+		{"f93c00", 1.0},
+		{"f93e00", 1.5},
+		{"f97bff", 65504.0},
+		{"f90001", 5.960464477539063e-8},
+		{"f9c400", -4.0},
+		{"fa47c35000", 100000.0},
+		{"fb3ff199999999999a", 1.1},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f7", nil},
+		{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+		{"c11a514b67b0", 1363896240.0},
+		{"d74401020304", "01020304"},
+		{"d6420102", "AQI="},
+		{"43fffefd", "__79"},
+		{"6449455446", "IETF"},
+		{"62c3bc", "ü"},
+		{"80", []interface{}{}},
+		{"8301820203820405", []interface{}{1.0, []interface{}{2.0, 3.0}, []interface{}{4.0, 5.0}}},
+		{"a0", map[string]interface{}{}},
+		{"a201020304", map[string]interface{}{"1": 2.0, "3": 4.0}},
+		{"a26161016162820203", map[string]interface{}{"a": 1.0, "b": []interface{}{2.0, 3.0}}},
+		{"5f42010243030405ff", "AQIDBAU"},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"9f018202039f0405ffff", []interface{}{1.0, []interface{}{2.0, 3.0}, []interface{}{4.0, 5.0}}},
+		{"9fff", []interface{}{}},
+		{"bf61610161629f0203ffff", map[string]interface{}{"a": 1.0, "b": []interface{}{2.0, 3.0}}},
+		{"a120f5", map[string]interface{}{"-1": true}},
+	} {
+		got, err := Decode(mustHex(test.Hex))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.Value) {
+			t.Errorf("%s: expected %#v, got %#v", test.Hex, test.Value, got)
+		}
+	}
+
+	for _, hx := range []string{
+		"",
+		"18",
+		"0000",
+		"1c",
+		"ff",
+		"f97c00",
+		"f97e00",
+		"fa7f800000",
+		"fbfff0000000000000",
+		"f0",
+		"62c3",
+		"62c328",
+		"9b00000000ffffffff",
+		"a1800102",
+		"5f6161ff",
+		"9f01",
+		"c16161",
+	} {
+		if _, err := Decode(mustHex(hx)); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("%q: expected ErrInvalidData, got %v", hx, err)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+
+	type point struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+
+	for _, test := range []struct {
+		Value interface{}
+		Hex   string
+	}{
+		{nil, "f6"},
+		{true, "f5"},
+		{0.0, "00"},
+		{23.0, "17"},
+		{1000000.0, "1a000f4240"},
+		{-1000.0, "3903e7"},
+		{1.1, "fb3ff199999999999a"},
+		{1e300, "fb7e37e43c8800759c"},
+		{42, "182a"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{"IETF", "6449455446"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]interface{}{1.0, []interface{}{2.0, 3.0}}, "8201820203"},
+		{map[string]interface{}{"b": 2.0, "aa": 3.0, "a": 1.0}, "a361610161620262616103"},
+		{point{1, 2}, "a2617801617902"},
+	} {
+		got, err := Encode(test.Value)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.Value, err)
+			continue
+		}
+		if want := mustHex(test.Hex); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: expected %x, got %x", test.Value, want, got)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	// {"device": "t1", "readings": [21.5, 22.5, 23]}
+	msg, err := Encode(map[string]interface{}{
+		"device":   "t1",
+		"readings": []interface{}{21.5, 22.5, 23.0},
+	})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	e := comp.MustCompile(`{"device": device, "n": $count(readings), "max": $max(readings)}`)
+
+	out, err := Eval(context.Background(), e, msg, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	got, err := Decode(out)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	want := map[string]interface{}{"device": "t1", "n": 3.0, "max": 23.0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, err := Eval(context.Background(), comp.MustCompile(`nothing`), msg, nil); err != jsonata.ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,305 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jgrpc serves JSONata over gRPC, so that services
+// written in other languages can use jsonata-go as a sidecar.
+// The service, jsonata.v1.JSONata, is defined in
+// jsonatapb/jsonata.proto, and clients in any language can be
+// generated from it:
+//
+//	srv, err := jgrpc.NewServer(nil)
+//	gs := grpc.NewServer()
+//	srv.Register(gs)
+//	gs.Serve(lis)
+//
+// Register also registers the standard gRPC health service
+// (grpc.health.v1.Health), which reports the JSONata service as
+// serving until SetServing(false) is called.
+//
+// Documents, variables and results are JSON text. Limits on the
+// expressions themselves, such as their length and the size of
+// the values that they build, are set by the Compiler's options
+// (see jsonata.WithCompileLimits and jsonata.WithSizeLimits).
+//
+// jgrpc is a separate module so that jsonata-go itself doesn't
+// depend on gRPC.
+package jgrpc
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/jgrpc/jsonatapb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the full name of the JSONata service, as
+// reported by the health service.
+const ServiceName = "jsonata.v1.JSONata"
+
+// Defaults for the Options.
+const (
+	DefaultMaxDocumentSize = 10 << 20
+	DefaultCacheSize       = 1000
+)
+
+// Options configure a Server.
+type Options struct {
+	// Compiler compiles the expressions. If it's nil, the
+	// Server uses a Compiler with only the built-in functions.
+	Compiler *jsonata.Compiler
+
+	// MaxDocumentSize is the maximum length in bytes of an
+	// Eval request's document, and of its variables. Longer
+	// ones are rejected with RESOURCE_EXHAUSTED. Zero means
+	// DefaultMaxDocumentSize.
+	MaxDocumentSize int
+
+	// Timeout, if it's positive, is the longest time that an
+	// Eval request can take. The client's deadline applies if
+	// it's sooner. A request that runs out of time fails with
+	// DEADLINE_EXCEEDED, but its evaluation only stops early
+	// if it calls extensions that watch the context, such as
+	// asynchronous ones. Use the Compiler's size limits to
+	// bound the work that an expression can do.
+	Timeout time.Duration
+
+	// CacheSize is the number of compiled expressions that
+	// are kept for reuse, with the least recently used ones
+	// dropped first. Zero means DefaultCacheSize.
+	CacheSize int
+}
+
+// A Server implements the JSONata service. It's safe for
+// concurrent use.
+type Server struct {
+	jsonatapb.UnimplementedJSONataServer
+
+	comp      *jsonata.Compiler
+	maxDoc    int
+	timeout   time.Duration
+	cacheSize int
+	health    *health.Server
+
+	mu    sync.Mutex
+	lru   *list.List
+	cache map[string]*list.Element
+}
+
+type cacheEntry struct {
+	src  string
+	expr *jsonata.Expression
+}
+
+// NewServer returns a Server with the given options, which may
+// be nil.
+func NewServer(opts *Options) (*Server, error) {
+
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.MaxDocumentSize < 0 || opts.CacheSize < 0 {
+		return nil, fmt.Errorf("jgrpc: invalid options %+v", *opts)
+	}
+
+	s := &Server{
+		comp:      opts.Compiler,
+		maxDoc:    opts.MaxDocumentSize,
+		timeout:   opts.Timeout,
+		cacheSize: opts.CacheSize,
+		health:    health.NewServer(),
+		lru:       list.New(),
+		cache:     map[string]*list.Element{},
+	}
+
+	if s.comp == nil {
+		comp, err := jsonata.NewCompiler(nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		s.comp = comp
+	}
+	if s.maxDoc == 0 {
+		s.maxDoc = DefaultMaxDocumentSize
+	}
+	if s.cacheSize == 0 {
+		s.cacheSize = DefaultCacheSize
+	}
+
+	s.SetServing(true)
+
+	return s, nil
+}
+
+// Register registers the JSONata service and the health service
+// with gs.
+func (s *Server) Register(gs *grpc.Server) {
+	jsonatapb.RegisterJSONataServer(gs, s)
+	healthpb.RegisterHealthServer(gs, s.health)
+}
+
+// SetServing sets the status that the health service reports,
+// e.g. to false while the server drains before it stops.
+func (s *Server) SetServing(serving bool) {
+
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+
+	s.health.SetServingStatus("", st)
+	s.health.SetServingStatus(ServiceName, st)
+}
+
+// Compile compiles an expression and caches it.
+func (s *Server) Compile(ctx context.Context, req *jsonatapb.CompileRequest) (*jsonatapb.CompileResponse, error) {
+
+	if _, err := s.compile(req.GetExpression()); err != nil {
+		return nil, err
+	}
+
+	return &jsonatapb.CompileResponse{}, nil
+}
+
+// Eval evaluates an expression against a document.
+func (s *Server) Eval(ctx context.Context, req *jsonatapb.EvalRequest) (*jsonatapb.EvalResponse, error) {
+
+	if len(req.GetDocument()) > s.maxDoc || len(req.GetVariables()) > s.maxDoc {
+		return nil, status.Errorf(codes.ResourceExhausted, "the document or variables are longer than the limit of %d bytes", s.maxDoc)
+	}
+
+	e, err := s.compile(req.GetExpression())
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+	if doc := req.GetDocument(); doc != "" {
+		if err := json.Unmarshal([]byte(doc), &data); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid document: %v", err)
+		}
+	}
+
+	var vars map[string]interface{}
+	if v := req.GetVariables(); v != "" {
+		if err := json.Unmarshal([]byte(v), &vars); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid variables: %v", err)
+		}
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	res, err := evalContext(ctx, e, data, vars)
+	if err == jsonata.ErrUndefined {
+		return &jsonatapb.EvalResponse{Undefined: true}, nil
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot encode the result: %v", err)
+	}
+
+	return &jsonatapb.EvalResponse{Result: string(b)}, nil
+}
+
+// evalContext is like e.EvalContext except that it returns
+// ctx's error as soon as ctx is done. Evaluation only stops
+// early for extensions that watch the context, so otherwise it
+// carries on in the background until it ends.
+func evalContext(ctx context.Context, e *jsonata.Expression, data interface{}, vars map[string]interface{}) (interface{}, error) {
+
+	type result struct {
+		v   interface{}
+		err error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		v, err := e.EvalContext(ctx, data, vars)
+		ch <- result{v, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.v, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// compile returns the compiled expression for src, from the
+// cache if possible.
+func (s *Server) compile(src string) (*jsonata.Expression, error) {
+
+	s.mu.Lock()
+	if el, ok := s.cache[src]; ok {
+		s.lru.MoveToFront(el)
+		s.mu.Unlock()
+		return el.Value.(*cacheEntry).expr, nil
+	}
+	s.mu.Unlock()
+
+	e, err := s.comp.Compile(src)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.cache[src]; ok {
+		s.lru.MoveToFront(el)
+		return el.Value.(*cacheEntry).expr, nil
+	}
+
+	s.cache[src] = s.lru.PushFront(&cacheEntry{src: src, expr: e})
+	for s.lru.Len() > s.cacheSize {
+		el := s.lru.Back()
+		s.lru.Remove(el)
+		delete(s.cache, el.Value.(*cacheEntry).src)
+	}
+
+	return e, nil
+}
+
+// statusError converts an error from compiling or evaluating an
+// expression to a gRPC status error.
+func statusError(err error) error {
+
+	var evalErr *jsonata.EvalError
+	var limitErr *jsonata.CompileLimitError
+
+	code := codes.InvalidArgument
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.As(err, &limitErr):
+		code = codes.ResourceExhausted
+	case errors.As(err, &evalErr) && evalErr.Type == jsonata.ErrResultTooLarge:
+		code = codes.ResourceExhausted
+	}
+
+	return status.Error(code, err.Error())
+}
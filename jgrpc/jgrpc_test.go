@@ -0,0 +1,188 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jgrpc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/jgrpc/jsonatapb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial starts a gRPC server for srv and returns a connection to
+// it.
+func dial(t *testing.T, srv *Server) *grpc.ClientConn {
+
+	lis := bufconn.Listen(1 << 20)
+
+	gs := grpc.NewServer()
+	srv.Register(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestEval(t *testing.T) {
+
+	srv, err := NewServer(nil)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	client := jsonatapb.NewJSONataClient(dial(t, srv))
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		Req       *jsonatapb.EvalRequest
+		Result    string
+		Undefined bool
+	}{
+		{
+			Req: &jsonatapb.EvalRequest{
+				Expression: `$sum(orders.(price * qty)) * $rate`,
+				Document:   `{"orders": [{"price": 5, "qty": 2}, {"price": 1.5, "qty": 4}]}`,
+				Variables:  `{"rate": 2}`,
+			},
+			Result: "32",
+		},
+		{
+			Req:    &jsonatapb.EvalRequest{Expression: `[1..3].($ * 2)`},
+			Result: `[2,4,6]`,
+		},
+		{
+			Req:       &jsonatapb.EvalRequest{Expression: `missing`, Document: `{}`},
+			Undefined: true,
+		},
+	} {
+		resp, err := client.Eval(ctx, test.Req)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Req.Expression, err)
+			continue
+		}
+		if resp.Result != test.Result || resp.Undefined != test.Undefined {
+			t.Errorf("%s: expected %q (undefined %t), got %q (undefined %t)", test.Req.Expression, test.Result, test.Undefined, resp.Result, resp.Undefined)
+		}
+	}
+
+	if _, err := client.Compile(ctx, &jsonatapb.CompileRequest{Expression: `a.b`}); err != nil {
+		t.Errorf("Compile failed: %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+
+	exts := map[string]jsonata.Extension{
+		"sleep": {Func: func(ms int) bool {
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			return true
+		}},
+	}
+
+	comp, err := jsonata.NewCompiler(nil, exts,
+		jsonata.WithCompileLimits(jsonata.CompileLimits{Length: 50}),
+		jsonata.WithSizeLimits(jsonata.SizeLimits{Items: 100}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	srv, err := NewServer(&Options{
+		Compiler:        comp,
+		MaxDocumentSize: 100,
+		Timeout:         50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	client := jsonatapb.NewJSONataClient(dial(t, srv))
+	ctx := context.Background()
+
+	if _, err := client.Compile(ctx, &jsonatapb.CompileRequest{Expression: `a +`}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Compile: expected INVALID_ARGUMENT, got %v", err)
+	}
+
+	for _, test := range []struct {
+		Req  *jsonatapb.EvalRequest
+		Code codes.Code
+	}{
+		{&jsonatapb.EvalRequest{Expression: `a +`}, codes.InvalidArgument},
+		{&jsonatapb.EvalRequest{Expression: `a`, Document: `{`}, codes.InvalidArgument},
+		{&jsonatapb.EvalRequest{Expression: `a`, Variables: `[1]`}, codes.InvalidArgument},
+		{&jsonatapb.EvalRequest{Expression: `"a" + 1`}, codes.InvalidArgument},
+		{&jsonatapb.EvalRequest{Expression: strings.Repeat("a.", 30) + "a"}, codes.ResourceExhausted},
+		{&jsonatapb.EvalRequest{Expression: `[1..1000]`}, codes.ResourceExhausted},
+		{&jsonatapb.EvalRequest{Expression: `a`, Document: `"` + strings.Repeat("x", 100) + `"`}, codes.ResourceExhausted},
+		{&jsonatapb.EvalRequest{Expression: `$sleep(1000)`}, codes.DeadlineExceeded},
+	} {
+		if _, err := client.Eval(ctx, test.Req); status.Code(err) != test.Code {
+			t.Errorf("%s: expected %v, got %v", test.Req.Expression, test.Code, err)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+
+	srv, err := NewServer(&Options{CacheSize: 2})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	for _, src := range []string{"a", "b", "a", "c"} {
+		if _, err := srv.compile(src); err != nil {
+			t.Fatalf("compile failed: %v", err)
+		}
+	}
+
+	if _, ok := srv.cache["b"]; ok || len(srv.cache) != 2 {
+		t.Errorf("expected a and c to be cached, got %d expressions", len(srv.cache))
+	}
+}
+
+func TestHealth(t *testing.T) {
+
+	srv, err := NewServer(nil)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	client := healthpb.NewHealthClient(dial(t, srv))
+	ctx := context.Background()
+
+	check := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: ServiceName})
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		if resp.Status != want {
+			t.Errorf("expected %v, got %v", want, resp.Status)
+		}
+	}
+
+	check(healthpb.HealthCheckResponse_SERVING)
+	srv.SetServing(false)
+	check(healthpb.HealthCheckResponse_NOT_SERVING)
+}
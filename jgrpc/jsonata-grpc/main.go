@@ -0,0 +1,68 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// jsonata-grpc serves the JSONata gRPC service (see package
+// jgrpc), e.g. as a sidecar for services in other languages.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/jgrpc"
+	"google.golang.org/grpc"
+)
+
+func main() {
+
+	port := flag.Uint("port", 50051, "The port `number` to serve on")
+	timeout := flag.Duration("timeout", 0, "The maximum `duration` of an evaluation, e.g. 2s")
+	maxDoc := flag.Int("max-document-size", jgrpc.DefaultMaxDocumentSize, "The maximum size of a document in `bytes`")
+	maxExpr := flag.Int("max-expression-length", 0, "The maximum length of an expression in `bytes`")
+	maxItems := flag.Int("max-items", 0, "The maximum `number` of items in an array or object built by an expression")
+	flag.Parse()
+
+	comp, err := jsonata.NewCompiler(nil, nil,
+		jsonata.WithCompileLimits(jsonata.CompileLimits{Length: *maxExpr}),
+		jsonata.WithSizeLimits(jsonata.SizeLimits{Items: *maxItems}))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv, err := jgrpc.NewServer(&jgrpc.Options{
+		Compiler:        comp,
+		MaxDocumentSize: *maxDoc,
+		Timeout:         *timeout,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gs := grpc.NewServer()
+	srv.Register(gs)
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		srv.SetServing(false)
+		gs.GracefulStop()
+	}()
+
+	log.Printf("Starting JSONata gRPC server on port %d\n", *port)
+	if err := gs.Serve(lis); err != nil {
+		log.Fatal(err)
+	}
+}
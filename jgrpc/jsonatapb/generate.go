@@ -0,0 +1,9 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jsonatapb holds the Go code generated from
+// jsonata.proto, the definition of the JSONata gRPC service.
+package jsonatapb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative jsonata.proto
@@ -0,0 +1,176 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: jsonata.proto
+
+package jsonatapb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	JSONata_Compile_FullMethodName = "/jsonata.v1.JSONata/Compile"
+	JSONata_Eval_FullMethodName    = "/jsonata.v1.JSONata/Eval"
+)
+
+// JSONataClient is the client API for JSONata service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// JSONata compiles and evaluates JSONata expressions.
+//
+// Errors are reported with gRPC status codes:
+// INVALID_ARGUMENT for expressions that don't compile, malformed
+// documents and variables, and failed evaluations;
+// RESOURCE_EXHAUSTED for requests over the server's limits; and
+// DEADLINE_EXCEEDED for evaluations that take longer than the
+// server's or the client's deadline.
+type JSONataClient interface {
+	// Compile checks that an expression compiles, and keeps the
+	// compiled expression for later Eval requests.
+	Compile(ctx context.Context, in *CompileRequest, opts ...grpc.CallOption) (*CompileResponse, error)
+	// Eval evaluates an expression against a JSON document.
+	Eval(ctx context.Context, in *EvalRequest, opts ...grpc.CallOption) (*EvalResponse, error)
+}
+
+type jSONataClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewJSONataClient(cc grpc.ClientConnInterface) JSONataClient {
+	return &jSONataClient{cc}
+}
+
+func (c *jSONataClient) Compile(ctx context.Context, in *CompileRequest, opts ...grpc.CallOption) (*CompileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CompileResponse)
+	err := c.cc.Invoke(ctx, JSONata_Compile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *jSONataClient) Eval(ctx context.Context, in *EvalRequest, opts ...grpc.CallOption) (*EvalResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EvalResponse)
+	err := c.cc.Invoke(ctx, JSONata_Eval_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// JSONataServer is the server API for JSONata service.
+// All implementations must embed UnimplementedJSONataServer
+// for forward compatibility
+//
+// JSONata compiles and evaluates JSONata expressions.
+//
+// Errors are reported with gRPC status codes:
+// INVALID_ARGUMENT for expressions that don't compile, malformed
+// documents and variables, and failed evaluations;
+// RESOURCE_EXHAUSTED for requests over the server's limits; and
+// DEADLINE_EXCEEDED for evaluations that take longer than the
+// server's or the client's deadline.
+type JSONataServer interface {
+	// Compile checks that an expression compiles, and keeps the
+	// compiled expression for later Eval requests.
+	Compile(context.Context, *CompileRequest) (*CompileResponse, error)
+	// Eval evaluates an expression against a JSON document.
+	Eval(context.Context, *EvalRequest) (*EvalResponse, error)
+	mustEmbedUnimplementedJSONataServer()
+}
+
+// UnimplementedJSONataServer must be embedded to have forward compatible implementations.
+type UnimplementedJSONataServer struct {
+}
+
+func (UnimplementedJSONataServer) Compile(context.Context, *CompileRequest) (*CompileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Compile not implemented")
+}
+func (UnimplementedJSONataServer) Eval(context.Context, *EvalRequest) (*EvalResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Eval not implemented")
+}
+func (UnimplementedJSONataServer) mustEmbedUnimplementedJSONataServer() {}
+
+// UnsafeJSONataServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to JSONataServer will
+// result in compilation errors.
+type UnsafeJSONataServer interface {
+	mustEmbedUnimplementedJSONataServer()
+}
+
+func RegisterJSONataServer(s grpc.ServiceRegistrar, srv JSONataServer) {
+	s.RegisterService(&JSONata_ServiceDesc, srv)
+}
+
+func _JSONata_Compile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JSONataServer).Compile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: JSONata_Compile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JSONataServer).Compile(ctx, req.(*CompileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _JSONata_Eval_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EvalRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JSONataServer).Eval(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: JSONata_Eval_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JSONataServer).Eval(ctx, req.(*EvalRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// JSONata_ServiceDesc is the grpc.ServiceDesc for JSONata service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var JSONata_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "jsonata.v1.JSONata",
+	HandlerType: (*JSONataServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Compile",
+			Handler:    _JSONata_Compile_Handler,
+		},
+		{
+			MethodName: "Eval",
+			Handler:    _JSONata_Eval_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "jsonata.proto",
+}
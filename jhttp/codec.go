@@ -0,0 +1,145 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jhttp
+
+import (
+	"encoding/json"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iwongu/jsonata-go/jcbor"
+	"github.com/iwongu/jsonata-go/jmsgpack"
+	"github.com/iwongu/jsonata-go/jxml"
+)
+
+// A codec converts between a media type and JSONata values.
+// Formats that can only be read, such as XML, have no encode
+// function.
+type codec struct {
+	mediaType string
+	decode    func([]byte) (interface{}, error)
+	encode    func(interface{}) ([]byte, error)
+}
+
+var jsonCodec = &codec{
+	mediaType: "application/json",
+	decode: func(b []byte) (interface{}, error) {
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	},
+	encode: json.Marshal,
+}
+
+var cborCodec = &codec{
+	mediaType: "application/cbor",
+	decode:    jcbor.Decode,
+	encode:    jcbor.Encode,
+}
+
+var msgpackCodec = &codec{
+	mediaType: "application/msgpack",
+	decode:    jmsgpack.Decode,
+	encode:    jmsgpack.Encode,
+}
+
+var xmlCodec = &codec{
+	mediaType: "application/xml",
+	decode:    jxml.Decode,
+}
+
+// codecs maps the media types that are understood to their
+// codecs. Types with the suffix +json or +xml are looked up by
+// their suffix.
+var codecs = map[string]*codec{
+	"application/json":        jsonCodec,
+	"application/cbor":        cborCodec,
+	"application/msgpack":     msgpackCodec,
+	"application/x-msgpack":   msgpackCodec,
+	"application/vnd.msgpack": msgpackCodec,
+	"application/xml":         xmlCodec,
+	"text/xml":                xmlCodec,
+}
+
+// codecFor returns the codec for a Content-Type header, or nil
+// if the type isn't understood.
+func codecFor(contentType string) *codec {
+
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	if c, ok := codecs[mt]; ok {
+		return c
+	}
+
+	switch {
+	case strings.HasSuffix(mt, "+json"):
+		return jsonCodec
+	case strings.HasSuffix(mt, "+xml"):
+		return xmlCodec
+	default:
+		return nil
+	}
+}
+
+// negotiate returns the codec to write a response with, given
+// the request's Accept header. A wildcard selects def. It
+// returns nil if none of the acceptable types can be written.
+func negotiate(accept string, def *codec) *codec {
+
+	if strings.TrimSpace(accept) == "" {
+		return def
+	}
+
+	type mediaRange struct {
+		typ string
+		q   float64
+	}
+
+	var ranges []mediaRange
+
+	for _, s := range strings.Split(accept, ",") {
+
+		mt, params, err := mime.ParseMediaType(s)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, mediaRange{mt, q})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, r := range ranges {
+
+		if r.typ == "*/*" || r.typ == strings.SplitN(def.mediaType, "/", 2)[0]+"/*" {
+			return def
+		}
+
+		if c := codecFor(r.typ); c != nil && c.encode != nil {
+			return c
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,416 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jhttp transforms the bodies of HTTP requests and
+// responses with JSONata expressions. Wrapping a handler in a
+// Handler makes a facade in front of an existing API, without
+// changing the API itself:
+//
+//	h := jhttp.NewHandler(api,
+//	    jhttp.WithRequest(comp.MustCompile(`{"name": fullName}`)),
+//	    jhttp.WithResponse(comp.MustCompile(`{"id": user.id, "name": user.name}`)))
+//
+// Bodies can be JSON, CBOR or MessagePack, and request bodies
+// can also be XML (see NewHandler). jhttp has no dependencies
+// outside the standard library.
+package jhttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+// DefaultMaxBodySize is the largest request or response body
+// that a Handler reads, unless it's changed by WithMaxBodySize.
+const DefaultMaxBodySize = 10 << 20
+
+// An Error is a failure to transform a request or a response.
+// It's passed to the Handler's error handler.
+type Error struct {
+	// Status is the HTTP status code of the error:
+	//
+	//	400 Bad Request: the request body is malformed.
+	//	406 Not Acceptable: none of the types in the request's
+	//	    Accept header can be written.
+	//	413 Request Entity Too Large: the request body is
+	//	    larger than the maximum body size.
+	//	415 Unsupported Media Type: the request body's
+	//	    Content-Type isn't understood.
+	//	422 Unprocessable Entity: the request expression
+	//	    failed.
+	//	500 Internal Server Error: a result can't be encoded.
+	//	502 Bad Gateway: the wrapped handler's response body
+	//	    is malformed or too large, or the response
+	//	    expression failed.
+	Status int
+
+	// Response is true if the error occurred while
+	// transforming the response, and false for the request.
+	Response bool
+
+	Err error
+}
+
+func (e *Error) Error() string {
+
+	what := "request"
+	if e.Response {
+		what = "response"
+	}
+
+	return fmt.Sprintf("jhttp: %s: %s", what, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// An Option configures a Handler.
+type Option func(*Handler)
+
+// WithRequest transforms request bodies with e before they're
+// passed to the wrapped handler.
+func WithRequest(e *jsonata.Expression) Option {
+	return func(h *Handler) {
+		h.request = e
+	}
+}
+
+// WithResponse transforms the bodies of the wrapped handler's
+// successful (2xx) responses with e.
+func WithResponse(e *jsonata.Expression) Option {
+	return func(h *Handler) {
+		h.response = e
+	}
+}
+
+// WithVars sets the variables of the expressions for a request,
+// e.g. its path or query parameters.
+func WithVars(fn func(r *http.Request) map[string]interface{}) Option {
+	return func(h *Handler) {
+		h.vars = fn
+	}
+}
+
+// WithErrorHandler replaces the function that writes errors,
+// which by default writes the Error's message as plain text with
+// its status code. err is always an *Error.
+func WithErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) Option {
+	return func(h *Handler) {
+		h.onError = fn
+	}
+}
+
+// WithMaxBodySize changes the largest body that a Handler reads
+// from DefaultMaxBodySize to n bytes.
+func WithMaxBodySize(n int64) Option {
+	return func(h *Handler) {
+		h.maxBody = n
+	}
+}
+
+// A Handler is an http.Handler that transforms requests and
+// responses on their way to and from another handler.
+type Handler struct {
+	next     http.Handler
+	request  *jsonata.Expression
+	response *jsonata.Expression
+	vars     func(*http.Request) map[string]interface{}
+	onError  func(http.ResponseWriter, *http.Request, error)
+	maxBody  int64
+}
+
+// NewHandler returns a Handler that wraps next.
+//
+// A request body is decoded according to its Content-Type,
+// which can be JSON (including types with the suffix +json),
+// CBOR (application/cbor), MessagePack (application/msgpack or
+// application/x-msgpack) or XML (application/xml, text/xml or a
+// type with the suffix +xml, mapped as jxml.Decode does). The
+// result of the request expression replaces the body in the
+// same format, except that XML bodies are replaced with JSON. If
+// the expression evaluates to undefined, next gets an empty body.
+// Requests without a body are passed on as they are.
+//
+// A successful response body is decoded in the same way. The
+// result of the response expression is written in the format
+// that the request's Accept header asks for, or in the
+// response's format if it accepts any type, or as JSON for
+// XML responses. If the expression evaluates to undefined, the
+// response is 204 No Content. Other responses, responses
+// without a body, and compressed responses or responses in
+// other formats are written as they are.
+//
+// If there's a response expression, the wrapped handler's
+// response is buffered, so it can't stream or hijack the
+// connection.
+func NewHandler(next http.Handler, opts ...Option) *Handler {
+
+	h := &Handler{
+		next:    next,
+		onError: writeError,
+		maxBody: DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+
+	status := http.StatusInternalServerError
+
+	var e *Error
+	if errors.As(err, &e) {
+		status = e.Status
+	}
+
+	http.Error(w, err.Error(), status)
+}
+
+// ServeHTTP transforms r, passes it to the wrapped handler and
+// transforms the response.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	var vars map[string]interface{}
+	if h.vars != nil {
+		vars = h.vars(r)
+	}
+
+	if h.request != nil {
+		var err *Error
+		if r, err = h.transformRequest(r, vars); err != nil {
+			h.onError(w, r, err)
+			return
+		}
+	}
+
+	if h.response == nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	rec := &recorder{
+		header: http.Header{},
+		status: http.StatusOK,
+	}
+	h.next.ServeHTTP(rec, r)
+
+	if err := h.transformResponse(w, r, rec, vars); err != nil {
+		h.onError(w, r, err)
+	}
+}
+
+func (h *Handler) transformRequest(r *http.Request, vars map[string]interface{}) (*http.Request, *Error) {
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return r, nil
+	}
+
+	body, err := readBody(r.Body, h.maxBody)
+	r.Body.Close()
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == errTooLarge {
+			status = http.StatusRequestEntityTooLarge
+		}
+		return r, &Error{Status: status, Err: err}
+	}
+
+	r2 := r.Clone(r.Context())
+
+	if len(body) == 0 {
+		r2.Body = http.NoBody
+		return r2, nil
+	}
+
+	c := codecFor(r.Header.Get("Content-Type"))
+	if c == nil {
+		return r, &Error{
+			Status: http.StatusUnsupportedMediaType,
+			Err:    fmt.Errorf("unsupported content type %q", r.Header.Get("Content-Type")),
+		}
+	}
+
+	out, err := transform(r.Context(), h.request, c, body, vars)
+	if err != nil && err != jsonata.ErrUndefined {
+		return r, err.(*Error)
+	}
+
+	r2.Header.Del("Content-Length")
+	r2.ContentLength = int64(len(out))
+
+	if len(out) == 0 {
+		r2.Header.Del("Content-Type")
+		r2.Body = http.NoBody
+	} else {
+		if c.encode == nil {
+			r2.Header.Set("Content-Type", jsonCodec.mediaType)
+		}
+		r2.Body = io.NopCloser(bytes.NewReader(out))
+	}
+
+	return r2, nil
+}
+
+func (h *Handler) transformResponse(w http.ResponseWriter, r *http.Request, rec *recorder, vars map[string]interface{}) *Error {
+
+	c := codecFor(rec.header.Get("Content-Type"))
+
+	if rec.status/100 != 2 || rec.body.Len() == 0 || c == nil || isEncoded(rec.header) {
+		rec.writeTo(w)
+		return nil
+	}
+
+	if int64(rec.body.Len()) > h.maxBody {
+		return &Error{Status: http.StatusBadGateway, Response: true, Err: errTooLarge}
+	}
+
+	def := c
+	if def.encode == nil {
+		def = jsonCodec
+	}
+
+	enc := negotiate(r.Header.Get("Accept"), def)
+	if enc == nil {
+		return &Error{
+			Status:   http.StatusNotAcceptable,
+			Response: true,
+			Err:      fmt.Errorf("cannot write any of %q", r.Header.Get("Accept")),
+		}
+	}
+
+	out, err := transform(r.Context(), h.response, &codec{decode: c.decode, encode: enc.encode}, rec.body.Bytes(), vars)
+	if err == jsonata.ErrUndefined {
+		copyHeader(w.Header(), rec.header)
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if err != nil {
+		e := err.(*Error)
+		e.Response = true
+		if e.Status != http.StatusInternalServerError {
+			e.Status = http.StatusBadGateway
+		}
+		return e
+	}
+
+	copyHeader(w.Header(), rec.header)
+	w.Header().Set("Content-Type", enc.mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.WriteHeader(rec.status)
+	w.Write(out)
+
+	return nil
+}
+
+// transform decodes body with c, evaluates e and encodes the
+// result with c's encoder, or as JSON if c can't encode. It
+// returns jsonata.ErrUndefined if e evaluates to undefined, and
+// an *Error for other failures.
+func transform(ctx context.Context, e *jsonata.Expression, c *codec, body []byte, vars map[string]interface{}) ([]byte, error) {
+
+	data, err := c.decode(body)
+	if err != nil {
+		return nil, &Error{Status: http.StatusBadRequest, Err: err}
+	}
+
+	res, err := e.EvalContext(ctx, data, vars)
+	if err == jsonata.ErrUndefined {
+		return nil, err
+	}
+	if err != nil {
+		return nil, &Error{Status: http.StatusUnprocessableEntity, Err: err}
+	}
+
+	encode := c.encode
+	if encode == nil {
+		encode = jsonCodec.encode
+	}
+
+	out, err := encode(res)
+	if err != nil {
+		return nil, &Error{Status: http.StatusInternalServerError, Err: err}
+	}
+
+	return out, nil
+}
+
+var errTooLarge = errors.New("body is too large")
+
+// readBody reads up to max bytes from r.
+func readBody(r io.Reader, max int64) ([]byte, error) {
+
+	b, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) > max {
+		return nil, errTooLarge
+	}
+
+	return b, nil
+}
+
+// isEncoded reports whether a response has a Content-Encoding
+// other than identity, e.g. gzip.
+func isEncoded(h http.Header) bool {
+	enc := strings.TrimSpace(h.Get("Content-Encoding"))
+	return enc != "" && !strings.EqualFold(enc, "identity")
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vs := range src {
+		if k == "Content-Length" {
+			continue
+		}
+		dst[k] = vs
+	}
+}
+
+// A recorder is an http.ResponseWriter that buffers a
+// response.
+type recorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.body.Write(b)
+}
+
+// writeTo writes the recorded response to w unchanged.
+func (rec *recorder) writeTo(w http.ResponseWriter) {
+	for k, vs := range rec.header {
+		w.Header()[k] = vs
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
@@ -0,0 +1,260 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jhttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/jmsgpack"
+)
+
+// echo is a handler that writes the request's body back with
+// its content type, and records the request.
+type echo struct {
+	req  *http.Request
+	body string
+}
+
+func (e *echo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	e.req, e.body = r, string(b)
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	w.Header().Set("X-Echo", "1")
+	w.Write(b)
+}
+
+func newCompiler(t *testing.T) *jsonata.Compiler {
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	return comp
+}
+
+func serve(h http.Handler, contentType, accept, body string) *httptest.ResponseRecorder {
+
+	r := httptest.NewRequest("POST", "/users/7", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestHandler(t *testing.T) {
+
+	comp := newCompiler(t)
+	next := &echo{}
+
+	h := NewHandler(next,
+		WithRequest(comp.MustCompile(`{"user": {"id": $id, "name": first & " " & last}}`)),
+		WithResponse(comp.MustCompile(`{"id": user.id, "greeting": "Hello, " & user.name}`)),
+		WithVars(func(r *http.Request) map[string]interface{} {
+			return map[string]interface{}{"id": strings.TrimPrefix(r.URL.Path, "/users/")}
+		}))
+
+	w := serve(h, "application/json", "", `{"first": "Ada", "last": "Lovelace"}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	if want := `{"user":{"id":"7","name":"Ada Lovelace"}}`; next.body != want {
+		t.Errorf("expected request body %s, got %s", want, next.body)
+	}
+	if next.req.ContentLength != int64(len(next.body)) {
+		t.Errorf("expected Content-Length %d, got %d", len(next.body), next.req.ContentLength)
+	}
+	if want := `{"greeting":"Hello, Ada Lovelace","id":"7"}`; w.Body.String() != want {
+		t.Errorf("expected response body %s, got %s", want, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %q", got)
+	}
+	if got := w.Header().Get("X-Echo"); got != "1" {
+		t.Errorf("expected the wrapped handler's headers to be kept, got X-Echo %q", got)
+	}
+}
+
+func TestHandlerFormats(t *testing.T) {
+
+	comp := newCompiler(t)
+	next := &echo{}
+	h := NewHandler(next,
+		WithRequest(comp.MustCompile(`order.item.{"sku": ` + "`@sku`" + `, "qty": $number(qty)}`)),
+		WithResponse(comp.MustCompile(`$sum(qty)`)))
+
+	// XML requests are passed on as JSON.
+	w := serve(h, "text/xml; charset=utf-8", "", `<order><item sku="A"><qty>2</qty></item><item sku="B"><qty>3</qty></item></order>`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	if want := `[{"qty":2,"sku":"A"},{"qty":3,"sku":"B"}]`; next.body != want {
+		t.Errorf("expected request body %s, got %s", want, next.body)
+	}
+	if got := next.req.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected request Content-Type application/json, got %q", got)
+	}
+	if w.Body.String() != "5" {
+		t.Errorf("expected response body 5, got %s", w.Body)
+	}
+
+	// The response format follows the Accept header.
+	w = serve(h, "application/json", "text/html;q=0.9, application/msgpack", `{"order": {"item": {"@sku": "A", "qty": "4"}}}`)
+
+	if got := w.Header().Get("Content-Type"); got != "application/msgpack" {
+		t.Fatalf("expected Content-Type application/msgpack, got %q", got)
+	}
+	v, err := jmsgpack.Decode(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if v != 4.0 {
+		t.Errorf("expected 4, got %v", v)
+	}
+
+	// MessagePack requests stay MessagePack.
+	msg, _ := jmsgpack.Encode(map[string]interface{}{"order": map[string]interface{}{"item": map[string]interface{}{"@sku": "C", "qty": "1"}}})
+
+	w = serve(h, "application/x-msgpack", "*/*", string(msg))
+
+	got, err := jmsgpack.Decode([]byte(next.body))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if want := map[string]interface{}{"sku": "C", "qty": 1.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected request %v, got %v", want, got)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/msgpack" {
+		t.Errorf("expected Content-Type application/msgpack, got %q", ct)
+	}
+}
+
+func TestHandlerPassThrough(t *testing.T) {
+
+	comp := newCompiler(t)
+
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("case") {
+		case "error":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "not found"}`))
+		case "text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("hello"))
+		case "gzip":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write([]byte("\x1f\x8b"))
+		case "undefined":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		}
+	}), WithResponse(comp.MustCompile(`value`)))
+
+	for _, test := range []struct {
+		Case   string
+		Status int
+		Body   string
+	}{
+		{"error", http.StatusNotFound, `{"error": "not found"}`},
+		{"text", http.StatusOK, "hello"},
+		{"gzip", http.StatusOK, "\x1f\x8b"},
+		{"undefined", http.StatusNoContent, ""},
+	} {
+		r := httptest.NewRequest("GET", "/?case="+test.Case, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.Status || w.Body.String() != test.Body {
+			t.Errorf("%s: expected %d %q, got %d %q", test.Case, test.Status, test.Body, w.Code, w.Body)
+		}
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+
+	comp := newCompiler(t)
+
+	for _, test := range []struct {
+		Name        string
+		Request     string
+		Response    string
+		ContentType string
+		Accept      string
+		Body        string
+		Status      int
+	}{
+		{"malformed", `$`, "", "application/json", "", `{`, http.StatusBadRequest},
+		{"unsupported", `$`, "", "text/csv", "", "a,b", http.StatusUnsupportedMediaType},
+		{"too large", `$`, "", "application/json", "", `"` + strings.Repeat("x", 100) + `"`, http.StatusRequestEntityTooLarge},
+		{"request", `$error("bad")`, "", "application/json", "", `{}`, http.StatusUnprocessableEntity},
+		{"response", "", `$error("bad")`, "application/json", "", `{}`, http.StatusBadGateway},
+		{"malformed response", "", `$`, "text/xml", "", `<a>`, http.StatusBadGateway},
+		{"not acceptable", "", `$`, "application/json", "text/html", `{}`, http.StatusNotAcceptable},
+	} {
+		var opts []Option
+		if test.Request != "" {
+			opts = append(opts, WithRequest(comp.MustCompile(test.Request)))
+		}
+		if test.Response != "" {
+			opts = append(opts, WithResponse(comp.MustCompile(test.Response)))
+		}
+
+		var got error
+		opts = append(opts, WithMaxBodySize(64), WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			got = err
+			writeError(w, r, err)
+		}))
+
+		w := serve(NewHandler(&echo{}, opts...), test.ContentType, test.Accept, test.Body)
+
+		if w.Code != test.Status {
+			t.Errorf("%s: expected status %d, got %d: %s", test.Name, test.Status, w.Code, w.Body)
+		}
+
+		var e *Error
+		if !errors.As(got, &e) {
+			t.Errorf("%s: expected an *Error, got %v", test.Name, got)
+			continue
+		}
+		if e.Response != (test.Response != "") {
+			t.Errorf("%s: expected Response %t, got %t", test.Name, test.Response != "", e.Response)
+		}
+	}
+}
+
+func TestHandlerUndefinedRequest(t *testing.T) {
+
+	comp := newCompiler(t)
+	next := &echo{}
+	h := NewHandler(next, WithRequest(comp.MustCompile(`nothing`)))
+
+	w := serve(h, "application/json", "", `{"a": 1}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if next.body != "" || next.req.ContentLength != 0 {
+		t.Errorf("expected an empty request body, got %q", next.body)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected an empty response, got %q", w.Body)
+	}
+}
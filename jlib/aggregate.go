@@ -11,27 +11,49 @@ import (
 	"github.com/iwongu/jsonata-go/jtypes"
 )
 
+// A NullHandling specifies how the aggregation functions (Sum,
+// Max, Min and Average) treat null elements in their input
+// arrays.
+type NullHandling int
+
+const (
+	// NullsError returns an error if an array contains nulls,
+	// as with any other non-number value. This is the behaviour
+	// required by the JSONata specification.
+	NullsError NullHandling = iota
+
+	// NullsSkip ignores null elements. An array that contains
+	// only nulls is treated like an empty array.
+	NullsSkip
+
+	// NullsAsZero treats null elements as zero. Null elements
+	// count towards the length of the array when calculating
+	// an average.
+	NullsAsZero
+)
+
+// IsValid reports whether h is a recognised null handling mode.
+func (h NullHandling) IsValid() bool {
+	return h >= NullsError && h <= NullsAsZero
+}
+
 // Sum returns the total of an array of numbers. If the array is
 // empty, Sum returns 0.
 func Sum(v reflect.Value) (float64, error) {
+	return NullsError.Sum(v)
+}
 
-	if !jtypes.IsArray(v) {
-		if n, ok := jtypes.AsNumber(v); ok {
-			return n, nil
-		}
-		return 0, fmt.Errorf("cannot call sum on a non-array type")
-	}
-
-	v = jtypes.Resolve(v)
+// Sum is like the package-level Sum function except that null
+// elements are handled according to h.
+func (h NullHandling) Sum(v reflect.Value) (float64, error) {
 
 	var sum float64
 
-	for i := 0; i < v.Len(); i++ {
-		n, ok := jtypes.AsNumber(v.Index(i))
-		if !ok {
-			return 0, fmt.Errorf("cannot call sum on an array with non-number types")
-		}
+	_, err := h.eachNumber("sum", v, func(n float64) {
 		sum += n
+	})
+	if err != nil {
+		return 0, err
 	}
 
 	return sum, nil
@@ -40,29 +62,28 @@ func Sum(v reflect.Value) (float64, error) {
 // Max returns the largest value in an array of numbers. If the
 // array is empty, Max returns 0 and an undefined error.
 func Max(v reflect.Value) (float64, error) {
+	return NullsError.Max(v)
+}
 
-	if !jtypes.IsArray(v) {
-		if n, ok := jtypes.AsNumber(v); ok {
-			return n, nil
-		}
-		return 0, fmt.Errorf("cannot call max on a non-array type")
-	}
-
-	v = jtypes.Resolve(v)
-	if v.Len() == 0 {
-		return 0, jtypes.ErrUndefined
-	}
+// Max is like the package-level Max function except that null
+// elements are handled according to h.
+func (h NullHandling) Max(v reflect.Value) (float64, error) {
 
 	var max float64
+	var seen bool
 
-	for i := 0; i < v.Len(); i++ {
-		n, ok := jtypes.AsNumber(v.Index(i))
-		if !ok {
-			return 0, fmt.Errorf("cannot call max on an array with non-number types")
-		}
-		if i == 0 || n > max {
+	count, err := h.eachNumber("max", v, func(n float64) {
+		if !seen || n > max {
 			max = n
+			seen = true
 		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		return 0, jtypes.ErrUndefined
 	}
 
 	return max, nil
@@ -71,29 +92,28 @@ func Max(v reflect.Value) (float64, error) {
 // Min returns the smallest value in an array of numbers. If the
 // array is empty, Min returns 0 and an undefined error.
 func Min(v reflect.Value) (float64, error) {
+	return NullsError.Min(v)
+}
 
-	if !jtypes.IsArray(v) {
-		if n, ok := jtypes.AsNumber(v); ok {
-			return n, nil
-		}
-		return 0, fmt.Errorf("cannot call min on a non-array type")
-	}
-
-	v = jtypes.Resolve(v)
-	if v.Len() == 0 {
-		return 0, jtypes.ErrUndefined
-	}
+// Min is like the package-level Min function except that null
+// elements are handled according to h.
+func (h NullHandling) Min(v reflect.Value) (float64, error) {
 
 	var min float64
+	var seen bool
 
-	for i := 0; i < v.Len(); i++ {
-		n, ok := jtypes.AsNumber(v.Index(i))
-		if !ok {
-			return 0, fmt.Errorf("cannot call min on an array with non-number types")
-		}
-		if i == 0 || n < min {
+	count, err := h.eachNumber("min", v, func(n float64) {
+		if !seen || n < min {
 			min = n
+			seen = true
 		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		return 0, jtypes.ErrUndefined
 	}
 
 	return min, nil
@@ -102,28 +122,119 @@ func Min(v reflect.Value) (float64, error) {
 // Average returns the mean of an array of numbers. If the array
 // is empty, Average returns 0 and an undefined error.
 func Average(v reflect.Value) (float64, error) {
+	return NullsError.Average(v)
+}
+
+// Average is like the package-level Average function except that
+// null elements are handled according to h.
+func (h NullHandling) Average(v reflect.Value) (float64, error) {
+
+	var sum float64
+
+	count, err := h.eachNumber("average", v, func(n float64) {
+		sum += n
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		return 0, jtypes.ErrUndefined
+	}
+
+	return sum / float64(count), nil
+}
+
+// WeightedAverage returns the mean of an array of numbers with
+// each number weighted by the number at the same position in the
+// weights array. The arrays must be the same length. If they are
+// empty, WeightedAverage returns 0 and an undefined error.
+func WeightedAverage(values, weights reflect.Value) (float64, error) {
+
+	var vs, ws []float64
+
+	_, err := NullsError.eachNumber("weightedAverage", values, func(n float64) {
+		vs = append(vs, n)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = NullsError.eachNumber("weightedAverage", weights, func(n float64) {
+		ws = append(ws, n)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(vs) != len(ws) {
+		return 0, fmt.Errorf("cannot call weightedAverage with %d values and %d weights", len(vs), len(ws))
+	}
+
+	if len(vs) == 0 {
+		return 0, jtypes.ErrUndefined
+	}
+
+	var sum, total float64
+
+	for i := range vs {
+		sum += vs[i] * ws[i]
+		total += ws[i]
+	}
+
+	if total == 0 {
+		return 0, fmt.Errorf("cannot call weightedAverage with weights that sum to zero")
+	}
+
+	return sum / total, nil
+}
+
+// eachNumber calls fn for each number in v, which must be a
+// number or an array of numbers. Null elements are handled
+// according to h. eachNumber returns the number of times fn
+// was called.
+func (h NullHandling) eachNumber(name string, v reflect.Value, fn func(float64)) (int, error) {
 
 	if !jtypes.IsArray(v) {
 		if n, ok := jtypes.AsNumber(v); ok {
-			return n, nil
+			fn(n)
+			return 1, nil
 		}
-		return 0, fmt.Errorf("cannot call average on a non-array type")
+		return 0, fmt.Errorf("cannot call %s on a non-array type", name)
 	}
 
 	v = jtypes.Resolve(v)
-	if v.Len() == 0 {
-		return 0, jtypes.ErrUndefined
-	}
 
-	var sum float64
+	count := 0
 
 	for i := 0; i < v.Len(); i++ {
-		n, ok := jtypes.AsNumber(v.Index(i))
+
+		item := jtypes.Resolve(v.Index(i))
+
+		n, ok := jtypes.AsNumber(item)
 		if !ok {
-			return 0, fmt.Errorf("cannot call average on an array with non-number types")
+			if h == NullsError || !isNull(item) {
+				return 0, fmt.Errorf("cannot call %s on an array with non-number types", name)
+			}
+			if h == NullsSkip {
+				continue
+			}
 		}
-		sum += n
+
+		fn(n)
+		count++
 	}
 
-	return sum / float64(v.Len()), nil
+	return count, nil
+}
+
+// isNull reports whether a resolved value is a JSON null.
+// Resolve leaves nil pointers and interfaces as is.
+func isNull(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
 }
@@ -0,0 +1,118 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jlib"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+func TestNullHandling(t *testing.T) {
+
+	var nilPtr *float64
+
+	data := []struct {
+		Input   interface{}
+		Mode    jlib.NullHandling
+		Sum     float64
+		Max     float64
+		Min     float64
+		Average float64
+		Error   bool
+	}{
+		{
+			Input: []interface{}{1, nil, 3},
+			Mode:  jlib.NullsError,
+			Error: true,
+		},
+		{
+			Input:   []interface{}{nil, 2, nilPtr, -4, nil},
+			Mode:    jlib.NullsSkip,
+			Sum:     -2,
+			Max:     2,
+			Min:     -4,
+			Average: -1,
+		},
+		{
+			Input:   []interface{}{nil, 2, nilPtr, -4, nil},
+			Mode:    jlib.NullsAsZero,
+			Sum:     -2,
+			Max:     2,
+			Min:     -4,
+			Average: -0.4,
+		},
+		{
+			// Nulls are the only non-numbers that are handled.
+			Input: []interface{}{1, nil, "3"},
+			Mode:  jlib.NullsSkip,
+			Error: true,
+		},
+		{
+			Input: []interface{}{1, nil, "3"},
+			Mode:  jlib.NullsAsZero,
+			Error: true,
+		},
+	}
+
+	for _, test := range data {
+
+		v := reflect.ValueOf(test.Input)
+
+		for _, fn := range []struct {
+			Name   string
+			Func   func(reflect.Value) (float64, error)
+			Output float64
+		}{
+			{"sum", test.Mode.Sum, test.Sum},
+			{"max", test.Mode.Max, test.Max},
+			{"min", test.Mode.Min, test.Min},
+			{"average", test.Mode.Average, test.Average},
+		} {
+			got, err := fn.Func(v)
+
+			if test.Error {
+				if err == nil {
+					t.Errorf("%s(%v) with mode %d: expected an error, got %v", fn.Name, test.Input, test.Mode, got)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Errorf("%s(%v) with mode %d: %s", fn.Name, test.Input, test.Mode, err)
+				continue
+			}
+
+			if got != fn.Output {
+				t.Errorf("%s(%v) with mode %d: expected %v, got %v", fn.Name, test.Input, test.Mode, fn.Output, got)
+			}
+		}
+	}
+}
+
+func TestNullHandlingAllNulls(t *testing.T) {
+
+	v := reflect.ValueOf([]interface{}{nil, nil})
+
+	if got, err := jlib.NullsSkip.Sum(v); got != 0 || err != nil {
+		t.Errorf("sum: expected 0, got %v (error %v)", got, err)
+	}
+
+	for name, fn := range map[string]func(reflect.Value) (float64, error){
+		"max":     jlib.NullsSkip.Max,
+		"min":     jlib.NullsSkip.Min,
+		"average": jlib.NullsSkip.Average,
+	} {
+		if _, err := fn(v); err != jtypes.ErrUndefined {
+			t.Errorf("%s: expected ErrUndefined, got %v", name, err)
+		}
+	}
+
+	if got, err := jlib.NullsAsZero.Max(v); got != 0 || err != nil {
+		t.Errorf("max: expected 0, got %v (error %v)", got, err)
+	}
+}
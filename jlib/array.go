@@ -5,6 +5,7 @@
 package jlib
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -27,48 +28,130 @@ func Count(v reflect.Value) int {
 	return v.Len()
 }
 
-// Distinct returns the values passed in with any duplicates removed.
+// Distinct returns the values passed in with any duplicates
+// removed. Values are compared using deep equality, so objects
+// and arrays with the same contents are considered duplicates.
+// The first occurrence of each value is kept. Values that are
+// not arrays are returned unchanged.
 func Distinct(v reflect.Value) interface{} {
+	return DistinctFunc(v, nil)
+}
+
+// An EqualFunc is a custom equality test. It reports whether a
+// and b are equal. If ok is false, the EqualFunc does not handle
+// the given values and the default comparison is used instead.
+type EqualFunc func(a, b interface{}) (equal bool, ok bool)
+
+// DistinctFunc is like Distinct except that values are first
+// compared using eq. Values for which eq returns ok false are
+// compared using deep equality. Because an EqualFunc can't be
+// used to build a hash table, DistinctFunc compares each value
+// with every distinct value seen so far, which is slower than
+// Distinct for large arrays. If eq is nil, DistinctFunc is
+// equivalent to Distinct.
+func DistinctFunc(v reflect.Value, eq EqualFunc) interface{} {
 	v = jtypes.Resolve(v)
 
-	// To match the behavior of jsonata-js, if this is a string we should
-	// return the entire string and not dedupe the individual characters
-	if jtypes.IsString(v) {
-		return v.String()
+	if !v.IsValid() {
+		return nil
 	}
 
-	if jtypes.IsArray(v) {
-		items := arrayify(v)
-		visited := make(map[interface{}]struct{})
-		distinctValues := reflect.MakeSlice(reflect.SliceOf(typeInterface), 0, 0)
-
-		for i := 0; i < items.Len(); i++ {
-			item := jtypes.Resolve(items.Index(i))
-
-			if jtypes.IsMap(item) {
-				// We can't hash a map, so convert it to a
-				// string that is hashable
-				mapItem := fmt.Sprint(item.Interface())
-				if _, ok := visited[mapItem]; ok {
-					continue
-				}
-				visited[mapItem] = struct{}{}
-				distinctValues = reflect.Append(distinctValues, item)
+	if !jtypes.IsArray(v) || v.Len() <= 1 {
+		if v.CanInterface() {
+			return v.Interface()
+		}
+		return nil
+	}
+
+	visited := make(map[interface{}]struct{})
+	distinctValues := make([]interface{}, 0, v.Len())
 
+	// When eq is set, the hash table can't be used. Keep
+	// the distinct values, and their keys, for comparison.
+	var kept []interface{}
+	var keptKeys []interface{}
+
+	for i := 0; i < v.Len(); i++ {
+		item := jtypes.Resolve(v.Index(i))
+		if !item.IsValid() || !item.CanInterface() {
+			continue
+		}
+
+		key, ok := distinctKey(item)
+
+		if eq != nil {
+			if containsEqual(kept, keptKeys, item.Interface(), key, ok, eq) {
 				continue
 			}
-
-			if _, ok := visited[item.Interface()]; ok {
+			kept = append(kept, item.Interface())
+			keptKeys = append(keptKeys, key)
+		} else if ok {
+			if _, seen := visited[key]; seen {
 				continue
 			}
+			visited[key] = struct{}{}
+		}
+
+		distinctValues = append(distinctValues, v.Index(i).Interface())
+	}
+
+	return distinctValues
+}
 
-			visited[item.Interface()] = struct{}{}
-			distinctValues = reflect.Append(distinctValues, item)
+// containsEqual reports whether values contains a value equal
+// to x according to eq or, if eq doesn't handle the values, by
+// comparing their distinct keys.
+func containsEqual(values, keys []interface{}, x interface{}, key interface{}, hasKey bool, eq EqualFunc) bool {
+	for i, v := range values {
+		if equal, ok := eq(v, x); ok {
+			if equal {
+				return true
+			}
+			continue
+		}
+		if hasKey && keys[i] != nil && keys[i] == key {
+			return true
 		}
-		return distinctValues.Interface()
 	}
+	return false
+}
 
-	return nil
+type nullKey struct{}
+
+type compositeKey struct {
+	json string
+}
+
+// distinctKey returns a hashable value that is the same for
+// any two deeply equal JSON values. It returns false if the
+// value cannot be compared.
+func distinctKey(v reflect.Value) (interface{}, bool) {
+
+	switch {
+	case jtypes.IsNumber(v):
+		n, _ := jtypes.AsNumber(v)
+		return n, true
+	case jtypes.IsString(v):
+		s, _ := jtypes.AsString(v)
+		return s, true
+	case jtypes.IsBool(v):
+		b, _ := jtypes.AsBool(v)
+		return b, true
+	case v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface:
+		// Resolve leaves nil pointers and interfaces, which
+		// represent JSON null, as is.
+		return nullKey{}, true
+	case jtypes.IsArray(v) || jtypes.IsMap(v):
+		// encoding/json sorts map keys, so objects with the
+		// same contents produce the same encoding.
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, false
+		}
+		return compositeKey{string(b)}, true
+	default:
+		return nil, false
+	}
 }
 
 // Append (golint)
@@ -121,6 +204,20 @@ func Reverse(v reflect.Value) (interface{}, error) {
 
 // Sort (golint)
 func Sort(v reflect.Value, swap jtypes.OptionalCallable) (interface{}, error) {
+	return SortFunc(v, swap, nil)
+}
+
+// A CompareFunc is a custom ordering for strings, e.g. the
+// collation order of a language. It returns a negative number if
+// a sorts before b, a positive number if a sorts after b and zero
+// if they sort together.
+type CompareFunc func(a, b string) int
+
+// SortFunc is like Sort except that, when no swap function is
+// given, arrays of strings are sorted with cmp rather than by
+// their code points. If cmp is nil, SortFunc is equivalent to
+// Sort.
+func SortFunc(v reflect.Value, swap jtypes.OptionalCallable, cmp CompareFunc) (interface{}, error) {
 	v = jtypes.Resolve(v)
 
 	switch {
@@ -135,7 +232,7 @@ func Sort(v reflect.Value, swap jtypes.OptionalCallable) (interface{}, error) {
 	case jtypes.IsArrayOf(v, jtypes.IsNumber):
 		return sortNumberArray(v), nil
 	case jtypes.IsArrayOf(v, jtypes.IsString):
-		return sortStringArray(v), nil
+		return sortStringArray(v, cmp), nil
 	}
 
 	return nil, fmt.Errorf("argument 1 of function sort must be an array of strings or numbers")
@@ -158,7 +255,7 @@ func sortNumberArray(v reflect.Value) []interface{} {
 	return results
 }
 
-func sortStringArray(v reflect.Value) []interface{} {
+func sortStringArray(v reflect.Value, cmp CompareFunc) []interface{} {
 	size := v.Len()
 	results := make([]interface{}, 0, size)
 
@@ -169,6 +266,9 @@ func sortStringArray(v reflect.Value) []interface{} {
 	}
 
 	sort.SliceStable(results, func(i, j int) bool {
+		if cmp != nil {
+			return cmp(results[i].(string), results[j].(string)) < 0
+		}
 		return results[i].(string) < results[j].(string)
 	})
 
@@ -261,6 +361,10 @@ func merge(lhs, rhs []interface{}, swapFunc func(interface{}, interface{}) (bool
 
 // Shuffle (golint)
 func Shuffle(v reflect.Value) interface{} {
+	return shuffle(v, rand.Intn)
+}
+
+func shuffle(v reflect.Value, intn func(int) int) interface{} {
 	v = forceArray(jtypes.Resolve(v))
 
 	length := arrayLen(v)
@@ -268,7 +372,7 @@ func Shuffle(v reflect.Value) interface{} {
 
 	for i := 0; i < length; i++ {
 
-		j := rand.Intn(i + 1)
+		j := intn(i + 1)
 
 		if i != j {
 			results[i] = results[j]
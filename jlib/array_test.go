@@ -0,0 +1,209 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib_test
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jlib"
+)
+
+func TestAppendCopies(t *testing.T) {
+
+	appendValues := func(v1, v2 interface{}) []interface{} {
+		res, err := jlib.Append(reflect.ValueOf(v1), reflect.ValueOf(v2))
+		if err != nil {
+			t.Fatalf("Append(%v, %v): %s", v1, v2, err)
+		}
+		return res.([]interface{})
+	}
+
+	a := appendValues([]interface{}{1.0}, 2.0)
+	b := appendValues(a, 3.0)
+	c := appendValues(a, 4.0)
+
+	// Modifying one result must not affect the others.
+	b[0] = 0.0
+	c = append(c, 5.0)
+
+	data := []struct {
+		Name   string
+		Value  []interface{}
+		Output []interface{}
+	}{
+		{
+			Name:   "a",
+			Value:  a,
+			Output: []interface{}{1.0, 2.0},
+		},
+		{
+			Name:   "b",
+			Value:  b,
+			Output: []interface{}{0.0, 2.0, 3.0},
+		},
+		{
+			Name:   "c",
+			Value:  c,
+			Output: []interface{}{1.0, 2.0, 4.0, 5.0},
+		},
+	}
+
+	for _, test := range data {
+		if !reflect.DeepEqual(test.Value, test.Output) {
+			t.Errorf("%s: expected %v, got %v", test.Name, test.Output, test.Value)
+		}
+	}
+}
+
+func TestRandShuffle(t *testing.T) {
+
+	input := reflect.ValueOf([]interface{}{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+
+	r1 := jlib.NewRand(rand.NewSource(7))
+	r2 := jlib.NewRand(rand.NewSource(7))
+
+	for i := 0; i < 5; i++ {
+		a, b := r1.Shuffle(input), r2.Shuffle(input)
+		if !reflect.DeepEqual(a, b) {
+			t.Fatalf("shuffle %d: expected identical results, got %v and %v", i, a, b)
+		}
+		if n := len(a.([]interface{})); n != input.Len() {
+			t.Fatalf("shuffle %d: expected %d items, got %d", i, input.Len(), n)
+		}
+	}
+
+	if a, b := r1.Random(), r2.Random(); a != b {
+		t.Errorf("expected identical random numbers, got %v and %v", a, b)
+	}
+}
+
+func TestDistinct(t *testing.T) {
+
+	data := []struct {
+		Input  interface{}
+		Output interface{}
+	}{
+		{
+			Input:  nil,
+			Output: nil,
+		},
+		{
+			Input:  "hello",
+			Output: "hello",
+		},
+		{
+			Input:  float64(1),
+			Output: float64(1),
+		},
+		{
+			Input:  []interface{}{1},
+			Output: []interface{}{1},
+		},
+		{
+			Input:  []interface{}{1, 2, 3, 3, 4, 3, 5},
+			Output: []interface{}{1, 2, 3, 4, 5},
+		},
+		{
+			// Numbers are compared by value, not type.
+			Input:  []interface{}{1, float64(1), 2.5, float32(2.5)},
+			Output: []interface{}{1, 2.5},
+		},
+		{
+			Input:  []interface{}{"1", 1, true, "true", nil, nil},
+			Output: []interface{}{"1", 1, true, "true", nil},
+		},
+		{
+			Input: []interface{}{
+				map[string]interface{}{"a": 1, "b": []interface{}{1, 2}},
+				map[string]interface{}{"b": []interface{}{1, 2}, "a": float64(1)},
+				map[string]interface{}{"a": "1", "b": []interface{}{1, 2}},
+				map[string]interface{}{"a": 1, "b": []interface{}{2, 1}},
+			},
+			Output: []interface{}{
+				map[string]interface{}{"a": 1, "b": []interface{}{1, 2}},
+				map[string]interface{}{"a": "1", "b": []interface{}{1, 2}},
+				map[string]interface{}{"a": 1, "b": []interface{}{2, 1}},
+			},
+		},
+		{
+			Input: []interface{}{
+				[]interface{}{1, 2},
+				[]interface{}{2, 1},
+				[]interface{}{1, 2},
+				[]float64{1, 2},
+			},
+			Output: []interface{}{
+				[]interface{}{1, 2},
+				[]interface{}{2, 1},
+			},
+		},
+	}
+
+	for _, test := range data {
+
+		got := jlib.Distinct(reflect.ValueOf(test.Input))
+
+		if !reflect.DeepEqual(got, test.Output) {
+			t.Errorf("distinct(%v): expected %v, got %v", test.Input, test.Output, got)
+		}
+	}
+}
+
+func TestDistinctFunc(t *testing.T) {
+
+	// Compare strings case-insensitively and leave
+	// everything else to the default comparison.
+	foldCase := func(a, b interface{}) (bool, bool) {
+		s1, ok1 := a.(string)
+		s2, ok2 := b.(string)
+		if !ok1 || !ok2 {
+			return false, false
+		}
+		return strings.EqualFold(s1, s2), true
+	}
+
+	data := []struct {
+		Input  interface{}
+		Output interface{}
+	}{
+		{
+			Input:  "hello",
+			Output: "hello",
+		},
+		{
+			Input:  []interface{}{"a", "B", "A", "b", "c"},
+			Output: []interface{}{"a", "B", "c"},
+		},
+		{
+			Input:  []interface{}{1, "1", float64(1), "x", nil, "X", nil},
+			Output: []interface{}{1, "1", "x", nil},
+		},
+		{
+			// The function is not applied to the contents
+			// of arrays and objects.
+			Input: []interface{}{
+				[]interface{}{"a"},
+				[]interface{}{"A"},
+				[]interface{}{"a"},
+			},
+			Output: []interface{}{
+				[]interface{}{"a"},
+				[]interface{}{"A"},
+			},
+		},
+	}
+
+	for _, test := range data {
+
+		got := jlib.DistinctFunc(reflect.ValueOf(test.Input), foldCase)
+
+		if !reflect.DeepEqual(got, test.Output) {
+			t.Errorf("distinct(%v): expected %v, got %v", test.Input, test.Output, got)
+		}
+	}
+}
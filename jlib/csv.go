@@ -0,0 +1,267 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// csvOptions are the options accepted by ParseCsv and ToCsv.
+type csvOptions struct {
+	delimiter rune
+	header    bool
+	columns   []string
+}
+
+func newCsvOptions(name string, options jtypes.OptionalValue) (csvOptions, error) {
+
+	opts := csvOptions{
+		delimiter: ',',
+		header:    true,
+	}
+
+	if !options.IsSet() {
+		return opts, nil
+	}
+
+	v := jtypes.Resolve(options.Value)
+	if !jtypes.IsMap(v) {
+		return csvOptions{}, fmt.Errorf("cannot call %s: options must be an object", name)
+	}
+
+	for _, key := range v.MapKeys() {
+
+		k, _ := jtypes.AsString(key)
+		val := v.MapIndex(key)
+
+		switch k {
+		case "delimiter":
+			s, ok := jtypes.AsString(val)
+			r, size := utf8.DecodeRuneInString(s)
+			if !ok || size == 0 || size != len(s) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+				return csvOptions{}, fmt.Errorf("cannot call %s: delimiter must be a single character other than a quote or a line break", name)
+			}
+			opts.delimiter = r
+		case "header":
+			b, ok := jtypes.AsBool(val)
+			if !ok {
+				return csvOptions{}, fmt.Errorf("cannot call %s: header must be a boolean", name)
+			}
+			opts.header = b
+		case "columns":
+			if name != "toCsv" {
+				return csvOptions{}, fmt.Errorf("cannot call %s: unknown option %q", name, k)
+			}
+			cols := arrayify(jtypes.Resolve(val))
+			if !jtypes.IsArrayOf(cols, jtypes.IsString) {
+				return csvOptions{}, fmt.Errorf("cannot call %s: columns must be an array of strings", name)
+			}
+			opts.columns = make([]string, cols.Len())
+			for i := range opts.columns {
+				opts.columns[i], _ = jtypes.AsString(cols.Index(i))
+			}
+		default:
+			return csvOptions{}, fmt.Errorf("cannot call %s: unknown option %q", name, k)
+		}
+	}
+
+	return opts, nil
+}
+
+// ParseCsv parses CSV text as described in RFC 4180. Fields may
+// be quoted with double quotes, and a quoted field may contain
+// delimiters, line breaks and doubled quotes. By default, the
+// first record is a header and each of the following records
+// becomes an object keyed by the header's fields. With the
+// option header set to false, each record becomes an array of
+// fields instead. The option delimiter replaces the comma that
+// separates fields. All fields are strings. Every record must
+// have the same number of fields.
+func ParseCsv(s string, options jtypes.OptionalValue) (interface{}, error) {
+
+	opts, err := newCsvOptions("parseCsv", options)
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(strings.NewReader(s))
+	r.Comma = opts.delimiter
+
+	var header []string
+	results := []interface{}{}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot call parseCsv: %s", err)
+		}
+
+		if !opts.header {
+			fields := make([]interface{}, len(record))
+			for i, f := range record {
+				fields[i] = f
+			}
+			results = append(results, fields)
+			continue
+		}
+
+		if header == nil {
+			seen := make(map[string]bool, len(record))
+			for _, f := range record {
+				if seen[f] {
+					return nil, fmt.Errorf("cannot call parseCsv: duplicate column %q", f)
+				}
+				seen[f] = true
+			}
+			header = record
+			continue
+		}
+
+		obj := make(map[string]interface{}, len(record))
+		for i, f := range record {
+			obj[header[i]] = f
+		}
+		results = append(results, obj)
+	}
+
+	return results, nil
+}
+
+// ToCsv writes an array of records as CSV text, quoting fields
+// as needed. Records may be arrays of values, which are written
+// in order, or objects. The columns for objects are the option
+// columns if it's set, otherwise the keys of all the objects in
+// sorted order, and a header row with the column names is
+// written first unless the option header is false. Strings are
+// written as they are, undefined values and nulls as empty
+// fields, and other values as $string would format them. The
+// option delimiter replaces the comma that separates fields.
+func ToCsv(v reflect.Value, options jtypes.OptionalValue) (string, error) {
+
+	opts, err := newCsvOptions("toCsv", options)
+	if err != nil {
+		return "", err
+	}
+
+	rows := arrayify(jtypes.Resolve(v))
+
+	columns := opts.columns
+	if columns == nil {
+		seen := map[string]bool{}
+		for i := 0; i < rows.Len(); i++ {
+			if jtypes.IsArray(rows.Index(i)) {
+				continue
+			}
+			keys, err := SortedKeys.keys(rows.Index(i))
+			if err != nil {
+				return "", err
+			}
+			for _, k := range keys {
+				if !seen[k] {
+					seen[k] = true
+					columns = append(columns, k)
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+
+	var b strings.Builder
+
+	w := csv.NewWriter(&b)
+	w.Comma = opts.delimiter
+
+	if opts.header && len(columns) > 0 {
+		if err := w.Write(columns); err != nil {
+			return "", err
+		}
+	}
+
+	for i := 0; i < rows.Len(); i++ {
+
+		row := jtypes.Resolve(rows.Index(i))
+
+		var fields []string
+
+		switch {
+		case jtypes.IsArray(row):
+			fields = make([]string, row.Len())
+			for j := range fields {
+				if fields[j], err = csvField(row.Index(j)); err != nil {
+					return "", err
+				}
+			}
+		case jtypes.IsMap(row) || (jtypes.IsStruct(row) && !jtypes.IsCallable(row)):
+			fields = make([]string, len(columns))
+			for j, col := range columns {
+				if fields[j], err = csvField(objectField(row, col)); err != nil {
+					return "", err
+				}
+			}
+		default:
+			return "", fmt.Errorf("cannot call toCsv: records must be arrays or objects")
+		}
+
+		if err := w.Write(fields); err != nil {
+			return "", err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// objectField returns the value of the key name in the map or
+// struct v, or an invalid Value if there's no such key.
+func objectField(v reflect.Value, name string) reflect.Value {
+
+	if jtypes.IsStruct(v) {
+		return jtypes.StructField(v, name)
+	}
+
+	key := reflect.ValueOf(name)
+	if kt := v.Type().Key(); kt != key.Type() {
+		if !key.Type().ConvertibleTo(kt) {
+			return reflect.Value{}
+		}
+		key = key.Convert(kt)
+	}
+
+	return v.MapIndex(key)
+}
+
+func csvField(v reflect.Value) (string, error) {
+
+	v = jtypes.Resolve(v)
+
+	if !v.IsValid() || isNull(v) {
+		return "", nil
+	}
+
+	if s, ok := jtypes.AsString(v); ok {
+		return s, nil
+	}
+
+	if !v.CanInterface() {
+		return "", nil
+	}
+
+	return String(v.Interface())
+}
@@ -13,12 +13,30 @@ type ErrType uint
 const (
 	_ ErrType = iota
 	ErrNaNInf
+	ErrInvalidRadix
+	ErrMalformedURL
+	ErrInvalidBase64
+	ErrInvalidPadWidth
+	ErrSingleMultipleMatches
+	ErrSingleNoMatch
+	ErrStringTooLong
 )
 
+// errcodes maps error types to the equivalent jsonata-js
+// error codes.
+var errcodes = map[ErrType]string{
+	ErrNaNInf:                "D3001",
+	ErrInvalidRadix:          "D3100",
+	ErrMalformedURL:          "D3140",
+	ErrSingleMultipleMatches: "D3138",
+	ErrSingleNoMatch:         "D3139",
+}
+
 // Error (golint)
 type Error struct {
-	Type ErrType
-	Func string
+	Type  ErrType
+	Func  string
+	Value string
 }
 
 // Error (golint)
@@ -29,6 +47,20 @@ func (e Error) Error() string {
 	switch e.Type {
 	case ErrNaNInf:
 		msg = "cannot convert NaN/Infinity to string"
+	case ErrInvalidRadix:
+		msg = fmt.Sprintf("the radix must be between 2 and 36, got %s", e.Value)
+	case ErrMalformedURL:
+		msg = fmt.Sprintf("malformed URL %q", e.Value)
+	case ErrInvalidBase64:
+		msg = fmt.Sprintf("invalid base 64 string %q", e.Value)
+	case ErrInvalidPadWidth:
+		msg = fmt.Sprintf("invalid width %s", e.Value)
+	case ErrSingleMultipleMatches:
+		msg = fmt.Sprintf("expected exactly 1 matching result, found another match at index %s", e.Value)
+	case ErrSingleNoMatch:
+		msg = "expected exactly 1 matching result, found none"
+	case ErrStringTooLong:
+		msg = fmt.Sprintf("result is longer than the limit of %s bytes", e.Value)
 	default:
 		msg = "unknown error"
 	}
@@ -36,9 +68,23 @@ func (e Error) Error() string {
 	return fmt.Sprintf("%s: %s", e.Func, msg)
 }
 
+// Code returns the jsonata-js error code for the error, or
+// an empty string if there is no equivalent code.
+func (e Error) Code() string {
+	return errcodes[e.Type]
+}
+
 func newError(name string, typ ErrType) *Error {
 	return &Error{
 		Func: name,
 		Type: typ,
 	}
 }
+
+func newErrorValue(name string, typ ErrType, value string) *Error {
+	return &Error{
+		Func:  name,
+		Type:  typ,
+		Value: value,
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// A CharacterMode specifies what the string functions Length,
+// Substring and Pad count as a character.
+type CharacterMode int
+
+const (
+	// CodePoints counts Unicode code points. This is the
+	// behaviour required by the JSONata specification.
+	CodePoints CharacterMode = iota
+
+	// Graphemes counts user-perceived characters (extended
+	// grapheme clusters), so that an emoji with a skin tone,
+	// a flag or a letter followed by combining accents is a
+	// single character. Clusters are found with the rules of
+	// Unicode Standard Annex #29, using the character
+	// properties that Go's unicode package provides. Rare
+	// scripts whose clusters depend on other properties, such
+	// as Indic conjuncts, may be split differently.
+	Graphemes
+)
+
+// IsValid reports whether m is a recognised character mode.
+func (m CharacterMode) IsValid() bool {
+	return m >= CodePoints && m <= Graphemes
+}
+
+// Length returns the number of characters in s.
+func (m CharacterMode) Length(s string) int {
+
+	if m == CodePoints {
+		return utf8.RuneCountInString(s)
+	}
+
+	n := 0
+	for s != "" {
+		s = s[nextGrapheme(s):]
+		n++
+	}
+	return n
+}
+
+// offset returns the byte offset of the nth character in s, or
+// -1 if s has n characters or fewer.
+func (m CharacterMode) offset(s string, n int) int {
+
+	if m == CodePoints {
+		return positionOfNthRune(s, n)
+	}
+
+	pos := 0
+	for i := 0; pos < len(s); i++ {
+		if i == n {
+			return pos
+		}
+		pos += nextGrapheme(s[pos:])
+	}
+
+	return -1
+}
+
+// splitGraphemes returns the grapheme clusters in s.
+func splitGraphemes(s string) []string {
+
+	var clusters []string
+	for s != "" {
+		n := nextGrapheme(s)
+		clusters = append(clusters, s[:n])
+		s = s[n:]
+	}
+
+	return clusters
+}
+
+// A graphemeProp is the Grapheme_Cluster_Break property of a
+// code point.
+type graphemeProp uint8
+
+const (
+	gpOther graphemeProp = iota
+	gpCR
+	gpLF
+	gpControl
+	gpExtend
+	gpZWJ
+	gpRegionalIndicator
+	gpPrepend
+	gpSpacingMark
+	gpL
+	gpV
+	gpT
+	gpLV
+	gpLVT
+	gpPictographic
+)
+
+// nextGrapheme returns the length in bytes of the grapheme
+// cluster at the start of s, which must not be empty.
+func nextGrapheme(s string) int {
+
+	r, pos := utf8.DecodeRuneInString(s)
+	prev := graphemeProperty(r)
+
+	// pict is true if the cluster so far ends with an
+	// Extended_Pictographic character followed by any number
+	// of Extend characters and, optionally, a ZWJ (rule GB11).
+	// ris is the number of consecutive regional indicators
+	// (rules GB12 and GB13).
+	pict := prev == gpPictographic
+	ris := 0
+	if prev == gpRegionalIndicator {
+		ris = 1
+	}
+
+	for pos < len(s) {
+
+		r, w := utf8.DecodeRuneInString(s[pos:])
+		next := graphemeProperty(r)
+
+		if graphemeBreak(prev, next, pict, ris) {
+			break
+		}
+
+		switch next {
+		case gpPictographic:
+			pict = true
+		case gpExtend, gpZWJ:
+			// A ZWJ only continues the sequence as its
+			// last character.
+			pict = pict && prev != gpZWJ
+		default:
+			pict = false
+		}
+
+		if next == gpRegionalIndicator {
+			ris++
+		} else {
+			ris = 0
+		}
+
+		prev = next
+		pos += w
+	}
+
+	return pos
+}
+
+// graphemeBreak reports whether there's a grapheme cluster
+// boundary between two code points with the properties prev and
+// next.
+func graphemeBreak(prev, next graphemeProp, pict bool, ris int) bool {
+
+	switch {
+	case prev == gpCR && next == gpLF: // GB3
+		return false
+	case prev == gpCR || prev == gpLF || prev == gpControl: // GB4
+		return true
+	case next == gpCR || next == gpLF || next == gpControl: // GB5
+		return true
+	case prev == gpL && (next == gpL || next == gpV || next == gpLV || next == gpLVT): // GB6
+		return false
+	case (prev == gpLV || prev == gpV) && (next == gpV || next == gpT): // GB7
+		return false
+	case (prev == gpLVT || prev == gpT) && next == gpT: // GB8
+		return false
+	case next == gpExtend || next == gpZWJ: // GB9
+		return false
+	case next == gpSpacingMark: // GB9a
+		return false
+	case prev == gpPrepend: // GB9b
+		return false
+	case prev == gpZWJ && next == gpPictographic && pict: // GB11
+		return false
+	case prev == gpRegionalIndicator && next == gpRegionalIndicator: // GB12, GB13
+		return ris%2 == 0
+	default: // GB999
+		return true
+	}
+}
+
+// graphemeProperty returns the Grapheme_Cluster_Break property
+// of r, as far as it can be derived from the unicode package's
+// tables.
+func graphemeProperty(r rune) graphemeProp {
+
+	switch {
+	case r == '\r':
+		return gpCR
+	case r == '\n':
+		return gpLF
+	case r == 0x200D:
+		return gpZWJ
+	case r == 0x200C, r >= 0xFF9E && r <= 0xFF9F, r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F:
+		// ZWNJ, halfwidth sound marks, emoji modifiers and
+		// tags extend the preceding character.
+		return gpExtend
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return gpRegionalIndicator
+	case r >= 0x0600 && r <= 0x0605, r == 0x06DD, r == 0x070F, r == 0x0890, r == 0x0891, r == 0x08E2, r == 0x110BD, r == 0x110CD:
+		return gpPrepend
+	case r >= 0x1100 && r <= 0x115F, r >= 0xA960 && r <= 0xA97C:
+		return gpL
+	case r >= 0x1160 && r <= 0x11A7, r >= 0xD7B0 && r <= 0xD7C6:
+		return gpV
+	case r >= 0x11A8 && r <= 0x11FF, r >= 0xD7CB && r <= 0xD7FB:
+		return gpT
+	case r >= 0xAC00 && r <= 0xD7A3:
+		if (r-0xAC00)%28 == 0 {
+			return gpLV
+		}
+		return gpLVT
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return gpExtend
+	case unicode.Is(unicode.Mc, r), r == 0x0E33, r == 0x0EB3:
+		return gpSpacingMark
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp):
+		return gpControl
+	case isPictographic(r):
+		return gpPictographic
+	default:
+		return gpOther
+	}
+}
+
+// pictographicRanges approximates the Extended_Pictographic
+// property, which the unicode package doesn't have.
+var pictographicRanges = &unicode.RangeTable{
+	LatinOffset: 1,
+	R16: []unicode.Range16{
+		{Lo: 0x00A9, Hi: 0x00AE, Stride: 5},
+		{Lo: 0x203C, Hi: 0x2049, Stride: 13},
+		{Lo: 0x2122, Hi: 0x2139, Stride: 23},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21A9, Hi: 0x21AA, Stride: 1},
+		{Lo: 0x231A, Hi: 0x231B, Stride: 1},
+		{Lo: 0x2328, Hi: 0x2328, Stride: 1},
+		{Lo: 0x2388, Hi: 0x2388, Stride: 1},
+		{Lo: 0x23CF, Hi: 0x23CF, Stride: 1},
+		{Lo: 0x23E9, Hi: 0x23F3, Stride: 1},
+		{Lo: 0x23F8, Hi: 0x23FA, Stride: 1},
+		{Lo: 0x24C2, Hi: 0x24C2, Stride: 1},
+		{Lo: 0x25AA, Hi: 0x25AB, Stride: 1},
+		{Lo: 0x25B6, Hi: 0x25C0, Stride: 10},
+		{Lo: 0x25FB, Hi: 0x25FE, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27BF, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2B05, Hi: 0x2B07, Stride: 1},
+		{Lo: 0x2B1B, Hi: 0x2B1C, Stride: 1},
+		{Lo: 0x2B50, Hi: 0x2B55, Stride: 5},
+		{Lo: 0x3030, Hi: 0x303D, Stride: 13},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F000, Hi: 0x1F1E5, Stride: 1},
+		{Lo: 0x1F200, Hi: 0x1F3FA, Stride: 1},
+		{Lo: 0x1F400, Hi: 0x1FAFF, Stride: 1},
+		{Lo: 0x1FC00, Hi: 0x1FFFD, Stride: 1},
+	},
+}
+
+func isPictographic(r rune) bool {
+	return unicode.Is(pictographicRanges, r)
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib_test
+
+import (
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jlib"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+func TestCharacterMode_Length(t *testing.T) {
+
+	data := []struct {
+		Input      string
+		CodePoints int
+		Graphemes  int
+	}{
+		{"", 0, 0},
+		{"hello", 5, 5},
+		{"\r\n", 2, 1},
+		{"\n\r", 2, 2},
+		// Combining marks.
+		{"é", 2, 1},
+		{"ä́b", 4, 2},
+		// Emoji with a skin tone and a variation selector.
+		{"\U0001F44D\U0001F3FD", 2, 1},
+		{"❤️", 2, 1},
+		// ZWJ sequences.
+		{"\U0001F468‍\U0001F469‍\U0001F467‍\U0001F466", 7, 1},
+		{"\U0001F3F3️‍\U0001F308", 4, 1},
+		{"a‍\U0001F308", 3, 2},
+		// Flags are pairs of regional indicators.
+		{"\U0001F1EF\U0001F1F5", 2, 1},
+		{"\U0001F1EF\U0001F1F5\U0001F1FA\U0001F1F8\U0001F1EC", 5, 3},
+		// Tag sequences.
+		{"\U0001F3F4\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F", 7, 1},
+		// Hangul syllables, composed and decomposed.
+		{"한글", 2, 2},
+		{"한글", 6, 2},
+		// Spacing marks.
+		{"कि", 2, 1},
+		// Prepended concatenation marks.
+		{"؀١", 2, 1},
+		// Controls are always on their own.
+		{"a\u0000́", 3, 3},
+	}
+
+	for _, test := range data {
+		if got := jlib.CodePoints.Length(test.Input); got != test.CodePoints {
+			t.Errorf("%+q: expected %d code points, got %d", test.Input, test.CodePoints, got)
+		}
+		if got := jlib.Graphemes.Length(test.Input); got != test.Graphemes {
+			t.Errorf("%+q: expected %d graphemes, got %d", test.Input, test.Graphemes, got)
+		}
+	}
+}
+
+func TestCharacterMode_Substring(t *testing.T) {
+
+	src := "Café \U0001F44D\U0001F3FD!"
+
+	data := []struct {
+		Start  int
+		Length jtypes.OptionalInt
+		Output string
+	}{
+		{0, jtypes.NewOptionalInt(4), "Café"},
+		{3, jtypes.NewOptionalInt(1), "é"},
+		{5, jtypes.OptionalInt{}, "\U0001F44D\U0001F3FD!"},
+		{-2, jtypes.NewOptionalInt(1), "\U0001F44D\U0001F3FD"},
+		{-1, jtypes.OptionalInt{}, "!"},
+		{7, jtypes.OptionalInt{}, ""},
+		{0, jtypes.NewOptionalInt(0), ""},
+	}
+
+	for _, test := range data {
+		if got := jlib.Graphemes.Substring(src, test.Start, test.Length); got != test.Output {
+			t.Errorf("Substring(%d, %v): expected %+q, got %+q", test.Start, test.Length, test.Output, got)
+		}
+	}
+}
+
+func TestCharacterMode_Pad(t *testing.T) {
+
+	data := []struct {
+		Input  string
+		Width  float64
+		Chars  string
+		Output string
+	}{
+		{"é", 3, "", "é  "},
+		{"é", -3, "", "  é"},
+		{"x", 4, "\U0001F1EF\U0001F1F5-", "x\U0001F1EF\U0001F1F5-\U0001F1EF\U0001F1F5"},
+		{"\U0001F44D\U0001F3FD", 1, "", "\U0001F44D\U0001F3FD"},
+		// Three regional indicators are a flag and a lone
+		// indicator, but repeating them makes more flags.
+		{"a", 4, "\U0001F1FA\U0001F1FA\U0001F1FA", "a\U0001F1FA\U0001F1FA\U0001F1FA\U0001F1FA\U0001F1FA"},
+		{"a", -4, "\U0001F1FA\U0001F1FA\U0001F1FA", "\U0001F1FA\U0001F1FA\U0001F1FA\U0001F1FA\U0001F1FAa"},
+	}
+
+	for _, test := range data {
+		got, err := jlib.Graphemes.Pad(test.Input, test.Width, jtypes.NewOptionalString(test.Chars))
+		if err != nil || got != test.Output {
+			t.Errorf("Pad(%+q, %v, %+q): expected %+q, got %+q (error %v)", test.Input, test.Width, test.Chars, test.Output, got, err)
+		}
+	}
+}
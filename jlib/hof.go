@@ -7,20 +7,28 @@ package jlib
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 
 	"github.com/iwongu/jsonata-go/jtypes"
 )
 
 // Map (golint)
 func Map(v reflect.Value, f jtypes.Callable) (interface{}, error) {
+	return mapItems(v, f, nil)
+}
+
+// mapItems implements Map. If progress is non-nil, it's called
+// after each item with the number of items processed so far.
+func mapItems(v reflect.Value, f jtypes.Callable, progress func(done, total int)) (interface{}, error) {
 
 	v = forceArray(jtypes.Resolve(v))
 
 	var results []interface{}
 
 	argc := clamp(f.ParamCount(), 1, 3)
+	n := arrayLen(v)
 
-	for i := 0; i < arrayLen(v); i++ {
+	for i := 0; i < n; i++ {
 
 		argv := []reflect.Value{v.Index(i), reflect.ValueOf(i), v}
 
@@ -31,6 +39,10 @@ func Map(v reflect.Value, f jtypes.Callable) (interface{}, error) {
 		if res.IsValid() && res.CanInterface() {
 			results = append(results, res.Interface())
 		}
+
+		if progress != nil {
+			progress(i+1, n)
+		}
 	}
 
 	return results, nil
@@ -99,30 +111,137 @@ func Reduce(v reflect.Value, f jtypes.Callable, init jtypes.OptionalValue) (inte
 
 // Single returns the one and only one value in the array parameter that satisfy
 // the function predicate (i.e. function returns Boolean true when passed the
-// value). Returns an error if the number of matching values is not exactly
+// value). If the predicate is omitted, the array must contain exactly one
+// value. Returns an error if the number of matching values is not exactly
 // one.
 // https://docs.jsonata.org/higher-order-functions#single
-func Single(v reflect.Value, f jtypes.Callable) (interface{}, error) {
-	filteredValue, err := Filter(v, f)
-	if err != nil {
-		return nil, err
+func Single(v reflect.Value, f jtypes.OptionalCallable) (interface{}, error) {
+
+	v = forceArray(jtypes.Resolve(v))
+
+	var argc int
+	if f.IsSet() {
+		argc = clamp(f.Callable.ParamCount(), 1, 3)
 	}
 
-	switch reflect.TypeOf(filteredValue).Kind() {
-	case reflect.Slice:
-		// Since Filter() returned a slice, if there is either zero or
-		// more than one item in the slice, return a error, otherwise
-		// return the item
-		s := reflect.ValueOf(filteredValue)
-		if s.Len() != 1 {
-			return nil, fmt.Errorf("number of matching values returned by single() must be 1, got: %d", s.Len())
+	var result reflect.Value
+	found := false
+
+	for i := 0; i < arrayLen(v); i++ {
+
+		item := v.Index(i)
+
+		if f.IsSet() {
+			argv := []reflect.Value{item, reflect.ValueOf(i), v}
+
+			res, err := f.Callable.Call(argv[:argc])
+			if err != nil {
+				return nil, err
+			}
+			if !Boolean(res) {
+				continue
+			}
 		}
-		return s.Index(0).Interface(), nil
 
-	default:
-		// Filter returned a single value, so use that
-		return reflect.ValueOf(filteredValue).Interface(), nil
+		if found {
+			return nil, newErrorValue("single", ErrSingleMultipleMatches, strconv.Itoa(i))
+		}
+
+		result = item
+		found = true
 	}
+
+	if !found {
+		return nil, newError("single", ErrSingleNoMatch)
+	}
+
+	if !result.IsValid() || !result.CanInterface() {
+		return nil, jtypes.ErrUndefined
+	}
+
+	return result.Interface(), nil
+}
+
+// CountIf returns the number of values in the array parameter
+// that satisfy the function predicate. It's equivalent to
+// $count($filter(array, function)) but doesn't build the
+// filtered array.
+func CountIf(v reflect.Value, f jtypes.Callable) (int, error) {
+
+	v = forceArray(jtypes.Resolve(v))
+
+	count := 0
+
+	argc := clamp(f.ParamCount(), 1, 3)
+
+	for i := 0; i < arrayLen(v); i++ {
+
+		argv := []reflect.Value{v.Index(i), reflect.ValueOf(i), v}
+
+		res, err := f.Call(argv[:argc])
+		if err != nil {
+			return 0, err
+		}
+		if Boolean(res) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// SumIf returns the total of the values in the array parameter
+// that satisfy the function predicate. If the optional third
+// parameter is provided, it's called with each matching value
+// and the results are summed instead. Undefined results are
+// ignored. It's equivalent to
+// $sum($filter(array, predicate).valueFn($)) but makes a single
+// pass over the array.
+func SumIf(v reflect.Value, f jtypes.Callable, valueFn jtypes.OptionalCallable) (float64, error) {
+
+	v = forceArray(jtypes.Resolve(v))
+
+	var sum float64
+
+	argc := clamp(f.ParamCount(), 1, 3)
+
+	var valueArgc int
+	if valueFn.IsSet() {
+		valueArgc = clamp(valueFn.Callable.ParamCount(), 1, 3)
+	}
+
+	for i := 0; i < arrayLen(v); i++ {
+
+		argv := []reflect.Value{v.Index(i), reflect.ValueOf(i), v}
+
+		res, err := f.Call(argv[:argc])
+		if err != nil {
+			return 0, err
+		}
+		if !Boolean(res) {
+			continue
+		}
+
+		x := argv[0]
+		if valueFn.IsSet() {
+			x, err = valueFn.Callable.Call(argv[:valueArgc])
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if x = jtypes.Resolve(x); !x.IsValid() {
+			continue
+		}
+
+		n, ok := jtypes.AsNumber(x)
+		if !ok {
+			return 0, fmt.Errorf("cannot call sumIf on non-number values")
+		}
+		sum += n
+	}
+
+	return sum, nil
 }
 
 func clamp(n, min, max int) int {
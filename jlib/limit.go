@@ -0,0 +1,119 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A StringLimit is the maximum length, in bytes, of the strings
+// made by Pad, Join, Replace and FormatNumber. Its methods are
+// like the package-level functions except that they return an
+// error of type ErrStringTooLong instead of a longer string.
+// Where the length of the result can be worked out from the
+// arguments, the error is returned before the string is built,
+// so a single call can't allocate an arbitrarily large string.
+type StringLimit int
+
+// IsValid reports whether l is a usable limit.
+func (l StringLimit) IsValid() bool {
+	return l > 0
+}
+
+func (l StringLimit) error(name string) error {
+	return newErrorValue(name, ErrStringTooLong, strconv.Itoa(int(l)))
+}
+
+func (l StringLimit) check(name string, s string, err error) (string, error) {
+	if err == nil && len(s) > int(l) {
+		return "", l.error(name)
+	}
+	return s, err
+}
+
+// Pad is like the package-level Pad function. Widths are
+// measured in code points, which are at least one byte long, so
+// a width greater than the limit is an error.
+func (l StringLimit) Pad(s string, width float64, chars jtypes.OptionalString) (string, error) {
+	return l.PadMode(CodePoints, s, width, chars)
+}
+
+// PadMode is like Pad except that widths are measured in the
+// characters of mode m, as in m.Pad. Characters of any mode are
+// at least one byte long.
+func (l StringLimit) PadMode(m CharacterMode, s string, width float64, chars jtypes.OptionalString) (string, error) {
+
+	if math.Abs(width) > float64(l) && math.Abs(width) <= maxPadWidth {
+		return "", l.error("pad")
+	}
+
+	s, err := m.Pad(s, width, chars)
+	return l.check("pad", s, err)
+}
+
+// Join is like the package-level Join function.
+func (l StringLimit) Join(values reflect.Value, separator jtypes.OptionalString) (string, error) {
+
+	if jtypes.IsArrayOf(values, jtypes.IsString) {
+
+		values := jtypes.Resolve(values)
+
+		n := 0
+		for i := 0; i < values.Len(); i++ {
+			s, _ := jtypes.AsString(values.Index(i))
+			n += len(s)
+			if i > 0 {
+				n += len(separator.String)
+			}
+			if n > int(l) {
+				return "", l.error("join")
+			}
+		}
+	}
+
+	s, err := Join(values, separator)
+	return l.check("join", s, err)
+}
+
+// Replace is like the package-level Replace function. When the
+// pattern is a regular expression, the length of the result is
+// checked after the replacements are made.
+func (l StringLimit) Replace(src string, pattern StringCallable, repl StringCallable, limit jtypes.OptionalInt) (string, error) {
+
+	p, ok1 := pattern.toInterface().(string)
+	r, ok2 := repl.toInterface().(string)
+
+	if ok1 && ok2 && p != "" && len(r) > len(p) {
+
+		count := strings.Count(src, p)
+		if limit.IsSet() && limit.Int >= 0 && limit.Int < count {
+			count = limit.Int
+		}
+
+		if len(src)+count*(len(r)-len(p)) > int(l) {
+			return "", l.error("replace")
+		}
+	}
+
+	s, err := Replace(src, pattern, repl, limit)
+	return l.check("replace", s, err)
+}
+
+// FormatNumber is like the package-level FormatNumber function.
+// A picture string longer than the limit is an error.
+func (l StringLimit) FormatNumber(value float64, picture string, options jtypes.OptionalValue) (string, error) {
+
+	if len(picture) > int(l) {
+		return "", l.error("formatNumber")
+	}
+
+	s, err := FormatNumber(value, picture, options)
+	return l.check("formatNumber", s, err)
+}
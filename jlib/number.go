@@ -45,11 +45,42 @@ func Number(value StringNumberBool) (float64, error) {
 	return 0, fmt.Errorf("unable to cast %q to a number", s)
 }
 
+// A RoundingMode specifies how Round resolves values that are
+// exactly halfway between two rounded results.
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds halfway values to the nearest even
+	// digit. This is the behaviour required by the JSONata
+	// specification.
+	RoundHalfEven RoundingMode = iota
+
+	// RoundHalfUp rounds halfway values towards positive
+	// infinity.
+	RoundHalfUp
+
+	// RoundHalfAwayFromZero rounds halfway values away from
+	// zero.
+	RoundHalfAwayFromZero
+)
+
+// IsValid reports whether m is a recognised rounding mode.
+func (m RoundingMode) IsValid() bool {
+	return m >= RoundHalfEven && m <= RoundHalfAwayFromZero
+}
+
 // Round rounds its input to the number of decimal places given
 // in the optional second parameter. By default, Round rounds to
 // the nearest integer. A negative precision specifies which column
-// to round to on the left hand side of the decimal place.
+// to round to on the left hand side of the decimal place. Halfway
+// values are rounded to the nearest even digit.
 func Round(x float64, prec jtypes.OptionalInt) float64 {
+	return RoundHalfEven.Round(x, prec)
+}
+
+// Round is like the package-level Round function except that
+// halfway values are resolved according to the rounding mode.
+func (m RoundingMode) Round(x float64, prec jtypes.OptionalInt) float64 {
 	// Adapted from gonum's floats.RoundEven.
 	// https://github.com/gonum/gonum/tree/master/floats
 
@@ -67,13 +98,7 @@ func Round(x float64, prec jtypes.OptionalInt) float64 {
 		return x
 	}
 	if isHalfway(intermed) {
-		correction, _ := math.Modf(math.Mod(intermed, 2))
-		intermed += correction
-		if intermed > 0 {
-			x = math.Floor(intermed)
-		} else {
-			x = math.Ceil(intermed)
-		}
+		x = m.roundHalfway(intermed)
 	} else {
 		if x < 0 {
 			x = math.Ceil(intermed - 0.5)
@@ -89,6 +114,25 @@ func Round(x float64, prec jtypes.OptionalInt) float64 {
 	return multByPow10(x, -prec.Int)
 }
 
+func (m RoundingMode) roundHalfway(x float64) float64 {
+	switch m {
+	case RoundHalfUp:
+		return math.Ceil(x)
+	case RoundHalfAwayFromZero:
+		if x > 0 {
+			return math.Ceil(x)
+		}
+		return math.Floor(x)
+	default:
+		correction, _ := math.Modf(math.Mod(x, 2))
+		x += correction
+		if x > 0 {
+			return math.Floor(x)
+		}
+		return math.Ceil(x)
+	}
+}
+
 // Power returns x to the power of y.
 func Power(x, y float64) (float64, error) {
 	res := math.Pow(x, y)
@@ -141,3 +141,65 @@ func TestRound(t *testing.T) {
 		}
 	}
 }
+
+func TestRoundingModes(t *testing.T) {
+
+	data := []struct {
+		Value     float64
+		Precision jtypes.OptionalInt
+		Outputs   [3]float64 // half even, half up, half away from zero
+	}{
+		{
+			Value:   2.5,
+			Outputs: [3]float64{2, 3, 3},
+		},
+		{
+			Value:   -2.5,
+			Outputs: [3]float64{-2, -2, -3},
+		},
+		{
+			Value:   3.5,
+			Outputs: [3]float64{4, 4, 4},
+		},
+		{
+			Value:   2.4,
+			Outputs: [3]float64{2, 2, 2},
+		},
+		{
+			Value:   -2.6,
+			Outputs: [3]float64{-3, -3, -3},
+		},
+		{
+			Value:     594.325,
+			Precision: jtypes.NewOptionalInt(2),
+			Outputs:   [3]float64{594.32, 594.33, 594.33},
+		},
+		{
+			Value:     -594.325,
+			Precision: jtypes.NewOptionalInt(2),
+			Outputs:   [3]float64{-594.32, -594.32, -594.33},
+		},
+		{
+			Value:     1250,
+			Precision: jtypes.NewOptionalInt(-2),
+			Outputs:   [3]float64{1200, 1300, 1300},
+		},
+	}
+
+	modes := []jlib.RoundingMode{
+		jlib.RoundHalfEven,
+		jlib.RoundHalfUp,
+		jlib.RoundHalfAwayFromZero,
+	}
+
+	for _, test := range data {
+		for i, mode := range modes {
+
+			got := mode.Round(test.Value, test.Precision)
+
+			if got != test.Outputs[i] {
+				t.Errorf("mode %d: round(%g, %d): Expected %g, got %g", mode, test.Value, test.Precision.Int, test.Outputs[i], got)
+			}
+		}
+	}
+}
@@ -7,6 +7,7 @@ package jlib
 import (
 	"fmt"
 	"reflect"
+	"sort"
 
 	"github.com/iwongu/jsonata-go/jtypes"
 )
@@ -28,6 +29,43 @@ func toInterfaceMap(v reflect.Value) (map[string]interface{}, bool) {
 	return nil, false
 }
 
+// A KeyOrder specifies the order in which the Each, Keys and
+// Spread functions visit the keys of a Go map. Struct fields are
+// always visited in field order.
+type KeyOrder int
+
+const (
+	// UnorderedKeys visits map keys in Go's map iteration order,
+	// which can differ from run to run. This is the default.
+	UnorderedKeys KeyOrder = iota
+
+	// SortedKeys visits map keys in sorted order. It produces
+	// the same results every time, at the cost of sorting.
+	SortedKeys
+)
+
+// MapKeys returns the keys of the map v in order o. String keys
+// are sorted lexically. Keys that aren't strings are sorted
+// after the string keys, in their original order.
+func (o KeyOrder) MapKeys(v reflect.Value) []reflect.Value {
+
+	keys := v.MapKeys()
+	if o != SortedKeys || len(keys) < 2 {
+		return keys
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		si, oki := jtypes.AsString(keys[i])
+		sj, okj := jtypes.AsString(keys[j])
+		if oki && okj {
+			return si < sj
+		}
+		return oki && !okj
+	})
+
+	return keys
+}
+
 // Each applies the function fn to each name/value pair in
 // the object obj and returns the results in an array. The
 // order of the items in the array is undefined.
@@ -40,6 +78,12 @@ func toInterfaceMap(v reflect.Value) (map[string]interface{}, bool) {
 // pair. The second and third arguments, if applicable, are
 // the value and the source object respectively.
 func Each(obj reflect.Value, fn jtypes.Callable) (interface{}, error) {
+	return UnorderedKeys.Each(obj, fn)
+}
+
+// Each is like the package-level Each function except that it
+// visits map keys in order o.
+func (o KeyOrder) Each(obj reflect.Value, fn jtypes.Callable) (interface{}, error) {
 
 	var each func(reflect.Value, jtypes.Callable) ([]interface{}, error)
 
@@ -47,7 +91,7 @@ func Each(obj reflect.Value, fn jtypes.Callable) (interface{}, error) {
 
 	switch {
 	case jtypes.IsMap(obj):
-		each = eachMap
+		each = o.eachMap
 	case jtypes.IsStruct(obj) && !jtypes.IsCallable(obj):
 		each = eachStruct
 	default:
@@ -73,7 +117,7 @@ func Each(obj reflect.Value, fn jtypes.Callable) (interface{}, error) {
 	}
 }
 
-func eachMap(v reflect.Value, fn jtypes.Callable) ([]interface{}, error) {
+func (o KeyOrder) eachMap(v reflect.Value, fn jtypes.Callable) ([]interface{}, error) {
 
 	size := v.Len()
 	if size == 0 {
@@ -84,7 +128,7 @@ func eachMap(v reflect.Value, fn jtypes.Callable) ([]interface{}, error) {
 
 	argv := make([]reflect.Value, fn.ParamCount())
 
-	for _, k := range v.MapKeys() {
+	for _, k := range o.MapKeys(v) {
 
 		for i := range argv {
 			switch i {
@@ -115,30 +159,30 @@ func eachMap(v reflect.Value, fn jtypes.Callable) ([]interface{}, error) {
 
 func eachStruct(v reflect.Value, fn jtypes.Callable) ([]interface{}, error) {
 
-	size := v.NumField()
-	if size == 0 {
+	names := jtypes.StructFieldNames(v.Type())
+	if len(names) == 0 {
 		return nil, nil
 	}
 
 	var results []interface{}
 
-	t := v.Type()
 	argv := make([]reflect.Value, fn.ParamCount())
 
-	for i := 0; i < size; i++ {
+	for _, name := range names {
 
-		field := t.Field(i)
-		if field.PkgPath != "" {
-			// Skip unexported fields.
+		val := jtypes.StructField(v, name)
+		if !val.IsValid() {
+			// Skip fields promoted from nil embedded
+			// pointers.
 			continue
 		}
 
 		for j := range argv {
 			switch j {
 			case 0:
-				argv[j] = v.Field(i)
+				argv[j] = val
 			case 1:
-				argv[j] = reflect.ValueOf(field.Name)
+				argv[j] = reflect.ValueOf(name)
 			case 2:
 				argv[j] = v
 			}
@@ -151,7 +195,7 @@ func eachStruct(v reflect.Value, fn jtypes.Callable) ([]interface{}, error) {
 
 		if res.IsValid() && res.CanInterface() {
 			if results == nil {
-				results = make([]interface{}, 0, size)
+				results = make([]interface{}, 0, len(names))
 			}
 			results = append(results, res.Interface())
 		}
@@ -257,26 +301,22 @@ func siftMap(v reflect.Value, fn jtypes.Callable) (map[string]interface{}, error
 
 func siftStruct(v reflect.Value, fn jtypes.Callable) (map[string]interface{}, error) {
 
-	size := v.NumField()
-	if size == 0 {
+	names := jtypes.StructFieldNames(v.Type())
+	if len(names) == 0 {
 		return nil, nil
 	}
 
 	var results map[string]interface{}
 
-	t := v.Type()
 	argv := make([]reflect.Value, fn.ParamCount())
 
-	for i := 0; i < size; i++ {
+	for _, key := range names {
 
-		key := t.Field(i).Name
-		val := v.Field(i)
+		val := jtypes.StructField(v, key)
 		if !val.IsValid() || !val.CanInterface() {
 			// Skip undefined or non-interfaceable values. We
 			// already know we don't want them in the results,
-			// so we can bypass the function call. This also
-			// filters out unexported fields (as they are
-			// non-interfaceable).
+			// so we can bypass the function call.
 			continue
 		}
 
@@ -298,7 +338,7 @@ func siftStruct(v reflect.Value, fn jtypes.Callable) (map[string]interface{}, er
 
 		if Boolean(res) {
 			if results == nil {
-				results = make(map[string]interface{}, size)
+				results = make(map[string]interface{}, len(names))
 			}
 			results[key] = val.Interface()
 		}
@@ -316,8 +356,14 @@ func siftStruct(v reflect.Value, fn jtypes.Callable) (map[string]interface{}, er
 // Keys returns the unique set of names from each object
 // in the array.
 func Keys(obj reflect.Value) (interface{}, error) {
+	return UnorderedKeys.Keys(obj)
+}
 
-	results, err := keys(obj)
+// Keys is like the package-level Keys function except that it
+// returns map keys in order o.
+func (o KeyOrder) Keys(obj reflect.Value) (interface{}, error) {
+
+	results, err := o.keys(obj)
 	if err != nil {
 		return nil, err
 	}
@@ -332,35 +378,39 @@ func Keys(obj reflect.Value) (interface{}, error) {
 	}
 }
 
-func keys(v reflect.Value) ([]string, error) {
+func (o KeyOrder) keys(v reflect.Value) ([]string, error) {
 
 	v = jtypes.Resolve(v)
 
 	switch {
 	case jtypes.IsMap(v):
-		return keysMap(v)
+		return o.keysMap(v)
 	case jtypes.IsStruct(v) && !jtypes.IsCallable(v):
 		return keysStruct(v)
 	case jtypes.IsArray(v):
-		return keysArray(v)
+		return o.keysArray(v)
 	default:
 		return nil, nil
 	}
 }
 
-func keysMap(v reflect.Value) ([]string, error) {
+func (o KeyOrder) keysMap(v reflect.Value) ([]string, error) {
 
 	if v.Len() == 0 {
 		return nil, nil
 	}
 
 	if m, ok := toInterfaceMap(v); ok {
-		return keysMapFast(m), nil
+		results := keysMapFast(m)
+		if o == SortedKeys {
+			sort.Strings(results)
+		}
+		return results, nil
 	}
 
 	results := make([]string, v.Len())
 
-	for i, k := range v.MapKeys() {
+	for i, k := range o.MapKeys(v) {
 
 		key, ok := jtypes.AsString(k)
 		if !ok {
@@ -385,32 +435,16 @@ func keysMapFast(m map[string]interface{}) []string {
 
 func keysStruct(v reflect.Value) ([]string, error) {
 
-	size := v.NumField()
-	if size == 0 {
-		return nil, nil
-	}
-
 	var results []string
 
-	t := v.Type()
-	for i := 0; i < size; i++ {
-
-		field := t.Field(i)
-		if field.PkgPath != "" {
-			// Skip unexported fields.
-			continue
-		}
-
-		if results == nil {
-			results = make([]string, 0, size)
-		}
-		results = append(results, field.Name)
-	}
+	jtypes.EachStructField(v, func(name string, _ reflect.Value) {
+		results = append(results, name)
+	})
 
 	return results, nil
 }
 
-func keysArray(v reflect.Value) ([]string, error) {
+func (o KeyOrder) keysArray(v reflect.Value) ([]string, error) {
 
 	size := v.Len()
 	if size == 0 {
@@ -420,7 +454,7 @@ func keysArray(v reflect.Value) ([]string, error) {
 	kresults := make([][]string, 0, size)
 
 	for i := 0; i < size; i++ {
-		results, err := keys(v.Index(i))
+		results, err := o.keys(v.Index(i))
 		if err != nil {
 			return nil, err
 		}
@@ -470,7 +504,7 @@ func Merge(objs reflect.Value) (interface{}, error) {
 		size = objs.Len()
 		merge = mergeMap
 	case jtypes.IsStruct(objs) && !jtypes.IsCallable(objs):
-		size = objs.NumField()
+		size = len(jtypes.StructFieldNames(objs.Type()))
 		merge = mergeStruct
 	case jtypes.IsArray(objs):
 		for i := 0; i < objs.Len(); i++ {
@@ -479,7 +513,7 @@ func Merge(objs reflect.Value) (interface{}, error) {
 			case jtypes.IsMap(obj):
 				size += obj.Len()
 			case jtypes.IsStruct(obj):
-				size += obj.NumField()
+				size += len(jtypes.StructFieldNames(obj.Type()))
 			default:
 				return nil, fmt.Errorf("argument must be an object or an array of objects")
 			}
@@ -529,20 +563,11 @@ func mergeMapFast(dest, src map[string]interface{}) {
 
 func mergeStruct(dest map[string]interface{}, src reflect.Value) error {
 
-	t := src.Type()
-
-	for i := 0; i < src.NumField(); i++ {
-
-		field := t.Field(i)
-		if field.PkgPath != "" {
-			// Skip unexported fields.
-			continue
+	jtypes.EachStructField(src, func(name string, val reflect.Value) {
+		if val.CanInterface() {
+			dest[name] = val.Interface()
 		}
-
-		if val := src.Field(i); val.IsValid() && val.CanInterface() {
-			dest[field.Name] = val.Interface()
-		}
-	}
+	})
 
 	return nil
 }
@@ -574,14 +599,19 @@ func mergeArray(dest map[string]interface{}, src reflect.Value) error {
 
 // Spread (golint)
 func Spread(v reflect.Value) (interface{}, error) {
+	return UnorderedKeys.Spread(v)
+}
+
+// Spread is like the package-level Spread function except that
+// it visits map keys in order o.
+func (o KeyOrder) Spread(v reflect.Value) (interface{}, error) {
 
 	var results []interface{}
 
 	switch {
 	case jtypes.IsMap(v):
 		v = jtypes.Resolve(v)
-		keys := v.MapKeys()
-		for _, k := range keys {
+		for _, k := range o.MapKeys(v) {
 			if k.Kind() != reflect.String {
 				return nil, fmt.Errorf("object key must evaluate to a string, got %v (%s)", k, k.Kind())
 			}
@@ -593,19 +623,17 @@ func Spread(v reflect.Value) (interface{}, error) {
 		}
 	case jtypes.IsStruct(v) && !jtypes.IsCallable(v):
 		v = jtypes.Resolve(v)
-		for i := 0; i < v.NumField(); i++ {
-			k := v.Type().Field(i).Name
-			v := v.FieldByIndex([]int{i})
+		jtypes.EachStructField(v, func(k string, v reflect.Value) {
 			if v.CanInterface() {
 				results = append(results, map[string]interface{}{
 					k: v.Interface(),
 				})
 			}
-		}
+		})
 	case jtypes.IsArray(v):
 		v = jtypes.Resolve(v)
 		for i := 0; i < v.Len(); i++ {
-			res, err := Spread(v.Index(i))
+			res, err := o.Spread(v.Index(i))
 			if err != nil {
 				return nil, err
 			}
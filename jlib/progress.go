@@ -0,0 +1,59 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// MapProgress describes the progress of a single call to Map.
+type MapProgress struct {
+	// Done is the number of items that have been processed.
+	Done int
+
+	// Total is the number of items in the array.
+	Total int
+
+	// Elapsed is the time since the call started.
+	Elapsed time.Duration
+}
+
+// A ProgressMapper is a version of the Map function that reports
+// its progress to a callback. It's intended for monitoring long
+// running transformations of large arrays.
+type ProgressMapper struct {
+	every int
+	fn    func(MapProgress)
+}
+
+// NewProgressMapper returns a ProgressMapper that calls fn after
+// every n items, and after the last item. If n is less than 1,
+// fn is only called after the last item.
+func NewProgressMapper(n int, fn func(MapProgress)) *ProgressMapper {
+	return &ProgressMapper{
+		every: n,
+		fn:    fn,
+	}
+}
+
+// Map is like the package-level Map function except that it
+// reports its progress to m's callback.
+func (m *ProgressMapper) Map(v reflect.Value, f jtypes.Callable) (interface{}, error) {
+
+	start := time.Now()
+
+	return mapItems(v, f, func(done, total int) {
+		if done == total || (m.every > 0 && done%m.every == 0) {
+			m.fn(MapProgress{
+				Done:    done,
+				Total:   total,
+				Elapsed: time.Since(start),
+			})
+		}
+	})
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+)
+
+// A Rand is a source of randomness for the Random and Shuffle
+// functions. Unlike the package-level functions, which use the
+// global source in math/rand, a Rand created from a seeded source
+// produces the same sequence of results every time. A Rand is
+// safe for concurrent use.
+type Rand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// NewRand returns a Rand that uses the given source.
+func NewRand(src rand.Source) *Rand {
+	return &Rand{
+		r: rand.New(src),
+	}
+}
+
+// Random is like the package-level Random function except that
+// it uses r as its source.
+func (r *Rand) Random() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Float64()
+}
+
+// Shuffle is like the package-level Shuffle function except that
+// it uses r as its source.
+func (r *Rand) Shuffle(v reflect.Value) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return shuffle(v, r.r.Intn)
+}
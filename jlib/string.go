@@ -10,11 +10,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
-	"net/url"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/iwongu/jsonata-go/jlib/jxpath"
@@ -24,6 +25,8 @@ import (
 // String converts a JSONata value to a string. Values that are
 // already strings are returned unchanged. Functions return empty
 // strings. All other types return their JSON representation.
+// Times are formatted in the same way as when they are read by
+// a JSONata expression (see jtypes.ConvertTime).
 func String(value interface{}) (string, error) {
 
 	switch v := value.(type) {
@@ -43,6 +46,10 @@ func String(value interface{}) (string, error) {
 		}
 	}
 
+	if v, ok := convertTimes(reflect.ValueOf(value), 0); ok {
+		value = v
+	}
+
 	// TODO: Round numbers to 13dps to match jsonata-js.
 	b := bytes.Buffer{}
 	e := json.NewEncoder(&b)
@@ -54,6 +61,163 @@ func String(value interface{}) (string, error) {
 	return strings.TrimSpace(b.String()), nil
 }
 
+// maxConvertDepth is the depth at which convertTimes stops
+// looking for times. Values that are nested deeper than this
+// are most likely cyclic, which the JSON encoder reports as an
+// error.
+const maxConvertDepth = 1000
+
+var (
+	typeTime          = reflect.TypeOf(time.Time{})
+	typeJSONMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// convertTimes returns a copy of v in which times are replaced
+// by strings, because the JSON encoder would otherwise format
+// them differently to jtypes.ConvertTime. Structs that contain
+// times are replaced by objects with the fields that are visible
+// to JSONata expressions (see jtypes.StructFieldNames). The
+// boolean return value is false if v contains no times, in
+// which case v should be encoded as it is.
+func convertTimes(v reflect.Value, depth int) (interface{}, bool) {
+
+	// Values that can't be interfaced, such as the fields of
+	// unexported embedded structs, are left to the JSON encoder.
+	if !v.IsValid() || !v.CanInterface() || depth > maxConvertDepth {
+		return nil, false
+	}
+
+	// Leave other types that encode themselves to the JSON
+	// encoder.
+	if t := v.Type(); !isTimeType(t) && t.Implements(typeJSONMarshaler) {
+		return nil, false
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, false
+		}
+		return convertTimes(v.Elem(), depth+1)
+
+	case reflect.Struct:
+		if v.Type() == typeTime {
+			return jtypes.ConvertTime(v).Interface(), true
+		}
+
+		obj := &jsonObject{}
+		changed := false
+		for _, name := range jtypes.StructFieldNames(v.Type()) {
+			fv := jtypes.RawStructField(v, name)
+			if !fv.IsValid() {
+				continue
+			}
+			if !fv.CanInterface() {
+				return nil, false
+			}
+			item, ok := convertTimes(fv, depth+1)
+			if ok {
+				changed = true
+			} else {
+				item = fv.Interface()
+			}
+			obj.names = append(obj.names, name)
+			obj.values = append(obj.values, item)
+		}
+		if !changed {
+			return nil, false
+		}
+		return obj, true
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, false
+		}
+		m := make(map[string]interface{}, v.Len())
+		changed := false
+		for _, k := range v.MapKeys() {
+			item, ok := convertTimes(v.MapIndex(k), depth+1)
+			if ok {
+				changed = true
+			} else {
+				item = v.MapIndex(k).Interface()
+			}
+			m[mapKey(k)] = item
+		}
+		if !changed {
+			return nil, false
+		}
+		return m, true
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+		items := make([]interface{}, v.Len())
+		changed := false
+		for i := range items {
+			item, ok := convertTimes(v.Index(i), depth+1)
+			if ok {
+				changed = true
+			} else {
+				item = v.Index(i).Interface()
+			}
+			items[i] = item
+		}
+		if !changed {
+			return nil, false
+		}
+		return items, true
+	}
+
+	return nil, false
+}
+
+func isTimeType(t reflect.Type) bool {
+	return t == typeTime || t.Kind() == reflect.Ptr && t.Elem() == typeTime
+}
+
+// mapKey returns the JSON object key for a map key.
+func mapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+// A jsonObject is a JSON object whose keys are encoded in the
+// order they were added, like the fields of a struct.
+type jsonObject struct {
+	names  []string
+	values []interface{}
+}
+
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+
+	b := bytes.Buffer{}
+	b.WriteByte('{')
+
+	for i, name := range o.names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
 // Substring returns the portion of a string starting at the
 // given (zero-indexed) offset. Negative offsets count from the
 // end of the string, e.g. a start position of -1 returns the
@@ -61,22 +225,28 @@ func String(value interface{}) (string, error) {
 // maximum number of characters returned. By default, Substring
 // returns all characters up to the end of the string.
 func Substring(s string, start int, length jtypes.OptionalInt) string {
+	return CodePoints.Substring(s, start, length)
+}
+
+// Substring is like the package-level Substring function except
+// that characters are counted according to m.
+func (m CharacterMode) Substring(s string, start int, length jtypes.OptionalInt) string {
 
-	if (length.IsSet() && length.Int <= 0) || start >= utf8.RuneCountInString(s) {
+	if (length.IsSet() && length.Int <= 0) || start >= m.Length(s) {
 		return ""
 	}
 
 	if start < 0 {
-		start += utf8.RuneCountInString(s)
+		start += m.Length(s)
 	}
 
 	if start > 0 {
-		pos := positionOfNthRune(s, start)
+		pos := m.offset(s, start)
 		s = s[pos:]
 	}
 
-	if length.IsSet() && length.Int < utf8.RuneCountInString(s) {
-		pos := positionOfNthRune(s, length.Int)
+	if length.IsSet() && length.Int < m.Length(s) {
+		pos := m.offset(s, length.Int)
 		s = s[:pos]
 	}
 
@@ -103,16 +273,33 @@ func SubstringAfter(s, substr string) string {
 	return s
 }
 
+// maxPadWidth is the largest width accepted by Pad. It's the
+// maximum length of a JavaScript array, which is the limit in
+// jsonata-js.
+const maxPadWidth = 1<<32 - 1
+
 // Pad returns a string padded to the specified number of characters.
 // If the width is greater than zero, the string is padded to the
 // right. If the width is less than zero, the string is padded to
 // the left. The optional third argument specifies the characters
 // used for padding. The default padding character is a space.
-func Pad(s string, width int, chars jtypes.OptionalString) string {
+// Widths are measured in Unicode code points, not bytes, and
+// fractional widths are truncated.
+func Pad(s string, width float64, chars jtypes.OptionalString) (string, error) {
+	return CodePoints.Pad(s, width, chars)
+}
 
-	padlen := abs(width) - utf8.RuneCountInString(s)
+// Pad is like the package-level Pad function except that widths
+// are measured in characters as counted by m.
+func (m CharacterMode) Pad(s string, width float64, chars jtypes.OptionalString) (string, error) {
+
+	if math.Abs(width) > maxPadWidth || math.IsNaN(width) {
+		return "", newErrorValue("pad", ErrInvalidPadWidth, strconv.FormatFloat(width, 'g', -1, 64))
+	}
+
+	padlen := abs(int(width)) - m.Length(s)
 	if padlen <= 0 {
-		return s
+		return s, nil
 	}
 
 	ch := chars.String
@@ -120,17 +307,33 @@ func Pad(s string, width int, chars jtypes.OptionalString) string {
 		ch = " "
 	}
 
-	padding := strings.Repeat(ch, padlen)
-	if utf8.RuneCountInString(padding) > padlen {
-		pos := positionOfNthRune(padding, padlen)
-		padding = padding[:pos]
+	var padding string
+	if m == CodePoints {
+		// Repeat the padding characters just enough times to
+		// cover padlen characters, then trim off the excess.
+		n := m.Length(ch)
+		padding = strings.Repeat(ch, (padlen+n-1)/n)
+		if n*((padlen+n-1)/n) > padlen {
+			pos := m.offset(padding, padlen)
+			padding = padding[:pos]
+		}
+	} else {
+		// Repeating a string can change where its clusters
+		// break (e.g. an odd number of regional indicators),
+		// so add the padding one cluster at a time.
+		clusters := splitGraphemes(ch)
+		var b strings.Builder
+		for i := 0; i < padlen; i++ {
+			b.WriteString(clusters[i%len(clusters)])
+		}
+		padding = b.String()
 	}
 
 	if width < 0 {
-		return padding + s
+		return padding + s, nil
 	}
 
-	return s + padding
+	return s + padding, nil
 }
 
 var reWhitespace = regexp.MustCompile(`\s+`)
@@ -459,7 +662,8 @@ func updateDecimalFormat(format *jxpath.DecimalFormat, key string, value string)
 
 // FormatBase returns the string representation of a number in the
 // optional base argument. If specified, the base must be between
-// 2 and 36. By default, FormatBase uses base 10.
+// 2 and 36 (after rounding), otherwise FormatBase returns an error
+// with code D3100. By default, FormatBase uses base 10.
 func FormatBase(value float64, base jtypes.OptionalFloat64) (string, error) {
 
 	radix := 10
@@ -468,7 +672,7 @@ func FormatBase(value float64, base jtypes.OptionalFloat64) (string, error) {
 	}
 
 	if radix < 2 || radix > 36 {
-		return "", fmt.Errorf("the second argument to formatBase must be between 2 and 36")
+		return "", newErrorValue("formatBase", ErrInvalidRadix, strconv.Itoa(radix))
 	}
 
 	return strconv.FormatInt(int64(Round(value, jtypes.OptionalInt{})), radix), nil
@@ -480,57 +684,30 @@ func Base64Encode(s string) (string, error) {
 }
 
 // Base64Decode returns the string represented by a base 64 string.
+// Like jsonata-js, Base64Decode ignores whitespace and accepts
+// input that uses the URL-safe alphabet or omits the trailing
+// padding characters.
 func Base64Decode(s string) (string, error) {
 
-	b, err := base64.StdEncoding.DecodeString(s)
-	if err != nil {
-		return "", err
-	}
-
-	return string(b), nil
-}
-
-// DecodeURL decodes a Uniform Resource Locator (URL)
-// See https://docs.jsonata.org/string-functions#decodeurl
-// and https://docs.jsonata.org/string-functions#decodeurlcomponent
-func DecodeURL(s string) (string, error) {
-	escaped, err := url.QueryUnescape(s)
-	if err != nil {
-		return "", err
-	}
-	return escaped, nil
-}
-
-// EncodeURL decodes a Uniform Resource Locator (URL)
-// See https://docs.jsonata.org/string-functions#encodeurl
-func EncodeURL(s string) (string, error) {
-	// Go will encode the UTF-8 replacement character to %EF%BF%DB
-	// but jsonata-js expects the operation to fail, so we'll
-	// provide the same behavior
-	if s == "�" {
-		return "", fmt.Errorf("invalid character")
-	}
+	enc := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return -1
+		case r == '-':
+			return '+'
+		case r == '_':
+			return '/'
+		default:
+			return r
+		}
+	}, s)
 
-	baseURL, err := url.Parse(s)
+	b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(enc, "="))
 	if err != nil {
-		return "", err
+		return "", newErrorValue("base64decode", ErrInvalidBase64, s)
 	}
 
-	baseURL.RawQuery = baseURL.Query().Encode()
-	return baseURL.String(), nil
-}
-
-// EncodeURLComponent decodes a component of a Uniform Resource Locator (URL)
-// and https://docs.jsonata.org/string-functions#encodeurlcomponent
-func EncodeURLComponent(s string) (string, error) {
-	// Go will encode the UTF-8 replacement character to %EF%BF%DB
-	// but jsonata-js expects the operation to fail, so we'll
-	// provide the same behavior
-	if s == "�" {
-		return "", fmt.Errorf("invalid character")
-	}
-
-	return url.QueryEscape(s), nil
+	return string(b), nil
 }
 
 type match struct {
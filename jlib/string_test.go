@@ -11,6 +11,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 	"unicode/utf8"
 
 	"github.com/iwongu/jsonata-go/jlib"
@@ -98,6 +99,31 @@ func TestString(t *testing.T) {
 			},
 			Output: `{"bool":true,"hello":"world","null":null,"one hundred":100,"pi":3.14159265359}`,
 		},
+		{
+			Input:  time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC),
+			Output: `"2024-01-02T03:04:05.000Z"`,
+		},
+		{
+			Input: struct {
+				Name string     `json:"name"`
+				Time time.Time  `json:"time"`
+				Ptr  *time.Time `json:"ptr"`
+				Skip string     `json:"-"`
+			}{
+				Name: "event",
+				Time: time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC),
+				Ptr:  timePtr(time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)),
+			},
+			Output: `{"name":"event","time":"2024-01-02T03:04:05.000Z","ptr":"2024-01-02T03:04:05.000Z"}`,
+		},
+		{
+			Input: map[string]interface{}{
+				"times": []time.Time{
+					time.Date(2024, time.January, 2, 3, 4, 5, 6e6, time.FixedZone("", -5*60*60)),
+				},
+			},
+			Output: `{"times":["2024-01-02T03:04:05.006-05:00"]}`,
+		},
 		{
 			Input:  replaceCallable(nil),
 			Output: "",
@@ -136,6 +162,10 @@ func TestString(t *testing.T) {
 	}
 }
 
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
 func TestSubstring(t *testing.T) {
 
 	src := "😂 emoji"
@@ -302,9 +332,10 @@ func TestPad(t *testing.T) {
 	src := "😂 emoji"
 
 	data := []struct {
-		Width  int
+		Width  float64
 		Chars  jtypes.OptionalString
 		Output string
+		Error  error
 	}{
 		{
 			Width:  10,
@@ -348,21 +379,56 @@ func TestPad(t *testing.T) {
 			Width:  -5,
 			Output: "😂 emoji",
 		},
+		{
+			// Pad with multiple multi-byte characters.
+			Width:  10,
+			Chars:  jtypes.NewOptionalString("超明"),
+			Output: "😂 emoji超明超",
+		},
+		{
+			// Pad with multiple multi-byte characters.
+			Width:  -11,
+			Chars:  jtypes.NewOptionalString("😂é"),
+			Output: "😂é😂é😂 emoji",
+		},
+		{
+			// Fractional widths are truncated.
+			Width:  10.9,
+			Output: "😂 emoji   ",
+		},
+		{
+			// Width too large.
+			Width: 1e300,
+			Error: &jlib.Error{
+				Func:  "pad",
+				Type:  jlib.ErrInvalidPadWidth,
+				Value: "1e+300",
+			},
+		},
+		{
+			// Width too large.
+			Width: -1 << 40,
+			Error: &jlib.Error{
+				Func:  "pad",
+				Type:  jlib.ErrInvalidPadWidth,
+				Value: "-1.099511627776e+12",
+			},
+		},
 	}
 
 	for _, test := range data {
 
-		got := jlib.Pad(src, test.Width, test.Chars)
+		got, err := jlib.Pad(src, test.Width, test.Chars)
 
-		if got != test.Output {
+		if got != test.Output || !reflect.DeepEqual(err, test.Error) {
 
-			s := fmt.Sprintf("pad(%q, %d", src, test.Width)
+			s := fmt.Sprintf("pad(%q, %g", src, test.Width)
 			if test.Chars.IsSet() {
 				s += fmt.Sprintf(", %q", test.Chars.String)
 			}
 			s += ")"
 
-			t.Errorf("%s: Expected %q, got %q", s, test.Output, got)
+			t.Errorf("%s: Expected %q (error %v), got %q (error %v)", s, test.Output, test.Error, got, err)
 		}
 	}
 }
@@ -1288,12 +1354,20 @@ func TestFormatBase(t *testing.T) {
 			Output: "2s",
 		},
 		{
-			Base:  jtypes.NewOptionalFloat64(1),
-			Error: fmt.Errorf("the second argument to formatBase must be between 2 and 36"),
+			Base: jtypes.NewOptionalFloat64(1),
+			Error: &jlib.Error{
+				Type:  jlib.ErrInvalidRadix,
+				Func:  "formatBase",
+				Value: "1",
+			},
 		},
 		{
-			Base:  jtypes.NewOptionalFloat64(40),
-			Error: fmt.Errorf("the second argument to formatBase must be between 2 and 36"),
+			Base: jtypes.NewOptionalFloat64(40),
+			Error: &jlib.Error{
+				Type:  jlib.ErrInvalidRadix,
+				Func:  "formatBase",
+				Value: "40",
+			},
 		},
 	}
 
@@ -1472,3 +1546,224 @@ func formatStringCallable(value jlib.StringCallable) string {
 		return fmt.Sprintf("<%s>", reflect.ValueOf(v).Kind())
 	}
 }
+
+func TestEncodeURL(t *testing.T) {
+
+	data := []struct {
+		Input     string
+		URL       string
+		Component string
+	}{
+		{
+			Input:     "",
+			URL:       "",
+			Component: "",
+		},
+		{
+			Input:     "hello world",
+			URL:       "hello%20world",
+			Component: "hello%20world",
+		},
+		{
+			Input:     "https://mozilla.org/?x=шеллы",
+			URL:       "https://mozilla.org/?x=%D1%88%D0%B5%D0%BB%D0%BB%D1%8B",
+			Component: "https%3A%2F%2Fmozilla.org%2F%3Fx%3D%D1%88%D0%B5%D0%BB%D0%BB%D1%8B",
+		},
+		{
+			Input:     "?x=test&y=a+b#frag",
+			URL:       "?x=test&y=a+b#frag",
+			Component: "%3Fx%3Dtest%26y%3Da%2Bb%23frag",
+		},
+		{
+			Input:     "-_.!~*'()",
+			URL:       "-_.!~*'()",
+			Component: "-_.!~*'()",
+		},
+		{
+			Input:     "100% 😂",
+			URL:       "100%25%20%F0%9F%98%82",
+			Component: "100%25%20%F0%9F%98%82",
+		},
+	}
+
+	for _, test := range data {
+
+		got, err := jlib.EncodeURL(test.Input)
+		if err != nil || got != test.URL {
+			t.Errorf("encodeUrl(%q): expected %q, got %q (%v)", test.Input, test.URL, got, err)
+		}
+
+		got, err = jlib.EncodeURLComponent(test.Input)
+		if err != nil || got != test.Component {
+			t.Errorf("encodeUrlComponent(%q): expected %q, got %q (%v)", test.Input, test.Component, got, err)
+		}
+
+		got, err = jlib.DecodeURL(test.URL)
+		if err != nil || got != test.Input {
+			t.Errorf("decodeUrl(%q): expected %q, got %q (%v)", test.URL, test.Input, got, err)
+		}
+
+		got, err = jlib.DecodeURLComponent(test.Component)
+		if err != nil || got != test.Input {
+			t.Errorf("decodeUrlComponent(%q): expected %q, got %q (%v)", test.Component, test.Input, got, err)
+		}
+	}
+}
+
+func TestDecodeURL(t *testing.T) {
+
+	data := []struct {
+		Input     string
+		URL       string
+		Component string
+	}{
+		{
+			// Plus signs are not spaces.
+			Input:     "a+b",
+			URL:       "a+b",
+			Component: "a+b",
+		},
+		{
+			// decodeUrl does not decode reserved characters.
+			Input:     "%3Fx%3dtest%20%2F",
+			URL:       "%3Fx%3dtest %2F",
+			Component: "?x=test /",
+		},
+		{
+			Input:     "%e2%82%ac",
+			URL:       "€",
+			Component: "€",
+		},
+	}
+
+	for _, test := range data {
+
+		got, err := jlib.DecodeURL(test.Input)
+		if err != nil || got != test.URL {
+			t.Errorf("decodeUrl(%q): expected %q, got %q (%v)", test.Input, test.URL, got, err)
+		}
+
+		got, err = jlib.DecodeURLComponent(test.Input)
+		if err != nil || got != test.Component {
+			t.Errorf("decodeUrlComponent(%q): expected %q, got %q (%v)", test.Input, test.Component, got, err)
+		}
+	}
+}
+
+func TestURLErrors(t *testing.T) {
+
+	data := []struct {
+		Func  func(string) (string, error)
+		Name  string
+		Input string
+	}{
+		{jlib.EncodeURL, "encodeUrl", "�"},
+		{jlib.EncodeURLComponent, "encodeUrlComponent", "abc\xff"},
+		{jlib.DecodeURL, "decodeUrl", "%"},
+		{jlib.DecodeURL, "decodeUrl", "%E0%A4%A"},
+		{jlib.DecodeURLComponent, "decodeUrlComponent", "%zz"},
+		{jlib.DecodeURLComponent, "decodeUrlComponent", "%C3"},
+		{jlib.DecodeURLComponent, "decodeUrlComponent", "%C3%28"},
+		{jlib.DecodeURLComponent, "decodeUrlComponent", "%80"},
+		{jlib.DecodeURLComponent, "decodeUrlComponent", "%ED%A0%80"},
+		{jlib.DecodeURLComponent, "decodeUrlComponent", "%C0%AF"},
+	}
+
+	for _, test := range data {
+
+		_, err := test.Func(test.Input)
+
+		exp := &jlib.Error{
+			Type:  jlib.ErrMalformedURL,
+			Func:  test.Name,
+			Value: test.Input,
+		}
+
+		if !reflect.DeepEqual(err, exp) {
+			t.Errorf("%s(%q): expected error %v, got %v", test.Name, test.Input, exp, err)
+		}
+		if code := exp.Code(); code != "D3140" {
+			t.Errorf("expected code D3140, got %q", code)
+		}
+	}
+}
+
+func TestBase64(t *testing.T) {
+
+	data := []struct {
+		Input   string
+		Encoded string
+	}{
+		{"", ""},
+		{"hello:world", "aGVsbG86d29ybGQ="},
+		{"user:pa55w0rd?", "dXNlcjpwYTU1dzByZD8="},
+		{"Привет", "0J/RgNC40LLQtdGC"},
+	}
+
+	for _, test := range data {
+
+		got, _ := jlib.Base64Encode(test.Input)
+		if got != test.Encoded {
+			t.Errorf("base64encode(%q): expected %q, got %q", test.Input, test.Encoded, got)
+		}
+
+		got, err := jlib.Base64Decode(test.Encoded)
+		if err != nil || got != test.Input {
+			t.Errorf("base64decode(%q): expected %q, got %q (%v)", test.Encoded, test.Input, got, err)
+		}
+	}
+}
+
+func TestBase64DecodeLenient(t *testing.T) {
+
+	data := []struct {
+		Input  string
+		Output string
+		Error  error
+	}{
+		{
+			// Missing padding.
+			Input:  "aGVsbG86d29ybGQ",
+			Output: "hello:world",
+		},
+		{
+			// Embedded whitespace.
+			Input:  "aGVs bG86\nd29y\r\nbGQ=",
+			Output: "hello:world",
+		},
+		{
+			// URL-safe alphabet.
+			Input:  "0J_RgNC40LLQtdGC",
+			Output: "Привет",
+		},
+		{
+			Input: "aGVs=bG8",
+			Error: &jlib.Error{
+				Type:  jlib.ErrInvalidBase64,
+				Func:  "base64decode",
+				Value: "aGVs=bG8",
+			},
+		},
+		{
+			Input: "a",
+			Error: &jlib.Error{
+				Type:  jlib.ErrInvalidBase64,
+				Func:  "base64decode",
+				Value: "a",
+			},
+		},
+	}
+
+	for _, test := range data {
+
+		got, err := jlib.Base64Decode(test.Input)
+
+		if got != test.Output {
+			t.Errorf("base64decode(%q): expected %q, got %q", test.Input, test.Output, got)
+		}
+
+		if !reflect.DeepEqual(err, test.Error) {
+			t.Errorf("base64decode(%q): expected error %v, got %v", test.Input, test.Error, err)
+		}
+	}
+}
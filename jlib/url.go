@@ -0,0 +1,204 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlib
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// The URL functions follow the semantics of JavaScript's
+// encodeURI, encodeURIComponent, decodeURI and decodeURIComponent.
+// See ECMA-262, section 19.2.6.
+const (
+	urlUnreserved = "-_.!~*'()"
+	urlReserved   = ";/?:@&=+$,#"
+)
+
+// EncodeURL encodes a Uniform Resource Locator (URL) by
+// replacing certain characters with UTF-8 escape sequences.
+// Characters that have a special meaning in a URL, such as
+// slashes and question marks, are not encoded.
+// See https://docs.jsonata.org/string-functions#encodeurl
+func EncodeURL(s string) (string, error) {
+	return encodeURL("encodeUrl", s, urlUnreserved+urlReserved)
+}
+
+// EncodeURLComponent encodes a component of a Uniform Resource
+// Locator (URL) by replacing certain characters with UTF-8
+// escape sequences.
+// See https://docs.jsonata.org/string-functions#encodeurlcomponent
+func EncodeURLComponent(s string) (string, error) {
+	return encodeURL("encodeUrlComponent", s, urlUnreserved)
+}
+
+// DecodeURL decodes a Uniform Resource Locator (URL) previously
+// encoded with EncodeURL. Escape sequences for characters that
+// have a special meaning in a URL are not decoded.
+// See https://docs.jsonata.org/string-functions#decodeurl
+func DecodeURL(s string) (string, error) {
+	return decodeURL("decodeUrl", s, urlReserved)
+}
+
+// DecodeURLComponent decodes a component of a Uniform Resource
+// Locator (URL) previously encoded with EncodeURLComponent.
+// See https://docs.jsonata.org/string-functions#decodeurlcomponent
+func DecodeURLComponent(s string) (string, error) {
+	return decodeURL("decodeUrlComponent", s, "")
+}
+
+func encodeURL(name string, s string, unescaped string) (string, error) {
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); {
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case r == utf8.RuneError:
+			// Invalid UTF-8 is the Go equivalent of the
+			// unpaired surrogates that cause the JavaScript
+			// functions to fail. Because encoding/json replaces
+			// unpaired surrogates with the Unicode replacement
+			// character, we reject that too.
+			return "", newErrorValue(name, ErrMalformedURL, s)
+		case r < utf8.RuneSelf && (isAlphaNumeric(byte(r)) || strings.IndexByte(unescaped, byte(r)) >= 0):
+			b.WriteByte(byte(r))
+		default:
+			for j := i; j < i+size; j++ {
+				writeEscape(&b, s[j])
+			}
+		}
+
+		i += size
+	}
+
+	return b.String(), nil
+}
+
+func decodeURL(name string, s string, reserved string) (string, error) {
+
+	if strings.IndexByte(s, '%') < 0 {
+		return s, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); {
+
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		c, ok := unescapeByte(s, i)
+		if !ok {
+			return "", newErrorValue(name, ErrMalformedURL, s)
+		}
+
+		if c < utf8.RuneSelf {
+			if strings.IndexByte(reserved, c) >= 0 {
+				b.WriteString(s[i : i+3])
+			} else {
+				b.WriteByte(c)
+			}
+			i += 3
+			continue
+		}
+
+		// Non-ASCII characters are encoded as a sequence
+		// of escaped UTF-8 bytes. The number of bytes in
+		// the sequence is given by the first byte.
+		n := utf8SequenceLength(c)
+		if n == 0 {
+			return "", newErrorValue(name, ErrMalformedURL, s)
+		}
+
+		buf := make([]byte, n)
+		buf[0] = c
+
+		for j := 1; j < n; j++ {
+			c, ok := unescapeByte(s, i+3*j)
+			if !ok {
+				return "", newErrorValue(name, ErrMalformedURL, s)
+			}
+			buf[j] = c
+		}
+
+		r, size := utf8.DecodeRune(buf)
+		if r == utf8.RuneError || size != n {
+			return "", newErrorValue(name, ErrMalformedURL, s)
+		}
+
+		b.Write(buf)
+		i += 3 * n
+	}
+
+	return b.String(), nil
+}
+
+// unescapeByte decodes the escape sequence at position i in
+// s. It returns false if there is no valid escape sequence at
+// that position.
+func unescapeByte(s string, i int) (byte, bool) {
+
+	if i+2 >= len(s) || s[i] != '%' {
+		return 0, false
+	}
+
+	hi, ok1 := fromHex(s[i+1])
+	lo, ok2 := fromHex(s[i+2])
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+
+	return hi<<4 | lo, true
+}
+
+func writeEscape(b *strings.Builder, c byte) {
+	const hex = "0123456789ABCDEF"
+	b.WriteByte('%')
+	b.WriteByte(hex[c>>4])
+	b.WriteByte(hex[c&0xF])
+}
+
+func fromHex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	default:
+		return 0, false
+	}
+}
+
+func isAlphaNumeric(c byte) bool {
+	return 'a' <= c && c <= 'z' ||
+		'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9'
+}
+
+// utf8SequenceLength returns the number of bytes in a UTF-8
+// sequence that starts with the given byte, or zero if the
+// byte cannot start a multi-byte sequence.
+func utf8SequenceLength(c byte) int {
+	switch {
+	case c&0xE0 == 0xC0:
+		return 2
+	case c&0xF0 == 0xE0:
+		return 3
+	case c&0xF8 == 0xF0:
+		return 4
+	default:
+		return 0
+	}
+}
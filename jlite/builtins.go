@@ -0,0 +1,739 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlite
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A builtin is a built-in function.
+type builtin struct {
+	// minArgs and maxArgs are the numbers of arguments that
+	// the function takes. maxArgs is -1 for variadic functions.
+	minArgs int
+	maxArgs int
+
+	// If context is true and the first argument is left out,
+	// the context value is used instead.
+	context bool
+
+	// If undefinedOK is false, the function returns undefined
+	// without being called if its first argument is undefined.
+	undefinedOK bool
+
+	fn func(args []interface{}, env *environment) (interface{}, error)
+}
+
+var builtins = map[string]*builtin{
+
+	// String functions.
+	"string":          {minArgs: 1, maxArgs: 1, context: true, fn: fnString},
+	"length":          {minArgs: 1, maxArgs: 1, context: true, fn: fnLength},
+	"substring":       {minArgs: 2, maxArgs: 3, context: true, fn: fnSubstring},
+	"substringBefore": {minArgs: 2, maxArgs: 2, context: true, fn: fnSubstringBefore},
+	"substringAfter":  {minArgs: 2, maxArgs: 2, context: true, fn: fnSubstringAfter},
+	"uppercase":       {minArgs: 1, maxArgs: 1, context: true, fn: stringFunc("$uppercase", strings.ToUpper)},
+	"lowercase":       {minArgs: 1, maxArgs: 1, context: true, fn: stringFunc("$lowercase", strings.ToLower)},
+	"trim":            {minArgs: 1, maxArgs: 1, context: true, fn: stringFunc("$trim", trim)},
+	"contains":        {minArgs: 2, maxArgs: 2, context: true, fn: fnContains},
+	"split":           {minArgs: 2, maxArgs: 3, context: true, fn: fnSplit},
+	"join":            {minArgs: 1, maxArgs: 2, fn: fnJoin},
+
+	// Numeric functions.
+	"number":  {minArgs: 1, maxArgs: 1, context: true, fn: fnNumber},
+	"abs":     {minArgs: 1, maxArgs: 1, context: true, fn: numberFunc("$abs", math.Abs)},
+	"floor":   {minArgs: 1, maxArgs: 1, context: true, fn: numberFunc("$floor", math.Floor)},
+	"ceil":    {minArgs: 1, maxArgs: 1, context: true, fn: numberFunc("$ceil", math.Ceil)},
+	"sqrt":    {minArgs: 1, maxArgs: 1, context: true, fn: fnSqrt},
+	"round":   {minArgs: 1, maxArgs: 2, context: true, fn: fnRound},
+	"power":   {minArgs: 2, maxArgs: 2, context: true, fn: fnPower},
+	"sum":     {minArgs: 1, maxArgs: 1, fn: aggregateFunc("$sum", sum)},
+	"max":     {minArgs: 1, maxArgs: 1, fn: aggregateFunc("$max", maximum)},
+	"min":     {minArgs: 1, maxArgs: 1, fn: aggregateFunc("$min", minimum)},
+	"average": {minArgs: 1, maxArgs: 1, fn: aggregateFunc("$average", average)},
+
+	// Boolean functions.
+	"boolean": {minArgs: 1, maxArgs: 1, context: true, fn: fnBoolean},
+	"not":     {minArgs: 1, maxArgs: 1, context: true, fn: fnNot},
+	"exists":  {minArgs: 1, maxArgs: 1, undefinedOK: true, fn: fnExists},
+
+	// Array functions.
+	"count":    {minArgs: 1, maxArgs: 1, undefinedOK: true, fn: fnCount},
+	"append":   {minArgs: 2, maxArgs: 2, undefinedOK: true, fn: fnAppend},
+	"reverse":  {minArgs: 1, maxArgs: 1, fn: fnReverse},
+	"distinct": {minArgs: 1, maxArgs: 1, fn: fnDistinct},
+
+	// Object functions.
+	"keys":   {minArgs: 1, maxArgs: 1, fn: fnKeys},
+	"lookup": {minArgs: 2, maxArgs: 2, fn: fnLookup},
+	"merge":  {minArgs: 1, maxArgs: 1, fn: fnMerge},
+
+	// Higher-order functions.
+	"map":    {minArgs: 2, maxArgs: 2, fn: fnMap},
+	"filter": {minArgs: 2, maxArgs: 2, fn: fnFilter},
+	"reduce": {minArgs: 2, maxArgs: 3, fn: fnReduce},
+}
+
+// baseEnv holds the built-in functions.
+var baseEnv = newBaseEnv()
+
+func newBaseEnv() *environment {
+
+	env := newEnvironment(nil)
+	for name, b := range builtins {
+		env.bind(name, b)
+	}
+
+	return env
+}
+
+func argCount(b *builtin) string {
+	switch {
+	case b.maxArgs < 0:
+		return "at least " + strconv.Itoa(b.minArgs)
+	case b.minArgs == b.maxArgs:
+		return strconv.Itoa(b.minArgs)
+	default:
+		return strconv.Itoa(b.minArgs) + " to " + strconv.Itoa(b.maxArgs)
+	}
+}
+
+func argError(name string, i int) error {
+	return newError("T0410", name, "argument "+strconv.Itoa(i+1)+" of function "+name+" does not match function signature")
+}
+
+// hasArg returns true if the ith argument was given and is
+// defined.
+func hasArg(args []interface{}, i int) bool {
+	return i < len(args) && args[i] != undefined
+}
+
+func stringArg(name string, args []interface{}, i int) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", argError(name, i)
+	}
+	return s, nil
+}
+
+func numberArg(name string, args []interface{}, i int) (float64, error) {
+	n, ok := asNumber(args[i])
+	if !ok {
+		return 0, argError(name, i)
+	}
+	return n, nil
+}
+
+func intArg(name string, args []interface{}, i int) (int, error) {
+	n, err := numberArg(name, args, i)
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func stringFunc(name string, f func(string) string) func([]interface{}, *environment) (interface{}, error) {
+	return func(args []interface{}, env *environment) (interface{}, error) {
+		s, err := stringArg(name, args, 0)
+		if err != nil {
+			return undefined, err
+		}
+		return f(s), nil
+	}
+}
+
+func numberFunc(name string, f func(float64) float64) func([]interface{}, *environment) (interface{}, error) {
+	return func(args []interface{}, env *environment) (interface{}, error) {
+		n, err := numberArg(name, args, 0)
+		if err != nil {
+			return undefined, err
+		}
+		return f(n), nil
+	}
+}
+
+func aggregateFunc(name string, f func([]float64) (float64, bool)) func([]interface{}, *environment) (interface{}, error) {
+	return func(args []interface{}, env *environment) (interface{}, error) {
+
+		items := arrayify(args[0])
+		nums := make([]float64, len(items))
+
+		for i, item := range items {
+			n, ok := asNumber(item)
+			if !ok {
+				return undefined, argError(name, 0)
+			}
+			nums[i] = n
+		}
+
+		res, ok := f(nums)
+		if !ok {
+			return undefined, nil
+		}
+
+		return res, nil
+	}
+}
+
+func fnString(args []interface{}, env *environment) (interface{}, error) {
+	return stringify(args[0])
+}
+
+func fnLength(args []interface{}, env *environment) (interface{}, error) {
+
+	s, err := stringArg("$length", args, 0)
+	if err != nil {
+		return undefined, err
+	}
+
+	return float64(utf8.RuneCountInString(s)), nil
+}
+
+func fnSubstring(args []interface{}, env *environment) (interface{}, error) {
+
+	s, err := stringArg("$substring", args, 0)
+	if err != nil {
+		return undefined, err
+	}
+
+	start, err := intArg("$substring", args, 1)
+	if err != nil {
+		return undefined, err
+	}
+
+	runes := []rune(s)
+	n := len(runes)
+
+	if start < 0 {
+		start += n
+		if start < 0 {
+			start = 0
+		}
+	}
+	if start >= n {
+		return "", nil
+	}
+
+	end := n
+	if hasArg(args, 2) {
+		length, err := intArg("$substring", args, 2)
+		if err != nil {
+			return undefined, err
+		}
+		if length <= 0 {
+			return "", nil
+		}
+		if start+length < end {
+			end = start + length
+		}
+	}
+
+	return string(runes[start:end]), nil
+}
+
+func fnSubstringBefore(args []interface{}, env *environment) (interface{}, error) {
+
+	s, err := stringArg("$substringBefore", args, 0)
+	if err != nil {
+		return undefined, err
+	}
+
+	chars, err := stringArg("$substringBefore", args, 1)
+	if err != nil {
+		return undefined, err
+	}
+
+	if i := strings.Index(s, chars); i >= 0 {
+		return s[:i], nil
+	}
+
+	return s, nil
+}
+
+func fnSubstringAfter(args []interface{}, env *environment) (interface{}, error) {
+
+	s, err := stringArg("$substringAfter", args, 0)
+	if err != nil {
+		return undefined, err
+	}
+
+	chars, err := stringArg("$substringAfter", args, 1)
+	if err != nil {
+		return undefined, err
+	}
+
+	if i := strings.Index(s, chars); i >= 0 {
+		return s[i+len(chars):], nil
+	}
+
+	return s, nil
+}
+
+// trim removes leading and trailing whitespace and replaces
+// internal runs of whitespace with a single space.
+func trim(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func fnContains(args []interface{}, env *environment) (interface{}, error) {
+
+	s, err := stringArg("$contains", args, 0)
+	if err != nil {
+		return undefined, err
+	}
+
+	substr, err := stringArg("$contains", args, 1)
+	if err != nil {
+		return undefined, err
+	}
+
+	return strings.Contains(s, substr), nil
+}
+
+func fnSplit(args []interface{}, env *environment) (interface{}, error) {
+
+	s, err := stringArg("$split", args, 0)
+	if err != nil {
+		return undefined, err
+	}
+
+	sep, err := stringArg("$split", args, 1)
+	if err != nil {
+		return undefined, err
+	}
+
+	parts := strings.Split(s, sep)
+
+	if hasArg(args, 2) {
+		limit, err := intArg("$split", args, 2)
+		if err != nil {
+			return undefined, err
+		}
+		if limit < 0 {
+			return undefined, newError("D3020", "$split", "third argument of the split function must evaluate to a positive number")
+		}
+		if limit < len(parts) {
+			parts = parts[:limit]
+		}
+	}
+
+	results := make([]interface{}, len(parts))
+	for i, p := range parts {
+		results[i] = p
+	}
+
+	return results, nil
+}
+
+func fnJoin(args []interface{}, env *environment) (interface{}, error) {
+
+	items := arrayify(args[0])
+	strs := make([]string, len(items))
+
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return undefined, argError("$join", 0)
+		}
+		strs[i] = s
+	}
+
+	var sep string
+	if hasArg(args, 1) {
+		var err error
+		if sep, err = stringArg("$join", args, 1); err != nil {
+			return undefined, err
+		}
+	}
+
+	return strings.Join(strs, sep), nil
+}
+
+func fnNumber(args []interface{}, env *environment) (interface{}, error) {
+
+	switch v := args[0].(type) {
+	case bool:
+		if v {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	case string:
+		if isNumeric(v) {
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				return n, nil
+			}
+		}
+		return undefined, newError("D3030", "$number", "unable to cast "+strconv.Quote(v)+" to a number")
+	}
+
+	if n, ok := asNumber(args[0]); ok {
+		return n, nil
+	}
+
+	return undefined, argError("$number", 0)
+}
+
+// isNumeric returns true if s is a number in JSON syntax.
+func isNumeric(s string) bool {
+
+	i := 0
+	digits := func() bool {
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		return i > start
+	}
+
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	if !digits() {
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		if !digits() {
+			return false
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if !digits() {
+			return false
+		}
+	}
+
+	return i == len(s)
+}
+
+func fnSqrt(args []interface{}, env *environment) (interface{}, error) {
+
+	n, err := numberArg("$sqrt", args, 0)
+	if err != nil {
+		return undefined, err
+	}
+
+	if n < 0 {
+		return undefined, newError("D3060", "$sqrt", "the sqrt function cannot be applied to a negative number")
+	}
+
+	return math.Sqrt(n), nil
+}
+
+func fnPower(args []interface{}, env *environment) (interface{}, error) {
+
+	x, err := numberArg("$power", args, 0)
+	if err != nil {
+		return undefined, err
+	}
+
+	y, err := numberArg("$power", args, 1)
+	if err != nil {
+		return undefined, err
+	}
+
+	res := math.Pow(x, y)
+	if math.IsNaN(res) || math.IsInf(res, 0) {
+		return undefined, newError("D3061", "$power", "the power function has resulted in a value that cannot be represented as a JSON number")
+	}
+
+	return res, nil
+}
+
+// fnRound rounds halfway values to the nearest even digit, as
+// the JSONata specification requires.
+func fnRound(args []interface{}, env *environment) (interface{}, error) {
+
+	x, err := numberArg("$round", args, 0)
+	if err != nil {
+		return undefined, err
+	}
+
+	var prec int
+	if hasArg(args, 1) {
+		if prec, err = intArg("$round", args, 1); err != nil {
+			return undefined, err
+		}
+	}
+
+	if x == 0 || (prec >= 0 && x == math.Trunc(x)) {
+		return x + 0, nil
+	}
+
+	y := shift(x, prec)
+	if math.IsInf(y, 0) {
+		return x, nil
+	}
+
+	if _, frac := math.Modf(y); math.Abs(frac) == 0.5 {
+		y = math.RoundToEven(y)
+	} else {
+		y = math.Round(y)
+	}
+
+	return shift(y, -prec), nil
+}
+
+// shift returns x multiplied by 10 to the power of n. It
+// adjusts the decimal exponent instead of multiplying, to avoid
+// rounding errors.
+func shift(x float64, n int) float64 {
+
+	if n == 0 {
+		return x
+	}
+
+	s := strconv.FormatFloat(x, 'e', -1, 64)
+	i := strings.IndexByte(s, 'e')
+	e, _ := strconv.Atoi(s[i+1:])
+
+	x, _ = strconv.ParseFloat(s[:i]+"e"+strconv.Itoa(e+n), 64)
+	return x
+}
+
+func sum(nums []float64) (float64, bool) {
+	var total float64
+	for _, n := range nums {
+		total += n
+	}
+	return total, true
+}
+
+func maximum(nums []float64) (float64, bool) {
+	if len(nums) == 0 {
+		return 0, false
+	}
+	res := nums[0]
+	for _, n := range nums[1:] {
+		res = math.Max(res, n)
+	}
+	return res, true
+}
+
+func minimum(nums []float64) (float64, bool) {
+	if len(nums) == 0 {
+		return 0, false
+	}
+	res := nums[0]
+	for _, n := range nums[1:] {
+		res = math.Min(res, n)
+	}
+	return res, true
+}
+
+func average(nums []float64) (float64, bool) {
+	if len(nums) == 0 {
+		return 0, false
+	}
+	total, _ := sum(nums)
+	return total / float64(len(nums)), true
+}
+
+func fnBoolean(args []interface{}, env *environment) (interface{}, error) {
+	return isTruthy(args[0]), nil
+}
+
+func fnNot(args []interface{}, env *environment) (interface{}, error) {
+	return !isTruthy(args[0]), nil
+}
+
+func fnExists(args []interface{}, env *environment) (interface{}, error) {
+	return args[0] != undefined, nil
+}
+
+func fnCount(args []interface{}, env *environment) (interface{}, error) {
+	return float64(len(arrayify(args[0]))), nil
+}
+
+func fnAppend(args []interface{}, env *environment) (interface{}, error) {
+
+	switch {
+	case args[0] == undefined:
+		return args[1], nil
+	case args[1] == undefined:
+		return args[0], nil
+	}
+
+	a, b := arrayify(args[0]), arrayify(args[1])
+
+	results := make([]interface{}, 0, len(a)+len(b))
+	results = append(results, a...)
+	results = append(results, b...)
+
+	return results, nil
+}
+
+func fnReverse(args []interface{}, env *environment) (interface{}, error) {
+
+	items := arrayify(args[0])
+	n := len(items)
+
+	results := make([]interface{}, n)
+	for i, item := range items {
+		results[n-1-i] = item
+	}
+
+	return results, nil
+}
+
+func fnDistinct(args []interface{}, env *environment) (interface{}, error) {
+
+	a, ok := args[0].([]interface{})
+	if !ok {
+		return args[0], nil
+	}
+
+	var results []interface{}
+
+outer:
+	for _, item := range a {
+		for _, v := range results {
+			if equal(item, v) {
+				continue outer
+			}
+		}
+		results = append(results, item)
+	}
+
+	return results, nil
+}
+
+func fnKeys(args []interface{}, env *environment) (interface{}, error) {
+
+	seen := map[string]bool{}
+	seq := &sequence{}
+
+	for _, item := range arrayify(args[0]) {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, key := range sortedKeys(m) {
+			if !seen[key] {
+				seen[key] = true
+				seq.values = append(seq.values, key)
+			}
+		}
+	}
+
+	return seq, nil
+}
+
+func fnLookup(args []interface{}, env *environment) (interface{}, error) {
+
+	key, err := stringArg("$lookup", args, 1)
+	if err != nil {
+		return undefined, err
+	}
+
+	return evalName(key, args[0]), nil
+}
+
+func fnMerge(args []interface{}, env *environment) (interface{}, error) {
+
+	results := map[string]interface{}{}
+
+	for _, item := range arrayify(args[0]) {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return undefined, argError("$merge", 0)
+		}
+		for key, v := range m {
+			results[key] = v
+		}
+	}
+
+	return results, nil
+}
+
+// callback calls a function passed to a higher-order function
+// with an item, its index and the array that it's in. Built-in
+// functions are only given as many of those as they take.
+func callback(fn interface{}, name string, item interface{}, i int, items []interface{}, env *environment) (interface{}, error) {
+
+	args := []interface{}{item, float64(i), items}
+	if b, ok := fn.(*builtin); ok && b.maxArgs >= 0 && b.maxArgs < len(args) {
+		args = args[:b.maxArgs]
+	}
+
+	return call(fn, name, args, undefined, env)
+}
+
+func fnMap(args []interface{}, env *environment) (interface{}, error) {
+
+	if !isFunction(args[1]) {
+		return undefined, argError("$map", 1)
+	}
+
+	items := arrayify(args[0])
+	seq := &sequence{}
+
+	for i, item := range items {
+		v, err := callback(args[1], "$map", item, i, items, env)
+		if err != nil {
+			return undefined, err
+		}
+		if v != undefined {
+			seq.values = append(seq.values, v)
+		}
+	}
+
+	return seq, nil
+}
+
+func fnFilter(args []interface{}, env *environment) (interface{}, error) {
+
+	if !isFunction(args[1]) {
+		return undefined, argError("$filter", 1)
+	}
+
+	items := arrayify(args[0])
+	seq := &sequence{}
+
+	for i, item := range items {
+		v, err := callback(args[1], "$filter", item, i, items, env)
+		if err != nil {
+			return undefined, err
+		}
+		if isTruthy(v) {
+			seq.values = append(seq.values, item)
+		}
+	}
+
+	return seq, nil
+}
+
+func fnReduce(args []interface{}, env *environment) (interface{}, error) {
+
+	if !isFunction(args[1]) {
+		return undefined, argError("$reduce", 1)
+	}
+
+	items := arrayify(args[0])
+
+	acc := undefined
+	if hasArg(args, 2) {
+		acc = args[2]
+	} else if len(items) > 0 {
+		acc, items = items[0], items[1:]
+	}
+
+	for _, item := range items {
+		var err error
+		acc, err = call(args[1], "$reduce", []interface{}{acc, item}, undefined, env)
+		if err != nil {
+			return undefined, err
+		}
+	}
+
+	return acc, nil
+}
@@ -0,0 +1,935 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlite
+
+import (
+	"math"
+	"sort"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// maxDepth is the deepest that function calls can nest.
+const maxDepth = 500
+
+// maxRangeItems is the largest array that the range operator
+// can create.
+const maxRangeItems = 10000000
+
+type undefinedType struct{}
+
+// undefined is the result of an expression that has no value.
+var undefined interface{} = undefinedType{}
+
+// A sequence holds the results of a path or predicate. eval
+// converts it to a single value or an array.
+type sequence struct {
+	values    []interface{}
+	keepArray bool
+}
+
+type environment struct {
+	parent *environment
+	vars   map[string]interface{}
+	depth  int
+}
+
+func newEnvironment(parent *environment) *environment {
+
+	env := &environment{
+		parent: parent,
+		vars:   map[string]interface{}{},
+	}
+	if parent != nil {
+		env.depth = parent.depth
+	}
+
+	return env
+}
+
+func (env *environment) bind(name string, v interface{}) {
+	env.vars[name] = v
+}
+
+func (env *environment) lookup(name string) interface{} {
+
+	for e := env; e != nil; e = e.parent {
+		if v, ok := e.vars[name]; ok {
+			return v
+		}
+	}
+
+	return undefined
+}
+
+func eval(node jparse.Node, data interface{}, env *environment) (interface{}, error) {
+
+	v, err := evalNode(node, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	return collapse(v), nil
+}
+
+// collapse converts a sequence to undefined, a single value or
+// an array, depending on its length.
+func collapse(v interface{}) interface{} {
+
+	if seq, ok := v.(*sequence); ok {
+		switch {
+		case len(seq.values) == 0:
+			return undefined
+		case len(seq.values) == 1 && !seq.keepArray:
+			return seq.values[0]
+		default:
+			return seq.values
+		}
+	}
+
+	return v
+}
+
+func evalNode(node jparse.Node, data interface{}, env *environment) (interface{}, error) {
+
+	switch node := node.(type) {
+	case *jparse.StringNode:
+		return node.Value, nil
+	case *jparse.NumberNode:
+		return node.Value, nil
+	case *jparse.BooleanNode:
+		return node.Value, nil
+	case *jparse.NullNode:
+		return nil, nil
+	case *jparse.VariableNode:
+		if node.Name == "" {
+			return data, nil
+		}
+		return env.lookup(node.Name), nil
+	case *jparse.NameNode:
+		return evalName(node.Value, data), nil
+	case *jparse.PathNode:
+		return evalPath(node, data, env)
+	case *jparse.NegationNode:
+		return evalNegation(node, data, env)
+	case *jparse.RangeNode:
+		return evalRange(node, data, env)
+	case *jparse.ArrayNode:
+		return evalArray(node, data, env)
+	case *jparse.ObjectNode:
+		return evalObject(node, data, env)
+	case *jparse.BlockNode:
+		return evalBlock(node, data, env)
+	case *jparse.WildcardNode:
+		return evalWildcard(data), nil
+	case *jparse.DescendentNode:
+		seq := &sequence{}
+		appendDescendents(seq, data)
+		return seq, nil
+	case *jparse.LambdaNode:
+		return &lambda{node: node, env: env}, nil
+	case *jparse.FunctionCallNode:
+		return evalFunctionCall(node, data, env)
+	case *jparse.PredicateNode:
+		return evalPredicate(node, data, env)
+	case *jparse.GroupNode:
+		items, err := eval(node.Expr, data, env)
+		if err != nil || items == undefined {
+			return undefined, err
+		}
+		return evalObject(node.ObjectNode, items, env)
+	case *jparse.ConditionalNode:
+		return evalConditional(node, data, env)
+	case *jparse.AssignmentNode:
+		v, err := eval(node.Value, data, env)
+		if err != nil {
+			return undefined, err
+		}
+		env.bind(node.Name, v)
+		return v, nil
+	case *jparse.NumericOperatorNode:
+		return evalNumericOperator(node, data, env)
+	case *jparse.ComparisonOperatorNode:
+		return evalComparisonOperator(node, data, env)
+	case *jparse.BooleanOperatorNode:
+		return evalBooleanOperator(node, data, env)
+	case *jparse.StringConcatenationNode:
+		return evalStringConcatenation(node, data, env)
+	case *jparse.SortNode:
+		return evalSort(node, data, env)
+	case *jparse.FunctionApplicationNode:
+		return evalFunctionApplication(node, data, env)
+	default:
+		return undefined, newError("", node.String(), "jlite: cannot evaluate "+node.String())
+	}
+}
+
+func evalName(name string, data interface{}) interface{} {
+
+	switch data := data.(type) {
+	case map[string]interface{}:
+		if v, ok := data[name]; ok {
+			return v
+		}
+	case []interface{}:
+		seq := &sequence{}
+		for _, item := range data {
+			if v := evalName(name, item); v != undefined {
+				seq.values = append(seq.values, v)
+			}
+		}
+		return seq
+	}
+
+	return undefined
+}
+
+func evalPath(node *jparse.PathNode, data interface{}, env *environment) (interface{}, error) {
+
+	if len(node.Steps) == 0 {
+		return undefined, nil
+	}
+
+	var isVar bool
+	switch step0 := node.Steps[0].(type) {
+	case *jparse.VariableNode:
+		isVar = true
+	case *jparse.PredicateNode:
+		_, isVar = step0.Expr.(*jparse.VariableNode)
+	}
+
+	items, isArray := data.([]interface{})
+	if isVar || !isArray {
+		items = []interface{}{data}
+	}
+
+	last := len(node.Steps) - 1
+	for i, step := range node.Steps {
+
+		if cons, ok := step.(*jparse.ArrayNode); ok && i == 0 {
+			v, err := eval(cons, items, env)
+			if err != nil || v == undefined {
+				return undefined, err
+			}
+			items = arrayify(v)
+			continue
+		}
+
+		results := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			v, err := eval(step, item, env)
+			if err != nil {
+				return undefined, err
+			}
+			if v != undefined {
+				results = append(results, v)
+			}
+		}
+
+		// If the last step produces a single array, it's the
+		// result as it stands.
+		if i == last && len(results) == 1 {
+			if a, ok := results[0].([]interface{}); ok {
+				return a, nil
+			}
+		}
+
+		_, isCons := step.(*jparse.ArrayNode)
+
+		items = make([]interface{}, 0, len(results))
+		for _, v := range results {
+			if a, ok := v.([]interface{}); ok && !isCons {
+				items = append(items, a...)
+			} else {
+				items = append(items, v)
+			}
+		}
+
+		if len(items) == 0 {
+			return undefined, nil
+		}
+	}
+
+	return &sequence{
+		values:    items,
+		keepArray: node.KeepArrays,
+	}, nil
+}
+
+func evalPredicate(node *jparse.PredicateNode, data interface{}, env *environment) (interface{}, error) {
+
+	items, err := eval(node.Expr, data, env)
+	if err != nil || items == undefined {
+		return undefined, err
+	}
+
+	values := arrayify(items)
+
+	for _, filter := range node.Filters {
+		values, err = applyFilter(filter, values, env)
+		if err != nil {
+			return undefined, err
+		}
+		if len(values) == 0 {
+			return undefined, nil
+		}
+	}
+
+	return &sequence{values: values}, nil
+}
+
+func applyFilter(filter jparse.Node, items []interface{}, env *environment) ([]interface{}, error) {
+
+	var results []interface{}
+
+	for i, item := range items {
+
+		res, err := eval(filter, item, env)
+		if err != nil {
+			return nil, err
+		}
+
+		if indexes, ok := asIndexes(res); ok {
+			for _, n := range indexes {
+				index := int(math.Floor(n))
+				if index < 0 {
+					index += len(items)
+				}
+				if index == i {
+					results = append(results, item)
+				}
+			}
+			continue
+		}
+
+		if isTruthy(res) {
+			results = append(results, item)
+		}
+	}
+
+	return results, nil
+}
+
+// asIndexes returns the array indexes that a predicate's result
+// refers to, if it's a number or an array of numbers.
+func asIndexes(v interface{}) ([]float64, bool) {
+
+	if n, ok := asNumber(v); ok {
+		return []float64{n}, true
+	}
+
+	a, ok := v.([]interface{})
+	if !ok || len(a) == 0 {
+		return nil, false
+	}
+
+	indexes := make([]float64, len(a))
+	for i, item := range a {
+		if indexes[i], ok = asNumber(item); !ok {
+			return nil, false
+		}
+	}
+
+	return indexes, true
+}
+
+func evalWildcard(data interface{}) interface{} {
+
+	seq := &sequence{}
+
+	walkValues(data, func(v interface{}) {
+		if a, ok := v.([]interface{}); ok {
+			seq.values = append(seq.values, flatten(nil, a)...)
+		} else {
+			seq.values = append(seq.values, v)
+		}
+	})
+
+	return seq
+}
+
+func appendDescendents(seq *sequence, v interface{}) {
+
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			appendDescendents(seq, item)
+		}
+	case map[string]interface{}:
+		seq.values = append(seq.values, v)
+		for _, key := range sortedKeys(v) {
+			appendDescendents(seq, v[key])
+		}
+	default:
+		if v != undefined {
+			seq.values = append(seq.values, v)
+		}
+	}
+}
+
+// walkValues calls fn for each value in an object, or each
+// value in each object in an array. Object keys are visited in
+// sorted order.
+func walkValues(data interface{}, fn func(interface{})) {
+
+	switch data := data.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(data) {
+			fn(data[key])
+		}
+	case []interface{}:
+		for _, item := range data {
+			walkValues(item, fn)
+		}
+	}
+}
+
+func evalNegation(node *jparse.NegationNode, data interface{}, env *environment) (interface{}, error) {
+
+	v, err := eval(node.RHS, data, env)
+	if err != nil || v == undefined {
+		return undefined, err
+	}
+
+	n, ok := asNumber(v)
+	if !ok {
+		return undefined, newError("D1002", node.RHS.String(), "cannot negate a non-numeric value")
+	}
+
+	return -n, nil
+}
+
+func evalRange(node *jparse.RangeNode, data interface{}, env *environment) (interface{}, error) {
+
+	bound := func(n jparse.Node, code, side string) (float64, bool, error) {
+		v, err := eval(n, data, env)
+		if err != nil || v == undefined {
+			return 0, false, err
+		}
+		x, ok := asNumber(v)
+		if !ok || x != math.Trunc(x) {
+			return 0, false, newError(code, n.String(), side+` side of the ".." operator must evaluate to an integer`)
+		}
+		return x, true, nil
+	}
+
+	lhs, lhsOK, err := bound(node.LHS, "T2003", "left")
+	if err != nil {
+		return undefined, err
+	}
+
+	rhs, rhsOK, err := bound(node.RHS, "T2004", "right")
+	if err != nil {
+		return undefined, err
+	}
+
+	if !lhsOK || !rhsOK || lhs > rhs {
+		return undefined, nil
+	}
+
+	if rhs-lhs >= maxRangeItems {
+		return undefined, newError("D2014", "..", "range operator has too many items")
+	}
+
+	results := make([]interface{}, 0, int(rhs-lhs)+1)
+	for x := lhs; x <= rhs; x++ {
+		results = append(results, x)
+	}
+
+	return results, nil
+}
+
+func evalArray(node *jparse.ArrayNode, data interface{}, env *environment) (interface{}, error) {
+
+	results := make([]interface{}, 0, len(node.Items))
+
+	for _, item := range node.Items {
+
+		v, err := eval(item, data, env)
+		if err != nil {
+			return undefined, err
+		}
+
+		if v == undefined {
+			continue
+		}
+
+		if _, isCons := item.(*jparse.ArrayNode); isCons {
+			results = append(results, v)
+			continue
+		}
+
+		results = append(results, arrayify(v)...)
+	}
+
+	return results, nil
+}
+
+func evalObject(node *jparse.ObjectNode, data interface{}, env *environment) (interface{}, error) {
+
+	items := arrayify(data)
+
+	type group struct {
+		pair  int
+		items []interface{}
+	}
+
+	var keys []string
+	groups := map[string]*group{}
+
+	for i, pair := range node.Pairs {
+
+		if s, ok := pair[0].(*jparse.StringNode); ok {
+			if _, ok := groups[s.Value]; ok {
+				return undefined, newError("D1009", s.Value, `multiple object keys evaluate to the value "`+s.Value+`"`)
+			}
+			groups[s.Value] = &group{pair: i, items: items}
+			keys = append(keys, s.Value)
+			continue
+		}
+
+		for _, item := range items {
+
+			v, err := eval(pair[0], item, env)
+			if err != nil {
+				return undefined, err
+			}
+
+			key, ok := v.(string)
+			if !ok {
+				return undefined, newError("T1003", pair[0].String(), "object key "+pair[0].String()+" does not evaluate to a string")
+			}
+
+			g, ok := groups[key]
+			if !ok {
+				groups[key] = &group{pair: i, items: []interface{}{item}}
+				keys = append(keys, key)
+				continue
+			}
+
+			if g.pair != i {
+				return undefined, newError("D1009", key, `multiple object keys evaluate to the value "`+key+`"`)
+			}
+			g.items = append(g.items, item)
+		}
+	}
+
+	results := make(map[string]interface{}, len(keys))
+
+	for _, key := range keys {
+
+		g := groups[key]
+
+		v, err := eval(node.Pairs[g.pair][1], g.items, env)
+		if err != nil {
+			return undefined, err
+		}
+
+		if v != undefined {
+			results[key] = v
+		}
+	}
+
+	return results, nil
+}
+
+func evalBlock(node *jparse.BlockNode, data interface{}, env *environment) (interface{}, error) {
+
+	env = newEnvironment(env)
+
+	res := undefined
+	for _, expr := range node.Exprs {
+		var err error
+		if res, err = eval(expr, data, env); err != nil {
+			return undefined, err
+		}
+	}
+
+	return res, nil
+}
+
+func evalConditional(node *jparse.ConditionalNode, data interface{}, env *environment) (interface{}, error) {
+
+	cond, err := eval(node.If, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	if isTruthy(cond) {
+		return eval(node.Then, data, env)
+	}
+
+	if node.Else != nil {
+		return eval(node.Else, data, env)
+	}
+
+	return undefined, nil
+}
+
+func evalNumericOperator(node *jparse.NumericOperatorNode, data interface{}, env *environment) (interface{}, error) {
+
+	lhs, err := eval(node.LHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	rhs, err := eval(node.RHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	op := node.Type.String()
+
+	x, xOK := asNumber(lhs)
+	if lhs != undefined && !xOK {
+		return undefined, newError("T2001", node.LHS.String(), `left side of the "`+op+`" operator must evaluate to a number`)
+	}
+
+	y, yOK := asNumber(rhs)
+	if rhs != undefined && !yOK {
+		return undefined, newError("T2002", node.RHS.String(), `right side of the "`+op+`" operator must evaluate to a number`)
+	}
+
+	if !xOK || !yOK {
+		return undefined, nil
+	}
+
+	var res float64
+	switch node.Type {
+	case jparse.NumericAdd:
+		res = x + y
+	case jparse.NumericSubtract:
+		res = x - y
+	case jparse.NumericMultiply:
+		res = x * y
+	case jparse.NumericDivide:
+		res = x / y
+	case jparse.NumericModulo:
+		res = math.Mod(x, y)
+	}
+
+	switch {
+	case math.IsInf(res, 0):
+		return undefined, newError("D1001", op, `result of the "`+op+`" operator is out of range`)
+	case math.IsNaN(res):
+		return undefined, newError("D1001", op, `result of the "`+op+`" operator is not a valid number`)
+	}
+
+	return res, nil
+}
+
+func evalComparisonOperator(node *jparse.ComparisonOperatorNode, data interface{}, env *environment) (interface{}, error) {
+
+	lhs, err := eval(node.LHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	rhs, err := eval(node.RHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	op := node.Type.String()
+
+	switch node.Type {
+	case jparse.ComparisonEqual:
+		return lhs != undefined && rhs != undefined && equal(lhs, rhs), nil
+	case jparse.ComparisonNotEqual:
+		return lhs != undefined && rhs != undefined && !equal(lhs, rhs), nil
+	case jparse.ComparisonIn:
+		if lhs == undefined || rhs == undefined {
+			return false, nil
+		}
+		for _, v := range arrayify(rhs) {
+			if equal(lhs, v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	// Like jsonata-go, treat null operands as undefined.
+	if lhs == nil {
+		lhs = undefined
+	}
+	if rhs == nil {
+		rhs = undefined
+	}
+
+	if lhs != undefined && !isComparable(lhs) {
+		return undefined, newError("T2010", node.LHS.String(), `left side of the "`+op+`" operator must evaluate to a number or string`)
+	}
+
+	if rhs != undefined && !isComparable(rhs) {
+		return undefined, newError("T2010", node.RHS.String(), `right side of the "`+op+`" operator must evaluate to a number or string`)
+	}
+
+	if lhs == undefined || rhs == undefined {
+		return false, nil
+	}
+
+	c, ok := compare(lhs, rhs)
+	if !ok {
+		return undefined, newError("T2009", op, `both sides of the "`+op+`" operator must have the same type`)
+	}
+
+	switch node.Type {
+	case jparse.ComparisonLess:
+		return c < 0, nil
+	case jparse.ComparisonLessEqual:
+		return c <= 0, nil
+	case jparse.ComparisonGreater:
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func evalBooleanOperator(node *jparse.BooleanOperatorNode, data interface{}, env *environment) (interface{}, error) {
+
+	lhs, err := eval(node.LHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	// Like jsonata-go, evaluate both sides.
+	rhs, err := eval(node.RHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	if node.Type == jparse.BooleanAnd {
+		return isTruthy(lhs) && isTruthy(rhs), nil
+	}
+
+	return isTruthy(lhs) || isTruthy(rhs), nil
+}
+
+func evalStringConcatenation(node *jparse.StringConcatenationNode, data interface{}, env *environment) (interface{}, error) {
+
+	lhs, err := eval(node.LHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	rhs, err := eval(node.RHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	s1, err := stringify(lhs)
+	if err != nil {
+		return undefined, err
+	}
+
+	s2, err := stringify(rhs)
+	if err != nil {
+		return undefined, err
+	}
+
+	return s1 + s2, nil
+}
+
+// A sortItem is an item being sorted and the values of its sort
+// terms.
+type sortItem struct {
+	value interface{}
+	terms []interface{}
+}
+
+type sortItems struct {
+	items []sortItem
+	dirs  []jparse.SortDir
+}
+
+func (s sortItems) Len() int      { return len(s.items) }
+func (s sortItems) Swap(i, j int) { s.items[i], s.items[j] = s.items[j], s.items[i] }
+
+func (s sortItems) Less(i, j int) bool {
+
+	for k, dir := range s.dirs {
+
+		a, b := s.items[i].terms[k], s.items[j].terms[k]
+
+		// Undefined values sort last.
+		switch {
+		case a == undefined && b == undefined:
+			continue
+		case a == undefined:
+			return false
+		case b == undefined:
+			return true
+		}
+
+		c, _ := compare(a, b)
+		if c == 0 {
+			continue
+		}
+		if dir == jparse.SortDescending {
+			return c > 0
+		}
+		return c < 0
+	}
+
+	return false
+}
+
+func evalSort(node *jparse.SortNode, data interface{}, env *environment) (interface{}, error) {
+
+	v, err := eval(node.Expr, data, env)
+	if err != nil || v == undefined {
+		return undefined, err
+	}
+
+	s := sortItems{
+		dirs: make([]jparse.SortDir, len(node.Terms)),
+	}
+	for i, term := range node.Terms {
+		s.dirs[i] = term.Dir
+	}
+
+	for _, item := range arrayify(v) {
+		terms := make([]interface{}, len(node.Terms))
+		for i, term := range node.Terms {
+			if terms[i], err = eval(term.Expr, item, env); err != nil {
+				return undefined, err
+			}
+			if terms[i] == nil {
+				terms[i] = undefined
+			}
+		}
+		s.items = append(s.items, sortItem{value: item, terms: terms})
+	}
+
+	for i, term := range node.Terms {
+		first := undefined
+		for _, item := range s.items {
+			t := item.terms[i]
+			if t == undefined {
+				continue
+			}
+			if !isComparable(t) {
+				return undefined, newError("T2008", term.Expr.String(), "expressions in a sort term must evaluate to strings or numbers")
+			}
+			if first == undefined {
+				first = t
+			} else if _, ok := compare(first, t); !ok {
+				return undefined, newError("T2007", term.Expr.String(), "expressions in a sort term must have the same type")
+			}
+		}
+	}
+
+	sort.Stable(s)
+
+	results := make([]interface{}, len(s.items))
+	for i, item := range s.items {
+		results[i] = item.value
+	}
+
+	return &sequence{values: results, keepArray: true}, nil
+}
+
+func evalFunctionCall(node *jparse.FunctionCallNode, data interface{}, env *environment) (interface{}, error) {
+
+	fn, err := eval(node.Func, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	args := make([]interface{}, len(node.Args))
+	for i, arg := range node.Args {
+		if args[i], err = eval(arg, data, env); err != nil {
+			return undefined, err
+		}
+	}
+
+	return call(fn, node.Func.String(), args, data, env)
+}
+
+func evalFunctionApplication(node *jparse.FunctionApplicationNode, data interface{}, env *environment) (interface{}, error) {
+
+	if c, ok := node.RHS.(*jparse.FunctionCallNode); ok {
+		g := *c
+		g.Args = append([]jparse.Node{node.LHS}, c.Args...)
+		return evalFunctionCall(&g, data, env)
+	}
+
+	lhs, err := eval(node.LHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	fn, err := eval(node.RHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	if !isFunction(fn) {
+		return undefined, newError("T2006", node.RHS.String(), "cannot use function application with non-function "+node.RHS.String())
+	}
+
+	return call(fn, node.RHS.String(), []interface{}{lhs}, data, env)
+}
+
+// A lambda is a function defined in an expression.
+type lambda struct {
+	node *jparse.LambdaNode
+	env  *environment
+}
+
+func isFunction(v interface{}) bool {
+	switch v.(type) {
+	case *lambda, *builtin:
+		return true
+	default:
+		return false
+	}
+}
+
+// call calls a function with the given arguments. data is the
+// context value, which built-in functions that take it use when
+// their first argument is left out.
+func call(fn interface{}, name string, args []interface{}, data interface{}, env *environment) (interface{}, error) {
+
+	if env.depth >= maxDepth {
+		return undefined, newError("U1001", name, "stack overflow error: check for a non-terminating recursive function")
+	}
+
+	switch fn := fn.(type) {
+	case *lambda:
+		local := newEnvironment(fn.env)
+		local.depth = env.depth + 1
+		for i, param := range fn.node.ParamNames {
+			v := undefined
+			if i < len(args) {
+				v = args[i]
+			}
+			local.bind(param, v)
+		}
+		return eval(fn.node.Body, data, local)
+
+	case *builtin:
+		if fn.context && len(args) == fn.minArgs-1 {
+			args = append([]interface{}{data}, args...)
+		}
+		if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+			return undefined, newError("T0410", name, "function "+name+" takes "+argCount(fn)+" arguments")
+		}
+		if !fn.undefinedOK && args[0] == undefined {
+			return undefined, nil
+		}
+		local := newEnvironment(env)
+		local.depth = env.depth + 1
+		v, err := fn.fn(args, local)
+		if err != nil {
+			return undefined, err
+		}
+		return collapse(v), nil
+
+	default:
+		return undefined, newError("T1006", name, "cannot call non-function "+name)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// tinygocheck is built with TinyGo in CI to check that jlite
+// and jparse still compile for TinyGo targets:
+//
+//	tinygo build -o jlite.wasm -target wasi ./jlite/internal/tinygocheck
+//
+// It evaluates the expression given as its argument, with no
+// input, and prints the result.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/iwongu/jsonata-go/jlite"
+)
+
+func main() {
+
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: tinygocheck <expression>")
+		os.Exit(2)
+	}
+
+	e, err := jlite.Compile(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	res, err := e.Eval(nil, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println(res)
+}
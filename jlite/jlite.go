@@ -0,0 +1,190 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jlite is a reduced JSONata engine for small targets,
+// such as embedded gateways built with TinyGo. It evaluates the
+// same syntax trees as jsonata-go (see jparse) but without the
+// reflection-based extension layer: input is limited to the
+// values that encoding/json produces, and only a subset of the
+// operators and built-in functions are available.
+//
+//	e, err := jlite.Compile(`$sum(readings[temp > 30].temp)`)
+//	if err != nil { ... }
+//	res, err := e.Eval(data, nil)
+//
+// Input data and variables must be made of these types:
+//
+//	nil                      (JSON null)
+//	bool
+//	float64 (or int, int64)  (JSON number)
+//	string
+//	[]interface{}
+//	map[string]interface{}
+//
+// Results are made of the same types, with float64 numbers.
+//
+// Expressions support paths, predicates, wildcards and
+// descendants, sorting (^), grouping, the arithmetic, comparison,
+// boolean and string operators, conditionals, ranges, array and
+// object constructors, blocks, variables, lambdas, function calls
+// and function application (~>). Compile rejects regular
+// expressions, object transformations (|...|), partial
+// application and function signatures. See Builtins for the
+// functions that are available.
+//
+// jlite imports jparse and a few packages from the standard
+// library that TinyGo supports, and neither package uses the
+// reflect package directly. Programs that need the full engine
+// should use the jsonata package instead; the two can be used
+// side by side.
+package jlite
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// ErrUndefined is returned by Eval when an expression yields no
+// results. See jsonata.ErrUndefined.
+var ErrUndefined = errors.New("no results found")
+
+// An Error describes an evaluation error, or an expression that
+// jlite can't evaluate.
+type Error struct {
+	// Code is the JSONata error code, e.g. "T2001", or empty
+	// for errors that are specific to jlite.
+	Code string
+
+	// Token is the part of the expression that caused the
+	// error, if it's known.
+	Token string
+
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(code, token, msg string) *Error {
+	return &Error{
+		Code:    code,
+		Token:   token,
+		Message: msg,
+	}
+}
+
+// An Expression is a compiled JSONata expression. It's safe for
+// concurrent use.
+type Expression struct {
+	node jparse.Node
+}
+
+// Compile parses a JSONata expression. It returns a jparse.Error
+// if the expression has a syntax error and an *Error if it uses
+// a feature that jlite doesn't support.
+func Compile(expr string) (*Expression, error) {
+
+	node, err := jparse.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkNode(node); err != nil {
+		return nil, err
+	}
+
+	return &Expression{
+		node: node,
+	}, nil
+}
+
+// MustCompile is like Compile except that it panics if the
+// expression can't be compiled.
+func MustCompile(expr string) *Expression {
+
+	e, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+
+	return e
+}
+
+// String returns the expression's source, as recreated from its
+// syntax tree.
+func (e *Expression) String() string {
+	return e.node.String()
+}
+
+// Eval evaluates the expression against data, with the variables
+// vars, which may be nil. It returns ErrUndefined if the result
+// is undefined.
+func (e *Expression) Eval(data interface{}, vars map[string]interface{}) (interface{}, error) {
+
+	env := newEnvironment(baseEnv)
+	for name, v := range vars {
+		env.bind(name, v)
+	}
+
+	v, err := eval(e.node, data, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == undefined {
+		return nil, ErrUndefined
+	}
+
+	return v, nil
+}
+
+// checkNode returns an error if node contains a feature that
+// jlite doesn't support.
+func checkNode(node jparse.Node) error {
+
+	var err error
+
+	jparse.Walk(node, func(n jparse.Node) bool {
+		if err != nil {
+			return false
+		}
+
+		var feature string
+		switch n.(type) {
+		case *jparse.RegexNode:
+			feature = "regular expressions"
+		case *jparse.ObjectTransformationNode:
+			feature = "object transformations"
+		case *jparse.PartialNode, *jparse.PlaceholderNode:
+			feature = "partial application"
+		case *jparse.TypedLambdaNode:
+			feature = "function signatures"
+		default:
+			return true
+		}
+
+		err = newError("", n.String(), "jlite does not support "+feature)
+		return false
+	})
+
+	return err
+}
+
+// Builtins returns the names of the built-in functions that
+// jlite provides, in alphabetical order. They behave like their
+// jsonata-go equivalents, except that $contains and $split take
+// strings rather than regular expressions.
+func Builtins() []string {
+
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
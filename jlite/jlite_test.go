@@ -0,0 +1,250 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlite
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+const testData = `{
+	"name": "gateway-7",
+	"tags": ["edge", "north"],
+	"readings": [
+		{"sensor": "a", "temp": 21.5, "ok": true},
+		{"sensor": "b", "temp": 35, "ok": false},
+		{"sensor": "a", "temp": 32.25, "ok": true},
+		{"sensor": "c"}
+	],
+	"nested": {"x": {"y": [1, [2, 3]]}}
+}`
+
+// TestEval compares jlite's results with jsonata-go's.
+func TestEval(t *testing.T) {
+
+	var data interface{}
+	if err := json.Unmarshal([]byte(testData), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]interface{}{
+		"limit": 30.0,
+	}
+
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	for _, expr := range []string{
+		`name`,
+		`missing`,
+		`readings.temp`,
+		`readings[0]`,
+		`readings[-1].sensor`,
+		`readings[temp > $limit].sensor`,
+		`readings[ok].temp`,
+		`readings[[0, 2]].temp`,
+		`readings[sensor = "a"][1].temp`,
+		`tags[]`,
+		`name[]`,
+		`nested.x.y`,
+		`nested.*`,
+		`**.y`,
+		`**.sensor`,
+		`readings.[sensor, ok]`,
+		`$sum(readings.temp)`,
+		`$max(readings.temp) - $min(readings.temp)`,
+		`$average([1, 2, 4])`,
+		`$count(readings)`,
+		`$count(missing)`,
+		`$round(2.5) + $round(3.5) + $round(1.255, 2)`,
+		`$abs(-3) * $floor(2.7) / $ceil(1.2) % 4`,
+		`$power(2, 10) + $sqrt(16)`,
+		`-readings[0].temp`,
+		`[1..5][$ % 2 = 1]`,
+		`$string(readings[0])`,
+		`$string(0.000001234) & $string(1e21) & $string(true)`,
+		`name & "/" & $uppercase(tags[0]) & "/" & $length(name)`,
+		`$substring(name, -1) & $substring(name, 0, 3) & $substringBefore(name, "-") & $substringAfter(name, "-")`,
+		`$trim("  a  b ") & $lowercase("ABC")`,
+		`$contains(name, "way") and $exists(tags)`,
+		`$split("a,b,c", ",", 2)`,
+		`$join(tags, "+")`,
+		`$number("12.5e1") + $number(true)`,
+		`$boolean([0, ""]) or $not(name)`,
+		`"b" in readings.sensor`,
+		`readings[0] = {"sensor": "a", "temp": 21.5, "ok": true}`,
+		`$append(tags, "south")`,
+		`$reverse(tags)`,
+		`$distinct(readings.sensor)`,
+		`$count($keys(readings))`,
+		`$lookup(readings, "sensor")`,
+		`$merge([{"a": 1}, {"b": 2}, {"a": 3}])`,
+		`$map(readings, function($v, $i) {$v.sensor & $i})`,
+		`$map(tags, $uppercase)`,
+		`$filter(readings, function($v) {$v.temp > 30}).sensor`,
+		`$reduce([1, 2, 3, 4], function($acc, $v) {$acc * $v})`,
+		`readings^(>temp).sensor`,
+		`readings^(sensor, >temp).temp`,
+		`readings{sensor: $sum(temp)}`,
+		`{"count": $count(readings), "sensors": readings.sensor}`,
+		`readings.{"s": sensor}`,
+		`($f := function($n) {$n < 2 ? $n : $f($n - 1) + $f($n - 2)}; $f(10))`,
+		`($x := 1; ($x := 2); $x)`,
+		`readings[0].temp > 20 ? "warm" : "cold"`,
+		`tags ~> $join(",")`,
+		`name ~> $uppercase`,
+		`readings.temp.$string()`,
+		`readings[0].sensor.$uppercase()`,
+	} {
+		want, wantErr := comp.MustCompile(expr).Eval(data, vars)
+		got, gotErr := MustCompile(expr).Eval(data, vars)
+
+		if (wantErr == nil) != (gotErr == nil) || (gotErr == ErrUndefined) != (wantErr == jsonata.ErrUndefined) {
+			t.Errorf("%s: expected error %v, got %v", expr, wantErr, gotErr)
+			continue
+		}
+
+		if !reflect.DeepEqual(normalize(t, want), normalize(t, got)) {
+			t.Errorf("%s: expected %v, got %v", expr, want, got)
+		}
+	}
+}
+
+// normalize converts a value to its JSON form, so that values
+// from the two engines can be compared.
+func normalize(t *testing.T, v interface{}) interface{} {
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("cannot marshal %v: %v", v, err)
+	}
+
+	var res interface{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestErrors(t *testing.T) {
+
+	data := map[string]interface{}{
+		"s": "text",
+		"n": 1,
+	}
+
+	for _, test := range []struct {
+		Expr string
+		Code string
+	}{
+		{`s + 1`, "T2001"},
+		{`n - s`, "T2002"},
+		{`s < 1`, "T2009"},
+		{`[1] < 2`, "T2010"},
+		{`n / 0`, "D1001"},
+		{`[1.5..3]`, "T2003"},
+		{`$uppercase(n)`, "T0410"},
+		{`$sum(["a"])`, "T0410"},
+		{`$substring()`, "T0410"},
+		{`$number("1x")`, "D3030"},
+		{`s()`, "T1006"},
+		{`n ~> s`, "T2006"},
+		{`{"a": 1, "a": 2}`, "D1009"},
+		{`{n: 1}`, "T1003"},
+		{`($f := function() {$f()}; $f())`, "U1001"},
+	} {
+		_, err := MustCompile(test.Expr).Eval(data, nil)
+
+		e, ok := err.(*Error)
+		if !ok || e.Code != test.Code {
+			t.Errorf("%s: expected error %s, got %v", test.Expr, test.Code, err)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+
+	for _, expr := range []string{
+		`$match(s, /a+/)`,
+		`$ ~> |a|{"b": 1}|`,
+		`$substring(?, 1)`,
+		`function($x)<n:n>{$x}`,
+	} {
+		_, err := Compile(expr)
+		if e, ok := err.(*Error); !ok || e.Code != "" {
+			t.Errorf("%s: expected an unsupported feature error, got %v", expr, err)
+		}
+	}
+
+	if _, err := Compile(`a +`); err == nil {
+		t.Errorf("expected a syntax error")
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	// Every jlite function should exist in jsonata-go.
+	for _, name := range Builtins() {
+		expr := "$" + name
+		res, err := comp.MustCompile(expr).Eval(nil, nil)
+		if err != nil || res == nil {
+			t.Errorf("%s: not a jsonata-go function: %v", expr, err)
+		}
+	}
+}
+
+// TestImports checks that jlite and jparse don't import
+// reflection-heavy packages, which TinyGo only partly supports.
+func TestImports(t *testing.T) {
+
+	banned := map[string]bool{
+		"reflect":                             true,
+		"encoding/json":                       true,
+		"github.com/iwongu/jsonata-go/jtypes": true,
+		"github.com/iwongu/jsonata-go/jlib":   true,
+	}
+
+	for _, dir := range []string{".", "../jparse"} {
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, file := range files {
+
+			if matched, _ := filepath.Match("*_test.go", filepath.Base(file)); matched {
+				continue
+			}
+
+			f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, imp := range f.Imports {
+				path, _ := strconv.Unquote(imp.Path.Value)
+				if banned[path] {
+					t.Errorf("%s imports %s", file, path)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+func asNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// arrayify returns v if it's an array, and otherwise an array
+// containing v. Undefined becomes an empty array.
+func arrayify(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case undefinedType:
+		return nil
+	default:
+		return []interface{}{v}
+	}
+}
+
+// flatten appends the items of an array, and of any arrays
+// nested in it, to dst.
+func flatten(dst, a []interface{}) []interface{} {
+	for _, v := range a {
+		if b, ok := v.([]interface{}); ok {
+			dst = flatten(dst, b)
+		} else {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
+
+// isTruthy converts a value to a boolean using JSONata's casting
+// rules (see the $boolean function).
+func isTruthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		for _, item := range v {
+			if isTruthy(item) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+
+	n, ok := asNumber(v)
+	return ok && n != 0
+}
+
+func isComparable(v interface{}) bool {
+	_, isNum := asNumber(v)
+	_, isStr := v.(string)
+	return isNum || isStr
+}
+
+// compare compares two numbers or two strings. The boolean
+// return value is false if they aren't the same type.
+func compare(a, b interface{}) (int, bool) {
+
+	if x, ok := asNumber(a); ok {
+		y, ok := asNumber(b)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+
+	return 0, false
+}
+
+// equal reports whether two values are deeply equal. Functions
+// are only equal to themselves.
+func equal(a, b interface{}) bool {
+
+	if x, ok := asNumber(a); ok {
+		y, ok := asNumber(b)
+		return ok && x == y
+	}
+
+	switch a := a.(type) {
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, v := range a {
+			w, ok := b[key]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case nil, bool, string, *lambda, *builtin:
+		return a == b
+	default:
+		return false
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// stringify converts a value to a string like the $string
+// function. Strings are unchanged, functions and undefined
+// become the empty string and other values are converted to
+// JSON.
+func stringify(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case undefinedType, *lambda, *builtin:
+		return "", nil
+	}
+
+	b, err := appendJSON(nil, v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// appendJSON appends the JSON encoding of v to dst. Numbers
+// and strings are formatted like encoding/json formats them,
+// and object keys are sorted.
+func appendJSON(dst []byte, v interface{}) ([]byte, error) {
+
+	if n, ok := asNumber(v); ok {
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, newError("D3001", "", "attempting to invoke string function on Infinity or NaN")
+		}
+		return appendNumber(dst, n), nil
+	}
+
+	var err error
+
+	switch v := v.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case bool:
+		return strconv.AppendBool(dst, v), nil
+	case string:
+		return appendString(dst, v), nil
+	case []interface{}:
+		dst = append(dst, '[')
+		for i, item := range v {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			if item == undefined || isFunction(item) {
+				dst = append(dst, "null"...)
+				continue
+			}
+			if dst, err = appendJSON(dst, item); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, ']'), nil
+	case map[string]interface{}:
+		dst = append(dst, '{')
+		first := true
+		for _, key := range sortedKeys(v) {
+			item := v[key]
+			if item == undefined || isFunction(item) {
+				continue
+			}
+			if !first {
+				dst = append(dst, ',')
+			}
+			first = false
+			dst = appendString(dst, key)
+			dst = append(dst, ':')
+			if dst, err = appendJSON(dst, item); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, '}'), nil
+	default:
+		return append(dst, "null"...), nil
+	}
+}
+
+func appendNumber(dst []byte, n float64) []byte {
+
+	format := byte('f')
+	if abs := math.Abs(n); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+
+	start := len(dst)
+	dst = strconv.AppendFloat(dst, n, format, -1, 64)
+
+	if format == 'e' {
+		// Change e-09 to e-9, as encoding/json does.
+		b := dst[start:]
+		if k := len(b); k >= 4 && b[k-4] == 'e' && b[k-3] == '-' && b[k-2] == '0' {
+			b[k-2] = b[k-1]
+			dst = dst[:len(dst)-1]
+		}
+	}
+
+	return dst
+}
+
+func appendString(dst []byte, s string) []byte {
+
+	const hex = "0123456789abcdef"
+
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < 0x20:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, "\ufffd"...)
+		} else {
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+
+	return append(dst, '"')
+}
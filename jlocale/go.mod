@@ -0,0 +1,10 @@
+module github.com/iwongu/jsonata-go/jlocale
+
+go 1.22
+
+require (
+	github.com/iwongu/jsonata-go v0.0.0
+	golang.org/x/text v0.14.0
+)
+
+replace github.com/iwongu/jsonata-go => ../
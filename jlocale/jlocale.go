@@ -0,0 +1,95 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jlocale makes the string functions of JSONata
+// expressions follow the rules of a language. Pass WithLanguage to
+// jsonata.NewCompiler:
+//
+//	comp, err := jsonata.NewCompiler(nil, exts,
+//	    jlocale.WithLanguage(language.Turkish))
+//
+// $uppercase and $lowercase then use the language's case
+// mappings, so that "i" becomes "İ" in Turkish and "ß" becomes
+// "SS" in German, and the order-by operator (^) and $sort sort
+// strings in the language's collation order, so that "ä" sorts
+// with "a" in German but after "z" in Swedish.
+//
+// jlocale is a separate module so that jsonata-go itself doesn't
+// depend on golang.org/x/text.
+package jlocale
+
+import (
+	"sync"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/jlib"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// WithLanguage sets both the case mappings and the collation order
+// of expressions compiled by a Compiler to those of tag. It's
+// equivalent to passing the results of CaseMapping and Collation
+// to jsonata.WithCaseMapping and jsonata.WithCollation.
+func WithLanguage(tag language.Tag) jsonata.CompilerOption {
+
+	upper, lower := CaseMapping(tag)
+	withCase := jsonata.WithCaseMapping(upper, lower)
+	withCollation := jsonata.WithCollation(Collation(tag))
+
+	return func(c *jsonata.Compiler) error {
+		if err := withCase(c); err != nil {
+			return err
+		}
+		return withCollation(c)
+	}
+}
+
+// CaseMapping returns functions that convert strings to upper
+// and lower case with the rules of tag, for use with
+// jsonata.WithCaseMapping. They're safe for concurrent use.
+func CaseMapping(tag language.Tag) (upper, lower func(string) string) {
+	return casePool(cases.Upper, tag), casePool(cases.Lower, tag)
+}
+
+// casePool returns a function that converts strings with the
+// Casers made by newCaser. Casers keep state between calls, so
+// each goroutine needs its own.
+func casePool(newCaser func(language.Tag, ...cases.Option) cases.Caser, tag language.Tag) func(string) string {
+
+	pool := sync.Pool{
+		New: func() interface{} {
+			c := newCaser(tag)
+			return &c
+		},
+	}
+
+	return func(s string) string {
+		c := pool.Get().(*cases.Caser)
+		defer pool.Put(c)
+		return c.String(s)
+	}
+}
+
+// Collation returns the collation order of tag, for use with
+// jsonata.WithCollation. Options such as collate.IgnoreCase or
+// collate.Numeric adjust the order. The function is safe for
+// concurrent use.
+func Collation(tag language.Tag, opts ...collate.Option) jlib.CompareFunc {
+
+	// Collators reuse buffers between calls, so each goroutine
+	// needs its own.
+	pool := sync.Pool{
+		New: func() interface{} {
+			return collate.New(tag, opts...)
+		},
+	}
+
+	return func(a, b string) int {
+		c := pool.Get().(*collate.Collator)
+		defer pool.Put(c)
+		return c.CompareString(a, b)
+	}
+}
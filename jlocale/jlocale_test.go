@@ -0,0 +1,71 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jlocale
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+func TestWithLanguage(t *testing.T) {
+
+	var words []interface{}
+	for _, w := range []string{"Zebra", "äpple", "apple", "öl", "zoo"} {
+		words = append(words, map[string]interface{}{"word": w})
+	}
+
+	tests := []struct {
+		Tag    language.Tag
+		Expr   string
+		Output interface{}
+	}{
+		{language.Turkish, `$uppercase("istanbul")`, "İSTANBUL"},
+		{language.Turkish, `$lowercase("DİYARBAKIR")`, "diyarbakır"},
+		{language.English, `$uppercase("istanbul")`, "ISTANBUL"},
+		{language.German, `$uppercase("straße")`, "STRASSE"},
+		{language.German, `$sort(words.word)`, []interface{}{"apple", "äpple", "öl", "Zebra", "zoo"}},
+		{language.Swedish, `$sort(words.word)`, []interface{}{"apple", "Zebra", "zoo", "äpple", "öl"}},
+		{language.Swedish, `words^(>word).word`, []interface{}{"öl", "äpple", "zoo", "Zebra", "apple"}},
+	}
+
+	for _, test := range tests {
+
+		comp, err := jsonata.NewCompiler(nil, nil, WithLanguage(test.Tag))
+		if err != nil {
+			t.Fatalf("NewCompiler failed: %v", err)
+		}
+
+		got, err := comp.MustCompile(test.Expr).Eval(map[string]interface{}{"words": words}, nil)
+		if err != nil || !reflect.DeepEqual(got, test.Output) {
+			t.Errorf("%s: %s: expected %v, got %v (error %v)", test.Tag, test.Expr, test.Output, got, err)
+		}
+	}
+}
+
+func TestCollation(t *testing.T) {
+
+	cmp := Collation(language.English, collate.Numeric)
+
+	// The function can be used from many goroutines at once.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if cmp("item 9", "item 10") >= 0 {
+					t.Errorf("expected item 9 to sort before item 10")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,359 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jmsgpack
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidData is wrapped by the errors for MessagePack data
+// that's malformed or can't be converted to JSONata values.
+var ErrInvalidData = errors.New("invalid data")
+
+// maxDepth is the maximum nesting of arrays and maps in the data
+// that Decode accepts.
+const maxDepth = 10000
+
+// extTimestamp is the extension type of timestamps.
+const extTimestamp = -1
+
+// Decode converts a single MessagePack object to JSONata values.
+// Maps become objects, arrays become arrays, and integers and
+// floats become float64s, as they would be for the same message
+// in JSON. Binary data becomes a base64 string, as encoding/json
+// encodes a []byte, and timestamps become RFC 3339 strings in
+// UTC. Map keys must be strings or integers, and integer keys
+// are converted to decimal strings. Other extension types,
+// infinities and NaNs are errors, and so is data after the first
+// object.
+func Decode(data []byte) (interface{}, error) {
+
+	d := &decoder{data: data}
+
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.off < len(d.data) {
+		return nil, d.errorf("%d bytes after the message", len(d.data)-d.off)
+	}
+
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("msgpack: offset %d: %w: %s", d.off, ErrInvalidData, fmt.Sprintf(format, a...))
+}
+
+// next returns the next n bytes.
+func (d *decoder) next(n uint64) ([]byte, error) {
+
+	if n > uint64(len(d.data)-d.off) {
+		return nil, d.errorf("unexpected end of data")
+	}
+
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of n bytes.
+func (d *decoder) uint(n int) (uint64, error) {
+
+	b, err := d.next(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+
+	return u, nil
+}
+
+// int reads a big-endian two's complement integer of n bytes.
+func (d *decoder) int(n int) (int64, error) {
+
+	u, err := d.uint(n)
+	if err != nil {
+		return 0, err
+	}
+
+	shift := uint(64 - 8*n)
+	return int64(u<<shift) >> shift, nil
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+
+	if depth > maxDepth {
+		return nil, d.errorf("data is nested too deeply")
+	}
+
+	start := d.off
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return float64(c), nil
+	case c >= 0xe0:
+		return float64(int8(c)), nil
+	case c <= 0x8f:
+		return d.decodeMap(uint64(c&0x0f), depth)
+	case c <= 0x9f:
+		return d.decodeArray(uint64(c&0x0f), depth)
+	case c <= 0xbf:
+		return d.str(uint64(c&0x1f), start)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n, start)
+
+	case 0xca, 0xcb:
+		var f float64
+		if c == 0xca {
+			u, err := d.uint(4)
+			if err != nil {
+				return nil, err
+			}
+			f = float64(math.Float32frombits(uint32(u)))
+		} else {
+			u, err := d.uint(8)
+			if err != nil {
+				return nil, err
+			}
+			f = math.Float64frombits(u)
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			d.off = start
+			return nil, d.errorf("%v is not a valid JSONata number", f)
+		}
+		return f, nil
+
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return float64(u), nil
+
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n, err := d.int(1 << (c - 0xd0))
+		if err != nil {
+			return nil, err
+		}
+		return float64(n), nil
+
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1<<(c-0xd4), start)
+
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n, start)
+
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n, depth)
+
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n, depth)
+
+	default:
+		d.off = start
+		return nil, d.errorf("invalid format 0x%02x", c)
+	}
+}
+
+func (d *decoder) decodeArray(n uint64, depth int) (interface{}, error) {
+
+	if n > uint64(len(d.data)-d.off) {
+		return nil, d.errorf("array of %d items is longer than the data", n)
+	}
+
+	items := make([]interface{}, n)
+	for i := range items {
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+
+	return items, nil
+}
+
+func (d *decoder) decodeMap(n uint64, depth int) (interface{}, error) {
+
+	if n > uint64(len(d.data)-d.off)/2 {
+		return nil, d.errorf("map of %d pairs is longer than the data", n)
+	}
+
+	m := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		key, err := d.key()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+
+	return m, nil
+}
+
+// key reads a map key.
+func (d *decoder) key() (string, error) {
+
+	start := d.off
+	b, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return strconv.Itoa(int(c)), nil
+	case c >= 0xe0:
+		return strconv.Itoa(int(int8(c))), nil
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(uint64(c&0x1f), start)
+	case c >= 0xcc && c <= 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatUint(u, 10), nil
+	case c >= 0xd0 && c <= 0xd3:
+		n, err := d.int(1 << (c - 0xd0))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	case c >= 0xd9 && c <= 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return "", err
+		}
+		return d.str(n, start)
+	default:
+		d.off = start
+		return "", d.errorf("map keys must be strings or integers")
+	}
+}
+
+// str reads a string of n bytes.
+func (d *decoder) str(n uint64, start int) (string, error) {
+
+	b, err := d.next(n)
+	if err != nil {
+		return "", err
+	}
+
+	if !utf8.Valid(b) {
+		d.off = start
+		return "", d.errorf("string is not valid UTF-8")
+	}
+
+	return string(b), nil
+}
+
+// ext reads an extension object with n bytes of data. Only
+// timestamps are supported.
+func (d *decoder) ext(n uint64, start int) (interface{}, error) {
+
+	typ, err := d.int(1)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if typ != extTimestamp {
+		d.off = start
+		return nil, d.errorf("unsupported extension type %d", typ)
+	}
+
+	var sec, nsec int64
+	switch n {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(b))
+	case 8:
+		u := binary.BigEndian.Uint64(b)
+		nsec, sec = int64(u>>34), int64(u&(1<<34-1))
+	case 12:
+		nsec, sec = int64(binary.BigEndian.Uint32(b)), int64(binary.BigEndian.Uint64(b[4:]))
+	default:
+		d.off = start
+		return nil, d.errorf("timestamp of %d bytes", n)
+	}
+
+	if nsec > 999999999 {
+		d.off = start
+		return nil, d.errorf("timestamp has %d nanoseconds", nsec)
+	}
+
+	return time.Unix(sec, nsec).UTC().Format(time.RFC3339Nano), nil
+}
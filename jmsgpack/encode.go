@@ -0,0 +1,228 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jmsgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// maxSafeInteger is the largest integer that a float64 holds
+// exactly.
+const maxSafeInteger = 1 << 53
+
+// Encode writes a JSONata result, such as a value returned by
+// Expression.Eval, as a MessagePack object. Numbers that are
+// integers are written in the smallest integer format that holds
+// them, and other numbers as float64s. Map keys are written in
+// sorted order, as encoding/json writes them. Values that aren't
+// JSON values, such as Go structs, are encoded as encoding/json
+// would encode them.
+func Encode(v interface{}) ([]byte, error) {
+
+	var e encoder
+	if err := e.encode(reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+// be writes the low n bytes of u in big-endian order.
+func (e *encoder) be(u uint64, n int) {
+	for shift := 8 * (n - 1); shift >= 0; shift -= 8 {
+		e.buf.WriteByte(byte(u >> uint(shift)))
+	}
+}
+
+func (e *encoder) uint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		e.buf.WriteByte(0xcc)
+		e.be(u, 1)
+	case u <= math.MaxUint16:
+		e.buf.WriteByte(0xcd)
+		e.be(u, 2)
+	case u <= math.MaxUint32:
+		e.buf.WriteByte(0xce)
+		e.be(u, 4)
+	default:
+		e.buf.WriteByte(0xcf)
+		e.be(u, 8)
+	}
+}
+
+func (e *encoder) int(n int64) {
+	switch {
+	case n >= 0:
+		e.uint(uint64(n))
+	case n >= -32:
+		e.buf.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		e.buf.WriteByte(0xd0)
+		e.be(uint64(n), 1)
+	case n >= math.MinInt16:
+		e.buf.WriteByte(0xd1)
+		e.be(uint64(n), 2)
+	case n >= math.MinInt32:
+		e.buf.WriteByte(0xd2)
+		e.be(uint64(n), 4)
+	default:
+		e.buf.WriteByte(0xd3)
+		e.be(uint64(n), 8)
+	}
+}
+
+func (e *encoder) float(f float64) error {
+
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("msgpack: cannot encode %v", f)
+	}
+
+	if f == math.Trunc(f) && math.Abs(f) <= maxSafeInteger {
+		e.int(int64(f))
+		return nil
+	}
+
+	e.buf.WriteByte(0xcb)
+	e.be(math.Float64bits(f), 8)
+
+	return nil
+}
+
+// header writes the format and size of a string, binary data,
+// array or map of n elements. fixMax is the largest size of the
+// fixed format, which has the size in the low bits of fix, or -1
+// if there's none. f8 is the format with an 8-bit size, or 0 if
+// there's none, and f16 the format with a 16-bit size, which is
+// followed by the one with a 32-bit size.
+func (e *encoder) header(n int, fix byte, fixMax int, f8, f16 byte) {
+	switch {
+	case n <= fixMax:
+		e.buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint8 && f8 != 0:
+		e.buf.WriteByte(f8)
+		e.be(uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(f16)
+		e.be(uint64(n), 2)
+	default:
+		e.buf.WriteByte(f16 + 1)
+		e.be(uint64(n), 4)
+	}
+}
+
+func (e *encoder) str(s string) {
+	e.header(len(s), 0xa0, 31, 0xd9, 0xda)
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) encode(v reflect.Value, depth int) error {
+
+	if depth > maxDepth {
+		return fmt.Errorf("msgpack: value is nested too deeply")
+	}
+
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			v = reflect.Value{}
+			break
+		}
+		if v.Type().Implements(jsonMarshalerType) {
+			return e.encodeJSON(v, depth)
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		e.buf.WriteByte(0xc0)
+		return nil
+	}
+
+	if v.Type().Implements(jsonMarshalerType) || (v.CanAddr() && reflect.PtrTo(v.Type()).Implements(jsonMarshalerType)) {
+		return e.encodeJSON(v, depth)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(0xc3)
+		} else {
+			e.buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return e.float(v.Float())
+	case reflect.String:
+		e.str(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			e.header(v.Len(), 0, -1, 0xc4, 0xc5)
+			e.buf.Write(v.Bytes())
+			return nil
+		}
+		e.header(v.Len(), 0x90, 15, 0, 0xdc)
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return e.encodeJSON(v, depth)
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		e.header(len(keys), 0x80, 15, 0, 0xde)
+		for _, key := range keys {
+			e.str(key.String())
+			if err := e.encode(v.MapIndex(key), depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return e.encodeJSON(v, depth)
+	}
+
+	return nil
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// encodeJSON writes a value that isn't a JSON value as its JSON
+// encoding would decode.
+func (e *encoder) encodeJSON(v reflect.Value, depth int) error {
+
+	if !v.CanInterface() {
+		return fmt.Errorf("msgpack: cannot encode unexported value of type %s", v.Type())
+	}
+
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Errorf("msgpack: %w", err)
+	}
+
+	var x interface{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		return fmt.Errorf("msgpack: %w", err)
+	}
+
+	return e.encode(reflect.ValueOf(x), depth+1)
+}
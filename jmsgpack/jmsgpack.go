@@ -0,0 +1,39 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jmsgpack evaluates JSONata expressions over
+// MessagePack payloads. Decode converts a message directly to
+// the values that JSONata works with, and Encode writes a result
+// back out as MessagePack, so a message never passes through
+// JSON:
+//
+//	req := <-calls
+//	resp, err := jmsgpack.Eval(ctx, expr, req, nil)
+//
+// jmsgpack has no dependencies outside the standard library.
+package jmsgpack
+
+import (
+	"context"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+// Eval decodes a MessagePack message, evaluates e against it and
+// returns the result as MessagePack. Like EvalContext, it returns
+// jsonata.ErrUndefined if the expression evaluates to undefined.
+func Eval(ctx context.Context, e *jsonata.Expression, msg []byte, vars map[string]interface{}) ([]byte, error) {
+
+	v, err := Decode(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.EvalContext(ctx, v, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return Encode(res)
+}
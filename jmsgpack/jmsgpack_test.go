@@ -0,0 +1,171 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jmsgpack
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+func TestDecode(t *testing.T) {
+
+	for _, test := range []struct {
+		Hex   string
+		Value interface{}
+	}{
+		{"00", 0.0},
+		{"7f", 127.0},
+		{"ff", -1.0},
+		{"e0", -32.0},
+		{"cc80", 128.0},
+		{"cdffff", 65535.0},
+		{"cfffffffffffffffff", 18446744073709551615.0},
+		{"d0ff", -1.0},
+		{"d18000", -32768.0},
+		{"d3ffffffffffffffff", -1.0},
+		{"ca3fc00000", 1.5},
+		{"cb3ff199999999999a", 1.1},
+		{"c0", nil},
+		{"c2", false},
+		{"c3", true},
+		{"a449455446", "IETF"},
+		{"d90449455446", "IETF"},
+		{"a2c3bc", "ü"},
+		{"c40401020304", "AQIDBA=="},
+		{"d6ff514b67b0", "2013-03-21T20:04:00Z"},
+		{"d7ff77359400514b67b0", "2013-03-21T20:04:00.5Z"},
+		{"c70cff00000000ffffffffffffffff", "1969-12-31T23:59:59Z"},
+		{"90", []interface{}{}},
+		{"9301920203920405", []interface{}{1.0, []interface{}{2.0, 3.0}, []interface{}{4.0, 5.0}}},
+		{"80", map[string]interface{}{}},
+		{"82a16101a162920203", map[string]interface{}{"a": 1.0, "b": []interface{}{2.0, 3.0}}},
+		{"810102", map[string]interface{}{"1": 2.0}},
+		{"81ffc3", map[string]interface{}{"-1": true}},
+	} {
+		got, err := Decode(mustHex(test.Hex))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Hex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.Value) {
+			t.Errorf("%s: expected %#v, got %#v", test.Hex, test.Value, got)
+		}
+	}
+
+	for _, hx := range []string{
+		"",
+		"c1",
+		"cc",
+		"0000",
+		"a2c3",
+		"a1ff",
+		"ca7f800000",
+		"cb7ff8000000000000",
+		"ddffffffff",
+		"91",
+		"81c0c0",
+		"d40101",
+		"d6ff",
+		"c703ff000000",
+	} {
+		if _, err := Decode(mustHex(hx)); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("%q: expected ErrInvalidData, got %v", hx, err)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+
+	type point struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+
+	long := strings.Repeat("x", 32)
+
+	for _, test := range []struct {
+		Value interface{}
+		Hex   string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{0.0, "00"},
+		{127.0, "7f"},
+		{128.0, "cc80"},
+		{-1.0, "ff"},
+		{-33.0, "d0df"},
+		{1000000.0, "ce000f4240"},
+		{1.1, "cb3ff199999999999a"},
+		{42, "2a"},
+		{uint64(18446744073709551615), "cfffffffffffffffff"},
+		{"IETF", "a449455446"},
+		{long, "d920" + hex.EncodeToString([]byte(long))},
+		{[]byte{1, 2, 3, 4}, "c40401020304"},
+		{[]interface{}{1.0, []interface{}{2.0, 3.0}}, "9201920203"},
+		{map[string]interface{}{"b": 2.0, "aa": 3.0, "a": 1.0}, "83a16101a2616103a16202"},
+		{point{1, 2}, "82a17801a17902"},
+	} {
+		got, err := Encode(test.Value)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.Value, err)
+			continue
+		}
+		if want := mustHex(test.Hex); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: expected %x, got %x", test.Value, want, got)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	// {"method": "sum", "params": [1, 2, 3.5]}
+	msg, err := Encode(map[string]interface{}{
+		"method": "sum",
+		"params": []interface{}{1.0, 2.0, 3.5},
+	})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	e := comp.MustCompile(`{"method": method, "result": $sum(params)}`)
+
+	out, err := Eval(context.Background(), e, msg, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	got, err := Decode(out)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	want := map[string]interface{}{"method": "sum", "result": 6.5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, err := Eval(context.Background(), comp.MustCompile(`nothing`), msg, nil); err != jsonata.ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jotel records JSONata evaluations as OpenTelemetry
+// spans. Pass its Observer to jsonata.WithObserver:
+//
+//	comp, err := jsonata.NewCompiler(nil, exts,
+//	    jsonata.WithObserver(jotel.NewObserver(nil)))
+//
+// Each evaluation is a "jsonata.eval" span that's a child of the
+// span in the context passed to EvalContext, and each function
+// call in the expression is a child span of the evaluation, or of
+// the call that it's nested in. Extensions that take a
+// context.Context get a context with the evaluation's span, so
+// their own spans are part of the same trace.
+//
+// jotel is a separate module so that jsonata-go itself doesn't
+// depend on OpenTelemetry.
+package jotel
+
+import (
+	"context"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the Observer's
+// tracer.
+const ScopeName = "github.com/iwongu/jsonata-go/jotel"
+
+// The attributes of the spans.
+const (
+	// ExpressionKey is the source of the expression.
+	ExpressionKey = attribute.Key("jsonata.expression")
+
+	// EvalIDKey is the evaluation ID (see jsonata.WithEvalID).
+	EvalIDKey = attribute.Key("jsonata.eval_id")
+
+	// FunctionKey is the name of a called function, without
+	// the leading $.
+	FunctionKey = attribute.Key("jsonata.function")
+
+	// PositionKey is the byte offset of a function call in
+	// the expression.
+	PositionKey = attribute.Key("jsonata.position")
+)
+
+// An Option configures an Observer.
+type Option func(*Observer)
+
+// WithoutCallSpans leaves out the spans for function calls,
+// which can be numerous for expressions that call functions on
+// every item of a large array.
+func WithoutCallSpans() Option {
+	return func(o *Observer) {
+		o.noCalls = true
+	}
+}
+
+// WithoutExpression leaves out the ExpressionKey attribute,
+// e.g. if expressions contain sensitive constants.
+func WithoutExpression() Option {
+	return func(o *Observer) {
+		o.noSource = true
+	}
+}
+
+// An Observer is a jsonata.EvalObserver that records spans.
+type Observer struct {
+	tracer   trace.Tracer
+	noCalls  bool
+	noSource bool
+}
+
+// NewObserver returns an Observer that uses a tracer from tp,
+// or from the global TracerProvider if tp is nil.
+func NewObserver(tp trace.TracerProvider, opts ...Option) *Observer {
+
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	o := &Observer{
+		tracer: tp.Tracer(ScopeName),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// StartEval starts a span for an evaluation.
+func (o *Observer) StartEval(ctx context.Context, info *jsonata.EvalInfo) context.Context {
+
+	var attrs []attribute.KeyValue
+	if !o.noSource {
+		attrs = append(attrs, ExpressionKey.String(info.Source))
+	}
+	if info.EvalID != "" {
+		attrs = append(attrs, EvalIDKey.String(info.EvalID))
+	}
+
+	ctx, _ = o.tracer.Start(ctx, "jsonata.eval", trace.WithAttributes(attrs...))
+	return ctx
+}
+
+// EndEval ends the evaluation's span.
+func (o *Observer) EndEval(ctx context.Context, info *jsonata.EvalInfo, err error) {
+	trace.SpanFromContext(ctx).End()
+}
+
+// StartCall starts a span for a function call.
+func (o *Observer) StartCall(ctx context.Context, info *jsonata.CallInfo) context.Context {
+
+	if o.noCalls {
+		return ctx
+	}
+
+	attrs := []attribute.KeyValue{
+		FunctionKey.String(info.Name),
+	}
+	if info.Position >= 0 {
+		attrs = append(attrs, PositionKey.Int(info.Position))
+	}
+	if info.EvalID != "" {
+		attrs = append(attrs, EvalIDKey.String(info.EvalID))
+	}
+
+	ctx, _ = o.tracer.Start(ctx, "jsonata.call $"+info.Name, trace.WithAttributes(attrs...))
+	return ctx
+}
+
+// EndCall ends the call's span, recording the error if the
+// call failed.
+func (o *Observer) EndCall(ctx context.Context, info *jsonata.CallInfo, err error) {
+
+	if o.noCalls {
+		return
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Error records an evaluation's error in its span.
+func (o *Observer) Error(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jotel
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestObserver(t *testing.T) {
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+
+	var extSpan trace.SpanContext
+
+	comp, err := jsonata.NewCompiler(nil, map[string]jsonata.Extension{
+		"lookup": {Func: func(ctx context.Context, s string) (string, error) {
+			extSpan = trace.SpanContextFromContext(ctx)
+			if s == "bad" {
+				return "", fmt.Errorf("no such key")
+			}
+			return s + "!", nil
+		}},
+	}, jsonata.WithObserver(NewObserver(tp)))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	ctx = jsonata.WithEvalID(ctx, "req-1")
+
+	e := comp.MustCompile(`$uppercase($lookup(name))`)
+	if _, err := e.EvalContext(ctx, map[string]interface{}{"name": "a"}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	spans := rec.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+
+	// Spans end innermost first.
+	lookup, upper, eval := spans[0], spans[1], spans[2]
+
+	if eval.Name() != "jsonata.eval" || eval.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected a jsonata.eval span under the request, got %s under %s", eval.Name(), eval.Parent().SpanID())
+	}
+	if upper.Name() != "jsonata.call $uppercase" || upper.Parent().SpanID() != eval.SpanContext().SpanID() {
+		t.Errorf("expected a $uppercase span under the evaluation, got %s", upper.Name())
+	}
+	if lookup.Name() != "jsonata.call $lookup" || lookup.Parent().SpanID() != eval.SpanContext().SpanID() {
+		t.Errorf("expected a $lookup span under the evaluation, got %s", lookup.Name())
+	}
+
+	// The extension sees the evaluation's span.
+	if extSpan.SpanID() != eval.SpanContext().SpanID() {
+		t.Errorf("expected the extension to see the evaluation's span")
+	}
+
+	want := map[attribute.Key]attribute.Value{
+		ExpressionKey: attribute.StringValue(`$uppercase($lookup(name))`),
+		EvalIDKey:     attribute.StringValue("req-1"),
+	}
+	for _, kv := range eval.Attributes() {
+		if v, ok := want[kv.Key]; ok && v != kv.Value {
+			t.Errorf("expected %s = %s, got %s", kv.Key, v.Emit(), kv.Value.Emit())
+		}
+		delete(want, kv.Key)
+	}
+	if len(want) > 0 {
+		t.Errorf("missing attributes %v", want)
+	}
+
+	// Errors are recorded in the spans.
+	rec = tracetest.NewSpanRecorder()
+	tp = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+
+	comp, err = jsonata.NewCompiler(nil, map[string]jsonata.Extension{
+		"lookup": {Func: func(s string) (string, error) {
+			return "", fmt.Errorf("no such key")
+		}},
+	}, jsonata.WithObserver(NewObserver(tp, WithoutCallSpans(), WithoutExpression())))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	if _, err := comp.MustCompile(`$lookup("bad")`).Eval(nil, nil); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	spans = rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected only the evaluation's span, got %d spans", len(spans))
+	}
+	if s := spans[0]; s.Status().Code != codes.Error || len(s.Events()) != 1 || s.Events()[0].Name != "exception" {
+		t.Errorf("expected the error in the span, got status %v and events %v", s.Status(), s.Events())
+	}
+	if attrs := spans[0].Attributes(); len(attrs) != 0 {
+		t.Errorf("expected no attributes, got %v", attrs)
+	}
+}
@@ -42,6 +42,8 @@ const (
 	ErrUnmatchedSubtype
 	ErrInvalidSubtype
 	ErrInvalidParamType
+	ErrUnmatchedBracket
+	ErrNestingDepth
 )
 
 var errmsgs = map[ErrType]string{
@@ -72,6 +74,8 @@ var errmsgs = map[ErrType]string{
 	ErrUnmatchedSubtype:   "invalid type signature: subtypes must follow a parameter",
 	ErrInvalidSubtype:     "invalid type signature: parameter type {{hint}} does not support subtypes",
 	ErrInvalidParamType:   "invalid type signature: unknown parameter type '{{hint}}'",
+	ErrUnmatchedBracket:   "invalid type signature: no closing bracket for '{{hint}}'",
+	ErrNestingDepth:       "the expression is nested too deeply",
 }
 
 var reErrMsg = regexp.MustCompile("{{(token|hint)}}")
@@ -0,0 +1,72 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package jparse_test
+
+import (
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// fuzzSeeds are the initial inputs for FuzzParse. Inputs that
+// once crashed or hung the parser are kept in testdata/fuzz.
+var fuzzSeeds = []string{
+	`a.b[0].c`,
+	`Account.Order[0].Product.(Price * Quantity)`,
+	`$sum(Account.Order.Product.Price)`,
+	`"hello" & ' ' & "world"`,
+	"`Product Name` = 'Bowler Hat'",
+	`-1.5e3 + 2 * (3 - 4) / 5 % 6`,
+	`[1..5, 7]`,
+	`{"a": 1, "b": [true, false, null]}`,
+	`a[b > 1 and c != "x" or d in [1, 2]]`,
+	`x ? y : z`,
+	`($x := 1; $y := $x + 1; $y)`,
+	`function($a, $b) { $a + $b }(1, 2)`,
+	`λ($x){$x * 2}`,
+	`$f := function($n)<n:n>{ $n <= 1 ? 1 : $n * $f($n - 1) }`,
+	`$map([1, 2], $string)`,
+	`a ~> $uppercase()`,
+	`$replace(a, /ab+/i, "x")`,
+	`a^(>b, <c)`,
+	`a{b: $sum(c)}`,
+	`**.x`,
+	`*.y`,
+	`Order@$o#$i.Product`,
+	`%.Price`,
+	`| a | {"b": 1}, ["c"] |`,
+	`$substring(?, 1)`,
+	`1.λ`,
+}
+
+func FuzzParse(f *testing.F) {
+
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, expr string) {
+
+		_, err := jparse.Parse(expr)
+		if err != nil {
+			if _, ok := err.(*jparse.Error); !ok {
+				t.Fatalf("Parse(%q): expected an *Error, got %T: %v", expr, err, err)
+			}
+		}
+
+		_, _, errs := jparse.ParseAll(expr)
+		if (err == nil) != (len(errs) == 0) {
+			t.Fatalf("Parse(%q) returned %v but ParseAll returned %v", expr, err, errs)
+		}
+		for _, e := range errs {
+			if _, ok := e.(*jparse.Error); !ok {
+				t.Fatalf("ParseAll(%q): expected an *Error, got %T: %v", expr, e, e)
+			}
+		}
+	})
+}
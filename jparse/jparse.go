@@ -4,6 +4,8 @@
 
 package jparse
 
+import "sort"
+
 // The JSONata parser is based on Pratt's Top Down Operator
 // Precededence algorithm (see https://tdop.github.io/). Given
 // a series of tokens representing a JSONata expression and the
@@ -55,6 +57,7 @@ var nuds = [...]nud{
 	typeIn:          parseName,
 	typeAnd:         parseName,
 	typeOr:          parseName,
+	typeOperator:    parseOperatorName,
 }
 
 // leds defines led functions for token types that are valid
@@ -83,12 +86,14 @@ var leds = [...]led{
 	typeIn:           parseComparisonOperator,
 	typeAnd:          parseBooleanOperator,
 	typeOr:           parseBooleanOperator,
+	typeOperator:     parseCustomOperator,
 }
 
 // bps defines binding powers for token types that are valid
 // in the infix position. The parsing algorithm requires that
 // all infix operators (as defined by the leds variable above)
-// have a non-zero binding power.
+// have a non-zero binding power. The binding powers of custom
+// operators are set by their Syntax (see parser.tokenBp).
 //
 // Binding powers are calculated from a 2D slice of token types
 // in which the outer slice is ordered by operator precedence
@@ -170,6 +175,10 @@ func lookupBp(tt tokenType) int {
 // and returns the root node. If the provided expression is not
 // valid, Parse returns an error of type Error.
 func Parse(expr string) (root Node, err error) {
+	return parse(expr, nil)
+}
+
+func parse(expr string, syntax *Syntax) (root Node, err error) {
 
 	// Handle panics from parseExpression.
 	defer func() {
@@ -182,7 +191,7 @@ func Parse(expr string) (root Node, err error) {
 		}
 	}()
 
-	p := newParser(expr)
+	p := newParser(expr, syntax)
 	node := p.parseExpression(0)
 
 	if p.token.Type != typeEOF {
@@ -192,21 +201,224 @@ func Parse(expr string) (root Node, err error) {
 	return node.optimize()
 }
 
+// A Range is the part of an expression that a node was parsed
+// from, as byte offsets. Start is inclusive and End is exclusive.
+type Range struct {
+	Start int
+	End   int
+}
+
+// ParseRanges is like Parse but also returns the source range of
+// each node in the syntax tree. Nodes created when the syntax
+// tree is simplified, such as the steps of a path, span the
+// nodes they contain.
+func ParseRanges(expr string) (root Node, ranges map[Node]Range, err error) {
+	return parseRanges(expr, nil)
+}
+
+func parseRanges(expr string, syntax *Syntax) (root Node, ranges map[Node]Range, err error) {
+
+	// Handle panics from parseExpression.
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(*Error); ok {
+				root, ranges, err = nil, nil, e
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	p := newParser(expr, syntax)
+	p.ranges = map[Node]Range{}
+	node := p.parseExpression(0)
+
+	if p.token.Type != typeEOF {
+		return nil, nil, newError(ErrSyntaxError, p.token)
+	}
+
+	root, err = node.optimize()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ranges = map[Node]Range{}
+	fillRanges(expr, root, p.ranges, ranges)
+
+	return root, ranges, nil
+}
+
+// ParseAll is like ParseRanges except that it doesn't stop at
+// the first syntax error. It skips over the rest of the faulty
+// part of the expression, e.g. to the end of the array item or
+// the closing bracket, and carries on parsing, so an editor can
+// show all of an expression's errors at once. If the expression
+// is not valid, root and ranges are nil and errs holds at least
+// one error of type Error, sorted by position.
+//
+// Errors that are caused by an earlier error, such as a missing
+// closing bracket after an unexpected token, are left out. Only
+// the first error is reported if a string, regular expression
+// or name is not terminated, because that hides the rest of the
+// expression, or if the expression is nested too deeply. Other
+// errors that are found after parsing, such as invalid path
+// steps, are reported if there are no syntax errors.
+func ParseAll(expr string) (root Node, ranges map[Node]Range, errs []error) {
+	return parseAll(expr, nil)
+}
+
+func parseAll(expr string, syntax *Syntax) (root Node, ranges map[Node]Range, errs []error) {
+
+	// Handle panics from newParser and nesting errors.
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(*Error); ok {
+				root, ranges, errs = nil, nil, []error{e}
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	p := newParser(expr, syntax)
+	p.ranges = map[Node]Range{}
+	p.recovering = true
+	p.syncPos = -1
+	node := p.parseExpression(0)
+
+	// Look for more errors after a stray token.
+	for p.token.Type != typeEOF {
+		p.addError(newError(ErrSyntaxError, p.token))
+		if !p.skip() {
+			break
+		}
+		if p.token.Type != typeEOF {
+			p.parseExpression(0)
+		}
+	}
+
+	if len(p.errs) > 0 {
+		sort.SliceStable(p.errs, func(i, j int) bool {
+			return errorPosition(p.errs[i]) < errorPosition(p.errs[j])
+		})
+		return nil, nil, p.errs
+	}
+
+	root, err := node.optimize()
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	ranges = map[Node]Range{}
+	fillRanges(expr, root, p.ranges, ranges)
+
+	return root, ranges, nil
+}
+
+// fillRanges copies the ranges of a node and its descendants
+// from parsed to ranges. Nodes that are missing from parsed
+// are given the span of their children.
+func fillRanges(expr string, node Node, parsed, ranges map[Node]Range) (Range, bool) {
+
+	r, ok := parsed[node]
+	spanned := !ok
+
+	for _, child := range Children(node) {
+		cr, cok := fillRanges(expr, child, parsed, ranges)
+		switch {
+		case !cok || !spanned:
+		case !ok:
+			r, ok = cr, true
+		default:
+			if cr.Start < r.Start {
+				r.Start = cr.Start
+			}
+			if cr.End > r.End {
+				r.End = cr.End
+			}
+		}
+	}
+
+	if !ok {
+		return Range{}, false
+	}
+
+	if spanned {
+		// The spans of predicates and singleton array paths
+		// end before their closing brackets.
+		switch node := node.(type) {
+		case *PredicateNode:
+			r.End = skipToken(expr, r.End, ']')
+		case *PathNode:
+			if node.KeepArrays {
+				if i := skipToken(expr, r.End, '['); i > r.End {
+					r.End = skipToken(expr, i, ']')
+				}
+			}
+		}
+	}
+
+	ranges[node] = r
+	return r, true
+}
+
+// skipToken returns the offset after ch if it's the next
+// character in expr after any whitespace. Otherwise it
+// returns pos.
+func skipToken(expr string, pos int, ch byte) int {
+
+	i := pos
+	for i < len(expr) && isWhitespace(rune(expr[i])) {
+		i++
+	}
+
+	if i < len(expr) && expr[i] == ch {
+		return i + 1
+	}
+
+	return pos
+}
+
 type parser struct {
 	lexer lexer
 	token token
+	// ranges, if non-nil, records the source range of each
+	// node returned by a nud or led function (see ParseRanges).
+	// end is the offset at the end of the last consumed token.
+	ranges map[Node]Range
+	end    int
+	// recovering is true if syntax errors are recorded in
+	// errs instead of stopping the parser (see ParseAll).
+	// syncPos is the position of the token that the parser
+	// last skipped to after an error.
+	recovering bool
+	errs       []error
+	syncPos    int
+	// depth is the depth of the syntax tree at the current
+	// token (see maxDepth).
+	depth int
 	// The following function pointers are a workaround
 	// for an initialisation loop compile error. See the
 	// comment in newParser.
 	lookupNud func(tokenType) nud
 	lookupLed func(tokenType) led
 	lookupBp  func(tokenType) int
+	// syntax holds the custom operators, if any.
+	syntax *Syntax
 }
 
-func newParser(input string) parser {
+// maxDepth is the maximum depth of the syntax tree, e.g. the
+// number of nested parentheses or chained operators, that the
+// parser accepts. It stops the parser, and the code that walks
+// the syntax tree, from exhausting the Go stack, which would
+// crash the program.
+const maxDepth = 10000
+
+func newParser(input string, syntax *Syntax) parser {
 
 	p := parser{
-		lexer: newLexer(input),
+		lexer:  newLexer(input, syntax),
+		syntax: syntax,
 
 		// Because the nuds/leds arrays refer to functions that
 		// call the parser methods, the parser methods cannot
@@ -242,48 +454,265 @@ func newParser(input string) parser {
 // by the top-level Parse function and returned to the
 // caller as errors. This makes the nud/led functions
 // nicer to write without sacrificing the public API.
+//
+// In recovery mode (see ParseAll), the errors are recorded
+// instead, and the nud or led that failed is replaced with an
+// errorNode.
 func (p *parser) parseExpression(rbp int) Node {
 
-	if p.token.Type == typeEOF {
-		panic(newError(ErrUnexpectedEOF, p.token))
+	// Each infix operator below adds a level to the syntax
+	// tree, so it counts towards the depth as well.
+	depth := p.depth
+	defer func() { p.depth = depth }()
+	p.depth++
+
+	start := p.token
+	lhs := p.try(start, func() Node {
+
+		if p.depth > maxDepth {
+			panic(newError(ErrNestingDepth, p.token))
+		}
+
+		if p.token.Type == typeEOF {
+			panic(newError(ErrUnexpectedEOF, p.token))
+		}
+
+		t := p.token
+		nud := p.lookupNud(t.Type)
+		if nud == nil {
+			panic(newError(ErrPrefix, t))
+		}
+
+		p.advance(false)
+
+		lhs, err := nud(p, t)
+		if err != nil {
+			p.report(err)
+			return &errorNode{}
+		}
+		p.mark(lhs, t)
+		return lhs
+	})
+
+	for rbp < p.tokenBp(p.token) {
+
+		t := p.token
+		p.depth++
+		lhs = p.try(t, func() Node {
+
+			if p.depth > maxDepth {
+				panic(newError(ErrNestingDepth, t))
+			}
+
+			p.advance(true)
+
+			led := p.lookupLed(t.Type)
+			if led == nil {
+				panic(newError(ErrInfix, t))
+			}
+
+			lhs, err := led(p, t, lhs)
+			if err != nil {
+				p.report(err)
+				return &errorNode{}
+			}
+			p.mark(lhs, start)
+			return lhs
+		})
 	}
 
-	t := p.token
-	p.advance(false)
+	// In recovery mode, a complete expression followed by a
+	// token that can't follow it, as in [1 2], is an error.
+	// Skipping to the next comma, semicolon or bracket lets
+	// the enclosing array, block, etc. carry on.
+	if rbp == 0 && p.recovering && !canFollow(p.token.Type) {
+		p.addError(newError(ErrSyntaxError, p.token))
+		p.synchronize(typeEOF)
+	}
+
+	return lhs
+}
 
-	nud := p.lookupNud(t.Type)
-	if nud == nil {
-		panic(newError(ErrPrefix, t))
+// try calls fn, which parses the part of the expression that
+// starts with token t. In recovery mode, if fn panics with a
+// syntax error, try records the error, skips the rest of the
+// part and returns an errorNode.
+func (p *parser) try(t token, fn func() Node) (node Node) {
+
+	if !p.recovering {
+		return fn()
 	}
 
-	lhs, err := nud(p, t)
-	if err != nil {
+	defer func() {
+		if r := recover(); r != nil {
+			// Nesting errors stop the parser: there's no point
+			// in carrying on at every level of a deep tree.
+			err, ok := r.(*Error)
+			if !ok || err.Type == ErrNestingDepth {
+				panic(r)
+			}
+			p.addError(err)
+			p.synchronize(closingTokens[t.Type])
+			node = &errorNode{}
+		}
+	}()
+
+	return fn()
+}
+
+// report records an error returned by a nud or led function
+// in recovery mode, and panics otherwise.
+func (p *parser) report(err error) {
+	if !p.recovering {
 		panic(err)
 	}
+	p.addError(err)
+}
 
-	for rbp < p.lookupBp(p.token.Type) {
+// addError records a syntax error in recovery mode. To avoid
+// reporting the same problem twice, it ignores errors at the
+// position of the previous error or of the token the parser
+// last skipped to, and errors that follow a lexer error.
+func (p *parser) addError(err error) {
 
-		t := p.token
-		p.advance(true)
+	if p.lexer.err != nil && err != p.lexer.err {
+		return
+	}
+
+	pos := errorPosition(err)
+	if pos >= 0 {
+		if pos == p.syncPos {
+			return
+		}
+		if n := len(p.errs); n > 0 && errorPosition(p.errs[n-1]) == pos {
+			return
+		}
+	}
 
-		led := p.lookupLed(t.Type)
-		if led == nil {
-			panic(newError(ErrInfix, t))
+	p.errs = append(p.errs, err)
+}
+
+// synchronize skips tokens after a syntax error so that the
+// parser can carry on. If close is a closing bracket, it skips
+// to the matching bracket and consumes it. Otherwise it stops
+// before the next token that can follow an expression. Tokens
+// in nested brackets are skipped in both cases.
+func (p *parser) synchronize(close tokenType) {
+
+	var depth int
+
+	for {
+		tt := p.token.Type
+
+		switch {
+		case tt == typeEOF || tt == typeError:
+			p.syncPos = p.token.Position
+			return
+		case closingTokens[tt] != typeEOF:
+			depth++
+		case isClosingToken(tt):
+			if depth == 0 {
+				if tt == close {
+					p.skip()
+				} else {
+					p.syncPos = p.token.Position
+				}
+				return
+			}
+			depth--
+		case depth == 0 && close == typeEOF && canFollow(tt):
+			p.syncPos = p.token.Position
+			return
 		}
 
-		lhs, err = led(p, t, lhs)
-		if err != nil {
-			panic(err)
+		if !p.skip() {
+			return
 		}
 	}
+}
 
-	return lhs
+// skip is like advance except that a lexer error is recorded
+// and skip returns false.
+func (p *parser) skip() (ok bool) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			err, isErr := r.(*Error)
+			if !isErr {
+				panic(r)
+			}
+			p.addError(err)
+			ok = false
+		}
+	}()
+
+	p.advance(false)
+	return true
+}
+
+// closingTokens maps opening brackets to closing brackets.
+var closingTokens = map[tokenType]tokenType{
+	typeBracketOpen: typeBracketClose,
+	typeBraceOpen:   typeBraceClose,
+	typeParenOpen:   typeParenClose,
+}
+
+func isClosingToken(tt tokenType) bool {
+	switch tt {
+	case typeBracketClose, typeBraceClose, typeParenClose:
+		return true
+	default:
+		return false
+	}
+}
+
+// canFollow reports whether a token of the given type can
+// follow a complete expression.
+func canFollow(tt tokenType) bool {
+	switch tt {
+	case typeEOF, typeComma, typeColon, typeSemicolon, typePipe, typeRange:
+		return true
+	default:
+		return isClosingToken(tt)
+	}
+}
+
+// errorPosition returns the position of a parser error, or -1
+// for other errors.
+func errorPosition(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.Position
+	}
+	return -1
+}
+
+// mark records the source range of a node that starts with
+// the given token and ends with the last consumed token.
+func (p *parser) mark(node Node, start token) {
+
+	if p.ranges == nil {
+		return
+	}
+
+	pos := start.Position
+	switch start.Type {
+	case typeString, typeNameEsc, typeRegex, typeVariable:
+		// The token's position is after the opening delimiter
+		// or the $ sign.
+		pos--
+	}
+
+	p.ranges[node] = Range{
+		Start: pos,
+		End:   p.end,
+	}
 }
 
 // advance requests the next token from the lexer and updates
 // the parser's current token pointer. It panics if the lexer
 // returns an error token.
 func (p *parser) advance(allowRegex bool) {
+	p.end = p.lexer.current
 	p.token = p.lexer.next(allowRegex)
 	if p.token.Type == typeError {
 		panic(p.lexer.err)
@@ -313,6 +742,15 @@ func (p *parser) bp(t tokenType) int {
 	return p.lookupBp(t)
 }
 
+// tokenBp returns the binding power for the given token, which
+// for custom operators depends on the operator.
+func (p *parser) tokenBp(t token) int {
+	if t.Type == typeOperator {
+		return p.syntax.precedence(t.Value)
+	}
+	return p.lookupBp(t.Type)
+}
+
 // initBindingPowers calculates binding power values for the
 // given token types and returns them as an array. The specific
 // values are not important. All that matters for parsing is
@@ -361,6 +799,9 @@ func initBindingPowers(tokenTypes [][]tokenType) [ledCount]int {
 func validateBindingPowers(bps [ledCount]int) {
 
 	for tt := tokenType(0); tt < ledCount; tt++ {
+		if tt == typeOperator {
+			continue
+		}
 		if leds[tt] != nil && bps[tt] == 0 {
 			panicf("validateBindingPowers: token type %d [%s] does not have a binding power", tt, tt)
 		}
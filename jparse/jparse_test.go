@@ -643,6 +643,7 @@ func TestFunctionCallNode(t *testing.T) {
 				Func: &jparse.VariableNode{
 					Name: "random",
 				},
+				Position: 7,
 			},
 		},
 		{
@@ -656,6 +657,7 @@ func TestFunctionCallNode(t *testing.T) {
 						Value: "hello",
 					},
 				},
+				Position: 10,
 			},
 		},
 		{
@@ -675,6 +677,7 @@ func TestFunctionCallNode(t *testing.T) {
 						Value: 2,
 					},
 				},
+				Position: 10,
 			},
 		},
 		{
@@ -883,9 +886,337 @@ func TestTypedLambdaNode(t *testing.T) {
 				Hint: "n",
 			},
 		},
+		{
+			// Unterminated union type.
+			Input: "λ($x)<(>{0}",
+			Error: &jparse.Error{
+				// TODO: Add position info.
+				Type: jparse.ErrUnmatchedBracket,
+				Hint: "(",
+			},
+		},
 	})
 }
 
+func TestParseSignature(t *testing.T) {
+
+	tests := []struct {
+		Input  string
+		Output []jparse.Param
+		Error  error
+	}{
+		{
+			Input: "<s-n?a<n>:s>",
+			Output: []jparse.Param{
+				{
+					Type:   jparse.ParamTypeString,
+					Option: jparse.ParamContextable,
+				},
+				{
+					Type:   jparse.ParamTypeNumber,
+					Option: jparse.ParamOptional,
+				},
+				{
+					Type: jparse.ParamTypeArray,
+					SubParams: []jparse.Param{
+						{
+							Type: jparse.ParamTypeNumber,
+						},
+					},
+				},
+			},
+		},
+		{
+			Input:  "<>",
+			Output: []jparse.Param{},
+		},
+		{
+			Input: "sn",
+			Error: &jparse.Error{
+				Type: jparse.ErrUnmatchedBracket,
+				Hint: "<",
+			},
+		},
+		{
+			Input: "<s>n",
+			Error: &jparse.Error{
+				Type: jparse.ErrUnmatchedBracket,
+				Hint: "<",
+			},
+		},
+		{
+			Input: "<sz>",
+			Error: &jparse.Error{
+				Type: jparse.ErrInvalidParamType,
+				Hint: "z",
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		output, err := jparse.ParseSignature(test.Input)
+
+		if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("%s: expected params %v, got %v", test.Input, test.Output, output)
+		}
+
+		if !reflect.DeepEqual(err, test.Error) {
+			t.Errorf("%s: expected error %v, got %v", test.Input, test.Error, err)
+		}
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+
+	tests := []struct {
+		Input  string
+		Ranges map[string]string
+	}{
+		{
+			Input: `$f("x", ` + "`a b`" + `) ? /ab/i : b.c[d > 1]`,
+			Ranges: map[string]string{
+				"*jparse.ConditionalNode":        `$f("x", ` + "`a b`" + `) ? /ab/i : b.c[d > 1]`,
+				"*jparse.FunctionCallNode":       `$f("x", ` + "`a b`" + `)`,
+				"*jparse.VariableNode":           `$f`,
+				"*jparse.StringNode":             `"x"`,
+				"*jparse.RegexNode":              `/ab/i`,
+				"*jparse.PredicateNode":          `c[d > 1]`,
+				"*jparse.ComparisonOperatorNode": `d > 1`,
+				"*jparse.NumberNode":             `1`,
+			},
+		},
+		{
+			Input: `{"k": (a; b[])}`,
+			Ranges: map[string]string{
+				"*jparse.ObjectNode": `{"k": (a; b[])}`,
+				"*jparse.StringNode": `"k"`,
+				"*jparse.BlockNode":  `(a; b[])`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		root, ranges, err := jparse.ParseRanges(test.Input)
+		if err != nil {
+			t.Errorf("%s: ParseRanges failed: %s", test.Input, err)
+			continue
+		}
+
+		got := map[string]string{}
+		var paths []string
+		jparse.Walk(root, func(node jparse.Node) bool {
+			r, ok := ranges[node]
+			if !ok {
+				t.Errorf("%s: no range for %s", test.Input, node)
+				return true
+			}
+			switch node.(type) {
+			case *jparse.PathNode:
+				paths = append(paths, test.Input[r.Start:r.End])
+			case *jparse.NameNode:
+			default:
+				got[reflect.TypeOf(node).String()] = test.Input[r.Start:r.End]
+			}
+			return true
+		})
+
+		if !reflect.DeepEqual(got, test.Ranges) {
+			t.Errorf("%s: expected ranges %v, got %v", test.Input, test.Ranges, got)
+		}
+
+		if len(paths) == 0 {
+			t.Errorf("%s: expected path ranges", test.Input)
+		}
+	}
+
+	_, ranges, err := jparse.ParseRanges(`a[] , b`)
+	if err == nil || ranges != nil {
+		t.Errorf("expected error, got %v", err)
+	}
+}
+
+func TestParseAll(t *testing.T) {
+
+	type errInfo struct {
+		Type     jparse.ErrType
+		Token    string
+		Position int
+	}
+
+	tests := []struct {
+		Input  string
+		Errors []errInfo
+	}{
+		{
+			Input: `[1 2, 3 4]`,
+			Errors: []errInfo{
+				{jparse.ErrSyntaxError, "2", 3},
+				{jparse.ErrSyntaxError, "4", 8},
+			},
+		},
+		{
+			Input: `(a b; c d)`,
+			Errors: []errInfo{
+				{jparse.ErrSyntaxError, "b", 3},
+				{jparse.ErrSyntaxError, "d", 8},
+			},
+		},
+		{
+			// The missing colon isn't reported separately.
+			Input: `{a b}`,
+			Errors: []errInfo{
+				{jparse.ErrSyntaxError, "b", 3},
+			},
+		},
+		{
+			Input: `{"a": 1 2, "b": }`,
+			Errors: []errInfo{
+				{jparse.ErrSyntaxError, "2", 8},
+				{jparse.ErrPrefix, "}", 16},
+			},
+		},
+		{
+			Input: `$f(a b, c d).x + `,
+			Errors: []errInfo{
+				{jparse.ErrSyntaxError, "b", 5},
+				{jparse.ErrSyntaxError, "d", 10},
+				{jparse.ErrUnexpectedEOF, "", 17},
+			},
+		},
+		{
+			Input: `"\q" & "\z"`,
+			Errors: []errInfo{
+				{jparse.ErrIllegalEscape, "\\q", 1},
+				{jparse.ErrIllegalEscape, "\\z", 8},
+			},
+		},
+		{
+			Input: `$x := ; [1,]`,
+			Errors: []errInfo{
+				{jparse.ErrPrefix, ";", 6},
+				{jparse.ErrPrefix, "]", 11},
+			},
+		},
+		{
+			Input: `[1, (2]`,
+			Errors: []errInfo{
+				{jparse.ErrUnexpectedToken, "]", 6},
+			},
+		},
+		{
+			Input: `(a; b`,
+			Errors: []errInfo{
+				{jparse.ErrMissingToken, "", 5},
+			},
+		},
+		{
+			// Nothing is reported after an unterminated
+			// string.
+			Input: `[1 2, "abc`,
+			Errors: []errInfo{
+				{jparse.ErrSyntaxError, "2", 3},
+				{jparse.ErrUnterminatedString, "abc", 7},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		root, ranges, errs := jparse.ParseAll(test.Input)
+		if root != nil || ranges != nil {
+			t.Errorf("%s: expected nil root and ranges", test.Input)
+		}
+
+		var got []errInfo
+		for _, err := range errs {
+			e, ok := err.(*jparse.Error)
+			if !ok {
+				t.Errorf("%s: expected a *jparse.Error, got %T", test.Input, err)
+				continue
+			}
+			got = append(got, errInfo{e.Type, e.Token, e.Position})
+		}
+
+		if !reflect.DeepEqual(got, test.Errors) {
+			t.Errorf("%s: expected errors %v, got %v", test.Input, test.Errors, got)
+		}
+	}
+
+	// Valid expressions parse as usual.
+	for _, input := range []string{
+		`$f("x", b.c[d > 1]) ? /ab/i : {"k": (a; b[])}`,
+		`$sort(items, function($l, $r) { $l.price > $r.price })`,
+	} {
+
+		want, wantRanges, err := jparse.ParseRanges(input)
+		if err != nil {
+			t.Fatalf("%s: ParseRanges failed: %s", input, err)
+		}
+
+		got, gotRanges, errs := jparse.ParseAll(input)
+		if len(errs) > 0 {
+			t.Errorf("%s: ParseAll failed: %v", input, errs)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %s, got %s", input, want, got)
+		}
+		if len(gotRanges) != len(wantRanges) {
+			t.Errorf("%s: expected %d ranges, got %d", input, len(wantRanges), len(gotRanges))
+		}
+	}
+
+	// Errors found after parsing are reported if there are
+	// no syntax errors.
+	_, _, errs := jparse.ParseAll(`a."b"`)
+	if len(errs) != 1 || errs[0].(*jparse.Error).Type != jparse.ErrPathLiteral {
+		t.Errorf("expected a path literal error, got %v", errs)
+	}
+
+	// A number followed by a dot and a multi-byte character
+	// used to send ParseAll into an endless loop.
+	_, _, errs = jparse.ParseAll(`1.λ`)
+	if len(errs) != 1 || errs[0].(*jparse.Error).Type != jparse.ErrPathLiteral {
+		t.Errorf("expected a path literal error, got %v", errs)
+	}
+}
+
+func TestParseNesting(t *testing.T) {
+
+	const n = 1000000
+
+	inputs := []string{
+		strings.Repeat("(", n) + "1" + strings.Repeat(")", n),
+		strings.Repeat("[", n),
+		strings.Repeat("-", n) + "1",
+		"1" + strings.Repeat("+1", n),
+		"a" + strings.Repeat(".a", n),
+		strings.Repeat("$f(", n) + "1" + strings.Repeat(")", n),
+		strings.Repeat("true ? ", n) + "1" + strings.Repeat(" : 2", n),
+	}
+
+	for _, input := range inputs {
+
+		_, err := jparse.Parse(input)
+		if e, ok := err.(*jparse.Error); !ok || e.Type != jparse.ErrNestingDepth {
+			t.Errorf("%.12s...: expected a nesting error, got %v", input, err)
+		}
+
+		_, _, errs := jparse.ParseAll(input)
+		if len(errs) != 1 {
+			t.Errorf("%.12s...: expected 1 error from ParseAll, got %d", input, len(errs))
+		}
+	}
+
+	input := strings.Repeat("(", 1000) + "1" + strings.Repeat(")", 1000)
+	if _, err := jparse.Parse(input); err != nil {
+		t.Errorf("expected 1000 nested parentheses to parse, got %v", err)
+	}
+}
+
 func TestPartialApplicationNode(t *testing.T) {
 	testParser(t, []testCase{
 		{
@@ -932,6 +1263,7 @@ func TestFunctionApplicationNode(t *testing.T) {
 							Value: " ",
 						},
 					},
+					Position: 33,
 				},
 			},
 		},
@@ -2000,6 +2332,7 @@ func TestPathNode(t *testing.T) {
 						Func: &jparse.VariableNode{
 							Name: "uppercase",
 						},
+						Position: 17,
 					},
 				},
 			},
@@ -2322,6 +2655,54 @@ func TestStringers(t *testing.T) {
 	}
 }
 
+func TestStringers_RoundTrip(t *testing.T) {
+
+	data := []string{
+		`Account.Order[0].Product[Price > 30][0].SKU`,
+		`Account.Order.Product[0][1]`,
+		`$.Order[OrderID = "order103"]`,
+		"`Product Name` & `and` & `1st`",
+		`"tab\there" & "quote\"s" & "\u0001" & 'single'`,
+		`"héllo" & "\u00e9"`,
+		`(1 + 2) * -(3 - 4) / 5 % 6`,
+		`1e21 + 0.000001 + 1000000`,
+		`($x := [1..5, 7]; $y := {"a": $x[0], "b": $count($x)}; $y.a)`,
+		`Account.Order{OrderID: $sum(Product.Price)}`,
+		`Product^(>Price, <Name).Name`,
+		`Product[]`,
+		`**.Price[$ > 10] ~> $sum()`,
+		`$map([1, 2], function($v, $i){$v * $i})`,
+		`λ($x)<n:n>{$x + 1}`,
+		`$substring(?, 0, 2)`,
+		`$ ~> |Account.Order.Product|{"Total": Price * Quantity}, ["Price"]|`,
+		`$contains("abc", /B/i) ? "yes" : ("no" or null and true)`,
+		`1 in [1, 2] and 3 != 4`,
+		`Account.*.Order`,
+		`$$.Account`,
+	}
+
+	for _, input := range data {
+
+		ast, err := jparse.Parse(input)
+		if err != nil {
+			t.Errorf("%s: %s", input, err)
+			continue
+		}
+
+		s := ast.String()
+
+		again, err := jparse.Parse(s)
+		if err != nil {
+			t.Errorf("%s: could not parse %q: %s", input, s, err)
+			continue
+		}
+
+		if got := again.String(); got != s {
+			t.Errorf("%s: expected %q to round trip, got %q", input, s, got)
+		}
+	}
+}
+
 func testParser(t *testing.T, data []testCase) {
 
 	for _, test := range data {
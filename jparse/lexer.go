@@ -61,6 +61,9 @@ const (
 	typeAnd
 	typeOr
 	typeIn
+
+	// Custom operators (see Syntax)
+	typeOperator
 )
 
 func (tt tokenType) String() string {
@@ -81,6 +84,8 @@ func (tt tokenType) String() string {
 		return "(variable)"
 	case typeRegex:
 		return "(regex)"
+	case typeOperator:
+		return "(operator)"
 	default:
 		if s := symbolsAndKeywords[tt]; s != "" {
 			return s
@@ -187,14 +192,17 @@ type lexer struct {
 	current int
 	width   int
 	err     error
+	syntax  *Syntax
 }
 
 // newLexer creates a new lexer from the provided input. The
 // input is tokenized by successive calls to the next method.
-func newLexer(input string) lexer {
+// syntax holds the custom operators to recognise, if any.
+func newLexer(input string, syntax *Syntax) lexer {
 	return lexer{
 		input:  input,
 		length: len(input),
+		syntax: syntax,
 	}
 }
 
@@ -222,6 +230,13 @@ func (l *lexer) next(allowRegex bool) token {
 		return l.scanRegex(ch)
 	}
 
+	// Custom symbols take precedence over the built-in symbols
+	// that they start with.
+	if n := l.syntax.matchSymbol(l.input[l.start:]); n > 0 {
+		l.current = l.start + n
+		return l.newToken(typeOperator)
+	}
+
 	if rts := lookupSymbol2(ch); rts != nil {
 		for _, rt := range rts {
 			if l.acceptRune(rt.r) {
@@ -338,7 +353,10 @@ func (l *lexer) scanNumber() token {
 			// If there are no digits after the decimal point,
 			// don't treat the dot as part of the number. It
 			// could be part of the range operator, e.g. "1..5".
-			l.backup()
+			// backup only undoes the last rune read, which is
+			// the one after the dot, so step back over the dot
+			// (a single byte) directly.
+			l.current--
 			return l.newToken(typeNumber)
 		}
 	}
@@ -392,7 +410,7 @@ func (l *lexer) scanName() token {
 		}
 
 		// ...or anything that looks like an operator.
-		if lookupSymbol1(ch) > 0 || lookupSymbol2(ch) != nil {
+		if lookupSymbol1(ch) > 0 || lookupSymbol2(ch) != nil || l.syntax.startsSymbol(ch) {
 			l.backup()
 			break
 		}
@@ -404,6 +422,8 @@ func (l *lexer) scanName() token {
 		t.Type = typeVariable
 	} else if tt := lookupKeyword(t.Value); tt > 0 {
 		t.Type = tt
+	} else if l.syntax.isWord(t.Value) {
+		t.Type = typeOperator
 	}
 
 	return t
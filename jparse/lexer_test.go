@@ -235,13 +235,29 @@ func TestLexerNumbers(t *testing.T) {
 		},
 		{
 			// Trailing decimal points are not supported.
-			// TODO: Why does this require a character following the decimal point?
 			Input: "5. ",
 			Tokens: []token{
 				tok(typeNumber, "5", 0),
 				tok(typeDot, ".", 1),
 			},
 		},
+		{
+			Input: "5.",
+			Tokens: []token{
+				tok(typeNumber, "5", 0),
+				tok(typeDot, ".", 1),
+			},
+		},
+		{
+			// The character after the decimal point can be
+			// more than one byte long.
+			Input: "1.λ",
+			Tokens: []token{
+				tok(typeNumber, "1", 0),
+				tok(typeDot, ".", 1),
+				tok(typeName, "λ", 2),
+			},
+		},
 	})
 }
 
@@ -358,7 +374,7 @@ func testLexer(t *testing.T, data []lexerTestCase) {
 
 	for _, test := range data {
 
-		l := newLexer(test.Input)
+		l := newLexer(test.Input, nil)
 		eof := tok(typeEOF, "", len(test.Input))
 
 		for _, exp := range test.Tokens {
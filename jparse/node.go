@@ -47,7 +47,7 @@ func (n *StringNode) optimize() (Node, error) {
 }
 
 func (n StringNode) String() string {
-	return fmt.Sprintf("%q", n.Value)
+	return quoteString(n.Value)
 }
 
 // A NumberNode represents a number literal.
@@ -209,7 +209,7 @@ func (n *NameNode) optimize() (Node, error) {
 }
 
 func (n NameNode) String() string {
-	if n.escaped {
+	if n.escaped || !isPlainName(n.Value) {
 		return fmt.Sprintf("`%s`", n.Value)
 	}
 	return n.Value
@@ -713,6 +713,22 @@ func (p Param) String() string {
 	return s
 }
 
+// ParseSignature parses a function signature in the format
+// used by typed lambdas, e.g. "<s-n?:s>", and returns its
+// parameters. The return type, if any, is not checked.
+func ParseSignature(sig string) ([]Param, error) {
+
+	part, ok := getBracketedString(sig, '<', '>')
+	if !ok || len(part)+2 != len(sig) {
+		return nil, &Error{
+			Type: ErrUnmatchedBracket,
+			Hint: "<",
+		}
+	}
+
+	return parseParams(part)
+}
+
 func parseParams(s string) ([]Param, error) {
 
 	params := []Param{}
@@ -734,7 +750,14 @@ func parseParams(s string) ([]Param, error) {
 		}
 
 		if r == '(' {
-			part := getBracketedString(s, '(', ')')
+			part, ok := getBracketedString(s, '(', ')')
+			if !ok {
+				// TODO: Add position to this error.
+				return nil, &Error{
+					Type: ErrUnmatchedBracket,
+					Hint: string(r),
+				}
+			}
 			var types ParamType
 			for _, c := range part {
 				typ, ok := parseParamType(c)
@@ -782,7 +805,14 @@ func parseParams(s string) ([]Param, error) {
 					Hint: params[n].Type.String(),
 				}
 			}
-			part := getBracketedString(s, '<', '>')
+			part, ok := getBracketedString(s, '<', '>')
+			if !ok {
+				// TODO: Add position to this error.
+				return nil, &Error{
+					Type: ErrUnmatchedBracket,
+					Hint: string(r),
+				}
+			}
 			sub, err := parseParams(part)
 			if err != nil {
 				return nil, err
@@ -802,7 +832,10 @@ func parseParams(s string) ([]Param, error) {
 	return params, nil
 }
 
-func getBracketedString(s string, open, close rune) string {
+// getBracketedString returns the contents of the bracketed
+// string at the start of s. It returns false if s doesn't
+// start with a complete bracketed string.
+func getBracketedString(s string, open, close rune) (string, bool) {
 
 	var depth int
 
@@ -820,12 +853,12 @@ func getBracketedString(s string, open, close rune) string {
 		if c == close {
 			depth--
 			if depth == 0 {
-				return s[utf8.RuneLen(open):pos]
+				return s[utf8.RuneLen(open):pos], true
 			}
 		}
 	}
 
-	return ""
+	return "", false
 }
 
 // A LambdaNode represents a user-defined JSONata function.
@@ -951,9 +984,12 @@ func (PlaceholderNode) String() string {
 }
 
 // A FunctionCallNode represents a call to a function.
+// Position is the offset of the call's opening parenthesis
+// in the expression.
 type FunctionCallNode struct {
-	Func Node
-	Args []Node
+	Func     Node
+	Args     []Node
+	Position int
 }
 
 const typePlaceholder = typeCondition
@@ -997,8 +1033,9 @@ func parseFunctionCall(p *parser, t token, lhs Node) (Node, error) {
 	}
 
 	return &FunctionCallNode{
-		Func: lhs,
-		Args: args,
+		Func:     lhs,
+		Args:     args,
+		Position: t.Position,
 	}, nil
 }
 
@@ -1156,7 +1193,18 @@ func (n *PredicateNode) optimize() (Node, error) {
 }
 
 func (n PredicateNode) String() string {
-	return fmt.Sprintf("%s[%s]", n.Expr, joinNodes(n.Filters, ", "))
+
+	var b strings.Builder
+	b.WriteString(n.Expr.String())
+
+	// Each filter is applied in turn, as in Product[0][Price > 5].
+	for _, filter := range n.Filters {
+		b.WriteString("[")
+		b.WriteString(filter.String())
+		b.WriteString("]")
+	}
+
+	return b.String()
 }
 
 // A GroupNode represents a group expression.
@@ -1584,6 +1632,53 @@ func (n StringConcatenationNode) String() string {
 	return fmt.Sprintf("%s & %s", n.LHS, n.RHS)
 }
 
+// A CustomOperatorNode represents an operation with a custom
+// infix operator (see Syntax).
+type CustomOperatorNode struct {
+	Symbol string
+	LHS    Node
+	RHS    Node
+}
+
+func parseCustomOperator(p *parser, t token, lhs Node) (Node, error) {
+	return &CustomOperatorNode{
+		Symbol: t.Value,
+		LHS:    lhs,
+		RHS:    p.parseExpression(p.tokenBp(t)),
+	}, nil
+}
+
+// parseOperatorName parses a custom operator in the prefix
+// position. Word operators are names there, as the keyword
+// operators are.
+func parseOperatorName(p *parser, t token) (Node, error) {
+	if !p.syntax.isWord(t.Value) {
+		return nil, newError(ErrPrefix, t)
+	}
+	return parseName(p, t)
+}
+
+func (n *CustomOperatorNode) optimize() (Node, error) {
+
+	var err error
+
+	n.LHS, err = n.LHS.optimize()
+	if err != nil {
+		return nil, err
+	}
+
+	n.RHS, err = n.RHS.optimize()
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+func (n CustomOperatorNode) String() string {
+	return fmt.Sprintf("%s %s %s", n.LHS, n.Symbol, n.RHS)
+}
+
 // SortDir describes the sort order of a sort operation.
 type SortDir uint8
 
@@ -1787,6 +1882,20 @@ func (n dotNode) String() string {
 	return fmt.Sprintf("%s.%s", n.lhs, n.rhs)
 }
 
+// An errorNode stands in for a part of an expression that has
+// a syntax error when the parser is in recovery mode (see
+// ParseAll). It is deliberately unexported and never appears in
+// a syntax tree returned by the parser.
+type errorNode struct{}
+
+func (n *errorNode) optimize() (Node, error) {
+	return n, nil
+}
+
+func (errorNode) String() string {
+	return "<error>"
+}
+
 // A singletonArrayNode is an interim data structure used when
 // processing path expressions. It is deliberately unexported
 // and gets converted into a PathNode during optimization.
@@ -1902,6 +2011,63 @@ func joinNodes(nodes []Node, sep string) string {
 	return strings.Join(values, sep)
 }
 
+// quoteString returns a string literal for s, using only the
+// escape sequences that the lexer accepts.
+func quoteString(s string) string {
+
+	var b strings.Builder
+	b.WriteByte('"')
+
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+
+	b.WriteByte('"')
+	return b.String()
+}
+
+// isPlainName returns true if a field name can be written
+// without backquotes.
+func isPlainName(s string) bool {
+
+	switch s {
+	case "", "and", "or", "in", "true", "false", "null", "function", "λ":
+		return false
+	}
+
+	for i, r := range s {
+		switch {
+		case i == 0 && (r == '$' || r == '"' || r == '\'' || r == '`' || r >= '0' && r <= '9'):
+			return false
+		case isWhitespace(r) || lookupSymbol1(r) > 0 || lookupSymbol2(r) != nil:
+			return false
+		}
+	}
+
+	return true
+}
+
 var jsonEscapes = map[rune]string{
 	'"':  "\"",
 	'\\': "\\",
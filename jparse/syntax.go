@@ -0,0 +1,205 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jparse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Precedences of the built-in infix operators. A custom operator
+// with the same precedence as a built-in operator binds as
+// tightly as it does, and operators of equal precedence are
+// evaluated from left to right.
+const (
+	// PrecedenceMultiply is the precedence of *, / and %.
+	PrecedenceMultiply = 70
+
+	// PrecedenceAdd is the precedence of +, - and &.
+	PrecedenceAdd = 60
+
+	// PrecedenceCompare is the precedence of =, !=, <, <=, >,
+	// >=, in, ~> and ^.
+	PrecedenceCompare = 50
+
+	// PrecedenceAnd is the precedence of and.
+	PrecedenceAnd = 40
+
+	// PrecedenceOr is the precedence of or.
+	PrecedenceOr = 30
+)
+
+// An Operator is a custom infix operator.
+type Operator struct {
+	// Symbol is the operator as it's written in expressions.
+	// It's either a word, such as matches, which is a name
+	// like any other in the prefix position, or a sequence
+	// of the punctuation characters !#%&*+-./:<=>?@\^|~, such
+	// as <=>. A symbol takes precedence over the built-in
+	// operators that it starts with, so with a custom =-
+	// operator, a=-1 has to be written a = -1. Symbols cannot
+	// be keywords or built-in operators.
+	Symbol string
+
+	// Precedence is the operator's binding power, from
+	// PrecedenceOr to PrecedenceMultiply, inclusive. Values in
+	// between the precedences of the built-in operators, such
+	// as PrecedenceAdd+5, are allowed.
+	Precedence int
+}
+
+// A Syntax is the JSONata grammar extended with custom infix
+// operators, which are parsed to CustomOperatorNodes. The parse
+// methods of a nil Syntax are the same as the package's parse
+// functions. A Syntax is immutable and safe for concurrent use.
+type Syntax struct {
+	words   map[string]int
+	symbols map[string]int
+
+	// sorted holds the keys of symbols, longest first.
+	sorted []string
+}
+
+// NewSyntax returns a Syntax with the given operators.
+func NewSyntax(ops ...Operator) (*Syntax, error) {
+
+	s := &Syntax{
+		words:   map[string]int{},
+		symbols: map[string]int{},
+	}
+
+	for _, op := range ops {
+
+		if op.Precedence < PrecedenceOr || op.Precedence > PrecedenceMultiply {
+			return nil, fmt.Errorf("operator %s: precedence must be between %d and %d", op.Symbol, PrecedenceOr, PrecedenceMultiply)
+		}
+
+		if _, ok := s.words[op.Symbol]; ok {
+			return nil, fmt.Errorf("operator %s is defined more than once", op.Symbol)
+		}
+		if _, ok := s.symbols[op.Symbol]; ok {
+			return nil, fmt.Errorf("operator %s is defined more than once", op.Symbol)
+		}
+
+		switch {
+		case isWordSymbol(op.Symbol):
+			if lookupKeyword(op.Symbol) > 0 {
+				return nil, fmt.Errorf("operator %s is a keyword", op.Symbol)
+			}
+			s.words[op.Symbol] = op.Precedence
+		case isPunctSymbol(op.Symbol):
+			if isBuiltinSymbol(op.Symbol) {
+				return nil, fmt.Errorf("operator %s is a built-in operator", op.Symbol)
+			}
+			s.symbols[op.Symbol] = op.Precedence
+			s.sorted = append(s.sorted, op.Symbol)
+		default:
+			return nil, fmt.Errorf("%q is not a valid operator symbol", op.Symbol)
+		}
+	}
+
+	sort.SliceStable(s.sorted, func(i, j int) bool {
+		return len(s.sorted[i]) > len(s.sorted[j])
+	})
+
+	return s, nil
+}
+
+// Parse is like the package's Parse function but recognises the
+// Syntax's custom operators.
+func (s *Syntax) Parse(expr string) (Node, error) {
+	return parse(expr, s)
+}
+
+// ParseRanges is like the package's ParseRanges function but
+// recognises the Syntax's custom operators.
+func (s *Syntax) ParseRanges(expr string) (Node, map[Node]Range, error) {
+	return parseRanges(expr, s)
+}
+
+// ParseAll is like the package's ParseAll function but
+// recognises the Syntax's custom operators.
+func (s *Syntax) ParseAll(expr string) (Node, map[Node]Range, []error) {
+	return parseAll(expr, s)
+}
+
+// precedence returns the binding power of a custom operator.
+func (s *Syntax) precedence(symbol string) int {
+	if bp, ok := s.words[symbol]; ok {
+		return bp
+	}
+	return s.symbols[symbol]
+}
+
+// isWord returns true if name is a custom word operator.
+func (s *Syntax) isWord(name string) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.words[name]
+	return ok
+}
+
+// startsSymbol returns true if a custom symbol operator starts
+// with r.
+func (s *Syntax) startsSymbol(r rune) bool {
+	if s == nil {
+		return false
+	}
+	for _, sym := range s.sorted {
+		if first, _ := utf8.DecodeRuneInString(sym); first == r {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSymbol returns the length of the longest custom symbol
+// operator at the start of input, or 0 if there isn't one.
+func (s *Syntax) matchSymbol(input string) int {
+	if s == nil {
+		return 0
+	}
+	for _, sym := range s.sorted {
+		if strings.HasPrefix(input, sym) {
+			return len(sym)
+		}
+	}
+	return 0
+}
+
+func isWordSymbol(s string) bool {
+
+	if s == "" {
+		return false
+	}
+
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && unicode.IsDigit(r):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func isPunctSymbol(s string) bool {
+	return s != "" && strings.Trim(s, `!#%&*+-./:<=>?@\^|~`) == ""
+}
+
+func isBuiltinSymbol(s string) bool {
+	for _, sym := range symbolsAndKeywords {
+		if sym == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jparse_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+func newTestSyntax(t *testing.T) *jparse.Syntax {
+
+	s, err := jparse.NewSyntax(
+		jparse.Operator{Symbol: "matches", Precedence: jparse.PrecedenceCompare},
+		jparse.Operator{Symbol: "<=>", Precedence: jparse.PrecedenceCompare},
+		jparse.Operator{Symbol: "@", Precedence: jparse.PrecedenceAdd + 5},
+	)
+	if err != nil {
+		t.Fatalf("NewSyntax failed: %v", err)
+	}
+
+	return s
+}
+
+// testPath returns the syntax tree of a single name.
+func testPath(name string) jparse.Node {
+	return &jparse.PathNode{
+		Steps: []jparse.Node{
+			&jparse.NameNode{Value: name},
+		},
+	}
+}
+
+func TestSyntax(t *testing.T) {
+
+	s := newTestSyntax(t)
+
+	data := []struct {
+		Input  string
+		Output jparse.Node
+	}{
+		{
+			Input: `name matches "^A"`,
+			Output: &jparse.CustomOperatorNode{
+				Symbol: "matches",
+				LHS:    testPath("name"),
+				RHS:    &jparse.StringNode{Value: "^A"},
+			},
+		},
+		{
+			// Word operators are names in the prefix position.
+			Input: `matches matches matches`,
+			Output: &jparse.CustomOperatorNode{
+				Symbol: "matches",
+				LHS:    testPath("matches"),
+				RHS:    testPath("matches"),
+			},
+		},
+		{
+			// Symbols end names, and take precedence over the
+			// built-in <= operator.
+			Input: `a<=>b`,
+			Output: &jparse.CustomOperatorNode{
+				Symbol: "<=>",
+				LHS:    testPath("a"),
+				RHS:    testPath("b"),
+			},
+		},
+		{
+			Input: `a <= b`,
+			Output: &jparse.ComparisonOperatorNode{
+				Type: jparse.ComparisonLessEqual,
+				LHS:  testPath("a"),
+				RHS:  testPath("b"),
+			},
+		},
+		{
+			// @ binds more tightly than + but less tightly
+			// than *.
+			Input: `1 + 2 @ 3 * 4`,
+			Output: &jparse.NumericOperatorNode{
+				Type: jparse.NumericAdd,
+				LHS:  &jparse.NumberNode{Value: 1},
+				RHS: &jparse.CustomOperatorNode{
+					Symbol: "@",
+					LHS:    &jparse.NumberNode{Value: 2},
+					RHS: &jparse.NumericOperatorNode{
+						Type: jparse.NumericMultiply,
+						LHS:  &jparse.NumberNode{Value: 3},
+						RHS:  &jparse.NumberNode{Value: 4},
+					},
+				},
+			},
+		},
+		{
+			// Operators of equal precedence are left
+			// associative.
+			Input: `a <=> b = c`,
+			Output: &jparse.ComparisonOperatorNode{
+				Type: jparse.ComparisonEqual,
+				LHS: &jparse.CustomOperatorNode{
+					Symbol: "<=>",
+					LHS:    testPath("a"),
+					RHS:    testPath("b"),
+				},
+				RHS: testPath("c"),
+			},
+		},
+		{
+			Input: `a and b matches c`,
+			Output: &jparse.BooleanOperatorNode{
+				Type: jparse.BooleanAnd,
+				LHS:  testPath("a"),
+				RHS: &jparse.CustomOperatorNode{
+					Symbol: "matches",
+					LHS:    testPath("b"),
+					RHS:    testPath("c"),
+				},
+			},
+		},
+	}
+
+	for _, test := range data {
+
+		got, err := s.Parse(test.Input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.Output) {
+			t.Errorf("%s: expected %s, got %s", test.Input, test.Output, got)
+		}
+
+		// The string form parses to the same tree.
+		again, err := s.Parse(got.String())
+		if err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("%s: %s does not round trip (error %v)", test.Input, got, err)
+		}
+	}
+
+	// Without the syntax, the operators aren't recognised.
+	if _, err := jparse.Parse(`name matches "^A"`); err == nil {
+		t.Errorf("expected an error without the syntax")
+	}
+
+	// Symbols can't be used as prefix operators.
+	_, err := s.Parse(`@ a`)
+	if e, ok := err.(*jparse.Error); !ok || e.Type != jparse.ErrPrefix || e.Token != "@" {
+		t.Errorf("expected a prefix error, got %v", err)
+	}
+
+	_, ranges, err := s.ParseRanges(`x <=> y`)
+	if err != nil || len(ranges) != 5 {
+		t.Errorf("expected 5 ranges, got %v (error %v)", ranges, err)
+	}
+
+	if _, _, errs := s.ParseAll(`[a matches, b <=> c]`); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+}
+
+func TestNewSyntax(t *testing.T) {
+
+	data := []jparse.Operator{
+		{Symbol: "", Precedence: jparse.PrecedenceAdd},
+		{Symbol: "and", Precedence: jparse.PrecedenceAdd},
+		{Symbol: "true", Precedence: jparse.PrecedenceAdd},
+		{Symbol: "~>", Precedence: jparse.PrecedenceAdd},
+		{Symbol: "**", Precedence: jparse.PrecedenceAdd},
+		{Symbol: "1x", Precedence: jparse.PrecedenceAdd},
+		{Symbol: "a-b", Precedence: jparse.PrecedenceAdd},
+		{Symbol: "<$>", Precedence: jparse.PrecedenceAdd},
+		{Symbol: "x", Precedence: jparse.PrecedenceOr - 1},
+		{Symbol: "x", Precedence: jparse.PrecedenceMultiply + 1},
+	}
+
+	for _, op := range data {
+		if _, err := jparse.NewSyntax(op); err == nil {
+			t.Errorf("%q (%d): expected an error", op.Symbol, op.Precedence)
+		}
+	}
+
+	op := jparse.Operator{Symbol: "x", Precedence: jparse.PrecedenceAdd}
+	if _, err := jparse.NewSyntax(op, op); err == nil {
+		t.Errorf("expected an error for a duplicate operator")
+	}
+}
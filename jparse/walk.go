@@ -0,0 +1,95 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jparse
+
+// Walk traverses a syntax tree in depth-first order. It calls
+// fn for each node, starting with the root node. If fn returns
+// false, the children of that node are not visited.
+func Walk(node Node, fn func(Node) bool) {
+
+	if node == nil || !fn(node) {
+		return
+	}
+
+	for _, child := range Children(node) {
+		Walk(child, fn)
+	}
+}
+
+// Children returns the immediate child nodes of a node in
+// evaluation order. Leaf nodes have no children.
+func Children(node Node) []Node {
+
+	switch n := node.(type) {
+	case *PathNode:
+		return n.Steps
+	case *NegationNode:
+		return []Node{n.RHS}
+	case *RangeNode:
+		return []Node{n.LHS, n.RHS}
+	case *ArrayNode:
+		return n.Items
+	case *ObjectNode:
+		return pairNodes(n.Pairs)
+	case *BlockNode:
+		return n.Exprs
+	case *ObjectTransformationNode:
+		return nonNilNodes(n.Pattern, n.Updates, n.Deletes)
+	case *LambdaNode:
+		return []Node{n.Body}
+	case *TypedLambdaNode:
+		return []Node{n.Body}
+	case *PartialNode:
+		return append([]Node{n.Func}, n.Args...)
+	case *FunctionCallNode:
+		return append([]Node{n.Func}, n.Args...)
+	case *PredicateNode:
+		return append([]Node{n.Expr}, n.Filters...)
+	case *GroupNode:
+		return append([]Node{n.Expr}, pairNodes(n.Pairs)...)
+	case *ConditionalNode:
+		return nonNilNodes(n.If, n.Then, n.Else)
+	case *AssignmentNode:
+		return []Node{n.Value}
+	case *NumericOperatorNode:
+		return []Node{n.LHS, n.RHS}
+	case *ComparisonOperatorNode:
+		return []Node{n.LHS, n.RHS}
+	case *BooleanOperatorNode:
+		return []Node{n.LHS, n.RHS}
+	case *StringConcatenationNode:
+		return []Node{n.LHS, n.RHS}
+	case *CustomOperatorNode:
+		return []Node{n.LHS, n.RHS}
+	case *SortNode:
+		nodes := []Node{n.Expr}
+		for _, term := range n.Terms {
+			nodes = append(nodes, term.Expr)
+		}
+		return nodes
+	case *FunctionApplicationNode:
+		return []Node{n.LHS, n.RHS}
+	default:
+		return nil
+	}
+}
+
+func pairNodes(pairs [][2]Node) []Node {
+	nodes := make([]Node, 0, len(pairs)*2)
+	for _, pair := range pairs {
+		nodes = append(nodes, pair[0], pair[1])
+	}
+	return nodes
+}
+
+func nonNilNodes(nodes ...Node) []Node {
+	results := make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node != nil {
+			results = append(results, node)
+		}
+	}
+	return results
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jparse_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+func TestWalk(t *testing.T) {
+
+	data := []struct {
+		Input  string
+		Skip   func(jparse.Node) bool
+		Output []string
+	}{
+		{
+			Input: `Account.Order[Price > 100].Product`,
+			Output: []string{
+				"*jparse.PathNode",
+				"*jparse.NameNode",
+				"*jparse.PredicateNode",
+				"*jparse.NameNode",
+				"*jparse.ComparisonOperatorNode",
+				"*jparse.PathNode",
+				"*jparse.NameNode",
+				"*jparse.NumberNode",
+				"*jparse.NameNode",
+			},
+		},
+		{
+			Input: `$x ? {"a": 1} : $f(2)`,
+			Output: []string{
+				"*jparse.ConditionalNode",
+				"*jparse.VariableNode",
+				"*jparse.ObjectNode",
+				"*jparse.StringNode",
+				"*jparse.NumberNode",
+				"*jparse.FunctionCallNode",
+				"*jparse.VariableNode",
+				"*jparse.NumberNode",
+			},
+		},
+		{
+			Input: `function($x){ $x + 1 }($y)`,
+			Skip: func(node jparse.Node) bool {
+				_, ok := node.(*jparse.LambdaNode)
+				return ok
+			},
+			Output: []string{
+				"*jparse.FunctionCallNode",
+				"*jparse.LambdaNode",
+				"*jparse.VariableNode",
+			},
+		},
+	}
+
+	for _, test := range data {
+
+		node, err := jparse.Parse(test.Input)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Input, err)
+		}
+
+		var output []string
+		jparse.Walk(node, func(n jparse.Node) bool {
+			output = append(output, fmt.Sprintf("%T", n))
+			return test.Skip == nil || !test.Skip(n)
+		})
+
+		if !reflect.DeepEqual(output, test.Output) {
+			t.Errorf("%s: expected %v, got %v", test.Input, test.Output, output)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/lint"
+)
+
+const usage = `Usage:
+    jsonata-cli eval [-i <input file>] <expression>
+    jsonata-cli lint [-e <expression>] [<file> ...]
+`
+
+func main() {
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	var ok bool
+
+	switch os.Args[1] {
+	case "eval":
+		ok, err = runEval(os.Args[2:])
+	case "lint":
+		ok, err = runLint(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jsonata-cli: %s\n", err)
+		os.Exit(2)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// runEval evaluates an expression against JSON input from a
+// file or stdin and writes the result to stdout as JSON.
+func runEval(args []string) (bool, error) {
+
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	input := flags.String("i", "", "read the input from a file instead of stdin")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	expr, err := jsonata.Compile(flags.Arg(0))
+	if err != nil {
+		return false, err
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var data interface{}
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return false, fmt.Errorf("cannot read input: %s", err)
+	}
+
+	res, err := expr.Eval(data)
+	if err == jsonata.ErrUndefined {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	b, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Println(string(b))
+	return true, nil
+}
+
+// runLint lints an expression or the expressions in files and
+// prints the problems it finds. It returns false if there are
+// any problems.
+func runLint(args []string) (bool, error) {
+
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	expr := flags.String("e", "", "lint an expression instead of files")
+	flags.Parse(args)
+
+	if (*expr == "") == (flags.NArg() == 0) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		return false, err
+	}
+
+	if *expr != "" {
+		return lintExpr(comp, "<expr>", *expr)
+	}
+
+	ok := true
+	for _, file := range flags.Args() {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return false, err
+		}
+		clean, err := lintExpr(comp, file, string(b))
+		if err != nil {
+			return false, err
+		}
+		ok = ok && clean
+	}
+
+	return ok, nil
+}
+
+func lintExpr(comp *jsonata.Compiler, name, expr string) (bool, error) {
+
+	problems, err := lint.Lint(comp, expr)
+	if err != nil {
+		if errs, ok := err.(jsonata.CompileErrors); ok {
+			for _, e := range errs {
+				fmt.Printf("%s:%d:%d: %s\n", name, e.Line, e.Column, e.Err)
+			}
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, p := range problems {
+		fmt.Printf("%s:%s\n", name, p)
+	}
+
+	return len(problems) == 0, nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+//go:build js && wasm
+// +build js,wasm
+
+// jsonata-wasm is a WebAssembly module that adds a global
+// jsonata object to JavaScript (see package jwasm). Build it
+// with
+//
+//	GOOS=js GOARCH=wasm go build -o jsonata.wasm ./jsonata-wasm
+//
+// and load it with the wasm_exec.js that comes with Go.
+package main
+
+import (
+	"log"
+
+	"github.com/iwongu/jsonata-go/jwasm"
+)
+
+func main() {
+
+	if err := jwasm.Register("jsonata", nil); err != nil {
+		log.Fatal(err)
+	}
+
+	// Keep the functions available to JavaScript.
+	select {}
+}
@@ -29,7 +29,21 @@ type Extension struct {
 	// Func is a Go function that implements the custom
 	// functionality and returns either one or two values.
 	// The second return value, if provided, must be an
-	// error.
+	// error. A non-nil error stops evaluation and is
+	// returned as an ExtensionError, except for
+	// jtypes.ErrUndefined which makes the result undefined.
+	//
+	// If the first parameter of Func is a context.Context,
+	// it receives the context passed to EvalContext (or
+	// context.Background for Eval) and is not counted as a
+	// JSONata argument. Use it to make I/O respect
+	// cancellation and deadlines.
+	//
+	// Func can be variadic, in which case it accepts any
+	// number of trailing arguments. Undefined trailing
+	// arguments are skipped, and a single array argument
+	// is spread into its items if the array can't be
+	// passed as one value, so $f([1, 2]) calls Func(1, 2).
 	Func interface{}
 
 	// UndefinedHandler is a function that determines how
@@ -47,6 +61,78 @@ type Extension struct {
 	// true, the evaluation context is inserted as the first
 	// argument when Func is called.
 	EvalContextHandler jtypes.ArgHandler
+
+	// Signature is an optional JSONata type signature for
+	// Func, in the format used by typed lambdas, e.g.
+	//
+	//	<s-n?:s>
+	//
+	// If Signature is set, the evaluator checks the number
+	// and types of the arguments before calling Func. A
+	// contextable (-) first parameter receives the evaluation
+	// context if the caller omits it, and optional (?)
+	// parameters that are omitted or undefined receive the
+	// zero value of their Go type (or an unset value, for the
+	// jtypes Optional types). Array (a) parameters turn other
+	// values into single-item arrays. The signature must have
+	// one type per parameter of Func, not counting a leading
+	// context.Context, and must end with a variadic (+) type
+	// if and only if Func is variadic. Signature cannot be
+	// combined with EvalContextHandler.
+	Signature string
+
+	// Description is an optional description of the
+	// extension for function references (see
+	// Compiler.FunctionDocs).
+	Description string
+
+	// Deprecated, if non-empty, marks the extension as
+	// deprecated and says what to use instead, e.g. "use
+	// $formatDate". It appears in function references and
+	// is reported by the lint package. Deprecated functions
+	// can still be called.
+	Deprecated string
+
+	// CallBatch is an optional bulk version of Func. If
+	// CallBatch is non-nil, it is used instead of Func when
+	// the extension is called for every item in an array,
+	// either by $map or by a path step, e.g.
+	//
+	//	$map(ids, $lookup)
+	//	$map(ids, function($id) { $lookup($id) })
+	//	ids.$lookup($)
+	//
+	// Each element of args holds the arguments for one call,
+	// after argument handling and type conversion. CallBatch
+	// must return one result per call, in the same order. A
+	// nil result is treated as undefined.
+	CallBatch func(args [][]interface{}) ([]interface{}, error)
+}
+
+// A Callable is a JSONata function, such as a lambda, a
+// built-in function or a partial application, that is passed to
+// an extension. An extension receives one by declaring a
+// Callable parameter:
+//
+//	"retry": {Func: func(fn jsonata.Callable, times int) (interface{}, error) {
+//	    var err error
+//	    for i := 0; i < times; i++ {
+//	        var res interface{}
+//	        if res, err = fn.Invoke(); err == nil {
+//	            return res, nil
+//	        }
+//	    }
+//	    return nil, err
+//	}}
+//
+// A Callable is only valid during the call to the extension.
+type Callable interface {
+	jtypes.Callable
+
+	// Invoke calls the function with the given arguments.
+	// A nil argument is passed as undefined. Invoke returns
+	// ErrUndefined if the result is undefined.
+	Invoke(args ...interface{}) (interface{}, error)
 }
 
 // RegisterExts registers custom functions for use in JSONata
@@ -89,6 +175,7 @@ func RegisterVars(vars map[string]interface{}) error {
 type Expr struct {
 	node     jparse.Node
 	registry map[string]reflect.Value
+	kernels  map[jparse.Node]filterKernel
 }
 
 // Compile parses a JSONata expression and returns an Expr
@@ -102,8 +189,12 @@ func Compile(expr string) (*Expr, error) {
 		return nil, err
 	}
 
+	// Parsed syntax trees have no unsupported constructs.
+	kernels, _ := compileFilterKernels(node, false)
+
 	e := &Expr{
-		node: node,
+		node:    node,
+		kernels: kernels,
 	}
 
 	globalRegistryMutex.RLock()
@@ -138,6 +229,12 @@ func (e *Expr) Eval(data interface{}) (interface{}, error) {
 	if !ok {
 		input = reflect.ValueOf(data)
 	}
+	input = jtypes.ConvertTime(input)
+
+	input, err := readLazy(input, nil)
+	if err != nil {
+		return nil, err
+	}
 
 	result, err := eval(e.node, input, e.newEnv(input))
 	if err != nil {
@@ -178,6 +275,20 @@ func (e *Expr) EvalBytes(data []byte) ([]byte, error) {
 	return json.Marshal(v)
 }
 
+// Eval compiles expr and evaluates it against the given data.
+// It's a shorthand for scripts and tests that evaluate an
+// expression once. Expressions that are evaluated repeatedly
+// should be compiled once with Compile or Compiler.Compile.
+func Eval(expr string, data interface{}) (interface{}, error) {
+
+	e, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Eval(data)
+}
+
 // RegisterExts registers custom functions for use during
 // evaluation. Custom functions registered with this method
 // are only available to this Expr object. To make custom
@@ -233,6 +344,7 @@ func (e *Expr) newEnv(input reflect.Value) *environment {
 	tc := timeCallables(time.Now())
 
 	env := newEnvironment(baseEnv, len(tc)+len(e.registry)+1)
+	env.state = &evalState{kernels: e.kernels}
 
 	env.bind("$", input)
 	env.bindAll(tc)
@@ -305,6 +417,7 @@ func processExts(exts map[string]Extension) (map[string]reflect.Value, error) {
 		if err != nil {
 			return nil, fmt.Errorf("%s is not a valid function: %s", name, err)
 		}
+		callable.isExtension = true
 
 		if m == nil {
 			m = make(map[string]reflect.Value, len(exts))
@@ -332,7 +445,7 @@ func processVars(vars map[string]interface{}) (map[string]reflect.Value, error)
 		if m == nil {
 			m = make(map[string]reflect.Value, len(vars))
 		}
-		m[name] = reflect.ValueOf(value)
+		m[name] = jtypes.ConvertTime(reflect.ValueOf(value))
 	}
 
 	return m, nil
@@ -5,20 +5,305 @@
 package jsonata
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
 	"reflect"
 	"time"
 
+	"github.com/iwongu/jsonata-go/jlib"
 	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
 )
 
 // Compiler prepares compiled expressions with a predefined base registry
 // of variables and extensions. Safe to share across goroutines.
 type Compiler struct {
 	baseRegistry map[string]reflect.Value
+	equal        jlib.EqualFunc
+	order        jlib.KeyOrder
+	collate      jlib.CompareFunc
+	converters   valueConverters
+	resolver     Resolver
+
+	// accessors holds the path accessors shared by the
+	// expressions that the Compiler compiles.
+	accessors *accessorTable
+
+	// parallelism is the number of goroutines that an
+	// expression can use (see WithParallelism).
+	parallelism int
+
+	// memoize is set by WithMemoization.
+	memoize bool
+
+	// evalIDs makes evaluation IDs (see WithEvalIDs).
+	evalIDs func() string
+
+	// missingFuncs is set by WithMissingFunctions.
+	missingFuncs func(Warning)
+
+	// interpolation holds the values of the placeholders in
+	// the source of expressions (see WithInterpolation).
+	interpolation map[string]string
+
+	// profile is set by WithProfile.
+	profile *Profile
+
+	// observer is set by WithObserver.
+	observer EvalObserver
+
+	// backend is set by WithBackend.
+	backend Backend
+
+	// disabled and allowed hold the names of the functions
+	// passed to DisableFunctions and AllowFunctions. allowed
+	// is nil if all built-in functions are allowed.
+	disabled map[string]bool
+	allowed  map[string]bool
+
+	// limits is set by WithSizeLimits.
+	limits SizeLimits
+
+	// charMode and stringLimit are set by WithCharacterMode and
+	// WithMaxStringLength.
+	charMode    jlib.CharacterMode
+	stringLimit jlib.StringLimit
+
+	// compileLimits is set by WithCompileLimits.
+	compileLimits CompileLimits
+
+	// exprs records the Compiler's expressions for Stats and
+	// Trim.
+	exprs *exprRegistry
+
+	// libraries holds the libraries registered with
+	// RegisterLibrary.
+	libraries map[string]*library
+
+	// prelude is set by SetPrelude.
+	prelude *prelude
+
+	// rewriters holds the passes added with AddRewriter.
+	rewriters []Rewriter
+
+	// operators holds the operators registered with
+	// RegisterOperator, and syntax is the grammar that
+	// includes them.
+	operators map[string]*customOperator
+	syntax    *jparse.Syntax
+
+	// frozen is set on the default compiler when it's first
+	// used (see Default).
+	frozen bool
+}
+
+// A CompilerOption configures a Compiler.
+type CompilerOption func(*Compiler) error
+
+// WithRoundingMode sets the rounding mode used by the $round
+// function in expressions compiled by the Compiler. The default,
+// jlib.RoundHalfEven, is the behaviour required by the JSONata
+// specification.
+func WithRoundingMode(mode jlib.RoundingMode) CompilerOption {
+	return func(c *Compiler) error {
+		if !mode.IsValid() {
+			return fmt.Errorf("invalid rounding mode %d", mode)
+		}
+		return c.replaceBuiltin("round", mode.Round)
+	}
 }
 
-// NewCompiler creates a Compiler seeded with the provided variables and extensions.
-func NewCompiler(vars map[string]interface{}, exts map[string]Extension) (*Compiler, error) {
+// WithNullHandling sets how the $sum, $max, $min and $average
+// functions in expressions compiled by the Compiler treat null
+// elements in their input arrays. The default, jlib.NullsError,
+// is the behaviour required by the JSONata specification. Note
+// that undefined values never appear in arrays: they are removed
+// when the array is constructed.
+func WithNullHandling(h jlib.NullHandling) CompilerOption {
+	return func(c *Compiler) error {
+		if !h.IsValid() {
+			return fmt.Errorf("invalid null handling mode %d", h)
+		}
+		for name, fn := range map[string]interface{}{
+			"sum":     h.Sum,
+			"max":     h.Max,
+			"min":     h.Min,
+			"average": h.Average,
+		} {
+			if err := c.replaceBuiltin(name, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithCharacterMode sets what the $length, $substring and $pad
+// functions in expressions compiled by the Compiler count as a
+// character. The default, jlib.CodePoints, is the behaviour
+// required by the JSONata specification. jlib.Graphemes counts
+// user-perceived characters instead, so that emoji and letters
+// with combining accents in user-generated content aren't split.
+func WithCharacterMode(mode jlib.CharacterMode) CompilerOption {
+	return func(c *Compiler) error {
+		if !mode.IsValid() {
+			return fmt.Errorf("invalid character mode %d", mode)
+		}
+		c.charMode = mode
+		return c.replaceStringFuncs()
+	}
+}
+
+// replaceStringFuncs replaces $length, $substring and $pad with
+// versions that use the Compiler's character mode and string
+// length limit, so that WithCharacterMode and WithMaxStringLength
+// can be used together, in either order.
+func (c *Compiler) replaceStringFuncs() error {
+
+	mode, limit := c.charMode, c.stringLimit
+
+	var pad interface{} = mode.Pad
+	if limit.IsValid() {
+		pad = func(s string, width float64, chars jtypes.OptionalString) (string, error) {
+			return limit.PadMode(mode, s, width, chars)
+		}
+	}
+
+	for name, fn := range map[string]interface{}{
+		"length":    mode.Length,
+		"substring": mode.Substring,
+		"pad":       pad,
+	} {
+		if err := c.replaceBuiltin(name, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WithRandSource sets the source of randomness for the $random
+// and $shuffle functions in expressions compiled by the Compiler.
+// Use a seeded source to make their results reproducible, e.g. in
+// tests. The source is shared by all of the Compiler's expressions
+// so results are only reproducible if evaluations run in a fixed
+// order.
+func WithRandSource(src rand.Source) CompilerOption {
+	return func(c *Compiler) error {
+		r := jlib.NewRand(src)
+		if err := c.replaceBuiltin("random", r.Random); err != nil {
+			return err
+		}
+		return c.replaceBuiltin("shuffle", r.Shuffle)
+	}
+}
+
+// WithMapProgress registers a callback that reports the progress
+// of the $map function in expressions compiled by the Compiler.
+// The callback is called after every n items, and after the last
+// item, of each call to $map. It's called synchronously, so it
+// should return quickly. Results from asynchronous extensions
+// (see Future) may still be pending when progress is reported.
+func WithMapProgress(n int, fn func(jlib.MapProgress)) CompilerOption {
+	return func(c *Compiler) error {
+		if fn == nil {
+			return fmt.Errorf("progress callback cannot be nil")
+		}
+		return c.replaceBuiltin("map", jlib.NewProgressMapper(n, fn).Map)
+	}
+}
+
+// WithEqual sets a custom equality function for the =, != and in
+// operators and the $distinct function in expressions compiled by
+// the Compiler. The function is consulted first; if it returns ok
+// false the values are compared as usual. It applies to the values
+// being compared, not to the contents of arrays and objects, e.g.
+// to compare strings case-insensitively:
+//
+//	WithEqual(func(a, b interface{}) (bool, bool) {
+//		s1, ok1 := a.(string)
+//		s2, ok2 := b.(string)
+//		if !ok1 || !ok2 {
+//			return false, false
+//		}
+//		return strings.EqualFold(s1, s2), true
+//	})
+func WithEqual(fn jlib.EqualFunc) CompilerOption {
+	return func(c *Compiler) error {
+		if fn == nil {
+			return fmt.Errorf("equality function cannot be nil")
+		}
+		c.equal = fn
+		return c.replaceBuiltin("distinct", func(v reflect.Value) interface{} {
+			return jlib.DistinctFunc(v, fn)
+		})
+	}
+}
+
+// WithSortedMapKeys makes expressions compiled by the Compiler
+// visit the keys of Go maps in sorted order, so that results are
+// the same from run to run. It affects the wildcard (*) and
+// descendant (**) operators and the $each, $keys and $spread
+// functions. By default, map keys are visited in Go's map
+// iteration order, which is random.
+func WithSortedMapKeys() CompilerOption {
+	return func(c *Compiler) error {
+		order := jlib.SortedKeys
+		c.order = order
+		for name, fn := range map[string]interface{}{
+			"each":   order.Each,
+			"keys":   order.Keys,
+			"spread": order.Spread,
+		} {
+			if err := c.replaceBuiltin(name, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithCaseMapping replaces the functions used by $uppercase and
+// $lowercase in expressions compiled by the Compiler. By default,
+// they are strings.ToUpper and strings.ToLower, which apply
+// Unicode's simple case mappings without regard to language, so
+// that i becomes I even in Turkish and ß is left unchanged. The
+// jlocale subpackage provides mappings for a given language.
+func WithCaseMapping(upper, lower func(string) string) CompilerOption {
+	return func(c *Compiler) error {
+		if upper == nil || lower == nil {
+			return fmt.Errorf("case mapping functions cannot be nil")
+		}
+		if err := c.replaceBuiltin("uppercase", upper); err != nil {
+			return err
+		}
+		return c.replaceBuiltin("lowercase", lower)
+	}
+}
+
+// WithCollation sets the order in which strings are sorted by the
+// order-by operator (^) and the $sort function without a
+// comparator in expressions compiled by the Compiler. By default,
+// strings are sorted by their code points. The comparison
+// operators (<, <= etc.) are not affected. The jlocale subpackage
+// provides the collation order of a given language.
+func WithCollation(cmp jlib.CompareFunc) CompilerOption {
+	return func(c *Compiler) error {
+		if cmp == nil {
+			return fmt.Errorf("collation function cannot be nil")
+		}
+		c.collate = cmp
+		return c.replaceBuiltin("sort", func(v reflect.Value, swap jtypes.OptionalCallable) (interface{}, error) {
+			return jlib.SortFunc(v, swap, cmp)
+		})
+	}
+}
+
+// NewCompiler creates a Compiler seeded with the provided variables and
+// extensions. Options are applied after the variables and extensions
+// have been registered.
+func NewCompiler(vars map[string]interface{}, exts map[string]Extension, opts ...CompilerOption) (*Compiler, error) {
 	base := make(map[string]reflect.Value)
 
 	if len(vars) > 0 {
@@ -44,18 +329,179 @@ func NewCompiler(vars map[string]interface{}, exts map[string]Extension) (*Compi
 	if len(base) == 0 {
 		base = nil
 	}
-	return &Compiler{baseRegistry: base}, nil
+
+	c := &Compiler{baseRegistry: base, accessors: newAccessorTable(), exprs: newExprRegistry()}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// replaceBuiltin overrides a built-in function with a Go function
+// that has the same signature. The replacement uses the built-in's
+// argument handlers. It's an error if the Compiler has a variable,
+// extension, module or library with the built-in's name, as the
+// option that replaces the built-in would have no effect on it,
+// or would silently replace it.
+func (c *Compiler) replaceBuiltin(name string, fn interface{}) error {
+
+	if v, ok := c.baseRegistry[name]; (ok && !isReplacedBuiltin(v)) || c.libraries[name] != nil {
+		return fmt.Errorf("cannot change the built-in function %s: it has been replaced by a variable, extension, module or library", name)
+	}
+
+	v, ok := baseEnv.symbols[name]
+	if !ok {
+		panicf("%s is not a built-in function", name)
+	}
+	builtin := v.Interface().(*goCallable)
+
+	callable, err := newGoCallable(name, Extension{
+		Func:               fn,
+		UndefinedHandler:   builtin.undefinedHandler,
+		EvalContextHandler: builtin.contextHandler,
+	})
+	if err != nil {
+		return err
+	}
+
+	callable.fansOut = builtin.fansOut
+	c.setBase(name, reflect.ValueOf(callable))
+	return nil
+}
+
+// isReplacedBuiltin returns true if v, a value in a Compiler's
+// base registry, is a built-in function that was replaced by an
+// option, such as WithRoundingMode, rather than a variable,
+// extension or module.
+func isReplacedBuiltin(v reflect.Value) bool {
+	if !v.IsValid() || !v.CanInterface() {
+		return false
+	}
+	gc, ok := v.Interface().(*goCallable)
+	return ok && !gc.isExtension
+}
+
+func (c *Compiler) setBase(name string, v reflect.Value) {
+	if c.baseRegistry == nil {
+		c.baseRegistry = make(map[string]reflect.Value)
+	}
+	c.baseRegistry[name] = v
+	delete(c.libraries, name)
 }
 
 // Compile parses an expression and returns an Expression with the
 // compiler's base registry bound. The returned expression is immutable
-// and goroutine-safe.
+// and goroutine-safe. If the expression is not valid, Compile returns
+// a *CompileError that wraps a jparse.Error.
 func (c *Compiler) Compile(expr string) (*Expression, error) {
-	node, err := jparse.Parse(expr)
+	node, ranges, expr, errs := c.compileNode(expr, false)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	if errs := c.checkLibraries(node, expr, ranges); len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return c.newExpression(node, ranges, expr), nil
+}
+
+// CompileAll is like Compile except that it reports all of the
+// syntax errors in an invalid expression, not just the first one
+// (see jparse.ParseAll). This is useful for long expressions
+// that are edited in a UI. The error is a CompileErrors.
+func (c *Compiler) CompileAll(expr string) (*Expression, error) {
+	node, ranges, expr, errs := c.compileNode(expr, true)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if errs := c.checkLibraries(node, expr, ranges); len(errs) > 0 {
+		return nil, errs
+	}
+
+	return c.newExpression(node, ranges, expr), nil
+}
+
+// compileNode prepares the source of an expression, or of part
+// of one such as a decision table cell, as Compile does: it
+// replaces placeholders, parses the result with the Compiler's
+// syntax, applies the rewriters and checks the compile limits and
+// the disabled functions. It returns the syntax tree, its source
+// ranges and the source after interpolation. If all is true, all
+// of the syntax errors are reported, as in CompileAll; otherwise
+// only the first one is. References to libraries aren't checked,
+// as a library being registered resolves them itself, so callers
+// check them with checkLibraries.
+func (c *Compiler) compileNode(expr string, all bool) (jparse.Node, map[jparse.Node]jparse.Range, string, CompileErrors) {
+	expr, errs := c.interpolate(expr)
+	if len(errs) > 0 {
+		return nil, nil, expr, errs
+	}
+
+	if err := c.checkLength(expr); err != nil {
+		return nil, nil, expr, CompileErrors{err}
+	}
+
+	var node jparse.Node
+	var ranges map[jparse.Node]jparse.Range
+
+	if all {
+		var perrs []error
+		node, ranges, perrs = c.syntax.ParseAll(expr)
+		for _, err := range perrs {
+			errs = append(errs, newCompileError(err, expr))
+		}
+	} else {
+		var err error
+		node, ranges, err = c.syntax.ParseRanges(expr)
+		if err != nil {
+			errs = CompileErrors{newCompileError(err, expr)}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, expr, errs
+	}
+
+	node, cerr := c.rewrite(node, expr)
+	if cerr != nil {
+		return nil, nil, expr, CompileErrors{cerr}
+	}
+	resolveModuleCalls(node, ranges, c.moduleNames())
+
+	if err := c.checkComplexity(node, expr, ranges); err != nil {
+		return nil, nil, expr, CompileErrors{err}
+	}
+
+	if errs := c.checkDisabled(node, expr, ranges); len(errs) > 0 {
+		return nil, nil, expr, errs
+	}
+
+	return node, ranges, expr, nil
+}
+
+// MustCompile is like Compile except it panics if given an
+// invalid expression. It simplifies the initialization of
+// global variables holding compiled expressions.
+func (c *Compiler) MustCompile(expr string) *Expression {
+
+	e, err := c.Compile(expr)
 	if err != nil {
-		return nil, err
+		panicf("could not compile %s: %s", expr, err)
 	}
 
+	return e
+}
+
+// newExpression returns an Expression for a syntax tree, using
+// the compiler's current configuration. src is the source of the
+// syntax tree, if it has one, from which the Expression can be
+// compiled again after it's trimmed (see Compiler.Trim).
+func (c *Compiler) newExpression(node jparse.Node, ranges map[jparse.Node]jparse.Range, src string) *Expression {
+
 	var merged map[string]reflect.Value
 	if len(c.baseRegistry) > 0 {
 		merged = make(map[string]reflect.Value, len(c.baseRegistry))
@@ -64,45 +510,146 @@ func (c *Compiler) Compile(expr string) (*Expression, error) {
 		}
 	}
 
-	return &Expression{node: node, baseRegistry: merged}, nil
+	if disabled := c.disabledFunctions(); len(disabled) > 0 {
+		if merged == nil {
+			merged = make(map[string]reflect.Value, len(disabled))
+		}
+		for _, name := range disabled {
+			merged[name] = newDisabledCallable(name)
+		}
+	}
+
+	var converters valueConverters
+	if len(c.converters) > 0 {
+		converters = make(valueConverters, len(c.converters))
+		for k, v := range c.converters {
+			converters[k] = v
+		}
+	}
+
+	e := &Expression{
+		source:       src,
+		baseRegistry: merged,
+		evalIDs:      c.evalIDs,
+		missingFuncs: c.missingFuncs,
+		profile:      c.profile,
+		observer:     c.observer,
+		equal:        c.equal,
+		order:        c.order,
+		collate:      c.collate,
+		converters:   converters,
+		resolver:     c.resolver,
+		limits:       c.limits,
+		libraries:    c.linkLibraries(node),
+		prelude:      c.prelude,
+		operators:    c.operators,
+	}
+	if c.prelude != nil {
+		e.libraries = appendLibraries(c.prelude.libraries, e.libraries)
+	}
+	e.raw = e.newRawPlan(node)
+	e.art = c.newArtifacts(e, node, ranges)
+
+	return e
 }
 
 // Expression is an immutable, thread-safe compiled JSONata expression.
 // It can be evaluated concurrently by multiple goroutines.
 type Expression struct {
-	node         jparse.Node
+	source       string
+	art          *exprArtifacts
 	baseRegistry map[string]reflect.Value
+	evalIDs      func() string
+	missingFuncs func(Warning)
+	profile      *Profile
+	observer     EvalObserver
+	equal        jlib.EqualFunc
+	order        jlib.KeyOrder
+	collate      jlib.CompareFunc
+	converters   valueConverters
+	resolver     Resolver
+	limits       SizeLimits
+	libraries    []*library
+	prelude      *prelude
+	operators    map[string]*customOperator
+	raw          *rawPlan
+
+	// stages are the expressions of a pipeline (see Pipe).
+	// They're evaluated before the expression itself, which
+	// is $.
+	stages []*Expression
 }
 
 // Eval evaluates the expression with the provided input and per-evaluation variables.
 // vars may be nil. This method is safe for concurrent use across goroutines.
+//
+// data can be a JSON document as a json.RawMessage or a []byte, in which case
+// only the fields that the expression can read are decoded.
+//
+// If the result is undefined, Eval returns ErrUndefined (see EvalWithUndefined).
 func (e *Expression) Eval(data interface{}, vars map[string]interface{}) (interface{}, error) {
-	input, ok := data.(reflect.Value)
-	if !ok {
-		input = reflect.ValueOf(data)
+	return e.evalWithBase(context.Background(), nil, data, vars, nil)
+}
+
+// EvalContext is like Eval but uses ctx for the evaluation. If ctx is
+// cancelled while the evaluator is waiting for an asynchronous extension
+// (see Future), evaluation stops and ctx.Err() is returned.
+func (e *Expression) EvalContext(ctx context.Context, data interface{}, vars map[string]interface{}) (interface{}, error) {
+	return e.evalWithBase(ctx, nil, data, vars, nil)
+}
+
+// String returns the expression's source in canonical form,
+// regenerated from its syntax tree: whitespace is normalized,
+// strings are double-quoted, and ${NAME} placeholders (see
+// WithInterpolation) are shown with their values. The result
+// compiles to the same expression, so it can be used as a cache
+// key or logged to show exactly what was compiled. The
+// Compiler's prelude isn't included.
+func (e *Expression) String() string {
+	return e.compiled().node.String()
+}
+
+func (e *Expression) evalWithBase(ctx context.Context, base *environment, data interface{}, vars map[string]interface{}, shared *sharedCache) (interface{}, error) {
+
+	var result reflect.Value
+
+	data, err := e.decodeInput(data, vars)
+	if err != nil {
+		return nil, err
 	}
 
-	// Prepare per-eval extras from vars
-	var extraValues map[string]reflect.Value
-	if len(vars) > 0 {
-		values, err := processVars(vars)
-		if err != nil {
-			return nil, err
+	k := e.compiled()
+
+	if shared == nil {
+		if v, ok := e.evalFastPath(ctx, k, data); ok {
+			return exportResult(v)
 		}
-		extraValues = values
 	}
 
-	env := e.newEnv(input, extraValues)
-	result, err := eval(e.node, input, env)
+	if base == nil {
+		base = e.newBaseEnv()
+	}
+
+	err = e.withEvalEnv(ctx, k, base, data, vars, shared, func(input reflect.Value, env *environment) error {
+		var err error
+		result, err = eval(k.node, input, env)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	return exportResult(result)
+}
+
+// exportResult converts the result of an evaluation to the
+// value returned to the caller.
+func exportResult(result reflect.Value) (interface{}, error) {
 	if !result.IsValid() {
 		return nil, ErrUndefined
 	}
 	if !result.CanInterface() {
-		return nil, err
+		return nil, nil
 	}
 	if result.Kind() == reflect.Ptr && result.IsNil() {
 		return nil, nil
@@ -110,43 +657,174 @@ func (e *Expression) Eval(data interface{}, vars map[string]interface{}) (interf
 	return result.Interface(), nil
 }
 
-func (e *Expression) newEnv(input reflect.Value, extras map[string]reflect.Value) *environment {
+// withEvalEnv prepares the input and environment for a single
+// evaluation of k, the compiled form of e, and passes them to fn.
+func (e *Expression) withEvalEnv(ctx context.Context, k *compiledExpr, base *environment, data interface{}, vars map[string]interface{}, shared *sharedCache, fn func(input reflect.Value, env *environment) error) error {
+	ctx = e.evalIDContext(ctx)
+
+	if e.observer != nil {
+		return e.observeEval(ctx, func(ctx context.Context) error {
+			return e.evalInEnv(ctx, k, base, data, vars, shared, fn)
+		})
+	}
+
+	return e.evalInEnv(ctx, k, base, data, vars, shared, fn)
+}
+
+// evalInEnv is withEvalEnv without the EvalObserver.
+func (e *Expression) evalInEnv(ctx context.Context, k *compiledExpr, base *environment, data interface{}, vars map[string]interface{}, shared *sharedCache, fn func(input reflect.Value, env *environment) error) error {
+
+	if len(e.stages) > 0 {
+		var err error
+		data, err = e.evalStages(ctx, data, vars)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := e.decodeInput(data, vars)
+	if err != nil {
+		return err
+	}
+
+	input, err := readLazy(e.input(data), &environment{state: &evalState{
+		context:    ctx,
+		converters: e.converters,
+	}})
+	if err != nil {
+		return err
+	}
+
+	// Prepare per-eval extras from vars
+	var extraValues map[string]reflect.Value
+	if len(vars) > 0 {
+		values, err := processVars(vars)
+		if err != nil {
+			return err
+		}
+		extraValues = values
+	}
+
+	env := e.newCallEnv(k, base, input, extraValues)
+	env.state.context = ctx
+	env.state.shared = shared
+
+	if stats := evalStats(ctx); stats != nil {
+		env.state.stats = newStatsRecorder()
+		defer env.state.stats.merge(ctx, stats)
+	}
+
+	if ref := env.goContext(); ref != nil {
+		ref.ctx = ctx
+		defer func() { ref.ctx = nil }()
+	}
+
+	err = e.prelude.eval(input, env, extraValues)
+	if err == nil {
+		err = fn(input, env)
+	}
+	if p := env.state.profile; p != nil {
+		p.merge()
+	}
+
+	if err != nil {
+		return setEvalID(locateError(err, env.state.errNode, e.source, k.ranges), EvalID(ctx))
+	}
+
+	return nil
+}
+
+// input returns the input of an evaluation as a reflect.Value
+// with the expression's value converters applied.
+func (e *Expression) input(data interface{}) reflect.Value {
+	switch data := data.(type) {
+	case reflect.Value:
+		return e.converters.convert(data)
+	case *PreparedInput:
+		return data.value
+	default:
+		return e.converters.convert(reflect.ValueOf(data))
+	}
+}
+
+// newBaseEnv returns an environment containing the built-in
+// functions and the base registry. Callables are cloned so that
+// the environment can't be affected by concurrent evaluations.
+func (e *Expression) newBaseEnv() *environment {
+
+	entries := e.art.base.get()
+
+	env := newEnvironment(baseEnv, len(entries))
+	env.state = &evalState{
+		goContext: &evalContextRef{},
+	}
+
+	for _, entry := range entries {
+		switch {
+		case entry.callable != nil:
+			env.bind(entry.name, reflect.ValueOf(env.cloneGoCallable(entry.callable)))
+		case entry.module != nil:
+			env.bind(entry.name, reflect.ValueOf(entry.module.clone(env)))
+		default:
+			env.bind(entry.name, entry.value)
+		}
+	}
+
+	return env
+}
+
+// newCallEnv returns an environment for a single evaluation of k
+// on top of an environment returned by newBaseEnv.
+func (e *Expression) newCallEnv(k *compiledExpr, base *environment, input reflect.Value, extras map[string]reflect.Value) *environment {
 	tc := timeCallables(time.Now())
 
-	// Size hint: $ + time callables + base + extras
-	baseCount := len(e.baseRegistry)
-	env := newEnvironment(baseEnv, 1+len(tc)+baseCount+len(extras))
+	// Size hint: $ + time callables + extras
+	env := newEnvironment(base, 1+len(tc)+len(extras))
+	env.state = &evalState{
+		kernels:      k.kernels,
+		accessors:    k.accessors,
+		parallel:     k.parallel,
+		memo:         newMemoCache(k.memo),
+		equal:        e.equal,
+		order:        e.order,
+		collate:      e.collate,
+		converters:   e.converters,
+		resolver:     e.resolver,
+		missingFuncs: e.missingFuncs,
+		observer:     e.observer,
+		limits:       e.limits,
+		ranges:       k.ranges,
+		goContext:    base.goContext(),
+		operators:    e.operators,
+	}
+
+	if e.profile != nil {
+		// The profile's timings assume that nodes are
+		// evaluated one at a time.
+		env.state.parallel = nil
+		env.state.profile = newProfileRecorder(e.profile, e.source, k.ranges)
+	}
 
 	env.bind("$", input)
-	env.bindAll(tc)
-
-	// Clone built-in callables from baseEnv into this evaluation environment
-	if baseEnv != nil && baseEnv.symbols != nil {
-		for name, v := range baseEnv.symbols {
-			if v.IsValid() && v.CanInterface() {
-				if gc, ok := v.Interface().(*goCallable); ok {
-					env.bind(name, reflect.ValueOf(gc.clone()))
-				}
-			}
+
+	// The base registry takes precedence over the time callables
+	for name, v := range tc {
+		if _, ok := e.baseRegistry[name]; !ok {
+			env.bind(name, v)
 		}
 	}
 
-	// Bind base registry, cloning any goCallable
-	for name, v := range e.baseRegistry {
-		if v.IsValid() && v.CanInterface() {
-			if gc, ok := v.Interface().(*goCallable); ok {
-				env.bind(name, reflect.ValueOf(gc.clone()))
-				continue
-			}
-		}
-		env.bind(name, v)
+	// Library functions are defined in each evaluation so that
+	// they run with its state.
+	for _, lib := range e.libraries {
+		env.bind(lib.name, reflect.ValueOf(lib.module(env, input)))
 	}
 
 	// Bind per-eval extras, cloning any goCallable (unlikely for vars, but safe)
 	for name, v := range extras {
 		if v.IsValid() && v.CanInterface() {
 			if gc, ok := v.Interface().(*goCallable); ok {
-				env.bind(name, reflect.ValueOf(gc.clone()))
+				env.bind(name, reflect.ValueOf(env.cloneGoCallable(gc)))
 				continue
 			}
 		}
@@ -1,9 +1,21 @@
 package jsonata
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"unicode"
+
+	"github.com/iwongu/jsonata-go/jlib"
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
 )
 
 func TestExpressionAndEval_Simple(t *testing.T) {
@@ -51,6 +63,512 @@ func TestExpression_WithExtsAndEval(t *testing.T) {
 	}
 }
 
+func TestExpression_VariadicExtensions(t *testing.T) {
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"maxOf": {Func: func(xs ...float64) float64 {
+			max := math.Inf(-1)
+			for _, x := range xs {
+				max = math.Max(max, x)
+			}
+			return max
+		}},
+		"join": {Func: func(sep string, parts ...string) string {
+			return strings.Join(parts, sep)
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"$maxOf(1, 5, 3)", float64(5)},
+		{"$maxOf([1, 5, 3])", float64(5)},
+		{"$maxOf(1, missing, 3)", float64(3)},
+		{"$maxOf(values)", float64(8)},
+		{"$join('-', 'a', 'b', 'c')", "a-b-c"},
+		{"$join('-', ['a', 'b'])", "a-b"},
+		{"$join('-')", ""},
+	}
+
+	input := map[string]interface{}{
+		"values": []interface{}{2, 8, 4},
+	}
+
+	for _, test := range tests {
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.expr, err)
+		}
+
+		got, err := expr.Eval(input, nil)
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestExpression_ExtensionSignatures(t *testing.T) {
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"repeat": {
+			Func: func(s string, n float64) string {
+				if n == 0 {
+					n = 2
+				}
+				return strings.Repeat(s, int(n))
+			},
+			Signature: "<s-n?:s>",
+		},
+		"total": {
+			Func: func(xs []interface{}) int {
+				return len(xs)
+			},
+			Signature: "<a<n>:n>",
+		},
+		"label": {
+			Func: func(s string, n jtypes.OptionalInt) string {
+				if !n.IsSet() {
+					return s
+				}
+				return s + strconv.Itoa(n.Int)
+			},
+			Signature: "<sn?:s>",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr  string
+		want  interface{}
+		error string
+	}{
+		{expr: "$repeat('ab', 3)", want: "ababab"},
+		{expr: "$repeat('ab')", want: "abab"},
+		{expr: "name.$repeat()", want: "xx"},
+		{expr: "name ~> $repeat(3)", want: "xxx"},
+		{expr: "$repeat('ab', missing)", want: "abab"},
+		{expr: "$repeat(1, 2)", error: `argument 1 of function "repeat" does not match function signature`},
+		{expr: "$repeat('a', 1, 2)", error: `function "repeat" takes 2 argument(s), got 3`},
+		{expr: "$total([1, 2, 3])", want: 3},
+		{expr: "$total(5)", want: 1},
+		{expr: "$total(['a'])", error: `argument 1 of function "total" does not match function signature`},
+		{expr: "$label('v')", want: "v"},
+		{expr: "$label('v', 2)", want: "v2"},
+	}
+
+	input := map[string]interface{}{
+		"name": "x",
+	}
+
+	for _, test := range tests {
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.expr, err)
+		}
+
+		got, err := expr.Eval(input, nil)
+		if test.error != "" {
+			if err == nil || err.Error() != test.error {
+				t.Errorf("%s: expected error %q, got %v", test.expr, test.error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+	}
+
+	bad := []Extension{
+		{Func: func(string) string { return "" }, Signature: "<s"},
+		{Func: func(string) string { return "" }, Signature: "<sn>"},
+		{Func: func(string, string) string { return "" }, Signature: "<ss->"},
+		{Func: func(...string) string { return "" }, Signature: "<s>"},
+		{Func: func(string) string { return "" }, Signature: "<s+>"},
+		{
+			Func:               func(string) string { return "" },
+			Signature:          "<s->",
+			EvalContextHandler: func([]reflect.Value) bool { return true },
+		},
+	}
+
+	for _, ext := range bad {
+		if _, err := NewCompiler(nil, map[string]Extension{"bad": ext}); err == nil {
+			t.Errorf("%s: expected error", ext.Signature)
+		}
+	}
+}
+
+func TestExpression_CallableExtensions(t *testing.T) {
+	errFlaky := errors.New("try again")
+	failures := 0
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"retry": {Func: func(fn Callable, times int) (interface{}, error) {
+			var err error
+			for i := 0; i < times; i++ {
+				var res interface{}
+				if res, err = fn.Invoke(); err == nil {
+					return res, nil
+				}
+			}
+			return nil, err
+		}},
+		"flaky": {Func: func() (string, error) {
+			if failures > 0 {
+				failures--
+				return "", errFlaky
+			}
+			return "ok", nil
+		}},
+		"apply": {Func: func(fn Callable, args ...interface{}) (interface{}, error) {
+			return fn.Invoke(args...)
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		failures int
+		want     interface{}
+		err      error
+	}{
+		{expr: "$retry(function() { $flaky() }, 3)", failures: 2, want: "ok"},
+		{expr: "$retry($flaky, 3)", failures: 2, want: "ok"},
+		{expr: "$retry(function() { $flaky() }, 3)", failures: 3, err: errFlaky},
+		{expr: "$apply(function($x, $y) { $x + $y }, 1, 2)", want: float64(3)},
+		{expr: "$apply($uppercase, 'abc')", want: "ABC"},
+		{expr: "$apply($substring(?, 1), 'abc')", want: "bc"},
+		{expr: "$apply(function() { missing })", err: ErrUndefined},
+	}
+
+	for _, test := range tests {
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.expr, err)
+		}
+
+		failures = test.failures
+		got, err := expr.Eval(nil, nil)
+
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: expected error %v, got %v", test.expr, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestExpression_ExtensionErrors(t *testing.T) {
+	errNegative := errors.New("negative number")
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"sqrt": {Func: func(x float64) (float64, error) {
+			if x < 0 {
+				return 0, errNegative
+			}
+			return math.Sqrt(x), nil
+		}},
+		"apply": {Func: func(fn jtypes.Callable, x float64) (interface{}, error) {
+			v, err := fn.Call([]reflect.Value{reflect.ValueOf(x)})
+			if err != nil {
+				return nil, err
+			}
+			return v.Interface(), nil
+		}},
+		"none": {Func: func() (interface{}, error) {
+			return nil, jtypes.ErrUndefined
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		fn       string
+		position int
+	}{
+		{"$sqrt(-1)", "sqrt", 5},
+		{"1 + $sqrt(-4)", "sqrt", 9},
+		{"-1 ~> $sqrt()", "sqrt", 11},
+		{"$map([4, -1], $sqrt)", "sqrt", -1},
+		{"$apply($sqrt, -1)", "apply", 6},
+	}
+
+	for _, test := range tests {
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.expr, err)
+		}
+
+		_, err = expr.Eval(nil, nil)
+
+		var extErr *ExtensionError
+		if !errors.As(err, &extErr) {
+			t.Errorf("%s: expected ExtensionError, got %v (%T)", test.expr, err, err)
+			continue
+		}
+		if extErr.Func != test.fn {
+			t.Errorf("%s: expected function %s, got %q", test.expr, test.fn, extErr.Func)
+		}
+		if extErr.Position != test.position {
+			t.Errorf("%s: expected position %d, got %d", test.expr, test.position, extErr.Position)
+		}
+		if !errors.Is(err, errNegative) {
+			t.Errorf("%s: expected error to wrap %v, got %v", test.expr, errNegative, err)
+		}
+	}
+
+	// ErrUndefined is not an error.
+	expr, err := comp.Compile("$none()")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if _, err := expr.Eval(nil, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
+
+func TestCompiler_CompileErrors(t *testing.T) {
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		want CompileError
+	}{
+		{"orders[", CompileError{Code: "S0207", Position: 7, Line: 1, Column: 8, SourceLine: "orders["}},
+		{"1..\"z\"", CompileError{Code: "S0201", Token: "..", Position: 1, Line: 1, Column: 2, SourceLine: "1..\"z\""}},
+		{"(\n  \"é\" & )", CompileError{Code: "S0211", Token: ")", Position: 11, Line: 2, Column: 9, SourceLine: "  \"é\" & )"}},
+		{"{\n  \"a\": 1 \"b\"\r\n}", CompileError{Code: "S0202", Token: "b", Position: 12, Line: 2, Column: 11, SourceLine: "  \"a\": 1 \"b\""}},
+	}
+
+	for _, test := range tests {
+		_, err := comp.Compile(test.expr)
+
+		var cerr *CompileError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%q: expected CompileError, got %v (%T)", test.expr, err, err)
+			continue
+		}
+
+		var perr *jparse.Error
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: expected the error to wrap a jparse.Error", test.expr)
+		}
+
+		got := *cerr
+		got.Err = nil
+		if got != test.want {
+			t.Errorf("%q: expected %#v, got %#v", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestCompileError_Error(t *testing.T) {
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{
+			expr: "orders[",
+			want: "unexpected end of expression at line 1, column 8\n" +
+				"orders[\n" +
+				"       ^",
+		},
+		{
+			expr: "(\n\t$x := \"é\" ++ 1\n)",
+			want: "the symbol '+' cannot be used as a prefix operator at line 2, column 13\n" +
+				"\t$x := \"é\" ++ 1\n" +
+				"\t           ^",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := comp.Compile(test.expr)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.expr)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("%q: expected error:\n%s\ngot:\n%s", test.expr, test.want, got)
+		}
+	}
+
+	// Errors without a location are unchanged.
+	err = &CompileError{Position: -1, Err: errors.New("bad expression")}
+	if got := err.Error(); got != "bad expression" {
+		t.Errorf("unexpected error %q", got)
+	}
+}
+
+func TestCompiler_CompileAll(t *testing.T) {
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	expr := "{\n  \"total\": $sum(orders.price qty),\n  \"count\": $count(orders) +\n}"
+
+	_, err = comp.CompileAll(expr)
+
+	var errs CompileErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected CompileErrors, got %v (%T)", err, err)
+	}
+
+	want := []CompileError{
+		{Code: "S0201", Token: "qty", Position: 31, Line: 2, Column: 30, SourceLine: "  \"total\": $sum(orders.price qty),"},
+		{Code: "S0211", Token: "}", Position: 65, Line: 4, Column: 1, SourceLine: "}"},
+	}
+
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %d: %v", len(want), len(errs), err)
+	}
+	for i := range want {
+		got := *errs[i]
+		got.Err = nil
+		if got != want[i] {
+			t.Errorf("error %d: expected %#v, got %#v", i, want[i], got)
+		}
+	}
+
+	if got, want := err.Error(), errs[0].Error()+"\n"+errs[1].Error(); got != want {
+		t.Errorf("expected error:\n%s\ngot:\n%s", want, got)
+	}
+
+	e, err := comp.CompileAll(`$sum(orders.price)`)
+	if err != nil {
+		t.Fatalf("CompileAll failed: %v", err)
+	}
+	got, err := e.Eval(map[string]interface{}{"orders": []interface{}{
+		map[string]interface{}{"price": 2},
+		map[string]interface{}{"price": 3},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if got != float64(5) {
+		t.Errorf("expected 5, got %v", got)
+	}
+}
+
+func TestExpression_EvalErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"fail": {Func: func(s string) (string, error) {
+			return "", errBoom
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"name":  "x",
+		"items": []interface{}{map[string]interface{}{"price": 1}},
+	}
+
+	tests := []struct {
+		expr  string
+		want  EvalError
+		cause error
+	}{
+		{
+			expr: "$string(1/0)",
+			want: EvalError{Type: ErrNumberInf, Token: "1/0", Value: "/", Code: "D1001", Position: 8, Line: 1, Column: 9},
+		},
+		{
+			expr: "items[\n  price > \"a\"\n]",
+			want: EvalError{Type: ErrTypeMismatch, Value: ">", Code: "T2009", Position: 9, Line: 2, Column: 3},
+		},
+		{
+			expr: "$count(items.$foo())",
+			want: EvalError{Type: ErrNonCallable, Token: "$foo", Code: "T1006", Position: 13, Line: 1, Column: 14},
+		},
+		{
+			expr:  "\"é\" & $uppercase(1, 2)",
+			want:  EvalError{Type: ErrWrapped, Token: "$uppercase(1, 2)", Code: "T0410", Position: 7, Line: 1, Column: 7},
+			cause: &ArgCountError{Func: "uppercase", Expected: 1, Received: 2},
+		},
+		{
+			expr:  "(\n  $x := 1;\n  $fail(name)\n)",
+			want:  EvalError{Type: ErrWrapped, Token: "$fail(name)", Position: 15, Line: 3, Column: 3},
+			cause: &ExtensionError{Func: "fail", Position: 20, Err: errBoom},
+		},
+		{
+			expr: "(\n  $f := function($n) { $n + $f($n) };\n  $f(1)\n)",
+			want: EvalError{Type: ErrStackOverflow, Token: "$f", Code: "U1001", Position: 30, Line: 2, Column: 29},
+		},
+	}
+
+	for _, test := range tests {
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Fatalf("%q: Compile failed: %v", test.expr, err)
+		}
+
+		_, err = expr.Eval(input, nil)
+
+		var evalErr *EvalError
+		if !errors.As(err, &evalErr) {
+			t.Errorf("%q: expected EvalError, got %v (%T)", test.expr, err, err)
+			continue
+		}
+
+		got := *evalErr
+		got.Err = nil
+		if test.want.Token == "" {
+			got.Token = ""
+		}
+		if got != test.want {
+			t.Errorf("%q: expected %#v, got %#v", test.expr, test.want, got)
+		}
+		if !reflect.DeepEqual(evalErr.Err, test.cause) {
+			t.Errorf("%q: expected cause %v, got %v", test.expr, test.cause, evalErr.Err)
+		}
+	}
+
+	// The legacy API's errors don't have locations.
+	_, err = MustCompile("$string(1/0)").Eval(nil)
+	if !reflect.DeepEqual(err, &EvalError{Type: ErrNumberInf, Value: "/"}) {
+		t.Errorf("unexpected error %#v", err)
+	}
+}
+
 func TestEvaluator_ConcurrentEval(t *testing.T) {
 	// Use a contextable builtin via function application to exercise per-call context.
 	comp, err := NewCompiler(nil, nil)
@@ -235,3 +753,573 @@ func TestCompiler_MergeWithEvaluatorExtras(t *testing.T) {
 		t.Fatalf("expected Hi, got %v", out)
 	}
 }
+
+func TestCompiler_MustCompile(t *testing.T) {
+	comp, err := NewCompiler(map[string]interface{}{"greet": "Hello"}, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	out, err := comp.MustCompile("$greet & ' ' & name").Eval(map[string]interface{}{"name": "Ada"}, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if out.(string) != "Hello Ada" {
+		t.Fatalf("expected Hello Ada, got %v", out)
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatalf("expected MustCompile to panic on an invalid expression")
+		}
+		if s, ok := r.(string); !ok || !strings.HasPrefix(s, "could not compile $greet &:") {
+			t.Fatalf("unexpected panic value %v", r)
+		}
+	}()
+	comp.MustCompile("$greet &")
+}
+
+func TestCompiler_WithRoundingMode(t *testing.T) {
+	tests := []struct {
+		mode jlib.RoundingMode
+		want []interface{}
+	}{
+		{jlib.RoundHalfEven, []interface{}{float64(2), float64(-2), 4.52, float64(12400)}},
+		{jlib.RoundHalfUp, []interface{}{float64(3), float64(-2), 4.53, float64(12500)}},
+		{jlib.RoundHalfAwayFromZero, []interface{}{float64(3), float64(-3), 4.53, float64(12500)}},
+	}
+
+	for _, tt := range tests {
+		comp, err := NewCompiler(nil, nil, WithRoundingMode(tt.mode))
+		if err != nil {
+			t.Fatalf("NewCompiler failed: %v", err)
+		}
+		expr, err := comp.Compile("[$round(2.5), $round(-2.5), $round(4.525, 2), 12450 ~> $round(-2)]")
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		out, err := expr.Eval(nil, nil)
+		if err != nil {
+			t.Fatalf("Eval failed: %v", err)
+		}
+		if !reflect.DeepEqual(out, tt.want) {
+			t.Errorf("mode %d: expected %v, got %v", tt.mode, tt.want, out)
+		}
+	}
+
+	// The default compiler uses the spec's round-half-to-even.
+	out, err := evalNew(t, "$round(0.5)", nil, nil, nil)
+	if err != nil || out != float64(0) {
+		t.Errorf("expected 0, got %v (%v)", out, err)
+	}
+
+	if _, err := NewCompiler(nil, nil, WithRoundingMode(jlib.RoundingMode(99))); err == nil {
+		t.Errorf("expected error for invalid rounding mode")
+	}
+}
+
+func TestCompiler_WithRandSource(t *testing.T) {
+	eval := func() []interface{} {
+		comp, err := NewCompiler(nil, nil, WithRandSource(rand.NewSource(42)))
+		if err != nil {
+			t.Fatalf("NewCompiler failed: %v", err)
+		}
+		expr, err := comp.Compile("[$random(), $shuffle([1, 2, 3, 4, 5, 6, 7, 8]), $random()]")
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		out, err := expr.Eval(nil, nil)
+		if err != nil {
+			t.Fatalf("Eval failed: %v", err)
+		}
+		return out.([]interface{})
+	}
+
+	first, second := eval(), eval()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected identical results from identically seeded compilers, got %v and %v", first, second)
+	}
+	if first[0] == first[2] {
+		t.Errorf("expected successive $random calls to differ, got %v", first)
+	}
+
+	r := rand.New(rand.NewSource(42))
+	if want := r.Float64(); first[0] != want {
+		t.Errorf("expected first $random() to return %v, got %v", want, first[0])
+	}
+
+	// Undefined arguments are handled like the built-in.
+	comp, err := NewCompiler(nil, nil, WithRandSource(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err := comp.Compile("$shuffle(nothing)")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	out, err := expr.Eval(nil, nil)
+	if err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v (%v)", err, out)
+	}
+}
+
+func TestCompiler_WithMapProgress(t *testing.T) {
+	var reports []jlib.MapProgress
+
+	comp, err := NewCompiler(nil, nil, WithMapProgress(2, func(p jlib.MapProgress) {
+		reports = append(reports, p)
+	}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err := comp.Compile("$map([1, 2, 3, 4, 5], function($n) { $n > 2 ? $n * 2 })")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	out, err := expr.Eval(nil, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	want := []interface{}{float64(6), float64(8), float64(10)}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("expected %v, got %v", want, out)
+	}
+
+	// Progress is reported every 2 items and after the last item.
+	var done []int
+	for i, p := range reports {
+		if p.Total != 5 {
+			t.Errorf("report %d: expected Total 5, got %d", i, p.Total)
+		}
+		if i > 0 && p.Elapsed < reports[i-1].Elapsed {
+			t.Errorf("report %d: elapsed time went backwards", i)
+		}
+		done = append(done, p.Done)
+	}
+	if exp := []int{2, 4, 5}; !reflect.DeepEqual(done, exp) {
+		t.Errorf("expected progress at %v, got %v", exp, done)
+	}
+
+	// Undefined arguments are handled like the built-in.
+	expr, err = comp.Compile("$map(nothing, $string)")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if out, err := expr.Eval(nil, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v (%v)", err, out)
+	}
+
+	if _, err := NewCompiler(nil, nil, WithMapProgress(10, nil)); err == nil {
+		t.Errorf("expected error for nil callback")
+	}
+}
+
+func TestCompiler_WithEqual(t *testing.T) {
+	// Compare phone numbers by their digits, whether they're
+	// strings or numbers.
+	digits := func(v interface{}) (string, bool) {
+		switch v := v.(type) {
+		case string:
+			return strings.Map(func(r rune) rune {
+				if r < '0' || r > '9' {
+					return -1
+				}
+				return r
+			}, v), true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		default:
+			return "", false
+		}
+	}
+	samePhone := func(a, b interface{}) (bool, bool) {
+		d1, ok1 := digits(a)
+		d2, ok2 := digits(b)
+		if !ok1 || !ok2 {
+			return false, false
+		}
+		return d1 == d2, true
+	}
+
+	comp, err := NewCompiler(nil, nil, WithEqual(samePhone))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"contacts": []interface{}{
+			map[string]interface{}{"name": "Ada", "phone": "(555) 010-0199"},
+			map[string]interface{}{"name": "Bob", "phone": "555.010.0100"},
+			map[string]interface{}{"name": "Cy", "phone": "555-010-0199"},
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{`"555-010-0199" = contacts[0].phone`, true},
+		{`contacts[0].phone != 5550100199`, false},
+		{`"5550100100" in contacts.phone`, true},
+		{`contacts[phone = "5550100199"].name`, []interface{}{"Ada", "Cy"}},
+		{`contacts["555 010 0100" = phone].name`, "Bob"},
+		{`$count($distinct(contacts.phone))`, 2},
+		// Other values are compared as usual.
+		{`[1, 2] = [1, 2]`, true},
+		{`true in [1, false]`, false},
+		{`contacts[name > "B"].name`, []interface{}{"Bob", "Cy"}},
+	}
+
+	for _, test := range tests {
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.expr, err)
+		}
+		out, err := expr.Eval(input, nil)
+		if err != nil {
+			t.Fatalf("%s: Eval failed: %v", test.expr, err)
+		}
+		if !reflect.DeepEqual(out, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, out)
+		}
+	}
+
+	if _, err := NewCompiler(nil, nil, WithEqual(nil)); err == nil {
+		t.Errorf("expected error for nil equality function")
+	}
+}
+
+func TestCompiler_WithNullHandling(t *testing.T) {
+	input := map[string]interface{}{
+		"readings": []interface{}{4, nil, 2, nil},
+	}
+
+	tests := []struct {
+		mode jlib.NullHandling
+		want []interface{}
+	}{
+		{jlib.NullsSkip, []interface{}{float64(6), float64(4), float64(2), float64(3)}},
+		{jlib.NullsAsZero, []interface{}{float64(6), float64(4), float64(0), 1.5}},
+	}
+
+	for _, test := range tests {
+		comp, err := NewCompiler(nil, nil, WithNullHandling(test.mode))
+		if err != nil {
+			t.Fatalf("NewCompiler failed: %v", err)
+		}
+		expr, err := comp.Compile("[$sum(readings), $max(readings), $min(readings), $average(readings)]")
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		out, err := expr.Eval(input, nil)
+		if err != nil {
+			t.Fatalf("mode %d: Eval failed: %v", test.mode, err)
+		}
+		if !reflect.DeepEqual(out, test.want) {
+			t.Errorf("mode %d: expected %v, got %v", test.mode, test.want, out)
+		}
+	}
+
+	// The default is to return an error.
+	comp, err := NewCompiler(nil, nil, WithNullHandling(jlib.NullsError))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err := comp.Compile("$sum(readings)")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if _, err := expr.Eval(input, nil); err == nil {
+		t.Errorf("expected error for null elements")
+	}
+
+	if _, err := NewCompiler(nil, nil, WithNullHandling(jlib.NullHandling(99))); err == nil {
+		t.Errorf("expected error for invalid null handling mode")
+	}
+}
+
+func TestCompiler_WithCharacterMode(t *testing.T) {
+	input := map[string]interface{}{
+		// A family emoji, a flag and an e with a combining
+		// acute accent.
+		"text": "\U0001F468\u200D\U0001F469\u200D\U0001F467\U0001F1EF\U0001F1F5e\u0301!",
+	}
+
+	tests := []struct {
+		mode jlib.CharacterMode
+		want []interface{}
+	}{
+		{jlib.CodePoints, []interface{}{10, "\U0001F469", "\U0001F468\u200D\U0001F469\u200D\U0001F467\U0001F1EF\U0001F1F5e\u0301!.."}},
+		{jlib.Graphemes, []interface{}{4, "e\u0301", "\U0001F468\u200D\U0001F469\u200D\U0001F467\U0001F1EF\U0001F1F5e\u0301!.."}},
+	}
+
+	for _, test := range tests {
+		comp, err := NewCompiler(nil, nil, WithCharacterMode(test.mode))
+		if err != nil {
+			t.Fatalf("NewCompiler failed: %v", err)
+		}
+		width := 12
+		if test.mode == jlib.Graphemes {
+			width = 6
+		}
+		expr, err := comp.Compile(fmt.Sprintf(`[$length(text), $substring(text, 2, 1), $pad(text, %d, ".")]`, width))
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		out, err := expr.Eval(input, nil)
+		if err != nil {
+			t.Fatalf("mode %d: Eval failed: %v", test.mode, err)
+		}
+		if !reflect.DeepEqual(out, test.want) {
+			t.Errorf("mode %d: expected %q, got %q", test.mode, test.want, out)
+		}
+	}
+
+	if _, err := NewCompiler(nil, nil, WithCharacterMode(jlib.CharacterMode(99))); err == nil {
+		t.Errorf("expected error for invalid character mode")
+	}
+
+	// The string length limit applies in either order.
+	for _, opts := range [][]CompilerOption{
+		{WithMaxStringLength(10), WithCharacterMode(jlib.Graphemes)},
+		{WithCharacterMode(jlib.Graphemes), WithMaxStringLength(10)},
+	} {
+		comp, err := NewCompiler(nil, nil, opts...)
+		if err != nil {
+			t.Fatalf("NewCompiler failed: %v", err)
+		}
+		var jerr *jlib.Error
+		if _, err := comp.MustCompile(`$pad("a", 1000)`).Eval(nil, nil); !errors.As(err, &jerr) || jerr.Type != jlib.ErrStringTooLong {
+			t.Errorf("expected ErrStringTooLong, got %v", err)
+		}
+		if got, err := comp.MustCompile(`$pad("e\u0301", 3, ".")`).Eval(nil, nil); err != nil || got != "e\u0301.." {
+			t.Errorf("expected graphemes to be counted, got %q (error %v)", got, err)
+		}
+	}
+}
+
+func TestCompiler_WithCaseMapping(t *testing.T) {
+	comp, err := NewCompiler(nil, nil, WithCaseMapping(
+		func(s string) string { return strings.ToUpperSpecial(unicode.TurkishCase, s) },
+		func(s string) string { return strings.ToLowerSpecial(unicode.TurkishCase, s) },
+	))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	out, err := comp.MustCompile(`[$uppercase("istanbul"), $lowercase("DİYARBAKIR")]`).Eval(nil, nil)
+	want := []interface{}{"İSTANBUL", "diyarbakır"}
+	if err != nil || !reflect.DeepEqual(out, want) {
+		t.Errorf("expected %q, got %q (error %v)", want, out, err)
+	}
+
+	if _, err := NewCompiler(nil, nil, WithCaseMapping(strings.ToUpper, nil)); err == nil {
+		t.Errorf("expected error for nil case mapping")
+	}
+}
+
+func TestCompiler_WithCollation(t *testing.T) {
+	// A case-insensitive order that puts accented letters
+	// next to their base letters.
+	fold := strings.NewReplacer("é", "e", "ö", "o")
+	cmp := func(a, b string) int {
+		return strings.Compare(fold.Replace(strings.ToLower(a)), fold.Replace(strings.ToLower(b)))
+	}
+
+	comp, err := NewCompiler(nil, nil, WithCollation(cmp))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"people": []interface{}{
+			map[string]interface{}{"name": "Zoë", "age": 30.0},
+			map[string]interface{}{"name": "émile", "age": 25.0},
+			map[string]interface{}{"name": "Öskar", "age": 40.0},
+			map[string]interface{}{"name": "adam", "age": 35.0},
+			map[string]interface{}{"name": "Emile", "age": 20.0},
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{`$sort(people.name)`, []interface{}{"adam", "émile", "Emile", "Öskar", "Zoë"}},
+		{`people^(name).name`, []interface{}{"adam", "émile", "Emile", "Öskar", "Zoë"}},
+		{`people^(>name).name`, []interface{}{"Zoë", "Öskar", "émile", "Emile", "adam"}},
+		// Names that collate together are ordered by the next
+		// term.
+		{`people^(name, age).name`, []interface{}{"adam", "Emile", "émile", "Öskar", "Zoë"}},
+		// Numbers and comparison operators are unaffected.
+		{`people^(>age).age`, []interface{}{40.0, 35.0, 30.0, 25.0, 20.0}},
+		{`"Zoë" < "adam"`, true},
+	}
+
+	for _, test := range tests {
+		out, err := comp.MustCompile(test.expr).Eval(input, nil)
+		if err != nil || !reflect.DeepEqual(out, test.want) {
+			t.Errorf("%s: expected %v, got %v (error %v)", test.expr, test.want, out, err)
+		}
+	}
+
+	if _, err := NewCompiler(nil, nil, WithCollation(nil)); err == nil {
+		t.Errorf("expected error for nil collation")
+	}
+}
+
+func TestCompiler_ReplaceBuiltinConflicts(t *testing.T) {
+	ext := Extension{Func: func(v interface{}) string { return "ext" }}
+
+	tests := []struct {
+		name string
+		opt  CompilerOption
+	}{
+		{"round", WithRoundingMode(jlib.RoundHalfUp)},
+		{"random", WithRandSource(rand.NewSource(1))},
+		{"map", WithMapProgress(1, func(jlib.MapProgress) {})},
+		{"distinct", WithEqual(func(a, b interface{}) (bool, bool) { return false, false })},
+		{"sum", WithNullHandling(jlib.NullsSkip)},
+		{"keys", WithSortedMapKeys()},
+		{"uppercase", WithCaseMapping(strings.ToUpper, strings.ToLower)},
+		{"sort", WithCollation(strings.Compare)},
+		{"length", WithCharacterMode(jlib.Graphemes)},
+		{"pad", WithMaxStringLength(100)},
+	}
+
+	for _, test := range tests {
+		// Options don't replace extensions or variables with
+		// the same name as a built-in.
+		if _, err := NewCompiler(nil, map[string]Extension{test.name: ext}, test.opt); err == nil {
+			t.Errorf("%s: expected an error for an extension", test.name)
+		}
+		if _, err := NewCompiler(map[string]interface{}{test.name: 1}, nil, test.opt); err == nil {
+			t.Errorf("%s: expected an error for a variable", test.name)
+		}
+
+		// Options can be combined with each other and applied
+		// more than once.
+		if _, err := NewCompiler(nil, nil, test.opt, test.opt); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+
+	// Without an option, the extension replaces the built-in.
+	comp, err := NewCompiler(nil, map[string]Extension{"round": ext})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	if got, err := comp.MustCompile(`$round(1.5)`).Eval(nil, nil); err != nil || got != "ext" {
+		t.Errorf("expected ext, got %v (error %v)", got, err)
+	}
+}
+
+func TestCompiler_WithSortedMapKeys(t *testing.T) {
+	input := map[string]interface{}{
+		"d": 4,
+		"b": map[string]interface{}{"y": 2, "x": 1},
+		"a": 1,
+		"c": map[string]int{"z": 3, "w": 0},
+		"e": 5,
+	}
+
+	comp, err := NewCompiler(nil, nil, WithSortedMapKeys())
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"$keys()", []string{"a", "b", "c", "d", "e"}},
+		{"$keys([b, c])", []string{"x", "y", "w", "z"}},
+		{"*[$type($) = 'number']", []interface{}{1, 4, 5}},
+		{"**[$type($) = 'number']", []interface{}{1, 1, 2, 0, 3, 4, 5}},
+		{"$each(b, function($v, $k) { $k & '=' & $v })", []interface{}{"x=1", "y=2"}},
+		{"$spread(c)", []interface{}{
+			map[string]interface{}{"w": 0},
+			map[string]interface{}{"z": 3},
+		}},
+	}
+
+	for _, test := range tests {
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Fatalf("%s: Compile failed: %v", test.expr, err)
+		}
+		// Map iteration order is random, so repeat each
+		// evaluation to make sure that the order is stable.
+		for i := 0; i < 10; i++ {
+			out, err := expr.Eval(input, nil)
+			if err != nil {
+				t.Fatalf("%s: Eval failed: %v", test.expr, err)
+			}
+			if !reflect.DeepEqual(out, test.want) {
+				t.Fatalf("%s: expected %v, got %v", test.expr, test.want, out)
+			}
+		}
+	}
+}
+
+func TestExpression_String(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil, WithInterpolation(map[string]string{"MIN": "10"}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	data := []struct {
+		Expr   string
+		String string
+	}{
+		{
+			Expr:   `Account.Order[0].Product[Price>${MIN}][0].SKU`,
+			String: `Account.Order[0].Product[Price > 10][0].SKU`,
+		},
+		{
+			Expr:   `$sum( Account.Order.Product.(Price*Quantity) )`,
+			String: `$sum(Account.Order.Product.(Price * Quantity))`,
+		},
+		{
+			Expr:   "'say \"hi\"' & `Product Name` & \"\\u0007\"",
+			String: "\"say \\\"hi\\\"\" & `Product Name` & \"\\u0007\"",
+		},
+	}
+
+	var input interface{}
+	if err := json.Unmarshal([]byte(`{"Account": {"Order": [{"Product": [{"Price": 5, "Quantity": 2, "SKU": "a"}, {"Price": 20, "Quantity": 1, "SKU": "b"}]}]}}`), &input); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	for _, test := range data {
+
+		e, err := comp.Compile(test.Expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.Expr, err)
+			continue
+		}
+
+		s := e.String()
+		if s != test.String {
+			t.Errorf("%s: expected %s, got %s", test.Expr, test.String, s)
+		}
+
+		again, err := comp.Compile(s)
+		if err != nil {
+			t.Errorf("%s: could not compile %s: %v", test.Expr, s, err)
+			continue
+		}
+		if again.String() != s {
+			t.Errorf("%s: expected %s to round trip, got %s", test.Expr, s, again.String())
+		}
+
+		want, wantErr := e.Eval(input, nil)
+		got, gotErr := again.Eval(input, nil)
+		if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(gotErr, wantErr) {
+			t.Errorf("%s: expected %v (error %v), got %v (error %v)", test.Expr, want, wantErr, got, gotErr)
+		}
+	}
+}
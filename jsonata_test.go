@@ -19,6 +19,7 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/iwongu/jsonata-go/jlib"
 	"github.com/iwongu/jsonata-go/jparse"
 	"github.com/iwongu/jsonata-go/jtypes"
 )
@@ -1427,6 +1428,22 @@ func TestArrayFlattening3(t *testing.T) {
 	})
 }
 
+func TestArrayFlattening4(t *testing.T) {
+
+	// Paths into nested empty arrays used to panic when an
+	// intermediate result was stored in an []interface{}.
+	runTestCases(t, []interface{}{[]interface{}{[]interface{}{}}}, []*testCase{
+		{
+			Expression: []string{
+				"a[0].a",
+				"a.a",
+				"$[0].a",
+			},
+			Error: ErrUndefined,
+		},
+	})
+}
+
 func TestOperatorPrecedence(t *testing.T) {
 
 	runTestCases(t, nil, []*testCase{
@@ -3715,6 +3732,42 @@ func TestFuncSort3(t *testing.T) {
 	})
 }
 
+func TestFuncDistinct(t *testing.T) {
+
+	runTestCases(t, nil, []*testCase{
+		{
+			Expression: `$distinct([1, 2, 3, 3, 4, 3, 5])`,
+			Output:     []interface{}{float64(1), float64(2), float64(3), float64(4), float64(5)},
+		},
+		{
+			Expression: `$distinct(["a", "b", "a", "B"])`,
+			Output:     []interface{}{"a", "b", "B"},
+		},
+		{
+			Expression: `$distinct([{"a": 1, "b": [1, 2]}, {"b": [1, 2], "a": 1}, {"a": 1}])`,
+			Output: []interface{}{
+				map[string]interface{}{"a": float64(1), "b": []interface{}{float64(1), float64(2)}},
+				map[string]interface{}{"a": float64(1)},
+			},
+		},
+		{
+			Expression: `$distinct([[1, 2], [1, 2], [2]])`,
+			Output: []interface{}{
+				[]interface{}{float64(1), float64(2)},
+				[]interface{}{float64(2)},
+			},
+		},
+		{
+			Expression: `$distinct("hello")`,
+			Output:     "hello",
+		},
+		{
+			Expression: `$distinct(nothing)`,
+			Error:      ErrUndefined,
+		},
+	})
+}
+
 func TestFuncShuffle(t *testing.T) {
 
 	runTestCases(t, nil, []*testCase{
@@ -4308,6 +4361,203 @@ func TestFuncAverage2(t *testing.T) {
 	})
 }
 
+func TestFuncWeightedAverage(t *testing.T) {
+
+	runTestCases(t, testdata.account, []*testCase{
+		{
+			Expression: []string{
+				"$weightedAverage([1, 2, 3], [1, 1, 1])",
+				"$weightedAverage([1, 3], [1, 1])",
+				"$weightedAverage([1, 3, 100], [1, 1, 0])",
+			},
+			Output: float64(2),
+		},
+		{
+			Expression: "$weightedAverage(4, 2)",
+			Output:     float64(4),
+		},
+		{
+			Expression: "$weightedAverage(Account.Order.Product.Price, Account.Order.Product.Quantity)",
+			Output:     (34.45*2 + 21.67*1 + 34.45*4 + 107.99*1) / 8,
+		},
+		{
+			Expression: "$weightedAverage([1, 2], [1])",
+			Error:      fmt.Errorf("cannot call weightedAverage with 2 values and 1 weights"),
+		},
+		{
+			Expression: "$weightedAverage([1, 2], [1, -1])",
+			Error:      fmt.Errorf("cannot call weightedAverage with weights that sum to zero"),
+		},
+		{
+			Expression: `$weightedAverage([1, "2"], [1, 1])`,
+			Error:      fmt.Errorf("cannot call weightedAverage on an array with non-number types"),
+		},
+		{
+			Expression: []string{
+				"$weightedAverage([], [])",
+				"$weightedAverage(nothing, [1])",
+				"$weightedAverage([1], nothing)",
+			},
+			Error: ErrUndefined,
+		},
+	})
+}
+
+func TestFuncCountIf(t *testing.T) {
+
+	runTestCases(t, testdata.account, []*testCase{
+		{
+			Expression: "$countIf([1..10], function($v) { $v % 2 = 0 })",
+			Output:     5,
+		},
+		{
+			Expression: "$countIf(Account.Order.Product, function($p) { $p.Price > 30 })",
+			Output:     3,
+		},
+		{
+			Expression: "$countIf([1, 2, 3], function($v, $i) { $i > 0 })",
+			Output:     2,
+		},
+		{
+			Expression: []string{
+				"$countIf([], function($v) { true })",
+				"$countIf(nothing, function($v) { true })",
+			},
+			Output: 0,
+		},
+	})
+}
+
+func TestFuncSumIf(t *testing.T) {
+
+	runTestCases(t, testdata.account, []*testCase{
+		{
+			Expression: "$sumIf([1..10], function($v) { $v % 2 = 0 })",
+			Output:     float64(30),
+		},
+		{
+			Expression: []string{
+				"$sumIf(Account.Order.Product, function($p) { $p.Price > 30 }, function($p) { $p.Price * $p.Quantity })",
+				"$sum(Account.Order.Product[Price > 30].(Price * Quantity))",
+			},
+			Output: 34.45*2 + 34.45*4 + 107.99*1,
+		},
+		{
+			// Undefined values are ignored.
+			Expression: "$sumIf(Account.Order.Product, function($p) { true }, function($p) { $p.Discount })",
+			Output:     float64(0),
+		},
+		{
+			Expression: "$sumIf([], function($v) { true })",
+			Output:     float64(0),
+		},
+		{
+			Expression: `$sumIf(["a"], function($v) { true })`,
+			Error:      fmt.Errorf("cannot call sumIf on non-number values"),
+		},
+		{
+			Expression: "$sumIf(nothing, function($v) { true })",
+			Error:      ErrUndefined,
+		},
+	})
+}
+
+func TestFuncParseCsv(t *testing.T) {
+
+	runTestCases(t, nil, []*testCase{
+		{
+			Expression: []string{
+				`$parseCsv("name,qty\nbolt,2\nnut,10\n")`,
+				`$parseCsv("name;qty\r\nbolt;2\r\nnut;10", {"delimiter": ";"})`,
+				`"name,qty\nbolt,2\nnut,10" ~> $parseCsv()`,
+			},
+			Output: []interface{}{
+				map[string]interface{}{"name": "bolt", "qty": "2"},
+				map[string]interface{}{"name": "nut", "qty": "10"},
+			},
+		},
+		{
+			Expression: `$parseCsv("a,\"b, \"\"c\"\"\"\n1,2", {"header": false})`,
+			Output: []interface{}{
+				[]interface{}{"a", `b, "c"`},
+				[]interface{}{"1", "2"},
+			},
+		},
+		{
+			Expression: []string{
+				`$parseCsv("")`,
+				`$parseCsv("name,qty")`,
+			},
+			Output: []interface{}{},
+		},
+		{
+			Expression: `$parseCsv("a,b\n1")`,
+			Error:      fmt.Errorf("cannot call parseCsv: record on line 2: wrong number of fields"),
+		},
+		{
+			Expression: `$parseCsv("a,a\n1,2")`,
+			Error:      fmt.Errorf("cannot call parseCsv: duplicate column \"a\""),
+		},
+		{
+			Expression: `$parseCsv("a", {"delimiter": "::"})`,
+			Error:      fmt.Errorf("cannot call parseCsv: delimiter must be a single character other than a quote or a line break"),
+		},
+		{
+			Expression: `$parseCsv("a", {"columns": ["a"]})`,
+			Error:      fmt.Errorf("cannot call parseCsv: unknown option \"columns\""),
+		},
+		{
+			Expression: `$parseCsv(nothing)`,
+			Error:      ErrUndefined,
+		},
+	})
+}
+
+func TestFuncToCsv(t *testing.T) {
+
+	runTestCases(t, testdata.account, []*testCase{
+		{
+			Expression: `$toCsv(Account.Order.Product.{"name": ` + "`Product Name`" + `, "price": Price})`,
+			Output:     "name,price\nBowler Hat,34.45\nTrilby hat,21.67\nBowler Hat,34.45\nCloak,107.99\n",
+		},
+		{
+			Expression: `$toCsv([{"b": 1, "a": "x, y"}, {"c": true, "a": null}])`,
+			Output:     "a,b,c\n\"x, y\",1,\n,,true\n",
+		},
+		{
+			Expression: `$toCsv([{"b": 1, "a": "x", "c": [1, 2]}], {"columns": ["c", "b"], "header": false, "delimiter": "\t"})`,
+			Output:     "[1,2]\t1\n",
+		},
+		{
+			Expression: []string{
+				`$toCsv([["a", "b"], [1, "say \"hi\""]])`,
+				`$parseCsv("a,b\n1,\"say \"\"hi\"\"\"", {"header": false}) ~> $toCsv()`,
+			},
+			Output: "a,b\n1,\"say \"\"hi\"\"\"\n",
+		},
+		{
+			Expression: `$toCsv({"a": 1})`,
+			Output:     "a\n1\n",
+		},
+		{
+			Expression: `$toCsv([1, 2])`,
+			Error:      fmt.Errorf("cannot call toCsv: records must be arrays or objects"),
+		},
+		{
+			Expression: `$toCsv([], {"columns": "a"})`,
+			Output:     "a\n",
+		},
+		{
+			Expression: `$toCsv([], {"columns": [1]})`,
+			Error:      fmt.Errorf("cannot call toCsv: columns must be an array of strings"),
+		},
+		{
+			Expression: `$toCsv(nothing)`,
+			Error:      ErrUndefined,
+		},
+	})
+}
+
 func TestFuncSpread(t *testing.T) {
 
 	runTestCases(t, nil, []*testCase{
@@ -4788,6 +5038,50 @@ func TestFuncFilter2(t *testing.T) {
 	})
 }
 
+func TestFuncSingle(t *testing.T) {
+
+	runTestCases(t, testdata.library, []*testCase{
+		{
+			Expression: `$single([1..10], function($v) {$v = 5})`,
+			Output:     float64(5),
+		},
+		{
+			Expression: `$single(library.books, λ($v, $i, $a) {$v.price = $max($a.price)}).isbn`,
+			Output:     "9780262510875",
+		},
+		{
+			Expression: []string{
+				`$single("hello")`,
+				`$single(["hello"])`,
+				`$single("hello", function($v) {true})`,
+			},
+			Output: "hello",
+		},
+		{
+			Expression: `$single([1..10], function($v) {$v % 2})`,
+			Error: &jlib.Error{
+				Func:  "single",
+				Type:  jlib.ErrSingleMultipleMatches,
+				Value: "2",
+			},
+		},
+		{
+			Expression: []string{
+				`$single([1..10], function($v) {$v > 10})`,
+				`$single([])`,
+			},
+			Error: &jlib.Error{
+				Func: "single",
+				Type: jlib.ErrSingleNoMatch,
+			},
+		},
+		{
+			Expression: `$single(nothing, function($v) {true})`,
+			Error:      ErrUndefined,
+		},
+	})
+}
+
 func TestFuncReduce(t *testing.T) {
 
 	runTestCases(t, nil, []*testCase{
@@ -5457,6 +5751,26 @@ func TestFuncPad(t *testing.T) {
 			Expression: `$pad("", 6, "超明體繁")`,
 			Output:     "超明體繁超明",
 		},
+		{
+			Expression: `$pad("超明體繁", -6, "-+")`,
+			Output:     "-+超明體繁",
+		},
+		{
+			Expression: `$pad("😂", -3, "😂é")`,
+			Output:     "😂é😂",
+		},
+		{
+			Expression: `$pad("foo", 5.9)`,
+			Output:     "foo  ",
+		},
+		{
+			Expression: `$pad("foo", 1e300)`,
+			Error: &jlib.Error{
+				Func:  "pad",
+				Type:  jlib.ErrInvalidPadWidth,
+				Value: "1e+300",
+			},
+		},
 		{
 			Expression: `$pad(nothing, -1)`,
 			Error:      ErrUndefined,
@@ -5933,22 +6247,27 @@ func TestFuncFormatBase(t *testing.T) {
 			Output:     "-1100100",
 		},
 		{
-			Expression: "$formatBase(100, 1)",
-			Error:      fmt.Errorf("the second argument to formatBase must be between 2 and 36"),
-			/*Error: &EvalError1{
-				Errno:    ErrInvalidBase,
-				Position: -3,
-				Value:    "1",
-			},*/
+			Expression: []string{
+				"$formatBase(100, 1)",
+				"$formatBase(100, 1.4)",
+			},
+			Error: &jlib.Error{
+				Type:  jlib.ErrInvalidRadix,
+				Func:  "formatBase",
+				Value: "1",
+			},
 		},
 		{
 			Expression: "$formatBase(100, 37)",
-			Error:      fmt.Errorf("the second argument to formatBase must be between 2 and 36"),
-			/*Error: &EvalError1{
-				Errno:    ErrInvalidBase,
-				Position: -3,
-				Value:    "37",
-			},*/
+			Error: &jlib.Error{
+				Type:  jlib.ErrInvalidRadix,
+				Func:  "formatBase",
+				Value: "37",
+			},
+		},
+		{
+			Expression: "$formatBase(255, 36.5)",
+			Output:     "73",
 		},
 	})
 }
@@ -5960,6 +6279,10 @@ func TestFuncBase64Encode(t *testing.T) {
 			Expression: `$base64encode("hello:world")`,
 			Output:     "aGVsbG86d29ybGQ=",
 		},
+		{
+			Expression: `$base64encode("Basic " & $base64encode("user:pass")) ~> $base64decode()`,
+			Output:     "Basic dXNlcjpwYXNz",
+		},
 		{
 			Expression: `$base64encode(nothing)`,
 			Error:      ErrUndefined,
@@ -5971,8 +6294,19 @@ func TestFuncBase64Decode(t *testing.T) {
 
 	runTestCases(t, nil, []*testCase{
 		{
-			Expression: `$base64decode("aGVsbG86d29ybGQ=")`,
-			Output:     "hello:world",
+			Expression: []string{
+				`$base64decode("aGVsbG86d29ybGQ=")`,
+				`$base64decode("aGVsbG86d29ybGQ")`,
+			},
+			Output: "hello:world",
+		},
+		{
+			Expression: `$base64decode("%%%")`,
+			Error: &jlib.Error{
+				Type:  jlib.ErrInvalidBase64,
+				Func:  "base64decode",
+				Value: "%%%",
+			},
 		},
 		{
 			Expression: `$base64decode(nothing)`,
@@ -5981,6 +6315,76 @@ func TestFuncBase64Decode(t *testing.T) {
 	})
 }
 
+func TestFuncEncodeUrl(t *testing.T) {
+
+	runTestCases(t, nil, []*testCase{
+		{
+			Expression: `$encodeUrl("https://mozilla.org/?x=шеллы")`,
+			Output:     "https://mozilla.org/?x=%D1%88%D0%B5%D0%BB%D0%BB%D1%8B",
+		},
+		{
+			Expression: `$encodeUrlComponent("?x=test")`,
+			Output:     "%3Fx%3Dtest",
+		},
+		{
+			Expression: `$encodeUrlComponent("hello world")`,
+			Output:     "hello%20world",
+		},
+		{
+			Expression: `$encodeUrlComponent("\ufffd")`,
+			Error: &jlib.Error{
+				Type:  jlib.ErrMalformedURL,
+				Func:  "encodeUrlComponent",
+				Value: "\ufffd",
+			},
+		},
+		{
+			Expression: []string{
+				`$encodeUrl(nothing)`,
+				`$encodeUrlComponent(nothing)`,
+			},
+			Error: ErrUndefined,
+		},
+	})
+}
+
+func TestFuncDecodeUrl(t *testing.T) {
+
+	runTestCases(t, nil, []*testCase{
+		{
+			Expression: `$decodeUrl("https://mozilla.org/?x=%D1%88%D0%B5%D0%BB%D0%BB%D1%8B")`,
+			Output:     "https://mozilla.org/?x=шеллы",
+		},
+		{
+			Expression: `$decodeUrl("%3Fx%3Dtest")`,
+			Output:     "%3Fx%3Dtest",
+		},
+		{
+			Expression: `$decodeUrlComponent("%3Fx%3Dtest")`,
+			Output:     "?x=test",
+		},
+		{
+			Expression: `$decodeUrlComponent("a+b")`,
+			Output:     "a+b",
+		},
+		{
+			Expression: `$decodeUrlComponent("%E0%A4%A")`,
+			Error: &jlib.Error{
+				Type:  jlib.ErrMalformedURL,
+				Func:  "decodeUrlComponent",
+				Value: "%E0%A4%A",
+			},
+		},
+		{
+			Expression: []string{
+				`$decodeUrl(nothing)`,
+				`$decodeUrlComponent(nothing)`,
+			},
+			Error: ErrUndefined,
+		},
+	})
+}
+
 func TestFuncNumber(t *testing.T) {
 
 	runTestCases(t, nil, []*testCase{
@@ -7949,6 +8353,269 @@ func TestTransform(t *testing.T) {
 
 type compareFunc func(interface{}, interface{}) bool
 
+type testAudit struct {
+	CreatedBy string `json:"created_by"`
+	Note      string `json:"id"` // hidden by testOrder.ID
+	Internal  string `json:"-"`
+}
+
+type testRegion struct {
+	Region string `json:"region"`
+}
+
+type testPrice struct {
+	Amount   float64 `json:"amount"`
+	Currency string
+}
+
+type testLine struct {
+	SKU   string     `json:"sku"`
+	Qty   int        `json:"qty,omitempty"`
+	Price *testPrice `json:"price"`
+}
+
+type testCustomer struct {
+	Name string `json:"name"`
+}
+
+type testOrder struct {
+	testAudit
+	*testRegion
+	ID       string        `json:"id"`
+	Lines    []testLine    `json:"lines"`
+	Customer *testCustomer `json:"customer"`
+	secret   string
+}
+
+func TestStructInput(t *testing.T) {
+
+	order := &testOrder{
+		testAudit: testAudit{
+			CreatedBy: "ada",
+			Note:      "note",
+			Internal:  "internal",
+		},
+		ID: "o1",
+		Lines: []testLine{
+			{SKU: "a", Qty: 2, Price: &testPrice{Amount: 1.5, Currency: "USD"}},
+			{SKU: "b", Qty: 3, Price: &testPrice{Amount: 2, Currency: "EUR"}},
+		},
+		Customer: &testCustomer{Name: "Bob"},
+		secret:   "secret",
+	}
+
+	runTestCases(t, order, []*testCase{
+		{
+			Expression: `id`,
+			Output:     "o1",
+		},
+		{
+			// Fields of embedded structs are promoted.
+			Expression: `created_by`,
+			Output:     "ada",
+		},
+		{
+			// Fields are named by their json tags, if any.
+			Expression: []string{
+				`ID`,
+				`CreatedBy`,
+				`Note`,
+				`Internal`,
+				`secret`,
+			},
+			Error: ErrUndefined,
+		},
+		{
+			// Fields in nil embedded pointers are undefined.
+			Expression: `region`,
+			Error:      ErrUndefined,
+		},
+		{
+			Expression: `customer.name`,
+			Output:     "Bob",
+		},
+		{
+			Expression: `lines.sku`,
+			Output:     []interface{}{"a", "b"},
+		},
+		{
+			Expression: `lines[qty > 2].sku`,
+			Output:     "b",
+		},
+		{
+			Expression: `$sum(lines.(qty * price.amount))`,
+			Output:     float64(9),
+		},
+		{
+			// Fields without json tags use the field name.
+			Expression: `lines.price.Currency`,
+			Output:     []interface{}{"USD", "EUR"},
+		},
+		{
+			Expression: `$keys($)`,
+			Output:     []string{"created_by", "id", "lines", "customer"},
+		},
+		{
+			Expression: `$keys(lines[0])`,
+			Output:     []string{"sku", "qty", "price"},
+		},
+		{
+			Expression: `$spread(lines[0].price)`,
+			Output: []interface{}{
+				map[string]interface{}{"amount": 1.5},
+				map[string]interface{}{"Currency": "USD"},
+			},
+		},
+		{
+			Expression: `$merge([customer, {"id": 2}])`,
+			Output:     map[string]interface{}{"name": "Bob", "id": float64(2)},
+		},
+		{
+			Expression: `$sift(lines[1], function($v, $k) { $k = "sku" })`,
+			Output:     map[string]interface{}{"sku": "b"},
+		},
+		{
+			Expression: `$each(customer, function($v, $k) { $k & "=" & $v })`,
+			Output:     "name=Bob",
+		},
+	})
+}
+
+type testEvent struct {
+	Name      string      `json:"name"`
+	Created   time.Time   `json:"created"`
+	Updated   *time.Time  `json:"updated"`
+	Deleted   *time.Time  `json:"deleted"`
+	Reminders []time.Time `json:"reminders"`
+	Attrs     interface{} `json:"attrs"`
+}
+
+func TestTimeInput(t *testing.T) {
+
+	created := time.Date(2020, time.March, 4, 5, 6, 7, 8e6, time.UTC)
+	updated := time.Date(2021, time.June, 1, 12, 0, 0, 0, time.FixedZone("", 2*60*60))
+
+	event := testEvent{
+		Name:    "launch",
+		Created: created,
+		Updated: &updated,
+		Reminders: []time.Time{
+			created.Add(time.Hour),
+			created.Add(2 * time.Hour),
+		},
+		Attrs: map[string]interface{}{
+			"due": created.AddDate(0, 1, 0),
+		},
+	}
+
+	runTestCases(t, event, []*testCase{
+		{
+			Expression: `created`,
+			Output:     "2020-03-04T05:06:07.008Z",
+		},
+		{
+			Expression: `updated`,
+			Output:     "2021-06-01T12:00:00.000+02:00",
+		},
+		{
+			// Nil pointers are null.
+			Expression: `deleted`,
+			Output:     nil,
+		},
+		{
+			Expression: `reminders`,
+			Output: []interface{}{
+				"2020-03-04T06:06:07.008Z",
+				"2020-03-04T07:06:07.008Z",
+			},
+		},
+		{
+			Expression: `reminders[1]`,
+			Output:     "2020-03-04T07:06:07.008Z",
+		},
+		{
+			Expression: `attrs.due`,
+			Output:     "2020-04-04T05:06:07.008Z",
+		},
+		{
+			Expression: `$toMillis(created)`,
+			Output:     created.UnixNano() / int64(time.Millisecond),
+		},
+		{
+			Expression: `$toMillis(reminders[0]) - $toMillis(created)`,
+			Output:     float64(time.Hour / time.Millisecond),
+		},
+		{
+			Expression: []string{
+				`created < "2020-03-05"`,
+				`created = "2020-03-04T05:06:07.008Z"`,
+				`"2020-03-04T06:06:07.008Z" in reminders`,
+			},
+			Output: true,
+		},
+		{
+			Expression: `$substring(created, 0, 10)`,
+			Output:     "2020-03-04",
+		},
+		{
+			Expression: `$each($, function($v, $k) { $k = "created" ? $v })`,
+			Output:     "2020-03-04T05:06:07.008Z",
+		},
+		{
+			// Times are formatted the same way by $string
+			// as when they are read by path.
+			Expression: []string{
+				`$contains($string($), '"created":"' & created & '"')`,
+				`$contains($string($), '"updated":"' & updated & '"')`,
+				`$string(attrs) = '{"due":"' & attrs.due & '"}'`,
+				`$string(reminders) = '["' & reminders[0] & '","' & reminders[1] & '"]'`,
+			},
+			Output: true,
+		},
+	})
+
+	runTestCases(t, created, []*testCase{
+		{
+			Expression: `$`,
+			Output:     "2020-03-04T05:06:07.008Z",
+		},
+		{
+			Expression: `$t & " " & $`,
+			Vars: map[string]interface{}{
+				"t": updated,
+			},
+			Output: "2021-06-01T12:00:00.000+02:00 2020-03-04T05:06:07.008Z",
+		},
+	})
+}
+
+func TestEval(t *testing.T) {
+
+	data := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"price": 10, "quantity": 3},
+			map[string]interface{}{"price": 0.5, "quantity": 10},
+		},
+	}
+
+	got, err := Eval("$sum(orders.(price*quantity))", data)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if got != float64(35) {
+		t.Errorf("expected 35, got %v", got)
+	}
+
+	if _, err := Eval("orders.missing", data); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+
+	var perr *jparse.Error
+	if _, err := Eval("orders[", data); !errors.As(err, &perr) {
+		t.Errorf("expected a jparse.Error, got %v", err)
+	}
+}
+
 func runTestCases(t *testing.T, input interface{}, tests []*testCase) {
 	runTestCasesFunc(t, reflect.DeepEqual, input, tests)
 }
@@ -0,0 +1,296 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jtypes
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A structField is a struct field that is visible to JSONata
+// expressions.
+type structField struct {
+	name   string
+	index  []int
+	tagged bool
+}
+
+type structInfo struct {
+	fields []structField
+	byName map[string]int
+}
+
+var structCache sync.Map // map[reflect.Type]*structInfo
+
+// StructFieldNames returns the names of the fields in a struct
+// type that are visible to JSONata expressions. Fields are named
+// and promoted in the same way as in encoding/json:
+//
+//   - Only exported fields are visible.
+//   - A field's name is taken from its json tag or, if there is
+//     no tag, from the field name. Fields tagged "-" are hidden.
+//   - The fields of embedded structs, and pointers to structs,
+//     are promoted to the outer struct unless the embedded field
+//     has a json tag.
+//   - If more than one field has the same name, the shallowest
+//     one wins. Of the fields at the same depth, a tagged field
+//     beats an untagged one. Any remaining conflicts hide all of
+//     the conflicting fields.
+//
+// Names are returned in field order.
+func StructFieldNames(t reflect.Type) []string {
+
+	info := cachedStructInfo(t)
+	if len(info.fields) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(info.fields))
+	for i, f := range info.fields {
+		names[i] = f.name
+	}
+
+	return names
+}
+
+// StructField returns the value of the named field in a struct.
+// See StructFieldNames for how fields are named. Times are
+// converted to strings (see ConvertTime). StructField returns an
+// invalid Value if there is no such field, or if the field is
+// promoted from an embedded pointer that is nil.
+func StructField(v reflect.Value, name string) reflect.Value {
+
+	info := cachedStructInfo(v.Type())
+
+	i, ok := info.byName[name]
+	if !ok {
+		return reflect.Value{}
+	}
+
+	return ConvertTime(fieldByIndex(v, info.fields[i].index))
+}
+
+// RawStructField is like StructField except that it doesn't
+// convert times, so the field can be set if v is addressable.
+func RawStructField(v reflect.Value, name string) reflect.Value {
+
+	info := cachedStructInfo(v.Type())
+
+	i, ok := info.byName[name]
+	if !ok {
+		return reflect.Value{}
+	}
+
+	return fieldByIndex(v, info.fields[i].index)
+}
+
+// EachStructField calls fn with the name and value of each field
+// in a struct that is visible to JSONata expressions (see
+// StructFieldNames). Like StructField, it converts times to
+// strings. Fields promoted from nil embedded pointers are
+// skipped.
+func EachStructField(v reflect.Value, fn func(name string, v reflect.Value)) {
+
+	info := cachedStructInfo(v.Type())
+
+	for _, f := range info.fields {
+		if fv := fieldByIndex(v, f.index); fv.IsValid() {
+			fn(f.name, ConvertTime(fv))
+		}
+	}
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+func cachedStructInfo(t reflect.Type) *structInfo {
+
+	if info, ok := structCache.Load(t); ok {
+		return info.(*structInfo)
+	}
+
+	fields := typeFields(t)
+	info := &structInfo{
+		fields: fields,
+		byName: make(map[string]int, len(fields)),
+	}
+
+	for i, f := range fields {
+		info.byName[f.name] = i
+	}
+
+	actual, _ := structCache.LoadOrStore(t, info)
+	return actual.(*structInfo)
+}
+
+// typeFields returns the visible fields of a struct type. It's
+// a simplified version of the function of the same name in
+// encoding/json.
+func typeFields(t reflect.Type) []structField {
+
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var fields []structField
+
+	// Names that are taken by a field at a shallower depth,
+	// including names that were hidden by conflicts.
+	taken := map[string]bool{}
+	visited := map[reflect.Type]bool{}
+
+	next := []embedded{{typ: t}}
+
+	for len(next) > 0 {
+
+		current := next
+		next = nil
+
+		var level []structField
+
+		for _, e := range current {
+
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+
+				sf := e.typ.Field(i)
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+
+				if sf.Anonymous {
+					// Embedded fields of unexported struct
+					// types can still have exported fields.
+					if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if sf.PkgPath != "" {
+					continue
+				}
+
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+
+				name := tag
+				if i := strings.IndexByte(tag, ','); i >= 0 {
+					name = tag[:i]
+				}
+
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{ft, index})
+					continue
+				}
+
+				if sf.PkgPath != "" {
+					// An unexported embedded struct with a
+					// tag isn't visible.
+					continue
+				}
+
+				level = append(level, structField{
+					name:   nameOrDefault(name, sf.Name),
+					index:  index,
+					tagged: name != "",
+				})
+			}
+		}
+
+		fields = append(fields, dominantFields(level, taken)...)
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		return indexLess(fields[i].index, fields[j].index)
+	})
+
+	return fields
+}
+
+// dominantFields resolves name conflicts between the fields at a
+// single depth and returns the fields that remain visible. Names
+// of all of the fields at this depth are added to taken.
+func dominantFields(level []structField, taken map[string]bool) []structField {
+
+	byName := map[string][]structField{}
+	var names []string
+
+	for _, f := range level {
+		if taken[f.name] {
+			continue
+		}
+		if _, ok := byName[f.name]; !ok {
+			names = append(names, f.name)
+		}
+		byName[f.name] = append(byName[f.name], f)
+	}
+
+	var results []structField
+
+	for _, name := range names {
+
+		taken[name] = true
+
+		candidates := byName[name]
+		if len(candidates) == 1 {
+			results = append(results, candidates[0])
+			continue
+		}
+
+		var tagged []structField
+		for _, f := range candidates {
+			if f.tagged {
+				tagged = append(tagged, f)
+			}
+		}
+
+		if len(tagged) == 1 {
+			results = append(results, tagged[0])
+		}
+	}
+
+	return results
+}
+
+func nameOrDefault(name, def string) string {
+	if name != "" {
+		return name
+	}
+	return def
+}
+
+func indexLess(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jtypes
+
+import (
+	"reflect"
+	"time"
+)
+
+// TimeLayout is the layout used to convert time.Time values to
+// strings. It's the ISO 8601 format used by the JSONata date and
+// time functions, e.g. 2017-05-15T15:12:59.152Z.
+const TimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+var typeTime = reflect.TypeOf(time.Time{})
+
+// ConvertTime converts time.Time values to strings. A time.Time,
+// or a non-nil pointer to one, is formatted using TimeLayout. A
+// slice or array of times is converted to an []interface{} of
+// strings. Other values are returned unchanged.
+//
+// Without this conversion, the evaluator would treat a time.Time
+// as a struct with no visible fields.
+func ConvertTime(v reflect.Value) reflect.Value {
+
+	if !v.IsValid() {
+		return v
+	}
+
+	r := Resolve(v)
+
+	switch r.Kind() {
+	case reflect.Struct:
+		if r.Type() == typeTime {
+			return reflect.ValueOf(formatTime(r))
+		}
+	case reflect.Slice, reflect.Array:
+		if isTimeType(r.Type().Elem()) {
+			return convertTimes(r)
+		}
+	}
+
+	return v
+}
+
+func isTimeType(t reflect.Type) bool {
+	return t == typeTime || t.Kind() == reflect.Ptr && t.Elem() == typeTime
+}
+
+func formatTime(v reflect.Value) string {
+	return v.Interface().(time.Time).Format(TimeLayout)
+}
+
+func convertTimes(v reflect.Value) reflect.Value {
+
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		return v
+	}
+
+	results := make([]interface{}, v.Len())
+
+	for i := range results {
+		item := Resolve(v.Index(i))
+		if item.Kind() == reflect.Struct {
+			results[i] = formatTime(item)
+		}
+	}
+
+	return reflect.ValueOf(results)
+}
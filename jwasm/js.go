@@ -0,0 +1,158 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+//go:build js && wasm
+// +build js,wasm
+
+package jwasm
+
+import (
+	"context"
+	"encoding/json"
+	"syscall/js"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+// Register sets the global JavaScript variable name to an
+// object with these functions, using comp to compile
+// expressions, or a Compiler with only the built-in functions
+// if comp is nil:
+//
+//	compile(src)
+//	    Returns {expression, errors}. expression is null if
+//	    src doesn't compile, and errors is an array of Error
+//	    objects, one for each syntax error.
+//
+//	evaluate(src, input, vars)
+//	    Compiles src and evaluates it once. It returns the
+//	    same object as expression.evaluate, with the compile
+//	    errors, if any, in errors.
+//
+// An expression has these functions:
+//
+//	evaluate(input, vars)
+//	    Returns {value, undefined, error}. value is the
+//	    result, undefined is true if the result is undefined,
+//	    and error is an Error object or null. input and vars
+//	    can be left out.
+//
+//	release()
+//	    Frees the Go functions behind the expression, which
+//	    can't be used afterwards.
+//
+// input, vars and value are JSON values, converted with
+// JSON.stringify and JSON.parse.
+func Register(name string, comp *jsonata.Compiler) error {
+
+	if comp == nil {
+		var err error
+		if comp, err = jsonata.NewCompiler(nil, nil); err != nil {
+			return err
+		}
+	}
+
+	compile := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return compileJS(comp, argString(args, 0))
+	})
+
+	evaluate := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		e, errs := Compile(comp, argString(args, 0))
+		if errs != nil {
+			return map[string]interface{}{
+				"value":     js.Undefined(),
+				"undefined": false,
+				"error":     toJS(errs[0]),
+				"errors":    toJS(errs),
+			}
+		}
+		if len(args) > 0 {
+			args = args[1:]
+		}
+		return evaluateJS(e, args)
+	})
+
+	js.Global().Set(name, map[string]interface{}{
+		"compile":  compile,
+		"evaluate": evaluate,
+	})
+
+	return nil
+}
+
+func compileJS(comp *jsonata.Compiler, src string) interface{} {
+
+	e, errs := Compile(comp, src)
+	if errs != nil {
+		return map[string]interface{}{
+			"expression": js.Null(),
+			"errors":     toJS(errs),
+		}
+	}
+
+	var evaluate, release js.Func
+
+	evaluate = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return evaluateJS(e, args)
+	})
+
+	release = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		evaluate.Release()
+		release.Release()
+		return nil
+	})
+
+	return map[string]interface{}{
+		"expression": map[string]interface{}{
+			"source":   src,
+			"evaluate": evaluate,
+			"release":  release,
+		},
+		"errors": js.Global().Get("Array").New(),
+	}
+}
+
+// evaluateJS evaluates e with the arguments input and vars.
+func evaluateJS(e *jsonata.Expression, args []js.Value) interface{} {
+
+	res := map[string]interface{}{
+		"value":     js.Undefined(),
+		"undefined": false,
+		"error":     js.Null(),
+	}
+
+	out, err := Evaluate(context.Background(), e, stringify(args, 0), stringify(args, 1))
+	switch {
+	case err == jsonata.ErrUndefined:
+		res["undefined"] = true
+	case err != nil:
+		res["error"] = toJS(NewError(err))
+	default:
+		res["value"] = js.Global().Get("JSON").Call("parse", out)
+	}
+
+	return res
+}
+
+func argString(args []js.Value, i int) string {
+	if i >= len(args) || args[i].Type() != js.TypeString {
+		return ""
+	}
+	return args[i].String()
+}
+
+// stringify returns the JSON text of an argument, or "" if it's
+// missing or undefined.
+func stringify(args []js.Value, i int) string {
+	if i >= len(args) || args[i].IsUndefined() {
+		return ""
+	}
+	return js.Global().Get("JSON").Call("stringify", args[i]).String()
+}
+
+// toJS converts a Go value to a JavaScript value via JSON.
+func toJS(v interface{}) js.Value {
+	b, _ := json.Marshal(v)
+	return js.Global().Get("JSON").Call("parse", string(b))
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jwasm exposes jsonata-go to JavaScript when it's built
+// for WebAssembly (GOOS=js GOARCH=wasm), e.g. to preview
+// expressions in a browser-based editor. Register, which is only
+// available in that build, adds a global object with compile and
+// evaluate functions; the command jsonata-wasm is a ready-made
+// module that calls it:
+//
+//	const c = jsonata.compile("$sum(orders.price)");
+//	if (c.errors.length) { showErrors(c.errors); }
+//	const r = c.expression.evaluate(input);
+//	if (r.error) { showError(r.error); } else { preview(r.value); }
+//
+// Values cross between JavaScript and Go as JSON, and errors are
+// plain objects (see Error), so nothing is thrown.
+package jwasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+// An Error describes a compile or evaluation error to
+// JavaScript. It's the JSON form of the error's details (see
+// jsonata.CompileError and jsonata.EvalError).
+type Error struct {
+	Message string `json:"message"`
+
+	// Code is the JSONata error code, e.g. "S0202", if there
+	// is one.
+	Code string `json:"code,omitempty"`
+
+	// Position is the byte offset of the error in the
+	// expression, or -1 if it isn't known. Line and Column are
+	// the 1-based line and column of the same location, with
+	// the column counted in characters, or 0 if it isn't
+	// known.
+	Position int `json:"position"`
+	Line     int `json:"line"`
+	Column   int `json:"column"`
+
+	// Token is the text at the location of the error.
+	Token string `json:"token,omitempty"`
+}
+
+// NewError returns the Error for err. Messages of compile
+// errors leave out the source line that the error is in, since
+// an editor shows the error in place.
+func NewError(err error) Error {
+
+	var compileErr *jsonata.CompileError
+	var evalErr *jsonata.EvalError
+
+	switch {
+	case errors.As(err, &compileErr):
+		return Error{
+			Message:  compileErr.Err.Error(),
+			Code:     compileErr.Code,
+			Position: compileErr.Position,
+			Line:     compileErr.Line,
+			Column:   compileErr.Column,
+			Token:    compileErr.Token,
+		}
+	case errors.As(err, &evalErr):
+		return Error{
+			Message:  evalErr.Error(),
+			Code:     evalErr.Code,
+			Position: evalErr.Position,
+			Line:     evalErr.Line,
+			Column:   evalErr.Column,
+			Token:    evalErr.Token,
+		}
+	default:
+		return Error{
+			Message:  err.Error(),
+			Position: -1,
+		}
+	}
+}
+
+// NewErrors returns the Errors for err, one for each error in a
+// jsonata.CompileErrors and otherwise just one.
+func NewErrors(err error) []Error {
+
+	var errs jsonata.CompileErrors
+	if !errors.As(err, &errs) {
+		return []Error{NewError(err)}
+	}
+
+	results := make([]Error, len(errs))
+	for i, e := range errs {
+		results[i] = NewError(e)
+	}
+
+	return results
+}
+
+// Compile compiles src with comp, reporting all of its syntax
+// errors rather than just the first one (see
+// jsonata.Compiler.CompileAll).
+func Compile(comp *jsonata.Compiler, src string) (*jsonata.Expression, []Error) {
+
+	e, err := comp.CompileAll(src)
+	if err != nil {
+		return nil, NewErrors(err)
+	}
+
+	return e, nil
+}
+
+// Evaluate evaluates e against input with the variables vars,
+// both of which are JSON text, and returns the result as JSON
+// text. An empty input means that there's no input, and empty
+// vars means that there are no variables. Like EvalContext, it
+// returns jsonata.ErrUndefined if the expression evaluates to
+// undefined.
+func Evaluate(ctx context.Context, e *jsonata.Expression, input, vars string) (string, error) {
+
+	var data interface{}
+	if input != "" {
+		if err := json.Unmarshal([]byte(input), &data); err != nil {
+			return "", err
+		}
+	}
+
+	var m map[string]interface{}
+	if vars != "" {
+		if err := json.Unmarshal([]byte(vars), &m); err != nil {
+			return "", err
+		}
+	}
+
+	res, err := e.EvalContext(ctx, data, m)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jwasm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+func TestCompile(t *testing.T) {
+
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	if _, errs := Compile(comp, "orders.price"); errs != nil {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+
+	_, errs := Compile(comp, "[a b, c +]")
+
+	want := []Error{
+		{Message: "syntax error: 'b'", Code: "S0201", Position: 3, Line: 1, Column: 4, Token: "b"},
+		{Message: "the symbol ']' cannot be used as a prefix operator", Code: "S0211", Position: 9, Line: 1, Column: 10, Token: "]"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("expected %+v, got %+v", want, errs)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		Expr   string
+		Input  string
+		Vars   string
+		Output string
+		Err    error
+	}{
+		{
+			Expr:   `$sum(orders.price) * $rate`,
+			Input:  `{"orders": [{"price": 1}, {"price": 2.5}]}`,
+			Vars:   `{"rate": 2}`,
+			Output: `7`,
+		},
+		{
+			Expr:   `{"n": $count([1, 2])}`,
+			Output: `{"n":2}`,
+		},
+		{
+			Expr:  `missing`,
+			Input: `{}`,
+			Err:   jsonata.ErrUndefined,
+		},
+	} {
+		out, err := Evaluate(ctx, comp.MustCompile(test.Expr), test.Input, test.Vars)
+		if err != test.Err {
+			t.Errorf("%s: expected error %v, got %v", test.Expr, test.Err, err)
+		}
+		if out != test.Output {
+			t.Errorf("%s: expected %s, got %s", test.Expr, test.Output, out)
+		}
+	}
+
+	if _, err := Evaluate(ctx, comp.MustCompile(`a`), `{`, ""); err == nil {
+		t.Errorf("expected an error for invalid input")
+	}
+
+	_, err = Evaluate(ctx, comp.MustCompile(`1 + "a"`), "", "")
+
+	got := NewError(err)
+	want := Error{
+		Message:  `right side of the "+" operator must evaluate to a number`,
+		Code:     "T2002",
+		Position: 0,
+		Line:     1,
+		Column:   1,
+		Token:    `"a"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestNewError(t *testing.T) {
+
+	got := NewError(errors.New("boom"))
+	want := Error{Message: "boom", Position: -1}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
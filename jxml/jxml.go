@@ -0,0 +1,186 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jxml evaluates JSONata expressions over XML documents,
+// which makes it possible to replace XSLT transforms of legacy
+// payloads with JSONata:
+//
+//	doc, err := os.ReadFile("order.xml")
+//	res, err := jxml.Eval(ctx, expr, doc, nil)
+//
+// Decode maps a document to JSONata values in the style of the
+// x2j convention (see Decode), so that an expression such as
+// order.items.item[`@sku` = "A1"].qty reads naturally. jxml has
+// no dependencies outside the standard library.
+package jxml
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+// ErrInvalidDocument is wrapped by the errors for XML documents
+// that can't be converted to JSONata values.
+var ErrInvalidDocument = errors.New("invalid document")
+
+const (
+	// AttrPrefix is prepended to attribute names to make the
+	// keys of attributes.
+	AttrPrefix = "@"
+
+	// TextKey is the key of the text of an element that also
+	// has attributes or child elements.
+	TextKey = "#text"
+)
+
+// maxDepth is the maximum nesting of elements in the documents
+// that Decode accepts.
+const maxDepth = 10000
+
+// Decode converts an XML document to JSONata values. The result
+// is an object with a single key, the name of the root element.
+//
+// An element with neither attributes nor child elements becomes
+// its text, which is "" for an empty element. Other elements
+// become objects, with a key for each attribute (its name with
+// AttrPrefix in front), a key for each child element name and,
+// if the element has any text, TextKey. Repeated child elements
+// become an array, in document order. Text that's only
+// whitespace is ignored. All values are strings, since XML has
+// no types, so numbers need $number to compare numerically.
+//
+// Namespace prefixes and declarations are dropped, so elements
+// and attributes are named by their local names. Comments,
+// processing instructions and directives are ignored.
+func Decode(data []byte) (interface{}, error) {
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root interface{}
+	var name string
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if root != nil {
+				return nil, fmt.Errorf("xml: %w: more than one root element", ErrInvalidDocument)
+			}
+			v, err := element(d, tok, 0)
+			if err != nil {
+				return nil, err
+			}
+			root, name = v, tok.Name.Local
+		case xml.CharData:
+			if !isSpace(tok) {
+				return nil, fmt.Errorf("xml: %w: text outside the root element", ErrInvalidDocument)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("xml: %w: no root element", ErrInvalidDocument)
+	}
+
+	return map[string]interface{}{
+		name: root,
+	}, nil
+}
+
+// Eval decodes an XML document, evaluates e against it and
+// returns the result. Like EvalContext, it returns
+// jsonata.ErrUndefined if the expression evaluates to undefined.
+func Eval(ctx context.Context, e *jsonata.Expression, doc []byte, vars map[string]interface{}) (interface{}, error) {
+
+	data, err := Decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.EvalContext(ctx, data, vars)
+}
+
+// element converts the element that starts with start, reading
+// up to and including its end tag.
+func element(d *xml.Decoder, start xml.StartElement, depth int) (interface{}, error) {
+
+	if depth > maxDepth {
+		return nil, fmt.Errorf("xml: %w: document is nested too deeply", ErrInvalidDocument)
+	}
+
+	obj := map[string]interface{}{}
+
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		obj[AttrPrefix+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			v, err := element(d, tok, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			add(obj, tok.Name.Local, v)
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			s := text.String()
+			if isSpace([]byte(s)) {
+				s = ""
+			}
+			if len(obj) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				obj[TextKey] = s
+			}
+			return obj, nil
+		}
+	}
+}
+
+// add adds the child element v to obj, making an array if obj
+// already has a child with the same name. Converted elements are
+// never arrays themselves, so an existing array can only be
+// a list of earlier children.
+func add(obj map[string]interface{}, name string, v interface{}) {
+
+	switch prev := obj[name].(type) {
+	case nil:
+		obj[name] = v
+	case []interface{}:
+		obj[name] = append(prev, v)
+	default:
+		obj[name] = []interface{}{prev, v}
+	}
+}
+
+func isSpace(b []byte) bool {
+	return len(bytes.TrimSpace(b)) == 0
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jxml
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+func TestDecode(t *testing.T) {
+
+	for _, test := range []struct {
+		XML   string
+		Value interface{}
+	}{
+		{
+			`<a>hello</a>`,
+			map[string]interface{}{"a": "hello"},
+		},
+		{
+			`<?xml version="1.0"?><!-- comment --><a/>`,
+			map[string]interface{}{"a": ""},
+		},
+		{
+			`<a id="1">x &amp; y</a>`,
+			map[string]interface{}{"a": map[string]interface{}{"@id": "1", "#text": "x & y"}},
+		},
+		{
+			`<a><![CDATA[<b>]]></a>`,
+			map[string]interface{}{"a": "<b>"},
+		},
+		{
+			`<list>
+				<item>1</item>
+				<item>2</item>
+				<other/>
+				<item>3</item>
+			</list>`,
+			map[string]interface{}{"list": map[string]interface{}{
+				"item":  []interface{}{"1", "2", "3"},
+				"other": "",
+			}},
+		},
+		{
+			`<p>Hello <b>there</b>!</p>`,
+			map[string]interface{}{"p": map[string]interface{}{"b": "there", "#text": "Hello !"}},
+		},
+		{
+			`<s:env xmlns:s="urn:s" xmlns="urn:d" s:v="2"><s:body><x/></s:body></s:env>`,
+			map[string]interface{}{"env": map[string]interface{}{
+				"@v":   "2",
+				"body": map[string]interface{}{"x": ""},
+			}},
+		},
+	} {
+		got, err := Decode([]byte(test.XML))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.XML, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.Value) {
+			t.Errorf("%s: expected %#v, got %#v", test.XML, test.Value, got)
+		}
+	}
+
+	for _, doc := range []string{
+		``,
+		`<!-- comment -->`,
+		`<a/><b/>`,
+		`<a/>text`,
+	} {
+		if _, err := Decode([]byte(doc)); !errors.Is(err, ErrInvalidDocument) {
+			t.Errorf("%q: expected ErrInvalidDocument, got %v", doc, err)
+		}
+	}
+
+	for _, doc := range []string{`<a>`, `<a></b>`} {
+		if _, err := Decode([]byte(doc)); err == nil {
+			t.Errorf("%q: expected a syntax error", doc)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	doc := []byte(`
+		<order id="17">
+			<item sku="A1"><qty>2</qty><price>5</price></item>
+			<item sku="B2"><qty>1</qty><price>7.5</price></item>
+		</order>`)
+
+	e := comp.MustCompile(`{
+		"id": $number(order.` + "`@id`" + `),
+		"skus": order.item.` + "`@sku`" + `,
+		"total": $sum(order.item.($number(qty) * $number(price)))
+	}`)
+
+	got, err := Eval(context.Background(), e, doc, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"id":    17.0,
+		"skus":  []interface{}{"A1", "B2"},
+		"total": 17.5,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, err := Eval(context.Background(), comp.MustCompile(`nothing`), doc, nil); err != jsonata.ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
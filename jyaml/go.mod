@@ -0,0 +1,10 @@
+module github.com/iwongu/jsonata-go/jyaml
+
+go 1.22
+
+require (
+	github.com/iwongu/jsonata-go v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+replace github.com/iwongu/jsonata-go => ../
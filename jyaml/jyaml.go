@@ -0,0 +1,264 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package jyaml evaluates JSONata expressions over YAML
+// documents. Decode converts a document to the values that
+// JSONata works with, and Encode writes a result back out as
+// YAML:
+//
+//	doc, err := os.ReadFile("deploy.yaml")
+//	out, err := jyaml.Eval(ctx, expr, doc, nil)
+//
+// YAML mappings become objects, sequences become arrays, and
+// numbers become float64s, as they would be for the same
+// document in JSON. Anchors, aliases and merge keys (<<) are
+// resolved. Timestamps, binary values and scalars with custom
+// tags keep their text, so a date such as 2024-01-02 is the
+// string "2024-01-02".
+//
+// jyaml is a separate module so that jsonata-go itself doesn't
+// depend on a YAML library.
+package jyaml
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidDocument is wrapped by the errors for YAML documents
+// that can't be converted to JSONata values.
+var ErrInvalidDocument = errors.New("invalid document")
+
+// Decode converts a YAML document to JSONata values. An empty
+// document decodes to nil.
+func Decode(data []byte) (interface{}, error) {
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+
+	if node.Kind == 0 {
+		return nil, nil
+	}
+
+	return convert(&node)
+}
+
+// DecodeAll converts each document in a YAML stream, such as a
+// file of documents separated by ---, to JSONata values. Empty
+// documents are skipped.
+func DecodeAll(r io.Reader) ([]interface{}, error) {
+
+	var docs []interface{}
+	dec := yaml.NewDecoder(r)
+
+	for {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isEmpty(&node) {
+			continue
+		}
+
+		v, err := convert(&node)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, v)
+	}
+}
+
+// Encode writes a JSONata result, such as a value returned by
+// Expression.Eval, as a YAML document. Object keys are written
+// in sorted order.
+func Encode(v interface{}) ([]byte, error) {
+
+	var b bytes.Buffer
+
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// Eval decodes a YAML document, evaluates e against it and
+// returns the result as YAML. Like EvalContext, it returns
+// jsonata.ErrUndefined if the expression evaluates to undefined.
+func Eval(ctx context.Context, e *jsonata.Expression, doc []byte, vars map[string]interface{}) ([]byte, error) {
+
+	data, err := Decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.EvalContext(ctx, data, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return Encode(res)
+}
+
+// isEmpty returns true if a document has no content. A document
+// that's an explicit null, such as ~, isn't empty.
+func isEmpty(doc *yaml.Node) bool {
+	if len(doc.Content) == 0 {
+		return true
+	}
+	node := doc.Content[0]
+	return node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null" && node.Value == ""
+}
+
+func convert(node *yaml.Node) (interface{}, error) {
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return convert(node.Content[0])
+
+	case yaml.AliasNode:
+		return convert(node.Alias)
+
+	case yaml.SequenceNode:
+		items := make([]interface{}, len(node.Content))
+		for i, child := range node.Content {
+			v, err := convert(child)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(node.Content)/2)
+		if err := convertMapping(node, m, false); err != nil {
+			return nil, err
+		}
+		return m, nil
+
+	case yaml.ScalarNode:
+		return convertScalar(node)
+
+	default:
+		return nil, nodeError(node, "unsupported node kind %d", node.Kind)
+	}
+}
+
+// convertMapping adds the pairs of a mapping to m. Merged
+// mappings (see https://yaml.org/type/merge.html) don't replace
+// keys that are already set.
+func convertMapping(node *yaml.Node, m map[string]interface{}, merging bool) error {
+
+	// Explicit keys take precedence over merged keys, wherever
+	// they appear, so merges are applied last.
+	var merges []*yaml.Node
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+
+		key, value := node.Content[i], node.Content[i+1]
+
+		if key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge" {
+			merges = append(merges, value)
+			continue
+		}
+
+		if key.Kind == yaml.AliasNode {
+			key = key.Alias
+		}
+		if key.Kind != yaml.ScalarNode {
+			return nodeError(key, "mapping keys must be scalars")
+		}
+
+		if _, ok := m[key.Value]; ok && merging {
+			continue
+		}
+
+		v, err := convert(value)
+		if err != nil {
+			return err
+		}
+		m[key.Value] = v
+	}
+
+	for _, value := range merges {
+
+		if value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+
+		for _, src := range sources {
+			if src.Kind == yaml.AliasNode {
+				src = src.Alias
+			}
+			if src.Kind != yaml.MappingNode {
+				return nodeError(src, "merge keys must refer to mappings")
+			}
+			if err := convertMapping(src, m, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func convertScalar(node *yaml.Node) (interface{}, error) {
+
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+
+	case "!!bool":
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return nil, err
+		}
+		return b, nil
+
+	case "!!int", "!!float":
+		var f float64
+		if err := node.Decode(&f); err != nil {
+			return nil, err
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, nodeError(node, "%s is not a valid JSONata number", node.Value)
+		}
+		return f, nil
+
+	default:
+		return node.Value, nil
+	}
+}
+
+func nodeError(node *yaml.Node, format string, a ...interface{}) error {
+	return fmt.Errorf("yaml: line %d: %w: %s", node.Line, ErrInvalidDocument, fmt.Sprintf(format, a...))
+}
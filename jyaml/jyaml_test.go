@@ -0,0 +1,125 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jyaml
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+const deployYAML = `
+defaults: &defaults
+  replicas: 2
+  image: app:1.0
+services:
+  web:
+    <<: *defaults
+    replicas: 4
+    ports: [80, 443]
+  worker:
+    <<: *defaults
+    enabled: yes
+    started: 2024-01-02
+    ratio: 0x10
+    note: ~
+`
+
+func TestDecode(t *testing.T) {
+
+	got, err := Decode([]byte(deployYAML))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	defaults := map[string]interface{}{
+		"replicas": 2.0,
+		"image":    "app:1.0",
+	}
+	want := map[string]interface{}{
+		"defaults": defaults,
+		"services": map[string]interface{}{
+			"web": map[string]interface{}{
+				"replicas": 4.0,
+				"image":    "app:1.0",
+				"ports":    []interface{}{80.0, 443.0},
+			},
+			"worker": map[string]interface{}{
+				"replicas": 2.0,
+				"image":    "app:1.0",
+				"enabled":  "yes",
+				"started":  "2024-01-02",
+				"ratio":    16.0,
+				"note":     nil,
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if v, err := Decode(nil); v != nil || err != nil {
+		t.Errorf("expected nil for an empty document, got %v (%v)", v, err)
+	}
+
+	for _, doc := range []string{
+		"x: .inf",
+		"? [a, b]\n: c",
+	} {
+		if _, err := Decode([]byte(doc)); !errors.Is(err, ErrInvalidDocument) {
+			t.Errorf("%q: expected ErrInvalidDocument, got %v", doc, err)
+		}
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+
+	docs, err := DecodeAll(strings.NewReader("a: 1\n---\n- b\n---\n~\n---\n"))
+	if err != nil {
+		t.Fatalf("DecodeAll failed: %v", err)
+	}
+
+	want := []interface{}{
+		map[string]interface{}{"a": 1.0},
+		[]interface{}{"b"},
+		nil,
+	}
+	if !reflect.DeepEqual(docs, want) {
+		t.Errorf("expected %v, got %v", want, docs)
+	}
+}
+
+func TestEval(t *testing.T) {
+
+	comp, err := jsonata.NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`$each(services, function($v, $k) {{"name": $k, "replicas": $v.replicas}})^(name)`)
+
+	got, err := Eval(context.Background(), e, []byte(deployYAML), nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	want := `- name: web
+  replicas: 4
+- name: worker
+  replicas: 2
+`
+	if string(got) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	if _, err := Eval(context.Background(), comp.MustCompile(`nothing`), []byte(deployYAML), nil); err != jsonata.ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A filterKernel is a specialised implementation of a predicate
+// filter. It reports whether a single item passes the filter.
+type filterKernel func(item reflect.Value, env *environment) (bool, error)
+
+// compileFilterKernels returns kernels for the predicate filters
+// in a syntax tree that can be evaluated without the generic
+// filter logic. The map is keyed by filter node and is safe for
+// concurrent reads.
+//
+// Currently, kernels are selected for comparisons between an
+// arbitrary expression and a number or string literal, as in
+// Order[Price > 100] or Product["Hat" = Name]. If customEquality
+// is true, the = and != operators use a custom equality function
+// (see WithEqual) and don't get kernels.
+func compileFilterKernels(root jparse.Node, customEquality bool) (map[jparse.Node]filterKernel, error) {
+
+	if err := checkPlanTree(root); err != nil {
+		return nil, err
+	}
+
+	var kernels map[jparse.Node]filterKernel
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+
+		pred, ok := node.(*jparse.PredicateNode)
+		if !ok {
+			return true
+		}
+
+		for _, filter := range pred.Filters {
+			if kernel := newFilterKernel(filter, customEquality); kernel != nil {
+				if kernels == nil {
+					kernels = map[jparse.Node]filterKernel{}
+				}
+				kernels[filter] = kernel
+			}
+		}
+
+		return true
+	})
+
+	return kernels, nil
+}
+
+func newFilterKernel(filter jparse.Node, customEquality bool) filterKernel {
+
+	node, ok := filter.(*jparse.ComparisonOperatorNode)
+	if !ok || node.Type == jparse.ComparisonIn {
+		return nil
+	}
+
+	if customEquality && !needComparableTypes(node.Type) {
+		return nil
+	}
+
+	switch literal := node.RHS.(type) {
+	case *jparse.NumberNode:
+		return newNumberKernel(node, node.LHS, literal.Value, false)
+	case *jparse.StringNode:
+		return newStringKernel(node, node.LHS, literal.Value, false)
+	}
+
+	switch literal := node.LHS.(type) {
+	case *jparse.NumberNode:
+		return newNumberKernel(node, node.RHS, literal.Value, true)
+	case *jparse.StringNode:
+		return newStringKernel(node, node.RHS, literal.Value, true)
+	}
+
+	return nil
+}
+
+// newNumberKernel returns a kernel that compares the result of
+// evaluating expr with the number n. Values that are not numbers
+// are handed off to the generic comparison logic so that errors
+// and undefined values are handled as usual.
+func newNumberKernel(node *jparse.ComparisonOperatorNode, expr jparse.Node, n float64, literalOnLeft bool) filterKernel {
+
+	literal := comparisonOperand{n: n, isNumber: true}
+
+	return func(item reflect.Value, env *environment) (bool, error) {
+
+		v, err := eval(expr, item, env)
+		if err != nil {
+			return false, err
+		}
+
+		if x, ok := jtypes.AsNumber(v); ok {
+			if literalOnLeft {
+				return compareNumbers(node.Type, n, x), nil
+			}
+			return compareNumbers(node.Type, x, n), nil
+		}
+
+		return compareWithLiteral(node, v, literal, literalOnLeft)
+	}
+}
+
+// newStringKernel is the string equivalent of newNumberKernel.
+func newStringKernel(node *jparse.ComparisonOperatorNode, expr jparse.Node, s string, literalOnLeft bool) filterKernel {
+
+	literal := newComparisonOperand(reflect.ValueOf(s))
+
+	return func(item reflect.Value, env *environment) (bool, error) {
+
+		v, err := eval(expr, item, env)
+		if err != nil {
+			return false, err
+		}
+
+		if x, ok := jtypes.AsString(v); ok {
+			if literalOnLeft {
+				return compareStrings(node.Type, s, x), nil
+			}
+			return compareStrings(node.Type, x, s), nil
+		}
+
+		return compareWithLiteral(node, v, literal, literalOnLeft)
+	}
+}
+
+func compareWithLiteral(node *jparse.ComparisonOperatorNode, v reflect.Value, literal comparisonOperand, literalOnLeft bool) (bool, error) {
+
+	var operand comparisonOperand
+	defined := v != undefined
+	if defined {
+		operand = newComparisonOperand(v)
+	}
+
+	if literalOnLeft {
+		return compareOperands(node, literal, true, operand, defined, nil)
+	}
+	return compareOperands(node, operand, defined, literal, true, nil)
+}
+
+func applyFilterKernel(kernel filterKernel, items reflect.Value, env *environment) (reflect.Value, error) {
+
+	nItems := items.Len()
+	results := reflect.MakeSlice(typeInterfaceSlice, 0, 0)
+
+	for i := 0; i < nItems; i++ {
+
+		item := items.Index(i)
+
+		ok, err := kernel(item, env)
+		if err != nil {
+			return undefined, err
+		}
+
+		if ok {
+			results = reflect.Append(results, item)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+func TestFilterKernelSelection(t *testing.T) {
+
+	data := []struct {
+		Expression string
+		Kernels    int
+	}{
+		{`Order[Price > 100]`, 1},
+		{`Order["Hat" = Product]`, 1},
+		{`Order[Price > 100][Product != "Hat"]`, 2},
+		{`Order[Price > Limit]`, 0},
+		{`Order[Product in ["Hat"]]`, 0},
+		{`Order[0]`, 0},
+		{`Order.Items[Qty < 2].Price`, 1},
+		{`$map(Order, function($o){ $o.Items[Qty = 1] })`, 1},
+	}
+
+	for _, test := range data {
+
+		node, err := jparse.Parse(test.Expression)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Expression, err)
+		}
+
+		kernels, _ := compileFilterKernels(node, false)
+		if len(kernels) != test.Kernels {
+			t.Errorf("%s: expected %d kernels, got %d", test.Expression, test.Kernels, len(kernels))
+		}
+	}
+}
+
+func TestFilterKernels(t *testing.T) {
+
+	input := map[string]interface{}{
+		"Order": []interface{}{
+			map[string]interface{}{"Product": "Hat", "Price": 34.45, "Qty": 2},
+			map[string]interface{}{"Product": "Bag", "Price": 107.99, "Qty": 1},
+			map[string]interface{}{"Product": "Dress", "Price": "n/a"},
+			map[string]interface{}{"Product": "Coat", "Price": []interface{}{1}},
+			map[string]interface{}{"Price": 200},
+		},
+	}
+
+	exprs := []string{
+		`Order[Price > 100].Product`,
+		`Order[100 < Price].Product`,
+		`Order[Price = 34.45].Product`,
+		`Order[Price != 34.45].Product`,
+		`Order[Qty <= 1].Product`,
+		`Order[Qty >= 2].Product`,
+		`Order[Product = "Hat"].Price`,
+		`Order["Hat" != Product].Price`,
+		`Order[Product < "Coat"].Price`,
+		`Order[Product > "Coat"].Price`,
+		`Order[Missing = 1]`,
+		`Order[Product > 100]`,
+		`Order[100 > Product]`,
+		`Order[Price < "Hat"]`,
+		`Order[Price = "n/a"].Product`,
+		`Order[Price = 1].Product`,
+	}
+
+	for _, expr := range exprs {
+
+		node, err := jparse.Parse(expr)
+		if err != nil {
+			t.Fatalf("%s: %s", expr, err)
+		}
+
+		kernels, _ := compileFilterKernels(node, false)
+		if len(kernels) == 0 {
+			t.Errorf("%s: no kernels selected", expr)
+			continue
+		}
+
+		// Evaluate the expression with and without kernels.
+		// The results should be identical.
+		in := reflect.ValueOf(input)
+
+		env := newEnvironment(nil, 0)
+		env.state = &evalState{kernels: kernels}
+		got, gotErr := eval(node, in, env)
+
+		exp, expErr := eval(node, in, newEnvironment(nil, 0))
+
+		if !reflect.DeepEqual(gotErr, expErr) {
+			t.Errorf("%s: expected error %v, got %v", expr, expErr, gotErr)
+		}
+
+		var gotValue, expValue interface{}
+		if got.IsValid() {
+			gotValue = got.Interface()
+		}
+		if exp.IsValid() {
+			expValue = exp.Interface()
+		}
+
+		if !reflect.DeepEqual(gotValue, expValue) {
+			t.Errorf("%s: expected %v, got %v", expr, expValue, gotValue)
+		}
+	}
+}
+
+func BenchmarkFilterKernel(b *testing.B) {
+
+	items := make([]interface{}, 1000)
+	for i := range items {
+		items[i] = map[string]interface{}{
+			"Price": float64(i),
+		}
+	}
+
+	e := MustCompile(`$[Price > 500]`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := e.Eval(items); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
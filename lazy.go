@@ -0,0 +1,433 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"io"
+	"math"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A LazyArray is an array whose items are fetched as they're
+// needed, e.g. from a database cursor or a paginated API, and
+// whose length isn't known in advance. LazyArrays can appear
+// anywhere in an expression's input, such as in a map or a
+// struct field.
+//
+// Some expressions read a LazyArray incrementally, without
+// holding all of its items in memory:
+//
+//   - a path step that follows the array's field, as in
+//     orders.total or $sum(orders.(price * qty)), is applied
+//     to the items in small batches, so only its results are
+//     kept;
+//   - a filter on the array's field that is a comparison or a
+//     boolean expression, as in orders[status = "open"], keeps
+//     only the matching items;
+//   - a non-negative index, as in orders[0], stops reading when
+//     it reaches the item;
+//   - a series of such filters, as in orders[status = "open"][0],
+//     is applied in turn to each batch, so the index stops
+//     reading as soon as the first open order is found.
+//
+// Ranges that are filtered or followed by a path step, as in
+// [1..n][$ % 7 = 0][0] or [1..n].($ * 2), are read in the same
+// way, without making the whole range into an array.
+//
+// Elsewhere, e.g. when the field is passed to a function, the
+// items are all read into an ordinary array first. The wildcard
+// and descendant operators skip LazyArrays.
+type LazyArray interface {
+	// Iter returns an iterator over the array's items. It's
+	// called every time the array is read, so an expression
+	// that reads the array twice iterates over it twice. ctx
+	// is the context passed to Expression.EvalContext.
+	Iter(ctx context.Context) LazyIterator
+}
+
+// A LazyIterator returns the items of a LazyArray one by one.
+// If a LazyIterator implements io.Closer, Close is called when
+// the evaluator stops reading it, whether or not it reached
+// the end of the array.
+type LazyIterator interface {
+	// Next returns the next item and true, or false if there
+	// are no more items. Items are read like any other input
+	// value. A non-nil error stops the evaluation.
+	Next() (item interface{}, ok bool, err error)
+}
+
+// lazyBatchSize is the number of items of a LazyArray that are
+// read before a path step is applied to them.
+const lazyBatchSize = 64
+
+var typeLazyArray = reflect.TypeOf((*LazyArray)(nil)).Elem()
+
+// asLazyArray returns the LazyArray held by v, if there is one.
+func asLazyArray(v reflect.Value) (LazyArray, bool) {
+
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Struct, reflect.Map, reflect.Slice, reflect.Func:
+	default:
+		return nil, false
+	}
+
+	if !v.CanInterface() || !v.Type().Implements(typeLazyArray) {
+		return nil, false
+	}
+
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+
+	return v.Interface().(LazyArray), true
+}
+
+func isLazyArray(v reflect.Value) bool {
+	_, ok := asLazyArray(v)
+	return ok
+}
+
+// readLazy reads all of the items of a LazyArray into an array.
+// Other values are returned unchanged.
+func readLazy(v reflect.Value, env *environment) (reflect.Value, error) {
+
+	lazy, ok := asLazyArray(v)
+	if !ok {
+		return v, nil
+	}
+
+	var items []interface{}
+	err := eachLazyItem(lazy, env, func(item reflect.Value) bool {
+		items = append(items, item.Interface())
+		return true
+	})
+	if err != nil {
+		return undefined, err
+	}
+
+	if items == nil {
+		items = []interface{}{}
+	}
+
+	return reflect.ValueOf(items), nil
+}
+
+// eachLazyItem calls fn with each item of a LazyArray until fn
+// returns false or there are no more items.
+func eachLazyItem(lazy LazyArray, env *environment, fn func(reflect.Value) bool) error {
+
+	it := lazy.Iter(env.ctx())
+	if c, ok := it.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	for {
+		item, ok, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+
+		v := reflect.ValueOf(item)
+		if item == nil {
+			v = reflect.ValueOf(null)
+		}
+
+		if !fn(env.convert(v)) {
+			return nil
+		}
+	}
+}
+
+// evalNameLazy is like eval for a name, except that if the named
+// field holds a LazyArray, it returns the LazyArray instead of
+// reading its items.
+func evalNameLazy(node *jparse.NameNode, data reflect.Value, env *environment) (reflect.Value, LazyArray, error) {
+
+	env.cover(node)
+
+	v, err := evalName(node, data, env)
+	if err != nil {
+		return undefined, nil, env.recordError(node, err)
+	}
+	env.clearError()
+
+	if lazy, ok := asLazyArray(v); ok {
+		return undefined, lazy, nil
+	}
+
+	if seq, ok := asSequence(v); ok {
+		v = seq.Value()
+	}
+
+	return v, nil, nil
+}
+
+// evalLazyStep applies the path step that follows a LazyArray
+// to the array's items, in batches of lazyBatchSize. As with
+// any other array, items that are arrays are flattened first.
+func evalLazyStep(lazy LazyArray, step jparse.Node, env *environment, lastStep bool) (reflect.Value, error) {
+
+	var results []reflect.Value
+	var batch []interface{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		res, err := evalOverArray(step, reflect.ValueOf(batch), env)
+		if err != nil {
+			return err
+		}
+		results = append(results, res...)
+		// The results can refer to the batch's items, so
+		// the next batch needs a new slice.
+		batch = nil
+		return nil
+	}
+
+	var err error
+	add := func(item reflect.Value) {
+		if item.CanInterface() {
+			batch = append(batch, item.Interface())
+		}
+	}
+
+	eachErr := eachLazyItem(lazy, env, func(item reflect.Value) bool {
+
+		if jtypes.IsArray(item) {
+			item = arrayify(item)
+			for i, N := 0, item.Len(); i < N; i++ {
+				add(item.Index(i))
+			}
+		} else {
+			add(item)
+		}
+
+		if len(batch) >= lazyBatchSize {
+			err = flush()
+		}
+		return err == nil
+	})
+
+	if err == nil {
+		err = eachErr
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return undefined, err
+	}
+
+	return pathStepResult(step, results, lastStep, env)
+}
+
+// filterLazy applies a predicate's filters to the items of a
+// LazyArray, for as many of the filters as can be applied
+// incrementally, and returns the number of filters that it
+// applied. Comparisons and boolean expressions are applied in
+// batches, and a non-negative number index stops reading when
+// it reaches the indexed item, so the filters in
+// [1..1000000][$ % 7 = 0][0] stop after the seventh item. The
+// remaining filters, if there are any, must be applied to the
+// result as usual.
+func filterLazy(lazy LazyArray, filters []jparse.Node, env *environment) (items reflect.Value, n int, err error) {
+
+	var stages []*lazyFilter
+
+	for _, filter := range filters {
+		stage := newLazyFilter(filter)
+		if stage == nil {
+			break
+		}
+		stages = append(stages, stage)
+	}
+
+	if len(stages) == 0 {
+		return undefined, 0, nil
+	}
+
+	results := reflect.MakeSlice(typeInterfaceSlice, 0, 0)
+	batch := reflect.MakeSlice(typeInterfaceSlice, 0, lazyBatchSize)
+	done := false
+
+	flush := func() error {
+		items := batch
+		batch = reflect.MakeSlice(typeInterfaceSlice, 0, lazyBatchSize)
+
+		for _, stage := range stages {
+			if items.Len() == 0 {
+				return nil
+			}
+			var err error
+			items, err = stage.apply(items, env)
+			if err != nil {
+				return err
+			}
+			if stage.done() {
+				done = true
+			}
+		}
+
+		results = reflect.AppendSlice(results, items)
+		return nil
+	}
+
+	first := stages[0]
+
+	eachErr := eachLazyItem(lazy, env, func(item reflect.Value) bool {
+		batch = reflect.Append(batch, item)
+		if batch.Len() >= lazyBatchSize || first.reaches(batch.Len()) {
+			err = flush()
+		}
+		return err == nil && !done
+	})
+
+	if err == nil {
+		err = eachErr
+	}
+	if err == nil && !done {
+		err = flush()
+	}
+
+	return results, len(stages), err
+}
+
+// A lazyFilter is a filter applied by filterLazy.
+type lazyFilter struct {
+	filter jparse.Node
+
+	// index is the number of the item that an index filter
+	// selects, or -1 for other filters, and seen is the number
+	// of items that it has been given so far.
+	index int
+	seen  int
+}
+
+// newLazyFilter returns a lazyFilter for a filter, or nil if it
+// can't be applied incrementally.
+func newLazyFilter(filter jparse.Node) *lazyFilter {
+
+	switch f := filter.(type) {
+	case *jparse.NumberNode:
+		if f.Value < 0 {
+			return nil
+		}
+		return &lazyFilter{
+			filter: filter,
+			index:  int(math.Floor(f.Value)),
+		}
+	case *jparse.ComparisonOperatorNode, *jparse.BooleanOperatorNode:
+		return &lazyFilter{
+			filter: filter,
+			index:  -1,
+		}
+	default:
+		return nil
+	}
+}
+
+// apply returns the items that pass the filter.
+func (f *lazyFilter) apply(items reflect.Value, env *environment) (reflect.Value, error) {
+
+	if f.index < 0 {
+		return applyFilter(f.filter, items, env)
+	}
+
+	n := items.Len()
+	defer func() { f.seen += n }()
+
+	if f.done() || !f.reaches(n) {
+		return items.Slice(0, 0), nil
+	}
+
+	return items.Slice(f.index-f.seen, f.index-f.seen+1), nil
+}
+
+// reaches returns true if an index filter reaches its item
+// within the next n items.
+func (f *lazyFilter) reaches(n int) bool {
+	return f.index >= 0 && f.seen <= f.index && f.seen+n > f.index
+}
+
+// done returns true if an index filter has selected its item.
+func (f *lazyFilter) done() bool {
+	return f.index >= 0 && f.seen > f.index
+}
+
+// A rangeArray is a LazyArray of the numbers in a range, so that
+// a range that's filtered, as in [1..1000000][$ % 7 = 0], or
+// mapped by a path, as in [1..1000000].($ * 2), isn't made into
+// an array first.
+type rangeArray struct {
+	lo   float64
+	size int
+}
+
+func (r rangeArray) Iter(context.Context) LazyIterator {
+	return &rangeIterator{
+		next: r.lo,
+		left: r.size,
+	}
+}
+
+type rangeIterator struct {
+	next float64
+	left int
+}
+
+func (it *rangeIterator) Next() (interface{}, bool, error) {
+
+	if it.left == 0 {
+		return nil, false, nil
+	}
+
+	v := it.next
+	it.next++
+	it.left--
+
+	return v, true, nil
+}
+
+// evalRangeLazy returns a rangeArray for an array constructor
+// that contains only a range, such as [1..n]. ok is false for
+// other nodes, and while the evaluation is traced or profiled,
+// which expects every node to be evaluated. An undefined range
+// is an empty rangeArray.
+func evalRangeLazy(node jparse.Node, data reflect.Value, env *environment) (lazy LazyArray, ok bool, err error) {
+
+	array, isArray := node.(*jparse.ArrayNode)
+	if !isArray || len(array.Items) != 1 || env.tracing() || env.profiling() {
+		return nil, false, nil
+	}
+
+	rng, isRange := array.Items[0].(*jparse.RangeNode)
+	if !isRange {
+		return nil, false, nil
+	}
+
+	// The nodes aren't evaluated, so record them for coverage
+	// here.
+	env.cover(array)
+	env.cover(rng)
+
+	lo, size, err := evalRangeBounds(rng, data, env)
+	if err != nil {
+		return nil, true, env.recordError(rng, err)
+	}
+
+	return rangeArray{lo: lo, size: size}, true, nil
+}
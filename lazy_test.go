@@ -0,0 +1,404 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testLazyArray is a LazyArray that records how much of it
+// has been read.
+type testLazyArray struct {
+	items  []interface{}
+	err    error
+	iters  int
+	read   int
+	closed int
+}
+
+func (a *testLazyArray) Iter(ctx context.Context) LazyIterator {
+	a.iters++
+	return &testLazyIterator{array: a}
+}
+
+type testLazyIterator struct {
+	array *testLazyArray
+	pos   int
+}
+
+func (it *testLazyIterator) Next() (interface{}, bool, error) {
+	if it.pos == len(it.array.items) {
+		if it.array.err != nil {
+			return nil, false, it.array.err
+		}
+		return nil, false, nil
+	}
+	it.pos++
+	it.array.read++
+	return it.array.items[it.pos-1], true, nil
+}
+
+func (it *testLazyIterator) Close() error {
+	it.array.closed++
+	return nil
+}
+
+func newTestOrders(n int) *testLazyArray {
+	items := make([]interface{}, n)
+	for i := range items {
+		status := "closed"
+		if i%10 == 3 {
+			status = "open"
+		}
+		items[i] = map[string]interface{}{
+			"id":     i,
+			"status": status,
+			"total":  float64(i),
+		}
+	}
+	return &testLazyArray{items: items}
+}
+
+func TestLazyArray(t *testing.T) {
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{
+			expr: `orders[0].id`,
+			want: 0,
+		},
+		{
+			expr: `orders[5].total`,
+			want: float64(5),
+		},
+		{
+			expr: `orders[status = "open"].id`,
+			want: []interface{}{3, 13, 23, 33, 43, 53, 63, 73, 83, 93},
+		},
+		{
+			expr: `$sum(orders.total)`,
+			want: float64(4950),
+		},
+		{
+			expr: `$count(orders)`,
+			want: 100,
+		},
+		{
+			expr: `orders[-1].id`,
+			want: 99,
+		},
+		{
+			expr: `$count(orders[total > 95])`,
+			want: 4,
+		},
+		{
+			expr: `orders[status = "open"][0].id`,
+			want: 3,
+		},
+	}
+
+	for _, test := range tests {
+
+		expr, err := Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		orders := newTestOrders(100)
+		got, err := expr.Eval(map[string]interface{}{"orders": orders})
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+		if orders.iters != 1 || orders.closed != 1 {
+			t.Errorf("%s: expected 1 iteration and 1 close, got %d and %d", test.expr, orders.iters, orders.closed)
+		}
+	}
+}
+
+func TestLazyArray_StopsEarly(t *testing.T) {
+
+	tests := []struct {
+		expr string
+		read int
+	}{
+		{
+			expr: `orders[0]`,
+			read: 1,
+		},
+		{
+			expr: `orders[5].total`,
+			read: 6,
+		},
+		{
+			expr: `orders[status = "open"].id`,
+			read: 100,
+		},
+	}
+
+	for _, test := range tests {
+
+		expr, err := Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		orders := newTestOrders(100)
+		if _, err := expr.Eval(map[string]interface{}{"orders": orders}); err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if orders.read != test.read {
+			t.Errorf("%s: expected %d items to be read, got %d", test.expr, test.read, orders.read)
+		}
+	}
+}
+
+func TestLazyArray_Errors(t *testing.T) {
+
+	errCursor := errors.New("cursor expired")
+
+	orders := newTestOrders(10)
+	orders.err = errCursor
+
+	for _, s := range []string{
+		`orders.total`,
+		`orders[status = "open"]`,
+		`$count(orders)`,
+		`orders`,
+	} {
+
+		expr, err := Compile(s)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", s, err)
+			continue
+		}
+
+		_, err = expr.Eval(map[string]interface{}{"orders": orders})
+		if !errors.Is(err, errCursor) {
+			t.Errorf("%s: expected the iterator's error, got %v", s, err)
+		}
+	}
+}
+
+func TestLazyArray_ReadTwice(t *testing.T) {
+
+	expr, err := Compile(`$count(orders) & "/" & $sum(orders.total)`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	orders := newTestOrders(4)
+	got, err := expr.Eval(map[string]interface{}{"orders": orders})
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	if got != "4/6" {
+		t.Errorf("expected 4/6, got %v", got)
+	}
+	if orders.iters != 2 || orders.closed != 2 {
+		t.Errorf("expected 2 iterations and 2 closes, got %d and %d", orders.iters, orders.closed)
+	}
+}
+
+func TestLazyArray_Input(t *testing.T) {
+
+	expr, err := Compile(`$[status = "open"].id`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	got, err := expr.Eval(newTestOrders(20))
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	want := []interface{}{3, 13}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	got, err = comp.MustCompile(`$[status = "open"].id`).Eval(newTestOrders(20), nil)
+	if err != nil {
+		t.Fatalf("Expression.Eval failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expression.Eval: expected %v, got %v", want, got)
+	}
+}
+
+func TestLazyArray_ChainedFilters(t *testing.T) {
+
+	tests := []struct {
+		expr string
+		want interface{}
+		read int
+	}{
+		{
+			expr: `orders[status = "open"][0].id`,
+			want: 3,
+			read: 64,
+		},
+		{
+			expr: `orders[total > 10][status = "open"][1].id`,
+			want: 23,
+			read: 64,
+		},
+		{
+			expr: `orders[status = "open"][-1].id`,
+			want: 93,
+			read: 100,
+		},
+	}
+
+	for _, test := range tests {
+
+		expr, err := Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		orders := newTestOrders(100)
+		got, err := expr.Eval(map[string]interface{}{"orders": orders})
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+		if orders.read != test.read {
+			t.Errorf("%s: expected %d items to be read, got %d", test.expr, test.read, orders.read)
+		}
+	}
+}
+
+func TestLazyRange(t *testing.T) {
+
+	tests := []struct {
+		expr string
+		want interface{}
+		err  error
+	}{
+		{
+			expr: `[1..10000000][$ % 7 = 0][0]`,
+			want: float64(7),
+		},
+		{
+			expr: `[1..10][$ > 3][1]`,
+			want: float64(5),
+		},
+		{
+			expr: `[1..10][$ > 3][$ % 2 = 0]`,
+			want: []interface{}{float64(4), float64(6), float64(8), float64(10)},
+		},
+		{
+			expr: `[1..10][$ > 3][-1]`,
+			want: float64(10),
+		},
+		{
+			expr: `[1..5].($ * 2)`,
+			want: []interface{}{float64(2), float64(4), float64(6), float64(8), float64(10)},
+		},
+		{
+			expr: `[1..3].$string()`,
+			want: []interface{}{"1", "2", "3"},
+		},
+		{
+			expr: `[1..10][$ > 10]`,
+			err:  ErrUndefined,
+		},
+		{
+			expr: `[5..1][0]`,
+			err:  ErrUndefined,
+		},
+		{
+			expr: `[1..$x].($ * 2)`,
+			err:  ErrUndefined,
+		},
+	}
+
+	for _, test := range tests {
+
+		expr, err := Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		got, err := expr.Eval(nil)
+		if err != test.err {
+			t.Errorf("%s: expected error %v, got %v", test.expr, test.err, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+	}
+
+	// Invalid ranges fail as they do when they're made into
+	// arrays.
+	for _, test := range []struct {
+		expr string
+		typ  ErrType
+	}{
+		{`[1.5..3][0]`, ErrNonIntegerLHS},
+		{`[1..3.5].$`, ErrNonIntegerRHS},
+		{`[1..10000001][0]`, ErrMaxRangeItems},
+	} {
+
+		expr, err := Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		var eerr *EvalError
+		if _, err := expr.Eval(nil); !errors.As(err, &eerr) || eerr.Type != test.typ {
+			t.Errorf("%s: expected an *EvalError of type %v, got %v", test.expr, test.typ, err)
+		}
+	}
+}
+
+func TestLazyRange_Allocations(t *testing.T) {
+
+	expr, err := Compile(`[1..10000000][$ % 7 = 0][0]`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := expr.Eval(nil); err != nil {
+			t.Fatalf("Eval failed: %v", err)
+		}
+	})
+
+	// Materializing the range would take ten million
+	// allocations.
+	if allocs > 2000 {
+		t.Errorf("expected the range to be streamed, got %.0f allocations", allocs)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// RegisterLibrary registers a set of named JSONata functions
+// under a single variable name, so that expressions can share
+// them instead of repeating their definitions. Each value in
+// funcs is the source of a function definition. For example,
+// after
+//
+//	c.RegisterLibrary("lib", map[string]string{
+//		"normalizeAddress": `function($a) {
+//			$join([$a.street, $lib.normalizeCity($a.city)], ", ")
+//		}`,
+//		"normalizeCity": `function($c) { $uppercase($trim($c)) }`,
+//	})
+//
+// the expression $lib.normalizeAddress(addr) calls the first
+// function with the value of addr in the current context. As the
+// example shows, library functions can call each other, and the
+// functions of libraries registered earlier, by name.
+//
+// References to library functions are resolved when an
+// expression is compiled: a reference to a function that isn't
+// in the library, such as $lib.normaliseAddress, is a compile
+// error, a *CompileError that wraps a *LibraryFunctionError,
+// unless the expression assigns the library name itself. The
+// functions are evaluated like functions defined in the
+// expression, with the same limits and options, and $ in a
+// function body is the input of the evaluation.
+//
+// A library replaces any variable, extension or module with the
+// same name. A variable with the library's name that's passed
+// to Eval replaces the library. RegisterLibrary applies to
+// expressions compiled after it's called and must not be called
+// at the same time as Compile.
+func (c *Compiler) RegisterLibrary(name string, funcs map[string]string) error {
+
+	if c.frozen {
+		return errDefaultFrozen()
+	}
+
+	if !validName(name) {
+		return fmt.Errorf("%s is not a valid library name", name)
+	}
+
+	lib := &library{
+		name:  name,
+		funcs: make(map[string]jparse.Node, len(funcs)),
+	}
+
+	names := make([]string, 0, len(funcs))
+	for fn := range funcs {
+		names = append(names, fn)
+	}
+	sort.Strings(names)
+
+	for _, fn := range names {
+
+		if !validName(fn) {
+			return fmt.Errorf("%s.%s is not a valid name", name, fn)
+		}
+
+		node, _, _, errs := c.compileNode(funcs[fn], false)
+		if len(errs) > 0 {
+			return fmt.Errorf("%s.%s: %w", name, fn, errs[0])
+		}
+
+		switch node.(type) {
+		case *jparse.LambdaNode, *jparse.TypedLambdaNode:
+		default:
+			return fmt.Errorf("%s.%s is not a function definition", name, fn)
+		}
+
+		// Calls to the library's own functions can't be resolved
+		// by compileNode because it isn't registered yet.
+		resolveModuleCalls(node, nil, map[string]bool{name: true})
+
+		lib.funcs[fn] = node
+	}
+
+	// Resolve the references between the library's functions,
+	// and to the libraries that are already registered.
+	libs := make(map[string]*library, len(c.libraries)+1)
+	for k, v := range c.libraries {
+		libs[k] = v
+	}
+	libs[name] = lib
+
+	for _, fn := range names {
+
+		refs, errs := resolveLibraries(libs, lib.funcs[fn], funcs[fn], nil)
+		if len(errs) > 0 {
+			return fmt.Errorf("%s.%s: %w", name, fn, errs[0])
+		}
+
+		for _, ref := range refs {
+			if ref != lib {
+				lib.deps = append(lib.deps, ref)
+			}
+		}
+	}
+
+	delete(c.baseRegistry, name)
+
+	if c.libraries == nil {
+		c.libraries = make(map[string]*library)
+	}
+	c.libraries[name] = lib
+
+	return nil
+}
+
+// WithLibrary registers a library of JSONata functions, as
+// RegisterLibrary does, for compilers that are only set up with
+// options.
+func WithLibrary(name string, funcs map[string]string) CompilerOption {
+	return func(c *Compiler) error {
+		return c.RegisterLibrary(name, funcs)
+	}
+}
+
+// A LibraryFunctionError is the error for a reference to a
+// function that isn't in a library (see RegisterLibrary).
+type LibraryFunctionError struct {
+	Library string
+	Name    string
+}
+
+func (e *LibraryFunctionError) Error() string {
+	return fmt.Sprintf("library $%s has no function %s", e.Library, e.Name)
+}
+
+// A library is a set of JSONata functions registered with
+// RegisterLibrary.
+type library struct {
+	name  string
+	funcs map[string]jparse.Node
+
+	// deps are the other libraries that the functions refer
+	// to.
+	deps []*library
+}
+
+// module returns the library's functions as a module for one
+// evaluation, with env as the environment in which they're
+// defined and input as the value of $ in their bodies.
+func (lib *library) module(env *environment, input reflect.Value) extensionModule {
+
+	mod := make(extensionModule, len(lib.funcs))
+
+	for fn, node := range lib.funcs {
+
+		f := &lambdaCallable{
+			callableName: callableName{
+				name: lib.name + "." + fn,
+			},
+			context: input,
+			env:     env,
+		}
+
+		switch node := node.(type) {
+		case *jparse.LambdaNode:
+			f.paramNames = node.ParamNames
+			f.body = node.Body
+		case *jparse.TypedLambdaNode:
+			f.typed = true
+			f.params = node.In
+			f.paramNames = node.ParamNames
+			f.body = node.Body
+		}
+
+		mod[fn] = f
+	}
+
+	return mod
+}
+
+// linkLibraries returns the libraries that an expression uses,
+// including the libraries that their functions use, in the
+// order in which they should be bound.
+func (c *Compiler) linkLibraries(root jparse.Node) []*library {
+
+	if len(c.libraries) == 0 {
+		return nil
+	}
+
+	refs, _ := resolveLibraries(c.libraries, root, "", nil)
+
+	var linked []*library
+	seen := map[*library]bool{}
+
+	var link func(*library)
+	link = func(lib *library) {
+		if seen[lib] {
+			return
+		}
+		seen[lib] = true
+		for _, dep := range lib.deps {
+			link(dep)
+		}
+		linked = append(linked, lib)
+	}
+
+	for _, lib := range refs {
+		link(lib)
+	}
+
+	return linked
+}
+
+// appendLibraries returns the libraries in a followed by the
+// ones in b that aren't in a.
+func appendLibraries(a, b []*library) []*library {
+
+	libs := append([]*library(nil), a...)
+
+	for _, lib := range b {
+		found := false
+		for _, l := range a {
+			if l == lib {
+				found = true
+				break
+			}
+		}
+		if !found {
+			libs = append(libs, lib)
+		}
+	}
+
+	return libs
+}
+
+// checkLibraries returns a compile error for each reference to
+// a library function that doesn't exist in a syntax tree.
+func (c *Compiler) checkLibraries(root jparse.Node, src string, ranges map[jparse.Node]jparse.Range) CompileErrors {
+
+	if len(c.libraries) == 0 {
+		return nil
+	}
+
+	_, errs := resolveLibraries(c.libraries, root, src, ranges)
+	return errs
+}
+
+// resolveLibraries returns the libraries that a syntax tree
+// refers to, and a compile error for each reference to a library
+// function that doesn't exist. As in checkDisabled, names
+// assigned anywhere in the expression are treated as defined
+// everywhere in it, so they don't refer to libraries.
+func resolveLibraries(libs map[string]*library, root jparse.Node, src string, ranges map[jparse.Node]jparse.Range) ([]*library, CompileErrors) {
+
+	bound := map[string]bool{}
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+		switch node := node.(type) {
+		case *jparse.AssignmentNode:
+			bound[node.Name] = true
+		case *jparse.LambdaNode:
+			for _, name := range node.ParamNames {
+				bound[name] = true
+			}
+		case *jparse.TypedLambdaNode:
+			for _, name := range node.ParamNames {
+				bound[name] = true
+			}
+		}
+		return true
+	})
+
+	var refs []*library
+	var errs CompileErrors
+	seen := map[*library]bool{}
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+
+		path, ok := node.(*jparse.PathNode)
+		if !ok {
+			return true
+		}
+
+		for i, step := range path.Steps {
+
+			v, ok := step.(*jparse.VariableNode)
+			if !ok || bound[v.Name] {
+				continue
+			}
+
+			lib, ok := libs[v.Name]
+			if !ok {
+				continue
+			}
+
+			if i+1 == len(path.Steps) {
+				continue
+			}
+
+			name := libraryFuncName(path.Steps[i+1])
+			if name == nil {
+				continue
+			}
+
+			if _, ok := lib.funcs[name.Value]; ok {
+				continue
+			}
+
+			err := newCompileError(&LibraryFunctionError{Library: lib.name, Name: name.Value}, src)
+			if r, ok := ranges[name]; ok {
+				err.Token = src[r.Start:r.End]
+				err.Position = r.Start
+				err.Line, err.Column = lineColumn(src, r.Start)
+				err.SourceLine = sourceLine(src, r.Start)
+			}
+			errs = append(errs, err)
+		}
+
+		return true
+	})
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+		if v, ok := node.(*jparse.VariableNode); ok && !bound[v.Name] {
+			if lib, ok := libs[v.Name]; ok && !seen[lib] {
+				seen[lib] = true
+				refs = append(refs, lib)
+			}
+		}
+		return true
+	})
+
+	return refs, errs
+}
+
+// libraryFuncName returns the name of the function in a path
+// step that follows a library variable, e.g. normalizeAddress in
+// $lib.normalizeAddress or $lib.normalizeAddress(addr)[0]. It
+// returns nil if the step isn't a function name.
+func libraryFuncName(step jparse.Node) *jparse.NameNode {
+
+	if pred, ok := step.(*jparse.PredicateNode); ok {
+		step = pred.Expr
+	}
+
+	if call, ok := step.(*jparse.FunctionCallNode); ok {
+		fn, ok := call.Func.(*jparse.PathNode)
+		if !ok || len(fn.Steps) != 1 {
+			return nil
+		}
+		step = fn.Steps[0]
+	}
+
+	name, _ := step.(*jparse.NameNode)
+	return name
+}
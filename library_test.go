@@ -0,0 +1,159 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompiler_RegisterLibrary(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.RegisterLibrary("text", map[string]string{
+		"clean": `function($s) { $uppercase($trim($s)) }`,
+	})
+	if err != nil {
+		t.Fatalf("RegisterLibrary failed: %v", err)
+	}
+
+	err = comp.RegisterLibrary("lib", map[string]string{
+		"normalizeAddress": `function($a) {
+			$join([$a.street, $text.clean($a.city)], ", ")
+		}`,
+		"fact":   `function($n) { $n <= 1 ? 1 : $n * $lib.fact($n - 1) }`,
+		"double": `λ($n)<n:n>{ $n * 2 }`,
+		"first":  `function() { items[0] }`,
+	})
+	if err != nil {
+		t.Fatalf("RegisterLibrary failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"addr": map[string]interface{}{
+			"street": "1 Main St",
+			"city":   " springfield ",
+		},
+		"items": []interface{}{3.0, 4.0},
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{
+			expr: `$lib.normalizeAddress(addr)`,
+			want: "1 Main St, SPRINGFIELD",
+		},
+		{
+			expr: `addr.$lib.normalizeAddress($)`,
+			want: "1 Main St, SPRINGFIELD",
+		},
+		{
+			expr: `$lib.fact(5)`,
+			want: 120.0,
+		},
+		{
+			expr: `$map(items, $lib.double)`,
+			want: []interface{}{6.0, 8.0},
+		},
+		{
+			expr: `addr.$lib.first()`,
+			want: 3.0,
+		},
+		{
+			expr: `($lib := {"fact": function($n){-$n}}; $lib.fact(5))`,
+			want: -5.0,
+		},
+	}
+
+	for _, test := range tests {
+		e, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		got, err := e.Eval(input, nil)
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+	}
+
+	e := comp.MustCompile(`$lib.double("x")`)
+	if _, err := e.Eval(nil, nil); err == nil {
+		t.Errorf("expected a type error calling $lib.double with a string")
+	}
+
+	// A variable passed to Eval replaces the library.
+	e = comp.MustCompile(`$lib`)
+	got, err := e.Eval(nil, map[string]interface{}{"lib": "var"})
+	if err != nil || got != "var" {
+		t.Errorf("expected the variable to replace the library, got %v (error %v)", got, err)
+	}
+}
+
+func TestCompiler_RegisterLibraryErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.RegisterLibrary("lib", map[string]string{
+		"ok": `function($x) { $x }`,
+	})
+	if err != nil {
+		t.Fatalf("RegisterLibrary failed: %v", err)
+	}
+
+	_, err = comp.Compile(`$lib.ok(1) + $lib.missing(2)`)
+
+	var cerr *CompileError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected a *CompileError, got %v", err)
+	}
+	if cerr.Token != "missing" || cerr.Position != 18 {
+		t.Errorf("expected the error at missing (18), got %q (%d)", cerr.Token, cerr.Position)
+	}
+
+	var lerr *LibraryFunctionError
+	if !errors.As(err, &lerr) || lerr.Library != "lib" || lerr.Name != "missing" {
+		t.Errorf("expected a *LibraryFunctionError for lib.missing, got %v", err)
+	}
+
+	if _, err := comp.Compile(`($lib := {}; $lib.missing(2))`); err != nil {
+		t.Errorf("expected an assigned name not to refer to the library, got %v", err)
+	}
+
+	for name, funcs := range map[string]map[string]string{
+		"bad name":   {"a-b": `function() { 1 }`},
+		"syntax":     {"f": `function( { 1 }`},
+		"not a func": {"f": `1 + 2`},
+		"reference":  {"f": `function() { $lib.ok(1) + $lib2.g() }`},
+	} {
+		if err := comp.RegisterLibrary("lib2", funcs); err == nil {
+			t.Errorf("%s: expected RegisterLibrary to fail", name)
+		}
+	}
+
+	// A module with the same name replaces the library.
+	if err := comp.RegisterModule("lib", nil); err != nil {
+		t.Fatalf("RegisterModule failed: %v", err)
+	}
+	if _, err := comp.Compile(`$lib.missing(2)`); err != nil {
+		t.Errorf("expected the module to replace the library, got %v", err)
+	}
+}
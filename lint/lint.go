@@ -0,0 +1,510 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+// Package lint reports likely bugs in JSONata expressions, such
+// as variables that are never used and predicates that never
+// match. The expressions are valid, so these problems don't stop
+// them from compiling, but they usually mean that an expression
+// doesn't do what its author intended.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	jsonata "github.com/iwongu/jsonata-go"
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// The checks that Lint runs.
+const (
+	// UnusedVariable reports variables that are assigned but
+	// never used. An assignment that is the last expression in
+	// a block isn't reported because it's the block's value.
+	UnusedVariable = "unused-variable"
+
+	// StringNumberComparison reports comparisons between a
+	// string literal and a number, e.g. age > "18". A string
+	// is never equal to a number, and ordering a string and a
+	// number is an error.
+	StringNumberComparison = "string-number-comparison"
+
+	// ShadowedFunction reports variables and function
+	// parameters that hide a built-in function or extension,
+	// e.g. $count := 0.
+	ShadowedFunction = "shadowed-function"
+
+	// AlwaysFalse reports predicates that never match, e.g.
+	// items[false] or items[type = "a" and type = "b"].
+	AlwaysFalse = "always-false"
+
+	// Deprecated reports uses of deprecated extensions (see
+	// jsonata.Extension.Deprecated).
+	Deprecated = "deprecated"
+)
+
+// A Problem is a likely bug in an expression.
+type Problem struct {
+	// Check is the check that found the problem, e.g.
+	// UnusedVariable.
+	Check   string
+	Message string
+
+	// Position is the byte offset of the problem in the
+	// expression. Line and Column are the 1-based line and
+	// column of the same location, with the column counted
+	// in characters.
+	Position int
+	Line     int
+	Column   int
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", p.Line, p.Column, p.Message, p.Check)
+}
+
+// Lint checks an expression for the problems described by the
+// checks above and returns them sorted by position. The built-in
+// functions and extensions are those of c, or the built-ins if c
+// is nil. If the expression isn't valid, Lint returns the error
+// from c.CompileAll.
+func Lint(c *jsonata.Compiler, expr string) ([]Problem, error) {
+
+	if c == nil {
+		var err error
+		if c, err = jsonata.NewCompiler(nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := c.CompileAll(expr); err != nil {
+		return nil, err
+	}
+
+	root, ranges, err := jparse.ParseRanges(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{
+		src:    expr,
+		ranges: ranges,
+		funcs:  map[string]jsonata.FunctionDoc{},
+	}
+
+	for _, doc := range c.FunctionDocs() {
+		l.funcs[doc.Name] = doc
+	}
+
+	l.push()
+	l.visitBody([]jparse.Node{root})
+	l.pop()
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		return l.problems[i].Position < l.problems[j].Position
+	})
+
+	return l.problems, nil
+}
+
+// Preflight is a jsonata.PreflightCheck that runs Lint and
+// reports each problem as a warning.
+func Preflight(c *jsonata.Compiler, expr string) []jsonata.PreflightIssue {
+
+	problems, err := Lint(c, expr)
+	if err != nil {
+		// PreflightAll reports expressions that don't compile.
+		return nil
+	}
+
+	issues := make([]jsonata.PreflightIssue, len(problems))
+	for i, p := range problems {
+		issues[i] = jsonata.PreflightIssue{
+			Check:    p.Check,
+			Message:  p.Message,
+			Warning:  true,
+			Position: p.Position,
+			Line:     p.Line,
+			Column:   p.Column,
+		}
+	}
+
+	return issues
+}
+
+type linter struct {
+	src      string
+	ranges   map[jparse.Node]jparse.Range
+	funcs    map[string]jsonata.FunctionDoc
+	scopes   []map[string]*binding
+	problems []Problem
+}
+
+// A binding is a variable assigned in a block or a function
+// parameter.
+type binding struct {
+	node   jparse.Node
+	used   bool
+	result bool
+	param  bool
+}
+
+func (l *linter) report(node jparse.Node, check, format string, a ...interface{}) {
+
+	p := Problem{
+		Check:    check,
+		Message:  fmt.Sprintf(format, a...),
+		Position: -1,
+	}
+
+	if r, ok := l.ranges[node]; ok {
+		p.Position = r.Start
+		before := l.src[:r.Start]
+		p.Line = 1 + strings.Count(before, "\n")
+		if i := strings.LastIndexByte(before, '\n'); i >= 0 {
+			before = before[i+1:]
+		}
+		p.Column = 1 + utf8.RuneCountInString(before)
+	}
+
+	l.problems = append(l.problems, p)
+}
+
+func (l *linter) push() {
+	l.scopes = append(l.scopes, map[string]*binding{})
+}
+
+// pop closes the innermost scope and reports the assignments
+// in it that were never used.
+func (l *linter) pop() {
+
+	scope := l.scopes[len(l.scopes)-1]
+	l.scopes = l.scopes[:len(l.scopes)-1]
+
+	for name, b := range scope {
+		if !b.used && !b.result && !b.param {
+			l.report(b.node, UnusedVariable, "$%s is assigned but never used", name)
+		}
+	}
+}
+
+// bind adds a variable to the innermost scope.
+func (l *linter) bind(name string, b *binding) {
+
+	if doc, ok := l.funcs[name]; ok && !l.isBound(name) {
+		kind := "extension"
+		if doc.Builtin {
+			kind = "built-in function"
+		}
+		l.report(b.node, ShadowedFunction, "$%s hides the %s $%s", name, kind, name)
+	}
+
+	l.scopes[len(l.scopes)-1][name] = b
+}
+
+// lookup returns the innermost binding of a variable, or nil.
+func (l *linter) lookup(name string) *binding {
+	for i := len(l.scopes) - 1; i >= 0; i-- {
+		if b, ok := l.scopes[i][name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (l *linter) isBound(name string) bool {
+	return l.lookup(name) != nil
+}
+
+// visitBody visits the expressions of a block, or the root
+// expression, in the current scope.
+func (l *linter) visitBody(exprs []jparse.Node) {
+	for i, expr := range exprs {
+		if a, ok := expr.(*jparse.AssignmentNode); ok {
+			l.visitAssignment(a, i == len(exprs)-1)
+			continue
+		}
+		l.visit(expr)
+	}
+}
+
+func (l *linter) visitAssignment(node *jparse.AssignmentNode, result bool) {
+
+	b := &binding{
+		node:   node,
+		result: result,
+	}
+
+	// A function can call itself, so it's bound before its
+	// body is visited. Other values can't refer to the
+	// variable that they're assigned to.
+	if isLambda(node.Value) {
+		l.bind(node.Name, b)
+		l.visit(node.Value)
+		return
+	}
+
+	l.visit(node.Value)
+	l.bind(node.Name, b)
+}
+
+func (l *linter) visit(node jparse.Node) {
+
+	switch node := node.(type) {
+	case *jparse.BlockNode:
+		l.push()
+		l.visitBody(node.Exprs)
+		l.pop()
+		return
+
+	case *jparse.AssignmentNode:
+		l.visitAssignment(node, true)
+		return
+
+	case *jparse.LambdaNode:
+		l.visitLambda(node, node)
+		return
+
+	case *jparse.TypedLambdaNode:
+		l.visitLambda(node, node.LambdaNode)
+		return
+
+	case *jparse.VariableNode:
+		l.visitVariable(node, node.Name)
+
+	case *jparse.PathNode:
+		l.checkModuleFunction(node)
+
+	case *jparse.ComparisonOperatorNode:
+		l.checkComparison(node)
+
+	case *jparse.PredicateNode:
+		for _, filter := range node.Filters {
+			l.checkPredicate(filter)
+		}
+	}
+
+	for _, child := range jparse.Children(node) {
+		l.visit(child)
+	}
+}
+
+func (l *linter) visitLambda(node jparse.Node, lambda *jparse.LambdaNode) {
+
+	l.push()
+	for _, name := range lambda.ParamNames {
+		l.bind(name, &binding{
+			node:  node,
+			param: true,
+		})
+	}
+	l.visit(lambda.Body)
+	l.pop()
+}
+
+func (l *linter) visitVariable(node jparse.Node, name string) {
+
+	if b := l.lookup(name); b != nil {
+		b.used = true
+		return
+	}
+
+	if doc, ok := l.funcs[name]; ok && doc.Deprecated != "" {
+		l.report(node, Deprecated, "$%s is deprecated: %s", name, doc.Deprecated)
+	}
+}
+
+// checkModuleFunction reports uses of deprecated functions in
+// extension modules, e.g. $str.pad.
+func (l *linter) checkModuleFunction(node *jparse.PathNode) {
+
+	if len(node.Steps) < 2 {
+		return
+	}
+
+	v, ok := node.Steps[0].(*jparse.VariableNode)
+	if !ok || l.isBound(v.Name) {
+		return
+	}
+
+	step := node.Steps[1]
+	if pred, ok := step.(*jparse.PredicateNode); ok {
+		step = pred.Expr
+	}
+
+	if call, ok := step.(*jparse.FunctionCallNode); ok {
+		step = call.Func
+	}
+	if path, ok := step.(*jparse.PathNode); ok && len(path.Steps) == 1 {
+		step = path.Steps[0]
+	}
+
+	name, ok := step.(*jparse.NameNode)
+	if !ok {
+		return
+	}
+
+	fn := v.Name + "." + name.Value
+	if doc, ok := l.funcs[fn]; ok && doc.Deprecated != "" {
+		l.report(node, Deprecated, "$%s is deprecated: %s", fn, doc.Deprecated)
+	}
+}
+
+func (l *linter) checkComparison(node *jparse.ComparisonOperatorNode) {
+
+	if node.Type == jparse.ComparisonIn {
+		return
+	}
+
+	s, ok := node.LHS.(*jparse.StringNode)
+	other := node.RHS
+	if !ok {
+		s, ok = node.RHS.(*jparse.StringNode)
+		other = node.LHS
+	}
+	if !ok || !l.isNumeric(other) {
+		return
+	}
+
+	switch node.Type {
+	case jparse.ComparisonEqual:
+		l.report(node, StringNumberComparison, "the string %q is never equal to a number", s.Value)
+	case jparse.ComparisonNotEqual:
+		l.report(node, StringNumberComparison, "the string %q is always different from a number", s.Value)
+	default:
+		l.report(node, StringNumberComparison, "comparing the string %q to a number with %s is an error", s.Value, node.Type)
+	}
+}
+
+// isNumeric reports whether an expression always returns a
+// number (or undefined).
+func (l *linter) isNumeric(node jparse.Node) bool {
+
+	switch node := node.(type) {
+	case *jparse.NumberNode, *jparse.NegationNode, *jparse.NumericOperatorNode:
+		return true
+	case *jparse.FunctionCallNode:
+		v, ok := node.Func.(*jparse.VariableNode)
+		return ok && numericFuncs[v.Name] && !l.isBound(v.Name)
+	default:
+		return false
+	}
+}
+
+// numericFuncs are the built-in functions that return numbers.
+var numericFuncs = map[string]bool{
+	"abs":      true,
+	"average":  true,
+	"ceil":     true,
+	"count":    true,
+	"floor":    true,
+	"length":   true,
+	"max":      true,
+	"millis":   true,
+	"min":      true,
+	"number":   true,
+	"power":    true,
+	"random":   true,
+	"round":    true,
+	"sqrt":     true,
+	"sum":      true,
+	"toMillis": true,
+}
+
+func (l *linter) checkPredicate(filter jparse.Node) {
+
+	if isConstant(filter) {
+		if r, ok := l.ranges[filter]; ok {
+			v, err := jsonata.Eval(l.src[r.Start:r.End], nil)
+			// Numbers are indexes and errors are reported
+			// when the expression is evaluated.
+			if err == jsonata.ErrUndefined || (err == nil && isFalsy(v)) {
+				l.report(filter, AlwaysFalse, "the predicate %s is always false", filter)
+			}
+		}
+		return
+	}
+
+	if b, ok := filter.(*jparse.BooleanOperatorNode); ok && b.Type == jparse.BooleanAnd {
+		lhs, lv, lok := equalsLiteral(b.LHS)
+		rhs, rv, rok := equalsLiteral(b.RHS)
+		if lok && rok && lhs == rhs && lv != rv {
+			l.report(filter, AlwaysFalse, "the predicate %s is always false: %s can't be both %s and %s", filter, lhs, lv, rv)
+		}
+	}
+}
+
+// isConstant reports whether an expression is made of literals
+// and operators only.
+func isConstant(node jparse.Node) bool {
+
+	switch node.(type) {
+	case *jparse.StringNode, *jparse.NumberNode, *jparse.BooleanNode, *jparse.NullNode,
+		*jparse.NegationNode, *jparse.NumericOperatorNode, *jparse.ComparisonOperatorNode,
+		*jparse.BooleanOperatorNode, *jparse.StringConcatenationNode, *jparse.ConditionalNode:
+	default:
+		return false
+	}
+
+	for _, child := range jparse.Children(node) {
+		if !isConstant(child) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isFalsy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	default:
+		return false
+	}
+}
+
+// equalsLiteral returns the operand and literal of a comparison
+// such as type = "a", if there is one.
+func equalsLiteral(node jparse.Node) (operand, literal string, ok bool) {
+
+	c, ok := node.(*jparse.ComparisonOperatorNode)
+	if !ok || c.Type != jparse.ComparisonEqual {
+		return "", "", false
+	}
+
+	lhs, rhs := c.LHS, c.RHS
+	if isLiteral(lhs) {
+		lhs, rhs = rhs, lhs
+	}
+	if !isLiteral(rhs) || isLiteral(lhs) {
+		return "", "", false
+	}
+
+	return lhs.String(), rhs.String(), true
+}
+
+func isLiteral(node jparse.Node) bool {
+	switch node.(type) {
+	case *jparse.StringNode, *jparse.NumberNode, *jparse.BooleanNode, *jparse.NullNode:
+		return true
+	default:
+		return false
+	}
+}
+
+func isLambda(node jparse.Node) bool {
+	switch node.(type) {
+	case *jparse.LambdaNode, *jparse.TypedLambdaNode:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package lint
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	jsonata "github.com/iwongu/jsonata-go"
+)
+
+func TestLint(t *testing.T) {
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{
+			expr: `($x := 1; $y := 2; $y)`,
+			want: []string{
+				"1:2: $x is assigned but never used (unused-variable)",
+			},
+		},
+		{
+			expr: `($f := function($n) { $n <= 1 ? 1 : $n * $f($n - 1) }; $f(5))`,
+		},
+		{
+			expr: `($x := 1)`,
+		},
+		{
+			expr: "price * 2 > \"18\" or\n$count(a) = \"3\"",
+			want: []string{
+				`1:1: comparing the string "18" to a number with > is an error (string-number-comparison)`,
+				`2:1: the string "3" is never equal to a number (string-number-comparison)`,
+			},
+		},
+		{
+			expr: `name = "18" or age > 18`,
+		},
+		{
+			expr: `($count := 0; $map(items, function($v, $sum) { $v + $count }))`,
+			want: []string{
+				"1:2: $count hides the built-in function $count (shadowed-function)",
+				"1:27: $sum hides the built-in function $sum (shadowed-function)",
+			},
+		},
+		{
+			expr: `[items[false], items[1 = 2], items[type = "a" and type = "b"], items[0], items[type = "a" and kind = "b"]]`,
+			want: []string{
+				"1:8: the predicate false is always false (always-false)",
+				"1:22: the predicate 1 = 2 is always false (always-false)",
+				`1:36: the predicate type = "a" and type = "b" is always false: type can't be both "a" and "b" (always-false)`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		problems, err := Lint(nil, test.expr)
+		if err != nil {
+			t.Errorf("%s: Lint failed: %v", test.expr, err)
+			continue
+		}
+
+		var got []string
+		for _, p := range problems {
+			got = append(got, p.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", test.expr, strings.Join(test.want, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestLint_Deprecated(t *testing.T) {
+
+	comp, err := jsonata.NewCompiler(nil, map[string]jsonata.Extension{
+		"repeat": {
+			Func:       strings.Repeat,
+			Deprecated: "use $pad",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.RegisterModule("str", map[string]jsonata.Extension{
+		"pad": {
+			Func:       func(s string, n int) string { return s },
+			Deprecated: "use $str.padStart",
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterModule failed: %v", err)
+	}
+
+	problems, err := Lint(comp, `$repeat("a", 2) & $str.pad("b", 3) & ($repeat := $uppercase; $repeat("c"))`)
+	if err != nil {
+		t.Fatalf("Lint failed: %v", err)
+	}
+
+	want := []Problem{
+		{
+			Check:    Deprecated,
+			Message:  "$repeat is deprecated: use $pad",
+			Position: 0,
+			Line:     1,
+			Column:   1,
+		},
+		{
+			Check:    Deprecated,
+			Message:  "$str.pad is deprecated: use $str.padStart",
+			Position: 18,
+			Line:     1,
+			Column:   19,
+		},
+		{
+			Check:    ShadowedFunction,
+			Message:  "$repeat hides the extension $repeat",
+			Position: 38,
+			Line:     1,
+			Column:   39,
+		},
+	}
+
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), problems)
+	}
+	for i := range want {
+		if problems[i] != want[i] {
+			t.Errorf("problem %d: expected %+v, got %+v", i, want[i], problems[i])
+		}
+	}
+}
+
+func TestLint_Invalid(t *testing.T) {
+
+	_, err := Lint(nil, `($x := ; $y := )`)
+
+	var errs jsonata.CompileErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Errorf("expected 2 CompileErrors, got %v", err)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+
+	report, err := jsonata.PreflightAll(map[string]string{
+		"a": `($x := 1; $y := 2; $y)`,
+		"b": `$count(items)`,
+		"c": `($x := ;)`,
+	}, &jsonata.PreflightOptions{
+		Checks: []jsonata.PreflightCheck{Preflight},
+	})
+	if err != nil {
+		t.Fatalf("PreflightAll failed: %v", err)
+	}
+
+	var got []string
+	for _, issue := range report.Issues {
+		got = append(got, issue.Check)
+	}
+
+	// The invalid expression is checked by PreflightAll, not
+	// Preflight.
+	want := []string{UnusedVariable, jsonata.PreflightCompile}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected issues %v, got %v", want, report.Issues)
+	}
+	if !report.Issues[0].Warning {
+		t.Errorf("expected lint problems to be warnings")
+	}
+}
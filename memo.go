@@ -0,0 +1,281 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// WithMemoization makes expressions compiled by the Compiler
+// evaluate repeated subexpressions once per context. If the same
+// function call, filter, sort, group or path (other than a plain
+// chain of names) appears more than once in an expression, such
+// as $count(Items) in
+//
+//	$count(Items) > 0 ? $count(Items) : "none"
+//
+// its result is cached the first time it's evaluated and reused
+// when it's evaluated again against the same context during the
+// same evaluation.
+//
+// Only pure subexpressions are cached: ones that don't assign
+// variables, define functions, or read variables that are
+// assigned anywhere in the expression, and that call nothing but
+// Go functions other than $random and $shuffle. Extensions and
+// the functions of custom operators (see RegisterOperator) are
+// assumed to return the same result each time they're called
+// with the same arguments during an evaluation, so one with side
+// effects may be called fewer times than it appears.
+func WithMemoization() CompilerOption {
+	return func(c *Compiler) error {
+		c.memoize = true
+		return nil
+	}
+}
+
+// A memoPlan records the repeated subexpressions of an
+// expression.
+type memoPlan struct {
+	nodes map[jparse.Node]memoExpr
+}
+
+// A memoExpr is a subexpression that can be cached. key is the
+// same for each occurrence of the subexpression and names are
+// the variables it reads.
+type memoExpr struct {
+	key   string
+	names []string
+}
+
+// compileMemoPlan returns the memoPlan for a syntax tree, or nil
+// if memoization is off or nothing in the tree is repeated.
+func compileMemoPlan(root jparse.Node, enabled bool) (*memoPlan, error) {
+
+	if !enabled {
+		return nil, nil
+	}
+
+	if err := checkPlanTree(root); err != nil {
+		return nil, err
+	}
+
+	bound := map[string]bool{}
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+		switch node := node.(type) {
+		case *jparse.AssignmentNode:
+			bound[node.Name] = true
+		case *jparse.LambdaNode:
+			for _, name := range node.ParamNames {
+				bound[name] = true
+			}
+		case *jparse.TypedLambdaNode:
+			for _, name := range node.ParamNames {
+				bound[name] = true
+			}
+		}
+		return true
+	})
+
+	nodes := map[jparse.Node]memoExpr{}
+	counts := map[string]int{}
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+		if expr, ok := newMemoExpr(node, bound); ok {
+			nodes[node] = expr
+			counts[expr.key]++
+		}
+		return true
+	})
+
+	for node, expr := range nodes {
+		if counts[expr.key] < 2 {
+			delete(nodes, node)
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	return &memoPlan{
+		nodes: nodes,
+	}, nil
+}
+
+// newMemoExpr returns the memoExpr for a node that can be cached.
+func newMemoExpr(node jparse.Node, bound map[string]bool) (memoExpr, bool) {
+
+	switch node := node.(type) {
+	case *jparse.PathNode:
+		if isNamePath(node.Steps) {
+			// Field lookups are cheaper than the cache.
+			return memoExpr{}, false
+		}
+	case *jparse.FunctionCallNode, *jparse.PredicateNode, *jparse.SortNode,
+		*jparse.GroupNode, *jparse.DescendentNode:
+	default:
+		return memoExpr{}, false
+	}
+
+	names, ok := parallelVars(node)
+	if !ok {
+		return memoExpr{}, false
+	}
+	for _, name := range names {
+		if bound[name] {
+			return memoExpr{}, false
+		}
+	}
+
+	return memoExpr{
+		key:   fmt.Sprintf("%T %s", node, node),
+		names: names,
+	}, true
+}
+
+// A memoCache holds the results of repeated subexpressions for
+// a single evaluation.
+type memoCache struct {
+	plan   *memoPlan
+	values map[memoEntryKey]memoEntry
+
+	// allowed records whether the variables read by a node
+	// are values or Go functions. They are the same for the
+	// whole evaluation because the expression doesn't assign
+	// them.
+	allowed map[jparse.Node]bool
+}
+
+type memoEntryKey struct {
+	key   string
+	input interface{}
+}
+
+// A memoEntry holds a cached result. The input is kept so that
+// its memory isn't reused by another value with the same
+// address during the evaluation.
+type memoEntry struct {
+	input reflect.Value
+	value reflect.Value
+}
+
+func newMemoCache(plan *memoPlan) *memoCache {
+	if plan == nil {
+		return nil
+	}
+	return &memoCache{
+		plan:    plan,
+		values:  map[memoEntryKey]memoEntry{},
+		allowed: map[jparse.Node]bool{},
+	}
+}
+
+func (c *memoCache) lookup(key memoEntryKey) (reflect.Value, bool) {
+	entry, ok := c.values[key]
+	return entry.value, ok
+}
+
+func (c *memoCache) store(key memoEntryKey, input, v reflect.Value) {
+	c.values[key] = memoEntry{
+		input: input,
+		value: v,
+	}
+}
+
+// memoNode returns the cache key for a node evaluated against
+// input, or a nil cache if the result can't be cached.
+func (s *environment) memoNode(node jparse.Node, input reflect.Value) (memoEntryKey, *memoCache) {
+
+	if s == nil || s.state == nil || s.state.memo == nil {
+		return memoEntryKey{}, nil
+	}
+
+	cache := s.state.memo
+	expr, ok := cache.plan.nodes[node]
+	if !ok {
+		return memoEntryKey{}, nil
+	}
+
+	allowed, ok := cache.allowed[node]
+	if !ok {
+		allowed = s.memoAllowed(expr.names)
+		cache.allowed[node] = allowed
+	}
+	if !allowed {
+		return memoEntryKey{}, nil
+	}
+
+	id, ok := memoIdentity(input)
+	if !ok {
+		return memoEntryKey{}, nil
+	}
+
+	return memoEntryKey{key: expr.key, input: id}, cache
+}
+
+// memoAllowed returns false if any of the named variables is a
+// function other than a Go function.
+func (s *environment) memoAllowed(names []string) bool {
+	for _, name := range names {
+		v := s.lookup(name)
+		if !v.IsValid() || !v.CanInterface() {
+			continue
+		}
+		switch v.Interface().(type) {
+		case *goCallable:
+		case jtypes.Callable, extensionModule:
+			return false
+		}
+	}
+	return true
+}
+
+// A memoRef identifies a map, slice or pointer by its address.
+type memoRef struct {
+	typ  reflect.Type
+	ptr  uintptr
+	size int
+}
+
+// memoIdentity returns a comparable value that identifies v
+// during an evaluation. ok is false for values that can't be
+// identified cheaply, such as structs.
+func memoIdentity(v reflect.Value) (id interface{}, ok bool) {
+
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		return nil, true
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type() == reflect.PtrTo(typeSequence) {
+			// Sequences grow while they're evaluated.
+			return nil, false
+		}
+		return memoRef{typ: v.Type(), ptr: v.Pointer()}, true
+	case reflect.Map:
+		return memoRef{typ: v.Type(), ptr: v.Pointer()}, true
+	case reflect.Slice:
+		return memoRef{typ: v.Type(), ptr: v.Pointer(), size: v.Len()}, true
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if v.CanInterface() {
+			return v.Interface(), true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,218 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+func TestMemoPlan(t *testing.T) {
+
+	data := []struct {
+		Expression string
+		Nodes      int
+	}{
+		{`$count(x) > 0 ? $count(x) : 0`, 2},
+		{`$count(x) > 0 ? $count(y) : 0`, 0},
+		{`a.b & a.b`, 0},
+		{`a[0] & a[0]`, 4},
+		{`[a^(b), a^(b).c]`, 2},
+		{`$sum(a.b) + $sum(a.b) + $count(a.b)`, 2},
+		{`$count($x) + $count($x)`, 2},
+		{`($x := 1; $count($x) + $count($x))`, 0},
+		{`function($v){ $count($v) + $count($v) }`, 0},
+		{`$random() + $random()`, 0},
+		{`$shuffle(a) & $shuffle(a)`, 0},
+		{`$f(a)(b) & $f(a)(b)`, 2},
+		{`$map(a, function($v){ $v }) & $map(a, function($v){ $v })`, 0},
+	}
+
+	for _, test := range data {
+
+		node, err := jparse.Parse(test.Expression)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Expression, err)
+		}
+
+		if plan, _ := compileMemoPlan(node, false); plan != nil {
+			t.Errorf("%s: expected no plan when memoization is off", test.Expression)
+		}
+
+		var n int
+		if plan, _ := compileMemoPlan(node, true); plan != nil {
+			n = len(plan.nodes)
+		}
+		if n != test.Nodes {
+			t.Errorf("%s: expected %d nodes, got %d", test.Expression, test.Nodes, n)
+		}
+	}
+}
+
+func TestCompiler_WithMemoization(t *testing.T) {
+
+	calls := map[string]int{}
+
+	exts := map[string]Extension{
+		"calls": {Func: func(s string) string {
+			calls[s]++
+			return s
+		}},
+	}
+
+	comp, err := NewCompiler(nil, exts, WithMemoization())
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"name":  "a",
+		"items": testParallelItems(3),
+	}
+
+	data := []struct {
+		Expression string
+		Calls      map[string]int
+	}{
+		{
+			// Repeated calls over the same context are made once.
+			`$calls(name) = "a" ? $calls(name) : "b"`,
+			map[string]int{"a": 1},
+		},
+		{
+			// Calls over different contexts are made once per
+			// context.
+			`items.($calls(id) & $calls(id))`,
+			map[string]int{"item000": 1, "item001": 1, "item002": 1},
+		},
+		{
+			`[$calls(name), items.$calls(id), $calls(name)]`,
+			map[string]int{"a": 1, "item000": 1, "item001": 1, "item002": 1},
+		},
+		{
+			// Variables that are assigned in the expression
+			// aren't cached.
+			`($n := name; $calls($n) & $calls($n))`,
+			map[string]int{"a": 2},
+		},
+		{
+			// Neither are calls to user-defined functions.
+			`($f := function($s){ $calls($s) }; $f(name) & $f(name))`,
+			map[string]int{"a": 2},
+		},
+	}
+
+	for _, test := range data {
+
+		for k := range calls {
+			delete(calls, k)
+		}
+
+		if _, err := comp.MustCompile(test.Expression).Eval(input, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.Expression, err)
+		}
+		if !reflect.DeepEqual(calls, test.Calls) {
+			t.Errorf("%s: expected calls %v, got %v", test.Expression, test.Calls, calls)
+		}
+	}
+
+	// Each evaluation has its own cache.
+	for k := range calls {
+		delete(calls, k)
+	}
+	e := comp.MustCompile(`$calls(name) & $calls(name)`)
+	for i := 0; i < 2; i++ {
+		if _, err := e.Eval(input, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if calls["a"] != 2 {
+		t.Errorf("expected 2 calls over 2 evaluations, got %d", calls["a"])
+	}
+}
+
+func TestCompiler_WithMemoization_Results(t *testing.T) {
+
+	plain, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	memo, err := NewCompiler(nil, nil, WithMemoization())
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"items": testParallelItems(20),
+		"empty": []interface{}{},
+	}
+
+	exprs := []string{
+		`$count(items) > 0 ? $count(items) : 0`,
+		`$count(empty) > 0 ? $count(empty) : "none"`,
+		`items[qty > 2].id & "," & $join(items[qty > 2].id, ",")`,
+		`items.($count(tags) + $count(tags))`,
+		`items.(sub.x % 2 = 0 ? $string(sub.x) : $string(sub.x) & "!")`,
+		`[items^(>price)[0].id, items^(>price)[-1].id]`,
+		`items{$string(qty): $sum(price)}.* ~> $keys() ~> $count()`,
+		`$sum(items.**.x) / $count(items.**.x)`,
+		`$map(items, function($v){ $count($v.tags) + $count($v.tags) })`,
+		`items.(tags[0] = tags[0])`,
+		`$count(missing) + $count(missing)`,
+		`$substring(items[0].id, 1) & $substring(items[0].id, 1)`,
+	}
+
+	for _, expr := range exprs {
+
+		want, wantErr := plain.MustCompile(expr).Eval(input, nil)
+		got, gotErr := memo.MustCompile(expr).Eval(input, nil)
+
+		if !reflect.DeepEqual(gotErr, wantErr) {
+			t.Errorf("%s: expected error %v, got %v", expr, wantErr, gotErr)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", expr, want, got)
+		}
+	}
+}
+
+func BenchmarkMemoization(b *testing.B) {
+
+	input := map[string]interface{}{
+		"items": testParallelItems(1000),
+	}
+
+	for _, memoize := range []bool{false, true} {
+
+		var opts []CompilerOption
+		if memoize {
+			opts = append(opts, WithMemoization())
+		}
+
+		comp, err := NewCompiler(nil, nil, opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		e := comp.MustCompile(`$count(items[qty > 2]) > 0 ? $sum(items[qty > 2].price) / $count(items[qty > 2]) : 0`)
+
+		name := "off"
+		if memoize {
+			name = "on"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := e.Eval(input, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// A Warning is a problem that an evaluation recovered from (see
+// WithMissingFunctions).
+type Warning struct {
+	// Message describes the problem.
+	Message string
+
+	// Func is the name of the function that the warning is
+	// about, without the leading $.
+	Func string
+
+	// Position is the byte offset of the problem in the
+	// expression, or -1 if it isn't known.
+	Position int
+
+	// EvalID is the evaluation's ID, if it has one (see
+	// WithEvalID).
+	EvalID string
+}
+
+func (w Warning) String() string {
+	s := w.Message
+	if w.Position >= 0 {
+		s = fmt.Sprintf("%s at position %d", s, w.Position)
+	}
+	if w.EvalID != "" {
+		s = fmt.Sprintf("[%s] %s", w.EvalID, s)
+	}
+	return s
+}
+
+// WithMissingFunctions makes calls to functions that aren't
+// defined, such as extensions from an optional module that isn't
+// registered, return undefined instead of failing, so that one
+// set of expressions can run where only some of their extensions
+// are available. Each such call is reported to warn, which may
+// be nil. warn may be called from more than one goroutine at a
+// time (see WithParallelism).
+//
+// Only names that aren't bound at all are treated like this. A
+// call to a variable that holds a value other than a function,
+// or that holds undefined, e.g. a lambda parameter that wasn't
+// passed, still fails.
+func WithMissingFunctions(warn func(Warning)) CompilerOption {
+	return func(c *Compiler) error {
+		if warn == nil {
+			warn = func(Warning) {}
+		}
+		c.missingFuncs = warn
+		return nil
+	}
+}
+
+// missingFunc returns true if fn is a variable that isn't bound
+// and missing functions are allowed, in which case it reports a
+// warning for the call.
+func (s *environment) missingFunc(fn jparse.Node, v reflect.Value) bool {
+
+	if v != undefined || s.state == nil || s.state.missingFuncs == nil {
+		return false
+	}
+
+	sym, ok := fn.(*jparse.VariableNode)
+	if !ok || sym.Name == "" || s.isBound(sym.Name) {
+		return false
+	}
+
+	w := Warning{
+		Message:  fmt.Sprintf("function $%s is not defined", sym.Name),
+		Func:     sym.Name,
+		Position: -1,
+		EvalID:   EvalID(s.state.context),
+	}
+	if r, ok := s.state.ranges[fn]; ok {
+		w.Position = r.Start
+	}
+
+	s.state.missingFuncs(w)
+	return true
+}
+
+// isBound returns true if name is bound in the environment or
+// one of its parents.
+func (s *environment) isBound(name string) bool {
+	for ; s != nil; s = s.parent {
+		if _, ok := s.symbols[name]; ok {
+			return true
+		}
+	}
+	return false
+}
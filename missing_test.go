@@ -0,0 +1,163 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompiler_WithMissingFunctions(t *testing.T) {
+
+	var warnings []Warning
+	comp, err := NewCompiler(nil, nil, WithMissingFunctions(func(w Warning) {
+		warnings = append(warnings, w)
+	}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	data := []struct {
+		Expression string
+		Output     interface{}
+		Warnings   []Warning
+	}{
+		{
+			Expression: `$geoDistance(a, b)`,
+			Output:     nil,
+			Warnings: []Warning{
+				{Message: "function $geoDistance is not defined", Func: "geoDistance", Position: 0},
+			},
+		},
+		{
+			Expression: `{"name": name, "region": $lookupRegion(zip)}`,
+			Output:     map[string]interface{}{"name": "Ann"},
+			Warnings: []Warning{
+				{Message: "function $lookupRegion is not defined", Func: "lookupRegion", Position: 25},
+			},
+		},
+		{
+			Expression: `name ~> $uppercase ~> $translate`,
+			Output:     nil,
+			Warnings: []Warning{
+				{Message: "function $translate is not defined", Func: "translate", Position: 22},
+			},
+		},
+		{
+			Expression: `$exists($enrich(name)) ? "enriched" : "plain"`,
+			Output:     "plain",
+			Warnings: []Warning{
+				{Message: "function $enrich is not defined", Func: "enrich", Position: 8},
+			},
+		},
+		{
+			Expression: `$uppercase(name)`,
+			Output:     "ANN",
+		},
+	}
+
+	input := map[string]interface{}{
+		"name": "Ann",
+		"zip":  "02134",
+	}
+
+	for _, test := range data {
+
+		warnings = nil
+
+		got, err := comp.MustCompile(test.Expression).Eval(input, nil)
+		if err != nil && err != ErrUndefined {
+			t.Errorf("%s: unexpected error: %v", test.Expression, err)
+		}
+		if !reflect.DeepEqual(got, test.Output) {
+			t.Errorf("%s: expected %v, got %v", test.Expression, test.Output, got)
+		}
+		if !reflect.DeepEqual(warnings, test.Warnings) {
+			t.Errorf("%s: expected warnings %v, got %v", test.Expression, test.Warnings, warnings)
+		}
+	}
+
+	// Warnings carry the evaluation ID.
+	warnings = nil
+	ctx := WithEvalID(context.Background(), "req-3")
+	if _, err := comp.MustCompile(`$missing()`).EvalContext(ctx, nil, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].EvalID != "req-3" {
+		t.Errorf("expected a warning with the ID req-3, got %v", warnings)
+	} else if s := warnings[0].String(); s != "[req-3] function $missing is not defined at position 0" {
+		t.Errorf("unexpected warning text %q", s)
+	}
+
+	// Calls to bound names that aren't functions still fail.
+	for _, expr := range []string{
+		`($x := 1; $x())`,
+		`($f := function($g) { $g() }; $f())`,
+	} {
+		warnings = nil
+
+		var eerr *EvalError
+		_, err := comp.MustCompile(expr).Eval(nil, nil)
+		if !errors.As(err, &eerr) || eerr.Type != ErrNonCallable {
+			t.Errorf("%s: expected ErrNonCallable, got %v", expr, err)
+		}
+		if len(warnings) != 0 {
+			t.Errorf("%s: expected no warnings, got %v", expr, warnings)
+		}
+	}
+
+	// Without the option, missing functions are errors.
+	comp, err = NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	var eerr *EvalError
+	if _, err := comp.MustCompile(`$missing()`).Eval(nil, nil); !errors.As(err, &eerr) || eerr.Type != ErrNonCallable {
+		t.Errorf("expected ErrNonCallable, got %v", err)
+	}
+
+	// A nil warn function is allowed.
+	comp, err = NewCompiler(nil, nil, WithMissingFunctions(nil))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	if _, err := comp.MustCompile(`$missing()`).Eval(nil, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
+
+func TestPreflightAll_MissingFunctions(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil, WithMissingFunctions(nil))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	report, err := PreflightAll(map[string]string{
+		"call":    `$enrich(name)`,
+		"partial": `$enrich(?, 1)`,
+	}, &PreflightOptions{Compiler: comp})
+	if err != nil {
+		t.Fatalf("PreflightAll failed: %v", err)
+	}
+
+	warnings := map[string]bool{}
+	for _, issue := range report.Issues {
+		warnings[issue.Name] = issue.Warning
+	}
+
+	// Missing functions that are called are warnings but
+	// partial applications of them are still errors.
+	want := map[string]bool{
+		"call":    true,
+		"partial": false,
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("expected issues %v, got %v", want, report.Issues)
+	}
+}
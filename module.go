@@ -0,0 +1,243 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// RegisterModule registers a group of extension functions under a
+// single variable name, so that an expression can call them as
+// $name.func(args). For example, after
+//
+//	c.RegisterModule("str", map[string]Extension{
+//		"slug": {Func: slugify},
+//	})
+//
+// the expression $str.slug(title) calls slugify with the value of
+// title in the current context. A module function can also be
+// passed to other functions without calling it, e.g.
+// $map(titles, $str.slug).
+//
+// A module replaces any variable, extension or module with the
+// same name. It applies to expressions compiled after it is
+// registered: calls such as $str.slug(title) are resolved when
+// an expression is compiled, unless the expression assigns the
+// module name itself. RegisterModule must not be called at the
+// same time as Compile.
+func (c *Compiler) RegisterModule(name string, exts map[string]Extension) error {
+
+	if c.frozen {
+		return errDefaultFrozen()
+	}
+
+	if !validName(name) {
+		return fmt.Errorf("%s is not a valid module name", name)
+	}
+
+	mod := make(extensionModule, len(exts))
+
+	for fn, ext := range exts {
+
+		if !validName(fn) {
+			return fmt.Errorf("%s.%s is not a valid name", name, fn)
+		}
+
+		callable, err := newGoCallable(name+"."+fn, ext)
+		if err != nil {
+			return fmt.Errorf("%s.%s is not a valid function: %s", name, fn, err)
+		}
+		callable.isExtension = true
+
+		mod[fn] = callable
+	}
+
+	c.setBase(name, reflect.ValueOf(mod))
+	return nil
+}
+
+// WithModule registers an extension module, as RegisterModule
+// does. It's for configuring compilers that are only set up
+// with options, such as the default compiler (see
+// RegisterDefault).
+func WithModule(name string, exts map[string]Extension) CompilerOption {
+	return func(c *Compiler) error {
+		return c.RegisterModule(name, exts)
+	}
+}
+
+// An extensionModule maps the names of the functions in a module
+// to their callables. It behaves like an object whose values are
+// functions, so $name.func evaluates to a function.
+type extensionModule map[string]interface{}
+
+// clone returns a copy of the module for use in env. See
+// environment.cloneGoCallable.
+func (m extensionModule) clone(env *environment) extensionModule {
+
+	cm := make(extensionModule, len(m))
+
+	for name, v := range m {
+		if gc, ok := v.(*goCallable); ok {
+			v = env.cloneGoCallable(gc)
+		}
+		cm[name] = v
+	}
+
+	return cm
+}
+
+// moduleNames returns the names of the compiler's modules and
+// libraries.
+func (c *Compiler) moduleNames() map[string]bool {
+
+	names := make(map[string]bool, len(c.libraries))
+
+	for name, v := range c.baseRegistry {
+		if v.IsValid() && v.Type() == typeExtensionModule {
+			names[name] = true
+		}
+	}
+	for name := range c.libraries {
+		names[name] = true
+	}
+
+	return names
+}
+
+// resolveModuleCalls merges each call to a module function in a
+// syntax tree, such as $str.slug(name) where $str is one of
+// modules, into a single path step. Without this, the call would
+// be evaluated in the context of the module rather than the
+// context of the path. Calls are left alone if the expression
+// binds the module's name to something else. The tree and its
+// ranges are modified in place.
+func resolveModuleCalls(node jparse.Node, ranges map[jparse.Node]jparse.Range, modules map[string]bool) {
+
+	if len(modules) == 0 {
+		return
+	}
+
+	bound := map[string]bool{}
+	jparse.Walk(node, func(n jparse.Node) bool {
+		switch n := n.(type) {
+		case *jparse.AssignmentNode:
+			bound[n.Name] = true
+		case *jparse.LambdaNode:
+			for _, name := range n.ParamNames {
+				bound[name] = true
+			}
+		}
+		return true
+	})
+
+	r := moduleResolver{
+		modules: modules,
+		bound:   bound,
+		ranges:  ranges,
+	}
+
+	jparse.Walk(node, func(n jparse.Node) bool {
+		switch n := n.(type) {
+		case *jparse.PathNode:
+			n.Steps = r.steps(n.Steps)
+		case *jparse.FunctionApplicationNode:
+			// e.g. name ~> $str.slug()
+			if path, ok := n.RHS.(*jparse.PathNode); ok && len(path.Steps) == 2 {
+				if call, ok := r.call(path.Steps, 0).(*jparse.FunctionCallNode); ok {
+					n.RHS = call
+				}
+			}
+		}
+		return true
+	})
+}
+
+type moduleResolver struct {
+	modules map[string]bool
+	bound   map[string]bool
+	ranges  map[jparse.Node]jparse.Range
+}
+
+// steps returns path steps with each module function call merged
+// into a single step.
+func (r moduleResolver) steps(steps []jparse.Node) []jparse.Node {
+
+	for i := 0; i < len(steps)-1; i++ {
+
+		call := r.call(steps, i)
+		if call == nil {
+			continue
+		}
+
+		merged := make([]jparse.Node, 0, len(steps)-1)
+		merged = append(merged, steps[:i]...)
+		merged = append(merged, call)
+		steps = append(merged, steps[i+2:]...)
+	}
+
+	return steps
+}
+
+// call returns the module function call made by the path steps
+// at i and i+1 as a single step, or nil if there isn't one. The
+// step is a function call or, if the call is filtered, a
+// predicate. The call's function becomes the path $name.func.
+func (r moduleResolver) call(steps []jparse.Node, i int) jparse.Node {
+
+	v, ok := steps[i].(*jparse.VariableNode)
+	if !ok || !r.modules[v.Name] || r.bound[v.Name] {
+		return nil
+	}
+
+	step := steps[i+1]
+	if pred, ok := step.(*jparse.PredicateNode); ok {
+		// e.g. $str.words(title)[0]
+		step = pred.Expr
+	}
+
+	call, ok := step.(*jparse.FunctionCallNode)
+	if !ok {
+		return nil
+	}
+
+	fn, ok := call.Func.(*jparse.PathNode)
+	if !ok || len(fn.Steps) != 1 {
+		return nil
+	}
+	name, ok := fn.Steps[0].(*jparse.NameNode)
+	if !ok {
+		return nil
+	}
+
+	path := &jparse.PathNode{
+		Steps: []jparse.Node{v, name},
+	}
+	call.Func = path
+
+	// The call and the new path start at the module name.
+	r.extend(path, v, name)
+	r.extend(call, v, call)
+	r.extend(steps[i+1], v, steps[i+1])
+
+	return steps[i+1]
+}
+
+// extend sets the range of node to run from the start of first
+// to the end of last, if they have ranges.
+func (r moduleResolver) extend(node, first, last jparse.Node) {
+
+	start, ok1 := r.ranges[first]
+	end, ok2 := r.ranges[last]
+
+	if ok1 && ok2 {
+		r.ranges[node] = jparse.Range{Start: start.Start, End: end.End}
+	}
+}
+
+var typeExtensionModule = reflect.TypeOf(extensionModule(nil))
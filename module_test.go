@@ -0,0 +1,193 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompiler_RegisterModule(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.RegisterModule("str", map[string]Extension{
+		"slug": {
+			Func: func(s string) string {
+				return strings.ToLower(strings.Join(strings.Fields(s), "-"))
+			},
+		},
+		"words": {
+			Func: strings.Fields,
+		},
+		"trim": {
+			Func:      strings.TrimSpace,
+			Signature: "<s-:s>",
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterModule failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"title": "Hello Big World",
+		"posts": []interface{}{
+			map[string]interface{}{"title": "First Post"},
+			map[string]interface{}{"title": "  Second Post "},
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{
+			expr: `$str.slug(title)`,
+			want: "hello-big-world",
+		},
+		{
+			expr: `posts.$str.slug(title)`,
+			want: []interface{}{"first-post", "second-post"},
+		},
+		{
+			expr: `$map(posts.title, $str.slug)`,
+			want: []interface{}{"first-post", "second-post"},
+		},
+		{
+			expr: `title ~> $str.slug()`,
+			want: "hello-big-world",
+		},
+		{
+			expr: `$str.words(title)[1]`,
+			want: "Big",
+		},
+		{
+			expr: `$str.words(title).$length($)`,
+			want: []interface{}{5, 3, 5},
+		},
+		{
+			expr: `posts[1].title.$str.trim()`,
+			want: "Second Post",
+		},
+		{
+			expr: `($str := {"slug": function($s){$s & "!"}}; $str.slug("x"))`,
+			want: "x!",
+		},
+	}
+
+	for _, test := range tests {
+
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		got, err := expr.Eval(input, nil)
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+	}
+
+	expr, err := comp.Compile(`$str.shout(title)`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if _, err := expr.Eval(input, nil); err == nil || !strings.Contains(err.Error(), "$str.shout") {
+		t.Errorf("expected error for unknown function, got %v", err)
+	}
+}
+
+func TestCompiler_RegisterModuleProfile(t *testing.T) {
+
+	p := NewProfile()
+
+	comp, err := NewCompiler(nil, nil, WithProfile(p))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.RegisterModule("str", map[string]Extension{
+		"upper": {Func: strings.ToUpper},
+	})
+	if err != nil {
+		t.Fatalf("RegisterModule failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"posts": []interface{}{
+			map[string]interface{}{"title": "a"},
+			map[string]interface{}{"title": "b"},
+		},
+	}
+
+	// Module calls are resolved when the expression is compiled,
+	// so each evaluation uses the same nodes, with their source
+	// ranges.
+	e := comp.MustCompile(`posts.$str.upper(title)`)
+	for i := 0; i < 2; i++ {
+		if _, err := e.Eval(input, nil); err != nil {
+			t.Fatalf("Eval failed: %v", err)
+		}
+	}
+
+	var calls []ProfileNode
+	for _, node := range p.Report().Nodes {
+		if node.Type == "FunctionCall" {
+			calls = append(calls, node)
+		}
+	}
+	if len(calls) != 1 {
+		t.Fatalf("expected one function call, got %+v", calls)
+	}
+	if c := calls[0]; c.Expr != "$str.upper(title)" || c.Start != 6 || c.Count != 4 {
+		t.Errorf("unexpected function call %+v", c)
+	}
+}
+
+func TestCompiler_RegisterModuleErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		exts map[string]Extension
+		want string
+	}{
+		{
+			name: "a.b",
+			want: "a.b is not a valid module name",
+		},
+		{
+			name: "str",
+			exts: map[string]Extension{"sl-ug": {Func: strings.ToLower}},
+			want: "str.sl-ug is not a valid name",
+		},
+		{
+			name: "str",
+			exts: map[string]Extension{"slug": {Func: "lower"}},
+			want: "str.slug is not a valid function: ",
+		},
+	}
+
+	for _, test := range tests {
+		err := comp.RegisterModule(test.name, test.exts)
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: expected error %q, got %v", test.name, test.want, err)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// NormalizeOptions control the output of Normalize.
+type NormalizeOptions struct {
+	// JSONNumbers converts numbers to json.Number instead of
+	// float64. Integers are formatted exactly, without an
+	// exponent, so a large int64 keeps all of its digits.
+	JSONNumbers bool
+
+	// OrderedObjects converts objects to OrderedObjects with
+	// their members sorted by key, instead of to maps.
+	OrderedObjects bool
+
+	// CollapseSingletons replaces arrays that contain exactly
+	// one value with the value itself, at every level.
+	CollapseSingletons bool
+}
+
+// An OrderedObject is an object whose members are in a fixed
+// order. It's marshalled to JSON in that order.
+type OrderedObject []ObjectMember
+
+// An ObjectMember is a name/value pair in an OrderedObject.
+type ObjectMember struct {
+	Key   string
+	Value interface{}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o OrderedObject) MarshalJSON() ([]byte, error) {
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	for i, m := range o {
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		value, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Normalize converts a result from Eval to a generic form that
+// doesn't depend on the types used by the evaluator or by the
+// input data. The result contains only:
+//
+//   - nil, for null
+//   - bool
+//   - string
+//   - float64, or json.Number if opts.JSONNumbers is set
+//   - []interface{}
+//   - map[string]interface{}, or OrderedObject if
+//     opts.OrderedObjects is set
+//
+// Go structs are converted to objects in the same way that the
+// evaluator reads them (see jtypes.StructFieldNames) and times
+// are converted to ISO 8601 strings. Functions, channels,
+// numbers that JSON can't represent, such as NaN, and values
+// that contain themselves (see CycleError) are errors. A nil
+// opts is the same as a zero NormalizeOptions.
+func Normalize(result interface{}, opts *NormalizeOptions) (interface{}, error) {
+	if opts == nil {
+		opts = &NormalizeOptions{}
+	}
+	return normalize(reflect.ValueOf(result), opts, &cycleChecker{})
+}
+
+var typeJSONNumber = reflect.TypeOf(json.Number(""))
+
+func normalize(v reflect.Value, opts *NormalizeOptions, cycles *cycleChecker) (interface{}, error) {
+
+	v = jtypes.ConvertTime(v)
+
+	if err := cycles.enter(v); err != nil {
+		return nil, err
+	}
+	defer cycles.leave(v)
+
+	v = jtypes.Resolve(v)
+
+	if !v.IsValid() || isNilValue(v) {
+		return nil, nil
+	}
+
+	if v.Type() == typeJSONNumber {
+		return normalizedJSONNumber(json.Number(v.String()), opts)
+	}
+
+	switch {
+	case jtypes.IsCallable(v):
+		return nil, fmt.Errorf("cannot normalize a function")
+	case jtypes.IsBool(v):
+		return v.Bool(), nil
+	case jtypes.IsString(v):
+		return v.String(), nil
+	case jtypes.IsNumber(v):
+		return normalizedNumber(v, opts)
+	case jtypes.IsArray(v):
+		return normalizedArray(v, opts, cycles)
+	case jtypes.IsMap(v):
+		return normalizedMap(v, opts, cycles)
+	case jtypes.IsStruct(v):
+		return normalizedStruct(v, opts, cycles)
+	default:
+		return nil, fmt.Errorf("cannot normalize a value of type %s", v.Type())
+	}
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+func normalizedNumber(v reflect.Value, opts *NormalizeOptions) (interface{}, error) {
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if opts.JSONNumbers {
+			return json.Number(strconv.FormatInt(v.Int(), 10)), nil
+		}
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if opts.JSONNumbers {
+			return json.Number(strconv.FormatUint(v.Uint(), 10)), nil
+		}
+		return float64(v.Uint()), nil
+	}
+
+	n := v.Float()
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return nil, fmt.Errorf("cannot normalize the number %v", n)
+	}
+
+	if opts.JSONNumbers {
+		return json.Number(formatJSONNumber(n)), nil
+	}
+
+	return n, nil
+}
+
+func normalizedJSONNumber(n json.Number, opts *NormalizeOptions) (interface{}, error) {
+
+	if opts.JSONNumbers {
+		return n, nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("cannot normalize the number %q", n)
+	}
+
+	return f, nil
+}
+
+// formatJSONNumber formats whole numbers below 1e21 without an
+// exponent, like JSON.stringify, and other numbers in the
+// shortest form that round-trips.
+func formatJSONNumber(n float64) string {
+	if n == math.Trunc(n) && math.Abs(n) < 1e21 {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+func normalizedArray(v reflect.Value, opts *NormalizeOptions, cycles *cycleChecker) (interface{}, error) {
+
+	results := make([]interface{}, v.Len())
+
+	for i := range results {
+		res, err := normalize(v.Index(i), opts, cycles)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = res
+	}
+
+	if opts.CollapseSingletons && len(results) == 1 {
+		return results[0], nil
+	}
+
+	return results, nil
+}
+
+func normalizedMap(v reflect.Value, opts *NormalizeOptions, cycles *cycleChecker) (interface{}, error) {
+
+	members := make(OrderedObject, 0, v.Len())
+
+	for _, k := range v.MapKeys() {
+
+		key, ok := jtypes.AsString(k)
+		if !ok {
+			return nil, fmt.Errorf("object key must be a string, got %v (%s)", k, k.Kind())
+		}
+
+		value, err := normalize(v.MapIndex(k), opts, cycles)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, ObjectMember{key, value})
+	}
+
+	return newObject(members, opts), nil
+}
+
+func normalizedStruct(v reflect.Value, opts *NormalizeOptions, cycles *cycleChecker) (interface{}, error) {
+
+	members := OrderedObject{}
+	var err error
+
+	jtypes.EachStructField(v, func(name string, v reflect.Value) {
+		if err != nil {
+			return
+		}
+		var value interface{}
+		value, err = normalize(v, opts, cycles)
+		members = append(members, ObjectMember{name, value})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newObject(members, opts), nil
+}
+
+func newObject(members OrderedObject, opts *NormalizeOptions) interface{} {
+
+	if opts.OrderedObjects {
+		sort.Slice(members, func(i, j int) bool {
+			return members[i].Key < members[j].Key
+		})
+		return members
+	}
+
+	m := make(map[string]interface{}, len(members))
+	for _, mem := range members {
+		m[mem.Key] = mem.Value
+	}
+
+	return m
+}
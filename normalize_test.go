@@ -0,0 +1,160 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testNormalizeItem struct {
+	Name    string    `json:"name"`
+	Count   int64     `json:"count"`
+	Created time.Time `json:"created"`
+	Hidden  bool      `json:"-"`
+}
+
+func TestNormalize(t *testing.T) {
+
+	created := time.Date(2017, 5, 15, 15, 12, 59, 152000000, time.UTC)
+
+	input := map[string]interface{}{
+		"b":     []int{1, 2},
+		"a":     uint8(7),
+		"null":  (*interface{})(nil),
+		"num":   json.Number("1.5"),
+		"items": []testNormalizeItem{{Name: "x", Count: 1<<53 + 1, Created: created}},
+		"one":   []interface{}{map[string]interface{}{"z": []string{"s"}}},
+	}
+
+	tests := []struct {
+		opts *NormalizeOptions
+		want interface{}
+	}{
+		{
+			opts: nil,
+			want: map[string]interface{}{
+				"b":    []interface{}{float64(1), float64(2)},
+				"a":    float64(7),
+				"null": nil,
+				"num":  1.5,
+				"items": []interface{}{
+					map[string]interface{}{
+						"name":    "x",
+						"count":   float64(1<<53 + 1),
+						"created": "2017-05-15T15:12:59.152Z",
+					},
+				},
+				"one": []interface{}{
+					map[string]interface{}{"z": []interface{}{"s"}},
+				},
+			},
+		},
+		{
+			opts: &NormalizeOptions{
+				JSONNumbers:        true,
+				OrderedObjects:     true,
+				CollapseSingletons: true,
+			},
+			want: OrderedObject{
+				{"a", json.Number("7")},
+				{"b", []interface{}{json.Number("1"), json.Number("2")}},
+				{"items", OrderedObject{
+					{"count", json.Number("9007199254740993")},
+					{"created", "2017-05-15T15:12:59.152Z"},
+					{"name", "x"},
+				}},
+				{"null", nil},
+				{"num", json.Number("1.5")},
+				{"one", OrderedObject{
+					{"z", "s"},
+				}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		got, err := Normalize(input, test.opts)
+		if err != nil {
+			t.Fatalf("%+v: Normalize failed: %v", test.opts, err)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: expected %#v, got %#v", test.opts, test.want, got)
+		}
+	}
+}
+
+func TestNormalizeEvalResult(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	expr, err := comp.Compile(`{"total": $sum(prices), "big": 1e21, "tags": ["b", "a"], "n": null}`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	res, err := expr.Eval(map[string]interface{}{"prices": []int{1, 2}}, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	got, err := Normalize(res, &NormalizeOptions{
+		JSONNumbers:    true,
+		OrderedObjects: true,
+	})
+	if err != nil {
+		t.Fatalf("Normalize failed: %v", err)
+	}
+
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	exp := `{"big":1e+21,"n":null,"tags":["b","a"],"total":3}`
+	if string(b) != exp {
+		t.Errorf("expected %s, got %s", exp, b)
+	}
+}
+
+func TestNormalizeErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	expr, err := comp.Compile(`{"f": function($x) { $x }}`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	fn, err := expr.Eval(nil, nil)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	data := []interface{}{
+		fn,
+		math.NaN(),
+		[]float64{math.Inf(1)},
+		map[int]string{1: "one"},
+		make(chan int),
+	}
+
+	for _, v := range data {
+		if _, err := Normalize(v, nil); err == nil {
+			t.Errorf("%v: expected error", v)
+		}
+	}
+}
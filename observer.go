@@ -0,0 +1,152 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// An EvalObserver is told about the evaluations of expressions,
+// e.g. to record them in a tracing system (see the jotel package
+// for OpenTelemetry). Its methods may be called from more than
+// one goroutine at a time.
+//
+// The Start methods return the context for the rest of the
+// evaluation or call, which is passed to the matching End method
+// and is the parent context of nested calls. It must be derived
+// from the context that the Start method is given.
+// Extensions that take a context.Context get the context
+// returned by StartEval.
+type EvalObserver interface {
+	// StartEval is called before an evaluation starts.
+	StartEval(ctx context.Context, info *EvalInfo) context.Context
+
+	// EndEval is called when the evaluation is finished. err
+	// is the error that the evaluation returns, if any.
+	EndEval(ctx context.Context, info *EvalInfo, err error)
+
+	// StartCall is called before a call to a function in the
+	// expression, such as $sum(x) or x ~> $f.
+	StartCall(ctx context.Context, info *CallInfo) context.Context
+
+	// EndCall is called when the function returns. err is the
+	// error that it returned, if any. For an asynchronous
+	// extension (see Future), the call returns when the
+	// extension has started, not when it has finished.
+	EndCall(ctx context.Context, info *CallInfo, err error)
+
+	// Error is called when an evaluation fails, before
+	// EndEval, with the error that the evaluation returns.
+	Error(ctx context.Context, err error)
+}
+
+// NopObserver is an EvalObserver that does nothing. It can be
+// embedded in an EvalObserver that only needs some of the methods.
+type NopObserver struct{}
+
+// StartEval returns ctx.
+func (NopObserver) StartEval(ctx context.Context, info *EvalInfo) context.Context { return ctx }
+
+// EndEval does nothing.
+func (NopObserver) EndEval(ctx context.Context, info *EvalInfo, err error) {}
+
+// StartCall returns ctx.
+func (NopObserver) StartCall(ctx context.Context, info *CallInfo) context.Context { return ctx }
+
+// EndCall does nothing.
+func (NopObserver) EndCall(ctx context.Context, info *CallInfo, err error) {}
+
+// Error does nothing.
+func (NopObserver) Error(ctx context.Context, err error) {}
+
+// EvalInfo describes an evaluation to an EvalObserver.
+type EvalInfo struct {
+	// Source is the expression that's being evaluated.
+	Source string
+
+	// EvalID is the evaluation's ID, if it has one (see
+	// WithEvalID).
+	EvalID string
+}
+
+// CallInfo describes a function call to an EvalObserver.
+type CallInfo struct {
+	// Name is the name of the function, without the leading
+	// $, e.g. "sum" or the name of an extension. Lambdas that
+	// aren't assigned to a variable are named "lambda".
+	Name string
+
+	// Position is the byte offset of the call in the
+	// expression, or -1 if it isn't known.
+	Position int
+
+	// EvalID is the evaluation's ID, if it has one.
+	EvalID string
+}
+
+// WithObserver tells o about the evaluations of the expressions
+// that the Compiler compiles.
+func WithObserver(o EvalObserver) CompilerOption {
+	return func(c *Compiler) error {
+		c.observer = o
+		return nil
+	}
+}
+
+// observeEval calls fn between the observer's StartEval and
+// EndEval, if the expression has an observer.
+func (e *Expression) observeEval(ctx context.Context, fn func(ctx context.Context) error) error {
+
+	if e.observer == nil {
+		return fn(ctx)
+	}
+
+	info := &EvalInfo{
+		Source: e.source,
+		EvalID: EvalID(ctx),
+	}
+
+	ctx = e.observer.StartEval(ctx, info)
+
+	err := fn(ctx)
+	if err != nil {
+		e.observer.Error(ctx, err)
+	}
+
+	e.observer.EndEval(ctx, info, err)
+	return err
+}
+
+// observeCall calls a function between the observer's
+// StartCall and EndCall. The context returned by StartCall is the
+// evaluation's context until the call returns.
+func observeCall(o EvalObserver, fn jtypes.Callable, node jparse.Node, env *environment, call func() (reflect.Value, error)) (reflect.Value, error) {
+
+	state := env.state
+
+	info := &CallInfo{
+		Name:     fn.Name(),
+		Position: -1,
+		EvalID:   EvalID(state.context),
+	}
+	if r, ok := state.ranges[node]; ok {
+		info.Position = r.Start
+	} else if fc, ok := node.(*jparse.FunctionCallNode); ok {
+		info.Position = fc.Position
+	}
+
+	ctx := state.context
+	state.context = o.StartCall(ctx, info)
+	defer func() { state.context = ctx }()
+
+	v, err := call()
+
+	o.EndCall(state.context, info, err)
+	return v, err
+}
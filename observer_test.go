@@ -0,0 +1,149 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type observerSpanKey struct{}
+
+// recordingObserver records the events it's told about. Each
+// Start method adds a span name to the context, so that events
+// show the spans that they're nested in.
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(ctx context.Context, format string, args ...interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	parent, _ := ctx.Value(observerSpanKey{}).(string)
+	o.events = append(o.events, parent+": "+fmt.Sprintf(format, args...))
+}
+
+func (o *recordingObserver) StartEval(ctx context.Context, info *EvalInfo) context.Context {
+	o.record(ctx, "start eval %s [%s]", info.Source, info.EvalID)
+	return context.WithValue(ctx, observerSpanKey{}, "eval")
+}
+
+func (o *recordingObserver) EndEval(ctx context.Context, info *EvalInfo, err error) {
+	o.record(ctx, "end eval %v", err != nil)
+}
+
+func (o *recordingObserver) StartCall(ctx context.Context, info *CallInfo) context.Context {
+	o.record(ctx, "start $%s at %d [%s]", info.Name, info.Position, info.EvalID)
+	return context.WithValue(ctx, observerSpanKey{}, "$"+info.Name)
+}
+
+func (o *recordingObserver) EndCall(ctx context.Context, info *CallInfo, err error) {
+	o.record(ctx, "end $%s %v", info.Name, err)
+}
+
+func (o *recordingObserver) Error(ctx context.Context, err error) {
+	var eerr *EvalError
+	errors.As(err, &eerr)
+	o.record(ctx, "error at %d [%s]", eerr.Position, eerr.EvalID)
+}
+
+func TestCompiler_WithObserver(t *testing.T) {
+
+	obs := &recordingObserver{}
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"span": {Func: func(ctx context.Context) string {
+			s, _ := ctx.Value(observerSpanKey{}).(string)
+			return s
+		}},
+		"fail": {Func: func() (string, error) {
+			return "", fmt.Errorf("failed")
+		}},
+	}, WithObserver(obs))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	ctx := WithEvalID(context.Background(), "req-9")
+
+	const expr = `($f := function($s) { $uppercase($s) }; [$f("a"), "b" ~> $f, $span()])`
+	got, err := comp.MustCompile(expr).EvalContext(ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Extensions see the evaluation's context.
+	if want := []interface{}{"A", "B", "eval"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	want := []string{
+		": start eval " + expr + " [req-9]",
+		"eval: start $f at 41 [req-9]",
+		"$f: start $uppercase at 22 [req-9]",
+		"$uppercase: end $uppercase <nil>",
+		"$f: end $f <nil>",
+		"eval: start $f at 50 [req-9]",
+		"$f: start $uppercase at 22 [req-9]",
+		"$uppercase: end $uppercase <nil>",
+		"$f: end $f <nil>",
+		"eval: start $span at 61 [req-9]",
+		"$span: end $span <nil>",
+		"eval: end eval false",
+	}
+	if !reflect.DeepEqual(obs.events, want) {
+		t.Errorf("expected events:\n%q\ngot:\n%q", want, obs.events)
+	}
+
+	obs.events = nil
+
+	if _, err := comp.MustCompile(`"x" & $fail()`).EvalContext(ctx, nil, nil); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	want = []string{
+		`: start eval "x" & $fail() [req-9]`,
+		"eval: start $fail at 6 [req-9]",
+		"$fail: end $fail function \"fail\" failed at position 11: failed",
+		"eval: error at 6 [req-9]",
+		"eval: end eval true",
+	}
+	if !reflect.DeepEqual(obs.events, want) {
+		t.Errorf("expected events:\n%q\ngot:\n%q", want, obs.events)
+	}
+}
+
+func TestNopObserver(t *testing.T) {
+
+	// An observer that embeds NopObserver only needs the
+	// methods it uses.
+	var calls []string
+	comp, err := NewCompiler(nil, nil, WithObserver(&callNameObserver{names: &calls}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	if _, err := comp.MustCompile(`$sum([1, 2]) + $count([3])`).Eval(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"sum", "count"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected calls %v, got %v", want, calls)
+	}
+}
+
+type callNameObserver struct {
+	NopObserver
+	names *[]string
+}
+
+func (o *callNameObserver) StartCall(ctx context.Context, info *CallInfo) context.Context {
+	*o.names = append(*o.names, info.Name)
+	return ctx
+}
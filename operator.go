@@ -0,0 +1,157 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// An Operator is a custom infix operator (see
+// Compiler.RegisterOperator).
+type Operator struct {
+
+	// Precedence is the operator's binding power relative to
+	// the built-in operators, from jparse.PrecedenceOr to
+	// jparse.PrecedenceMultiply, e.g. jparse.PrecedenceCompare
+	// for an operator that binds like =.
+	Precedence int
+
+	// Func is a Go function with two parameters, for the left
+	// and right operands, and the same rules as Extension.Func.
+	// It can take a context.Context as well, but it can't be
+	// variadic.
+	Func interface{}
+
+	// UndefinedHandler decides whether the result is undefined
+	// without calling Func, as in Extension. If it's nil, the
+	// result is undefined if either operand is undefined.
+	UndefinedHandler jtypes.ArgHandler
+}
+
+// RegisterOperator adds a custom infix operator to the language
+// compiled by c, so that domains can write, for example,
+//
+//	c.RegisterOperator("matches", Operator{
+//		Precedence: jparse.PrecedenceCompare,
+//		Func:       func(s, pattern string) (bool, error) { ... },
+//	})
+//
+// and then name matches "^A". The symbol is either a word, which
+// is still a name wherever an operator can't appear, or a
+// sequence of punctuation characters, such as <=> (see
+// jparse.Operator for the rules). Both operands are evaluated
+// before Func is called, and Func's errors are returned as
+// *ExtensionErrors.
+//
+// An operator replaces any operator with the same symbol. It
+// applies to expressions, preludes, libraries and decision
+// tables compiled after it is registered. RegisterOperator must
+// not be called at the same time as Compile.
+func (c *Compiler) RegisterOperator(symbol string, op Operator) error {
+
+	if c.frozen {
+		return errDefaultFrozen()
+	}
+
+	callable, err := newGoCallable(symbol, Extension{
+		Func:             op.Func,
+		UndefinedHandler: op.UndefinedHandler,
+	})
+	if err != nil {
+		return fmt.Errorf("%s is not a valid operator: %s", symbol, err)
+	}
+	if len(callable.params) != 2 || callable.isVariadic {
+		return fmt.Errorf("%s is not a valid operator: func must have two parameters", symbol)
+	}
+	callable.isExtension = true
+	if callable.undefinedHandler == nil {
+		callable.undefinedHandler = undefinedOperand
+	}
+
+	// Copy the operators so that clones and expressions
+	// compiled earlier keep the ones they have.
+	ops := make(map[string]*customOperator, len(c.operators)+1)
+	for sym, o := range c.operators {
+		ops[sym] = o
+	}
+	ops[symbol] = &customOperator{
+		precedence: op.Precedence,
+		callable:   callable,
+	}
+
+	defs := make([]jparse.Operator, 0, len(ops))
+	for sym, o := range ops {
+		defs = append(defs, jparse.Operator{
+			Symbol:     sym,
+			Precedence: o.precedence,
+		})
+	}
+
+	syntax, err := jparse.NewSyntax(defs...)
+	if err != nil {
+		return err
+	}
+
+	c.operators = ops
+	c.syntax = syntax
+	return nil
+}
+
+// WithOperator adds a custom infix operator, as RegisterOperator
+// does, for compilers that are only set up with options.
+func WithOperator(symbol string, op Operator) CompilerOption {
+	return func(c *Compiler) error {
+		return c.RegisterOperator(symbol, op)
+	}
+}
+
+// A customOperator is an operator added with RegisterOperator.
+type customOperator struct {
+	precedence int
+	callable   *goCallable
+}
+
+// undefinedOperand is the default UndefinedHandler of custom
+// operators.
+func undefinedOperand(argv []reflect.Value) bool {
+	for _, arg := range argv {
+		if arg == undefined {
+			return true
+		}
+	}
+	return false
+}
+
+func evalCustomOperator(node *jparse.CustomOperatorNode, data reflect.Value, env *environment) (reflect.Value, error) {
+
+	fn := env.operator(node.Symbol)
+	if fn == nil {
+		return undefined, fmt.Errorf("operator %s is not defined", node.Symbol)
+	}
+
+	lhs, err := eval(node.LHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	rhs, err := eval(node.RHS, data, env)
+	if err != nil {
+		return undefined, err
+	}
+
+	argv := []reflect.Value{lhs, rhs}
+	wrapCallableArgs(fn, argv, env, nil)
+
+	v, err := fn.Call(argv)
+	if err != nil {
+		return undefined, err
+	}
+
+	return await(v, env)
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// testMatches implements a matches operator.
+func testMatches(s, pattern string) (bool, error) {
+	return regexp.MatchString(pattern, s)
+}
+
+// testCompare implements a <=> operator for numbers.
+func testCompare(a, b float64) float64 {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func newOperatorCompiler(t *testing.T) *Compiler {
+
+	comp, err := NewCompiler(nil, nil,
+		WithOperator("matches", Operator{
+			Precedence: jparse.PrecedenceCompare,
+			Func:       testMatches,
+		}),
+		WithOperator("<=>", Operator{
+			Precedence: jparse.PrecedenceCompare,
+			Func:       testCompare,
+		}),
+		// A unit-aware multiplication that binds more tightly
+		// than +.
+		WithOperator("@", Operator{
+			Precedence: jparse.PrecedenceMultiply,
+			Func: func(ctx context.Context, n float64, unit string) (float64, error) {
+				switch unit {
+				case "m":
+					return n, nil
+				case "km":
+					return n * 1000, nil
+				default:
+					return 0, errors.New("unknown unit " + unit)
+				}
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	return comp
+}
+
+func TestCompiler_RegisterOperator(t *testing.T) {
+
+	comp := newOperatorCompiler(t)
+
+	data := map[string]interface{}{
+		"name":    "Alice",
+		"matches": "Bob",
+		"a":       2.0,
+		"b":       3.0,
+	}
+
+	tests := []struct {
+		Expr   string
+		Output interface{}
+	}{
+		{`name matches "^A"`, true},
+		{`name matches "^B" or matches matches "^B"`, true},
+		{`a <=> b`, -1.0},
+		{`b <=> a + 1`, 0.0},
+		{`$sort([3, 1, 2], function($x, $y) { $x <=> $y > 0 })`, []interface{}{1.0, 2.0, 3.0}},
+		{`1 @ "km" + 500 @ "m"`, 1500.0},
+		{`missing matches "x"`, nil},
+		{`name matches missing`, nil},
+	}
+
+	for _, test := range tests {
+		e, err := comp.Compile(test.Expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.Expr, err)
+			continue
+		}
+		got, err := e.Eval(data, nil)
+		if test.Output == nil {
+			if err != ErrUndefined {
+				t.Errorf("%s: expected undefined, got %v (error %v)", test.Expr, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.Output) {
+			t.Errorf("%s: expected %v, got %v (error %v)", test.Expr, test.Output, got, err)
+		}
+	}
+
+	// Errors from the Go function are ExtensionErrors.
+	_, err := comp.MustCompile(`1 @ "mi"`).Eval(nil, nil)
+	var extErr *ExtensionError
+	if !errors.As(err, &extErr) || extErr.Func != "@" {
+		t.Errorf("expected an ExtensionError for @, got %v", err)
+	}
+
+	// Operators are available in preludes, and survive
+	// recompiling a trimmed expression.
+	if err := comp.SetPrelude(`$isA := function($s) { $s matches "^A" }`); err != nil {
+		t.Fatalf("SetPrelude failed: %v", err)
+	}
+	e := comp.MustCompile(`$isA(name) and a <=> b = -1`)
+	comp.Trim(0)
+	if got, err := e.Eval(data, nil); err != nil || got != true {
+		t.Errorf("expected true, got %v (error %v)", got, err)
+	}
+	if got, want := e.String(), `$isA(name) and a <=> b = -1`; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestCompiler_RegisterOperatorErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	// Expressions compiled before an operator is registered
+	// can't use it.
+	if _, err := comp.Compile(`name matches "x"`); err == nil {
+		t.Errorf("expected an error for an unregistered operator")
+	}
+
+	for _, test := range []struct {
+		Symbol string
+		Op     Operator
+	}{
+		{"matches", Operator{Precedence: jparse.PrecedenceCompare, Func: "not a function"}},
+		{"matches", Operator{Precedence: jparse.PrecedenceCompare, Func: func(string) bool { return true }}},
+		{"matches", Operator{Precedence: jparse.PrecedenceCompare, Func: func(...string) bool { return true }}},
+		{"matches", Operator{Precedence: 0, Func: testMatches}},
+		{"and", Operator{Precedence: jparse.PrecedenceCompare, Func: testMatches}},
+		{"<=", Operator{Precedence: jparse.PrecedenceCompare, Func: testMatches}},
+		{"a b", Operator{Precedence: jparse.PrecedenceCompare, Func: testMatches}},
+	} {
+		if err := comp.RegisterOperator(test.Symbol, test.Op); err == nil {
+			t.Errorf("%s: expected an error", test.Symbol)
+		}
+	}
+
+	// Failed registrations leave the compiler unchanged.
+	if len(comp.operators) != 0 || comp.syntax != nil {
+		t.Errorf("expected no operators, got %v", comp.operators)
+	}
+}
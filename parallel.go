@@ -0,0 +1,385 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// WithParallelism lets expressions compiled by the Compiler use
+// up to n goroutines to evaluate a path step, a filter, or the
+// function passed to $map or $filter, over a large array. The
+// array is split into n parts and the results are merged in
+// order, so they're the same as those of a sequential evaluation.
+// If more than one part fails, the error is the one a sequential
+// evaluation would have returned.
+//
+// Only pure expressions are evaluated in parallel: ones that
+// don't assign variables, define functions or call anything but
+// Go functions, such as extensions and the built-in functions
+// other than $random and $shuffle. Those Go functions (and any
+// Resolver, value converters, lazy arrays and progress callback)
+// are called from several goroutines at once, so they must be
+// safe for concurrent use. Everything else is evaluated
+// sequentially, as are calls to batched extensions and the
+// function passed to $map if there is a progress callback (see
+// WithMapProgress). The default, 1, turns parallel evaluation
+// off.
+func WithParallelism(n int) CompilerOption {
+	return func(c *Compiler) error {
+		if n < 1 {
+			return fmt.Errorf("parallelism must be at least 1, got %d", n)
+		}
+		c.parallelism = n
+		return nil
+	}
+}
+
+// minParallelItems is the smallest array that is evaluated in
+// parallel. Smaller arrays aren't worth the cost of starting
+// the goroutines. It's defined as a global so we can use it in
+// the tests.
+var minParallelItems = 1000
+
+// A parallelPlan records the nodes of an expression that can be
+// evaluated in parallel.
+type parallelPlan struct {
+	workers int
+
+	// nodes maps each path step, filter and function body that
+	// can be evaluated in parallel to the names of the variables
+	// it reads.
+	nodes map[jparse.Node][]string
+}
+
+// compileParallelPlan returns the parallelPlan for a syntax tree,
+// or nil if nothing in it can be evaluated in parallel.
+func compileParallelPlan(root jparse.Node, workers int) (*parallelPlan, error) {
+
+	if workers < 2 {
+		return nil, nil
+	}
+
+	if err := checkPlanTree(root); err != nil {
+		return nil, err
+	}
+
+	nodes := map[jparse.Node][]string{}
+
+	add := func(node jparse.Node) {
+		if _, ok := nodes[node]; ok {
+			return
+		}
+		if names, ok := parallelVars(node); ok {
+			nodes[node] = names
+		}
+	}
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+		switch node := node.(type) {
+		case *jparse.PathNode:
+			for _, step := range node.Steps {
+				add(step)
+			}
+		case *jparse.PredicateNode:
+			for _, filter := range node.Filters {
+				add(filter)
+			}
+		case *jparse.LambdaNode:
+			add(node.Body)
+		case *jparse.TypedLambdaNode:
+			add(node.Body)
+		}
+		return true
+	})
+
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	return &parallelPlan{
+		workers: workers,
+		nodes:   nodes,
+	}, nil
+}
+
+// impureFuncs are the built-in functions whose results depend
+// on the order in which they're called.
+var impureFuncs = map[string]bool{
+	"random":  true,
+	"shuffle": true,
+}
+
+// parallelVars returns the names of the variables that a node
+// reads. ok is false if the node can't be evaluated in parallel
+// because it binds variables or calls something other than a
+// variable. Whether the variables are Go functions is decided
+// when the node is evaluated (see parallelEnvs). Custom operators
+// are Go functions, like extensions, so they don't stop a node
+// from being evaluated in parallel or memoized.
+func parallelVars(node jparse.Node) (names []string, ok bool) {
+
+	ok = true
+	seen := map[string]bool{}
+
+	jparse.Walk(node, func(node jparse.Node) bool {
+		switch node := node.(type) {
+		case *jparse.VariableNode:
+			if impureFuncs[node.Name] {
+				ok = false
+			} else if node.Name != "" && !seen[node.Name] {
+				seen[node.Name] = true
+				names = append(names, node.Name)
+			}
+		case *jparse.FunctionCallNode:
+			_, ok = node.Func.(*jparse.VariableNode)
+		case *jparse.AssignmentNode, *jparse.LambdaNode, *jparse.TypedLambdaNode,
+			*jparse.PartialNode, *jparse.ObjectTransformationNode:
+			ok = false
+		}
+		return ok
+	})
+
+	return names, ok
+}
+
+// parallelEnvs returns an environment for each of the goroutines
+// that evaluate node for n items, or nil if node should be
+// evaluated sequentially. Each environment has its own copy of
+// the evaluation state and of the Go functions that node reads.
+// Nested nodes are evaluated sequentially.
+func (s *environment) parallelEnvs(node jparse.Node, n int) []*environment {
+
+	if s == nil || s.state == nil || s.state.parallel == nil || n < minParallelItems {
+		return nil
+	}
+
+	names, ok := s.state.parallel.nodes[node]
+	if !ok {
+		return nil
+	}
+
+	callables := map[string]*goCallable{}
+	for _, name := range names {
+		v := s.lookup(name)
+		if !v.IsValid() || !v.CanInterface() {
+			continue
+		}
+		switch v := v.Interface().(type) {
+		case *goCallable:
+			if v.batch != nil {
+				// Batches are collected sequentially.
+				return nil
+			}
+			callables[name] = v
+		case jtypes.Callable, extensionModule:
+			// Lambdas and the like share their evaluation
+			// state with their caller.
+			return nil
+		}
+	}
+
+	workers := s.state.parallel.workers
+	if workers > n {
+		workers = n
+	}
+
+	envs := make([]*environment, workers)
+	for i := range envs {
+
+		state := *s.state
+		state.parallel = nil
+		state.memo = nil
+		state.shared = nil
+		state.errNode = nil
+		state.cycles = cycleChecker{}
+
+		env := &environment{
+			parent:  s,
+			symbols: make(map[string]reflect.Value, len(callables)),
+			state:   &state,
+		}
+		for name, gc := range callables {
+			env.bind(name, reflect.ValueOf(env.cloneGoCallable(gc)))
+		}
+
+		envs[i] = env
+	}
+
+	return envs
+}
+
+// evalParallel splits the items [0, n) into one part for each
+// environment returned by parallelEnvs and calls fn for each
+// part in its own goroutine. It returns the concatenated results
+// or the error from the first part that failed. If node can't be
+// evaluated in parallel, ok is false and fn isn't called.
+func evalParallel(node jparse.Node, n int, env *environment, fn func(lo, hi int, env *environment) ([]reflect.Value, error)) (results []reflect.Value, ok bool, err error) {
+
+	envs := env.parallelEnvs(node, n)
+	if envs == nil {
+		return nil, false, nil
+	}
+
+	parts := make([][]reflect.Value, len(envs))
+	errs := make([]error, len(envs))
+	panics := make([]interface{}, len(envs))
+
+	size := (n + len(envs) - 1) / len(envs)
+
+	var wg sync.WaitGroup
+
+	for i := range envs {
+
+		lo, hi := i*size, (i+1)*size
+		if hi > n {
+			hi = n
+		}
+		if lo >= hi {
+			break
+		}
+
+		wg.Add(1)
+		go func(i, lo, hi int) {
+			defer wg.Done()
+			defer func() {
+				// Re-panic in the caller's goroutine.
+				if r := recover(); r != nil {
+					panics[i] = r
+				}
+			}()
+			parts[i], errs[i] = fn(lo, hi, envs[i])
+		}(i, lo, hi)
+	}
+
+	wg.Wait()
+
+	count := 0
+	for i := range envs {
+		if panics[i] != nil {
+			panic(panics[i])
+		}
+		if errs[i] != nil {
+			if env.state.errNode == nil {
+				env.state.errNode = envs[i].state.errNode
+			}
+			return nil, true, errs[i]
+		}
+		count += len(parts[i])
+	}
+
+	if count == 0 {
+		return nil, true, nil
+	}
+
+	results = make([]reflect.Value, 0, count)
+	for _, part := range parts {
+		results = append(results, part...)
+	}
+
+	return results, true, nil
+}
+
+// precomputeCalls calls the lambda passed to a function such as
+// $map (see goCallable.parallelCalls) for each item of the array
+// passed with it, in parallel. If it can, it replaces the lambda
+// with a precomputedCallable, so the function returns the same
+// results as it would have with the lambda.
+func precomputeCalls(argv []reflect.Value, env *environment) error {
+
+	if len(argv) != 2 || !argv[1].IsValid() || !argv[1].CanInterface() {
+		return nil
+	}
+
+	f, ok := argv[1].Interface().(*lambdaCallable)
+	if !ok || f.ParamCount() > 2 {
+		return nil
+	}
+
+	items := jtypes.Resolve(argv[0])
+	if !jtypes.IsArray(items) {
+		return nil
+	}
+
+	argc := f.ParamCount()
+	if argc < 1 {
+		argc = 1
+	}
+
+	results, ok, err := evalParallel(f.body, items.Len(), f.env, func(lo, hi int, env *environment) ([]reflect.Value, error) {
+
+		fn := *f
+		fn.env = env
+
+		// Like $map, make all of the calls before waiting for
+		// any asynchronous results.
+		batches := newBatchSet()
+		results := make([]reflect.Value, hi-lo)
+
+		for i := lo; i < hi; i++ {
+
+			argv := []reflect.Value{items.Index(i), reflect.ValueOf(i)}
+
+			res, err := fn.call(argv[:argc], batches)
+			if err != nil {
+				return nil, err
+			}
+
+			results[i-lo] = res
+		}
+
+		for i, res := range results {
+			res, err := await(res, env)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = res
+		}
+
+		return results, nil
+	})
+
+	if !ok || err != nil {
+		return err
+	}
+
+	argv[1] = reflect.ValueOf(&precomputedCallable{
+		callableName: f.callableName,
+		results:      results,
+	})
+
+	return nil
+}
+
+// A precomputedCallable returns the results of calls made by
+// precomputeCalls. It takes an item and its index, and returns
+// the result for that index.
+type precomputedCallable struct {
+	callableName
+	results []reflect.Value
+}
+
+func (f *precomputedCallable) ParamCount() int {
+	return 2
+}
+
+func (f *precomputedCallable) Call(argv []reflect.Value) (reflect.Value, error) {
+
+	if len(argv) < 2 {
+		return undefined, fmt.Errorf("precomputed function called without an index")
+	}
+
+	i, ok := jtypes.AsNumber(argv[1])
+	if !ok || int(i) < 0 || int(i) >= len(f.results) {
+		return undefined, fmt.Errorf("precomputed function called with an invalid index")
+	}
+
+	return f.results[int(i)], nil
+}
@@ -0,0 +1,372 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// setMinParallelItems changes minParallelItems for the duration
+// of a test.
+func setMinParallelItems(t *testing.T, n int) {
+	old := minParallelItems
+	minParallelItems = n
+	t.Cleanup(func() {
+		minParallelItems = old
+	})
+}
+
+func testParallelItems(n int) []interface{} {
+
+	items := make([]interface{}, n)
+	for i := range items {
+		items[i] = map[string]interface{}{
+			"id":    fmt.Sprintf("item%03d", i),
+			"price": float64(i%17) * 1.5,
+			"qty":   i % 5,
+			"tags":  []interface{}{"a", fmt.Sprint(i % 3)},
+			"sub":   map[string]interface{}{"x": i},
+		}
+	}
+
+	return items
+}
+
+func TestParallelPlan(t *testing.T) {
+
+	// Is the second step of each path in the plan?
+	data := []struct {
+		Expression string
+		Parallel   bool
+	}{
+		{`items.(price * qty)`, true},
+		{`items.$string(id)`, true},
+		{`items.{"id": id, "tags": [tags]}`, true},
+		{`items.**.x`, true},
+		{`items.($ ~> $string)`, true},
+		{`items.($x := price; $x)`, false},
+		{`items.(function($v){ $v }(price))`, false},
+		{`items.($lookup($m, "f"))(price)`, false},
+		{`items.$random()`, false},
+		{`items.$shuffle(tags)`, false},
+		{`items.| sub | {"y": 1} |`, false},
+	}
+
+	for _, test := range data {
+
+		node, err := jparse.Parse(test.Expression)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Expression, err)
+		}
+
+		if plan, _ := compileParallelPlan(node, 1); plan != nil {
+			t.Errorf("%s: expected no plan for 1 worker", test.Expression)
+		}
+
+		step := node.(*jparse.PathNode).Steps[1]
+
+		var ok bool
+		if plan, _ := compileParallelPlan(node, 4); plan != nil {
+			_, ok = plan.nodes[step]
+		}
+		if ok != test.Parallel {
+			t.Errorf("%s: expected parallel to be %t, got %t", test.Expression, test.Parallel, ok)
+		}
+	}
+
+	// Lambda bodies are planned so that $map and $filter can
+	// call them in parallel.
+	node, err := jparse.Parse(`$map(items, function($v){ $v.price })`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lambda := node.(*jparse.FunctionCallNode).Args[1].(*jparse.LambdaNode)
+	plan, _ := compileParallelPlan(node, 4)
+	if _, ok := plan.nodes[lambda.Body]; !ok {
+		t.Errorf("expected the lambda body to be in the plan")
+	}
+}
+
+func TestCompiler_WithParallelism(t *testing.T) {
+
+	setMinParallelItems(t, 10)
+
+	input := map[string]interface{}{
+		"items": testParallelItems(101),
+	}
+
+	exts := map[string]Extension{
+		"double": {Func: func(n float64) float64 { return 2 * n }},
+	}
+
+	seq, err := NewCompiler(nil, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	par, err := NewCompiler(nil, exts, WithParallelism(4))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	exprs := []string{
+		`items.(price * qty)`,
+		`items.{"id": id, "total": price * qty}`,
+		`items[price > 10].id`,
+		`items[qty = 0][price < 5].sub.x`,
+		`items[0].id`,
+		`items[-1].id`,
+		`items[[1, 50, 100]].id`,
+		`items.$string(id)`,
+		`items.$double(price)`,
+		`items.tags`,
+		`items.[tags]`,
+		`items.sub.*`,
+		`items.**.x`,
+		`items.(qty > 2 ? id : undefined)`,
+		`$sum(items.(price * qty))`,
+		`items^(>price).id`,
+		`items{id: price}`,
+		`$map(items, function($v){ $v.price * 2 })`,
+		`$map(items, function($v, $i){ $i & ":" & $v.id })`,
+		`$map(items, function($v){ [$v.qty] })`,
+		`$map(items, function($v){ $v.missing })`,
+		`$map(items.sub, function($v){ $map($v.*, $string) })`,
+		`$filter(items, function($v){ $v.qty > 2 }).id`,
+		`$filter(items, function($v, $i){ $i % 7 = 0 }).id`,
+		`$map(items, $string)`,
+		`items.($x := price; $x + qty)`,
+		`($f := function($p){ $p * 3 }; items.$f(price))`,
+		`$map(items, function($v){ ($y := $v.qty; $y * $y) })`,
+		`$map(items, function($v, $i, $a){ $count($a) - $i })`,
+	}
+
+	for _, expr := range exprs {
+
+		want, wantErr := seq.MustCompile(expr).Eval(input, nil)
+		got, gotErr := par.MustCompile(expr).Eval(input, nil)
+
+		if !reflect.DeepEqual(gotErr, wantErr) {
+			t.Errorf("%s: expected error %v, got %v", expr, wantErr, gotErr)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", expr, want, got)
+		}
+	}
+
+	if _, err := NewCompiler(nil, nil, WithParallelism(0)); err == nil {
+		t.Errorf("expected an error for zero parallelism")
+	}
+}
+
+func TestCompiler_WithParallelism_Batches(t *testing.T) {
+
+	setMinParallelItems(t, 10)
+
+	// Calls to batched extensions are still batched.
+	var sizes []int
+	exts := map[string]Extension{
+		"lookup": {
+			Func: func(id string) string { return id },
+			CallBatch: func(args [][]interface{}) ([]interface{}, error) {
+				sizes = append(sizes, len(args))
+				results := make([]interface{}, len(args))
+				for i, arg := range args {
+					results[i] = arg[0]
+				}
+				return results, nil
+			},
+		},
+	}
+
+	comp, err := NewCompiler(nil, exts, WithParallelism(4))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"items": testParallelItems(50),
+	}
+
+	for _, expr := range []string{
+		`items.$lookup(id)`,
+		`$map(items, function($v){ $lookup($v.id) })`,
+	} {
+
+		sizes = nil
+
+		got, err := comp.MustCompile(expr).Eval(input, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", expr, err)
+		}
+		if n := reflect.ValueOf(got).Len(); n != 50 {
+			t.Errorf("%s: expected 50 results, got %d", expr, n)
+		}
+		if !reflect.DeepEqual(sizes, []int{50}) {
+			t.Errorf("%s: expected one batch of 50, got %v", expr, sizes)
+		}
+	}
+}
+
+func TestCompiler_WithParallelism_Errors(t *testing.T) {
+
+	setMinParallelItems(t, 10)
+
+	input := map[string]interface{}{
+		"items": testParallelItems(100),
+	}
+
+	// Items 37 and 80 fail. The error should be the one that
+	// a sequential evaluation returns, i.e. item 37, even
+	// though the worker for item 80 may finish first.
+	exts := map[string]Extension{
+		"check": {Func: func(id string) (string, error) {
+			switch id {
+			case "item037", "item080":
+				return "", fmt.Errorf("bad item %s", id)
+			case "item000", "item001", "item002":
+				time.Sleep(10 * time.Millisecond)
+			}
+			return id, nil
+		}},
+	}
+
+	seq, err := NewCompiler(nil, exts)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	par, err := NewCompiler(nil, exts, WithParallelism(8))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	exprs := []string{
+		`items.$check(id)`,
+		`items[$check(id) = id].id`,
+		`$map(items, function($v){ $check($v.id) })`,
+		`$filter(items, function($v){ $check($v.id) })`,
+		`items.(qty & $check(id))`,
+	}
+
+	for _, expr := range exprs {
+
+		_, wantErr := seq.MustCompile(expr).Eval(input, nil)
+		_, gotErr := par.MustCompile(expr).Eval(input, nil)
+
+		var eerr *ExtensionError
+		if !errors.As(gotErr, &eerr) || eerr.Err.Error() != "bad item item037" {
+			t.Errorf("%s: expected the error for item 37, got %v", expr, gotErr)
+		}
+		if !reflect.DeepEqual(gotErr, wantErr) {
+			t.Errorf("%s: expected error %v, got %v", expr, wantErr, gotErr)
+		}
+	}
+}
+
+func TestCompiler_WithParallelism_Goroutines(t *testing.T) {
+
+	const workers = 4
+
+	setMinParallelItems(t, workers)
+
+	// The first call in each goroutine waits for the others.
+	// If the calls were sequential, they would time out.
+	var mu sync.Mutex
+	var waiting int
+	ready := make(chan struct{})
+
+	exts := map[string]Extension{
+		"wait": {Func: func(n float64) bool {
+			mu.Lock()
+			waiting++
+			if waiting == workers {
+				close(ready)
+			}
+			first, ch := waiting <= workers, ready
+			mu.Unlock()
+
+			if !first {
+				return true
+			}
+
+			select {
+			case <-ch:
+				return true
+			case <-time.After(5 * time.Second):
+				return false
+			}
+		}},
+	}
+
+	comp, err := NewCompiler(nil, exts, WithParallelism(workers))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := make([]interface{}, 4*workers)
+	for i := range input {
+		input[i] = i
+	}
+
+	for _, expr := range []string{
+		`$.$wait($)`,
+		`$[$wait($)]`,
+	} {
+
+		mu.Lock()
+		waiting = 0
+		ready = make(chan struct{})
+		mu.Unlock()
+
+		got, err := comp.MustCompile(expr).Eval(input, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", expr, err)
+		}
+
+		n := reflect.ValueOf(got).Len()
+		if expr == `$[$wait($)]` && n != len(input) {
+			t.Errorf("%s: expected %d items, got %v", expr, len(input), got)
+		}
+		for i := 0; i < n; i++ {
+			if v := reflect.ValueOf(got).Index(i).Interface(); v == false {
+				t.Errorf("%s: calls were not made in parallel: %v", expr, got)
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkParallelism(b *testing.B) {
+
+	items := testParallelItems(100000)
+
+	for _, n := range []int{1, 4} {
+
+		comp, err := NewCompiler(nil, nil, WithParallelism(n))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		e := comp.MustCompile(`$map(items, function($v){ $v.price * $v.qty + $count($v.tags) })`)
+		input := map[string]interface{}{"items": items}
+
+		b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := e.Eval(input, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
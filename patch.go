@@ -0,0 +1,199 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A Patch is a JSON Patch (RFC 6902): a list of operations that
+// turn one JSON document into another.
+type Patch []PatchOperation
+
+// A PatchOperation is a single operation in a Patch.
+type PatchOperation struct {
+	// Op is "add", "remove" or "replace".
+	Op string
+
+	// Path is a JSON Pointer (RFC 6901) to the location of the
+	// operation, e.g. /servers/0/replicas, or an empty string
+	// for the whole document.
+	Path string
+
+	// Value is the new value for "add" and "replace", after
+	// normalization (see Normalize). It's unused for "remove".
+	Value interface{}
+}
+
+// MarshalJSON implements json.Marshaler. Value is included for
+// "add" and "replace", even if it's null, and left out for
+// "remove".
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{op.Op, op.Path, op.Value})
+}
+
+// Patch evaluates an expression that is a transform, such as
+//
+//	| servers[env = "prod"] | {"replicas": replicas * 2} |
+//
+// against data and returns the changes that it makes as a JSON
+// Patch, instead of the whole modified document. Applying the
+// patch to data's JSON encoding gives the transform's result,
+// so large documents can be updated elsewhere without sending
+// them in full. data itself is unchanged.
+//
+// Changed values are replaced and deleted members are removed.
+// Members that the transform adds are added. Arrays are patched
+// item by item, with items added or removed at the end if the
+// array changes length. Object members are patched in key
+// order.
+func (e *Expression) Patch(data interface{}, vars map[string]interface{}) (Patch, error) {
+
+	before, after, err := e.evalTransform(data, vars, "Patch")
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := Normalize(before, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := Normalize(after, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var p patcher
+	p.diff(nil, b, a)
+
+	if p.ops == nil {
+		return Patch{}, nil
+	}
+
+	return p.ops, nil
+}
+
+type patcher struct {
+	ops Patch
+}
+
+func (p *patcher) add(op string, path []diffStep, value interface{}) {
+	p.ops = append(p.ops, PatchOperation{
+		Op:    op,
+		Path:  patchPointer(path),
+		Value: value,
+	})
+}
+
+// diff adds the operations that turn before into after. Both
+// are normalized values.
+func (p *patcher) diff(path []diffStep, before, after interface{}) {
+
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+
+	bm, bok := before.(map[string]interface{})
+	am, aok := after.(map[string]interface{})
+	if bok && aok {
+		p.diffObjects(path, bm, am)
+		return
+	}
+
+	ba, bok := before.([]interface{})
+	aa, aok := after.([]interface{})
+	if bok && aok {
+		p.diffArrays(path, ba, aa)
+		return
+	}
+
+	p.add("replace", path, after)
+}
+
+func (p *patcher) diffObjects(path []diffStep, before, after map[string]interface{}) {
+
+	keys := map[string]interface{}{}
+	for k := range before {
+		keys[k] = nil
+	}
+	for k := range after {
+		keys[k] = nil
+	}
+
+	for _, k := range sortedKeys(keys) {
+
+		k := k
+		step := appendStep(path, diffStep{key: &k})
+
+		b, bok := before[k]
+		a, aok := after[k]
+
+		switch {
+		case !aok:
+			p.add("remove", step, nil)
+		case !bok:
+			p.add("add", step, a)
+		default:
+			p.diff(step, b, a)
+		}
+	}
+}
+
+func (p *patcher) diffArrays(path []diffStep, before, after []interface{}) {
+
+	n := len(before)
+	if len(after) < n {
+		n = len(after)
+	}
+
+	for i := 0; i < n; i++ {
+		p.diff(appendStep(path, diffStep{index: i}), before[i], after[i])
+	}
+
+	for i := n; i < len(after); i++ {
+		p.add("add", appendStep(path, diffStep{index: i}), after[i])
+	}
+
+	// Items are removed from the end, so that the indexes of
+	// the remaining items don't change.
+	for i := len(before) - 1; i >= n; i-- {
+		p.add("remove", appendStep(path, diffStep{index: i}), nil)
+	}
+}
+
+// patchPointer formats a path as a JSON Pointer.
+func patchPointer(path []diffStep) string {
+
+	var b strings.Builder
+
+	for _, step := range path {
+		b.WriteByte('/')
+		if step.key == nil {
+			b.WriteString(strconv.Itoa(step.index))
+			continue
+		}
+		b.WriteString(pointerEscaper.Replace(*step.key))
+	}
+
+	return b.String()
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
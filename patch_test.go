@@ -0,0 +1,147 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpression_Patch(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"version": 1,
+		"servers": []interface{}{
+			map[string]interface{}{"name": "a", "env": "prod", "replicas": 2, "debug": true},
+			map[string]interface{}{"name": "b", "env": "dev", "replicas": 1, "debug": true},
+			map[string]interface{}{"name": "c", "env": "prod", "replicas": 3, "tags": []interface{}{"x", "y"}},
+		},
+		"a/b~c": "old",
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{
+			expr: `| servers[env = "prod"] | {"replicas": replicas * 2, "owner": null}, "debug" |`,
+			want: `[` +
+				`{"op":"remove","path":"/servers/0/debug"},` +
+				`{"op":"add","path":"/servers/0/owner","value":null},` +
+				`{"op":"replace","path":"/servers/0/replicas","value":4},` +
+				`{"op":"add","path":"/servers/2/owner","value":null},` +
+				`{"op":"replace","path":"/servers/2/replicas","value":6}` +
+				`]`,
+		},
+		{
+			expr: `| servers[name = "c"] | {"tags": ["z"]} |`,
+			want: `[` +
+				`{"op":"replace","path":"/servers/2/tags/0","value":"z"},` +
+				`{"op":"remove","path":"/servers/2/tags/1"}` +
+				`]`,
+		},
+		{
+			expr: `| servers[name = "c"] | {"tags": [tags, "z"]} |`,
+			want: `[{"op":"add","path":"/servers/2/tags/2","value":"z"}]`,
+		},
+		{
+			expr: `| $ | {"a/b~c": "new", "version": version + 1} |`,
+			want: `[` +
+				`{"op":"replace","path":"/a~1b~0c","value":"new"},` +
+				`{"op":"replace","path":"/version","value":2}` +
+				`]`,
+		},
+		{
+			expr: `| servers[name = "b"] | {"replicas": 1} |`,
+			want: `[]`,
+		},
+	}
+
+	for _, test := range tests {
+
+		patch, err := comp.MustCompile(test.expr).Patch(data, nil)
+		if err != nil {
+			t.Errorf("%s: Patch failed: %v", test.expr, err)
+			continue
+		}
+
+		b, err := json.Marshal(patch)
+		if err != nil {
+			t.Errorf("%s: json.Marshal failed: %v", test.expr, err)
+			continue
+		}
+
+		if got := string(b); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.expr, test.want, got)
+		}
+	}
+
+	if got := data["servers"].([]interface{})[0].(map[string]interface{})["replicas"]; got != 2 {
+		t.Errorf("expected the input to be unchanged, got replicas %v", got)
+	}
+}
+
+func TestExpression_PatchStruct(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	server := applyServer{Name: "a", Env: "dev", Replicas: 1}
+
+	patch, err := comp.MustCompile(`| $ | {"env": $env} |`).Patch(server, map[string]interface{}{
+		"env": "prod",
+	})
+	if err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+
+	want := Patch{
+		{Op: "replace", Path: "/env", Value: "prod"},
+	}
+
+	if !reflect.DeepEqual(patch, want) {
+		t.Errorf("expected %v, got %v", want, patch)
+	}
+}
+
+func TestExpression_PatchErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		expr string
+		data interface{}
+		err  string
+	}{
+		{
+			expr: `$ ~> | $ | {"env": "prod"} |`,
+			data: map[string]interface{}{},
+			err:  "Patch needs a transform expression",
+		},
+		{
+			expr: `| $ | {"env": "prod"} |`,
+			err:  "Patch needs an input value",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := comp.MustCompile(test.expr).Patch(test.data, nil)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, got %v", test.expr, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Pipe returns an expression that evaluates the given
+// expressions in order, each one against the result of the one
+// before, like the ~> operator does for functions. The
+// expressions can come from different Compilers. The result can
+// be used like any other Expression, e.g. with EvalBatch or
+// NewEvaluator, and can itself be passed to Pipe to extend the
+// pipeline.
+//
+// The first expression decodes the input, as Eval would, and
+// every expression is given the same variables. If a result is
+// undefined, the rest of the pipeline is skipped and the
+// pipeline's result is undefined. Other errors are wrapped with the position of the expression that
+// failed, starting from 0. A pipeline with no expressions
+// returns its input.
+func Pipe(exprs ...*Expression) *Expression {
+
+	var stages []*Expression
+	for _, e := range exprs {
+		if len(e.stages) > 0 {
+			stages = append(stages, e.stages...)
+		} else {
+			stages = append(stages, e)
+		}
+	}
+
+	c, err := NewCompiler(nil, nil)
+	if err != nil {
+		panicf("Pipe: %s", err)
+	}
+
+	p := c.MustCompile("$")
+	p.stages = stages
+
+	return p
+}
+
+// evalStages evaluates the expressions of a pipeline and returns
+// the result of the last one, which is the input to the pipeline
+// expression itself. The result is nil if an expression's result
+// is undefined.
+func (e *Expression) evalStages(ctx context.Context, data interface{}, vars map[string]interface{}) (interface{}, error) {
+
+	for i, stage := range e.stages {
+
+		v, err := stage.EvalContext(ctx, data, vars)
+		if err == ErrUndefined {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i, err)
+		}
+
+		// Pass null on as null rather than as a nil input,
+		// which is undefined.
+		if v == nil {
+			data = reflect.ValueOf(null)
+		} else {
+			data = v
+		}
+	}
+
+	return data, nil
+}
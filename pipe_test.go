@@ -0,0 +1,129 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	orders := comp.MustCompile(`orders[status = $status]`)
+	totals := comp.MustCompile(`$.(price * qty)`)
+	sum := comp.MustCompile(`$sum($)`)
+
+	input := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"status": "open", "price": 2.0, "qty": 3.0},
+			map[string]interface{}{"status": "closed", "price": 5.0, "qty": 1.0},
+			map[string]interface{}{"status": "open", "price": 1.0, "qty": 4.0},
+		},
+	}
+	vars := map[string]interface{}{"status": "open"}
+
+	p := Pipe(orders, totals)
+	total := Pipe(p, sum)
+
+	got, err := p.Eval(input, vars)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if want := []interface{}{6.0, 4.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	got, err = total.Eval(input, vars)
+	if err != nil || got != 10.0 {
+		t.Errorf("expected 10, got %v (error %v)", got, err)
+	}
+
+	if len(p.stages) != 2 || len(total.stages) != 3 {
+		t.Errorf("expected 2 and 3 stages, got %d and %d", len(p.stages), len(total.stages))
+	}
+
+	if _, err := total.Eval(input, map[string]interface{}{"status": "lost"}); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+
+	bad := Pipe(orders, comp.MustCompile(`$number("x" & $count($))`))
+	_, err = bad.Eval(input, vars)
+
+	var eerr *EvalError
+	if !errors.As(err, &eerr) {
+		t.Errorf("expected an *EvalError, got %v", err)
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "stage 1: ") {
+		t.Errorf("expected the error to name stage 1, got %v", err)
+	}
+
+	if got, err := Pipe().Eval(input, nil); err != nil || !reflect.DeepEqual(got, input) {
+		t.Errorf("expected an empty pipeline to return its input, got %v (error %v)", got, err)
+	}
+
+	// Inputs are decoded as Eval would.
+	doc := json.RawMessage(`{"orders": [{"status": "open", "price": 2, "qty": 3}]}`)
+	if got, err := total.Eval(doc, vars); err != nil || got != 6.0 {
+		t.Errorf("expected 6 from a JSON document, got %v (error %v)", got, err)
+	}
+	if got, err := Pipe().Eval(json.RawMessage(`[1, 2]`), nil); err != nil || !reflect.DeepEqual(got, []interface{}{1.0, 2.0}) {
+		t.Errorf("expected an empty pipeline to decode its input, got %v (error %v)", got, err)
+	}
+
+	// Null is passed on as null.
+	isNull := comp.MustCompile(`$ = null`)
+	if got, err := Pipe(comp.MustCompile(`null`), isNull).Eval(input, nil); err != nil || got != true {
+		t.Errorf("expected true, got %v (error %v)", got, err)
+	}
+}
+
+func TestPipe_Expression(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	total := Pipe(comp.MustCompile(`items.price`), comp.MustCompile(`$sum($)`))
+
+	input := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": 2.0},
+			map[string]interface{}{"price": 3.0},
+		},
+	}
+
+	// A pipeline can be used wherever an Expression can.
+	res, err := total.EvalResult(context.Background(), input, nil)
+	if err != nil {
+		t.Fatalf("EvalResult failed: %v", err)
+	}
+	if v, err := res.Value(); err != nil || v != 5.0 {
+		t.Errorf("EvalResult: expected 5, got %v (error %v)", v, err)
+	}
+
+	results, err := total.EvalBatch(context.Background(), []interface{}{input, map[string]interface{}{}}, nil)
+	if err != nil || len(results) != 2 || results[0].Value != 5.0 || results[1].Err != ErrUndefined {
+		t.Errorf("EvalBatch: unexpected results %v (error %v)", results, err)
+	}
+
+	if v, err := total.NewEvaluator().Eval(input, nil); err != nil || v != 5.0 {
+		t.Errorf("Evaluator: expected 5, got %v (error %v)", v, err)
+	}
+
+	group := NewEvalGroup(map[string]*Expression{"total": total}, nil)
+	if v, err := group.Eval(input, nil); err != nil || !reflect.DeepEqual(v, map[string]interface{}{"total": 5.0}) {
+		t.Errorf("EvalGroup: unexpected result %v (error %v)", v, err)
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// The checks that PreflightAll runs.
+const (
+	// PreflightCompile reports expressions that don't compile.
+	PreflightCompile = "compile"
+
+	// PreflightComplexity reports expressions with more nodes
+	// than PreflightOptions.MaxComplexity.
+	PreflightComplexity = "complexity"
+
+	// PreflightUnknownFunction reports calls to functions that
+	// aren't built-in functions, extensions, variables of the
+	// Compiler or PreflightOptions.Vars, or variables assigned
+	// in the expression. Such calls fail when they're evaluated,
+	// unless the Compiler has WithMissingFunctions, in which case
+	// they're reported as warnings.
+	PreflightUnknownFunction = "unknown-function"
+
+	// PreflightPortability reports calls to built-in functions
+	// that jsonata-go adds to JSONata, e.g. $countIf, if
+	// PreflightOptions.Portable is set. Expressions that use
+	// them don't run in other JSONata implementations.
+	PreflightPortability = "portability"
+)
+
+// A PreflightCheck is an additional check for PreflightAll,
+// such as lint.Preflight. It's called with each expression that
+// compiles and returns the issues it finds, without the Name.
+// Checks are called from several goroutines at once.
+type PreflightCheck func(c *Compiler, expr string) []PreflightIssue
+
+// PreflightOptions control how PreflightAll checks a set of
+// expressions.
+type PreflightOptions struct {
+	// Compiler compiles the expressions. If it's nil,
+	// PreflightAll uses a Compiler with only the built-in
+	// functions.
+	Compiler *Compiler
+
+	// Vars are the names, without the leading $, of the
+	// variables that are passed to Eval. Calling one isn't an
+	// unknown function.
+	Vars []string
+
+	// MaxComplexity, if it's positive, is the largest number
+	// of nodes that an expression's syntax tree may have.
+	MaxComplexity int
+
+	// Portable turns on the portability check.
+	Portable bool
+
+	// Checks are run on each expression after the built-in
+	// checks.
+	Checks []PreflightCheck
+
+	// WarningsAsErrors makes PreflightReport.Err fail on
+	// warnings as well as errors.
+	WarningsAsErrors bool
+
+	// Parallelism is the number of expressions checked at
+	// once. The default is runtime.GOMAXPROCS(0).
+	Parallelism int
+}
+
+// A PreflightIssue is a problem found by PreflightAll.
+type PreflightIssue struct {
+	// Name is the name of the expression and Check is the
+	// check that found the problem, e.g. PreflightCompile.
+	Name    string
+	Check   string
+	Message string
+
+	// Warning is true for problems that don't stop the
+	// expression from being evaluated, such as the ones found
+	// by lint.Preflight.
+	Warning bool
+
+	// Position is the byte offset of the problem in the
+	// expression, or -1 if it isn't known. Line and Column are
+	// the 1-based line and column of the same location, with
+	// the column counted in characters.
+	Position int
+	Line     int
+	Column   int
+
+	// Err is the underlying error, if there is one, e.g. a
+	// *CompileError.
+	Err error
+}
+
+func (i PreflightIssue) String() string {
+
+	var loc string
+	if i.Position >= 0 {
+		loc = fmt.Sprintf("%d:%d: ", i.Line, i.Column)
+	}
+
+	kind := "error"
+	if i.Warning {
+		kind = "warning"
+	}
+
+	return fmt.Sprintf("%s: %s%s: %s (%s)", i.Name, loc, kind, i.Message, i.Check)
+}
+
+// A PreflightReport has the results of PreflightAll.
+type PreflightReport struct {
+	// Expressions holds the compiled expressions, keyed by
+	// name. Expressions that don't compile are omitted.
+	Expressions map[string]*Expression
+
+	// Complexity is the number of nodes in the syntax tree of
+	// each compiled expression, keyed by name.
+	Complexity map[string]int
+
+	// Issues are sorted by expression name and position.
+	Issues []PreflightIssue
+
+	warningsAsErrors bool
+}
+
+// Err returns a PreflightErrors with the issues that are errors,
+// or nil if there are none. If PreflightOptions.WarningsAsErrors
+// was set, every issue counts as an error.
+func (r *PreflightReport) Err() error {
+
+	var errs PreflightErrors
+	for _, issue := range r.Issues {
+		if !issue.Warning || r.warningsAsErrors {
+			errs = append(errs, issue)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// PreflightErrors is the error returned by PreflightReport.Err.
+type PreflightErrors []PreflightIssue
+
+func (errs PreflightErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.String()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// PreflightAll compiles and checks a set of expressions, keyed
+// by name, such as the mappings that a service loads on startup.
+// The expressions are checked concurrently and every problem is
+// collected in the report, so that a service can refuse to start
+// with a single, complete list of what's wrong:
+//
+//	report, err := jsonata.PreflightAll(mappings, &jsonata.PreflightOptions{
+//	    Compiler: compiler,
+//	    Checks:   []jsonata.PreflightCheck{lint.Preflight},
+//	})
+//	if err == nil {
+//	    err = report.Err()
+//	}
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// PreflightAll only returns an error if it can't create the
+// default Compiler; problems with the expressions are recorded in
+// the report.
+func PreflightAll(exprs map[string]string, opts *PreflightOptions) (*PreflightReport, error) {
+
+	if opts == nil {
+		opts = &PreflightOptions{}
+	}
+
+	comp := opts.Compiler
+	if comp == nil {
+		var err error
+		if comp, err = NewCompiler(nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(exprs))
+	for name := range exprs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p := &preflighter{
+		comp:  comp,
+		opts:  opts,
+		known: map[string]bool{},
+	}
+
+	for _, doc := range comp.FunctionDocs() {
+		p.known[doc.Name] = true
+	}
+	for name := range comp.baseRegistry {
+		p.known[name] = true
+	}
+	for _, name := range opts.Vars {
+		p.known[name] = true
+	}
+
+	results := make([]preflightResult, len(names))
+
+	workers := opts.Parallelism
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers && w < len(names); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = p.check(names[i], exprs[names[i]])
+			}
+		}()
+	}
+
+	for i := range names {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	report := &PreflightReport{
+		Expressions:      map[string]*Expression{},
+		Complexity:       map[string]int{},
+		warningsAsErrors: opts.WarningsAsErrors,
+	}
+
+	for i, res := range results {
+		if res.expr != nil {
+			report.Expressions[names[i]] = res.expr
+			report.Complexity[names[i]] = res.complexity
+		}
+		report.Issues = append(report.Issues, res.issues...)
+	}
+
+	return report, nil
+}
+
+type preflighter struct {
+	comp *Compiler
+	opts *PreflightOptions
+
+	// known holds the names of the functions and variables
+	// that are defined for every expression.
+	known map[string]bool
+}
+
+type preflightResult struct {
+	expr       *Expression
+	complexity int
+	issues     []PreflightIssue
+}
+
+// unsupportedFuncs are JSONata functions that jsonata-go doesn't
+// implement.
+var unsupportedFuncs = map[string]bool{
+	"assert":        true,
+	"eval":          true,
+	"formatInteger": true,
+	"parseInteger":  true,
+}
+
+// nonstandardFuncs are built-in functions that jsonata-go adds
+// to JSONata.
+var nonstandardFuncs = map[string]bool{
+	"countIf":         true,
+	"parseCsv":        true,
+	"sumIf":           true,
+	"toCsv":           true,
+	"weightedAverage": true,
+}
+
+func (p *preflighter) check(name, src string) preflightResult {
+
+	var res preflightResult
+	var k *compiledExpr
+
+	report := func(node jparse.Node, check string, warning bool, format string, a ...interface{}) {
+
+		issue := PreflightIssue{
+			Name:     name,
+			Check:    check,
+			Message:  fmt.Sprintf(format, a...),
+			Warning:  warning,
+			Position: -1,
+		}
+
+		if r, ok := k.ranges[node]; ok {
+			issue.Position = r.Start
+			issue.Line, issue.Column = lineColumn(src, r.Start)
+		}
+
+		res.issues = append(res.issues, issue)
+	}
+
+	e, err := p.comp.CompileAll(src)
+	if err != nil {
+
+		cerrs, ok := err.(CompileErrors)
+		if !ok {
+			cerrs = CompileErrors{newCompileError(err, src)}
+		}
+
+		for _, cerr := range cerrs {
+			res.issues = append(res.issues, PreflightIssue{
+				Name:     name,
+				Check:    PreflightCompile,
+				Message:  cerr.Err.Error(),
+				Position: cerr.Position,
+				Line:     cerr.Line,
+				Column:   cerr.Column,
+				Err:      cerr,
+			})
+		}
+
+		return res
+	}
+
+	res.expr = e
+	k = e.compiled()
+
+	// Names assigned anywhere in the expression are treated
+	// as defined everywhere in it.
+	bound := map[string]bool{}
+
+	jparse.Walk(k.node, func(node jparse.Node) bool {
+		res.complexity++
+		switch node := node.(type) {
+		case *jparse.AssignmentNode:
+			bound[node.Name] = true
+		case *jparse.LambdaNode:
+			for _, name := range node.ParamNames {
+				bound[name] = true
+			}
+		case *jparse.TypedLambdaNode:
+			for _, name := range node.ParamNames {
+				bound[name] = true
+			}
+		}
+		return true
+	})
+
+	if max := p.opts.MaxComplexity; max > 0 && res.complexity > max {
+		report(k.node, PreflightComplexity, false, "the expression has %d nodes, more than the limit of %d", res.complexity, max)
+	}
+
+	jparse.Walk(k.node, func(node jparse.Node) bool {
+
+		// Calls to missing functions return undefined
+		// if the Compiler allows it (see WithMissingFunctions),
+		// so they're only warnings. Partial applications
+		// still fail.
+		var fn jparse.Node
+		missingOK := p.comp.missingFuncs != nil
+		switch node := node.(type) {
+		case *jparse.FunctionCallNode:
+			fn = node.Func
+		case *jparse.PartialNode:
+			fn = node.Func
+			missingOK = false
+		case *jparse.FunctionApplicationNode:
+			fn = node.RHS
+		}
+
+		v, ok := fn.(*jparse.VariableNode)
+		if !ok || v.Name == "" || v.Name == "$" || bound[v.Name] {
+			return true
+		}
+
+		switch {
+		case !p.known[v.Name] && unsupportedFuncs[v.Name]:
+			report(v, PreflightUnknownFunction, missingOK, "$%s is a JSONata function that jsonata-go doesn't support", v.Name)
+		case !p.known[v.Name]:
+			report(v, PreflightUnknownFunction, missingOK, "$%s is not defined", v.Name)
+		case p.opts.Portable && nonstandardFuncs[v.Name] && p.isBuiltin(v.Name):
+			report(v, PreflightPortability, true, "$%s is not a standard JSONata function", v.Name)
+		}
+
+		return true
+	})
+
+	for _, check := range p.opts.Checks {
+		for _, issue := range check(p.comp, src) {
+			issue.Name = name
+			res.issues = append(res.issues, issue)
+		}
+	}
+
+	sort.SliceStable(res.issues, func(i, j int) bool {
+		return res.issues[i].Position < res.issues[j].Position
+	})
+
+	return res
+}
+
+// isBuiltin returns true if name is a built-in function that
+// hasn't been replaced by an extension.
+func (p *preflighter) isBuiltin(name string) bool {
+	_, ok := p.comp.baseRegistry[name]
+	return !ok
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPreflightAll(t *testing.T) {
+
+	comp, err := NewCompiler(map[string]interface{}{
+		"rate": 1.5,
+	}, map[string]Extension{
+		"slug": {Func: strings.ToLower},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	exprs := map[string]string{
+		"ok":          `$slug(name) & $string(rate)`,
+		"vars":        `$fx(price)`,
+		"bound":       `($f := function($s){ $uppercase($s) }; $f(name) ~> $trim)`,
+		"lambda":      `function($g){ $g(1) }`,
+		"invalid":     `($x := ; $y := )`,
+		"unknown":     "name &\n  $nosuch(\"a\")",
+		"unsupported": `$formatInteger(123, "w")`,
+		"apply":       `name ~> $nosuch`,
+		"partial":     `$nosuch(?, 1)`,
+		"portable":    `$countIf(items, function($v){ $v > 1 })`,
+		"complex":     `[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12]`,
+	}
+
+	report, err := PreflightAll(exprs, &PreflightOptions{
+		Compiler:      comp,
+		Vars:          []string{"fx"},
+		MaxComplexity: 12,
+		Portable:      true,
+		Parallelism:   3,
+	})
+	if err != nil {
+		t.Fatalf("PreflightAll failed: %v", err)
+	}
+
+	var got []string
+	for _, issue := range report.Issues {
+		got = append(got, issue.String())
+	}
+
+	want := []string{
+		`apply: 1:9: error: $nosuch is not defined (unknown-function)`,
+		`complex: 1:1: error: the expression has 13 nodes, more than the limit of 12 (complexity)`,
+		`invalid: 1:8: error: the symbol ';' cannot be used as a prefix operator (compile)`,
+		`invalid: 1:16: error: the symbol ')' cannot be used as a prefix operator (compile)`,
+		`partial: 1:1: error: $nosuch is not defined (unknown-function)`,
+		`portable: 1:1: warning: $countIf is not a standard JSONata function (portability)`,
+		`unknown: 2:3: error: $nosuch is not defined (unknown-function)`,
+		`unsupported: 1:1: error: $formatInteger is a JSONata function that jsonata-go doesn't support (unknown-function)`,
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if len(report.Expressions) != len(exprs)-1 {
+		t.Errorf("expected %d compiled expressions, got %d", len(exprs)-1, len(report.Expressions))
+	}
+	if _, ok := report.Expressions["invalid"]; ok {
+		t.Errorf("expected no expression for an invalid expression")
+	}
+	if n := report.Complexity["complex"]; n != 13 {
+		t.Errorf("expected a complexity of 13, got %d", n)
+	}
+
+	var cerr *CompileError
+	for _, issue := range report.Issues {
+		if issue.Check == PreflightCompile && !errors.As(issue.Err, &cerr) {
+			t.Errorf("expected a CompileError, got %v", issue.Err)
+		}
+	}
+
+	var errs PreflightErrors
+	if !errors.As(report.Err(), &errs) || len(errs) != len(want)-1 {
+		t.Errorf("expected %d errors, got %v", len(want)-1, report.Err())
+	}
+}
+
+func TestPreflightAll_Checks(t *testing.T) {
+
+	exprs := map[string]string{}
+	for i := 0; i < 20; i++ {
+		exprs[fmt.Sprintf("expr%02d", i)] = fmt.Sprintf(`$string(%d)`, i)
+	}
+
+	check := func(c *Compiler, expr string) []PreflightIssue {
+		if expr != `$string(7)` {
+			return nil
+		}
+		return []PreflightIssue{{
+			Check:    "seven",
+			Message:  "no sevens",
+			Warning:  true,
+			Position: 8,
+			Line:     1,
+			Column:   9,
+		}}
+	}
+
+	report, err := PreflightAll(exprs, &PreflightOptions{
+		Checks: []PreflightCheck{check},
+	})
+	if err != nil {
+		t.Fatalf("PreflightAll failed: %v", err)
+	}
+
+	if len(report.Issues) != 1 || report.Issues[0].Name != "expr07" {
+		t.Fatalf("expected one issue for expr07, got %v", report.Issues)
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("expected warnings not to be errors, got %v", err)
+	}
+
+	report, err = PreflightAll(exprs, &PreflightOptions{
+		Checks:           []PreflightCheck{check},
+		WarningsAsErrors: true,
+	})
+	if err != nil {
+		t.Fatalf("PreflightAll failed: %v", err)
+	}
+
+	want := "expr07: 1:9: warning: no sevens (seven)"
+	if err := report.Err(); err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+
+	// A nil options and empty corpus is fine.
+	report, err = PreflightAll(nil, nil)
+	if err != nil || len(report.Issues) != 0 || report.Err() != nil {
+		t.Errorf("expected an empty report, got %v, %v", report, err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// SetPrelude sets the definitions that are shared by the
+// expressions compiled by c, so that a common header of
+// variables and functions doesn't have to be repeated in each
+// one. The prelude is a block of assignments, e.g.
+//
+//	c.SetPrelude(`(
+//		$vat := 0.2;
+//		$gross := function($net) { $net * (1 + $vat) };
+//	)`)
+//
+// after which expressions can use $vat and $gross as if they
+// had defined them themselves. A prelude that isn't a block of
+// assignments, or a single assignment, is a compile error.
+//
+// The prelude is parsed and checked once, when it's set, and
+// its definitions are evaluated in order at the start of each
+// evaluation, before the expression, with the same input and
+// limits. A variable passed to Eval replaces the definition with
+// the same name. SetPrelude replaces any previous prelude, and
+// an empty expr removes it. It applies to expressions compiled
+// after it's called and must not be called at the same time as
+// Compile.
+func (c *Compiler) SetPrelude(expr string) error {
+
+	if c.frozen {
+		return errDefaultFrozen()
+	}
+
+	if expr == "" {
+		c.prelude = nil
+		return nil
+	}
+
+	node, ranges, expr, errs := c.compileNode(expr, false)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	defs, bad := preludeDefs(node)
+	if bad != nil {
+		err := newCompileError(fmt.Errorf("the prelude can only contain assignments"), expr)
+		if r, ok := ranges[bad]; ok {
+			err.Token = expr[r.Start:r.End]
+			err.Position = r.Start
+			err.Line, err.Column = lineColumn(expr, r.Start)
+			err.SourceLine = sourceLine(expr, r.Start)
+		}
+		return err
+	}
+
+	if errs := c.checkLibraries(node, expr, ranges); len(errs) > 0 {
+		return errs[0]
+	}
+
+	c.prelude = &prelude{
+		defs:      defs,
+		libraries: c.linkLibraries(node),
+	}
+
+	return nil
+}
+
+// WithPrelude sets the definitions that are shared by the
+// compiler's expressions, as SetPrelude does, for compilers
+// that are only set up with options.
+func WithPrelude(expr string) CompilerOption {
+	return func(c *Compiler) error {
+		return c.SetPrelude(expr)
+	}
+}
+
+// A prelude holds the definitions set with SetPrelude.
+type prelude struct {
+	defs []*jparse.AssignmentNode
+
+	// libraries are the libraries that the definitions use
+	// (see RegisterLibrary).
+	libraries []*library
+}
+
+// preludeDefs returns the assignments in the syntax tree of a
+// prelude or, if it contains anything else, the first node that
+// isn't an assignment.
+func preludeDefs(root jparse.Node) ([]*jparse.AssignmentNode, jparse.Node) {
+
+	nodes := []jparse.Node{root}
+	if block, ok := root.(*jparse.BlockNode); ok {
+		nodes = block.Exprs
+	}
+
+	defs := make([]*jparse.AssignmentNode, len(nodes))
+
+	for i, node := range nodes {
+		def, ok := node.(*jparse.AssignmentNode)
+		if !ok {
+			return nil, node
+		}
+		defs[i] = def
+	}
+
+	return defs, nil
+}
+
+// defines returns true if the prelude assigns a variable.
+func (p *prelude) defines(name string) bool {
+
+	if p == nil {
+		return false
+	}
+
+	for _, def := range p.defs {
+		if def.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eval binds the prelude's definitions in env, skipping the
+// names in vars.
+func (p *prelude) eval(input reflect.Value, env *environment, vars map[string]reflect.Value) error {
+
+	if p == nil {
+		return nil
+	}
+
+	for _, def := range p.defs {
+
+		if _, ok := vars[def.Name]; ok {
+			continue
+		}
+
+		if _, err := eval(def, input, env); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompiler_SetPrelude(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.SetPrelude(`(
+		$vat := 0.2;
+		$gross := function($net) { $net * (1 + $vat) };
+		$total := $sum(items.price);
+	)`)
+	if err != nil {
+		t.Fatalf("SetPrelude failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": 10.0},
+			map[string]interface{}{"price": 20.0},
+		},
+	}
+
+	tests := []struct {
+		expr string
+		vars map[string]interface{}
+		want interface{}
+	}{
+		{
+			expr: `$gross(100)`,
+			want: 120.0,
+		},
+		{
+			expr: `$total`,
+			want: 30.0,
+		},
+		{
+			expr: `items.$gross(price)`,
+			want: []interface{}{12.0, 24.0},
+		},
+		{
+			expr: `($vat := 0.5; $vat)`,
+			want: 0.5,
+		},
+		{
+			// A variable passed to Eval replaces a definition,
+			// including in the definitions that follow it.
+			expr: `$gross(100)`,
+			vars: map[string]interface{}{"vat": 0.5},
+			want: 150.0,
+		},
+	}
+
+	for _, test := range tests {
+		e, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		got, err := e.Eval(input, test.vars)
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+	}
+
+	// Expressions keep the prelude that they were compiled with.
+	e := comp.MustCompile(`$vat`)
+
+	if err := comp.SetPrelude(""); err != nil {
+		t.Fatalf("SetPrelude failed: %v", err)
+	}
+
+	if got, err := e.Eval(nil, nil); err != nil || got != 0.2 {
+		t.Errorf("expected 0.2, got %v (error %v)", got, err)
+	}
+	if _, err := comp.MustCompile(`$vat`).Eval(nil, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined without a prelude, got %v", err)
+	}
+}
+
+func TestCompiler_SetPreludeErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil, WithDisabledFunctions("random"))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.SetPrelude(`($a := 1; $b := $a + 1; $a + $b)`)
+
+	var cerr *CompileError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected a *CompileError, got %v", err)
+	}
+	if cerr.Position != 24 {
+		t.Errorf("expected the error at position 24, got %d", cerr.Position)
+	}
+
+	if err := comp.SetPrelude(`($r := $random())`); err == nil {
+		t.Errorf("expected a disabled function in the prelude to fail")
+	}
+
+	if err := comp.SetPrelude(`$a := (`); err == nil {
+		t.Errorf("expected a syntax error")
+	}
+
+	// A prelude definition replaces a disabled function.
+	if err := comp.SetPrelude(`$random := function() { 4 }`); err != nil {
+		t.Fatalf("SetPrelude failed: %v", err)
+	}
+	got, err := comp.MustCompile(`$random()`).Eval(nil, nil)
+	if err != nil || got != 4.0 {
+		t.Errorf("expected 4, got %v (error %v)", got, err)
+	}
+
+	// Definitions are evaluated with each evaluation, so their
+	// errors are evaluation errors.
+	if err := comp.SetPrelude(`$n := $number("x")`); err != nil {
+		t.Fatalf("SetPrelude failed: %v", err)
+	}
+	if _, err := comp.MustCompile(`1`).Eval(nil, nil); err == nil {
+		t.Errorf("expected the prelude's error")
+	}
+}
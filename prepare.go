@@ -0,0 +1,163 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A PreparedInput is an input document that has been converted
+// once, by PrepareInput, so that it can be evaluated many times
+// without reading its Go values again. Pass it to Eval, or to any
+// other method that takes an input, in place of the document. A
+// PreparedInput can be shared by concurrent evaluations.
+type PreparedInput struct {
+	value reflect.Value
+}
+
+// PrepareInput converts data to the generic form that the
+// evaluator reads fastest, for documents that are evaluated by
+// many expressions. Structs are converted to maps, as the
+// evaluator reads them (see jtypes.StructFieldNames), other maps
+// and slices to map[string]interface{} and []interface{}, and
+// pointers are followed. Times and values with the compiler's
+// value converters are converted as they would be on access
+// (see RegisterValueConverter). Strings, numbers, booleans and
+// LazyArrays are kept as they are.
+//
+// The result can be evaluated by expressions from other
+// Compilers, but their value converters aren't applied to it
+// again. A value that contains itself is a *CycleError. data
+// must not be modified while PrepareInput runs, and changes
+// made to it afterwards aren't seen by the PreparedInput.
+func (c *Compiler) PrepareInput(data interface{}) (*PreparedInput, error) {
+
+	if p, ok := data.(*PreparedInput); ok {
+		return p, nil
+	}
+
+	v := reflect.ValueOf(data)
+	if !v.IsValid() {
+		return &PreparedInput{}, nil
+	}
+
+	res, err := prepareValue(v, c.converters, &cycleChecker{})
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil {
+		return &PreparedInput{value: reflect.ValueOf(null)}, nil
+	}
+
+	return &PreparedInput{value: reflect.ValueOf(res)}, nil
+}
+
+// Value returns the converted document, e.g. to pass to
+// Normalize or to compare with a result. It must not be
+// modified.
+func (p *PreparedInput) Value() interface{} {
+	v, _ := exportResult(p.value)
+	return v
+}
+
+func prepareValue(v reflect.Value, cs valueConverters, cycles *cycleChecker) (interface{}, error) {
+
+	v = cs.convert(v)
+
+	if isLazyArray(v) {
+		return v.Interface(), nil
+	}
+
+	if err := cycles.enter(v); err != nil {
+		return nil, err
+	}
+	defer cycles.leave(v)
+
+	v = jtypes.Resolve(v)
+
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	// Nil pointers, maps and slices keep their types so that
+	// they're read as they would be in data.
+	if isNilValue(v) && v.CanInterface() {
+		return v.Interface(), nil
+	}
+
+	switch {
+	case v.Type() == typeJSONNumber:
+		return v.Interface(), nil
+	case jtypes.IsArray(v):
+		return prepareArray(v, cs, cycles)
+	case jtypes.IsMap(v):
+		return prepareMap(v, cs, cycles)
+	case jtypes.IsStruct(v):
+		return prepareStruct(v, cs, cycles)
+	case v.CanInterface():
+		return v.Interface(), nil
+	default:
+		return nil, fmt.Errorf("cannot prepare a value of type %s", v.Type())
+	}
+}
+
+func prepareArray(v reflect.Value, cs valueConverters, cycles *cycleChecker) (interface{}, error) {
+
+	results := make([]interface{}, v.Len())
+
+	for i := range results {
+		res, err := prepareValue(v.Index(i), cs, cycles)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = res
+	}
+
+	return results, nil
+}
+
+func prepareMap(v reflect.Value, cs valueConverters, cycles *cycleChecker) (interface{}, error) {
+
+	results := make(map[string]interface{}, v.Len())
+
+	for _, k := range v.MapKeys() {
+
+		key, ok := jtypes.AsString(k)
+		if !ok {
+			return nil, fmt.Errorf("object key must be a string, got %v (%s)", k, k.Kind())
+		}
+
+		res, err := prepareValue(v.MapIndex(k), cs, cycles)
+		if err != nil {
+			return nil, err
+		}
+		results[key] = res
+	}
+
+	return results, nil
+}
+
+func prepareStruct(v reflect.Value, cs valueConverters, cycles *cycleChecker) (interface{}, error) {
+
+	results := map[string]interface{}{}
+	var err error
+
+	jtypes.EachStructField(v, func(name string, v reflect.Value) {
+		if err != nil {
+			return
+		}
+		results[name], err = prepareValue(v, cs, cycles)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type prepareCents int64
+
+type prepareLine struct {
+	SKU   string       `json:"sku"`
+	Qty   int          `json:"qty"`
+	Price prepareCents `json:"price"`
+}
+
+type prepareOrder struct {
+	ID      string         `json:"id"`
+	Placed  time.Time      `json:"placed"`
+	Lines   []prepareLine  `json:"lines"`
+	Notes   []string       `json:"notes"`
+	Parent  *prepareOrder  `json:"parent"`
+	Tags    map[string]int `json:"tags"`
+	private string
+}
+
+func TestCompiler_PrepareInput(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	err = comp.RegisterValueConverter(reflect.TypeOf(prepareCents(0)), func(v interface{}) interface{} {
+		return float64(v.(prepareCents)) / 100
+	})
+	if err != nil {
+		t.Fatalf("RegisterValueConverter failed: %v", err)
+	}
+
+	order := &prepareOrder{
+		ID:     "o1",
+		Placed: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Lines: []prepareLine{
+			{SKU: "a", Qty: 2, Price: 150},
+			{SKU: "b", Qty: 1, Price: 99},
+		},
+		Tags:    map[string]int{"x": 1},
+		private: "hidden",
+	}
+
+	p, err := comp.PrepareInput(order)
+	if err != nil {
+		t.Fatalf("PrepareInput failed: %v", err)
+	}
+
+	exprs := []string{
+		`id`,
+		`placed`,
+		`lines[qty > 1].sku`,
+		`$sum(lines.(price * qty))`,
+		`notes`,
+		`parent`,
+		`parent.id`,
+		`tags.x`,
+		`private`,
+		`$count(*)`,
+		`**.sku`,
+	}
+
+	for _, expr := range exprs {
+		e := comp.MustCompile(expr)
+
+		want, wantErr := e.Eval(order, nil)
+		got, gotErr := e.Eval(p, nil)
+
+		if !reflect.DeepEqual(got, want) || !sameError(gotErr, wantErr) {
+			t.Errorf("%s: expected %v (error %v), got %v (error %v)", expr, want, wantErr, got, gotErr)
+		}
+	}
+
+	// Preparing a prepared input returns it unchanged.
+	if q, err := comp.PrepareInput(p); err != nil || q != p {
+		t.Errorf("expected the same PreparedInput, got %p (error %v)", q, err)
+	}
+
+	v, ok := p.Value().(map[string]interface{})
+	if !ok || v["placed"] != "2020-01-02T03:04:05.000Z" {
+		t.Errorf("expected a map with the time as a string, got %v", p.Value())
+	}
+
+	p, err = comp.PrepareInput(nil)
+	if err != nil || p.Value() != nil {
+		t.Fatalf("expected an undefined input, got %v (error %v)", p.Value(), err)
+	}
+	if _, err := comp.MustCompile(`$`).Eval(p, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+
+	order.Parent = order
+
+	var cerr *CycleError
+	if _, err := comp.PrepareInput(order); !errors.As(err, &cerr) {
+		t.Errorf("expected a *CycleError, got %v", err)
+	}
+}
+
+func sameError(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Error() == b.Error()
+}
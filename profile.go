@@ -0,0 +1,287 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// A Profile records how often the nodes of expressions are
+// evaluated and how long they take, over any number of
+// evaluations (see WithProfile). It's safe for concurrent use.
+type Profile struct {
+	mu    sync.Mutex
+	evals int
+	nodes map[jparse.Node]*ProfileNode
+	funcs map[string]*ProfileFunc
+}
+
+// NewProfile returns an empty Profile.
+func NewProfile() *Profile {
+	return &Profile{
+		nodes: map[jparse.Node]*ProfileNode{},
+		funcs: map[string]*ProfileFunc{},
+	}
+}
+
+// ProfileNode holds the statistics for one node of an
+// expression.
+type ProfileNode struct {
+	// Source is the whole expression that the node belongs to.
+	Source string
+
+	// Type, Expr, Start and End describe the node like the
+	// fields of a TraceStep.
+	Type  string
+	Expr  string
+	Start int
+	End   int
+
+	// Count is the number of times the node was evaluated.
+	// Total is the time spent evaluating it, including its
+	// operands, and Self is Total less the time spent
+	// evaluating its operands.
+	Count int
+	Total time.Duration
+	Self  time.Duration
+}
+
+// ProfileFunc holds the statistics for a built-in function,
+// extension or lambda that's called by name, e.g. $sum(x).
+type ProfileFunc struct {
+	// Name is the function's name, without the leading $.
+	Name string
+
+	// Count is the number of calls and Time is the time spent
+	// in them, not counting the evaluation of their arguments.
+	Count int
+	Time  time.Duration
+}
+
+// A ProfileReport is a snapshot of a Profile. Nodes are sorted
+// by Self time and Functions by Time, most expensive first.
+type ProfileReport struct {
+	Evaluations int
+	Nodes       []ProfileNode
+	Functions   []ProfileFunc
+}
+
+// WithProfile records the evaluations of the expressions that
+// the Compiler compiles in p. Profiling adds overhead to every
+// node that's evaluated. So that the time spent in each node can
+// be measured, evaluations that are profiled don't use
+// WithParallelism and call batched extensions one at a time.
+//
+// The time of nodes that an optimization evaluates without
+// visiting them individually, such as the steps of simple paths
+// of field names, is counted in the node that contains them.
+func WithProfile(p *Profile) CompilerOption {
+	return func(c *Compiler) error {
+		c.profile = p
+		return nil
+	}
+}
+
+// Report returns the statistics recorded so far.
+func (p *Profile) Report() *ProfileReport {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := &ProfileReport{
+		Evaluations: p.evals,
+		Nodes:       make([]ProfileNode, 0, len(p.nodes)),
+		Functions:   make([]ProfileFunc, 0, len(p.funcs)),
+	}
+
+	for _, n := range p.nodes {
+		r.Nodes = append(r.Nodes, *n)
+	}
+	for _, f := range p.funcs {
+		r.Functions = append(r.Functions, *f)
+	}
+
+	sort.Slice(r.Nodes, func(i, j int) bool {
+		a, b := r.Nodes[i], r.Nodes[j]
+		switch {
+		case a.Self != b.Self:
+			return a.Self > b.Self
+		case a.Source != b.Source:
+			return a.Source < b.Source
+		default:
+			return a.Start < b.Start
+		}
+	})
+
+	sort.Slice(r.Functions, func(i, j int) bool {
+		a, b := r.Functions[i], r.Functions[j]
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		return a.Name < b.Name
+	})
+
+	return r
+}
+
+// Reset discards the statistics recorded so far.
+func (p *Profile) Reset() {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.evals = 0
+	p.nodes = map[jparse.Node]*ProfileNode{}
+	p.funcs = map[string]*ProfileFunc{}
+}
+
+// String returns the report as a table of nodes and a table of
+// functions.
+func (r *ProfileReport) String() string {
+	return r.Top(len(r.Nodes) + len(r.Functions))
+}
+
+// Top is like String but lists at most n nodes and n functions.
+func (r *ProfileReport) Top(n int) string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%d evaluations\n", r.Evaluations)
+
+	fmt.Fprintf(&b, "%12s %12s %8s  %s\n", "self", "total", "count", "node")
+	for i, node := range r.Nodes {
+		if i == n {
+			break
+		}
+		fmt.Fprintf(&b, "%12s %12s %8d  %d-%d %s\n", node.Self, node.Total, node.Count, node.Start, node.End, node.Expr)
+	}
+
+	if len(r.Functions) > 0 {
+		fmt.Fprintf(&b, "%12s %12s %8s  %s\n", "time", "", "calls", "function")
+		for i, f := range r.Functions {
+			if i == n {
+				break
+			}
+			fmt.Fprintf(&b, "%12s %12s %8d  $%s\n", f.Time, "", f.Count, f.Name)
+		}
+	}
+
+	return b.String()
+}
+
+// A profileRecorder records the nodes evaluated during a single
+// evaluation. It's merged into the Profile at the end.
+type profileRecorder struct {
+	profile *Profile
+	src     string
+	ranges  map[jparse.Node]jparse.Range
+
+	nodes map[jparse.Node]*profileStat
+
+	// children holds the time spent in the operands of each
+	// node that's being evaluated.
+	children []time.Duration
+}
+
+type profileStat struct {
+	count       int
+	total, self time.Duration
+}
+
+func newProfileRecorder(p *Profile, src string, ranges map[jparse.Node]jparse.Range) *profileRecorder {
+	if p == nil {
+		return nil
+	}
+	return &profileRecorder{
+		profile: p,
+		src:     src,
+		ranges:  ranges,
+		nodes:   map[jparse.Node]*profileStat{},
+	}
+}
+
+// profiling returns true if the evaluation is being profiled.
+func (s *environment) profiling() bool {
+	return s != nil && s.state != nil && s.state.profile != nil
+}
+
+// eval evaluates a node and records its statistics.
+func (r *profileRecorder) eval(node jparse.Node, input reflect.Value, env *environment) (reflect.Value, error) {
+
+	r.children = append(r.children, 0)
+	start := time.Now()
+
+	v, err := evalNode(node, input, env)
+
+	total := time.Since(start)
+	n := len(r.children) - 1
+	self := total - r.children[n]
+	r.children = r.children[:n]
+	if n > 0 {
+		r.children[n-1] += total
+	}
+
+	stat := r.nodes[node]
+	if stat == nil {
+		stat = &profileStat{}
+		r.nodes[node] = stat
+	}
+	stat.count++
+	stat.total += total
+	stat.self += self
+
+	return v, err
+}
+
+// merge adds the evaluation's statistics to the Profile.
+func (r *profileRecorder) merge() {
+
+	p := r.profile
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.evals++
+
+	for node, stat := range r.nodes {
+
+		pn := p.nodes[node]
+		if pn == nil {
+			pn = &ProfileNode{
+				Source: r.src,
+				Type:   nodeType(node),
+			}
+			pn.Expr, pn.Start, pn.End = nodeSource(node, r.src, r.ranges)
+			p.nodes[node] = pn
+		}
+		pn.Count += stat.count
+		pn.Total += stat.total
+		pn.Self += stat.self
+
+		call, ok := node.(*jparse.FunctionCallNode)
+		if !ok {
+			continue
+		}
+		sym, ok := call.Func.(*jparse.VariableNode)
+		if !ok || sym.Name == "" {
+			continue
+		}
+
+		pf := p.funcs[sym.Name]
+		if pf == nil {
+			pf = &ProfileFunc{Name: sym.Name}
+			p.funcs[sym.Name] = pf
+		}
+		pf.Count += stat.count
+		pf.Time += stat.self
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompiler_WithProfile(t *testing.T) {
+
+	setMinParallelItems(t, 2)
+
+	p := NewProfile()
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"slow": {Func: func(n float64) float64 {
+			time.Sleep(2 * time.Millisecond)
+			return n
+		}},
+	}, WithProfile(p), WithParallelism(4))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`$sum(items.$slow(price)) + $count(items)`)
+
+	input := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": 1},
+			map[string]interface{}{"price": 2},
+			map[string]interface{}{"price": 3},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		v, err := e.Eval(input, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v != float64(9) {
+			t.Fatalf("expected 9, got %v", v)
+		}
+	}
+
+	r := p.Report()
+
+	if r.Evaluations != 2 {
+		t.Errorf("expected 2 evaluations, got %d", r.Evaluations)
+	}
+
+	// The calls to $slow are the most expensive node.
+	if len(r.Nodes) == 0 || r.Nodes[0].Expr != "$slow(price)" {
+		t.Fatalf("expected $slow(price) to be first, got:\n%s", r)
+	}
+
+	top := r.Nodes[0]
+	if top.Type != "FunctionCall" || top.Count != 6 || top.Start != 11 || top.End != 23 {
+		t.Errorf("unexpected node %+v", top)
+	}
+	if top.Self < 12*time.Millisecond || top.Total < top.Self {
+		t.Errorf("expected at least 12ms in $slow, got self %s, total %s", top.Self, top.Total)
+	}
+
+	counts := map[string]int{}
+	for _, f := range r.Functions {
+		counts[f.Name] = f.Count
+	}
+	if counts["slow"] != 6 || counts["sum"] != 2 || counts["count"] != 2 {
+		t.Errorf("unexpected function counts %v", counts)
+	}
+	if f := r.Functions[0]; f.Name != "slow" || f.Time < 12*time.Millisecond {
+		t.Errorf("expected $slow to be the most expensive function, got %+v", f)
+	}
+
+	// The whole expression's total covers the $slow calls.
+	for _, node := range r.Nodes {
+		if node.Start == 0 && node.End == len(e.source) && node.Total < top.Total {
+			t.Errorf("expected the root total to be at least %s, got %s", top.Total, node.Total)
+		}
+	}
+
+	if s := r.Top(1); strings.Count(s, "\n") != 5 || !strings.Contains(s, "$slow(price)") || !strings.Contains(s, "$slow\n") {
+		t.Errorf("unexpected report:\n%s", s)
+	}
+
+	p.Reset()
+	if r := p.Report(); r.Evaluations != 0 || len(r.Nodes) != 0 || len(r.Functions) != 0 {
+		t.Errorf("expected an empty report after Reset, got:\n%s", r)
+	}
+}
+
+func TestCompiler_WithProfileOperators(t *testing.T) {
+
+	p := NewProfile()
+
+	comp, err := NewCompiler(nil, nil, WithProfile(p))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	if _, err := comp.MustCompile(`(1 + 2) * 3 > 0 and true`).Eval(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Every operand is profiled.
+	exprs := map[string]bool{}
+	for _, node := range p.Report().Nodes {
+		exprs[node.Expr] = true
+	}
+	for _, expr := range []string{"1 + 2", "(1 + 2) * 3", "(1 + 2) * 3 > 0", "true"} {
+		if !exprs[expr] {
+			t.Errorf("expected %q in the profile, got %v", expr, exprs)
+		}
+	}
+}
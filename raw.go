@@ -0,0 +1,591 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// decodeInput decodes an input passed to Eval as a JSON document,
+// i.e. a json.RawMessage or a []byte. Only the parts of the
+// document that the expression can read are decoded (see
+// rawPlan). Other inputs are returned unchanged.
+func (e *Expression) decodeInput(data interface{}, vars map[string]interface{}) (interface{}, error) {
+
+	// The first stage of a pipeline decodes its own input.
+	if len(e.stages) > 0 {
+		return data, nil
+	}
+
+	var b []byte
+
+	switch data := data.(type) {
+	case json.RawMessage:
+		b = data
+	case []byte:
+		b = data
+	default:
+		return data, nil
+	}
+
+	return e.raw.decode(b, vars)
+}
+
+// A rawPlan records the fields of its input that an expression
+// reads, so that a JSON document can be decoded without the
+// fields that it doesn't. An expression can read its whole input,
+// e.g. with $ or *, or call a function that does, in which case
+// the whole document is decoded.
+type rawPlan struct {
+	fields rawFields
+	whole  bool
+
+	// builtins are the built-in functions that the plan assumes
+	// don't read the input. If the variables of an evaluation
+	// replace one of them, the whole document is decoded.
+	builtins []string
+}
+
+// rawFields is a tree of field names. A name that maps to nil
+// is decoded with all of its fields. The names apply to the
+// items of arrays, as they do in a path.
+type rawFields map[string]rawFields
+
+// add adds a path of field names to the tree.
+func (f rawFields) add(names []string) {
+
+	for i, name := range names {
+
+		sub, ok := f[name]
+		if ok && sub == nil {
+			return
+		}
+
+		if i == len(names)-1 {
+			f[name] = nil
+			return
+		}
+
+		if !ok {
+			sub = rawFields{}
+			f[name] = sub
+		}
+		f = sub
+	}
+}
+
+// newRawPlan returns the rawPlan for an expression.
+func (e *Expression) newRawPlan(node jparse.Node) *rawPlan {
+
+	a := &rawAnalysis{
+		plan: &rawPlan{
+			fields: rawFields{},
+		},
+		bound: map[string]bool{},
+		base:  e.baseRegistry,
+	}
+
+	// Library functions are evaluated against the input.
+	if len(e.libraries) > 0 {
+		a.plan.whole = true
+		return a.plan
+	}
+
+	// As with the optimized backend, a syntax tree that the
+	// analysis can't handle is decoded in full.
+	defer func() {
+		if r := recover(); r != nil {
+			a.plan.whole = true
+		}
+	}()
+
+	roots := []jparse.Node{node}
+	if e.prelude != nil {
+		for _, def := range e.prelude.defs {
+			roots = append(roots, def)
+		}
+	}
+
+	for _, root := range roots {
+		a.bind(root)
+	}
+	for _, root := range roots {
+		a.input(root)
+	}
+
+	return a.plan
+}
+
+// A rawAnalysis finds the fields that an expression reads from
+// its input.
+type rawAnalysis struct {
+	plan  *rawPlan
+	bound map[string]bool
+	base  map[string]reflect.Value
+	seen  map[string]bool
+}
+
+// bind records the names that an expression assigns or uses as
+// parameters, which can't be assumed to be built-in functions.
+func (a *rawAnalysis) bind(root jparse.Node) {
+	jparse.Walk(root, func(node jparse.Node) bool {
+		switch node := node.(type) {
+		case *jparse.AssignmentNode:
+			a.bound[node.Name] = true
+		case *jparse.LambdaNode:
+			for _, name := range node.ParamNames {
+				a.bound[name] = true
+			}
+		case *jparse.TypedLambdaNode:
+			for _, name := range node.ParamNames {
+				a.bound[name] = true
+			}
+		}
+		return true
+	})
+}
+
+// input analyses a node that is evaluated against the input
+// of the expression.
+func (a *rawAnalysis) input(node jparse.Node) {
+
+	if a.plan.whole || node == nil {
+		return
+	}
+
+	switch node := node.(type) {
+	case *jparse.NameNode:
+		a.plan.fields.add([]string{node.Value})
+	case *jparse.PathNode:
+		a.path(node.Steps)
+	case *jparse.VariableNode:
+		if node.Name == "" || node.Name == "$" || a.usesContext(node.Name, 0) {
+			a.plan.whole = true
+		}
+	case *jparse.WildcardNode, *jparse.DescendentNode, *jparse.PartialNode:
+		a.plan.whole = true
+	case *jparse.PredicateNode:
+		a.input(node.Expr)
+		a.items(node.Filters...)
+	case *jparse.SortNode:
+		a.input(node.Expr)
+		for _, term := range node.Terms {
+			a.items(term.Expr)
+		}
+	case *jparse.GroupNode:
+		a.input(node.Expr)
+		a.items(node.ObjectNode)
+	case *jparse.FunctionCallNode:
+		a.call(node.Func, len(node.Args))
+		for _, arg := range node.Args {
+			a.input(arg)
+		}
+	case *jparse.FunctionApplicationNode:
+		a.input(node.LHS)
+		switch rhs := node.RHS.(type) {
+		case *jparse.FunctionCallNode:
+			a.call(rhs.Func, len(rhs.Args)+1)
+			for _, arg := range rhs.Args {
+				a.input(arg)
+			}
+		case *jparse.VariableNode:
+			a.call(rhs, 1)
+		default:
+			a.input(rhs)
+		}
+	case *jparse.TypedLambdaNode:
+		// A contextable parameter is passed the input.
+		if len(node.In) > 0 && node.In[0].Option == jparse.ParamContextable {
+			a.plan.whole = true
+			return
+		}
+		a.input(node.Body)
+	case *jparse.ObjectTransformationNode:
+		// A transform is evaluated against its argument.
+		a.items(jparse.Children(node)...)
+	default:
+		for _, child := range jparse.Children(node) {
+			a.input(child)
+		}
+	}
+}
+
+// path analyses the steps of a path that is evaluated against
+// the input. The leading names are recorded as a path of fields
+// and the steps that follow them are evaluated against the
+// fields' values, all of which are decoded.
+func (a *rawAnalysis) path(steps []jparse.Node) {
+
+	// A path that starts with $ or $$ reads the input.
+	for len(steps) > 0 {
+		v, ok := steps[0].(*jparse.VariableNode)
+		if !ok || (v.Name != "" && v.Name != "$") {
+			break
+		}
+		steps = steps[1:]
+	}
+
+	if len(steps) == 0 {
+		a.plan.whole = true
+		return
+	}
+
+	var names []string
+	i := 0
+
+loop:
+	for ; i < len(steps); i++ {
+		switch step := steps[i].(type) {
+		case *jparse.NameNode:
+			names = append(names, step.Value)
+		case *jparse.PredicateNode:
+			if name, ok := step.Expr.(*jparse.NameNode); ok {
+				names = append(names, name.Value)
+				a.items(step.Filters...)
+				i++
+			}
+			break loop
+		default:
+			break loop
+		}
+	}
+
+	if len(names) == 0 {
+		a.input(steps[0])
+		i = 1
+	} else {
+		a.plan.fields.add(names)
+	}
+
+	a.items(steps[i:]...)
+}
+
+// items analyses nodes that are evaluated against values other
+// than the input, such as the items of a path or a filter. They
+// only read the input with $$.
+func (a *rawAnalysis) items(nodes ...jparse.Node) {
+	for _, node := range nodes {
+		jparse.Walk(node, func(node jparse.Node) bool {
+			switch node := node.(type) {
+			case *jparse.VariableNode:
+				if node.Name == "$" {
+					a.plan.whole = true
+				}
+			case *jparse.PathNode:
+				if len(node.Steps) == 0 {
+					break
+				}
+				if v, ok := node.Steps[0].(*jparse.VariableNode); ok && v.Name == "$" {
+					a.path(node.Steps)
+					return false
+				}
+			}
+			return !a.plan.whole
+		})
+	}
+}
+
+// call analyses a function call that is evaluated against the
+// input. Only calls to built-in functions that aren't passed the
+// input as an implicit argument are allowed.
+func (a *rawAnalysis) call(fn jparse.Node, argc int) {
+
+	v, ok := fn.(*jparse.VariableNode)
+	if !ok || !a.isBuiltin(v.Name) || a.usesContext(v.Name, argc) {
+		a.plan.whole = true
+	}
+}
+
+// isBuiltin returns true if a name refers to a built-in function,
+// and records the name in the plan.
+func (a *rawAnalysis) isBuiltin(name string) bool {
+
+	if a.bound[name] {
+		return false
+	}
+	if _, ok := a.base[name]; ok {
+		return false
+	}
+	if _, ok := lookupBuiltin(name); !ok {
+		return false
+	}
+
+	if a.seen == nil {
+		a.seen = map[string]bool{}
+	}
+	if !a.seen[name] {
+		a.seen[name] = true
+		a.plan.builtins = append(a.plan.builtins, name)
+	}
+
+	return true
+}
+
+// usesContext returns true if a name refers to a built-in
+// function that is passed the input when it's called with argc
+// arguments, as in $string().
+func (a *rawAnalysis) usesContext(name string, argc int) bool {
+
+	if !a.isBuiltin(name) {
+		return false
+	}
+
+	f, _ := lookupBuiltin(name)
+	if argc >= len(f.params) {
+		return false
+	}
+
+	return f.contextHandler != nil ||
+		len(f.signature) > 0 && f.signature[0].Option == jparse.ParamContextable
+}
+
+// lookupBuiltin returns the built-in function with the given
+// name.
+func lookupBuiltin(name string) (*goCallable, bool) {
+	v := baseEnv.lookup(name)
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+	f, ok := v.Interface().(*goCallable)
+	return f, ok
+}
+
+// decode decodes a JSON document.
+func (p *rawPlan) decode(b []byte, vars map[string]interface{}) (interface{}, error) {
+
+	var v interface{}
+
+	// Decoding the whole document reports syntax errors as
+	// json.Unmarshal does.
+	if p.whole || !json.Valid(b) || p.replaced(vars) {
+		err := json.Unmarshal(b, &v)
+		return v, err
+	}
+
+	d := &rawDecoder{
+		data: b,
+	}
+
+	return d.value(p.fields)
+}
+
+// replaced returns true if vars replace one of the plan's
+// built-in functions.
+func (p *rawPlan) replaced(vars map[string]interface{}) bool {
+	for _, name := range p.builtins {
+		if _, ok := vars[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// A rawDecoder decodes the fields in a rawFields tree from a
+// valid JSON document and skips the others.
+type rawDecoder struct {
+	data []byte
+	pos  int
+}
+
+var errRawSyntax = errors.New("invalid JSON input")
+
+// value decodes the value at the current position. If fields
+// is nil, the whole value is decoded.
+func (d *rawDecoder) value(fields rawFields) (interface{}, error) {
+
+	d.space()
+
+	if fields != nil && d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case '{':
+			return d.object(fields)
+		case '[':
+			return d.array(fields)
+		}
+	}
+
+	start := d.pos
+	if err := d.skip(); err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	err := json.Unmarshal(d.data[start:d.pos], &v)
+	return v, err
+}
+
+func (d *rawDecoder) object(fields rawFields) (interface{}, error) {
+
+	results := map[string]interface{}{}
+	d.pos++
+
+	for {
+		d.space()
+		if d.next('}') {
+			return results, nil
+		}
+
+		start := d.pos
+		if err := d.skip(); err != nil {
+			return nil, err
+		}
+		key, err := rawKey(d.data[start:d.pos])
+		if err != nil {
+			return nil, err
+		}
+
+		d.space()
+		if !d.next(':') {
+			return nil, errRawSyntax
+		}
+
+		if sub, ok := fields[key]; ok {
+			v, err := d.value(sub)
+			if err != nil {
+				return nil, err
+			}
+			results[key] = v
+		} else if err := d.skip(); err != nil {
+			return nil, err
+		}
+
+		d.space()
+		if !d.next(',') && !d.peek('}') {
+			return nil, errRawSyntax
+		}
+	}
+}
+
+func (d *rawDecoder) array(fields rawFields) (interface{}, error) {
+
+	results := []interface{}{}
+	d.pos++
+
+	for {
+		d.space()
+		if d.next(']') {
+			return results, nil
+		}
+
+		v, err := d.value(fields)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, v)
+
+		d.space()
+		if !d.next(',') && !d.peek(']') {
+			return nil, errRawSyntax
+		}
+	}
+}
+
+// skip moves past the value at the current position.
+func (d *rawDecoder) skip() error {
+
+	d.space()
+	if d.pos >= len(d.data) {
+		return errRawSyntax
+	}
+
+	switch d.data[d.pos] {
+	case '"':
+		return d.skipString()
+	case '{', '[':
+		depth := 0
+		for d.pos < len(d.data) {
+			switch d.data[d.pos] {
+			case '"':
+				if err := d.skipString(); err != nil {
+					return err
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			d.pos++
+			if depth == 0 {
+				return nil
+			}
+		}
+		return errRawSyntax
+	default:
+		for d.pos < len(d.data) && !isRawDelim(d.data[d.pos]) {
+			d.pos++
+		}
+		return nil
+	}
+}
+
+func (d *rawDecoder) skipString() error {
+
+	for d.pos++; d.pos < len(d.data); d.pos++ {
+		switch d.data[d.pos] {
+		case '\\':
+			d.pos++
+		case '"':
+			d.pos++
+			return nil
+		}
+	}
+
+	return errRawSyntax
+}
+
+func (d *rawDecoder) space() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\r', '\n':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+// isRawDelim returns true for the bytes that can follow a
+// number or a literal in a JSON document.
+func isRawDelim(c byte) bool {
+	switch c {
+	case ',', ':', ']', '}', ' ', '\t', '\r', '\n':
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *rawDecoder) peek(c byte) bool {
+	return d.pos < len(d.data) && d.data[d.pos] == c
+}
+
+func (d *rawDecoder) next(c byte) bool {
+	if !d.peek(c) {
+		return false
+	}
+	d.pos++
+	return true
+}
+
+// rawKey returns the value of a quoted object key.
+func rawKey(b []byte) (string, error) {
+
+	if len(b) < 2 || b[0] != '"' {
+		return "", errRawSyntax
+	}
+	if bytes.IndexByte(b, '\\') < 0 {
+		return string(b[1 : len(b)-1]), nil
+	}
+
+	var key string
+	err := json.Unmarshal(b, &key)
+	return key, err
+}
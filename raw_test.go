@@ -0,0 +1,244 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testRawDocument = `{
+	"id": "o1",
+	"customer": {"name": "Ann", "email": "ann@example.com", "tags": ["a", "b"]},
+	"lines": [
+		{"sku": "x", "qty": 2, "price": 1.5, "notes": {"gift": true}},
+		{"sku": "y", "qty": 1, "price": 10, "notes": null}
+	],
+	"status": "open",
+	"escaped\"key": "é\\",
+	"nested": [[{"a": 1}, {"a": 2}], [], {"a": 3}],
+	"empty": {},
+	"flag": false
+}`
+
+func TestRawInput(t *testing.T) {
+
+	exprs := []string{
+		`id`,
+		`$.id`,
+		`$$.customer.name`,
+		`customer.name & " <" & customer.email & ">"`,
+		`lines.sku`,
+		`lines[qty > 1].sku`,
+		`lines[0].notes.gift`,
+		`$sum(lines.(price * qty))`,
+		`$count(customer.tags)`,
+		`lines^(>price).sku`,
+		`lines{sku: qty}`,
+		`{"name": customer.name, "n": $count(lines)}`,
+		`lines.{"sku": sku, "status": $$.status}`,
+		`nested.a`,
+		`empty`,
+		`flag`,
+		`missing.field`,
+		`$string(customer)`,
+		`$sort($keys(customer))`,
+		`$substring(customer.name, 1)`,
+		`"escaped\"key"`,
+		`$uppercase(status)`,
+		`status ~> $uppercase()`,
+		`$`,
+		`*.name`,
+		`**.sku`,
+		`customer.($string())`,
+		`($f := function($l) { $l.sku & id }; lines.$f($))`,
+		`$map(lines, function($l) { $l.sku })`,
+		`$string()`,
+		`$length()`,
+		`customer.tags[$ = "b"]`,
+		`lines[$$.status = "open"].qty`,
+		`$exists(customer)`,
+		`customer ~> |$|{"name": "Bob"}|`,
+	}
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(testRawDocument), &doc); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	for _, expr := range exprs {
+
+		e := comp.MustCompile(expr)
+		want, wantErr := e.Eval(doc, nil)
+
+		for _, data := range []interface{}{json.RawMessage(testRawDocument), []byte(testRawDocument)} {
+			got, gotErr := e.Eval(data, nil)
+			if !reflect.DeepEqual(got, want) || !sameError(gotErr, wantErr) {
+				t.Errorf("%s: expected %v (error %v), got %v (error %v)", expr, want, wantErr, got, gotErr)
+			}
+		}
+	}
+}
+
+func TestRawInput_Plan(t *testing.T) {
+
+	data := []struct {
+		Expr   string
+		Fields rawFields
+		Whole  bool
+	}{
+		{
+			Expr:   `customer.name`,
+			Fields: rawFields{"customer": {"name": nil}},
+		},
+		{
+			Expr:   `customer.name & customer`,
+			Fields: rawFields{"customer": nil},
+		},
+		{
+			Expr:   `$sum(lines[status = "open"].total) + $count(id)`,
+			Fields: rawFields{"lines": nil, "id": nil},
+		},
+		{
+			Expr:   `a.b.(c + $$.d.e)`,
+			Fields: rawFields{"a": {"b": nil}, "d": {"e": nil}},
+		},
+		{
+			Expr:   `$x.y`,
+			Fields: rawFields{},
+		},
+		{
+			Expr:  `$`,
+			Whole: true,
+		},
+		{
+			Expr:  `a.b[$$ = 1]`,
+			Whole: true,
+		},
+		{
+			Expr:  `$string()`,
+			Whole: true,
+		},
+		{
+			Expr:  `$f(a)`,
+			Whole: true,
+		},
+		{
+			Expr:  `$substring(2)`,
+			Whole: true,
+		},
+		{
+			Expr:  `function($x) { $ }`,
+			Whole: true,
+		},
+		{
+			Expr:  `**.a`,
+			Whole: true,
+		},
+	}
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	for _, test := range data {
+
+		p := comp.MustCompile(test.Expr).raw
+		if p.whole != test.Whole {
+			t.Errorf("%s: expected whole to be %t, got %t", test.Expr, test.Whole, p.whole)
+		}
+		if !test.Whole && !reflect.DeepEqual(p.fields, test.Fields) {
+			t.Errorf("%s: expected fields %v, got %v", test.Expr, test.Fields, p.fields)
+		}
+	}
+}
+
+func TestRawInput_Decode(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`customer.name & lines[0].sku`)
+
+	got, err := e.raw.decode([]byte(testRawDocument), nil)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"customer": map[string]interface{}{"name": "Ann"},
+		"lines": []interface{}{
+			map[string]interface{}{"sku": "x", "qty": 2.0, "price": 1.5, "notes": map[string]interface{}{"gift": true}},
+			map[string]interface{}{"sku": "y", "qty": 1.0, "price": 10.0, "notes": nil},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Variables that replace a built-in function decode the
+	// whole document.
+	e = comp.MustCompile(`$uppercase(id)`)
+	got, err = e.raw.decode([]byte(testRawDocument), map[string]interface{}{"uppercase": 1})
+	if m, ok := got.(map[string]interface{}); err != nil || !ok || len(m) != 8 {
+		t.Errorf("expected the whole document, got %v (error %v)", got, err)
+	}
+
+	// Syntax errors are reported for the whole document, even in
+	// fields that aren't read.
+	var want2 interface{}
+	wantErr := json.Unmarshal([]byte(`{"id": 1, "x": [}`), &want2)
+	if _, err := e.Eval(json.RawMessage(`{"id": 1, "x": [}`), nil); !sameError(err, wantErr) {
+		t.Errorf("expected %v, got %v", wantErr, err)
+	}
+}
+
+func BenchmarkRawInput(b *testing.B) {
+
+	lines := make([]interface{}, 10000)
+	for i := range lines {
+		lines[i] = map[string]interface{}{"sku": "abc", "qty": i, "tags": []string{"a", "b", "c"}}
+	}
+	doc, _ := json.Marshal(map[string]interface{}{
+		"id":     "o1",
+		"status": "open",
+		"lines":  lines,
+	})
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		b.Fatalf("NewCompiler failed: %v", err)
+	}
+	e := comp.MustCompile(`id & ":" & status`)
+
+	b.Run("Partial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := e.Eval(json.RawMessage(doc), nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Unmarshal", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var v interface{}
+			if err := json.Unmarshal(doc, &v); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := e.Eval(v, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// A Resolver supplies the values of fields that are not in an
+// expression's input, e.g. by fetching a sub-document from a
+// store. This lets expressions query documents that are loaded
+// lazily, or spread across several sources, with ordinary paths.
+//
+// Resolve is called when a path step names a field that obj
+// doesn't have. obj is the object, or the string, number or
+// boolean, that the step is applied to. Resolve returns the
+// field's value, which is read like any other input value, or
+// ErrUndefined if the field doesn't exist. A nil value is null.
+// Any other error stops the evaluation.
+//
+// Resolvers are called by concurrent evaluations, so they must
+// be safe for concurrent use. ctx is the context passed to
+// Expression.EvalContext.
+type Resolver interface {
+	Resolve(ctx context.Context, obj interface{}, field string) (interface{}, error)
+}
+
+// ResolverFunc is an adapter that allows an ordinary function
+// to be used as a Resolver.
+type ResolverFunc func(ctx context.Context, obj interface{}, field string) (interface{}, error)
+
+// Resolve calls f(ctx, obj, field).
+func (f ResolverFunc) Resolve(ctx context.Context, obj interface{}, field string) (interface{}, error) {
+	return f(ctx, obj, field)
+}
+
+// WithResolver makes expressions compiled by the Compiler ask r
+// for the fields that are missing from their input. For example,
+// a resolver that loads customers by ID lets order.customer.name
+// follow a customer ID stored in the order:
+//
+//	r := jsonata.ResolverFunc(func(ctx context.Context, obj interface{}, field string) (interface{}, error) {
+//		if order, ok := obj.(map[string]interface{}); ok && field == "customer" {
+//			return store.Customer(ctx, order["customerId"])
+//		}
+//		return nil, jsonata.ErrUndefined
+//	})
+//
+// Fields are resolved when they are read by name. The wildcard
+// and descendant operators, and built-in functions such as $keys,
+// only see the fields that are in the input.
+func WithResolver(r Resolver) CompilerOption {
+	return func(c *Compiler) error {
+		c.resolver = r
+		return nil
+	}
+}
+
+// resolve returns the value of a field that obj doesn't have
+// from the current evaluation's Resolver. It returns undefined
+// if there isn't a Resolver or if the field doesn't exist.
+func (s *environment) resolve(obj reflect.Value, field string) (reflect.Value, error) {
+
+	if s == nil || s.state == nil || s.state.resolver == nil {
+		return undefined, nil
+	}
+
+	if !obj.IsValid() || !obj.CanInterface() {
+		return undefined, nil
+	}
+
+	v, err := s.state.resolver.Resolve(s.ctx(), obj.Interface(), field)
+	switch {
+	case err == ErrUndefined || err == jtypes.ErrUndefined:
+		return undefined, nil
+	case err != nil:
+		return undefined, fmt.Errorf("cannot resolve field %q: %w", field, err)
+	case v == nil:
+		return reflect.ValueOf(null), nil
+	}
+
+	return s.convert(reflect.ValueOf(v)), nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCompiler_WithResolver(t *testing.T) {
+
+	customers := map[string]map[string]interface{}{
+		"c1": {"name": "Ada", "city": "London"},
+		"c2": {"name": "Grace", "city": nil},
+	}
+
+	var mu sync.Mutex
+	var fetched []string
+
+	errStore := errors.New("store unavailable")
+
+	resolver := ResolverFunc(func(ctx context.Context, obj interface{}, field string) (interface{}, error) {
+		switch obj := obj.(type) {
+		case map[string]interface{}:
+			if field != "customer" {
+				break
+			}
+			id, _ := obj["customerId"].(string)
+			if id == "broken" {
+				return nil, errStore
+			}
+			mu.Lock()
+			fetched = append(fetched, id)
+			mu.Unlock()
+			if c, ok := customers[id]; ok {
+				return c, nil
+			}
+		case string:
+			// Strings are customer IDs.
+			if c, ok := customers[obj]; ok {
+				return c[field], nil
+			}
+		}
+		return nil, ErrUndefined
+	})
+
+	comp, err := NewCompiler(nil, nil, WithResolver(resolver))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"id": 1, "customerId": "c1", "total": 10},
+			map[string]interface{}{"id": 2, "customerId": "c2", "total": 20},
+			map[string]interface{}{"id": 3, "customerId": "c3", "total": 30},
+		},
+		"vip":   "c1",
+		"other": "c2",
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{
+			expr: `orders[0].customer.name`,
+			want: "Ada",
+		},
+		{
+			expr: `orders.customer.name`,
+			want: []interface{}{"Ada", "Grace"},
+		},
+		{
+			expr: `orders[customer.city = "London"].id`,
+			want: 1,
+		},
+		{
+			expr: `vip.name`,
+			want: "Ada",
+		},
+		{
+			expr: `$type(other.city)`,
+			want: "null",
+		},
+		{
+			// Fields in the input don't go to the resolver.
+			expr: `orders[0].total`,
+			want: 10,
+		},
+	}
+
+	for _, test := range tests {
+
+		expr, err := comp.Compile(test.expr)
+		if err != nil {
+			t.Errorf("%s: Compile failed: %v", test.expr, err)
+			continue
+		}
+
+		got, err := expr.Eval(input, nil)
+		if err != nil {
+			t.Errorf("%s: Eval failed: %v", test.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.expr, test.want, got)
+		}
+	}
+
+	expr, err := comp.Compile(`orders[2].customer.name`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if _, err := expr.Eval(input, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined for an unknown customer, got %v", err)
+	}
+
+	fetched = nil
+	expr, err = comp.Compile(`orders[0].(customer.name & " " & total)`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if _, err := expr.Eval(input, nil); err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if !reflect.DeepEqual(fetched, []string{"c1"}) {
+		t.Errorf("expected one fetch, got %v", fetched)
+	}
+
+	expr, err = comp.Compile(`customer`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	_, err = expr.Eval(map[string]interface{}{"customerId": "broken"}, nil)
+	if !errors.Is(err, errStore) {
+		t.Errorf("expected the resolver's error, got %v", err)
+	}
+
+	// Without a resolver, missing fields are undefined.
+	comp, err = NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	expr, err = comp.Compile(`orders[0].customer.name`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if _, err := expr.Eval(input, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined without a resolver, got %v", err)
+	}
+}
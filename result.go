@@ -0,0 +1,406 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// A Result holds the result of an evaluation (see EvalResult)
+// and converts it to other forms when they're asked for. Callers
+// that marshal the result to JSON or decode it into a struct
+// can do so straight from the evaluator's values, without first
+// building the generic value returned by Eval. A Result is safe
+// for concurrent use as long as the evaluation's input isn't
+// modified.
+type Result struct {
+	v reflect.Value
+}
+
+// EvalResult is like EvalContext except that it returns the
+// result as a *Result. Like EvalContext, it returns ErrUndefined
+// if the expression evaluates to undefined.
+func (e *Expression) EvalResult(ctx context.Context, data interface{}, vars map[string]interface{}) (*Result, error) {
+
+	var result reflect.Value
+
+	k := e.compiled()
+
+	err := e.withEvalEnv(ctx, k, e.newBaseEnv(), data, vars, nil, func(input reflect.Value, env *environment) error {
+		var err error
+		result, err = eval(k.node, input, env)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.IsValid() {
+		return nil, ErrUndefined
+	}
+
+	return &Result{v: result}, nil
+}
+
+// Value returns the result as Eval would.
+func (r *Result) Value() (interface{}, error) {
+	return exportResult(r.v)
+}
+
+// Len returns the number of items in the result if it's an
+// array, or 1 if it's another value.
+func (r *Result) Len() int {
+	if v, ok := r.array(); ok {
+		return v.Len()
+	}
+	return 1
+}
+
+// Each calls fn for the items of the result in order, or for the
+// result itself if it isn't an array, like a JSONata sequence.
+// Each item is a Result that can be converted on its own, e.g. to
+// decode a large array one struct at a time. Each stops at the
+// first error from fn and returns it.
+func (r *Result) Each(fn func(i int, item *Result) error) error {
+
+	v, ok := r.array()
+	if !ok {
+		return fn(0, r)
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		item := &Result{v: v.Index(i)}
+		if err := fn(i, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// array returns the result if it's an array. A []byte isn't an
+// array because it's encoded as a base64 string.
+func (r *Result) array() (reflect.Value, bool) {
+	v := derefValue(r.v)
+	switch {
+	case v.Kind() == reflect.Array:
+		return v, true
+	case v.Kind() == reflect.Slice:
+		return v, v.Type().Elem().Kind() != reflect.Uint8
+	default:
+		return v, false
+	}
+}
+
+// MarshalJSON encodes the result as JSON, so that a Result can
+// be passed to json.Marshal or included in a response struct.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	v, err := r.Value()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// Decode stores the result in the value that dst points to,
+// following the rules of json.Unmarshal: objects decode into
+// structs (matching fields by their json tags or names) and
+// maps, arrays into slices and arrays, and numbers into any
+// numeric type that can hold them. A single value decodes into a
+// slice of one item, since JSONata doesn't distinguish between a
+// value and an array that contains it. Values are converted
+// directly, except that types that implement json.Unmarshaler or
+// encoding.TextUnmarshaler, and structs with embedded fields,
+// are decoded from the value's JSON encoding.
+func (r *Result) Decode(dst interface{}) error {
+
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("cannot decode into non-pointer %T", dst)
+	}
+
+	return decodeValue(v.Elem(), r.v, "")
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decodeValue stores src in dst, which must be settable. path is
+// the location of dst in the result, for errors.
+func decodeValue(dst, src reflect.Value, path string) error {
+
+	src = derefValue(src)
+
+	// Like encoding/json, null only affects values that can
+	// be nil.
+	if !src.IsValid() {
+		switch dst.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+
+	if ptr := reflect.PtrTo(dst.Type()); ptr.Implements(jsonUnmarshalerType) || ptr.Implements(textUnmarshalerType) {
+		return decodeJSON(dst, src, path)
+	}
+
+	if src.Type().AssignableTo(dst.Type()) && dst.Kind() != reflect.Interface {
+		dst.Set(src)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() == 0 || src.Type().Implements(dst.Type()) {
+			if src.CanInterface() {
+				dst.Set(reflect.ValueOf(src.Interface()))
+				return nil
+			}
+		}
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeValue(dst.Elem(), src, path)
+	case reflect.Bool:
+		if src.Kind() == reflect.Bool {
+			dst.SetBool(src.Bool())
+			return nil
+		}
+	case reflect.String:
+		if src.Kind() == reflect.String {
+			dst.SetString(src.String())
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f, ok := numberValue(src); ok {
+			if f != math.Trunc(f) || dst.OverflowInt(int64(f)) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return decodeError(src, dst, path)
+			}
+			dst.SetInt(int64(f))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f, ok := numberValue(src); ok {
+			if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 || dst.OverflowUint(uint64(f)) {
+				return decodeError(src, dst, path)
+			}
+			dst.SetUint(uint64(f))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := numberValue(src); ok {
+			if dst.OverflowFloat(f) {
+				return decodeError(src, dst, path)
+			}
+			dst.SetFloat(f)
+			return nil
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 && src.Kind() == reflect.String {
+			// Base64, as in encoding/json.
+			return decodeJSON(dst, src, path)
+		}
+		if src.Kind() != reflect.Slice && src.Kind() != reflect.Array {
+			s := reflect.MakeSlice(dst.Type(), 1, 1)
+			if err := decodeValue(s.Index(0), src, path+"[0]"); err != nil {
+				return err
+			}
+			dst.Set(s)
+			return nil
+		}
+		s := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := decodeValue(s.Index(i), src.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+		return nil
+	case reflect.Array:
+		if src.Kind() == reflect.Slice || src.Kind() == reflect.Array {
+			for i := 0; i < dst.Len(); i++ {
+				if i >= src.Len() {
+					dst.Index(i).Set(reflect.Zero(dst.Type().Elem()))
+					continue
+				}
+				if err := decodeValue(dst.Index(i), src.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if src.Kind() == reflect.Map && src.Type().Key().Kind() == reflect.String && dst.Type().Key().Kind() == reflect.String {
+			m := reflect.MakeMapWithSize(dst.Type(), src.Len())
+			iter := src.MapRange()
+			for iter.Next() {
+				key := iter.Key().String()
+				elem := reflect.New(dst.Type().Elem()).Elem()
+				if err := decodeValue(elem, iter.Value(), joinPath(path, key)); err != nil {
+					return err
+				}
+				m.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), elem)
+			}
+			dst.Set(m)
+			return nil
+		}
+		return decodeJSON(dst, src, path)
+	case reflect.Struct:
+		fields := structFieldsOf(dst.Type())
+		if fields == nil {
+			return decodeJSON(dst, src, path)
+		}
+		if src.Kind() == reflect.Map && src.Type().Key().Kind() == reflect.String {
+			iter := src.MapRange()
+			for iter.Next() {
+				key := iter.Key().String()
+				i, ok := fields.lookup(key)
+				if !ok {
+					continue
+				}
+				if err := decodeValue(dst.Field(i), iter.Value(), joinPath(path, key)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return decodeJSON(dst, src, path)
+	}
+
+	return decodeError(src, dst, path)
+}
+
+// decodeJSON stores src in dst by way of its JSON encoding.
+func decodeJSON(dst, src reflect.Value, path string) error {
+
+	if !src.CanInterface() {
+		return decodeError(src, dst, path)
+	}
+
+	b, err := json.Marshal(src.Interface())
+	if err != nil {
+		return fmt.Errorf("cannot decode %s: %w", decodePath(path), err)
+	}
+
+	if err := json.Unmarshal(b, dst.Addr().Interface()); err != nil {
+		return fmt.Errorf("cannot decode %s: %w", decodePath(path), err)
+	}
+
+	return nil
+}
+
+func decodeError(src, dst reflect.Value, path string) error {
+	return fmt.Errorf("cannot decode %s: %s value into %s", decodePath(path), src.Type(), dst.Type())
+}
+
+func decodePath(path string) string {
+	if path == "" {
+		return "result"
+	}
+	return strings.TrimPrefix(path, ".")
+}
+
+func joinPath(path, key string) string {
+	return path + "." + key
+}
+
+// derefValue returns the value that v points to or holds, or an
+// invalid value if it's nil.
+func derefValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func numberValue(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	default:
+		return 0, false
+	}
+}
+
+// structFields maps the JSON names of a struct type's fields to
+// their indexes.
+type structFields struct {
+	names map[string]int
+	folds map[string]int
+}
+
+// lookup returns the field for a key, matching the key exactly
+// or, failing that, case-insensitively, as encoding/json does.
+func (f *structFields) lookup(key string) (int, bool) {
+	if i, ok := f.names[key]; ok {
+		return i, true
+	}
+	i, ok := f.folds[strings.ToLower(key)]
+	return i, ok
+}
+
+var structFieldsCache sync.Map
+
+// structFieldsOf returns the fields of a struct type, or nil if
+// it has embedded fields, which are left to encoding/json.
+func structFieldsOf(t reflect.Type) *structFields {
+
+	if f, ok := structFieldsCache.Load(t); ok {
+		return f.(*structFields)
+	}
+
+	f := &structFields{
+		names: map[string]int{},
+		folds: map[string]int{},
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+
+		field := t.Field(i)
+		if field.Anonymous {
+			f = nil
+			break
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if s := strings.Split(tag, ",")[0]; s != "" {
+				name = s
+			}
+		}
+
+		f.names[name] = i
+		if _, ok := f.folds[strings.ToLower(name)]; !ok {
+			f.folds[strings.ToLower(name)] = i
+		}
+	}
+
+	structFieldsCache.Store(t, f)
+	return f
+}
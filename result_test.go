@@ -0,0 +1,161 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type resultLine struct {
+	SKU     string    `json:"sku"`
+	Qty     int       `json:"qty"`
+	Price   *float64  `json:"price,omitempty"`
+	Tags    []string  `json:"tags"`
+	Shipped time.Time `json:"shipped"`
+	Skip    string    `json:"-"`
+	Note    string
+}
+
+func TestExpression_EvalResult(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"lines": []interface{}{
+			map[string]interface{}{"sku": "A1", "qty": 2.0, "price": 1.5, "tags": []interface{}{"x", "y"}},
+			map[string]interface{}{"sku": "B2", "qty": 1.0, "tags": "z"},
+		},
+	}
+
+	e := comp.MustCompile(`lines.{"sku": sku, "qty": qty, "price": price, "tags": tags, "shipped": "2024-01-02T03:04:05Z", "Skip": "no", "note": "n"}`)
+
+	res, err := e.EvalResult(context.Background(), data, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Results decode straight into structs.
+	var lines []resultLine
+	if err := res.Decode(&lines); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	price := 1.5
+	shipped := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := []resultLine{
+		{SKU: "A1", Qty: 2, Price: &price, Tags: []string{"x", "y"}, Shipped: shipped, Note: "n"},
+		{SKU: "B2", Qty: 1, Tags: []string{"z"}, Shipped: shipped, Note: "n"},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("expected %+v, got %+v", want, lines)
+	}
+
+	v, err := e.Eval(data, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := json.Marshal(v)
+
+	// A Result marshals to the same JSON as Eval's result.
+	got, err := json.Marshal(res)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(got) != string(b) {
+		t.Errorf("expected %s, got %s", b, got)
+	}
+
+	if v2, err := res.Value(); err != nil || !reflect.DeepEqual(v2, v) {
+		t.Errorf("expected %v, got %v (%v)", v, v2, err)
+	}
+
+	// Results can be read item by item.
+	if n := res.Len(); n != 2 {
+		t.Errorf("expected 2 items, got %d", n)
+	}
+	var skus []string
+	err = res.Each(func(i int, item *Result) error {
+		var line resultLine
+		if err := item.Decode(&line); err != nil {
+			return err
+		}
+		skus = append(skus, line.SKU)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(skus, []string{"A1", "B2"}) {
+		t.Errorf("expected [A1 B2], got %v (%v)", skus, err)
+	}
+
+	// A single value is a sequence of one item.
+	res, err = comp.MustCompile(`lines[0].qty`).EvalResult(context.Background(), data, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var qtys []uint8
+	if err := res.Decode(&qtys); err != nil || !reflect.DeepEqual(qtys, []uint8{2}) {
+		t.Errorf("expected [2], got %v (%v)", qtys, err)
+	}
+	if n := res.Len(); n != 1 {
+		t.Errorf("expected 1 item, got %d", n)
+	}
+
+	if _, err := comp.MustCompile(`nothing`).EvalResult(context.Background(), data, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
+
+func TestResult_DecodeErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tests := []struct {
+		Expression string
+		Dst        interface{}
+		Error      string
+	}{
+		{
+			Expression: `{"a": [1, 2.5]}`,
+			Dst:        &map[string][]int{},
+			Error:      "cannot decode a[1]: float64 value into int",
+		},
+		{
+			Expression: `{"qty": "two"}`,
+			Dst:        &resultLine{},
+			Error:      "cannot decode qty: string value into int",
+		},
+		{
+			Expression: `300`,
+			Dst:        new(int8),
+			Error:      "cannot decode result: float64 value into int8",
+		},
+		{
+			Expression: `1`,
+			Dst:        resultLine{},
+			Error:      "cannot decode into non-pointer jsonata.resultLine",
+		},
+	}
+
+	for _, test := range tests {
+
+		res, err := comp.MustCompile(test.Expression).EvalResult(context.Background(), nil, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.Expression, err)
+		}
+
+		if err := res.Decode(test.Dst); err == nil || err.Error() != test.Error {
+			t.Errorf("%s: expected error %q, got %v", test.Expression, test.Error, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// A Rewriter transforms the syntax tree of an expression after
+// it's parsed and before it's checked and compiled (see
+// Compiler.AddRewriter). It may modify the tree in place, or
+// return a new one.
+type Rewriter func(jparse.Node) jparse.Node
+
+// AddRewriter adds a pass that transforms the syntax tree of
+// each expression compiled by c, e.g. to rename deprecated
+// functions, to add a filter to every path or to reject fields
+// that a policy doesn't allow. Rewriters run in the order that
+// they're added, each on the result of the one before, and the
+// result of the last one is checked against the compiler's
+// limits and disabled functions, and evaluated, as if it had been
+// parsed. A rewriter that returns nil is a compile error. To
+// reject an expression, a rewriter can panic with an error,
+// which Compile returns in a *CompileError.
+//
+// Rewriters apply to expressions and preludes compiled after
+// they're added. A rewriter may be called again for the same
+// source when a trimmed expression is recompiled (see
+// Compiler.Trim), so it must give the same result each time.
+// Nodes that a rewriter creates have no position in the source,
+// so errors in them aren't reported with one, and
+// Expression.String returns the rewritten expression.
+func (c *Compiler) AddRewriter(fn Rewriter) error {
+
+	if c.frozen {
+		return errDefaultFrozen()
+	}
+
+	if fn == nil {
+		return fmt.Errorf("the rewriter cannot be nil")
+	}
+
+	// Copy the slice so that clones and expressions compiled
+	// earlier don't see the new rewriter.
+	rewriters := make([]Rewriter, len(c.rewriters), len(c.rewriters)+1)
+	copy(rewriters, c.rewriters)
+	c.rewriters = append(rewriters, fn)
+
+	return nil
+}
+
+// WithRewriter adds a pass that transforms the syntax tree of the
+// compiler's expressions, as AddRewriter does, for compilers that
+// are only set up with options.
+func WithRewriter(fn Rewriter) CompilerOption {
+	return func(c *Compiler) error {
+		return c.AddRewriter(fn)
+	}
+}
+
+// rewrite applies the compiler's rewriters to the syntax tree of
+// expr.
+func (c *Compiler) rewrite(node jparse.Node, expr string) (jparse.Node, *CompileError) {
+
+	node, err := applyRewriters(c.rewriters, node)
+	if err != nil {
+		return nil, newCompileError(err, expr)
+	}
+
+	return node, nil
+}
+
+// applyRewriters applies rewriters to a syntax tree in order. It
+// returns an error if a rewriter returns nil or panics with an
+// error.
+func applyRewriters(rewriters []Rewriter, node jparse.Node) (res jparse.Node, err error) {
+
+	for i, fn := range rewriters {
+		if node, err = callRewriter(fn, node); err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, fmt.Errorf("rewriter %d returned no expression", i+1)
+		}
+	}
+
+	return node, nil
+}
+
+func callRewriter(fn Rewriter, node jparse.Node) (res jparse.Node, err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+
+	return fn(node), nil
+}
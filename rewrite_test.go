@@ -0,0 +1,220 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// renameFunc returns a Rewriter that renames calls to the
+// function from to the function to.
+func renameFunc(from, to string) Rewriter {
+	return func(node jparse.Node) jparse.Node {
+		jparse.Walk(node, func(n jparse.Node) bool {
+			if call, ok := n.(*jparse.FunctionCallNode); ok {
+				if v, ok := call.Func.(*jparse.VariableNode); ok && v.Name == from {
+					v.Name = to
+				}
+			}
+			return true
+		})
+		return node
+	}
+}
+
+// filterPaths returns a Rewriter that adds a filter to the first
+// step of each path.
+func filterPaths(filter string) Rewriter {
+	return func(node jparse.Node) jparse.Node {
+		jparse.Walk(node, func(n jparse.Node) bool {
+			if path, ok := n.(*jparse.PathNode); ok {
+				f, err := jparse.Parse(filter)
+				if err != nil {
+					panic(err)
+				}
+				path.Steps[0] = &jparse.PredicateNode{
+					Expr:    path.Steps[0],
+					Filters: []jparse.Node{f},
+				}
+				return false
+			}
+			return true
+		})
+		return node
+	}
+}
+
+var errForbiddenField = errors.New("field ssn is not allowed")
+
+// forbidField is a Rewriter that rejects expressions that read
+// the field ssn.
+func forbidField(node jparse.Node) jparse.Node {
+	jparse.Walk(node, func(n jparse.Node) bool {
+		if name, ok := n.(*jparse.NameNode); ok && name.Value == "ssn" {
+			panic(errForbiddenField)
+		}
+		return true
+	})
+	return node
+}
+
+func TestCompiler_AddRewriter(t *testing.T) {
+
+	data := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"tenant": "t1", "total": 5.0},
+			map[string]interface{}{"tenant": "t2", "total": 7.0},
+			map[string]interface{}{"tenant": "t1", "total": 3.0},
+		},
+		"ssn": "123",
+	}
+
+	comp, err := NewCompiler(nil, nil,
+		WithRewriter(renameFunc("total", "sum")),
+		WithRewriter(filterPaths(`tenant = "t1"`)),
+		WithRewriter(forbidField),
+	)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e, err := comp.Compile(`$total(orders.total)`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	if got, err := e.Eval(data, nil); err != nil || got != 8.0 {
+		t.Errorf("expected 8, got %v (error %v)", got, err)
+	}
+	if got, want := e.String(), `$sum(orders[tenant = "t1"].total)`; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	// Rewriters run again when a trimmed expression is compiled
+	// again.
+	if n := comp.Trim(0); n != 1 {
+		t.Fatalf("expected 1 trimmed expression, got %d", n)
+	}
+	if got, err := e.Eval(data, nil); err != nil || got != 8.0 {
+		t.Errorf("expected 8 after recompiling, got %v (error %v)", got, err)
+	}
+
+	// A rewriter can reject an expression by panicking with an
+	// error.
+	if _, err := comp.Compile(`orders.ssn`); !errors.Is(err, errForbiddenField) {
+		t.Errorf("expected %v, got %v", errForbiddenField, err)
+	}
+	_, err = comp.CompileAll(`orders.ssn`)
+	if errs, _ := err.(CompileErrors); len(errs) != 1 || !errors.Is(errs[0], errForbiddenField) {
+		t.Errorf("expected %v, got %v", errForbiddenField, err)
+	}
+	if err := comp.SetPrelude(`$id := ssn`); !errors.Is(err, errForbiddenField) {
+		t.Errorf("expected %v, got %v", errForbiddenField, err)
+	}
+}
+
+func TestCompiler_AddRewriterChecks(t *testing.T) {
+
+	// The rewritten expression is checked for disabled
+	// functions.
+	comp, err := NewCompiler(nil, nil,
+		WithDisabledFunctions("now"),
+		WithRewriter(renameFunc("today", "now")),
+	)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	if _, err := comp.Compile(`$today()`); err == nil {
+		t.Errorf("expected an error for a disabled function")
+	}
+
+	// Rewriters that return nil are compile errors.
+	comp, err = NewCompiler(nil, nil, WithRewriter(func(jparse.Node) jparse.Node {
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	if _, err := comp.Compile(`a`); err == nil {
+		t.Errorf("expected an error for a nil rewrite")
+	} else if _, ok := err.(*CompileError); !ok {
+		t.Errorf("expected a *CompileError, got %T", err)
+	}
+
+	if err := comp.AddRewriter(nil); err == nil {
+		t.Errorf("expected an error for a nil rewriter")
+	}
+
+	// Decision table cells and library functions are rewritten
+	// and checked like expressions.
+	comp, err = NewCompiler(nil, nil,
+		WithRewriter(forbidField),
+		WithDisabledFunctions("now"),
+		WithRewriter(renameFunc("today", "now")),
+		WithCompileLimits(CompileLimits{Nodes: 10}),
+	)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+	for _, table := range []*DecisionTable{
+		{Rows: []DecisionRow{{When: []string{"ssn"}, Then: "1"}}},
+		{Rows: []DecisionRow{{When: []string{"true"}, Then: "$today()"}}},
+		{Rows: []DecisionRow{{When: []string{"true"}, Then: "[1, 2, 3, 4, 5, 6, 7, 8, 9, 10]"}}},
+		// Each cell is within the limits, but the table isn't.
+		{Rows: []DecisionRow{
+			{When: []string{"a = 1"}, Then: "1"},
+			{When: []string{"a = 2"}, Then: "2"},
+			{When: []string{"a = 3"}, Then: "3"},
+		}},
+	} {
+		if _, err := comp.CompileDecisionTable(table); err == nil {
+			t.Errorf("%+v: expected an error", table)
+		}
+	}
+	for _, body := range []string{
+		`function() { ssn }`,
+		`function() { $today() }`,
+	} {
+		if err := comp.RegisterLibrary("lib", map[string]string{"f": body}); err == nil {
+			t.Errorf("%s: expected an error", body)
+		}
+	}
+}
+
+func TestCompiler_AddRewriterScope(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	before := comp.MustCompile(`$string(a)`)
+	if err := comp.AddRewriter(renameFunc("string", "uppercase")); err != nil {
+		t.Fatalf("AddRewriter failed: %v", err)
+	}
+	after := comp.MustCompile(`$string(a)`)
+
+	// Rewriters only apply to expressions compiled after they're
+	// added, even when an earlier expression is recompiled.
+	comp.Trim(0)
+
+	data := map[string]interface{}{"a": "x"}
+	for _, test := range []struct {
+		Expr   *Expression
+		Output interface{}
+	}{
+		{before, "x"},
+		{after, "X"},
+	} {
+		got, err := test.Expr.Eval(data, nil)
+		if err != nil || !reflect.DeepEqual(got, test.Output) {
+			t.Errorf("expected %v, got %v (error %v)", test.Output, got, err)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// A Rule is a named boolean expression in a RuleSet. A rule
+// fires if its expression evaluates to a truthy value (see
+// $boolean).
+//
+// If the expression is a block, the variables assigned by the
+// block's top-level expressions are captured when the rule
+// fires. For example, the following rule captures $total:
+//
+//	($total := $sum(Items.Price); $total > 100)
+type Rule struct {
+	Name     string
+	Priority int
+	Expr     string
+}
+
+// A RulePolicy controls which rules a RuleSet evaluates.
+type RulePolicy int
+
+const (
+	// FirstMatch evaluates rules until one fires. An error
+	// stops evaluation, since a rule with a higher priority
+	// than the first match might not have been evaluated.
+	FirstMatch RulePolicy = iota
+
+	// AllMatches evaluates every rule. Rules that return an
+	// error don't fire, and their errors are returned together
+	// as a RuleErrors after the other rules have been evaluated.
+	AllMatches
+
+	// FailFast evaluates every rule, like AllMatches, but stops
+	// at the first error.
+	FailFast
+)
+
+// A FiredRule is a rule that fired during an evaluation of a
+// RuleSet. Bindings holds the variables captured by the rule,
+// keyed by name without the leading $, or nil if the rule
+// doesn't capture any variables. Variables that were undefined
+// are omitted.
+type FiredRule struct {
+	Name     string
+	Priority int
+	Bindings map[string]interface{}
+}
+
+// A RuleError is an error returned by a rule.
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (e RuleError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Rule, e.Err)
+}
+
+// Unwrap returns the error returned by the rule's expression.
+func (e RuleError) Unwrap() error {
+	return e.Err
+}
+
+// RuleErrors is the error returned by the AllMatches policy if
+// one or more rules return an error.
+type RuleErrors []*RuleError
+
+func (errs RuleErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// A RuleSet is a set of rules that are evaluated in priority
+// order against the same input. Like a Bundle, a RuleSet shares
+// the results of pure subexpressions that appear in more than
+// one rule.
+//
+// A RuleSet is safe for concurrent use.
+type RuleSet struct {
+	rules []*compiledRule
+	plan  *sharedPlan
+}
+
+type compiledRule struct {
+	Rule
+	expr     *Expression
+	captures []string
+}
+
+// CompileRules compiles a set of rules into a RuleSet. Rules
+// are evaluated in descending order of priority. Rules with the
+// same priority are evaluated in the order given. Rule names
+// must be unique and non-empty.
+func (c *Compiler) CompileRules(rules []Rule) (*RuleSet, error) {
+
+	rs := &RuleSet{
+		rules: make([]*compiledRule, 0, len(rules)),
+	}
+
+	names := make(map[string]bool, len(rules))
+	roots := make([]jparse.Node, 0, len(rules))
+
+	for _, r := range rules {
+
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule name cannot be empty")
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = true
+
+		e, err := c.Compile(r.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+
+		node := e.art.pin().node
+		rs.rules = append(rs.rules, &compiledRule{
+			Rule:     r,
+			expr:     e,
+			captures: capturedNames(node),
+		})
+		roots = append(roots, node)
+	}
+
+	sort.SliceStable(rs.rules, func(i, j int) bool {
+		return rs.rules[i].Priority > rs.rules[j].Priority
+	})
+
+	rs.plan = newSharedPlan(roots)
+	return rs, nil
+}
+
+// Names returns the names of the RuleSet's rules in evaluation
+// order.
+func (rs *RuleSet) Names() []string {
+	names := make([]string, len(rs.rules))
+	for i, r := range rs.rules {
+		names[i] = r.Name
+	}
+	return names
+}
+
+// Eval evaluates the rules in the RuleSet with the given input
+// and variables, according to policy, and returns the rules
+// that fired in evaluation order.
+func (rs *RuleSet) Eval(data interface{}, vars map[string]interface{}, policy RulePolicy) ([]FiredRule, error) {
+	return rs.EvalContext(context.Background(), data, vars, policy)
+}
+
+// EvalContext is like Eval but uses ctx for the evaluations. See
+// Expression.EvalContext.
+func (rs *RuleSet) EvalContext(ctx context.Context, data interface{}, vars map[string]interface{}, policy RulePolicy) ([]FiredRule, error) {
+
+	switch policy {
+	case FirstMatch, AllMatches, FailFast:
+	default:
+		return nil, fmt.Errorf("unknown rule policy %d", policy)
+	}
+
+	cache := &sharedCache{
+		plan:   rs.plan,
+		values: map[string]reflect.Value{},
+	}
+
+	var fired []FiredRule
+	var errs RuleErrors
+
+	if len(rs.rules) > 0 {
+		ctx = rs.rules[0].expr.evalIDContext(ctx)
+	}
+
+	for _, r := range rs.rules {
+
+		ok, bindings, err := r.eval(ctx, data, vars, cache)
+		if err != nil {
+			err := &RuleError{
+				Rule: r.Name,
+				Err:  err,
+			}
+			if policy != AllMatches {
+				return nil, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		fired = append(fired, FiredRule{
+			Name:     r.Name,
+			Priority: r.Priority,
+			Bindings: bindings,
+		})
+
+		if policy == FirstMatch {
+			break
+		}
+	}
+
+	if len(errs) > 0 {
+		return fired, errs
+	}
+
+	return fired, nil
+}
+
+// eval evaluates a rule and returns true and the rule's
+// captured variables if the rule fires.
+func (r *compiledRule) eval(ctx context.Context, data interface{}, vars map[string]interface{}, cache *sharedCache) (bool, map[string]interface{}, error) {
+
+	var fired bool
+	var bindings map[string]interface{}
+
+	e := r.expr
+	k := e.compiled()
+
+	err := e.withEvalEnv(ctx, k, e.newBaseEnv(), data, vars, cache, func(input reflect.Value, env *environment) error {
+
+		node := k.node
+
+		// Evaluate a top-level block in an environment that
+		// is still available afterwards so that its variables
+		// can be captured.
+		if block, ok := node.(*jparse.BlockNode); ok && len(block.Exprs) > 0 {
+			env = newEnvironment(env, len(r.captures))
+			last := len(block.Exprs) - 1
+			for _, node := range block.Exprs[:last] {
+				if _, err := eval(node, input, env); err != nil {
+					return err
+				}
+			}
+			node = block.Exprs[last]
+		}
+
+		var err error
+		fired, err = evalCondition(node, input, env)
+		if err != nil || !fired || len(r.captures) == 0 {
+			return err
+		}
+
+		bindings = make(map[string]interface{}, len(r.captures))
+		for _, name := range r.captures {
+			if v, ok := env.symbols[name]; ok {
+				if res, ok := ruleBinding(v); ok {
+					bindings[name] = res
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return fired, bindings, err
+}
+
+// capturedNames returns the names of the variables assigned by
+// the top-level expressions in a block.
+func capturedNames(node jparse.Node) []string {
+
+	block, ok := node.(*jparse.BlockNode)
+	if !ok {
+		return nil
+	}
+
+	var names []string
+	seen := map[string]bool{}
+
+	for _, node := range block.Exprs {
+		if assign, ok := node.(*jparse.AssignmentNode); ok && !seen[assign.Name] {
+			seen[assign.Name] = true
+			names = append(names, assign.Name)
+		}
+	}
+
+	return names
+}
+
+// ruleBinding converts the value of a captured variable to an
+// interface{}. It returns false if the value is undefined.
+func ruleBinding(v reflect.Value) (interface{}, bool) {
+	switch {
+	case !v.IsValid():
+		return nil, false
+	case !v.CanInterface():
+		return nil, true
+	case v.Kind() == reflect.Ptr && v.IsNil():
+		return nil, true
+	default:
+		return v.Interface(), true
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRuleSet(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	rs, err := comp.CompileRules([]Rule{
+		{Name: "small", Priority: 1, Expr: `$count(Items) < 3`},
+		{Name: "vip", Priority: 10, Expr: `Customer.Tier = "gold"`},
+		{Name: "big", Priority: 5, Expr: `($total := $sum(Items.Price); $total > $limit)`},
+		{Name: "express", Priority: 5, Expr: `Shipping = "express"`},
+		{Name: "discount", Priority: 1, Expr: `($codes := Codes; $note := Note; $exists($codes))`},
+	})
+	if err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+
+	if got, want := rs.Names(), []string{"vip", "big", "express", "small", "discount"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names: expected %v, got %v", want, got)
+	}
+
+	input := map[string]interface{}{
+		"Customer": map[string]interface{}{
+			"Tier": "silver",
+		},
+		"Items": []interface{}{
+			map[string]interface{}{"Price": 40},
+			map[string]interface{}{"Price": 80},
+		},
+		"Shipping": "express",
+	}
+
+	vars := map[string]interface{}{
+		"limit": 100,
+	}
+
+	tests := []struct {
+		policy RulePolicy
+		want   []FiredRule
+	}{
+		{
+			policy: FirstMatch,
+			want: []FiredRule{
+				{Name: "big", Priority: 5, Bindings: map[string]interface{}{"total": float64(120)}},
+			},
+		},
+		{
+			policy: AllMatches,
+			want: []FiredRule{
+				{Name: "big", Priority: 5, Bindings: map[string]interface{}{"total": float64(120)}},
+				{Name: "express", Priority: 5},
+				{Name: "small", Priority: 1},
+			},
+		},
+		{
+			policy: FailFast,
+			want: []FiredRule{
+				{Name: "big", Priority: 5, Bindings: map[string]interface{}{"total": float64(120)}},
+				{Name: "express", Priority: 5},
+				{Name: "small", Priority: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		got, err := rs.Eval(input, vars, test.policy)
+		if err != nil {
+			t.Errorf("policy %d: Eval failed: %v", test.policy, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("policy %d: expected %v, got %v", test.policy, test.want, got)
+		}
+	}
+
+	// Undefined variables aren't captured.
+	input["Codes"] = []interface{}{"SPRING"}
+	got, err := rs.Eval(input, vars, AllMatches)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	want := FiredRule{
+		Name:     "discount",
+		Priority: 1,
+		Bindings: map[string]interface{}{"codes": []interface{}{"SPRING"}},
+	}
+	if len(got) != 4 || !reflect.DeepEqual(got[3], want) {
+		t.Errorf("expected last rule %v, got %v", want, got)
+	}
+
+	// No rules fire.
+	got, err = rs.Eval(map[string]interface{}{"Items": []interface{}{1, 2, 3}}, vars, AllMatches)
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no rules to fire, got %v", got)
+	}
+}
+
+func TestRuleSetErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	badRules := [][]Rule{
+		{{Name: "", Expr: `true`}},
+		{{Name: "a", Expr: `true`}, {Name: "a", Expr: `false`}},
+		{{Name: "a", Expr: `(`}},
+	}
+
+	for _, rules := range badRules {
+		if _, err := comp.CompileRules(rules); err == nil {
+			t.Errorf("%v: expected error", rules)
+		}
+	}
+
+	rs, err := comp.CompileRules([]Rule{
+		{Name: "first", Priority: 3, Expr: `true`},
+		{Name: "broken", Priority: 2, Expr: `Value + 1`},
+		{Name: "last", Priority: 1, Expr: `true`},
+	})
+	if err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"Value": "text",
+	}
+
+	// FirstMatch stops before reaching the broken rule.
+	got, err := rs.Eval(input, nil, FirstMatch)
+	if err != nil || len(got) != 1 || got[0].Name != "first" {
+		t.Errorf("FirstMatch: expected rule first, got %v (error %v)", got, err)
+	}
+
+	// AllMatches skips the broken rule.
+	got, err = rs.Eval(input, nil, AllMatches)
+	var errs RuleErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Rule != "broken" {
+		t.Errorf("AllMatches: expected error from rule broken, got %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "first" || got[1].Name != "last" {
+		t.Errorf("AllMatches: expected rules first and last, got %v", got)
+	}
+
+	// FailFast stops at the broken rule.
+	got, err = rs.Eval(input, nil, FailFast)
+	var ruleErr *RuleError
+	if !errors.As(err, &ruleErr) || ruleErr.Rule != "broken" {
+		t.Errorf("FailFast: expected error from rule broken, got %v", err)
+	}
+	if got != nil {
+		t.Errorf("FailFast: expected no results, got %v", got)
+	}
+
+	if _, err := rs.Eval(input, nil, RulePolicy(-1)); err == nil {
+		t.Errorf("expected error for unknown policy")
+	}
+}
@@ -0,0 +1,463 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/iwongu/jsonata-go/jlib"
+	"github.com/iwongu/jsonata-go/jparse"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// DisableFunctions stops expressions compiled by c from calling
+// the named functions, which may be built-ins, extensions or
+// modules. Names may start with a $, e.g.
+//
+//	c.DisableFunctions("$random", "$shuffle", "$millis", "$now")
+//
+// A reference to a disabled function is a compile error, a
+// *CompileError that wraps a *DisabledFunctionError, unless the
+// expression assigns the name itself. A disabled function that's
+// reached some other way fails with a *DisabledFunctionError
+// when it's called. Names that aren't defined are ignored, so the
+// same list can be used with compilers that have different
+// extensions. DisableFunctions applies to expressions compiled
+// after it's called and must not be called at the same time as
+// Compile.
+func (c *Compiler) DisableFunctions(names ...string) error {
+
+	if c.frozen {
+		return errDefaultFrozen()
+	}
+
+	if c.disabled == nil {
+		c.disabled = make(map[string]bool, len(names))
+	}
+	for _, name := range names {
+		c.disabled[strings.TrimPrefix(name, "$")] = true
+	}
+
+	return nil
+}
+
+// AllowFunctions restricts the built-in functions available to
+// expressions compiled by c to the named ones, for evaluating
+// untrusted expressions with a known set of functions. Names may
+// start with a $. The other built-ins are disabled as if they
+// were passed to DisableFunctions. Extensions and modules are
+// still available because the Compiler's owner registered them;
+// use DisableFunctions to remove them. Calling AllowFunctions
+// again adds to the allowed functions.
+func (c *Compiler) AllowFunctions(names ...string) error {
+
+	if c.frozen {
+		return errDefaultFrozen()
+	}
+
+	if c.allowed == nil {
+		c.allowed = make(map[string]bool, len(names))
+	}
+	for _, name := range names {
+		c.allowed[strings.TrimPrefix(name, "$")] = true
+	}
+
+	return nil
+}
+
+// WithDisabledFunctions disables functions, as DisableFunctions
+// does, for compilers that are only set up with options.
+func WithDisabledFunctions(names ...string) CompilerOption {
+	return func(c *Compiler) error {
+		return c.DisableFunctions(names...)
+	}
+}
+
+// WithAllowedFunctions restricts the built-in functions, as
+// AllowFunctions does, for compilers that are only set up with
+// options.
+func WithAllowedFunctions(names ...string) CompilerOption {
+	return func(c *Compiler) error {
+		return c.AllowFunctions(names...)
+	}
+}
+
+// WithMaxStringLength limits the strings made by the $pad, $join,
+// $replace and $formatNumber functions in expressions compiled by
+// the Compiler to n bytes, so that untrusted expressions can't
+// allocate huge strings, e.g. with $pad("", 1e9). A call whose
+// result would be longer fails with a jlib.Error of type
+// jlib.ErrStringTooLong, usually before the string is built (see
+// jlib.StringLimit).
+func WithMaxStringLength(n int) CompilerOption {
+	return func(c *Compiler) error {
+		limit := jlib.StringLimit(n)
+		if !limit.IsValid() {
+			return fmt.Errorf("invalid string length limit %d", n)
+		}
+		c.stringLimit = limit
+		if err := c.replaceStringFuncs(); err != nil {
+			return err
+		}
+		for name, fn := range map[string]interface{}{
+			"join":         limit.Join,
+			"replace":      limit.Replace,
+			"formatNumber": limit.FormatNumber,
+		} {
+			if err := c.replaceBuiltin(name, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// SizeLimits caps the size of the values that an expression
+// builds during evaluation (see WithSizeLimits). A zero field
+// means no limit.
+type SizeLimits struct {
+	// Items is the maximum number of items in an array made
+	// by a range, such as [1..n], an array constructor, a
+	// built-in function such as $append or $map, or a path step
+	// that joins the arrays of several items, as in
+	// orders.lines, and the maximum number of keys in an
+	// object constructor. Arrays in the input and the results
+	// of extensions aren't limited.
+	Items int
+
+	// Bytes is the maximum length of a string made by the &
+	// operator.
+	Bytes int
+}
+
+// WithSizeLimits stops expressions compiled by the Compiler from
+// building arrays, objects and strings larger than the limits,
+// so that untrusted expressions such as [1..10000000] or a
+// string doubled in a loop with & can't exhaust memory. An
+// operation whose result would be too large fails with an
+// *EvalError of type ErrResultTooLarge, before it builds the
+// result where the size is known in advance.
+func WithSizeLimits(limits SizeLimits) CompilerOption {
+	return func(c *Compiler) error {
+		if limits.Items < 0 || limits.Bytes < 0 {
+			return fmt.Errorf("invalid size limits %+v", limits)
+		}
+		c.limits = limits
+		return nil
+	}
+}
+
+// checkItems returns an ErrResultTooLarge error if n is more
+// than the number of items allowed by the evaluation's
+// SizeLimits. token is the operator that made the items.
+func (s *environment) checkItems(n int, token string) error {
+	if s == nil || s.state == nil {
+		return nil
+	}
+	if max := s.state.limits.Items; max > 0 && n > max {
+		return newEvalError(ErrResultTooLarge, token, fmt.Sprintf("%d items", max))
+	}
+	return nil
+}
+
+// checkResultItems is like checkItems for the result of a call
+// to gc, if gc is a built-in function that returns an array, such
+// as $append or $map. The results of extensions aren't checked.
+func (s *environment) checkResultItems(v reflect.Value, gc *goCallable) error {
+
+	if s == nil || s.state == nil || s.state.limits.Items == 0 || gc.isExtension {
+		return nil
+	}
+
+	if seq, ok := asSequence(v); ok {
+		return s.checkItems(seq.Len(), "$"+gc.Name())
+	}
+	if r := jtypes.Resolve(v); jtypes.IsArray(r) {
+		return s.checkItems(r.Len(), "$"+gc.Name())
+	}
+
+	return nil
+}
+
+// checkBytes is like checkItems for the length of a string.
+func (s *environment) checkBytes(n int, token string) error {
+	if s == nil || s.state == nil {
+		return nil
+	}
+	if max := s.state.limits.Bytes; max > 0 && n > max {
+		return newEvalError(ErrResultTooLarge, token, fmt.Sprintf("%d bytes", max))
+	}
+	return nil
+}
+
+// CompileLimits caps the size and complexity of the expressions
+// that a Compiler accepts (see WithCompileLimits). A zero field
+// means no limit.
+type CompileLimits struct {
+	// Length is the maximum length of an expression's source
+	// in bytes, after placeholders are replaced (see
+	// WithInterpolation).
+	Length int
+
+	// Nodes is the maximum number of nodes in an expression's
+	// syntax tree.
+	Nodes int
+
+	// Depth is the maximum nesting depth of an expression's
+	// syntax tree. The top-level node has a depth of 1.
+	Depth int
+}
+
+// WithCompileLimits makes Compile fail for expressions that are
+// longer, have more nodes or are nested more deeply than the
+// limits, so that a service that compiles untrusted expressions
+// can reject absurd ones before they run. The error is a
+// *CompileError that wraps a *CompileLimitError. Expressions
+// that are too long are rejected before they're parsed.
+func WithCompileLimits(limits CompileLimits) CompilerOption {
+	return func(c *Compiler) error {
+		if limits.Length < 0 || limits.Nodes < 0 || limits.Depth < 0 {
+			return fmt.Errorf("invalid compile limits %+v", limits)
+		}
+		c.compileLimits = limits
+		return nil
+	}
+}
+
+// A CompileLimitError is the error for an expression that
+// exceeds one of a Compiler's CompileLimits. Limit is "length",
+// "nodes" or "depth".
+type CompileLimitError struct {
+	Limit string
+	Size  int
+	Max   int
+}
+
+func (e *CompileLimitError) Error() string {
+	switch e.Limit {
+	case "length":
+		return fmt.Sprintf("the expression is %d bytes long, more than the limit of %d", e.Size, e.Max)
+	case "nodes":
+		return fmt.Sprintf("the expression has %d nodes, more than the limit of %d", e.Size, e.Max)
+	default:
+		return fmt.Sprintf("the expression is nested %d levels deep, more than the limit of %d", e.Size, e.Max)
+	}
+}
+
+// checkLength returns a compile error if src is longer than the
+// Compiler's limit.
+func (c *Compiler) checkLength(src string) *CompileError {
+	if max := c.compileLimits.Length; max > 0 && len(src) > max {
+		return newCompileError(&CompileLimitError{Limit: "length", Size: len(src), Max: max}, src)
+	}
+	return nil
+}
+
+// checkComplexity returns a compile error if a syntax tree has
+// more nodes, or is nested more deeply, than the Compiler's
+// limits. An error for the depth is located at the first node
+// that's too deep.
+func (c *Compiler) checkComplexity(root jparse.Node, src string, ranges map[jparse.Node]jparse.Range) *CompileError {
+
+	limits := c.compileLimits
+
+	if max := limits.Nodes; max > 0 {
+		n := 0
+		jparse.Walk(root, func(jparse.Node) bool {
+			n++
+			return true
+		})
+		if n > max {
+			return newCompileError(&CompileLimitError{Limit: "nodes", Size: n, Max: max}, src)
+		}
+	}
+
+	if max := limits.Depth; max > 0 {
+
+		var deep jparse.Node
+		var maxDepth int
+		var walk func(node jparse.Node, depth int)
+		walk = func(node jparse.Node, depth int) {
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+			if depth > max && deep == nil {
+				deep = node
+			}
+			for _, child := range jparse.Children(node) {
+				walk(child, depth+1)
+			}
+		}
+		walk(root, 1)
+
+		if deep != nil {
+			err := newCompileError(&CompileLimitError{Limit: "depth", Size: maxDepth, Max: max}, src)
+			if r, ok := ranges[deep]; ok {
+				err.Token = src[r.Start:r.End]
+				err.Position = r.Start
+				err.Line, err.Column = lineColumn(src, r.Start)
+				err.SourceLine = sourceLine(src, r.Start)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A DisabledFunctionError is the error for a reference to, or a
+// call of, a function that's disabled (see DisableFunctions and
+// AllowFunctions).
+type DisabledFunctionError struct {
+	Name string
+}
+
+func (e *DisabledFunctionError) Error() string {
+	return fmt.Sprintf("function $%s is disabled", e.Name)
+}
+
+// functionDisabled returns true if expressions compiled by c
+// can't call the named function.
+func (c *Compiler) functionDisabled(name string) bool {
+
+	if c.disabled[name] {
+		return true
+	}
+
+	if c.allowed == nil || c.allowed[name] || !isBuiltinName(name) {
+		return false
+	}
+
+	// Extensions and variables that replace a built-in are
+	// allowed, but built-ins that are replaced by options,
+	// such as WithRoundingMode, aren't.
+	if v, ok := c.baseRegistry[name]; ok {
+		return isReplacedBuiltin(v)
+	}
+
+	return true
+}
+
+// disabledFunctions returns the names of the functions that
+// expressions compiled by c can't call.
+func (c *Compiler) disabledFunctions() []string {
+
+	if c.disabled == nil && c.allowed == nil {
+		return nil
+	}
+
+	var names []string
+	seen := map[string]bool{}
+
+	add := func(name string) {
+		if !seen[name] && c.functionDisabled(name) {
+			names = append(names, name)
+		}
+		seen[name] = true
+	}
+
+	for name := range c.disabled {
+		add(name)
+	}
+	if c.allowed != nil {
+		for name := range baseEnv.symbols {
+			add(name)
+		}
+		for name := range timeCallables(time.Time{}) {
+			add(name)
+		}
+	}
+
+	return names
+}
+
+// isBuiltinName returns true if name is a built-in function.
+func isBuiltinName(name string) bool {
+	if _, ok := baseEnv.symbols[name]; ok {
+		return true
+	}
+	return name == "millis" || name == "now"
+}
+
+// checkDisabled returns a compile error for each reference to a
+// disabled function in a syntax tree. Names assigned anywhere in
+// the expression, or in the prelude, are treated as defined
+// everywhere in it.
+func (c *Compiler) checkDisabled(root jparse.Node, src string, ranges map[jparse.Node]jparse.Range) CompileErrors {
+
+	if c.disabled == nil && c.allowed == nil {
+		return nil
+	}
+
+	bound := map[string]bool{}
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+		switch node := node.(type) {
+		case *jparse.AssignmentNode:
+			bound[node.Name] = true
+		case *jparse.LambdaNode:
+			for _, name := range node.ParamNames {
+				bound[name] = true
+			}
+		case *jparse.TypedLambdaNode:
+			for _, name := range node.ParamNames {
+				bound[name] = true
+			}
+		}
+		return true
+	})
+
+	var errs CompileErrors
+
+	jparse.Walk(root, func(node jparse.Node) bool {
+
+		v, ok := node.(*jparse.VariableNode)
+		if !ok || v.Name == "" || bound[v.Name] || c.prelude.defines(v.Name) || !c.functionDisabled(v.Name) {
+			return true
+		}
+
+		err := newCompileError(&DisabledFunctionError{Name: v.Name}, src)
+		if r, ok := ranges[v]; ok {
+			err.Token = src[r.Start:r.End]
+			err.Position = r.Start
+			err.Line, err.Column = lineColumn(src, r.Start)
+			err.SourceLine = sourceLine(src, r.Start)
+		}
+		errs = append(errs, err)
+
+		return true
+	})
+
+	return errs
+}
+
+// A disabledCallable stands in for a disabled function at
+// runtime. Unlike the other callables, it isn't renamed when
+// it's called because it's shared by concurrent evaluations.
+type disabledCallable struct {
+	callableMarshaler
+	name string
+}
+
+func newDisabledCallable(name string) reflect.Value {
+	return reflect.ValueOf(&disabledCallable{
+		name: name,
+	})
+}
+
+func (f *disabledCallable) Name() string {
+	return f.name
+}
+
+func (f *disabledCallable) ParamCount() int {
+	return 0
+}
+
+func (f *disabledCallable) Call([]reflect.Value) (reflect.Value, error) {
+	return undefined, &DisabledFunctionError{Name: f.name}
+}
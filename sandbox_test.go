@@ -0,0 +1,347 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/iwongu/jsonata-go/jlib"
+)
+
+func TestCompiler_DisableFunctions(t *testing.T) {
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"lookup": {Func: func(s string) string { return s }},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	if err := comp.DisableFunctions("$random", "shuffle", "$now", "lookup", "$nosuchfunc"); err != nil {
+		t.Fatalf("DisableFunctions failed: %v", err)
+	}
+
+	for _, expr := range []string{
+		`$random()`,
+		`$shuffle([1, 2])`,
+		`$now()`,
+		`$lookup("a")`,
+		`$map([1, 2], $random)`,
+		`[1, 2] ~> $shuffle`,
+	} {
+		_, err := comp.Compile(expr)
+
+		var derr *DisabledFunctionError
+		if !errors.As(err, &derr) {
+			t.Errorf("%s: expected a DisabledFunctionError, got %v", expr, err)
+		}
+
+		var cerr *CompileError
+		if !errors.As(err, &cerr) || cerr.Position < 0 || cerr.Token != "$"+derr.Name {
+			t.Errorf("%s: expected a CompileError with a position, got %v", expr, err)
+		}
+	}
+
+	// CompileAll reports every reference.
+	_, err = comp.CompileAll(`$random() + $count($shuffle([1]))`)
+	var cerrs CompileErrors
+	if !errors.As(err, &cerrs) || len(cerrs) != 2 {
+		t.Errorf("expected two CompileErrors, got %v", err)
+	}
+
+	// Other functions, and names that the expression assigns,
+	// are still allowed.
+	for _, expr := range []string{
+		`$sum([1, 2])`,
+		`($random := function() { 4 }; $random())`,
+		`$map([1, 2], function($now) { $now * 2 })`,
+	} {
+		if _, err := comp.MustCompile(expr).Eval(nil, nil); err != nil {
+			t.Errorf("%s: unexpected error: %v", expr, err)
+		}
+	}
+
+	// Disabled functions that can't be detected at compile
+	// time fail when they're called.
+	_, err = comp.MustCompile(`($random := $random; $random())`).Eval(nil, nil)
+	var derr *DisabledFunctionError
+	if !errors.As(err, &derr) || derr.Name != "random" {
+		t.Errorf("expected a DisabledFunctionError, got %v", err)
+	}
+	var eerr *EvalError
+	if !errors.As(err, &eerr) || eerr.Position < 0 {
+		t.Errorf("expected an EvalError with a position, got %v", err)
+	}
+
+	// Disabled functions aren't documented.
+	for _, doc := range comp.FunctionDocs() {
+		if doc.Name == "random" || doc.Name == "now" || doc.Name == "lookup" {
+			t.Errorf("expected no docs for disabled function %s", doc.Name)
+		}
+	}
+}
+
+func TestCompiler_AllowFunctions(t *testing.T) {
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"lookup": {Func: func(s string) string { return s }},
+		"round":  {Func: func(n float64) float64 { return n }},
+	}, WithAllowedFunctions("$sum", "$string", "count"))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	// Extensions, including ones that replace built-ins, are
+	// allowed.
+	for _, expr := range []string{
+		`$sum([1, 2]) & $string(3) & $count([4])`,
+		`$lookup("a")`,
+		`$round(1.5)`,
+	} {
+		if _, err := comp.MustCompile(expr).Eval(nil, nil); err != nil {
+			t.Errorf("%s: unexpected error: %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{
+		`$uppercase("a")`,
+		`$millis()`,
+		`$map([1], $string)`,
+	} {
+		var derr *DisabledFunctionError
+		if _, err := comp.Compile(expr); !errors.As(err, &derr) {
+			t.Errorf("%s: expected a DisabledFunctionError, got %v", expr, err)
+		}
+	}
+
+	// Functions can be disabled as well.
+	if err := comp.DisableFunctions("lookup"); err != nil {
+		t.Fatalf("DisableFunctions failed: %v", err)
+	}
+	if _, err := comp.Compile(`$lookup("a")`); err == nil || err.Error() != "function $lookup is disabled at line 1, column 1\n$lookup(\"a\")\n^" {
+		t.Errorf("unexpected error %q", err)
+	}
+}
+
+func TestCompiler_WithMaxStringLength(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil, WithMaxStringLength(10))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	for _, test := range []struct {
+		Expression string
+		Output     interface{}
+		Error      string
+	}{
+		{
+			Expression: `$pad("ab", 10, "-")`,
+			Output:     "ab--------",
+		},
+		{
+			Expression: `$pad("", 1e9)`,
+			Error:      "pad: result is longer than the limit of 10 bytes",
+		},
+		{
+			Expression: `$pad("", -6, "ééé")`,
+			Error:      "pad: result is longer than the limit of 10 bytes",
+		},
+		{
+			Expression: `$join(["abc", "def"], ", ")`,
+			Output:     "abc, def",
+		},
+		{
+			Expression: `$join(["abc", "def", "g"], ", ")`,
+			Error:      "join: result is longer than the limit of 10 bytes",
+		},
+		{
+			Expression: `$replace("aaaa", "a", "bb")`,
+			Output:     "bbbbbbbb",
+		},
+		{
+			Expression: `$replace("aaaa", "a", "bbb")`,
+			Error:      "replace: result is longer than the limit of 10 bytes",
+		},
+		{
+			Expression: `$replace("aaaa", "a", "bbb", 2)`,
+			Output:     "bbbbbbaa",
+		},
+		{
+			Expression: `$replace("aaaa", /a/, "bbb")`,
+			Error:      "replace: result is longer than the limit of 10 bytes",
+		},
+		{
+			Expression: `$formatNumber(1234.5, "#,##0.00")`,
+			Output:     "1,234.50",
+		},
+		{
+			Expression: `$formatNumber(1, "000000000000")`,
+			Error:      "formatNumber: result is longer than the limit of 10 bytes",
+		},
+	} {
+		got, err := comp.MustCompile(test.Expression).Eval(nil, nil)
+
+		var jerr *jlib.Error
+		switch {
+		case test.Error == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.Expression, err)
+		case test.Error == "" && got != test.Output:
+			t.Errorf("%s: expected %q, got %q", test.Expression, test.Output, got)
+		case test.Error != "" && (!errors.As(err, &jerr) || jerr.Type != jlib.ErrStringTooLong || jerr.Error() != test.Error):
+			t.Errorf("%s: expected error %q, got %v", test.Expression, test.Error, err)
+		}
+	}
+
+	if _, err := NewCompiler(nil, nil, WithMaxStringLength(0)); err == nil {
+		t.Errorf("expected an error for a zero limit")
+	}
+}
+
+func TestCompiler_WithSizeLimits(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil, WithSizeLimits(SizeLimits{Items: 100, Bytes: 64}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	for _, test := range []struct {
+		Expression string
+		Error      string
+	}{
+		{
+			Expression: `$count([1..100])`,
+		},
+		{
+			Expression: `[1..100000000]`,
+			Error:      "result of .. is larger than the limit of 100 items",
+		},
+		{
+			Expression: `[[1..60], [1..60]]`,
+		},
+		{
+			Expression: `[0, $append([1..60], [1..40])]`,
+			Error:      "result of [ is larger than the limit of 100 items",
+		},
+		{
+			Expression: `$append([1..90], [1..90])`,
+			Error:      "result of $append is larger than the limit of 100 items",
+		},
+		{
+			Expression: `($f := function($a, $n) { $n = 0 ? $a : $f($append($a, $a), $n - 1) }; $f([1], 40))`,
+			Error:      "result of $append is larger than the limit of 100 items",
+		},
+		{
+			Expression: `$map([1..60], function($v) { $v }) ~> $append([1..40])`,
+		},
+		{
+			Expression: `$map([1..60], function($v) { [$v, $v] }) ~> $count()`,
+		},
+		{
+			Expression: `[1..60].([$, $])`,
+			Error:      "result of . is larger than the limit of 100 items",
+		},
+		{
+			Expression: `[1..101].{$string(): $}`,
+			Error:      "result of .. is larger than the limit of 100 items",
+		},
+		{
+			Expression: `[1..60].[$, $] ~> $count()`,
+		},
+		{
+			Expression: `[1..60]{$string(): $}`,
+		},
+		{
+			Expression: `$pad("", 32, "x") & $pad("", 32, "x")`,
+		},
+		{
+			Expression: `($f := function($s, $n) { $n = 0 ? $s : $f($s & $s, $n - 1) }; $f("ab", 10))`,
+			Error:      "result of & is larger than the limit of 64 bytes",
+		},
+	} {
+		_, err := comp.MustCompile(test.Expression).Eval(nil, nil)
+
+		var eerr *EvalError
+		switch {
+		case test.Error == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.Expression, err)
+		case test.Error != "" && (!errors.As(err, &eerr) || eerr.Type != ErrResultTooLarge || eerr.Error() != test.Error || eerr.Position < 0):
+			t.Errorf("%s: expected error %q, got %v", test.Expression, test.Error, err)
+		}
+	}
+
+	// Arrays in the input aren't limited, but values built
+	// from them are.
+	var input []interface{}
+	for i := 0; i < 101; i++ {
+		input = append(input, i)
+	}
+	if _, err := comp.MustCompile(`$count($)`).Eval(input, nil); err != nil {
+		t.Errorf("unexpected error for a large input: %v", err)
+	}
+	want := "result of { is larger than the limit of 100 items"
+	if _, err := comp.MustCompile(`${$string(): $}`).Eval(input, nil); err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+
+	if _, err := NewCompiler(nil, nil, WithSizeLimits(SizeLimits{Items: -1})); err == nil {
+		t.Errorf("expected an error for a negative limit")
+	}
+}
+
+func TestCompiler_WithCompileLimits(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil, WithCompileLimits(CompileLimits{Length: 40, Nodes: 10, Depth: 4}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	for _, test := range []struct {
+		Expression string
+		Limit      string
+		Error      string
+	}{
+		{
+			Expression: `$sum(Order.Price)`,
+		},
+		{
+			Expression: `"` + strings.Repeat("a", 40) + `"`,
+			Limit:      "length",
+			Error:      "the expression is 42 bytes long, more than the limit of 40",
+		},
+		{
+			Expression: `[1, 2, 3, 4, 5, 6, 7, 8, 9, 10]`,
+			Limit:      "nodes",
+			Error:      "the expression has 11 nodes, more than the limit of 10",
+		},
+		{
+			Expression: `[[[[1]]]]`,
+			Limit:      "depth",
+			Error:      "the expression is nested 5 levels deep, more than the limit of 4 at line 1, column 5\n[[[[1]]]]\n    ^",
+		},
+	} {
+		for _, compile := range []func(string) (*Expression, error){comp.Compile, comp.CompileAll} {
+
+			_, err := compile(test.Expression)
+			if errs, ok := err.(CompileErrors); ok && len(errs) == 1 {
+				err = errs[0]
+			}
+
+			var lerr *CompileLimitError
+			switch {
+			case test.Error == "" && err != nil:
+				t.Errorf("%s: unexpected error: %v", test.Expression, err)
+			case test.Error != "" && (!errors.As(err, &lerr) || lerr.Limit != test.Limit || err.Error() != test.Error):
+				t.Errorf("%s: expected error %q, got %v", test.Expression, test.Error, err)
+			}
+		}
+	}
+
+	if _, err := NewCompiler(nil, nil, WithCompileLimits(CompileLimits{Depth: -1})); err == nil {
+		t.Errorf("expected an error for a negative limit")
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+
+	"github.com/iwongu/jsonata-go/jlib"
+	"github.com/iwongu/jsonata-go/jtypes"
+)
+
+// ShardIndex returns the shard, from 0 to shards-1, for a key.
+// It uses the FNV-1a hash of the key, so the same key always
+// maps to the same shard, in every process and in every version
+// of jsonata-go. ShardIndex panics if shards isn't positive.
+func ShardIndex(key string, shards int) int {
+
+	if shards <= 0 {
+		panicf("invalid number of shards %d", shards)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	return int(h.Sum64() % uint64(shards))
+}
+
+// Partition splits a batch of items into shards by evaluating e,
+// the shard key, against each item, e.g. customerId. The key is
+// converted to a string as $string does and passed to
+// ShardIndex, so items with the same key end up in the same
+// shard, wherever Partition runs. Items keep their order within
+// a shard. Partition fails if the key is undefined for an item.
+func (e *Expression) Partition(items []interface{}, shards int) ([][]interface{}, error) {
+
+	if shards <= 0 {
+		return nil, fmt.Errorf("invalid number of shards %d", shards)
+	}
+
+	ev := e.NewEvaluator()
+	parts := make([][]interface{}, shards)
+
+	for i, item := range items {
+
+		v, err := ev.EvalContext(context.Background(), item, nil)
+		if err == ErrUndefined {
+			return nil, fmt.Errorf("item %d has no shard key", i)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+
+		key, err := jlib.String(v)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+
+		n := ShardIndex(key, shards)
+		parts[n] = append(parts[n], item)
+	}
+
+	return parts, nil
+}
+
+// A Merger combines the results of an aggregate expression from
+// two shards into the result for both (see MergeShards). The
+// Mergers in this package accept the values returned by Eval.
+type Merger func(a, b interface{}) (interface{}, error)
+
+// MergeShards combines the per-shard results of an aggregate
+// expression with m. Results that are nil, e.g. from shards for
+// which the expression returned ErrUndefined, are skipped.
+// MergeShards returns nil if every result is nil.
+//
+// Shards must return partial results that can be merged. An
+// average, for instance, can't be merged from per-shard
+// averages: have each shard return {"sum": $sum(x), "count":
+// $count(x)} instead, merge them with MergeFields, and divide
+// the merged sum by the merged count.
+func MergeShards(results []interface{}, m Merger) (interface{}, error) {
+
+	var merged interface{}
+
+	for _, res := range results {
+		if res == nil {
+			continue
+		}
+		if merged == nil {
+			merged = res
+			continue
+		}
+		var err error
+		if merged, err = m(merged, res); err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
+
+// MergeSum adds the results of $sum, or of any other numeric
+// expression, from two shards.
+func MergeSum(a, b interface{}) (interface{}, error) {
+
+	x, y, err := mergeNumbers(a, b, "sum")
+	if err != nil {
+		return nil, err
+	}
+
+	return x + y, nil
+}
+
+// MergeCount adds the results of $count from two shards.
+func MergeCount(a, b interface{}) (interface{}, error) {
+
+	x, y, err := mergeNumbers(a, b, "count")
+	if err != nil {
+		return nil, err
+	}
+
+	return int(x + y), nil
+}
+
+// MergeMin returns the smaller of the results of $min from two
+// shards.
+func MergeMin(a, b interface{}) (interface{}, error) {
+
+	x, y, err := mergeNumbers(a, b, "min")
+	if err != nil {
+		return nil, err
+	}
+
+	if y < x {
+		return y, nil
+	}
+	return x, nil
+}
+
+// MergeMax returns the larger of the results of $max from two
+// shards.
+func MergeMax(a, b interface{}) (interface{}, error) {
+
+	x, y, err := mergeNumbers(a, b, "max")
+	if err != nil {
+		return nil, err
+	}
+
+	if y > x {
+		return y, nil
+	}
+	return x, nil
+}
+
+// MergeAppend concatenates the results of two shards as
+// $append does. A result that isn't an array is treated as an
+// array of one item.
+func MergeAppend(a, b interface{}) (interface{}, error) {
+
+	var items []interface{}
+
+	for _, v := range []interface{}{a, b} {
+		rv := jtypes.Resolve(reflect.ValueOf(v))
+		if !jtypes.IsArray(rv) {
+			items = append(items, v)
+			continue
+		}
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, rv.Index(i).Interface())
+		}
+	}
+
+	return items, nil
+}
+
+// MergeGroups returns a Merger for grouped aggregates, objects
+// whose keys are groups and whose values are aggregates, as in
+// Order{Region: $sum(Total)}. Groups that only appear in one
+// shard are copied, and groups that appear in both are merged
+// with m.
+func MergeGroups(m Merger) Merger {
+	return func(a, b interface{}) (interface{}, error) {
+
+		x, y, err := mergeObjects(a, b)
+		if err != nil {
+			return nil, err
+		}
+
+		merged := make(map[string]interface{}, len(x)+len(y))
+		for k, v := range x {
+			merged[k] = v
+		}
+
+		for k, v := range y {
+			if prev, ok := merged[k]; ok {
+				if v, err = m(prev, v); err != nil {
+					return nil, fmt.Errorf("group %q: %w", k, err)
+				}
+			}
+			merged[k] = v
+		}
+
+		return merged, nil
+	}
+}
+
+// MergeFields returns a Merger for objects whose fields are
+// different aggregates, such as {"total": $sum(x), "n":
+// $count(x), "top": $max(x)}. Each field in fields is merged with
+// its Merger. Other fields are taken from the first shard that
+// has them, e.g. a group's name.
+func MergeFields(fields map[string]Merger) Merger {
+	return func(a, b interface{}) (interface{}, error) {
+
+		x, y, err := mergeObjects(a, b)
+		if err != nil {
+			return nil, err
+		}
+
+		merged := make(map[string]interface{}, len(x)+len(y))
+		for k, v := range x {
+			merged[k] = v
+		}
+
+		for k, v := range y {
+			prev, ok := merged[k]
+			switch m := fields[k]; {
+			case !ok:
+				merged[k] = v
+			case m != nil:
+				if merged[k], err = m(prev, v); err != nil {
+					return nil, fmt.Errorf("field %q: %w", k, err)
+				}
+			}
+		}
+
+		return merged, nil
+	}
+}
+
+func mergeNumbers(a, b interface{}, name string) (float64, float64, error) {
+
+	x, ok := jtypes.AsNumber(reflect.ValueOf(a))
+	if !ok {
+		return 0, 0, fmt.Errorf("cannot merge %s: %v is not a number", name, a)
+	}
+
+	y, ok := jtypes.AsNumber(reflect.ValueOf(b))
+	if !ok {
+		return 0, 0, fmt.Errorf("cannot merge %s: %v is not a number", name, b)
+	}
+
+	return x, y, nil
+}
+
+func mergeObjects(a, b interface{}) (map[string]interface{}, map[string]interface{}, error) {
+
+	x, ok := a.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("cannot merge %T: expected an object", a)
+	}
+
+	y, ok := b.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("cannot merge %T: expected an object", b)
+	}
+
+	return x, y, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShardIndex(t *testing.T) {
+
+	// The shards must never change, since other processes
+	// (and other versions) rely on them.
+	for _, test := range []struct {
+		Key    string
+		Shards int
+		Shard  int
+	}{
+		{"", 7, 14695981039346656037 % 7},
+		{"a", 16, 0xaf63dc4c8601ec8c % 16},
+		{"customer-42", 1, 0},
+	} {
+		if got := ShardIndex(test.Key, test.Shards); got != test.Shard {
+			t.Errorf("%q: expected shard %d, got %d", test.Key, test.Shard, got)
+		}
+	}
+}
+
+func TestExpression_Partition(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	var items []interface{}
+	for i := 0; i < 100; i++ {
+		items = append(items, map[string]interface{}{
+			"customer": float64(i % 10),
+			"total":    float64(i),
+		})
+	}
+
+	parts, err := comp.MustCompile(`customer`).Partition(items, 4)
+	if err != nil {
+		t.Fatalf("Partition failed: %v", err)
+	}
+	if len(parts) != 4 {
+		t.Fatalf("expected 4 shards, got %d", len(parts))
+	}
+
+	n := 0
+	for i, part := range parts {
+		for _, item := range part {
+			key := item.(map[string]interface{})["customer"].(float64)
+			if want := ShardIndex(formatShardKey(key), 4); want != i {
+				t.Errorf("customer %v: expected shard %d, got %d", key, want, i)
+			}
+		}
+		n += len(part)
+	}
+	if n != len(items) {
+		t.Errorf("expected %d items, got %d", len(items), n)
+	}
+
+	// Aggregates evaluated per shard and merged match the
+	// aggregates of the whole batch.
+	for _, test := range []struct {
+		Expression string
+		Merger     Merger
+	}{
+		{`$sum(total)`, MergeSum},
+		{`$count(total)`, MergeCount},
+		{`$min(total)`, MergeMin},
+		{`$max(total)`, MergeMax},
+		{`${$string(customer): $sum(total)}`, MergeGroups(MergeSum)},
+		{`${$string(customer): {"n": $count(total), "top": $max(total), "customer": customer[0]}}`, MergeGroups(MergeFields(map[string]Merger{
+			"n":   MergeCount,
+			"top": MergeMax,
+		}))},
+	} {
+		e := comp.MustCompile(test.Expression)
+
+		want, err := e.Eval(items, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.Expression, err)
+		}
+
+		var results []interface{}
+		for _, part := range parts {
+			res, err := e.Eval(part, nil)
+			if err != nil && err != ErrUndefined {
+				t.Fatalf("%s: unexpected error: %v", test.Expression, err)
+			}
+			results = append(results, res)
+		}
+
+		got, err := MergeShards(results, test.Merger)
+		if err != nil {
+			t.Fatalf("%s: MergeShards failed: %v", test.Expression, err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", test.Expression, want, got)
+		}
+	}
+
+	// Appended items are in shard order.
+	got, err := MergeShards([]interface{}{[]interface{}{1.0, 2.0}, nil, 3.0}, MergeAppend)
+	if err != nil || !reflect.DeepEqual(got, []interface{}{1.0, 2.0, 3.0}) {
+		t.Errorf("expected [1 2 3], got %v (%v)", got, err)
+	}
+
+	if _, err := comp.MustCompile(`nothing`).Partition(items, 4); err == nil || err.Error() != "item 0 has no shard key" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if _, err := MergeShards([]interface{}{1.0, "a"}, MergeSum); err == nil || err.Error() != "cannot merge sum: a is not a number" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func formatShardKey(key float64) string {
+	v, _ := Eval(`$string($)`, key)
+	return v.(string)
+}
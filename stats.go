@@ -0,0 +1,182 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EvalStats holds the statistics of the evaluations that were
+// run with a context returned by WithEvalStats.
+type EvalStats struct {
+	// EvalID is the evaluation ID (see WithEvalID), if there
+	// is one.
+	EvalID string
+
+	// Evaluations is the number of evaluations that the
+	// statistics cover, e.g. one for each expression that a
+	// Bundle evaluated.
+	Evaluations int
+
+	// Nodes is the number of syntax tree nodes that were
+	// evaluated. A node is counted each time it's evaluated,
+	// e.g. once for each item in the array that a path step
+	// is mapped over.
+	Nodes int64
+
+	// MaxDepth is the deepest nesting of node evaluations,
+	// which grows with recursive functions (see
+	// ErrStackOverflow).
+	MaxDepth int
+
+	// Calls is the number of function calls in the
+	// expressions, and BuiltinCalls is the number of those
+	// that called built-in functions. Calls that functions
+	// make, such as $map calling its function argument, aren't
+	// counted.
+	Calls        int64
+	BuiltinCalls int64
+
+	// Allocs and AllocBytes are the number of heap allocations
+	// and the bytes allocated while the evaluations ran. They
+	// are read from the runtime's process-wide counters, so
+	// they include the allocations of other goroutines and
+	// are only approximate on a busy server.
+	Allocs     uint64
+	AllocBytes uint64
+
+	// Duration is the total time taken by the evaluations.
+	Duration time.Duration
+}
+
+// String returns the statistics on a single line, for logs.
+func (s *EvalStats) String() string {
+	id := ""
+	if s.EvalID != "" {
+		id = "[" + s.EvalID + "] "
+	}
+	return fmt.Sprintf("%s%d evaluations, %d nodes, depth %d, %d calls (%d built-in), %d allocs (%d bytes) in %s",
+		id, s.Evaluations, s.Nodes, s.MaxDepth, s.Calls, s.BuiltinCalls, s.Allocs, s.AllocBytes, s.Duration)
+}
+
+type evalStatsKey struct{}
+
+// WithEvalStats returns a copy of ctx that records the
+// statistics of the evaluations that it's passed to (via
+// EvalContext or the EvalContext method of a Bundle, RuleSet,
+// Template or EvalGroup) in stats. The statistics of several
+// evaluations are added together. They can be logged with each
+// request to catch expressions that do far more work than
+// expected:
+//
+//	var stats jsonata.EvalStats
+//	res, err := expr.EvalContext(jsonata.WithEvalStats(ctx, &stats), data, nil)
+//	log.Printf("%s: %s", tenant, &stats)
+//
+// Evaluations without statistics don't pay for them. stats must
+// not be read until the evaluations have returned.
+func WithEvalStats(ctx context.Context, stats *EvalStats) context.Context {
+	return context.WithValue(ctx, evalStatsKey{}, stats)
+}
+
+// evalStats returns the EvalStats in ctx, or nil.
+func evalStats(ctx context.Context) *EvalStats {
+	stats, _ := ctx.Value(evalStatsKey{}).(*EvalStats)
+	return stats
+}
+
+// statsMutex serialises updates to EvalStats, which are shared by
+// concurrent evaluations in an EvalGroup.
+var statsMutex sync.Mutex
+
+// allocMetrics are the runtime metrics read for
+// EvalStats.Allocs and EvalStats.AllocBytes.
+var allocMetrics = []string{
+	"/gc/heap/allocs:objects",
+	"/gc/heap/allocs:bytes",
+}
+
+// A statsRecorder counts the work done by a single evaluation.
+// It's shared by the goroutines of a parallel evaluation.
+type statsRecorder struct {
+	nodes    int64
+	depth    int64
+	calls    int64
+	builtins int64
+	start    time.Time
+	allocs   []metrics.Sample
+}
+
+func newStatsRecorder() *statsRecorder {
+	r := &statsRecorder{
+		start: time.Now(),
+	}
+	r.allocs = readAllocs()
+	return r
+}
+
+// node records the evaluation of a node at a nesting depth.
+func (r *statsRecorder) node(depth int) {
+	atomic.AddInt64(&r.nodes, 1)
+	for {
+		cur := atomic.LoadInt64(&r.depth)
+		if int64(depth) <= cur || atomic.CompareAndSwapInt64(&r.depth, cur, int64(depth)) {
+			return
+		}
+	}
+}
+
+// call records a function call.
+func (r *statsRecorder) call(builtin bool) {
+	atomic.AddInt64(&r.calls, 1)
+	if builtin {
+		atomic.AddInt64(&r.builtins, 1)
+	}
+}
+
+// merge adds the recorded statistics to stats.
+func (r *statsRecorder) merge(ctx context.Context, stats *EvalStats) {
+
+	d := time.Since(r.start)
+	allocs := readAllocs()
+
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+
+	if stats.EvalID == "" {
+		stats.EvalID = EvalID(ctx)
+	}
+	stats.Evaluations++
+	stats.Nodes += atomic.LoadInt64(&r.nodes)
+	if depth := int(atomic.LoadInt64(&r.depth)); depth > stats.MaxDepth {
+		stats.MaxDepth = depth
+	}
+	stats.Calls += atomic.LoadInt64(&r.calls)
+	stats.BuiltinCalls += atomic.LoadInt64(&r.builtins)
+	stats.Allocs += allocDelta(r.allocs[0], allocs[0])
+	stats.AllocBytes += allocDelta(r.allocs[1], allocs[1])
+	stats.Duration += d
+}
+
+func readAllocs() []metrics.Sample {
+	samples := make([]metrics.Sample, len(allocMetrics))
+	for i, name := range allocMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	return samples
+}
+
+func allocDelta(before, after metrics.Sample) uint64 {
+	if before.Value.Kind() != metrics.KindUint64 || after.Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return after.Value.Uint64() - before.Value.Uint64()
+}
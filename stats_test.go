@@ -0,0 +1,154 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWithEvalStats(t *testing.T) {
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"double": {Func: func(n float64) float64 { return 2 * n }},
+	})
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	var stats EvalStats
+	ctx := WithEvalStats(WithEvalID(context.Background(), "req-1"), &stats)
+
+	// Five calls, four of them built-in, plus 20 nested calls
+	// of $fact.
+	e := comp.MustCompile(`($fact := function($n) { $n <= 1 ? 1 : $n * $fact($n - 1) }; $double($sum([1, 2])) + $count([3]) + $fact(20) * 0 + $length($string(1)))`)
+	if _, err := e.EvalContext(ctx, nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if stats.EvalID != "req-1" || stats.Evaluations != 1 {
+		t.Errorf("expected 1 evaluation with ID req-1, got %d with ID %q", stats.Evaluations, stats.EvalID)
+	}
+	if stats.Calls != 25 || stats.BuiltinCalls != 4 {
+		t.Errorf("expected 25 calls, 4 of them built-in, got %d and %d", stats.Calls, stats.BuiltinCalls)
+	}
+	if stats.Nodes < 100 {
+		t.Errorf("expected at least 100 nodes, got %d", stats.Nodes)
+	}
+	if stats.MaxDepth < 20 {
+		t.Errorf("expected a depth of at least 20, got %d", stats.MaxDepth)
+	}
+	if stats.Duration <= 0 {
+		t.Errorf("expected a duration, got %s", stats.Duration)
+	}
+
+	// Statistics of several evaluations are added together.
+	nodes := stats.Nodes
+	if _, err := comp.MustCompile(`[1..1000].($ * 2)`).EvalContext(ctx, nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Evaluations != 2 || stats.Nodes < nodes+1000 {
+		t.Errorf("expected 2 evaluations and at least %d nodes, got %d and %d", nodes+1000, stats.Evaluations, stats.Nodes)
+	}
+	if stats.Allocs == 0 || stats.AllocBytes == 0 {
+		t.Errorf("expected allocations, got %d (%d bytes)", stats.Allocs, stats.AllocBytes)
+	}
+
+	if s := stats.String(); !strings.HasPrefix(s, "[req-1] 2 evaluations, ") {
+		t.Errorf("unexpected string %q", s)
+	}
+
+	// Statistics are only recorded on request.
+	before := stats
+	if _, err := e.EvalContext(context.Background(), nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats != before {
+		t.Errorf("expected no statistics without WithEvalStats")
+	}
+}
+
+func TestWithEvalStats_TailCalls(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": 1},
+			map[string]interface{}{"price": 2},
+		},
+	}
+
+	// Function calls at the end of lambda bodies and in path
+	// steps are counted once per call.
+	for _, test := range []struct {
+		Expr  string
+		Nodes int64
+	}{
+		{`$map([1, 2], function($x) { $string($x) })`, 12},
+		{`items.$string(price)`, 7},
+	} {
+		var stats EvalStats
+		ctx := WithEvalStats(context.Background(), &stats)
+		if _, err := comp.MustCompile(test.Expr).EvalContext(ctx, data, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.Expr, err)
+		}
+		if stats.Nodes != test.Nodes {
+			t.Errorf("%s: expected %d nodes, got %d", test.Expr, test.Nodes, stats.Nodes)
+		}
+	}
+}
+
+func TestWithEvalStats_Operators(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	// Operands of numeric, comparison and boolean operators
+	// are counted even though they're evaluated without eval.
+	for _, test := range []struct {
+		Expr  string
+		Nodes int64
+	}{
+		{`1 + 2 * (3 - -4)`, 8},
+		{`1 < 2 and true`, 5},
+		{`1 + 2 > 2 ? 1 : 0`, 7},
+	} {
+		var stats EvalStats
+		ctx := WithEvalStats(context.Background(), &stats)
+		if _, err := comp.MustCompile(test.Expr).EvalContext(ctx, nil, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.Expr, err)
+		}
+		if stats.Nodes != test.Nodes {
+			t.Errorf("%s: expected %d nodes, got %d", test.Expr, test.Nodes, stats.Nodes)
+		}
+	}
+}
+
+func TestWithEvalStats_Parallel(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil, WithParallelism(4))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	var stats EvalStats
+	ctx := WithEvalStats(context.Background(), &stats)
+
+	if _, err := comp.MustCompile(`[1..5000].$string($)`).EvalContext(ctx, nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Every goroutine's calls are counted.
+	if stats.Calls != 5000 || stats.BuiltinCalls != 5000 {
+		t.Errorf("expected 5000 built-in calls, got %d (%d built-in)", stats.Calls, stats.BuiltinCalls)
+	}
+}
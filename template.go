@@ -0,0 +1,397 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iwongu/jsonata-go/jlib"
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// A Template is a JSON document with JSONata expressions
+// embedded in its strings, between {{ and }}. Evaluating a
+// Template against an input returns a copy of the document with
+// the expressions replaced by their results:
+//
+//   - A string that consists of a single expression, such as
+//     "{{ order.total * 1.2 }}", is replaced by the expression's
+//     result, which can be of any type. If the result is
+//     undefined, the string is left out of its object or array.
+//   - In any other string, such as "Order {{ order.id }}", each
+//     expression is replaced by its result converted to a
+//     string, as by $string. Undefined results are replaced by
+//     the empty string.
+//
+// Object keys and values other than strings are copied as they
+// are. All of the expressions are compiled once, when the
+// Template is compiled, and pure subexpressions that appear in
+// more than one of them are evaluated once per input (see
+// Bundle).
+//
+// A Template is safe for concurrent use.
+type Template struct {
+	root  templateNode
+	exprs []*Expression
+	plan  *sharedPlan
+}
+
+// CompileTemplate compiles a template document. The document must
+// contain only the types produced by encoding/json, i.e. maps
+// with string keys, slices of interface{}, strings, float64,
+// json.Number, bools and nil.
+func (c *Compiler) CompileTemplate(doc interface{}) (*Template, error) {
+
+	t := &Template{}
+
+	root, err := t.compile(c, doc, "")
+	if err != nil {
+		return nil, err
+	}
+	t.root = root
+
+	roots := make([]jparse.Node, len(t.exprs))
+	for i, e := range t.exprs {
+		roots[i] = e.art.pin().node
+	}
+	t.plan = newSharedPlan(roots)
+
+	return t, nil
+}
+
+// ParseTemplate decodes a template document from JSON and
+// compiles it. See CompileTemplate.
+func (c *Compiler) ParseTemplate(data []byte) (*Template, error) {
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("cannot parse template: %w", err)
+	}
+
+	return c.CompileTemplate(doc)
+}
+
+// Eval instantiates the template with the given input and
+// variables. It returns ErrUndefined if the whole template is a
+// single expression that evaluates to undefined. Errors are
+// prefixed with the location of the failing expression in the
+// template, as a JSON Pointer.
+func (t *Template) Eval(data interface{}, vars map[string]interface{}) (interface{}, error) {
+	return t.EvalContext(context.Background(), data, vars)
+}
+
+// EvalContext is like Eval but uses ctx for the evaluations. See
+// Expression.EvalContext.
+func (t *Template) EvalContext(ctx context.Context, data interface{}, vars map[string]interface{}) (interface{}, error) {
+
+	if len(t.exprs) > 0 {
+		ctx = t.exprs[0].evalIDContext(ctx)
+	}
+
+	s := &templateState{
+		ctx:   ctx,
+		data:  data,
+		vars:  vars,
+		exprs: t.exprs,
+		cache: &sharedCache{
+			plan:   t.plan,
+			values: map[string]reflect.Value{},
+		},
+	}
+
+	// The expressions come from the same compiler, so they
+	// can share a base environment.
+	if len(t.exprs) > 0 {
+		s.base = t.exprs[0].newBaseEnv()
+	}
+
+	res, ok, err := t.root.instantiate(s)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUndefined
+	}
+
+	return res, nil
+}
+
+func (t *Template) compile(c *Compiler, v interface{}, path string) (templateNode, error) {
+
+	switch v := v.(type) {
+	case string:
+		return t.compileString(c, v, path)
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		node := templateObject{
+			keys:   keys,
+			values: make([]templateNode, len(keys)),
+		}
+		for i, key := range keys {
+			value, err := t.compile(c, v[key], path+"/"+escapePointer(key))
+			if err != nil {
+				return nil, err
+			}
+			node.values[i] = value
+		}
+		return node, nil
+
+	case []interface{}:
+		node := make(templateArray, len(v))
+		for i, item := range v {
+			value, err := t.compile(c, item, path+"/"+strconv.Itoa(i))
+			if err != nil {
+				return nil, err
+			}
+			node[i] = value
+		}
+		return node, nil
+
+	case nil, bool, float64, json.Number:
+		return templateLiteral{v}, nil
+
+	default:
+		return nil, fmt.Errorf("template %s: unsupported type %T", pointerName(path), v)
+	}
+}
+
+// compileString splits a string into literal text and embedded
+// expressions. An expression ends at the first }} after which
+// the expression parses, so expressions can contain braces.
+func (t *Template) compileString(c *Compiler, s string, path string) (templateNode, error) {
+
+	var parts []templatePart
+
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			break
+		}
+
+		if start > 0 {
+			parts = append(parts, templatePart{text: s[:start]})
+		}
+		s = s[start+2:]
+
+		end, e, err := compileEmbedded(c, s)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", pointerName(path), err)
+		}
+
+		parts = append(parts, templatePart{expr: len(t.exprs) + 1})
+		t.exprs = append(t.exprs, e)
+		s = s[end+2:]
+	}
+
+	if len(parts) == 0 {
+		return templateLiteral{s}, nil
+	}
+
+	if s != "" {
+		parts = append(parts, templatePart{text: s})
+	}
+
+	if len(parts) == 1 && parts[0].expr > 0 {
+		return templateExpr{
+			index: parts[0].expr - 1,
+			path:  path,
+		}, nil
+	}
+
+	return templateString{
+		parts: parts,
+		path:  path,
+	}, nil
+}
+
+// compileEmbedded compiles the expression at the start of s and
+// returns the position of the }} that closes it.
+func compileEmbedded(c *Compiler, s string) (int, *Expression, error) {
+
+	var firstErr error
+
+	for pos := 0; ; {
+		end := strings.Index(s[pos:], "}}")
+		if end < 0 {
+			break
+		}
+		end += pos
+
+		e, err := c.Compile(s[:end])
+		if err == nil {
+			return end, e, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		pos = end + 1
+	}
+
+	if firstErr == nil {
+		firstErr = fmt.Errorf("missing }}")
+	}
+
+	return 0, nil, firstErr
+}
+
+// escapePointer escapes a key for use in a JSON Pointer.
+func escapePointer(key string) string {
+	key = strings.Replace(key, "~", "~0", -1)
+	return strings.Replace(key, "/", "~1", -1)
+}
+
+func pointerName(path string) string {
+	if path == "" {
+		return "root"
+	}
+	return strconv.Quote(path)
+}
+
+type templateState struct {
+	ctx   context.Context
+	data  interface{}
+	vars  map[string]interface{}
+	base  *environment
+	cache *sharedCache
+	exprs []*Expression
+}
+
+// eval evaluates the expression at index i. The path is used in
+// error messages.
+func (s *templateState) eval(i int, path string) (interface{}, bool, error) {
+
+	res, err := s.exprs[i].evalWithBase(s.ctx, s.base, s.data, s.vars, s.cache)
+	if err == ErrUndefined {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("template %s: %w", pointerName(path), err)
+	}
+
+	return res, true, nil
+}
+
+// A templateNode is a compiled part of a template document. Its
+// instantiate method returns false if the node is undefined.
+type templateNode interface {
+	instantiate(*templateState) (interface{}, bool, error)
+}
+
+type templateLiteral struct {
+	value interface{}
+}
+
+func (n templateLiteral) instantiate(*templateState) (interface{}, bool, error) {
+	return n.value, true, nil
+}
+
+type templateObject struct {
+	keys   []string
+	values []templateNode
+}
+
+func (n templateObject) instantiate(s *templateState) (interface{}, bool, error) {
+
+	obj := make(map[string]interface{}, len(n.keys))
+
+	for i, key := range n.keys {
+		v, ok, err := n.values[i].instantiate(s)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			obj[key] = v
+		}
+	}
+
+	return obj, true, nil
+}
+
+type templateArray []templateNode
+
+func (n templateArray) instantiate(s *templateState) (interface{}, bool, error) {
+
+	arr := make([]interface{}, 0, len(n))
+
+	for _, item := range n {
+		v, ok, err := item.instantiate(s)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			arr = append(arr, v)
+		}
+	}
+
+	return arr, true, nil
+}
+
+type templateExpr struct {
+	index int
+	path  string
+}
+
+func (n templateExpr) instantiate(s *templateState) (interface{}, bool, error) {
+	return s.eval(n.index, n.path)
+}
+
+// A templatePart is either literal text or, if expr is non-zero,
+// the expression at index expr-1.
+type templatePart struct {
+	text string
+	expr int
+}
+
+type templateString struct {
+	parts []templatePart
+	path  string
+}
+
+func (n templateString) instantiate(s *templateState) (interface{}, bool, error) {
+
+	var b strings.Builder
+
+	for _, part := range n.parts {
+
+		if part.expr == 0 {
+			b.WriteString(part.text)
+			continue
+		}
+
+		v, ok, err := s.eval(part.expr-1, n.path)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			continue
+		}
+
+		if str, ok := v.(string); ok {
+			b.WriteString(str)
+			continue
+		}
+
+		str, err := jlib.String(v)
+		if err != nil {
+			return nil, false, fmt.Errorf("template %s: %w", pointerName(n.path), err)
+		}
+		b.WriteString(str)
+	}
+
+	return b.String(), true, nil
+}
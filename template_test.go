@@ -0,0 +1,134 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompiler_ParseTemplate(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	tmpl, err := comp.ParseTemplate([]byte(`{
+		"id": "{{ order.id }}",
+		"title": "Order {{ order.id }} for {{ customer.name }}{{ missing }}",
+		"gross": "{{ order.total * 1.2 }}",
+		"items": ["{{ order.items[price > 10].name }}", "{{ missing }}", "fixed", 3],
+		"summary": "{{ {'count': $count(order.items), 'max': $max(order.items.price)} }}",
+		"note": "{{ missing }}",
+		"flags": {"rush": "{{ $rush }}", "empty": null},
+		"plain": "no expressions"
+	}`))
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"order": map[string]interface{}{
+			"id":    42,
+			"total": 100.0,
+			"items": []interface{}{
+				map[string]interface{}{"name": "pen", "price": 5},
+				map[string]interface{}{"name": "book", "price": 20},
+			},
+		},
+		"customer": map[string]interface{}{
+			"name": "Ada",
+		},
+	}
+
+	got, err := tmpl.Eval(input, map[string]interface{}{"rush": true})
+	if err != nil {
+		t.Fatalf("Eval failed: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"id":    42,
+		"title": "Order 42 for Ada",
+		"gross": 120.0,
+		"items": []interface{}{"book", "fixed", float64(3)},
+		"summary": map[string]interface{}{
+			"count": 2,
+			"max":   float64(20),
+		},
+		"flags": map[string]interface{}{
+			"rush":  true,
+			"empty": nil,
+		},
+		"plain": "no expressions",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// A template that is a single expression can be undefined.
+	tmpl, err = comp.CompileTemplate("{{ missing }}")
+	if err != nil {
+		t.Fatalf("CompileTemplate failed: %v", err)
+	}
+	if _, err := tmpl.Eval(input, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+}
+
+func TestCompiler_CompileTemplateErrors(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	compileErrors := []struct {
+		doc  interface{}
+		want string
+	}{
+		{
+			doc:  map[string]interface{}{"a": []interface{}{"{{ 1 + }}"}},
+			want: `template "/a/0": `,
+		},
+		{
+			doc:  map[string]interface{}{"a/b": "{{ x"},
+			want: `template "/a~1b": missing }}`,
+		},
+		{
+			doc:  "{{}}",
+			want: `template root: `,
+		},
+		{
+			doc:  map[string]interface{}{"n": 1},
+			want: `template "/n": unsupported type int`,
+		},
+	}
+
+	for _, test := range compileErrors {
+		_, err := comp.CompileTemplate(test.doc)
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%v: expected error %q, got %v", test.doc, test.want, err)
+		}
+	}
+
+	if _, err := comp.ParseTemplate([]byte(`{`)); err == nil {
+		t.Errorf("expected error for invalid JSON")
+	}
+
+	tmpl, err := comp.CompileTemplate(map[string]interface{}{
+		"x": []interface{}{"value: {{ $string(a) & 1 + 'b' }}"},
+	})
+	if err != nil {
+		t.Fatalf("CompileTemplate failed: %v", err)
+	}
+
+	_, err = tmpl.Eval(map[string]interface{}{"a": 1}, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), `template "/x/0": `) {
+		t.Errorf("expected error at /x/0, got %v", err)
+	}
+}
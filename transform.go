@@ -0,0 +1,57 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+)
+
+// A TransformResult is the outcome of evaluating one value
+// received by Transform. Input is the value itself, e.g. so that
+// a consumer can acknowledge the message that it came from. Err
+// is ErrUndefined if the result is undefined.
+type TransformResult struct {
+	Input interface{}
+	Value interface{}
+	Err   error
+}
+
+// Transform evaluates the expression against each value received
+// from in, with no variables, and sends the results to out in
+// the same order. It returns nil when in is closed, or ctx.Err()
+// if ctx is done first. Failed evaluations are sent to out like
+// any other result and don't stop the transform.
+//
+// Transform waits for out to accept each result before it
+// receives the next value, so a slow consumer slows the
+// producer down. It doesn't close out, so several Transforms
+// can send to the same channel, e.g. to spread the work over
+// more goroutines at the cost of ordering.
+func (e *Expression) Transform(ctx context.Context, in <-chan interface{}, out chan<- TransformResult) error {
+
+	ev := e.NewEvaluator()
+
+	for {
+		var data interface{}
+		var ok bool
+
+		select {
+		case data, ok = <-in:
+			if !ok {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		v, err := ev.EvalContext(ctx, data, nil)
+
+		select {
+		case out <- TransformResult{Input: data, Value: v, Err: err}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpression_Transform(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`$uppercase(name)`)
+
+	in := make(chan interface{})
+	out := make(chan TransformResult)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Transform(context.Background(), in, out)
+	}()
+
+	inputs := []interface{}{
+		map[string]interface{}{"name": "a"},
+		map[string]interface{}{},
+		map[string]interface{}{"name": 1},
+		map[string]interface{}{"name": "b"},
+	}
+
+	go func() {
+		for _, v := range inputs {
+			in <- v
+		}
+		close(in)
+	}()
+
+	for i := range inputs {
+		res := <-out
+		if !reflect.DeepEqual(res.Input, inputs[i]) {
+			t.Errorf("result %d: expected input %v, got %v", i, inputs[i], res.Input)
+		}
+		switch i {
+		case 0:
+			if res.Err != nil || res.Value != "A" {
+				t.Errorf("result %d: expected A, got %v (error %v)", i, res.Value, res.Err)
+			}
+		case 3:
+			if res.Err != nil || res.Value != "B" {
+				t.Errorf("result %d: expected B, got %v (error %v)", i, res.Value, res.Err)
+			}
+		case 1:
+			if res.Err != ErrUndefined {
+				t.Errorf("result %d: expected ErrUndefined, got %v", i, res.Err)
+			}
+		case 2:
+			if res.Err == nil || res.Err == ErrUndefined {
+				t.Errorf("result %d: expected an evaluation error, got %v", i, res.Err)
+			}
+		}
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("expected nil after in was closed, got %v", err)
+	}
+}
+
+func TestExpression_TransformCancel(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`$`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Nobody reads out, so Transform blocks sending the first
+	// result until ctx is cancelled.
+	in := make(chan interface{}, 1)
+	in <- 1.0
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Transform(ctx, in, make(chan TransformResult))
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Transform didn't return after ctx was cancelled")
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iwongu/jsonata-go/jparse"
+)
+
+// CompilerStats describes the expressions compiled by a Compiler
+// that are still in use (see Compiler.Stats).
+type CompilerStats struct {
+	// Expressions is the number of expressions that haven't
+	// been garbage collected, including the expressions of
+	// Bundles, RuleSets and Templates.
+	Expressions int
+
+	// Resident is the number of expressions that hold their
+	// compiled form, and Trimmed is the number whose compiled
+	// form was dropped by Compiler.Trim.
+	Resident int
+	Trimmed  int
+
+	// Nodes is the number of syntax tree nodes held by the
+	// resident expressions. The memory used by an expression is
+	// roughly proportional to its number of nodes.
+	Nodes int
+
+	// SourceBytes is the total length of the sources of the
+	// expressions, which are kept even when an expression is
+	// trimmed.
+	SourceBytes int
+
+	// Recompiles is the number of times that a trimmed
+	// expression has been compiled again because it was used.
+	Recompiles int64
+}
+
+// Stats returns statistics about the expressions compiled by c,
+// for reporting the memory held by a long-running service.
+func (c *Compiler) Stats() CompilerStats {
+
+	var stats CompilerStats
+
+	r := c.exprs
+	if r == nil {
+		return stats
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for a := range r.exprs {
+		stats.Expressions++
+		stats.SourceBytes += len(a.source)
+		if k := a.load(); k != nil {
+			stats.Resident++
+			stats.Nodes += k.nodes
+		} else {
+			stats.Trimmed++
+		}
+	}
+	stats.Recompiles = atomic.LoadInt64(&r.recompiles)
+
+	return stats
+}
+
+// Trim drops the compiled form of the expressions compiled by c
+// that haven't been evaluated for at least idle, and returns the
+// number of expressions that it trimmed. A trimmed expression
+// keeps only its source and configuration. It is compiled again,
+// from its source, the next time it's used, so Trim is safe to
+// call at any time, e.g. periodically during quiet periods to
+// bound the memory of a service that holds thousands of
+// expressions. Evaluations that are in progress aren't affected.
+//
+// Expressions that have no source, such as those made by
+// CompileDecisionTable, and the expressions in Bundles, RuleSets
+// and Templates, which share compiled plans with each other,
+// aren't trimmed. Nor are expressions compiled with a Profile,
+// whose statistics refer to the compiled form.
+func (c *Compiler) Trim(idle time.Duration) int {
+
+	r := c.exprs
+	if r == nil {
+		return 0
+	}
+
+	cutoff := time.Now().Add(-idle).UnixNano()
+	n := 0
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for a := range r.exprs {
+		if a.trim(cutoff) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// An exprRegistry records the expressions compiled by a Compiler
+// that haven't been garbage collected. It holds their
+// exprArtifacts rather than the Expressions themselves, so that
+// it doesn't stop them from being collected.
+type exprRegistry struct {
+	mu         sync.Mutex
+	exprs      map[*exprArtifacts]struct{}
+	recompiles int64
+}
+
+func newExprRegistry() *exprRegistry {
+	return &exprRegistry{
+		exprs: map[*exprArtifacts]struct{}{},
+	}
+}
+
+func (r *exprRegistry) add(a *exprArtifacts) {
+	r.mu.Lock()
+	r.exprs[a] = struct{}{}
+	r.mu.Unlock()
+}
+
+func (r *exprRegistry) remove(a *exprArtifacts) {
+	r.mu.Lock()
+	delete(r.exprs, a)
+	r.mu.Unlock()
+}
+
+// A compiledExpr is the compiled form of an expression: its
+// syntax tree and the plans of the optimized backend.
+type compiledExpr struct {
+	node      jparse.Node
+	ranges    map[jparse.Node]jparse.Range
+	kernels   map[jparse.Node]filterKernel
+	accessors map[*jparse.PathNode]*pathAccessor
+	fast      *fastPath
+	parallel  *parallelPlan
+	memo      *memoPlan
+	fallback  error
+	nodes     int
+}
+
+// exprArtifacts holds the compiledExpr of an Expression, which
+// may be dropped by Compiler.Trim and rebuilt from the source.
+type exprArtifacts struct {
+	source    string
+	rewriters []Rewriter
+	modules   map[string]bool
+	syntax    *jparse.Syntax
+	compile   func(node jparse.Node, ranges map[jparse.Node]jparse.Range) *compiledExpr
+	reg       *exprRegistry
+	base      *baseTemplate
+
+	v      atomic.Value // *compiledExpr
+	mu     sync.Mutex
+	used   int64
+	pinned int32
+}
+
+// load returns the compiledExpr, or nil if it has been trimmed.
+func (a *exprArtifacts) load() *compiledExpr {
+	k, _ := a.v.Load().(*compiledExpr)
+	return k
+}
+
+// get returns the compiledExpr, compiling the source again if it
+// has been trimmed.
+func (a *exprArtifacts) get() *compiledExpr {
+
+	if a.source != "" {
+		atomic.StoreInt64(&a.used, time.Now().UnixNano())
+	}
+
+	if k := a.load(); k != nil {
+		return k
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if k := a.load(); k != nil {
+		return k
+	}
+
+	node, ranges, err := a.syntax.ParseRanges(a.source)
+	if err != nil {
+		// The source compiled before, so this can't happen.
+		panicf("could not recompile %s: %s", a.source, err)
+	}
+
+	if node, err = applyRewriters(a.rewriters, node); err != nil {
+		// Rewriters must give the same result each time.
+		panicf("could not rewrite %s: %s", a.source, err)
+	}
+	resolveModuleCalls(node, ranges, a.modules)
+
+	k := a.compile(node, ranges)
+	a.v.Store(k)
+	atomic.AddInt64(&a.reg.recompiles, 1)
+
+	return k
+}
+
+// pin stops the compiledExpr from being trimmed and returns it.
+func (a *exprArtifacts) pin() *compiledExpr {
+	atomic.StoreInt32(&a.pinned, 1)
+	return a.get()
+}
+
+// trim drops the compiledExpr if it hasn't been used since
+// cutoff, and returns true if it did.
+func (a *exprArtifacts) trim(cutoff int64) bool {
+
+	if a.source == "" || a.reg == nil || atomic.LoadInt32(&a.pinned) != 0 || atomic.LoadInt64(&a.used) > cutoff {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.load() == nil {
+		return false
+	}
+
+	a.v.Store((*compiledExpr)(nil))
+	return true
+}
+
+// newArtifacts returns the exprArtifacts for a new Expression
+// and records them in the Compiler's registry, if it has one,
+// until the Expression is garbage collected.
+func (c *Compiler) newArtifacts(e *Expression, node jparse.Node, ranges map[jparse.Node]jparse.Range) *exprArtifacts {
+
+	// Recompiling uses the settings that the expression was
+	// compiled with, even if the Compiler has changed since.
+	plans := &Compiler{
+		equal:       c.equal,
+		accessors:   c.accessors,
+		parallelism: c.parallelism,
+		memoize:     c.memoize,
+		backend:     c.backend,
+	}
+
+	a := &exprArtifacts{
+		source:    e.source,
+		rewriters: c.rewriters,
+		modules:   c.moduleNames(),
+		syntax:    c.syntax,
+		compile:   plans.compileExpr,
+		reg:       c.exprs,
+		base:      newBaseTemplate(e.baseRegistry),
+		used:      time.Now().UnixNano(),
+	}
+	if c.profile != nil {
+		a.pinned = 1
+	}
+	a.v.Store(c.compileExpr(node, ranges))
+
+	if r := a.reg; r != nil {
+		r.add(a)
+		runtime.SetFinalizer(e, func(*Expression) {
+			r.remove(a)
+		})
+	}
+
+	return a
+}
+
+// compileExpr returns the compiled form of a syntax tree.
+func (c *Compiler) compileExpr(node jparse.Node, ranges map[jparse.Node]jparse.Range) *compiledExpr {
+
+	k := &compiledExpr{
+		node:   node,
+		ranges: ranges,
+	}
+
+	jparse.Walk(node, func(jparse.Node) bool {
+		k.nodes++
+		return true
+	})
+
+	k.fallback = c.compilePlans(k, node)
+	return k
+}
+
+// compiled returns the compiled form of e, compiling it again if
+// it has been trimmed. Callers should use the result for the
+// whole of an operation because a later call may return a
+// different syntax tree.
+func (e *Expression) compiled() *compiledExpr {
+	return e.art.get()
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompiler_Trim(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"Order": []interface{}{
+			map[string]interface{}{"Price": 2.0, "Qty": 3.0},
+			map[string]interface{}{"Price": 5.0, "Qty": 1.0},
+		},
+	}
+
+	srcs := []string{`$sum(Order.(Price * Qty))`, `Order[Price > 3].Qty`, `$sum(Order.Price)`}
+
+	hot := comp.MustCompile(srcs[0])
+	cold := comp.MustCompile(srcs[1])
+	bundle, err := comp.CompileBundle(map[string]string{"total": srcs[2]})
+	if err != nil {
+		t.Fatalf("CompileBundle failed: %v", err)
+	}
+
+	stats := comp.Stats()
+	if stats.Expressions != 3 || stats.Resident != 3 || stats.Trimmed != 0 || stats.Nodes == 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if want := len(srcs[0]) + len(srcs[1]) + len(srcs[2]); stats.SourceBytes != want {
+		t.Errorf("expected %d source bytes, got %d", want, stats.SourceBytes)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := hot.Eval(data, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only the idle expression is trimmed. Expressions in a
+	// Bundle are never trimmed.
+	if n := comp.Trim(10 * time.Millisecond); n != 1 {
+		t.Errorf("expected 1 trimmed expression, got %d", n)
+	}
+	if n := comp.Trim(0); n != 1 {
+		t.Errorf("expected 1 more trimmed expression, got %d", n)
+	}
+
+	stats = comp.Stats()
+	if stats.Resident != 1 || stats.Trimmed != 2 || stats.Recompiles != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// Trimmed expressions are compiled again when they're
+	// used.
+	for i, test := range []struct {
+		Expr   *Expression
+		Output interface{}
+	}{
+		{hot, 11.0},
+		{cold, 1.0},
+	} {
+		got, err := test.Expr.Eval(data, nil)
+		if err != nil || got != test.Output {
+			t.Errorf("%s: expected %v, got %v (%v)", srcs[i], test.Output, got, err)
+		}
+	}
+
+	if _, err := bundle.Eval(data, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	stats = comp.Stats()
+	if stats.Resident != 3 || stats.Trimmed != 0 || stats.Recompiles != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCompiler_TrimConcurrent(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`$sum([1..10][$ % 2 = 0])`)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				comp.Trim(0)
+			}
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if got, err := e.Eval(nil, nil); err != nil || got != 30.0 {
+					t.Errorf("expected 30, got %v (%v)", got, err)
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+)
+
+// Strings evaluates the expression and returns the result as a
+// slice of strings. A single string is returned as a slice of
+// one item, as in a JSONata sequence. Like Eval, it returns
+// ErrUndefined if the expression evaluates to undefined, and
+// it returns an error if the result contains a value that isn't
+// a string, other than null, which is returned as "".
+func (e *Expression) Strings(data interface{}, vars map[string]interface{}) ([]string, error) {
+	var results []string
+	err := e.evalInto(data, vars, &results)
+	return results, err
+}
+
+// Float64s is like Strings but for numbers.
+func (e *Expression) Float64s(data interface{}, vars map[string]interface{}) ([]float64, error) {
+	var results []float64
+	err := e.evalInto(data, vars, &results)
+	return results, err
+}
+
+// Bools is like Strings but for booleans.
+func (e *Expression) Bools(data interface{}, vars map[string]interface{}) ([]bool, error) {
+	var results []bool
+	err := e.evalInto(data, vars, &results)
+	return results, err
+}
+
+// evalInto evaluates the expression and decodes the result into
+// the value that dst points to (see Result.Decode).
+func (e *Expression) evalInto(data interface{}, vars map[string]interface{}, dst interface{}) error {
+
+	res, err := e.EvalResult(context.Background(), data, vars)
+	if err != nil {
+		return err
+	}
+
+	return res.Decode(dst)
+}
@@ -0,0 +1,30 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package jsonata
+
+// EvalAs evaluates e and decodes the result into a value of type
+// T, following the rules of Result.Decode, e.g.
+//
+//	total, err := jsonata.EvalAs[float64](e, order, nil)
+//	lines, err := jsonata.EvalAs[[]Line](e, order, nil)
+//
+// Like Eval, it returns ErrUndefined if the expression evaluates
+// to undefined. On an error, the zero value of T is returned.
+// EvalAs requires Go 1.18; Strings, Float64s and Bools cover the
+// common cases for earlier versions.
+func EvalAs[T any](e *Expression, data interface{}, vars map[string]interface{}) (T, error) {
+
+	var result T
+
+	if err := e.evalInto(data, vars, &result); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package jsonata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvalAs(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	type line struct {
+		SKU string `json:"sku"`
+		Qty int    `json:"qty"`
+	}
+
+	input := map[string]interface{}{
+		"lines": []interface{}{
+			map[string]interface{}{"sku": "a", "qty": 2},
+			map[string]interface{}{"sku": "b", "qty": 1},
+		},
+	}
+
+	total, err := EvalAs[int](comp.MustCompile(`$sum(lines.qty)`), input, nil)
+	if err != nil || total != 3 {
+		t.Errorf("expected 3, got %v (error %v)", total, err)
+	}
+
+	lines, err := EvalAs[[]line](comp.MustCompile(`lines[qty > 1]`), input, nil)
+	if want := []line{{SKU: "a", Qty: 2}}; err != nil || !reflect.DeepEqual(lines, want) {
+		t.Errorf("expected %v, got %v (error %v)", want, lines, err)
+	}
+
+	if v, err := EvalAs[string](comp.MustCompile(`lines.missing`), input, nil); err != ErrUndefined || v != "" {
+		t.Errorf("expected ErrUndefined, got %q (error %v)", v, err)
+	}
+
+	if v, err := EvalAs[int](comp.MustCompile(`lines[0].sku`), input, nil); err == nil || v != 0 {
+		t.Errorf("expected an error and 0, got %v (error %v)", v, err)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpression_TypedResults(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	input := map[string]interface{}{
+		"lines": []interface{}{
+			map[string]interface{}{"sku": "a", "qty": 2, "gift": true},
+			map[string]interface{}{"sku": "b", "qty": 1.5, "gift": false},
+		},
+	}
+
+	strs, err := comp.MustCompile(`lines.sku`).Strings(input, nil)
+	if err != nil || !reflect.DeepEqual(strs, []string{"a", "b"}) {
+		t.Errorf("Strings: expected [a b], got %v (error %v)", strs, err)
+	}
+
+	strs, err = comp.MustCompile(`lines[0].sku`).Strings(input, nil)
+	if err != nil || !reflect.DeepEqual(strs, []string{"a"}) {
+		t.Errorf("Strings: expected a single string to be [a], got %v (error %v)", strs, err)
+	}
+
+	nums, err := comp.MustCompile(`lines.qty`).Float64s(input, nil)
+	if err != nil || !reflect.DeepEqual(nums, []float64{2, 1.5}) {
+		t.Errorf("Float64s: expected [2 1.5], got %v (error %v)", nums, err)
+	}
+
+	bools, err := comp.MustCompile(`lines.gift`).Bools(input, nil)
+	if err != nil || !reflect.DeepEqual(bools, []bool{true, false}) {
+		t.Errorf("Bools: expected [true false], got %v (error %v)", bools, err)
+	}
+
+	if _, err := comp.MustCompile(`lines.missing`).Strings(input, nil); err != ErrUndefined {
+		t.Errorf("expected ErrUndefined, got %v", err)
+	}
+
+	if strs, err := comp.MustCompile(`lines.qty`).Strings(input, nil); err == nil {
+		t.Errorf("expected an error for numbers, got %v", strs)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+)
+
+// An UndefinedMode specifies what EvalWithUndefined returns when
+// an expression evaluates to undefined.
+type UndefinedMode int
+
+const (
+	// UndefinedError returns a nil result and ErrUndefined,
+	// like EvalContext.
+	UndefinedError UndefinedMode = iota
+
+	// UndefinedNil returns a nil result and a nil error, so that
+	// an undefined result can't be told apart from null.
+	UndefinedNil
+
+	// UndefinedSentinel returns Undefined and a nil error.
+	UndefinedSentinel
+)
+
+// IsValid reports whether m is a recognised undefined mode.
+func (m UndefinedMode) IsValid() bool {
+	return m >= UndefinedError && m <= UndefinedSentinel
+}
+
+// Undefined is the result of an expression that evaluates to
+// undefined, for evaluations with UndefinedSentinel.
+// Compare results with it using ==. It isn't a JSON value, so
+// check for it before encoding a result.
+var Undefined interface{} = undefinedResult{}
+
+type undefinedResult struct{}
+
+func (undefinedResult) String() string {
+	return "undefined"
+}
+
+// EvalWithUndefined is like EvalContext except that mode sets
+// what it returns when the result is undefined, e.g. when a path
+// matches nothing. EvalContext returns ErrUndefined, which means
+// that every caller has to tell "no match" apart from a failure:
+//
+//	v, err := e.Eval(data, nil)
+//	if err == jsonata.ErrUndefined {
+//		// no match
+//	} else if err != nil {
+//		return err
+//	}
+//
+// With UndefinedNil or UndefinedSentinel, only failures are
+// errors. Other ways of evaluating an expression, such as
+// EvalResult, EvalBatch and the jhttp handlers, report undefined
+// results as ErrUndefined.
+func (e *Expression) EvalWithUndefined(ctx context.Context, data interface{}, vars map[string]interface{}, mode UndefinedMode) (interface{}, error) {
+	return mode.result(e.EvalContext(ctx, data, vars))
+}
+
+// EvalWithUndefined is like EvalContext except that mode sets
+// what it returns when the result is undefined. See
+// Expression.EvalWithUndefined.
+func (ev *Evaluator) EvalWithUndefined(ctx context.Context, data interface{}, vars map[string]interface{}, mode UndefinedMode) (interface{}, error) {
+	return mode.result(ev.EvalContext(ctx, data, vars))
+}
+
+// result applies m to the result of an evaluation.
+func (m UndefinedMode) result(v interface{}, err error) (interface{}, error) {
+
+	if !m.IsValid() {
+		return nil, fmt.Errorf("invalid undefined mode %d", m)
+	}
+
+	if err != ErrUndefined {
+		return v, err
+	}
+
+	switch m {
+	case UndefinedNil:
+		return nil, nil
+	case UndefinedSentinel:
+		return Undefined, nil
+	default:
+		return nil, ErrUndefined
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestExpression_EvalWithUndefined(t *testing.T) {
+
+	data := map[string]interface{}{
+		"name": "Alice",
+	}
+
+	tests := []struct {
+		Mode    UndefinedMode
+		Missing interface{}
+		Err     error
+	}{
+		{UndefinedError, nil, ErrUndefined},
+		{UndefinedNil, nil, nil},
+		{UndefinedSentinel, Undefined, nil},
+	}
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	ctx := context.Background()
+	missing := comp.MustCompile(`phone`)
+	ev := missing.NewEvaluator()
+
+	for _, test := range tests {
+
+		for _, eval := range []func() (interface{}, error){
+			func() (interface{}, error) { return missing.EvalWithUndefined(ctx, data, nil, test.Mode) },
+			func() (interface{}, error) { return ev.EvalWithUndefined(ctx, data, nil, test.Mode) },
+			func() (interface{}, error) {
+				return Pipe(comp.MustCompile(`$`), missing).EvalWithUndefined(ctx, data, nil, test.Mode)
+			},
+		} {
+			if got, err := eval(); got != test.Missing || err != test.Err {
+				t.Errorf("mode %d: expected %v (error %v), got %v (error %v)", test.Mode, test.Missing, test.Err, got, err)
+			}
+		}
+
+		// Defined results, including null, and failures are
+		// unaffected.
+		if got, err := comp.MustCompile(`null`).EvalWithUndefined(ctx, data, nil, test.Mode); got != nil || err != nil {
+			t.Errorf("mode %d: expected null, got %v (error %v)", test.Mode, got, err)
+		}
+		if got, err := comp.MustCompile(`name`).EvalWithUndefined(ctx, data, nil, test.Mode); got != "Alice" || err != nil {
+			t.Errorf("mode %d: expected Alice, got %v (error %v)", test.Mode, got, err)
+		}
+		if _, err := comp.MustCompile(`$error("boom")`).EvalWithUndefined(ctx, data, nil, test.Mode); err == nil || err == ErrUndefined {
+			t.Errorf("mode %d: expected an error, got %v", test.Mode, err)
+		}
+	}
+
+	// Other ways of evaluating report ErrUndefined.
+	if _, err := missing.Eval(data, nil); err != ErrUndefined {
+		t.Errorf("Eval: expected ErrUndefined, got %v", err)
+	}
+	if _, err := ev.Eval(data, nil); err != ErrUndefined {
+		t.Errorf("Evaluator: expected ErrUndefined, got %v", err)
+	}
+
+	if s := fmt.Sprint(Undefined); s != "undefined" {
+		t.Errorf("expected undefined, got %s", s)
+	}
+
+	if _, err := missing.EvalWithUndefined(ctx, data, nil, UndefinedMode(99)); err == nil {
+		t.Errorf("expected error for invalid undefined mode")
+	}
+}
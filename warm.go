@@ -0,0 +1,119 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Warm does the one-time work that the first evaluation of e
+// would otherwise do: it compiles the expression again if it was
+// trimmed (see Compiler.Trim) and prepares the list of functions
+// that every evaluation copies into its environment. Calling Warm
+// before an expression starts serving requests, e.g. right after
+// a deploy, keeps that work out of the first request's latency.
+// Warm doesn't evaluate anything, so it's safe for expressions
+// whose extensions have side effects. It's safe to call more
+// than once and at the same time as evaluations.
+func (e *Expression) Warm() {
+	e.art.warm()
+}
+
+// Warm warms every expression compiled by c that hasn't been
+// garbage collected, as Expression.Warm does, and returns the
+// number of expressions.
+func (c *Compiler) Warm() int {
+
+	r := c.exprs
+	if r == nil {
+		return 0
+	}
+
+	r.mu.Lock()
+	arts := make([]*exprArtifacts, 0, len(r.exprs))
+	for a := range r.exprs {
+		arts = append(arts, a)
+	}
+	r.mu.Unlock()
+
+	for _, a := range arts {
+		a.warm()
+	}
+
+	return len(arts)
+}
+
+func (a *exprArtifacts) warm() {
+	a.get()
+	a.base.get()
+}
+
+// A baseTemplate lists the values that newBaseEnv binds in the
+// environment of every evaluation: the built-in functions, which
+// are cloned, and the expression's base registry. It's built the
+// first time it's needed, or by Warm.
+type baseTemplate struct {
+	registry map[string]reflect.Value
+
+	once    sync.Once
+	entries []baseEntry
+}
+
+// A baseEntry is a value in a baseTemplate. If the value is a Go
+// function or an extension module, each evaluation gets a copy.
+type baseEntry struct {
+	name     string
+	value    reflect.Value
+	callable *goCallable
+	module   extensionModule
+}
+
+func newBaseTemplate(registry map[string]reflect.Value) *baseTemplate {
+	return &baseTemplate{
+		registry: registry,
+	}
+}
+
+// get returns the template's entries, building them if
+// necessary.
+func (t *baseTemplate) get() []baseEntry {
+	t.once.Do(t.build)
+	return t.entries
+}
+
+func (t *baseTemplate) build() {
+
+	var entries []baseEntry
+
+	// Built-ins that the base registry replaces aren't cloned.
+	if baseEnv != nil {
+		for name, v := range baseEnv.symbols {
+			if _, ok := t.registry[name]; ok {
+				continue
+			}
+			if v.IsValid() && v.CanInterface() {
+				if gc, ok := v.Interface().(*goCallable); ok {
+					entries = append(entries, baseEntry{name: name, callable: gc})
+				}
+			}
+		}
+	}
+
+	for name, v := range t.registry {
+		entry := baseEntry{name: name, value: v}
+		if v.IsValid() && v.CanInterface() {
+			switch x := v.Interface().(type) {
+			case *goCallable:
+				entry.callable = x
+			case extensionModule:
+				entry.module = x
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	t.entries = entries
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Blues Inc.  All rights reserved.
+// Use of this source code is governed by licenses granted by the
+// copyright holder including that found in the LICENSE file.
+
+package jsonata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpression_Warm(t *testing.T) {
+
+	comp, err := NewCompiler(nil, map[string]Extension{
+		"upper": {Func: strings.ToUpper},
+	}, WithModule("text", map[string]Extension{
+		"trim": {Func: strings.TrimSpace},
+	}))
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	e := comp.MustCompile(`$upper($text.trim(name)) & $string($count(tags))`)
+	comp.Trim(0)
+
+	e.Warm()
+
+	if stats := comp.Stats(); stats.Resident != 1 || stats.Recompiles != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// Warming again does nothing.
+	e.Warm()
+
+	if stats := comp.Stats(); stats.Recompiles != 1 {
+		t.Errorf("expected 1 recompile, got %d", stats.Recompiles)
+	}
+
+	data := map[string]interface{}{
+		"name": " ada ",
+		"tags": []interface{}{"a", "b"},
+	}
+
+	got, err := e.Eval(data, nil)
+	if err != nil || got != "ADA2" {
+		t.Errorf("expected ADA2, got %v (%v)", got, err)
+	}
+}
+
+func TestCompiler_Warm(t *testing.T) {
+
+	comp, err := NewCompiler(nil, nil)
+	if err != nil {
+		t.Fatalf("NewCompiler failed: %v", err)
+	}
+
+	exprs := []*Expression{
+		comp.MustCompile(`a + b`),
+		comp.MustCompile(`$sum(items)`),
+		comp.MustCompile(`$count(items)`),
+	}
+
+	if n := comp.Trim(0); n != len(exprs) {
+		t.Errorf("expected %d trimmed expressions, got %d", len(exprs), n)
+	}
+
+	if n := comp.Warm(); n != len(exprs) {
+		t.Errorf("expected %d warmed expressions, got %d", len(exprs), n)
+	}
+
+	if stats := comp.Stats(); stats.Resident != len(exprs) || stats.Recompiles != int64(len(exprs)) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	for _, e := range exprs {
+		if _, err := e.Eval(map[string]interface{}{"a": 1.0, "b": 2.0, "items": []interface{}{1.0}}, nil); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}